@@ -0,0 +1,251 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// MinAlbumSize is the number of images or videos sent in a row that the official clients group into an album.
+// Fewer items are displayed as separate messages.
+const MinAlbumSize = 4
+
+// MaxAlbumSize is the maximum number of items that the official clients allow sending at once.
+const MaxAlbumSize = 30
+
+// DefaultAlbumWindow is the default maximum time between two items of an album in AlbumMiddleware.
+const DefaultAlbumWindow = 5 * time.Second
+
+// AlbumItem is a single image or video in an album sent with SendAlbum.
+type AlbumItem struct {
+	// The file to send.
+	Data []byte
+	// The type of the file, either MediaImage or MediaVideo.
+	Type MediaType
+	// The mime type of the file. If empty, it's detected from the data.
+	Mimetype string
+	Caption  string
+}
+
+// SendAlbum uploads the given images and videos and sends them to the chat one after another. The official clients
+// don't have a separate message type for albums: they group images and videos that are sent in a row, so all items
+// are uploaded before the first one is sent to keep the messages close together.
+//
+// The items are uploaded with Upload, so the transcoding hooks, Client.Thumbnailer and Client.ValidateOutgoingMedia
+// apply to them like to any other upload. If sending fails midway, the responses of the items that were already
+// sent are returned along with the error.
+//
+//	resps, err := cli.SendAlbum(ctx, chat, []whatsmeow.AlbumItem{
+//		{Data: photo1, Type: whatsmeow.MediaImage, Caption: "Day 1"},
+//		{Data: photo2, Type: whatsmeow.MediaImage},
+//		{Data: photo3, Type: whatsmeow.MediaImage},
+//		{Data: clip, Type: whatsmeow.MediaVideo},
+//	})
+func (cli *Client) SendAlbum(ctx context.Context, to types.JID, items []AlbumItem) ([]SendResponse, error) {
+	if len(items) < 2 || len(items) > MaxAlbumSize {
+		return nil, fmt.Errorf("%w (got %d items)", ErrInvalidAlbum, len(items))
+	}
+	for i, item := range items {
+		if item.Type != MediaImage && item.Type != MediaVideo {
+			return nil, fmt.Errorf("%w (item %d is %s)", ErrInvalidAlbum, i+1, item.Type)
+		}
+	}
+	messages := make([]*waProto.Message, len(items))
+	for i, item := range items {
+		var err error
+		messages[i], err = cli.buildAlbumItem(ctx, item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload album item %d: %w", i+1, err)
+		}
+	}
+	resps := make([]SendResponse, 0, len(messages))
+	for i, message := range messages {
+		resp, err := cli.SendMessage(ctx, to, "", message)
+		if err != nil {
+			return resps, fmt.Errorf("failed to send album item %d: %w", i+1, err)
+		}
+		resps = append(resps, resp)
+	}
+	return resps, nil
+}
+
+// buildAlbumItem uploads a single album item and builds the image or video message for it.
+func (cli *Client) buildAlbumItem(ctx context.Context, item AlbumItem) (*waProto.Message, error) {
+	mimetype := item.Mimetype
+	if len(mimetype) == 0 {
+		mimetype = sniffMediaMimetype(item.Data)
+	}
+	// The metadata is best-effort, it's replaced below if the file is converted while uploading
+	var width, height, seconds *uint32
+	if info, err := ValidateMedia(item.Data, item.Type, ""); err == nil {
+		if info.Width > 0 && info.Height > 0 {
+			width, height = proto.Uint32(uint32(info.Width)), proto.Uint32(uint32(info.Height))
+		}
+		if info.Duration > 0 {
+			seconds = proto.Uint32(uint32(info.Duration.Round(time.Second) / time.Second))
+		}
+	}
+	uploaded, err := cli.Upload(ctx, item.Data, item.Type)
+	if err != nil {
+		return nil, err
+	}
+	var caption *string
+	if len(item.Caption) > 0 {
+		caption = proto.String(item.Caption)
+	}
+	var msg *waProto.Message
+	if item.Type == MediaVideo {
+		msg = &waProto.Message{VideoMessage: &waProto.VideoMessage{
+			Url:               proto.String(uploaded.URL),
+			DirectPath:        proto.String(uploaded.DirectPath),
+			MediaKey:          uploaded.MediaKey,
+			Mimetype:          proto.String(mimetype),
+			FileEncSha256:     uploaded.FileEncSHA256,
+			FileSha256:        uploaded.FileSHA256,
+			FileLength:        proto.Uint64(uploaded.FileLength),
+			Caption:           caption,
+			Width:             width,
+			Height:            height,
+			Seconds:           seconds,
+			MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+		}}
+	} else {
+		msg = &waProto.Message{ImageMessage: &waProto.ImageMessage{
+			Url:               proto.String(uploaded.URL),
+			DirectPath:        proto.String(uploaded.DirectPath),
+			MediaKey:          uploaded.MediaKey,
+			Mimetype:          proto.String(mimetype),
+			FileEncSha256:     uploaded.FileEncSHA256,
+			FileSha256:        uploaded.FileSHA256,
+			FileLength:        proto.Uint64(uploaded.FileLength),
+			Caption:           caption,
+			Width:             width,
+			Height:            height,
+			MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+		}}
+	}
+	if len(uploaded.JPEGThumbnail) > 0 {
+		setThumbnail(msg, uploaded.JPEGThumbnail, uploaded.ThumbnailWidth, uploaded.ThumbnailHeight)
+	}
+	if len(uploaded.Mimetype) > 0 {
+		setTranscodedMetadata(msg, &uploaded)
+	}
+	return msg, nil
+}
+
+type pendingAlbum struct {
+	sender   types.JID
+	messages []*events.Message
+	timer    *time.Timer
+}
+
+type albumGrouper struct {
+	next    EventHandler
+	window  time.Duration
+	pending map[types.JID]*pendingAlbum
+	lock    sync.Mutex
+}
+
+// AlbumMiddleware returns middleware that groups images and videos sent in a row into Album events, like the
+// official clients display them. The Message events of the items are held back until the album is complete, which
+// is when another message is received in the chat or no more items arrive within the window. If the group has fewer
+// than MinAlbumSize items, the Message events are passed on as-is.
+//
+// The window is also the maximum difference between the timestamps of two items. If it's zero, DefaultAlbumWindow
+// is used. Albums completed by the window running out are dispatched from a separate goroutine, but events are never
+// handled concurrently by the rest of the chain.
+//
+//	cli.UseEventMiddleware(whatsmeow.AlbumMiddleware(0))
+//	cli.AddEventHandler(func(evt interface{}) {
+//		if album, ok := evt.(*events.Album); ok {
+//			fmt.Println(album.Sender, "sent", len(album.Messages), "images")
+//		}
+//	})
+func AlbumMiddleware(window time.Duration) EventMiddleware {
+	if window <= 0 {
+		window = DefaultAlbumWindow
+	}
+	return func(next EventHandler) EventHandler {
+		grouper := &albumGrouper{
+			next:    next,
+			window:  window,
+			pending: make(map[types.JID]*pendingAlbum),
+		}
+		return grouper.dispatch
+	}
+}
+
+// isAlbumItem returns true if the message is a normal image or video that can be a part of an album.
+func isAlbumItem(msg *events.Message) bool {
+	if msg.IsViewOnce || msg.IsEdit {
+		return false
+	}
+	return msg.Message.GetImageMessage() != nil || (msg.Message.GetVideoMessage() != nil && !msg.Message.GetVideoMessage().GetGifPlayback())
+}
+
+func (ag *albumGrouper) dispatch(evt interface{}) {
+	msg, ok := evt.(*events.Message)
+	if !ok {
+		ag.next(evt)
+		return
+	}
+	chat := msg.Info.Chat.ToNonAD()
+	ag.lock.Lock()
+	defer ag.lock.Unlock()
+	album := ag.pending[chat]
+	if album != nil {
+		last := album.messages[len(album.messages)-1]
+		if !isAlbumItem(msg) || album.sender != msg.Info.Sender.ToNonAD() || msg.Info.Timestamp.Sub(last.Info.Timestamp) > ag.window {
+			ag.flush(chat, album)
+			album = nil
+		}
+	}
+	if !isAlbumItem(msg) {
+		ag.next(evt)
+		return
+	}
+	if album == nil {
+		album = &pendingAlbum{sender: msg.Info.Sender.ToNonAD()}
+		ag.pending[chat] = album
+		album.timer = time.AfterFunc(ag.window, func() {
+			ag.lock.Lock()
+			if ag.pending[chat] == album {
+				ag.flush(chat, album)
+			}
+			ag.lock.Unlock()
+		})
+	} else {
+		album.timer.Reset(ag.window)
+	}
+	album.messages = append(album.messages, msg)
+}
+
+// flush dispatches the pending album of a chat. The lock must be held.
+func (ag *albumGrouper) flush(chat types.JID, album *pendingAlbum) {
+	album.timer.Stop()
+	delete(ag.pending, chat)
+	if len(album.messages) < MinAlbumSize {
+		for _, msg := range album.messages {
+			ag.next(msg)
+		}
+		return
+	}
+	ag.next(&events.Album{
+		Chat:     chat,
+		Sender:   album.sender,
+		Messages: album.messages,
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow_test
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/insomnius/whatsmeow"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestAlbumMiddleware(t *testing.T) {
+	var received []interface{}
+	dispatch := whatsmeow.AlbumMiddleware(time.Minute)(func(evt interface{}) {
+		received = append(received, evt)
+	})
+	chat := types.NewJID("1234", types.DefaultUserServer)
+	now := time.Now()
+	makeMessage := func(id types.MessageID, sender string, message *waProto.Message) *events.Message {
+		return &events.Message{Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: types.NewJID(sender, types.DefaultUserServer)},
+			ID:            id,
+			Timestamp:     now,
+		}, Message: message}
+	}
+	image := &waProto.Message{ImageMessage: &waProto.ImageMessage{}}
+	text := &waProto.Message{Conversation: proto.String("hi")}
+
+	for _, id := range []types.MessageID{"A", "B", "C", "D"} {
+		dispatch(makeMessage(id, "1234", image))
+	}
+	dispatch(makeMessage("E", "1234", image))
+	dispatch(makeMessage("F", "5678", image))
+	dispatch(makeMessage("G", "5678", text))
+
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(received))
+	}
+	if album, ok := received[0].(*events.Album); !ok || len(album.Messages) != 5 || album.Messages[4].Info.ID != "E" {
+		t.Errorf("Expected first event to be an album of 5 items, got %+v", received[0])
+	}
+	if msg, ok := received[1].(*events.Message); !ok || msg.Info.ID != "F" {
+		t.Errorf("Expected second event to be message F, got %+v", received[1])
+	}
+	if msg, ok := received[2].(*events.Message); !ok || msg.Info.ID != "G" {
+		t.Errorf("Expected third event to be message G, got %+v", received[2])
+	}
+}
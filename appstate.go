@@ -27,12 +27,12 @@ func (cli *Client) FetchAppState(name appstate.WAPatchName, fullSync, onlyIfNotS
 	cli.appStateSyncLock.Lock()
 	defer cli.appStateSyncLock.Unlock()
 	if fullSync {
-		err := cli.Store.AppState.DeleteAppStateVersion(string(name))
+		err := cli.Store.AppState.DeleteAppStateVersion(context.TODO(), string(name))
 		if err != nil {
 			return fmt.Errorf("failed to reset app state %s version: %w", name, err)
 		}
 	}
-	version, hash, err := cli.Store.AppState.GetAppStateVersion(string(name))
+	version, hash, err := cli.Store.AppState.GetAppStateVersion(context.TODO(), string(name))
 	if err != nil {
 		return fmt.Errorf("failed to get app state %s version: %w", name, err)
 	}
@@ -67,7 +67,7 @@ func (cli *Client) FetchAppState(name appstate.WAPatchName, fullSync, onlyIfNotS
 			var contacts []store.ContactEntry
 			mutations, contacts = cli.filterContacts(mutations)
 			cli.Log.Debugf("Mass inserting app state snapshot with %d contacts into the store", len(contacts))
-			err = cli.Store.Contacts.PutAllContactNames(contacts)
+			err = cli.Store.Contacts.PutAllContactNames(context.TODO(), contacts)
 			if err != nil {
 				// This is a fairly serious failure, so just abort the whole thing
 				return fmt.Errorf("failed to update contact store with data from snapshot: %v", err)
@@ -131,25 +131,25 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, dispatchEvts boo
 			mutedUntil = time.Unix(act.GetMuteEndTimestamp(), 0)
 		}
 		if cli.Store.ChatSettings != nil {
-			storeUpdateError = cli.Store.ChatSettings.PutMutedUntil(jid, mutedUntil)
+			storeUpdateError = cli.Store.ChatSettings.PutMutedUntil(context.TODO(), jid, mutedUntil)
 		}
 	case "pin_v1":
 		act := mutation.Action.GetPinAction()
 		eventToDispatch = &events.Pin{JID: jid, Timestamp: ts, Action: act}
 		if cli.Store.ChatSettings != nil {
-			storeUpdateError = cli.Store.ChatSettings.PutPinned(jid, act.GetPinned())
+			storeUpdateError = cli.Store.ChatSettings.PutPinned(context.TODO(), jid, act.GetPinned())
 		}
 	case "archive":
 		act := mutation.Action.GetArchiveChatAction()
 		eventToDispatch = &events.Archive{JID: jid, Timestamp: ts, Action: act}
 		if cli.Store.ChatSettings != nil {
-			storeUpdateError = cli.Store.ChatSettings.PutArchived(jid, act.GetArchived())
+			storeUpdateError = cli.Store.ChatSettings.PutArchived(context.TODO(), jid, act.GetArchived())
 		}
 	case "contact":
 		act := mutation.Action.GetContactAction()
 		eventToDispatch = &events.Contact{JID: jid, Timestamp: ts, Action: act}
 		if cli.Store.Contacts != nil {
-			storeUpdateError = cli.Store.Contacts.PutContactName(jid, act.GetFirstName(), act.GetFullName())
+			storeUpdateError = cli.Store.Contacts.PutContactName(context.TODO(), jid, act.GetFirstName(), act.GetFullName())
 		}
 	case "deleteChat":
 		act := mutation.Action.GetDeleteChatAction()
@@ -185,15 +185,17 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, dispatchEvts boo
 		}
 		eventToDispatch = &evt
 	case "markChatAsRead":
-		eventToDispatch = &events.MarkChatAsRead{
+		evt := &events.MarkChatAsRead{
 			JID:       jid,
 			Timestamp: ts,
 			Action:    mutation.Action.GetMarkChatAsReadAction(),
 		}
+		cli.trackUnreadAppState(evt)
+		eventToDispatch = evt
 	case "setting_pushName":
 		eventToDispatch = &events.PushNameSetting{Timestamp: ts, Action: mutation.Action.GetPushNameSetting()}
 		cli.Store.PushName = mutation.Action.GetPushNameSetting().GetName()
-		err := cli.Store.Save()
+		err := cli.Store.Save(context.TODO())
 		if err != nil {
 			cli.Log.Errorf("Failed to save device store after updating push name: %v", err)
 		}
@@ -238,6 +240,64 @@ func (cli *Client) fetchAppStatePatches(name appstate.WAPatchName, fromVersion u
 	return appstate.ParsePatchList(resp, cli.downloadExternalAppStateBlob)
 }
 
+// SendAppState encrypts and sends the given app state patch, then fetches the app state type from the server
+// to update the local state. The patch is applied to the user's other devices as if it was made in the official apps.
+//
+// The patch is encrypted with the newest app state key that the primary device has shared, so the app state
+// sync key store must implement store.LatestAppStateSyncKeyGetter.
+//
+//	err := cli.SendAppState(ctx, appstate.BuildMarkChatAsRead(chat, true, time.Time{}, nil))
+func (cli *Client) SendAppState(ctx context.Context, patch appstate.PatchInfo) error {
+	version, hash, err := cli.Store.AppState.GetAppStateVersion(ctx, string(patch.Type))
+	if err != nil {
+		return fmt.Errorf("failed to get %s app state version: %w", patch.Type, err)
+	}
+	keyGetter, ok := cli.Store.AppStateKeys.(store.LatestAppStateSyncKeyGetter)
+	if !ok {
+		return store.ErrLatestAppStateSyncKeyNotSupported
+	}
+	latestKeyID, err := keyGetter.GetLatestAppStateSyncKeyID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest app state key ID: %w", err)
+	} else if latestKeyID == nil {
+		return ErrNoAppStateKeys
+	}
+	state := appstate.HashState{Version: version, Hash: hash}
+	encodedPatch, err := cli.appStateProc.EncodePatch(latestKeyID, state, patch)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.sendIQ(infoQuery{
+		Namespace: "w:sync:app:state",
+		Type:      iqSet,
+		To:        types.ServerJID,
+		Context:   ctx,
+		Content: []waBinary.Node{{
+			Tag: "sync",
+			Content: []waBinary.Node{{
+				Tag: "collection",
+				Attrs: waBinary.Attrs{
+					"name":            string(patch.Type),
+					"version":         version,
+					"return_snapshot": false,
+				},
+				Content: []waBinary.Node{{
+					Tag:     "patch",
+					Content: encodedPatch,
+				}},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	respCollection := resp.GetChildByTag("sync", "collection")
+	if respCollection.AttrGetter().OptionalString("type") == "error" {
+		return fmt.Errorf("%w: %s", ErrAppStateUpdate, respCollection.XMLString())
+	}
+	return cli.FetchAppState(patch.Type, false, false)
+}
+
 func (cli *Client) requestMissingAppStateKeys(ctx context.Context, patches *appstate.PatchList) {
 	cli.appStateKeyRequestsLock.Lock()
 	rawKeyIDs := cli.appStateProc.GetMissingKeyIDs(patches)
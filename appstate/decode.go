@@ -8,6 +8,7 @@ package appstate
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -173,15 +174,15 @@ func (proc *Processor) decodeMutations(mutations []*waProto.SyncdMutation, out *
 }
 
 func (proc *Processor) storeMACs(name WAPatchName, currentState HashState, out *patchOutput) {
-	err := proc.Store.AppState.PutAppStateVersion(string(name), currentState.Version, currentState.Hash)
+	err := proc.Store.AppState.PutAppStateVersion(context.TODO(), string(name), currentState.Version, currentState.Hash)
 	if err != nil {
 		proc.Log.Errorf("Failed to update app state version in the database: %v", err)
 	}
-	err = proc.Store.AppState.DeleteAppStateMutationMACs(string(name), out.RemovedMACs)
+	err = proc.Store.AppState.DeleteAppStateMutationMACs(context.TODO(), string(name), out.RemovedMACs)
 	if err != nil {
 		proc.Log.Errorf("Failed to remove deleted mutation MACs from the database: %v", err)
 	}
-	err = proc.Store.AppState.PutAppStateMutationMACs(string(name), currentState.Version, out.AddedMACs)
+	err = proc.Store.AppState.PutAppStateMutationMACs(context.TODO(), string(name), currentState.Version, out.AddedMACs)
 	if err != nil {
 		proc.Log.Errorf("Failed to insert added mutation MACs to the database: %v", err)
 	}
@@ -274,7 +275,7 @@ func (proc *Processor) DecodePatches(list *PatchList, initialState HashState, va
 				}
 			}
 			// Previous value not found in current patch, look in the database
-			return proc.Store.AppState.GetAppStateMutationMAC(string(list.Name), indexMAC)
+			return proc.Store.AppState.GetAppStateMutationMAC(context.TODO(), string(list.Name), indexMAC)
 		})
 		if len(warn) > 0 {
 			proc.Log.Warnf("Warnings while updating hash for %s: %+v", list.Name, warn)
@@ -290,7 +291,7 @@ func (proc *Processor) DecodePatches(list *PatchList, initialState HashState, va
 			if err != nil {
 				return
 			}
-			patchMAC := generatePatchMAC(patch, list.Name, keys.PatchMAC)
+			patchMAC := generatePatchMAC(patch, list.Name, keys.PatchMAC, version)
 			if !bytes.Equal(patchMAC, patch.GetPatchMac()) {
 				err = fmt.Errorf("failed to verify patch v%d: %w", version, ErrMismatchingPatchMAC)
 				return
@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package appstate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/cbcutil"
+)
+
+// MutationInfo contains information about a single mutation to the app state.
+type MutationInfo struct {
+	// Index contains the thing being mutated (like `mute` or `pin_v1`), followed by parameters like the target JID.
+	Index []string
+	// Version is a static number that depends on the thing being mutated.
+	Version int32
+	// Value contains the data for the mutation.
+	Value *waProto.SyncActionValue
+}
+
+// PatchInfo contains information about a patch to the app state.
+// A patch can contain multiple mutations, as long as all mutations are in the same app state type.
+type PatchInfo struct {
+	// Timestamp is the time when the patch was created. This will be filled automatically in EncodePatch if it's zero.
+	Timestamp time.Time
+	// Type is the app state type being mutated.
+	Type WAPatchName
+	// Mutations contains the individual mutations to apply to the app state in this patch.
+	Mutations []MutationInfo
+}
+
+// IndexMarkChatAsRead is the first part of the index of markChatAsRead mutations.
+const IndexMarkChatAsRead = "markChatAsRead"
+
+// BuildMarkChatAsRead builds an app state patch for marking a chat as read or unread.
+//
+// The last message key is the newest message in the chat, which tells the other devices how far the chat has
+// been read. It and the timestamp are optional.
+func BuildMarkChatAsRead(target types.JID, read bool, lastMessageTimestamp time.Time, lastMessageKey *waProto.MessageKey) PatchInfo {
+	messageRange := &waProto.SyncActionMessageRange{}
+	if !lastMessageTimestamp.IsZero() {
+		messageRange.LastMessageTimestamp = proto.Int64(lastMessageTimestamp.Unix())
+	}
+	if lastMessageKey != nil {
+		messageRange.Messages = []*waProto.SyncActionMessage{{
+			Key:       lastMessageKey,
+			Timestamp: messageRange.LastMessageTimestamp,
+		}}
+	}
+	return PatchInfo{
+		Type: WAPatchRegularLow,
+		Mutations: []MutationInfo{{
+			Index:   []string{IndexMarkChatAsRead, target.String()},
+			Version: 3,
+			Value: &waProto.SyncActionValue{
+				MarkChatAsReadAction: &waProto.MarkChatAsReadAction{
+					Read:         proto.Bool(read),
+					MessageRange: messageRange,
+				},
+			},
+		}},
+	}
+}
+
+// EncodePatch encrypts the given patch with the given app state key and computes the MACs that the server and
+// other devices use to verify it. The state is the current version and hash of the app state type being mutated,
+// as stored in the AppStateStore. The result is the marshaled SyncdPatch to send to the server.
+func (proc *Processor) EncodePatch(keyID []byte, state HashState, patchInfo PatchInfo) ([]byte, error) {
+	keys, err := proc.getAppStateKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app state key details with key ID %x: %w", keyID, err)
+	}
+	if patchInfo.Timestamp.IsZero() {
+		patchInfo.Timestamp = time.Now()
+	}
+
+	mutations := make([]*waProto.SyncdMutation, 0, len(patchInfo.Mutations))
+	for _, mutationInfo := range patchInfo.Mutations {
+		mutationInfo.Value.Timestamp = proto.Int64(patchInfo.Timestamp.UnixMilli())
+
+		indexBytes, err := json.Marshal(mutationInfo.Index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal mutation index: %w", err)
+		}
+		content, err := proto.Marshal(&waProto.SyncActionData{
+			Index:   indexBytes,
+			Value:   mutationInfo.Value,
+			Padding: []byte{},
+			Version: proto.Int32(mutationInfo.Version),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal mutation data: %w", err)
+		}
+		encryptedContent, err := cbcutil.Encrypt(keys.ValueEncryption, nil, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt mutation data: %w", err)
+		}
+		valueMAC := generateContentMAC(waProto.SyncdMutation_SET, encryptedContent, keyID, keys.ValueMAC)
+		indexMAC := concatAndHMAC(sha256.New, keys.Index, indexBytes)
+		mutations = append(mutations, &waProto.SyncdMutation{
+			Operation: waProto.SyncdMutation_SET.Enum(),
+			Record: &waProto.SyncdRecord{
+				Index: &waProto.SyncdIndex{Blob: indexMAC},
+				Value: &waProto.SyncdValue{Blob: append(encryptedContent, valueMAC...)},
+				KeyId: &waProto.KeyId{Id: keyID},
+			},
+		})
+	}
+
+	warn, err := state.updateHash(mutations, func(indexMAC []byte, _ int) ([]byte, error) {
+		return proc.Store.AppState.GetAppStateMutationMAC(context.TODO(), string(patchInfo.Type), indexMAC)
+	})
+	if len(warn) > 0 {
+		proc.Log.Warnf("Warnings while updating hash for %s: %+v", patchInfo.Type, warn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state hash: %w", err)
+	}
+
+	state.Version++
+	patch := &waProto.SyncdPatch{
+		SnapshotMac: state.generateSnapshotMAC(patchInfo.Type, keys.SnapshotMAC),
+		KeyId:       &waProto.KeyId{Id: keyID},
+		Mutations:   mutations,
+	}
+	patch.PatchMac = generatePatchMAC(patch, patchInfo.Type, keys.PatchMAC, state.Version)
+	result, err := proto.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal compiled patch: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package appstate_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/insomnius/whatsmeow/appstate"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+func encodeAndDecode(t *testing.T, proc *appstate.Processor, keyID []byte, state appstate.HashState, patchInfo appstate.PatchInfo) ([]appstate.Mutation, appstate.HashState) {
+	t.Helper()
+	encoded, err := proc.EncodePatch(keyID, state, patchInfo)
+	if err != nil {
+		t.Fatalf("Failed to encode patch: %v", err)
+	}
+	var patch waProto.SyncdPatch
+	if err = proto.Unmarshal(encoded, &patch); err != nil {
+		t.Fatalf("Failed to unmarshal encoded patch: %v", err)
+	}
+	// The server assigns the version when accepting the patch
+	patch.Version = &waProto.SyncdVersion{Version: proto.Uint64(state.Version + 1)}
+	mutations, newState, err := proc.DecodePatches(&appstate.PatchList{
+		Name:    patchInfo.Type,
+		Patches: []*waProto.SyncdPatch{&patch},
+	}, state, true)
+	if err != nil {
+		t.Fatalf("Failed to decode patch: %v", err)
+	}
+	return mutations, newState
+}
+
+func TestEncodePatchRoundtrip(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	keyID := []byte{0, 0, 0, 1}
+	err := device.AppStateKeys.PutAppStateSyncKey(context.Background(), keyID, store.AppStateSyncKey{
+		Data:        bytes.Repeat([]byte{1}, 32),
+		Fingerprint: []byte{},
+		Timestamp:   time.Now().Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to store app state key: %v", err)
+	}
+	proc := appstate.NewProcessor(device, waLog.Noop)
+	chat := types.NewJID("2222", types.DefaultUserServer)
+
+	mutations, state := encodeAndDecode(t, proc, keyID, appstate.HashState{}, appstate.BuildMarkChatAsRead(chat, true, time.Time{}, nil))
+	if state.Version != 1 {
+		t.Errorf("Expected version 1 after first patch, got %d", state.Version)
+	} else if len(mutations) != 1 || mutations[0].Index[0] != appstate.IndexMarkChatAsRead || mutations[0].Index[1] != chat.String() {
+		t.Fatalf("Unexpected mutations after first patch: %+v", mutations)
+	} else if !mutations[0].Action.GetMarkChatAsReadAction().GetRead() {
+		t.Errorf("Expected chat to be marked as read")
+	}
+
+	// Overwriting the same index makes the hash depend on the value MAC stored from the first patch
+	mutations, state = encodeAndDecode(t, proc, keyID, state, appstate.BuildMarkChatAsRead(chat, false, time.Time{}, nil))
+	if state.Version != 2 {
+		t.Errorf("Expected version 2 after second patch, got %d", state.Version)
+	} else if len(mutations) != 1 || mutations[0].Action.GetMarkChatAsReadAction().GetRead() {
+		t.Errorf("Expected chat to be marked as unread, got %+v", mutations)
+	}
+
+	storedVersion, storedHash, err := device.AppState.GetAppStateVersion(context.Background(), string(appstate.WAPatchRegularLow))
+	if err != nil {
+		t.Fatalf("Failed to get stored app state version: %v", err)
+	} else if storedVersion != state.Version || storedHash != state.Hash {
+		t.Errorf("Stored state (v%d) doesn't match decoded state (v%d)", storedVersion, state.Version)
+	}
+}
@@ -8,6 +8,7 @@
 package appstate
 
 import (
+	"context"
 	"encoding/base64"
 	"sync"
 
@@ -73,7 +74,7 @@ func (proc *Processor) getAppStateKey(keyID []byte) (keys ExpandedAppStateKeys,
 	keys, ok = proc.keyCache[keyCacheID]
 	if !ok {
 		var keyData *store.AppStateSyncKey
-		keyData, err = proc.Store.AppStateKeys.GetAppStateSyncKey(keyID)
+		keyData, err = proc.Store.AppStateKeys.GetAppStateSyncKey(context.TODO(), keyID)
 		if keyData != nil {
 			keys = expandAppStateKeys(keyData.Data)
 			proc.keyCache[keyCacheID] = keys
@@ -94,7 +95,7 @@ func (proc *Processor) GetMissingKeyIDs(pl *PatchList) [][]byte {
 		stringKeyID := base64.RawStdEncoding.EncodeToString(keyID)
 		_, alreadyAdded := cache[stringKeyID]
 		if !alreadyAdded {
-			keyData, err := proc.Store.AppStateKeys.GetAppStateSyncKey(keyID)
+			keyData, err := proc.Store.AppStateKeys.GetAppStateSyncKey(context.TODO(), keyID)
 			if err != nil {
 				proc.Log.Warnf("Error fetching key %X while checking if it's missing: %v", keyID, err)
 			}
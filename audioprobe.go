@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/insomnius/whatsmeow/util/mp3"
+	"github.com/insomnius/whatsmeow/util/mp4"
+	"github.com/insomnius/whatsmeow/util/oggopus"
+)
+
+// AudioInfo contains the codec and duration of an audio file, see ProbeAudio.
+type AudioInfo struct {
+	// The codec of the audio, either "opus", "mp3" or "aac".
+	Codec string
+	// The mime type to use in the AudioMessage.
+	Mimetype string
+	Duration time.Duration
+}
+
+// Seconds returns the duration rounded to full seconds, as used in AudioMessage.Seconds.
+// Audio shorter than a second is rounded up, as the official clients show zero as an unknown duration.
+func (info *AudioInfo) Seconds() uint32 {
+	seconds := uint32(info.Duration.Round(time.Second) / time.Second)
+	if seconds == 0 && info.Duration > 0 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// ProbeAudio reads the codec and duration of the given audio file. Ogg Opus, MP3 and AAC in MP4 containers are
+// supported, other formats return an error wrapping ErrUnsupportedMediaFormat.
+//
+// Audio uploaded with Upload is probed automatically, and the duration is returned in UploadResponse.Seconds.
+//
+//	info, err := whatsmeow.ProbeAudio(mp3Data)
+//	// handle error
+//	msg.AudioMessage.Seconds = proto.Uint32(info.Seconds())
+func ProbeAudio(data []byte) (*AudioInfo, error) {
+	switch {
+	case oggopus.IsOggOpus(data):
+		info, err := oggopus.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read Ogg Opus audio: %v", ErrInvalidMediaData, err)
+		}
+		return &AudioInfo{Codec: "opus", Mimetype: VoiceMimetype, Duration: info.Duration}, nil
+	case mp4.IsMP4(data):
+		info, err := mp4.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read MP4 audio: %v", ErrInvalidMediaData, err)
+		}
+		return &AudioInfo{Codec: "aac", Mimetype: "audio/mp4", Duration: info.Duration}, nil
+	case mp3.IsMP3(data):
+		info, err := mp3.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read MP3 audio: %v", ErrInvalidMediaData, err)
+		}
+		return &AudioInfo{Codec: "mp3", Mimetype: "audio/mpeg", Duration: info.Duration}, nil
+	default:
+		return nil, fmt.Errorf("%w: can't probe %s audio", ErrUnsupportedMediaFormat, sniffMediaMimetype(data))
+	}
+}
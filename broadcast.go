@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -51,7 +52,7 @@ func (cli *Client) getStatusBroadcastRecipients() ([]types.JID, error) {
 	}
 
 	// Blacklist or all contacts mode. Find all contacts from database, then filter them appropriately.
-	contacts, err := cli.Store.Contacts.GetAllContacts()
+	contacts, err := cli.Store.Contacts.GetAllContacts(context.TODO())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contact list from db: %w", err)
 	}
@@ -0,0 +1,176 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// BulkTarget is a single recipient for SendBulk.
+type BulkTarget struct {
+	JID types.JID
+	// Arbitrary data for the message factory, e.g. the name to use in a personalized message.
+	Data interface{}
+}
+
+// BulkMessageFactory builds the message to send to a single target in SendBulk.
+// If it returns an error, the target is skipped and the error is included in its result.
+type BulkMessageFactory func(target BulkTarget) (*waProto.Message, error)
+
+// BulkRateConfig configures how fast SendBulk sends messages.
+type BulkRateConfig struct {
+	// Interval is the base delay between two messages. Defaults to 3 seconds.
+	Interval time.Duration
+	// Jitter adds a random delay between zero and the given duration on top of Interval.
+	Jitter time.Duration
+	// If BurstSize is set, SendBulk pauses for BurstPause after every BurstSize messages.
+	BurstSize  int
+	BurstPause time.Duration
+	// MaxConsecutiveFailures is the number of failed sends in a row after which SendBulk gives up.
+	// Defaults to 5, set to a negative number to never give up because of normal send errors.
+	MaxConsecutiveFailures int
+	// OnResult is called after each target has been processed, e.g. for showing progress.
+	OnResult func(result BulkSendResult)
+}
+
+// DefaultBulkRateConfig is used by SendBulk if the config is nil.
+var DefaultBulkRateConfig = BulkRateConfig{
+	Interval:               3 * time.Second,
+	Jitter:                 2 * time.Second,
+	MaxConsecutiveFailures: 5,
+}
+
+// BulkSendResult is the result of sending to a single target in SendBulk.
+type BulkSendResult struct {
+	Target   BulkTarget
+	Response SendResponse
+	Error    error
+}
+
+// isBanRiskError returns true if the send error means that the server is rate limiting the account,
+// in which case continuing to send messages may get the account banned.
+func isBanRiskError(err error) bool {
+	return errors.Is(err, ErrAckRateOverLimit) || errors.Is(err, ErrAckReachoutLocked) || errors.Is(err, ErrIQRateOverLimit)
+}
+
+// SendBulk sends a message built by msgFactory to each of the given targets, one at a time with a delay
+// between messages as specified in the rate config.
+//
+// Sending stops early with ErrBulkSendAborted if the server signals that the account is sending too much
+// (rate limit errors, a temporary ban, or being logged out), or if too many sends fail in a row. The returned
+// results only contain the targets that were processed before stopping, in the same order as the input.
+//
+// The messages are never put in the outbox (see store.OutboxStore), as the throttling and the rate limit checks
+// need the server's response to each message. Sends while the client isn't logged in fail instead.
+//
+//	results, err := cli.SendBulk(ctx, targets, func(target whatsmeow.BulkTarget) (*waProto.Message, error) {
+//		return &waProto.Message{Conversation: proto.String(fmt.Sprintf("Hello %s!", target.Data))}, nil
+//	}, nil)
+func (cli *Client) SendBulk(ctx context.Context, targets []BulkTarget, msgFactory BulkMessageFactory, rate *BulkRateConfig) ([]BulkSendResult, error) {
+	if rate == nil {
+		rate = &DefaultBulkRateConfig
+	}
+	interval := rate.Interval
+	if interval <= 0 {
+		interval = DefaultBulkRateConfig.Interval
+	}
+	maxFailures := rate.MaxConsecutiveFailures
+	if maxFailures == 0 {
+		maxFailures = DefaultBulkRateConfig.MaxConsecutiveFailures
+	}
+
+	var abortLock sync.Mutex
+	var abortReason error
+	abortCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	handlerID := cli.AddEventHandler(func(evt interface{}) {
+		var reason error
+		switch typedEvt := evt.(type) {
+		case *events.TemporaryBan:
+			reason = fmt.Errorf("account was temporarily banned: %s", typedEvt)
+		case *events.LoggedOut:
+			reason = fmt.Errorf("client was logged out: %s", typedEvt.Reason)
+		case *events.StreamReplaced:
+			reason = errors.New("another client connected with the same keys")
+		default:
+			return
+		}
+		abortLock.Lock()
+		if abortReason == nil {
+			abortReason = reason
+		}
+		abortLock.Unlock()
+		cancel()
+	})
+	defer cli.RemoveEventHandler(handlerID)
+	getAbortReason := func() error {
+		abortLock.Lock()
+		defer abortLock.Unlock()
+		return abortReason
+	}
+
+	results := make([]BulkSendResult, 0, len(targets))
+	consecutiveFailures := 0
+	for i, target := range targets {
+		if i > 0 {
+			delay := interval
+			if rate.Jitter > 0 {
+				delay += time.Duration(rand.Int63n(int64(rate.Jitter)))
+			}
+			if rate.BurstSize > 0 && i%rate.BurstSize == 0 {
+				delay += rate.BurstPause
+			}
+			select {
+			case <-time.After(delay):
+			case <-abortCtx.Done():
+			}
+		}
+		if reason := getAbortReason(); reason != nil {
+			return results, fmt.Errorf("%w: %v", ErrBulkSendAborted, reason)
+		} else if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		result := BulkSendResult{Target: target}
+		msg, err := msgFactory(target)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to build message: %w", err)
+		} else {
+			result.Response, result.Error = cli.prepareAndSendMessage(abortCtx, target.JID, "", msg, false)
+		}
+		results = append(results, result)
+		if rate.OnResult != nil {
+			rate.OnResult(result)
+		}
+
+		if err != nil {
+			// Message factory errors don't say anything about the connection, so they don't count as failures
+			continue
+		} else if result.Error == nil {
+			consecutiveFailures = 0
+			continue
+		} else if isBanRiskError(result.Error) {
+			return results, fmt.Errorf("%w: server rate limited sending to %s: %v", ErrBulkSendAborted, target.JID, result.Error)
+		} else if errors.Is(result.Error, ErrClientShuttingDown) {
+			return results, fmt.Errorf("%w: %v", ErrBulkSendAborted, result.Error)
+		}
+		consecutiveFailures++
+		if maxFailures > 0 && consecutiveFailures >= maxFailures {
+			return results, fmt.Errorf("%w: %d sends failed in a row, last error: %v", ErrBulkSendAborted, consecutiveFailures, result.Error)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestSendBulkSkipsOutbox(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	outbox := &testOutboxStore{}
+	device.Outbox = outbox
+	cli := NewClient(device, nil)
+
+	targets := []BulkTarget{
+		{JID: types.NewJID("2222", types.DefaultUserServer)},
+		{JID: types.NewJID("3333", types.DefaultUserServer)},
+		{JID: types.NewJID("4444", types.DefaultUserServer)},
+	}
+	results, err := cli.SendBulk(context.Background(), targets, func(target BulkTarget) (*waProto.Message, error) {
+		return &waProto.Message{Conversation: proto.String("hi")}, nil
+	}, &BulkRateConfig{Interval: time.Millisecond, MaxConsecutiveFailures: 2})
+	if !errors.Is(err, ErrBulkSendAborted) {
+		t.Fatalf("Expected bulk send to be aborted after failing to send while disconnected, got %v", err)
+	} else if len(results) != 2 {
+		t.Fatalf("Expected 2 results before aborting, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Response.Queued || result.Error == nil {
+			t.Errorf("Expected send to %s to fail instead of being queued", result.Target.JID)
+		}
+	}
+	if ids := outbox.ids(); len(ids) != 0 {
+		t.Errorf("Expected outbox to be empty, got %v", ids)
+	}
+}
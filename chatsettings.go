@@ -0,0 +1,50 @@
+package whatsmeow
+
+import (
+	"context"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// GetChatSettings gets the locally stored mute, pin and archive settings of the given chat.
+//
+// The settings are stored when they're received through app state sync, so they're only up to date
+// after the regular_low app state patches have been fetched. If the chat doesn't have any stored
+// settings, the returned struct will have Found set to false.
+func (cli *Client) GetChatSettings(ctx context.Context, chat types.JID) (types.LocalChatSettings, error) {
+	if cli.Store.ChatSettings == nil {
+		return types.LocalChatSettings{}, ErrNoChatSettingsStore
+	}
+	return cli.Store.ChatSettings.GetChatSettings(ctx, chat.ToNonAD())
+}
+
+// GetMutedUntil returns the time until which the given chat is muted, or a zero time if it's not muted.
+//
+// Chats that are muted forever return a negative unix timestamp (time.Unix(-1, 0)), use IsMuted to check
+// whether a chat is currently muted.
+func (cli *Client) GetMutedUntil(ctx context.Context, chat types.JID) (time.Time, error) {
+	settings, err := cli.GetChatSettings(ctx, chat)
+	return settings.MutedUntil, err
+}
+
+// IsMuted checks whether the given chat is currently muted.
+func (cli *Client) IsMuted(ctx context.Context, chat types.JID) (bool, error) {
+	mutedUntil, err := cli.GetMutedUntil(ctx, chat)
+	if err != nil || mutedUntil.IsZero() {
+		return false, err
+	}
+	return mutedUntil.Unix() < 0 || mutedUntil.After(time.Now()), nil
+}
+
+// IsPinned checks whether the given chat is pinned.
+func (cli *Client) IsPinned(ctx context.Context, chat types.JID) (bool, error) {
+	settings, err := cli.GetChatSettings(ctx, chat)
+	return settings.Pinned, err
+}
+
+// IsArchived checks whether the given chat is archived.
+func (cli *Client) IsArchived(ctx context.Context, chat types.JID) (bool, error) {
+	settings, err := cli.GetChatSettings(ctx, chat)
+	return settings.Archived, err
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package clientmanager runs many whatsmeow clients for the devices in a single store container.
+package clientmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/insomnius/whatsmeow"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+var (
+	ErrDeviceNotPaired = errors.New("device doesn't have a JID, use NewPairingClient for unpaired devices")
+	ErrClientExists    = errors.New("manager already has a client for that device")
+	ErrClientNotFound  = errors.New("manager doesn't have a client for that device")
+)
+
+// DefaultConnectInterval is the default delay between connecting clients in ConnectAll.
+const DefaultConnectInterval = 500 * time.Millisecond
+
+// Event is an event from one of the clients of a Manager.
+type Event struct {
+	// JID is the device JID of the client. It's empty for events of clients that haven't been paired yet.
+	JID    types.JID
+	Client *whatsmeow.Client
+	Evt    interface{}
+}
+
+// Manager owns a whatsmeow client for every device in a store container.
+type Manager struct {
+	Container store.Container
+	Log       waLog.Logger
+
+	// ConnectInterval is the delay between connecting clients in ConnectAll, so that reconnecting
+	// lots of accounts after a restart doesn't hit the servers all at once.
+	ConnectInterval time.Duration
+	// HTTPClient is shared by all clients created by the manager for media uploads and downloads.
+	// Clients that get a proxy or dial function in SetupClient switch to their own copy of the transport,
+	// so the shared client isn't modified. Set it to nil to give each client its own HTTP client.
+	HTTPClient *http.Client
+	// SetupClient is called for every new client before it's added to the manager, e.g. to set a proxy.
+	SetupClient func(cli *whatsmeow.Client)
+
+	clients map[types.JID]*whatsmeow.Client
+	lock    sync.RWMutex
+	events  chan *Event
+}
+
+// New creates a Manager for the given container. The logger can be nil.
+//
+// The events argument is the size of the buffer of the Events channel. Note that the channel blocks
+// the event handling of the client that emitted an event when the buffer is full.
+func New(container store.Container, log waLog.Logger, events int) *Manager {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Manager{
+		Container:       container,
+		Log:             log,
+		ConnectInterval: DefaultConnectInterval,
+		HTTPClient: &http.Client{
+			Transport: (http.DefaultTransport.(*http.Transport)).Clone(),
+		},
+		clients: make(map[types.JID]*whatsmeow.Client),
+		events:  make(chan *Event, events),
+	}
+}
+
+// Events returns the channel where the events of all clients are sent, tagged with the JID of the client.
+func (m *Manager) Events() <-chan *Event {
+	return m.events
+}
+
+// LoadAll creates clients for all devices in the container that the manager doesn't have a client for yet.
+// The clients aren't connected, use ConnectAll for that.
+func (m *Manager) LoadAll(ctx context.Context) error {
+	devices, err := m.Container.GetAllDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get devices: %w", err)
+	}
+	for _, device := range devices {
+		_, err = m.Add(device)
+		if err != nil && !errors.Is(err, ErrClientExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) newClient(device *store.Device) *whatsmeow.Client {
+	name := "Client"
+	if device.ID != nil {
+		name = device.ID.String()
+	}
+	cli := whatsmeow.NewClient(device, m.Log.Sub(name))
+	if m.HTTPClient != nil {
+		cli.SetHTTPClient(m.HTTPClient)
+	}
+	if m.SetupClient != nil {
+		m.SetupClient(cli)
+	}
+	cli.AddEventHandler(func(evt interface{}) {
+		m.handleEvent(cli, evt)
+	})
+	return cli
+}
+
+// Add creates a client for the given paired device.
+func (m *Manager) Add(device *store.Device) (*whatsmeow.Client, error) {
+	if device.ID == nil {
+		return nil, ErrDeviceNotPaired
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, exists := m.clients[*device.ID]; exists {
+		return nil, ErrClientExists
+	}
+	cli := m.newClient(device)
+	m.clients[*device.ID] = cli
+	return cli, nil
+}
+
+// NewPairingClient creates a client for a new device in the container. The client isn't managed until
+// pairing succeeds, after which it can be found with Get like the other clients.
+//
+//	cli := manager.NewPairingClient()
+//	qrChan, _ := cli.GetQRChannel(context.Background())
+//	err := cli.Connect()
+func (m *Manager) NewPairingClient() *whatsmeow.Client {
+	return m.newClient(m.Container.NewDevice())
+}
+
+func (m *Manager) handleEvent(cli *whatsmeow.Client, evt interface{}) {
+	var jid types.JID
+	if cli.Store.ID != nil {
+		jid = *cli.Store.ID
+	}
+	switch evt := evt.(type) {
+	case *events.PairSuccess:
+		jid = evt.ID
+		m.lock.Lock()
+		m.clients[jid] = cli
+		m.lock.Unlock()
+	case *events.LoggedOut:
+		// The device data has already been deleted, so there's nothing left to manage
+		m.lock.Lock()
+		for clientJID, existing := range m.clients {
+			if existing == cli {
+				jid = clientJID
+				delete(m.clients, clientJID)
+			}
+		}
+		m.lock.Unlock()
+	}
+	m.events <- &Event{JID: jid, Client: cli, Evt: evt}
+}
+
+// Get returns the client of the device with the given JID, or nil if the manager doesn't have one.
+func (m *Manager) Get(jid types.JID) *whatsmeow.Client {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.clients[jid]
+}
+
+// Clients returns all the clients of the manager, sorted by JID.
+func (m *Manager) Clients() []*whatsmeow.Client {
+	m.lock.RLock()
+	jids := make([]types.JID, 0, len(m.clients))
+	for jid := range m.clients {
+		jids = append(jids, jid)
+	}
+	sort.Slice(jids, func(i, j int) bool {
+		return jids[i].String() < jids[j].String()
+	})
+	clients := make([]*whatsmeow.Client, len(jids))
+	for i, jid := range jids {
+		clients[i] = m.clients[jid]
+	}
+	m.lock.RUnlock()
+	return clients
+}
+
+// Connect connects the client of the given device.
+func (m *Manager) Connect(jid types.JID) error {
+	cli := m.Get(jid)
+	if cli == nil {
+		return ErrClientNotFound
+	}
+	return cli.Connect()
+}
+
+// Disconnect disconnects the client of the given device, but keeps it in the manager.
+func (m *Manager) Disconnect(jid types.JID) error {
+	cli := m.Get(jid)
+	if cli == nil {
+		return ErrClientNotFound
+	}
+	cli.Disconnect()
+	return nil
+}
+
+// Remove disconnects the client of the given device and removes it from the manager.
+// The device data is kept in the container, so it can be added again later.
+func (m *Manager) Remove(jid types.JID) error {
+	m.lock.Lock()
+	cli, ok := m.clients[jid]
+	delete(m.clients, jid)
+	m.lock.Unlock()
+	if !ok {
+		return ErrClientNotFound
+	}
+	cli.Disconnect()
+	return nil
+}
+
+// Logout logs out the client of the given device, which deletes the device data, and removes it from the manager.
+func (m *Manager) Logout(jid types.JID) error {
+	cli := m.Get(jid)
+	if cli == nil {
+		return ErrClientNotFound
+	}
+	err := cli.Logout()
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	delete(m.clients, jid)
+	m.lock.Unlock()
+	return nil
+}
+
+// ConnectAll connects all clients that aren't connected yet, waiting ConnectInterval between each one.
+//
+// Connection errors don't stop the other clients from being connected. They're returned in a map
+// from device JID to error, which is empty if all clients connected successfully. If the context
+// is canceled, the remaining clients aren't connected and the context error is returned.
+func (m *Manager) ConnectAll(ctx context.Context) (map[types.JID]error, error) {
+	failed := make(map[types.JID]error)
+	first := true
+	for _, cli := range m.Clients() {
+		if cli.IsConnected() || cli.Store.ID == nil {
+			continue
+		}
+		if !first && m.ConnectInterval > 0 {
+			select {
+			case <-time.After(m.ConnectInterval):
+			case <-ctx.Done():
+				return failed, ctx.Err()
+			}
+		}
+		first = false
+		jid := *cli.Store.ID
+		err := cli.Connect()
+		if err != nil && !errors.Is(err, whatsmeow.ErrAlreadyConnected) {
+			m.Log.Warnf("Failed to connect %s: %v", jid, err)
+			failed[jid] = err
+		}
+	}
+	return failed, nil
+}
+
+// DisconnectAll disconnects all clients immediately.
+func (m *Manager) DisconnectAll() {
+	for _, cli := range m.Clients() {
+		cli.Disconnect()
+	}
+}
+
+// Shutdown gracefully shuts down all clients in parallel, see whatsmeow.Client.Shutdown.
+// It returns the first error returned by any of the clients.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	clients := m.Clients()
+	errs := make(chan error, len(clients))
+	for _, cli := range clients {
+		go func(cli *whatsmeow.Client) {
+			errs <- cli.Shutdown(ctx)
+		}(cli)
+	}
+	var firstErr error
+	for range clients {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package clientmanager_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/insomnius/whatsmeow"
+	"github.com/insomnius/whatsmeow/clientmanager"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestManagerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	container := inmemstore.New(nil)
+	for _, user := range []string{"3333", "1111", "2222"} {
+		device := container.NewDevice()
+		jid := types.NewADJID(user, 0, 1)
+		device.ID = &jid
+		if err := device.Save(ctx); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+	}
+
+	manager := clientmanager.New(container, nil, 16)
+	if err := manager.LoadAll(ctx); err != nil {
+		t.Fatalf("Failed to load clients: %v", err)
+	}
+	clients := manager.Clients()
+	if len(clients) != 3 || clients[0].Store.ID.User != "1111" || clients[2].Store.ID.User != "3333" {
+		t.Fatalf("Unexpected clients %v", clients)
+	}
+	// Loading again shouldn't create duplicate clients
+	if err := manager.LoadAll(ctx); err != nil || len(manager.Clients()) != 3 {
+		t.Fatalf("Expected LoadAll to skip existing clients, got %d clients, %v", len(manager.Clients()), err)
+	}
+
+	jid := types.NewADJID("2222", 0, 1)
+	if manager.Get(jid) != clients[1] {
+		t.Errorf("Get returned wrong client")
+	}
+	if _, err := manager.Add(clients[1].Store); !errors.Is(err, clientmanager.ErrClientExists) {
+		t.Errorf("Expected ErrClientExists, got %v", err)
+	}
+	if _, err := manager.Add(container.NewDevice()); !errors.Is(err, clientmanager.ErrDeviceNotPaired) {
+		t.Errorf("Expected ErrDeviceNotPaired, got %v", err)
+	}
+	if err := manager.Remove(jid); err != nil {
+		t.Errorf("Failed to remove client: %v", err)
+	} else if manager.Get(jid) != nil || len(manager.Clients()) != 2 {
+		t.Errorf("Client wasn't removed")
+	}
+	if err := manager.Connect(jid); !errors.Is(err, clientmanager.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+	for _, cli := range manager.Clients() {
+		if cli == clients[1] {
+			t.Errorf("Removed client is still listed")
+		}
+	}
+}
+
+func TestSetupClientProxyDoesNotModifySharedTransport(t *testing.T) {
+	container := inmemstore.New(nil)
+	manager := clientmanager.New(container, nil, 16)
+	sharedTransport := manager.HTTPClient.Transport.(*http.Transport)
+	sharedTransport.Proxy = nil
+	proxyURL, _ := url.Parse("http://proxy.example.com:8080")
+	manager.SetupClient = func(cli *whatsmeow.Client) {
+		cli.SetProxy(http.ProxyURL(proxyURL))
+	}
+	manager.NewPairingClient()
+	manager.NewPairingClient()
+	if manager.HTTPClient.Transport != sharedTransport {
+		t.Fatal("Shared transport was replaced")
+	} else if sharedTransport.Proxy != nil {
+		t.Fatal("SetupClient modified the proxy of the shared transport")
+	}
+}
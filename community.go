@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// CreateCommunity creates a new community with the given settings. The server creates the announcement group of
+// the community automatically, use GetCommunityGroups to find it.
+//
+// Communities are created without other members, add groups with CreateSubGroup or LinkGroup and users to the
+// announcement group to add them to the community.
+//
+//	community, err := cli.CreateCommunity(ctx, whatsmeow.GroupConfig{
+//		ReqCreateGroup: whatsmeow.ReqCreateGroup{Name: "Neighborhood"},
+//		Description:    "Everything happening around the block",
+//	})
+func (cli *Client) CreateCommunity(ctx context.Context, config GroupConfig) (*types.GroupInfo, error) {
+	config.IsParent = true
+	config.LinkedParentJID = types.EmptyJID
+	return cli.CreateGroupWithConfig(ctx, config)
+}
+
+// CreateSubGroup creates a new group inside the given community.
+//
+//	group, err := cli.CreateSubGroup(ctx, community.JID, whatsmeow.GroupConfig{
+//		ReqCreateGroup: whatsmeow.ReqCreateGroup{
+//			Name:         "Gardening",
+//			Participants: participants,
+//		},
+//	})
+func (cli *Client) CreateSubGroup(ctx context.Context, community types.JID, config GroupConfig) (*types.GroupInfo, error) {
+	config.IsParent = false
+	config.LinkedParentJID = community
+	return cli.CreateGroupWithConfig(ctx, config)
+}
+
+// GetCommunityGroups gets the groups of the given community, with the announcement group separated from the others.
+func (cli *Client) GetCommunityGroups(community types.JID) (*types.CommunityGroups, error) {
+	subGroups, err := cli.GetSubGroups(community)
+	if err != nil {
+		return nil, err
+	}
+	return splitCommunityGroups(subGroups), nil
+}
+
+func splitCommunityGroups(subGroups []*types.GroupLinkTarget) *types.CommunityGroups {
+	var groups types.CommunityGroups
+	for _, group := range subGroups {
+		if group.IsDefaultSubGroup && groups.Announcement == nil {
+			groups.Announcement = group
+		} else {
+			groups.SubGroups = append(groups.SubGroups, group)
+		}
+	}
+	return &groups
+}
+
+// GetCommunityAnnouncementGroup gets the JID of the announcement group of the given community.
+func (cli *Client) GetCommunityAnnouncementGroup(community types.JID) (types.JID, error) {
+	groups, err := cli.GetCommunityGroups(community)
+	if err != nil {
+		return types.EmptyJID, err
+	} else if groups.Announcement == nil {
+		return types.EmptyJID, fmt.Errorf("%w in %s", ErrNoAnnouncementGroup, community)
+	}
+	return groups.Announcement.JID, nil
+}
+
+// dispatchGroupNotification dispatches a parsed group notification, followed by CommunityLink events
+// if the notification links or unlinks groups in a community.
+func (cli *Client) dispatchGroupNotification(evt interface{}) {
+	cli.dispatchEvent(evt)
+	groupInfo, ok := evt.(*events.GroupInfo)
+	if !ok {
+		return
+	}
+	if linkEvt := communityLinkEvent(groupInfo, groupInfo.Link, false); linkEvt != nil {
+		cli.dispatchEvent(linkEvt)
+	}
+	if unlinkEvt := communityLinkEvent(groupInfo, groupInfo.Unlink, true); unlinkEvt != nil {
+		cli.dispatchEvent(unlinkEvt)
+	}
+}
+
+func communityLinkEvent(evt *events.GroupInfo, change *types.GroupLinkChange, unlinked bool) *events.CommunityLink {
+	if change == nil {
+		return nil
+	}
+	linkEvt := &events.CommunityLink{
+		Sender:       evt.Sender,
+		Timestamp:    evt.Timestamp,
+		Unlinked:     unlinked,
+		UnlinkReason: change.UnlinkReason,
+	}
+	switch change.Type {
+	case types.GroupLinkChangeTypeSub:
+		// The notification came to the community and the target is the subgroup
+		linkEvt.Community = evt.JID
+		linkEvt.Group = change.Group
+	case types.GroupLinkChangeTypeParent:
+		// The notification came to the subgroup and the target is the community
+		linkEvt.Community = change.Group.JID
+		linkEvt.Group = types.GroupLinkTarget{JID: evt.JID}
+	default:
+		// Sibling changes don't say which community they're about
+		return nil
+	}
+	return linkEvt
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestSplitCommunityGroups(t *testing.T) {
+	announcement := &types.GroupLinkTarget{JID: types.NewJID("1", types.GroupServer), GroupIsDefaultSub: types.GroupIsDefaultSub{IsDefaultSubGroup: true}}
+	// Only the first default subgroup is the announcement group
+	otherDefault := &types.GroupLinkTarget{JID: types.NewJID("2", types.GroupServer), GroupIsDefaultSub: types.GroupIsDefaultSub{IsDefaultSubGroup: true}}
+	group := &types.GroupLinkTarget{JID: types.NewJID("3", types.GroupServer)}
+
+	groups := splitCommunityGroups([]*types.GroupLinkTarget{group, announcement, otherDefault})
+	if groups.Announcement != announcement {
+		t.Errorf("Expected %s to be the announcement group, got %v", announcement.JID, groups.Announcement)
+	} else if !reflect.DeepEqual(groups.SubGroups, []*types.GroupLinkTarget{group, otherDefault}) {
+		t.Errorf("Unexpected subgroups %v", groups.SubGroups)
+	}
+	if groups = splitCommunityGroups([]*types.GroupLinkTarget{group}); groups.Announcement != nil || len(groups.SubGroups) != 1 {
+		t.Errorf("Expected no announcement group, got %+v", groups)
+	}
+}
+
+func TestCommunityLinkEvent(t *testing.T) {
+	sender := types.NewJID("2222", types.DefaultUserServer)
+	community := types.NewJID("111", types.GroupServer)
+	group := types.NewJID("222", types.GroupServer)
+	timestamp := time.Unix(1700000000, 0)
+	subTarget := types.GroupLinkTarget{JID: group, GroupName: types.GroupName{Name: "Sub"}}
+
+	tests := []struct {
+		name     string
+		evt      events.GroupInfo
+		change   *types.GroupLinkChange
+		unlinked bool
+		expected *events.CommunityLink
+	}{
+		{"no change", events.GroupInfo{JID: community}, nil, false, nil},
+		{"link in community", events.GroupInfo{JID: community, Sender: &sender, Timestamp: timestamp},
+			&types.GroupLinkChange{Type: types.GroupLinkChangeTypeSub, Group: subTarget}, false,
+			&events.CommunityLink{Community: community, Group: subTarget, Sender: &sender, Timestamp: timestamp}},
+		{"unlink in subgroup", events.GroupInfo{JID: group, Timestamp: timestamp},
+			&types.GroupLinkChange{Type: types.GroupLinkChangeTypeParent, UnlinkReason: types.GroupUnlinkReasonDelete, Group: types.GroupLinkTarget{JID: community}}, true,
+			&events.CommunityLink{Community: community, Group: types.GroupLinkTarget{JID: group}, Timestamp: timestamp, Unlinked: true, UnlinkReason: types.GroupUnlinkReasonDelete}},
+		{"sibling", events.GroupInfo{JID: group},
+			&types.GroupLinkChange{Type: types.GroupLinkChangeTypeSibling, Group: subTarget}, false, nil},
+	}
+	for _, test := range tests {
+		if linkEvt := communityLinkEvent(&test.evt, test.change, test.unlinked); !reflect.DeepEqual(linkEvt, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, linkEvt)
+		}
+	}
+}
+
+func TestDispatchGroupNotification(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	var dispatched []interface{}
+	cli.AddEventHandler(func(evt interface{}) {
+		dispatched = append(dispatched, evt)
+	})
+	community := types.NewJID("111", types.GroupServer)
+	groupInfo := &events.GroupInfo{
+		JID:    community,
+		Link:   &types.GroupLinkChange{Type: types.GroupLinkChangeTypeSub, Group: types.GroupLinkTarget{JID: types.NewJID("222", types.GroupServer)}},
+		Unlink: &types.GroupLinkChange{Type: types.GroupLinkChangeTypeSub, Group: types.GroupLinkTarget{JID: types.NewJID("333", types.GroupServer)}},
+	}
+	cli.dispatchGroupNotification(groupInfo)
+	if len(dispatched) != 3 || dispatched[0] != groupInfo {
+		t.Fatalf("Expected the group info followed by two community link events, got %v", dispatched)
+	}
+	link, _ := dispatched[1].(*events.CommunityLink)
+	unlink, _ := dispatched[2].(*events.CommunityLink)
+	if link == nil || link.Unlinked || link.Group.JID != groupInfo.Link.Group.JID {
+		t.Errorf("Unexpected link event %+v", dispatched[1])
+	}
+	if unlink == nil || !unlink.Unlinked || unlink.Group.JID != groupInfo.Unlink.Group.JID {
+		t.Errorf("Unexpected unlink event %+v", dispatched[2])
+	}
+
+	dispatched = nil
+	joinRequest := &events.GroupJoinRequest{JID: community}
+	cli.dispatchGroupNotification(joinRequest)
+	if len(dispatched) != 1 || dispatched[0] != joinRequest {
+		t.Errorf("Expected other group notifications to be dispatched as is, got %v", dispatched)
+	}
+}
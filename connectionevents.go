@@ -7,20 +7,29 @@
 package whatsmeow
 
 import (
-	"sync/atomic"
+	"context"
+	"errors"
+	"strconv"
 	"time"
 
 	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store"
 	"github.com/insomnius/whatsmeow/types"
 	"github.com/insomnius/whatsmeow/types/events"
 )
 
 func (cli *Client) handleStreamError(node *waBinary.Node) {
-	atomic.StoreUint32(&cli.isLoggedIn, 0)
 	cli.clearResponseWaiters(node)
 	code, _ := node.Attrs["code"].(string)
 	conflict, _ := node.GetOptionalChildByTag("conflict")
 	conflictType := conflict.AttrGetter().OptionalString("type")
+	codeInt, _ := strconv.Atoi(code)
+	reason := &ServerDisconnectError{Code: codeInt, Raw: node}
+	if code == "401" && conflictType == "device_removed" {
+		cli.setState(types.ConnectionStateLoggedOut, reason)
+	} else {
+		cli.setState(types.ConnectionStateDisconnected, reason)
+	}
 	switch {
 	case code == "515":
 		cli.Log.Infof("Got 515 code, reconnecting...")
@@ -34,11 +43,11 @@ func (cli *Client) handleStreamError(node *waBinary.Node) {
 	case code == "401" && conflictType == "device_removed":
 		cli.expectDisconnect()
 		cli.Log.Infof("Got device removed stream error, sending LoggedOut event and deleting session")
-		go cli.dispatchEvent(&events.LoggedOut{OnConnect: false, Reason: events.ConnectFailureLoggedOut})
-		err := cli.Store.Delete()
+		err := cli.Store.Delete(context.TODO())
 		if err != nil {
 			cli.Log.Warnf("Failed to delete store after device_removed error: %v", err)
 		}
+		go cli.handleLoggedOut(&events.LoggedOut{OnConnect: false, Reason: events.ConnectFailureLoggedOut})
 	case conflictType == "replaced":
 		cli.expectDisconnect()
 		cli.Log.Infof("Got replaced stream error, sending StreamReplaced event")
@@ -47,8 +56,10 @@ func (cli *Client) handleStreamError(node *waBinary.Node) {
 		// This seems to happen when the server wants to restart or something.
 		// The disconnection will be emitted as an events.Disconnected and then the auto-reconnect will do its thing.
 		cli.Log.Warnf("Got 503 stream error, assuming automatic reconnect will handle it")
+		cli.setDisconnectReason(reason)
 	default:
 		cli.Log.Errorf("Unknown stream error: %s", node.XMLString())
+		cli.setDisconnectReason(reason)
 		go cli.dispatchEvent(&events.StreamError{Code: code, Raw: node})
 	}
 }
@@ -79,15 +90,19 @@ func (cli *Client) handleIB(node *waBinary.Node) {
 func (cli *Client) handleConnectFailure(node *waBinary.Node) {
 	ag := node.AttrGetter()
 	reason := events.ConnectFailureReason(ag.Int("reason"))
-	cli.expectDisconnect()
+	failure := &ServerDisconnectError{Code: int(reason), Raw: node}
 	if reason.IsLoggedOut() {
+		cli.expectDisconnect()
+		cli.setState(types.ConnectionStateLoggedOut, failure)
 		cli.Log.Infof("Got %s connect failure, sending LoggedOut event and deleting session", reason)
-		go cli.dispatchEvent(&events.LoggedOut{OnConnect: true, Reason: reason})
-		err := cli.Store.Delete()
+		err := cli.Store.Delete(context.TODO())
 		if err != nil {
 			cli.Log.Warnf("Failed to delete store after %d failure: %v", int(reason), err)
 		}
+		go cli.handleLoggedOut(&events.LoggedOut{OnConnect: true, Reason: reason})
 	} else if reason == events.ConnectFailureTempBanned {
+		cli.expectDisconnect()
+		cli.setState(types.ConnectionStateBanned, failure)
 		cli.Log.Warnf("Temporary ban connect failure: %s", node.XMLString())
 		expiryTime := ag.UnixTime("expire")
 		go cli.dispatchEvent(&events.TemporaryBan{
@@ -95,10 +110,14 @@ func (cli *Client) handleConnectFailure(node *waBinary.Node) {
 			Expire: expiryTime,
 		})
 	} else if reason == events.ConnectFailureClientOutdated {
+		cli.expectDisconnect()
+		cli.setState(types.ConnectionStateDisconnected, failure)
 		cli.Log.Errorf("Client outdated (405) connect failure")
 		go cli.dispatchEvent(&events.ClientOutdated{})
 	} else {
+		cli.expectDisconnect()
 		cli.Log.Warnf("Unknown connect failure: %s", node.XMLString())
+		cli.setState(types.ConnectionStateDisconnected, failure)
 		go cli.dispatchEvent(&events.ConnectFailure{Reason: reason, Raw: node})
 	}
 }
@@ -107,15 +126,18 @@ func (cli *Client) handleConnectSuccess(node *waBinary.Node) {
 	cli.Log.Infof("Successfully authenticated")
 	cli.LastSuccessfulConnect = time.Now()
 	cli.AutoReconnectErrors = 0
-	atomic.StoreUint32(&cli.isLoggedIn, 1)
+	cli.setState(types.ConnectionStateOnline, nil)
 	go func() {
-		if dbCount, err := cli.Store.PreKeys.UploadedPreKeyCount(); err != nil {
+		if err := cli.Store.UpdateLastSeen(context.TODO(), cli.LastSuccessfulConnect); err != nil && !errors.Is(err, store.ErrReadOnly) {
+			cli.Log.Warnf("Failed to save last seen time of device: %v", err)
+		}
+		if dbCount, err := cli.Store.PreKeys.UploadedPreKeyCount(context.TODO()); err != nil {
 			cli.Log.Errorf("Failed to get number of prekeys in database: %v", err)
 		} else if serverCount, err := cli.getServerPreKeyCount(); err != nil {
 			cli.Log.Warnf("Failed to get number of prekeys on server: %v", err)
 		} else {
 			cli.Log.Debugf("Database has %d prekeys, server says we have %d", dbCount, serverCount)
-			if serverCount < MinPreKeyCount || dbCount < MinPreKeyCount {
+			if serverCount < cli.minPreKeyCount() || dbCount < cli.minPreKeyCount() {
 				cli.uploadPreKeys()
 				sc, _ := cli.getServerPreKeyCount()
 				cli.Log.Debugf("Prekey count after upload: %d", sc)
@@ -127,6 +149,8 @@ func (cli *Client) handleConnectSuccess(node *waBinary.Node) {
 		}
 		cli.dispatchEvent(&events.Connected{})
 		cli.closeSocketWaitChan()
+		cli.startFlushingOutbox()
+		cli.startScheduler()
 	}()
 }
 
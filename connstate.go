@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// State returns the current state of the connection to WhatsApp.
+//
+// Changes to the state are also emitted as events.ConnectionStateChanged.
+func (cli *Client) State() types.ConnectionState {
+	cli.stateLock.Lock()
+	defer cli.stateLock.Unlock()
+	return cli.state
+}
+
+func (cli *Client) setState(state types.ConnectionState, reason error) {
+	cli.stateLock.Lock()
+	defer cli.stateLock.Unlock()
+	cli.unlockedSetState(state, reason)
+}
+
+// setStateFrom changes the state only if the current state is the given one.
+func (cli *Client) setStateFrom(from, to types.ConnectionState, reason error) bool {
+	cli.stateLock.Lock()
+	defer cli.stateLock.Unlock()
+	if cli.state != from {
+		return false
+	}
+	cli.unlockedSetState(to, reason)
+	return true
+}
+
+// setDisconnectedState changes the state to disconnected, unless the client has been banned or logged out,
+// in which case the more specific state is kept.
+func (cli *Client) setDisconnectedState(reason error) {
+	cli.stateLock.Lock()
+	defer cli.stateLock.Unlock()
+	if !cli.state.IsTerminal() {
+		cli.unlockedSetState(types.ConnectionStateDisconnected, reason)
+	}
+}
+
+func (cli *Client) unlockedSetState(state types.ConnectionState, reason error) {
+	if cli.state == state {
+		return
+	}
+	cli.Log.Debugf("Connection state changed from %s to %s", cli.state, state)
+	cli.stateEvents = append(cli.stateEvents, &events.ConnectionStateChanged{
+		Previous: cli.state,
+		State:    state,
+		Reason:   reason,
+	})
+	cli.state = state
+	if !cli.stateEventsRunning {
+		cli.stateEventsRunning = true
+		go cli.dispatchStateEvents()
+	}
+}
+
+// dispatchStateEvents emits queued state change events one by one, so that they're received in order
+// without blocking the code that changed the state.
+func (cli *Client) dispatchStateEvents() {
+	for {
+		cli.stateLock.Lock()
+		if len(cli.stateEvents) == 0 {
+			cli.stateEventsRunning = false
+			cli.stateLock.Unlock()
+			return
+		}
+		evt := cli.stateEvents[0]
+		cli.stateEvents = cli.stateEvents[1:]
+		cli.stateLock.Unlock()
+		cli.dispatchEvent(evt)
+	}
+}
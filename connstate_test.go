@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestConnectionStateTransitions(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	changes := make(chan *events.ConnectionStateChanged, 16)
+	cli.AddEventHandler(func(evt interface{}) {
+		if change, ok := evt.(*events.ConnectionStateChanged); ok {
+			changes <- change
+		}
+	})
+	disconnectErr := errors.New("connection reset")
+
+	cli.setState(types.ConnectionStateConnecting, nil)
+	cli.setState(types.ConnectionStateHandshaking, nil)
+	cli.setState(types.ConnectionStateAuthenticating, nil)
+	cli.setState(types.ConnectionStateOnline, nil)
+	// Setting the same state again doesn't emit anything
+	cli.setState(types.ConnectionStateOnline, nil)
+	if cli.setStateFrom(types.ConnectionStateDegraded, types.ConnectionStateOnline, nil) {
+		t.Error("Expected recovering to fail when the connection isn't degraded")
+	}
+	cli.setStateFrom(types.ConnectionStateOnline, types.ConnectionStateDegraded, ErrKeepAliveTimedOut)
+	cli.setStateFrom(types.ConnectionStateDegraded, types.ConnectionStateOnline, nil)
+	cli.setDisconnectedState(disconnectErr)
+	cli.setState(types.ConnectionStateLoggedOut, nil)
+	// Logging out is final until the next connection attempt
+	cli.setDisconnectedState(nil)
+
+	expected := []events.ConnectionStateChanged{
+		{Previous: types.ConnectionStateDisconnected, State: types.ConnectionStateConnecting},
+		{Previous: types.ConnectionStateConnecting, State: types.ConnectionStateHandshaking},
+		{Previous: types.ConnectionStateHandshaking, State: types.ConnectionStateAuthenticating},
+		{Previous: types.ConnectionStateAuthenticating, State: types.ConnectionStateOnline},
+		{Previous: types.ConnectionStateOnline, State: types.ConnectionStateDegraded, Reason: ErrKeepAliveTimedOut},
+		{Previous: types.ConnectionStateDegraded, State: types.ConnectionStateOnline},
+		{Previous: types.ConnectionStateOnline, State: types.ConnectionStateDisconnected, Reason: disconnectErr},
+		{Previous: types.ConnectionStateDisconnected, State: types.ConnectionStateLoggedOut},
+	}
+	for i, expectedChange := range expected {
+		select {
+		case change := <-changes:
+			if *change != expectedChange {
+				t.Errorf("Expected change #%d to be %+v, got %+v", i+1, expectedChange, *change)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for change #%d (%s)", i+1, expectedChange.State)
+		}
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Unexpected extra change %+v", *change)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if state := cli.State(); state != types.ConnectionStateLoggedOut {
+		t.Errorf("Expected final state to be logged out, got %s", state)
+	}
+}
+
+func TestConnectionStateProperties(t *testing.T) {
+	for state := types.ConnectionStateDisconnected; state <= types.ConnectionStateLoggedOut; state++ {
+		loggedIn := state == types.ConnectionStateOnline || state == types.ConnectionStateDegraded
+		terminal := state == types.ConnectionStateBanned || state == types.ConnectionStateLoggedOut
+		if state.IsLoggedIn() != loggedIn || state.IsTerminal() != terminal {
+			t.Errorf("Unexpected properties for %s: logged in %t, terminal %t", state, state.IsLoggedIn(), state.IsTerminal())
+		}
+	}
+	if name := types.ConnectionState(100).String(); name != "unknown state 100" {
+		t.Errorf("Unexpected name for unknown state: %q", name)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"sync"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// DedupCache remembers which incoming messages have already been handled, so that messages the server
+// replays after a reconnect (e.g. because the acknowledgement was lost) aren't emitted twice.
+//
+// Implementations may persist the entries in a database to also catch replays across restarts.
+// The sender is always a non-AD JID.
+type DedupCache interface {
+	// HasSeen returns true if MarkSeen has been called with the same sender and message ID.
+	HasSeen(ctx context.Context, sender types.JID, id types.MessageID) (bool, error)
+	// MarkSeen remembers that the message has been handled.
+	MarkSeen(ctx context.Context, sender types.JID, id types.MessageID) error
+}
+
+type dedupKey struct {
+	Sender types.JID
+	ID     types.MessageID
+}
+
+// MemoryDedupCache is a DedupCache that keeps a fixed number of the most recent message IDs in memory.
+type MemoryDedupCache struct {
+	seen map[dedupKey]struct{}
+	list []dedupKey
+	ptr  int
+	lock sync.Mutex
+}
+
+var _ DedupCache = (*MemoryDedupCache)(nil)
+
+// NewMemoryDedupCache creates a new in-memory dedup cache that remembers the given number of messages.
+//
+//	cli.DedupCache = whatsmeow.NewMemoryDedupCache(1000)
+func NewMemoryDedupCache(size int) *MemoryDedupCache {
+	if size <= 0 {
+		size = 1
+	}
+	return &MemoryDedupCache{
+		seen: make(map[dedupKey]struct{}, size),
+		list: make([]dedupKey, size),
+	}
+}
+
+// HasSeen implements DedupCache.
+func (mdc *MemoryDedupCache) HasSeen(_ context.Context, sender types.JID, id types.MessageID) (bool, error) {
+	mdc.lock.Lock()
+	_, ok := mdc.seen[dedupKey{sender, id}]
+	mdc.lock.Unlock()
+	return ok, nil
+}
+
+// MarkSeen implements DedupCache. If the cache is full, the oldest entry is forgotten.
+func (mdc *MemoryDedupCache) MarkSeen(_ context.Context, sender types.JID, id types.MessageID) error {
+	key := dedupKey{sender, id}
+	mdc.lock.Lock()
+	defer mdc.lock.Unlock()
+	if _, ok := mdc.seen[key]; ok {
+		return nil
+	}
+	if oldest := mdc.list[mdc.ptr]; oldest.ID != "" {
+		delete(mdc.seen, oldest)
+	}
+	mdc.seen[key] = struct{}{}
+	mdc.list[mdc.ptr] = key
+	mdc.ptr = (mdc.ptr + 1) % len(mdc.list)
+	return nil
+}
+
+// isDuplicateMessage checks if the message has already been handled according to the dedup cache.
+func (cli *Client) isDuplicateMessage(ctx context.Context, info *types.MessageInfo) bool {
+	if cli.DedupCache == nil {
+		return false
+	}
+	seen, err := cli.DedupCache.HasSeen(ctx, info.Sender.ToNonAD(), info.ID)
+	if err != nil {
+		cli.Log.Warnf("Failed to check if %s from %s is a duplicate: %v", info.ID, info.SourceString(), err)
+		return false
+	}
+	return seen
+}
+
+func (cli *Client) markMessageSeen(ctx context.Context, info *types.MessageInfo) {
+	if cli.DedupCache == nil {
+		return
+	}
+	err := cli.DedupCache.MarkSeen(ctx, info.Sender.ToNonAD(), info.ID)
+	if err != nil {
+		cli.Log.Warnf("Failed to mark %s from %s as seen in dedup cache: %v", info.ID, info.SourceString(), err)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomnius/whatsmeow"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestMemoryDedupCache(t *testing.T) {
+	ctx := context.Background()
+	cache := whatsmeow.NewMemoryDedupCache(2)
+	sender := types.NewJID("1234", types.DefaultUserServer)
+	for _, id := range []types.MessageID{"A", "B", "B", "C"} {
+		_ = cache.MarkSeen(ctx, sender, id)
+	}
+	for id, expected := range map[types.MessageID]bool{"A": false, "B": true, "C": true, "D": false} {
+		if seen, _ := cache.HasSeen(ctx, sender, id); seen != expected {
+			t.Errorf("Expected HasSeen(%s) to be %t", id, expected)
+		}
+	}
+	if seen, _ := cache.HasSeen(ctx, types.NewJID("5678", types.DefaultUserServer), "B"); seen {
+		t.Errorf("Expected message from another sender not to be seen")
+	}
+}
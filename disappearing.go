@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// GetDisappearingTimer returns the last known disappearing message timer of the given chat.
+// The second return value is false if the timer of the chat isn't known.
+//
+// Timers are learned from incoming messages, group info and SetDisappearingTimer calls, and they're only kept in memory.
+func (cli *Client) GetDisappearingTimer(chat types.JID) (time.Duration, bool) {
+	cli.disappearingTimersLock.RLock()
+	timer, ok := cli.disappearingTimers[chat.ToNonAD()]
+	cli.disappearingTimersLock.RUnlock()
+	return timer, ok
+}
+
+func (cli *Client) cacheDisappearingTimer(chat types.JID, timer time.Duration) {
+	if chat.IsEmpty() {
+		return
+	}
+	cli.disappearingTimersLock.Lock()
+	cli.disappearingTimers[chat.ToNonAD()] = timer
+	cli.disappearingTimersLock.Unlock()
+}
+
+var contextInfoDescriptor = (&waProto.ContextInfo{}).ProtoReflect().Descriptor()
+var futureProofMessageDescriptor = (&waProto.FutureProofMessage{}).ProtoReflect().Descriptor()
+
+// findContextInfoHolder finds the content of the message that can contain a ContextInfo,
+// looking inside wrappers like ViewOnceMessageV2. It returns nil if the message type doesn't support ContextInfo.
+func findContextInfoHolder(msg protoreflect.Message) (holder protoreflect.Message, field protoreflect.FieldDescriptor) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		content := value.Message()
+		if content.Descriptor() == futureProofMessageDescriptor {
+			holder, field = findContextInfoHolder(content.Get(content.Descriptor().Fields().ByName("message")).Message())
+		} else if ctxField := content.Descriptor().Fields().ByName("contextInfo"); ctxField != nil && ctxField.Message() == contextInfoDescriptor {
+			holder, field = content, ctxField
+		}
+		return holder == nil
+	})
+	return
+}
+
+func getContextInfo(msg *waProto.Message) *waProto.ContextInfo {
+	holder, field := findContextInfoHolder(msg.ProtoReflect())
+	if holder == nil || !holder.Has(field) {
+		return nil
+	}
+	return holder.Get(field).Message().Interface().(*waProto.ContextInfo)
+}
+
+// applyDisappearingTimer returns a copy of the message with the expiration set to the known disappearing timer
+// of the chat, or the message itself if there's nothing to change.
+func (cli *Client) applyDisappearingTimer(to types.JID, message *waProto.Message) *waProto.Message {
+	if !cli.AutoApplyDisappearingTimer || (to.Server != types.DefaultUserServer && to.Server != types.GroupServer) {
+		return message
+	}
+	timer, ok := cli.GetDisappearingTimer(to)
+	if !ok || timer == 0 || getContextInfo(message).GetExpiration() != 0 {
+		return message
+	}
+	message = proto.Clone(message).(*waProto.Message)
+	if message.Conversation != nil {
+		message.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: message.Conversation}
+		message.Conversation = nil
+	}
+	holder, field := findContextInfoHolder(message.ProtoReflect())
+	if holder == nil {
+		return message
+	}
+	holder.Mutable(field).Message().Interface().(*waProto.ContextInfo).Expiration = proto.Uint32(uint32(timer.Seconds()))
+	return message
+}
+
+func (cli *Client) updateDisappearingTimerFromMessage(info *types.MessageInfo, msg *waProto.Message) {
+	if protoMsg := msg.GetProtocolMessage(); protoMsg.GetType() == waProto.ProtocolMessage_EPHEMERAL_SETTING {
+		cli.cacheDisappearingTimer(info.Chat, time.Duration(protoMsg.GetEphemeralExpiration())*time.Second)
+	} else if expiration := getContextInfo(msg).GetExpiration(); expiration > 0 {
+		cli.cacheDisappearingTimer(info.Chat, time.Duration(expiration)*time.Second)
+	}
+}
+
+func (cli *Client) updateDisappearingTimersFromHistory(conversations []*waProto.Conversation) {
+	for _, conv := range conversations {
+		chatJID, _ := types.ParseJID(conv.GetId())
+		if conv.EphemeralExpiration != nil {
+			cli.cacheDisappearingTimer(chatJID, time.Duration(conv.GetEphemeralExpiration())*time.Second)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func newDisappearingTestClient(chat types.JID, timer time.Duration) *Client {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.AutoApplyDisappearingTimer = true
+	cli.cacheDisappearingTimer(chat, timer)
+	return cli
+}
+
+func TestAutoApplyDisappearingTimerDefault(t *testing.T) {
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.cacheDisappearingTimer(chat, DisappearingTimer7Days)
+	msg := &waProto.Message{Conversation: proto.String("hello")}
+	if cli.AutoApplyDisappearingTimer {
+		t.Error("Expected AutoApplyDisappearingTimer to be disabled by default")
+	} else if cli.applyDisappearingTimer(chat, msg) != msg {
+		t.Error("Message was changed without enabling AutoApplyDisappearingTimer")
+	}
+}
+
+func TestApplyDisappearingTimer(t *testing.T) {
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	cli := newDisappearingTestClient(chat, DisappearingTimer7Days)
+	const expected = uint32(7 * 24 * 60 * 60)
+
+	tests := []struct {
+		name    string
+		message *waProto.Message
+		check   func(*waProto.Message) *waProto.ContextInfo
+	}{{
+		name:    "conversation is converted to extended text",
+		message: &waProto.Message{Conversation: proto.String("hi")},
+		check: func(msg *waProto.Message) *waProto.ContextInfo {
+			if msg.Conversation != nil || msg.GetExtendedTextMessage().GetText() != "hi" {
+				t.Errorf("Expected conversation to be converted to an extended text message, got %v", msg)
+			}
+			return msg.GetExtendedTextMessage().GetContextInfo()
+		},
+	}, {
+		name:    "existing context info is kept",
+		message: &waProto.Message{ImageMessage: &waProto.ImageMessage{ContextInfo: &waProto.ContextInfo{StanzaId: proto.String("quoted")}}},
+		check: func(msg *waProto.Message) *waProto.ContextInfo {
+			if msg.GetImageMessage().GetContextInfo().GetStanzaId() != "quoted" {
+				t.Error("Existing context info was lost")
+			}
+			return msg.GetImageMessage().GetContextInfo()
+		},
+	}, {
+		name: "view once wrapper",
+		message: &waProto.Message{ViewOnceMessageV2: &waProto.FutureProofMessage{Message: &waProto.Message{
+			VideoMessage: &waProto.VideoMessage{ViewOnce: proto.Bool(true)},
+		}}},
+		check: func(msg *waProto.Message) *waProto.ContextInfo {
+			return msg.GetViewOnceMessageV2().GetMessage().GetVideoMessage().GetContextInfo()
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := proto.Clone(test.message).(*waProto.Message)
+			result := cli.applyDisappearingTimer(chat, test.message)
+			if expiration := test.check(result).GetExpiration(); expiration != expected {
+				t.Errorf("Expected expiration %d, got %d", expected, expiration)
+			}
+			if !proto.Equal(test.message, original) {
+				t.Error("The original message was modified")
+			}
+		})
+	}
+}
+
+func TestApplyDisappearingTimer_Unchanged(t *testing.T) {
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	cli := newDisappearingTestClient(chat, DisappearingTimer24Hours)
+	explicit := &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+		Text:        proto.String("hi"),
+		ContextInfo: &waProto.ContextInfo{Expiration: proto.Uint32(60)},
+	}}
+	if cli.applyDisappearingTimer(chat, explicit) != explicit {
+		t.Error("Message with an explicit expiration was changed")
+	}
+	msg := &waProto.Message{Conversation: proto.String("hi")}
+	if cli.applyDisappearingTimer(types.NewJID("3333", types.DefaultUserServer), msg) != msg {
+		t.Error("Message to a chat with an unknown timer was changed")
+	}
+	if cli.applyDisappearingTimer(types.StatusBroadcastJID, msg) != msg {
+		t.Error("Message to a broadcast list was changed")
+	}
+	cli.cacheDisappearingTimer(chat, DisappearingTimerOff)
+	if cli.applyDisappearingTimer(chat, msg) != msg {
+		t.Error("Message to a chat with disappearing messages turned off was changed")
+	}
+	cli.cacheDisappearingTimer(chat, DisappearingTimer24Hours)
+	cli.AutoApplyDisappearingTimer = false
+	if cli.applyDisappearingTimer(chat, msg) != msg {
+		t.Error("Message was changed with AutoApplyDisappearingTimer disabled")
+	}
+}
+
+func TestUpdateDisappearingTimerFromMessage(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	info := &types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}}
+
+	cli.updateDisappearingTimerFromMessage(info, &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+		ContextInfo: &waProto.ContextInfo{Expiration: proto.Uint32(86400)},
+	}})
+	if timer, ok := cli.GetDisappearingTimer(chat); !ok || timer != DisappearingTimer24Hours {
+		t.Errorf("Expected timer to be learned from message expiration, got %s (known: %t)", timer, ok)
+	}
+	cli.updateDisappearingTimerFromMessage(info, &waProto.Message{ProtocolMessage: &waProto.ProtocolMessage{
+		Type:                waProto.ProtocolMessage_EPHEMERAL_SETTING.Enum(),
+		EphemeralExpiration: proto.Uint32(0),
+	}})
+	if timer, ok := cli.GetDisappearingTimer(chat); !ok || timer != DisappearingTimerOff {
+		t.Errorf("Expected timer to be turned off by the setting message, got %s (known: %t)", timer, ok)
+	}
+}
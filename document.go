@@ -0,0 +1,200 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/util/imageutil"
+)
+
+// DocumentPreview contains the metadata that the official clients show in the bubble of a document message.
+type DocumentPreview struct {
+	// The number of pages, or zero if it's not known.
+	PageCount uint32
+	// A JPEG thumbnail of the first page.
+	JPEGThumbnail   []byte
+	ThumbnailWidth  int
+	ThumbnailHeight int
+}
+
+// DocumentPreviewer extracts the page count and a thumbnail of documents for Client.UploadDocument.
+//
+// Implementations should return ErrThumbnailUnsupported for documents they can't handle.
+type DocumentPreviewer interface {
+	PreviewDocument(ctx context.Context, data []byte, mimetype string) (*DocumentPreview, error)
+}
+
+// PDFPreviewer is a DocumentPreviewer for PDF files. The page count is read from the file in pure Go, which doesn't
+// work for files that store the page objects in compressed object streams. Thumbnails of the first page are only
+// made if PdftoppmPath is set.
+type PDFPreviewer struct {
+	// The path to the pdftoppm binary from poppler-utils, which is used for rendering the first page,
+	// e.g. "pdftoppm" to look it up in PATH. If empty, no thumbnail is made.
+	PdftoppmPath string
+	// The maximum width and height of the thumbnail. Defaults to DefaultThumbnailSize.
+	MaxSize int
+}
+
+var _ DocumentPreviewer = (*PDFPreviewer)(nil)
+
+// PreviewDocument counts the pages of the PDF and renders the first page with pdftoppm if it's enabled.
+func (pp *PDFPreviewer) PreviewDocument(ctx context.Context, data []byte, mimetype string) (*DocumentPreview, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, ErrThumbnailUnsupported
+	}
+	preview := &DocumentPreview{PageCount: countPDFPages(data)}
+	if len(pp.PdftoppmPath) == 0 {
+		return preview, nil
+	}
+	// pdftoppm can't read the input from stdin
+	input, err := os.CreateTemp("", "whatsmeow-document-*.pdf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		_ = input.Close()
+		_ = os.Remove(input.Name())
+	}()
+	if _, err = input.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	size := thumbnailSize(pp.MaxSize)
+	cmd := exec.CommandContext(ctx, pp.PdftoppmPath,
+		"-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", strconv.Itoa(size), "-png",
+		input.Name(),
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %w (%s)", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	preview.JPEGThumbnail, preview.ThumbnailWidth, preview.ThumbnailHeight, err = imageutil.MakeThumbnail(stdout.Bytes(), size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make thumbnail of first page: %w", err)
+	}
+	return preview, nil
+}
+
+var pdfPageObjectRegex = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// countPDFPages counts the page objects in the given PDF file, or returns zero if there aren't any uncompressed ones.
+func countPDFPages(data []byte) uint32 {
+	return uint32(len(pdfPageObjectRegex.FindAllIndex(data, -1)))
+}
+
+// DocumentOptions contains the metadata for Client.UploadDocument.
+type DocumentOptions struct {
+	// The file name shown to recipients. If empty, "document" with an extension matching the mime type is used.
+	FileName string
+	// The mime type of the file. If empty, it's guessed from the file name extension or detected from the data.
+	Mimetype string
+	// The title shown in the message bubble. Defaults to the file name.
+	Title string
+	// A caption to send with the document.
+	Caption string
+	// The previewer used to extract the page count and a thumbnail. If nil, a PDFPreviewer without thumbnails is used.
+	// If it doesn't support the document, Client.Thumbnailer can still make a thumbnail when uploading.
+	Previewer DocumentPreviewer
+}
+
+// UploadDocument uploads the given file and returns a document message containing it, including the page count and
+// thumbnail from the previewer. Documents with a caption are wrapped in a DocumentWithCaptionMessage like the
+// official clients do.
+//
+//	msg, err := cli.UploadDocument(ctx, pdfData, whatsmeow.DocumentOptions{
+//		FileName:  "report.pdf",
+//		Caption:   "Here's the report",
+//		Previewer: &whatsmeow.PDFPreviewer{PdftoppmPath: "pdftoppm"},
+//	})
+//	// handle error
+//	resp, err := cli.SendMessage(ctx, chat, "", msg)
+func (cli *Client) UploadDocument(ctx context.Context, data []byte, opts DocumentOptions) (*waProto.Message, error) {
+	mimetype := opts.Mimetype
+	if len(mimetype) == 0 && len(opts.FileName) > 0 {
+		mimetype = mime.TypeByExtension(filepath.Ext(opts.FileName))
+	}
+	if len(mimetype) == 0 {
+		mimetype = sniffMediaMimetype(data)
+	}
+	fileName := opts.FileName
+	if len(fileName) == 0 {
+		fileName = "document"
+		if exts, _ := mime.ExtensionsByType(mimetype); len(exts) > 0 {
+			fileName += exts[0]
+		}
+	}
+	title := opts.Title
+	if len(title) == 0 {
+		title = fileName
+	}
+
+	previewer := opts.Previewer
+	if previewer == nil {
+		previewer = &PDFPreviewer{}
+	}
+	preview, err := previewer.PreviewDocument(ctx, data, mimetype)
+	if errors.Is(err, ErrThumbnailUnsupported) {
+		preview = &DocumentPreview{}
+	} else if err != nil {
+		// The preview is only cosmetic, so it's not worth failing the whole send
+		cli.Log.Warnf("Failed to make preview of %s: %v", fileName, err)
+		preview = &DocumentPreview{}
+	}
+
+	uploaded, err := cli.Upload(ctx, data, MediaDocument)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload document: %w", err)
+	}
+	if len(preview.JPEGThumbnail) == 0 && len(uploaded.JPEGThumbnail) > 0 {
+		preview.JPEGThumbnail = uploaded.JPEGThumbnail
+		preview.ThumbnailWidth, preview.ThumbnailHeight = int(uploaded.ThumbnailWidth), int(uploaded.ThumbnailHeight)
+	}
+	doc := &waProto.DocumentMessage{
+		Url:               proto.String(uploaded.URL),
+		DirectPath:        proto.String(uploaded.DirectPath),
+		MediaKey:          uploaded.MediaKey,
+		Mimetype:          proto.String(mimetype),
+		FileEncSha256:     uploaded.FileEncSHA256,
+		FileSha256:        uploaded.FileSHA256,
+		FileLength:        proto.Uint64(uploaded.FileLength),
+		FileName:          proto.String(fileName),
+		Title:             proto.String(title),
+		MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+	}
+	if preview.PageCount > 0 {
+		doc.PageCount = proto.Uint32(preview.PageCount)
+	}
+	if len(preview.JPEGThumbnail) > 0 {
+		doc.JpegThumbnail = preview.JPEGThumbnail
+		doc.ThumbnailWidth = proto.Uint32(uint32(preview.ThumbnailWidth))
+		doc.ThumbnailHeight = proto.Uint32(uint32(preview.ThumbnailHeight))
+	}
+	if len(opts.Caption) == 0 {
+		return &waProto.Message{DocumentMessage: doc}, nil
+	}
+	doc.Caption = proto.String(opts.Caption)
+	return &waProto.Message{DocumentWithCaptionMessage: &waProto.FutureProofMessage{
+		Message: &waProto.Message{DocumentMessage: doc},
+	}}, nil
+}
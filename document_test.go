@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+const testPDF = "%PDF-1.4\n1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] /Count 2 >> endobj\n" +
+	"2 0 obj << /Type /Page /Parent 1 0 R >> endobj\n3 0 obj <</Type/Page/Parent 1 0 R>> endobj\n%%EOF\n"
+
+// newUploadTestClient returns a client that uploads media to a local test server, which accepts everything.
+func newUploadTestClient(t *testing.T) *Client {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"url":"https://mmg.whatsapp.net/test","direct_path":"/v/test"}`))
+	}))
+	t.Cleanup(srv.Close)
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.mediaConnCache = &MediaConn{FetchedAt: time.Now(), TTL: 3600, Hosts: []MediaConnHost{{Hostname: srv.Listener.Addr().String()}}}
+	cli.SetHTTPClient(srv.Client())
+	return cli
+}
+
+type staticPreviewer struct {
+	preview *DocumentPreview
+	err     error
+}
+
+func (sp *staticPreviewer) PreviewDocument(ctx context.Context, data []byte, mimetype string) (*DocumentPreview, error) {
+	return sp.preview, sp.err
+}
+
+func TestPDFPreviewer(t *testing.T) {
+	ctx := context.Background()
+	if _, err := (&PDFPreviewer{}).PreviewDocument(ctx, []byte("hello"), "text/plain"); !errors.Is(err, ErrThumbnailUnsupported) {
+		t.Errorf("Expected ErrThumbnailUnsupported for non-PDF data, got %v", err)
+	}
+	preview, err := (&PDFPreviewer{}).PreviewDocument(ctx, []byte(testPDF), "application/pdf")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	} else if preview.PageCount != 2 || preview.JPEGThumbnail != nil {
+		t.Errorf("Expected 2 pages and no thumbnail, got %+v", preview)
+	}
+	missing := &PDFPreviewer{PdftoppmPath: filepath.Join(t.TempDir(), "pdftoppm")}
+	if _, err = missing.PreviewDocument(ctx, []byte(testPDF), "application/pdf"); err == nil {
+		t.Error("Expected error when pdftoppm can't be run")
+	}
+}
+
+func TestUploadDocument(t *testing.T) {
+	cli := newUploadTestClient(t)
+	ctx := context.Background()
+
+	msg, err := cli.UploadDocument(ctx, []byte(testPDF), DocumentOptions{})
+	if err != nil {
+		t.Fatalf("Failed to upload document: %v", err)
+	}
+	doc := msg.GetDocumentMessage()
+	if doc.GetFileName() != "document.pdf" || doc.GetTitle() != "document.pdf" || doc.GetMimetype() != "application/pdf" {
+		t.Errorf("Unexpected name, title or mime type in %v", doc)
+	} else if doc.GetPageCount() != 2 || doc.GetDirectPath() != "/v/test" || len(doc.GetMediaKey()) != 32 {
+		t.Errorf("Unexpected page count or upload info in %v", doc)
+	}
+
+	msg, err = cli.UploadDocument(ctx, []byte(`{"a":1}`), DocumentOptions{
+		FileName:  "data.json",
+		Title:     "Data",
+		Caption:   "Here's the data",
+		Previewer: &staticPreviewer{preview: &DocumentPreview{JPEGThumbnail: []byte{0xff, 0xd8}, ThumbnailWidth: 10, ThumbnailHeight: 20}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to upload document: %v", err)
+	} else if msg.GetDocumentMessage() != nil {
+		t.Fatal("Expected document with caption to be wrapped")
+	}
+	doc = msg.GetDocumentWithCaptionMessage().GetMessage().GetDocumentMessage()
+	if doc.GetFileName() != "data.json" || doc.GetTitle() != "Data" || doc.GetCaption() != "Here's the data" || doc.GetMimetype() != "application/json" {
+		t.Errorf("Unexpected metadata in %v", doc)
+	} else if len(doc.GetJpegThumbnail()) != 2 || doc.GetThumbnailWidth() != 10 || doc.GetThumbnailHeight() != 20 {
+		t.Errorf("Expected thumbnail from the previewer, got %v", doc)
+	} else if doc.PageCount != nil {
+		t.Error("Expected no page count when the previewer doesn't know it")
+	}
+
+	// Preview errors are only logged
+	msg, err = cli.UploadDocument(ctx, []byte(testPDF), DocumentOptions{FileName: "report.pdf", Previewer: &staticPreviewer{err: errors.New("broken")}})
+	if err != nil {
+		t.Fatalf("Expected preview error to be ignored, got %v", err)
+	} else if msg.GetDocumentMessage().PageCount != nil {
+		t.Error("Expected no page count when the preview failed")
+	}
+}
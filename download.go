@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -20,8 +21,20 @@ import (
 
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
 	"github.com/insomnius/whatsmeow/socket"
+	"github.com/insomnius/whatsmeow/types"
 	"github.com/insomnius/whatsmeow/util/cbcutil"
 	"github.com/insomnius/whatsmeow/util/hkdfutil"
+	"github.com/insomnius/whatsmeow/util/ratelimit"
+)
+
+var (
+	// GlobalUploadRateLimit limits the total speed of media uploads of all clients.
+	// For example, to limit uploads to 1 MiB/s:
+	//
+	//	whatsmeow.GlobalUploadRateLimit = ratelimit.New(1024 * 1024)
+	GlobalUploadRateLimit *ratelimit.Limiter
+	// GlobalDownloadRateLimit limits the total speed of media downloads of all clients.
+	GlobalDownloadRateLimit *ratelimit.Limiter
 )
 
 // MediaType represents a type of uploaded file on WhatsApp.
@@ -119,23 +132,38 @@ var mediaTypeToMMSType = map[MediaType]string{
 }
 
 // DownloadAny loops through the downloadable parts of the given message and downloads the first non-nil item.
-func (cli *Client) DownloadAny(msg *waProto.Message) (data []byte, err error) {
-	if msg == nil {
+//
+// If the info of the message is passed too, expired media is re-requested from the phone automatically
+// like DownloadAnyWithRetry does, waiting at most MediaRetryTimeout for the phone to re-upload it:
+//
+//	data, err := cli.DownloadAny(evt.Message, &evt.Info)
+func (cli *Client) DownloadAny(msg *waProto.Message, info ...*types.MessageInfo) (data []byte, err error) {
+	if len(info) > 0 && info[0] != nil {
+		return cli.DownloadAnyWithRetry(context.TODO(), info[0], msg)
+	}
+	part := getDownloadablePart(msg)
+	if part == nil {
 		return nil, ErrNothingDownloadableFound
 	}
+	return cli.Download(part)
+}
+
+func getDownloadablePart(msg *waProto.Message) DownloadableMessage {
 	switch {
+	case msg == nil:
+		return nil
 	case msg.ImageMessage != nil:
-		return cli.Download(msg.ImageMessage)
+		return msg.ImageMessage
 	case msg.VideoMessage != nil:
-		return cli.Download(msg.VideoMessage)
+		return msg.VideoMessage
 	case msg.AudioMessage != nil:
-		return cli.Download(msg.AudioMessage)
+		return msg.AudioMessage
 	case msg.DocumentMessage != nil:
-		return cli.Download(msg.DocumentMessage)
+		return msg.DocumentMessage
 	case msg.StickerMessage != nil:
-		return cli.Download(msg.StickerMessage)
+		return msg.StickerMessage
 	default:
-		return nil, ErrNothingDownloadableFound
+		return nil
 	}
 }
 
@@ -182,7 +210,21 @@ func GetMediaType(msg DownloadableMessage) MediaType {
 //	imageData, err := cli.Download(msg.GetImageMessage())
 //
 // You can also use DownloadAny to download the first non-nil sub-message.
+//
+// If Client.MediaCache is set, files are cached by their SHA-256 hash, so downloading the same file again
+// (even from a different message) returns the cached data.
 func (cli *Client) Download(msg DownloadableMessage) ([]byte, error) {
+	if data := cli.getCachedDownload(context.TODO(), msg.GetFileSha256()); data != nil {
+		return data, nil
+	}
+	data, err := cli.download(msg)
+	if err == nil {
+		cli.cacheDownload(context.TODO(), msg.GetFileSha256(), data)
+	}
+	return data, err
+}
+
+func (cli *Client) download(msg DownloadableMessage) ([]byte, error) {
 	mediaType, ok := classToMediaType[msg.ProtoReflect().Descriptor().Name()]
 	if !ok {
 		return nil, fmt.Errorf("%w '%s'", ErrUnknownMediaType, string(msg.ProtoReflect().Descriptor().Name()))
@@ -208,28 +250,83 @@ func (cli *Client) Download(msg DownloadableMessage) ([]byte, error) {
 
 // DownloadMediaWithPath downloads an attachment by manually specifying the path and encryption details.
 func (cli *Client) DownloadMediaWithPath(directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType MediaType, mmsType string) (data []byte, err error) {
-	var mediaConn *MediaConn
-	mediaConn, err = cli.refreshMediaConn(false)
+	var hosts []string
+	_, hosts, err = cli.getMediaHosts()
 	if err != nil {
-		return nil, fmt.Errorf("failed to refresh media connections: %w", err)
+		return nil, err
 	}
 	if len(mmsType) == 0 {
 		mmsType = mediaTypeToMMSType[mediaType]
 	}
-	for i, host := range mediaConn.Hosts {
-		mediaURL := fmt.Sprintf("https://%s%s&hash=%s&mms-type=%s&__wa-mms=", host.Hostname, directPath, base64.URLEncoding.EncodeToString(encFileHash), mmsType)
+	for i, host := range hosts {
+		mediaURL := fmt.Sprintf("https://%s%s&hash=%s&mms-type=%s&__wa-mms=", host, directPath, base64.URLEncoding.EncodeToString(encFileHash), mmsType)
 		data, err = cli.downloadAndDecrypt(mediaURL, mediaKey, mediaType, fileLength, encFileHash, fileHash)
-		// TODO there are probably some errors that shouldn't retry
-		if err != nil {
-			if i >= len(mediaConn.Hosts)-1 {
-				return nil, fmt.Errorf("failed to download media from last host: %w", err)
-			}
-			cli.Log.Warnf("Failed to download media: %s, trying with next host...", err)
+		retryable := err != nil && isRetryableDownloadError(err)
+		cli.reportMediaHost(host, retryable)
+		if !retryable {
+			return
+		} else if i >= len(hosts)-1 {
+			return nil, fmt.Errorf("failed to download media from last host: %w", err)
 		}
+		cli.Log.Warnf("Failed to download media from %s: %s, trying with next host...", host, err)
 	}
 	return
 }
 
+// DownloadProgressFunc is called by DownloadToWriter and DownloadResumable while downloading. The numbers are the amount
+// of encrypted data received so far and the total size of the encrypted file, which is -1 if the server didn't send the size.
+type DownloadProgressFunc func(downloaded, total int64)
+
+// DownloadToWriter downloads the attachment from the given protobuf message like Download, but writes the decrypted
+// data to the given writer as it's received instead of keeping the whole file in memory.
+//
+// The encryption MAC and hashes can only be checked after the whole file has been received, so the data is written
+// before it's verified. If an error is returned, the data written so far must be discarded, unless the download is
+// continued with DownloadResumable.
+// The progress function is optional.
+//
+//	file, err := os.Create("video.mp4")
+//	// handle error
+//	err = cli.DownloadToWriter(msg.GetVideoMessage(), file, func(downloaded, total int64) {
+//		fmt.Printf("Downloaded %d/%d bytes\n", downloaded, total)
+//	})
+func (cli *Client) DownloadToWriter(msg DownloadableMessage, w io.Writer, progress DownloadProgressFunc) error {
+	return cli.DownloadResumable(msg, w, &DownloadState{}, progress)
+}
+
+// DownloadMediaWithPathToWriter is like DownloadMediaWithPath, but writes the data to the given writer, see DownloadToWriter.
+//
+// If the download from one media host is interrupted, it's continued from the next host.
+func (cli *Client) DownloadMediaWithPathToWriter(directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType MediaType, mmsType string, w io.Writer, progress DownloadProgressFunc) error {
+	return cli.downloadMediaWithPathResumable(directPath, encFileHash, fileHash, mediaKey, fileLength, mediaType, mmsType, w, &DownloadState{}, progress)
+}
+
+func (cli *Client) downloadMediaWithPathResumable(directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType MediaType, mmsType string, w io.Writer, state *DownloadState, progress DownloadProgressFunc) error {
+	_, hosts, err := cli.getMediaHosts()
+	if err != nil {
+		return err
+	}
+	if len(mmsType) == 0 {
+		mmsType = mediaTypeToMMSType[mediaType]
+	}
+	for i, host := range hosts {
+		mediaURL := fmt.Sprintf("https://%s%s&hash=%s&mms-type=%s&__wa-mms=", host, directPath, base64.URLEncoding.EncodeToString(encFileHash), mmsType)
+		var retryable bool
+		retryable, err = cli.downloadAndDecryptResumable(mediaURL, mediaKey, mediaType, fileLength, encFileHash, fileHash, w, state, progress)
+		retryable = retryable && isRetryableDownloadError(err)
+		cli.reportMediaHost(host, retryable)
+		if err == nil {
+			return nil
+		} else if !retryable {
+			return err
+		} else if i >= len(hosts)-1 {
+			return fmt.Errorf("failed to download media from last host: %w", err)
+		}
+		cli.Log.Warnf("Failed to download media from %s: %s, trying with next host from offset %d...", host, err, state.Offset)
+	}
+	return err
+}
+
 func (cli *Client) downloadAndDecrypt(url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSha256, fileSha256 []byte) (data []byte, err error) {
 	iv, cipherKey, macKey, _ := getMediaKeys(mediaKey, appInfo)
 	var ciphertext, mac []byte
@@ -252,7 +349,10 @@ func getMediaKeys(mediaKey []byte, appInfo MediaType) (iv, cipherKey, macKey, re
 	return mediaKeyExpanded[:16], mediaKeyExpanded[16:48], mediaKeyExpanded[48:80], mediaKeyExpanded[80:]
 }
 
-func (cli *Client) downloadEncryptedMedia(url string, checksum []byte) (file, mac []byte, err error) {
+// openMediaDownload sends the HTTP request for downloading encrypted media and checks the status code.
+// If the offset is non-zero, the rest of the file is requested with a range header. The server may still respond
+// with the whole file, which can be detected from the status code.
+func (cli *Client) openMediaDownload(url string, offset int64) (resp *http.Response, err error) {
 	var req *http.Request
 	req, err = http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -261,13 +361,15 @@ func (cli *Client) downloadEncryptedMedia(url string, checksum []byte) (file, ma
 	}
 	req.Header.Set("Origin", socket.Origin)
 	req.Header.Set("Referer", socket.Origin+"/")
-	var resp *http.Response
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 	resp, err = cli.http.Do(req)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK && (offset == 0 || resp.StatusCode != http.StatusPartialContent) {
+		_ = resp.Body.Close()
 		if resp.StatusCode == http.StatusNotFound {
 			err = ErrMediaDownloadFailedWith404
 		} else if resp.StatusCode == http.StatusGone {
@@ -275,10 +377,20 @@ func (cli *Client) downloadEncryptedMedia(url string, checksum []byte) (file, ma
 		} else {
 			err = fmt.Errorf("download failed with status code %d", resp.StatusCode)
 		}
+		return nil, err
+	}
+	return
+}
+
+func (cli *Client) downloadEncryptedMedia(url string, checksum []byte) (file, mac []byte, err error) {
+	var resp *http.Response
+	resp, err = cli.openMediaDownload(url, 0)
+	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 	var data []byte
-	data, err = io.ReadAll(resp.Body)
+	data, err = io.ReadAll(ratelimit.NewReader(resp.Request.Context(), resp.Body, cli.DownloadRateLimit, GlobalDownloadRateLimit))
 	if err != nil {
 		return
 	} else if len(data) <= 10 {
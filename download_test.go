@@ -0,0 +1,105 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+// encryptTestMedia encrypts random data the way Upload does and returns the plaintext, the encrypted file
+// and an image message with the keys and hashes for downloading it from the given URL.
+func encryptTestMedia(t *testing.T, size int, url string) (plaintext, encrypted []byte, msg *waProto.ImageMessage) {
+	t.Helper()
+	plaintext = make([]byte, size)
+	mediaKey := make([]byte, 32)
+	_, _ = rand.Read(plaintext)
+	_, _ = rand.Read(mediaKey)
+	iv, cipherKey, macKey, _ := getMediaKeys(mediaKey, MediaImage)
+	var buf bytes.Buffer
+	fileSHA256, fileEncSHA256, _, err := encryptMediaStream(bytes.NewReader(plaintext), &buf, iv, cipherKey, macKey)
+	if err != nil {
+		t.Fatalf("failed to encrypt media: %v", err)
+	}
+	return plaintext, buf.Bytes(), &waProto.ImageMessage{
+		Url:           proto.String(url),
+		MediaKey:      mediaKey,
+		FileEncSha256: fileEncSHA256,
+		FileSha256:    fileSHA256,
+		FileLength:    proto.Uint64(uint64(size)),
+	}
+}
+
+func newMediaServer(t *testing.T, file *[]byte) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(*file))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadToWriter(t *testing.T) {
+	var file []byte
+	srv := newMediaServer(t, &file)
+	plaintext, file, msg := encryptTestMedia(t, 200*1024+3, srv.URL+"/media")
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+
+	var output bytes.Buffer
+	var lastDownloaded, lastTotal int64
+	err := cli.DownloadToWriter(msg, &output, func(downloaded, total int64) {
+		if downloaded < lastDownloaded {
+			t.Errorf("Progress went backwards from %d to %d", lastDownloaded, downloaded)
+		}
+		lastDownloaded, lastTotal = downloaded, total
+	})
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	} else if !bytes.Equal(output.Bytes(), plaintext) {
+		t.Fatal("Downloaded data doesn't match the original")
+	}
+	if lastDownloaded != int64(len(file)) || lastTotal != int64(len(file)) {
+		t.Errorf("Expected final progress %d/%d, got %d/%d", len(file), len(file), lastDownloaded, lastTotal)
+	}
+}
+
+func TestDownloadToWriter_Invalid(t *testing.T) {
+	var file []byte
+	srv := newMediaServer(t, &file)
+	_, original, msg := encryptTestMedia(t, 10*1024, srv.URL+"/media")
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+
+	tests := []struct {
+		name     string
+		file     []byte
+		expected error
+	}{
+		{"corrupted data", append(append([]byte{original[0] ^ 1}, original[1:len(original)-10]...), original[len(original)-10:]...), ErrInvalidMediaEncSHA256},
+		{"too short", original[:20], ErrTooShortFile},
+	}
+	for _, test := range tests {
+		file = test.file
+		if err := cli.DownloadToWriter(msg, &bytes.Buffer{}, nil); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+	// Without the encrypted hash, corrupted data is caught by the MAC
+	file = tests[0].file
+	msg.FileEncSha256 = nil
+	if err := cli.DownloadToWriter(msg, &bytes.Buffer{}, nil); !errors.Is(err, ErrInvalidMediaHMAC) {
+		t.Errorf("Expected ErrInvalidMediaHMAC, got %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDownloadBackoff is the retry policy used by DownloadManagers that don't have one set.
+// It retries failed downloads three times, waiting 1, 2 and 4 seconds (±20%).
+var DefaultDownloadBackoff = &ExponentialBackoff{
+	MaxAttempts:  3,
+	InitialDelay: 1 * time.Second,
+	MaxDelay:     1 * time.Minute,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// DownloadManager downloads media in the background with a limited number of concurrent downloads, and retries
+// downloads that fail because of network or server errors. It's meant for things like bots that archive all
+// incoming media, where downloading everything at once would overload the connection.
+//
+//	mgr := whatsmeow.NewDownloadManager(cli, 4)
+//	defer mgr.Close()
+//	handle := mgr.Enqueue(ctx, evt.Message.GetImageMessage())
+//	// do something else
+//	data, err := handle.Wait(ctx)
+type DownloadManager struct {
+	// PerHostConcurrency limits the number of concurrent downloads from a single media host. Zero means no limit
+	// other than the total concurrency. The host is the one that the download starts from: if it fails, the client
+	// may try other hosts without checking the limit. Downloads from hosts that are at the limit stay in the queue
+	// while downloads from other hosts are started.
+	PerHostConcurrency int
+	// Backoff decides how many times and after how long failed downloads are retried. If nil, DefaultDownloadBackoff
+	// is used. Downloads that fail for reasons where retrying won't help, like expired media or hash mismatches,
+	// aren't retried.
+	Backoff *ExponentialBackoff
+
+	cli    *Client
+	queue  []*DownloadHandle
+	closed bool
+	cond   *sync.Cond
+	lock   sync.Mutex
+
+	hosts   map[string]int
+	workers sync.WaitGroup
+}
+
+// DownloadHandle is a download queued in a DownloadManager. The result can be waited for with Wait or Done.
+type DownloadHandle struct {
+	ctx      context.Context
+	msg      DownloadableMessage
+	attempts int32
+
+	// host is the media host that the download starts from, found when a worker first looks at the download.
+	host      string
+	hostKnown bool
+
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewDownloadManager creates a download manager that runs up to the given number of downloads at the same time.
+// The manager must be closed with Close when it's not needed anymore.
+func NewDownloadManager(cli *Client, concurrency int) *DownloadManager {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	mgr := &DownloadManager{
+		cli:   cli,
+		hosts: make(map[string]int),
+	}
+	mgr.cond = sync.NewCond(&mgr.lock)
+	mgr.workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go mgr.worker()
+	}
+	return mgr
+}
+
+// Enqueue adds the given media to the download queue and returns a handle for getting the result.
+//
+// The context can be used to cancel the download while it's in the queue or waiting to be retried,
+// but downloads that have already started are not interrupted.
+func (mgr *DownloadManager) Enqueue(ctx context.Context, msg DownloadableMessage) *DownloadHandle {
+	handle := &DownloadHandle{ctx: ctx, msg: msg, done: make(chan struct{})}
+	mgr.push(handle)
+	if ctx.Done() != nil {
+		go mgr.wakeOnCancel(handle)
+	}
+	return handle
+}
+
+// wakeOnCancel wakes up the workers when the context of a download is canceled,
+// so that it's removed from the queue even if it's waiting for a busy host.
+func (mgr *DownloadManager) wakeOnCancel(handle *DownloadHandle) {
+	select {
+	case <-handle.ctx.Done():
+		mgr.lock.Lock()
+		mgr.cond.Broadcast()
+		mgr.lock.Unlock()
+	case <-handle.done:
+	}
+}
+
+// Close stops the download manager. Downloads that haven't started yet fail with ErrDownloadManagerClosed,
+// and Close waits for the downloads in progress to finish.
+func (mgr *DownloadManager) Close() {
+	mgr.lock.Lock()
+	mgr.closed = true
+	queue := mgr.queue
+	mgr.queue = nil
+	mgr.cond.Broadcast()
+	mgr.lock.Unlock()
+	for _, handle := range queue {
+		handle.finish(nil, ErrDownloadManagerClosed)
+	}
+	mgr.workers.Wait()
+}
+
+// QueueLength returns the number of downloads that are waiting to start.
+func (mgr *DownloadManager) QueueLength() int {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	return len(mgr.queue)
+}
+
+func (mgr *DownloadManager) push(handle *DownloadHandle) {
+	mgr.lock.Lock()
+	if mgr.closed {
+		mgr.lock.Unlock()
+		handle.finish(nil, ErrDownloadManagerClosed)
+		return
+	}
+	mgr.queue = append(mgr.queue, handle)
+	mgr.cond.Signal()
+	mgr.lock.Unlock()
+}
+
+func (mgr *DownloadManager) worker() {
+	defer mgr.workers.Done()
+	for {
+		handle := mgr.next()
+		if handle == nil {
+			return
+		}
+		mgr.download(handle)
+	}
+}
+
+// next waits for a queued download whose host isn't at the PerHostConcurrency limit, and takes a slot
+// for the host. Canceled downloads are removed from the queue on the way. It returns nil after Close.
+func (mgr *DownloadManager) next() *DownloadHandle {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	for !mgr.closed {
+		for i := 0; i < len(mgr.queue); i++ {
+			handle := mgr.queue[i]
+			if err := handle.ctx.Err(); err != nil {
+				mgr.removeQueued(i)
+				i--
+				handle.finish(nil, err)
+				continue
+			} else if !handle.hostKnown {
+				// Finding the host may need a media conn request, so do it without holding the lock
+				mgr.removeQueued(i)
+				mgr.lock.Unlock()
+				handle.host = mgr.getHost(handle.msg)
+				handle.hostKnown = true
+				mgr.lock.Lock()
+				if mgr.closed {
+					handle.finish(nil, ErrDownloadManagerClosed)
+					return nil
+				}
+				if i > len(mgr.queue) {
+					i = len(mgr.queue)
+				}
+				mgr.queue = append(mgr.queue[:i], append([]*DownloadHandle{handle}, mgr.queue[i:]...)...)
+			}
+			if len(handle.host) == 0 {
+				mgr.removeQueued(i)
+				return handle
+			} else if mgr.hosts[handle.host] < mgr.PerHostConcurrency {
+				mgr.removeQueued(i)
+				mgr.hosts[handle.host]++
+				return handle
+			}
+		}
+		mgr.cond.Wait()
+	}
+	return nil
+}
+
+func (mgr *DownloadManager) removeQueued(i int) {
+	copy(mgr.queue[i:], mgr.queue[i+1:])
+	mgr.queue[len(mgr.queue)-1] = nil
+	mgr.queue = mgr.queue[:len(mgr.queue)-1]
+}
+
+func (mgr *DownloadManager) download(handle *DownloadHandle) {
+	data, err := mgr.cli.Download(handle.msg)
+	mgr.releaseHost(handle.host)
+	attempts := int(atomic.AddInt32(&handle.attempts, 1))
+	if err == nil || !isRetryableDownloadError(err) {
+		handle.finish(data, err)
+		return
+	}
+	backoff := mgr.Backoff
+	if backoff == nil {
+		backoff = DefaultDownloadBackoff
+	}
+	delay, ok := backoff.NextReconnect(attempts, err)
+	if !ok {
+		handle.finish(nil, err)
+		return
+	}
+	mgr.cli.Log.Debugf("Download failed (attempt %d): %v, retrying in %s", attempts, err, delay)
+	go func() {
+		select {
+		case <-time.After(delay):
+			mgr.push(handle)
+		case <-handle.ctx.Done():
+			handle.finish(nil, handle.ctx.Err())
+		}
+	}()
+}
+
+// getHost returns the media host that the download of the given message will start from.
+func (mgr *DownloadManager) getHost(msg DownloadableMessage) string {
+	if mgr.PerHostConcurrency <= 0 {
+		return ""
+	}
+	if urlable, ok := msg.(downloadableMessageWithURL); ok && len(urlable.GetUrl()) > 0 && !strings.HasPrefix(urlable.GetUrl(), "https://web.whatsapp.net") {
+		if parsed, err := url.Parse(urlable.GetUrl()); err == nil {
+			return parsed.Host
+		}
+	}
+	_, hosts, err := mgr.cli.getMediaHosts()
+	if err != nil {
+		return ""
+	}
+	return hosts[0]
+}
+
+func (mgr *DownloadManager) releaseHost(host string) {
+	if len(host) == 0 {
+		return
+	}
+	mgr.lock.Lock()
+	mgr.hosts[host]--
+	if mgr.hosts[host] <= 0 {
+		delete(mgr.hosts, host)
+	}
+	mgr.cond.Broadcast()
+	mgr.lock.Unlock()
+}
+
+// isRetryableDownloadError returns false for download errors that will happen again if the download is retried.
+func isRetryableDownloadError(err error) bool {
+	for _, permanent := range []error{
+		ErrMediaDownloadFailedWith404, ErrMediaDownloadFailedWith410, ErrNoURLPresent, ErrUnknownMediaType,
+		ErrFileLengthMismatch, ErrTooShortFile, ErrInvalidMediaHMAC, ErrInvalidMediaEncSHA256, ErrInvalidMediaSHA256,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+func (handle *DownloadHandle) finish(data []byte, err error) {
+	handle.data, handle.err = data, err
+	close(handle.done)
+}
+
+// Done returns a channel that's closed when the download finishes or fails.
+func (handle *DownloadHandle) Done() <-chan struct{} {
+	return handle.done
+}
+
+// Result returns the downloaded data, or the error if the download failed. It must only be called after the
+// channel returned by Done is closed.
+func (handle *DownloadHandle) Result() ([]byte, error) {
+	return handle.data, handle.err
+}
+
+// Attempts returns the number of times the download has been attempted so far.
+func (handle *DownloadHandle) Attempts() int {
+	return int(atomic.LoadInt32(&handle.attempts))
+}
+
+// Wait waits for the download to finish and returns the result. If the context is canceled first,
+// the context error is returned, but the download continues in the background.
+func (handle *DownloadHandle) Wait(ctx context.Context) ([]byte, error) {
+	select {
+	case <-handle.done:
+		return handle.data, handle.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+)
+
+// newTestDownloadManager creates a download manager without workers, so that the test can call next directly.
+func newTestDownloadManager(perHost int) *DownloadManager {
+	mgr := &DownloadManager{PerHostConcurrency: perHost, hosts: make(map[string]int)}
+	mgr.cond = sync.NewCond(&mgr.lock)
+	return mgr
+}
+
+func enqueueTestDownload(mgr *DownloadManager, ctx context.Context, url string) *DownloadHandle {
+	return mgr.Enqueue(ctx, &waProto.ImageMessage{Url: proto.String(url)})
+}
+
+func nextWithTimeout(mgr *DownloadManager, timeout time.Duration) (*DownloadHandle, bool) {
+	result := make(chan *DownloadHandle, 1)
+	go func() {
+		result <- mgr.next()
+	}()
+	select {
+	case handle := <-result:
+		return handle, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+func TestDownloadManagerSkipsBusyHosts(t *testing.T) {
+	mgr := newTestDownloadManager(1)
+	ctx := context.Background()
+	first := enqueueTestDownload(mgr, ctx, "https://mmg-a.example.com/1")
+	second := enqueueTestDownload(mgr, ctx, "https://mmg-a.example.com/2")
+	other := enqueueTestDownload(mgr, ctx, "https://mmg-b.example.com/3")
+
+	if handle := mgr.next(); handle != first {
+		t.Fatal("Expected the first download to start first")
+	}
+	// The second download has to wait for the first one, but it mustn't block downloads from other hosts
+	if handle, ok := nextWithTimeout(mgr, time.Second); !ok || handle != other {
+		t.Fatal("Expected the download from the other host to start while the first host is busy")
+	}
+	blocked := make(chan *DownloadHandle, 1)
+	go func() {
+		blocked <- mgr.next()
+	}()
+	select {
+	case <-blocked:
+		t.Fatal("Download started even though its host is at the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	mgr.releaseHost(first.host)
+	select {
+	case handle := <-blocked:
+		if handle != second {
+			t.Fatal("Expected the second download to start after the first one finished")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Waiting download didn't start after the host was released")
+	}
+}
+
+func TestDownloadManagerCancelWhileWaitingForHost(t *testing.T) {
+	mgr := newTestDownloadManager(1)
+	enqueueTestDownload(mgr, context.Background(), "https://mmg-a.example.com/1")
+	if mgr.next() == nil {
+		t.Fatal("Expected the first download to start")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := enqueueTestDownload(mgr, ctx, "https://mmg-a.example.com/2")
+	go mgr.next()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if _, err := waiting.Wait(withTestTimeout(t)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled download to fail with context.Canceled, got %v", err)
+	}
+	if mgr.QueueLength() != 0 {
+		t.Errorf("Canceled download wasn't removed from the queue")
+	}
+}
+
+func TestDownloadManagerCloseWhileWaitingForHost(t *testing.T) {
+	mgr := newTestDownloadManager(1)
+	enqueueTestDownload(mgr, context.Background(), "https://mmg-a.example.com/1")
+	mgr.next()
+	waiting := enqueueTestDownload(mgr, context.Background(), "https://mmg-a.example.com/2")
+	result := make(chan *DownloadHandle, 1)
+	go func() {
+		result <- mgr.next()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	mgr.Close()
+	select {
+	case handle := <-result:
+		if handle != nil {
+			t.Error("Expected next to return nil after closing")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Worker kept waiting for the host after closing")
+	}
+	if _, err := waiting.Wait(withTestTimeout(t)); !errors.Is(err, ErrDownloadManagerClosed) {
+		t.Errorf("Expected ErrDownloadManagerClosed, got %v", err)
+	}
+}
+
+func withTestTimeout(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
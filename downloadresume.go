@@ -0,0 +1,258 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/insomnius/whatsmeow/util/ratelimit"
+)
+
+// DownloadState contains the progress of a media download started with DownloadResumable. All the fields are
+// exported, so it can be stored (e.g. as JSON) to resume the download after the process is restarted.
+type DownloadState struct {
+	// Offset is the number of bytes of the encrypted file that have been downloaded, decrypted and written.
+	// The decrypted data written so far has the same length.
+	Offset int64
+
+	// The decryption and hashing state at Offset.
+	IV                 []byte
+	EncryptedHashState []byte
+	MACHashState       []byte
+	PlaintextHashState []byte
+}
+
+// DownloadResumable downloads the attachment from the given protobuf message like DownloadToWriter, but keeps track of
+// the progress in the given state, so that an interrupted download can be continued from where it stopped instead of
+// starting from the beginning again.
+//
+// To start a new download, pass an empty state. If the download fails, the state can be stored and passed to
+// DownloadResumable later to continue. Before resuming, the writer must contain exactly the first state.Offset bytes of
+// the decrypted file, which means that files should be truncated to state.Offset and opened for appending:
+//
+//	state := &whatsmeow.DownloadState{}
+//	err := cli.DownloadResumable(msg.GetVideoMessage(), file, state, nil)
+//	if err != nil {
+//		// store the state somewhere, and later:
+//		_ = file.Truncate(state.Offset)
+//		_, _ = file.Seek(state.Offset, io.SeekStart)
+//		err = cli.DownloadResumable(msg.GetVideoMessage(), file, state, nil)
+//	}
+//
+// The rest of the file is requested from the server with a HTTP range request.
+func (cli *Client) DownloadResumable(msg DownloadableMessage, w io.Writer, state *DownloadState, progress DownloadProgressFunc) error {
+	mediaType, ok := classToMediaType[msg.ProtoReflect().Descriptor().Name()]
+	if !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownMediaType, string(msg.ProtoReflect().Descriptor().Name()))
+	}
+	urlable, ok := msg.(downloadableMessageWithURL)
+	if ok && len(urlable.GetUrl()) > 0 && !strings.HasPrefix(urlable.GetUrl(), "https://web.whatsapp.net") {
+		_, err := cli.downloadAndDecryptResumable(urlable.GetUrl(), msg.GetMediaKey(), mediaType, getSize(msg), msg.GetFileEncSha256(), msg.GetFileSha256(), w, state, progress)
+		return err
+	} else if len(msg.GetDirectPath()) > 0 {
+		return cli.downloadMediaWithPathResumable(msg.GetDirectPath(), msg.GetFileEncSha256(), msg.GetFileSha256(), msg.GetMediaKey(), getSize(msg), mediaType, mediaTypeToMMSType[mediaType], w, state, progress)
+	}
+	return ErrNoURLPresent
+}
+
+// mediaHoldBack is the number of bytes at the end of the downloaded data that can't be decrypted before the
+// download is complete: the last block of the ciphertext contains the padding, and it's followed by a 10-byte MAC.
+const mediaHoldBack = aes.BlockSize + 10
+
+// downloadAndDecryptResumable streams media from the given URL into the writer, starting from the offset in the state.
+// The first return value is true if the error was caused by the HTTP request, so the download can be resumed with
+// another media host. The state is updated even if an error is returned.
+func (cli *Client) downloadAndDecryptResumable(url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSha256, fileSha256 []byte, w io.Writer, state *DownloadState, progress DownloadProgressFunc) (retryable bool, err error) {
+	iv, cipherKey, macKey, _ := getMediaKeys(mediaKey, appInfo)
+	md, err := newMediaDecrypter(state, iv, cipherKey, macKey, w)
+	if err != nil {
+		return false, err
+	}
+	defer md.saveState()
+
+	resp, err := cli.openMediaDownload(url, state.Offset)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	body := ratelimit.NewReader(resp.Request.Context(), resp.Body, cli.DownloadRateLimit, GlobalDownloadRateLimit)
+	if state.Offset > 0 && resp.StatusCode == http.StatusOK {
+		// The server ignored the range header and sent the whole file
+		if _, err = io.CopyN(io.Discard, body, state.Offset); err != nil {
+			return true, err
+		}
+	}
+	total := int64(-1)
+	if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+		total = resp.ContentLength
+	} else if resp.ContentLength >= 0 {
+		total = state.Offset + resp.ContentLength
+	}
+
+	readBuf := make([]byte, 32*1024)
+	pending := make([]byte, 0, len(readBuf)+mediaHoldBack)
+	for {
+		n, readErr := body.Read(readBuf)
+		pending = append(pending, readBuf[:n]...)
+		if progress != nil && n > 0 {
+			progress(state.Offset+int64(len(pending)), total)
+		}
+		if processable := (len(pending) - mediaHoldBack) / aes.BlockSize * aes.BlockSize; processable > 0 {
+			if err = md.process(pending[:processable]); err != nil {
+				return false, err
+			}
+			pending = append(pending[:0], pending[processable:]...)
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return true, readErr
+		}
+	}
+	if len(pending) < mediaHoldBack {
+		return false, ErrTooShortFile
+	} else if (len(pending)-10)%aes.BlockSize != 0 {
+		return false, fmt.Errorf("failed to decrypt file: ciphertext is not a multiple of the block size")
+	}
+	mac := pending[len(pending)-10:]
+	length, err := md.finish(pending[:len(pending)-10], mac)
+	if err != nil {
+		return false, err
+	} else if len(fileEncSha256) == 32 && !hmac.Equal(md.encryptedHash.Sum(nil), fileEncSha256) {
+		return false, ErrInvalidMediaEncSHA256
+	} else if !hmac.Equal(md.macSum(), mac) {
+		return false, ErrInvalidMediaHMAC
+	} else if fileLength >= 0 && length != int64(fileLength) {
+		return false, fmt.Errorf("%w: expected %d, got %d", ErrFileLengthMismatch, fileLength, length)
+	} else if len(fileSha256) == 32 && !hmac.Equal(md.plaintextHash.Sum(nil), fileSha256) {
+		return false, ErrInvalidMediaSHA256
+	}
+	return false, nil
+}
+
+// mediaDecrypter decrypts and hashes media incrementally. The HMAC is computed manually with a plain SHA-256 hash
+// as the inner hash, because unlike crypto/hmac, the state of the plain hash can be saved and restored.
+type mediaDecrypter struct {
+	state *DownloadState
+	w     io.Writer
+
+	mode      cipher.BlockMode
+	lastBlock []byte
+	plainBuf  []byte
+	macKey    []byte
+
+	encryptedHash hash.Hash
+	macHash       hash.Hash
+	plaintextHash hash.Hash
+}
+
+func newMediaDecrypter(state *DownloadState, iv, cipherKey, macKey []byte, w io.Writer) (*mediaDecrypter, error) {
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return nil, err
+	}
+	md := &mediaDecrypter{
+		state:  state,
+		w:      w,
+		macKey: macKey,
+
+		encryptedHash: sha256.New(),
+		macHash:       sha256.New(),
+		plaintextHash: sha256.New(),
+	}
+	if state.Offset == 0 {
+		md.lastBlock = iv
+		md.macHash.Write(hmacKeyPad(macKey, 0x36))
+		md.macHash.Write(iv)
+	} else if state.Offset < 0 || state.Offset%aes.BlockSize != 0 || len(state.IV) != aes.BlockSize {
+		return nil, ErrInvalidDownloadState
+	} else {
+		md.lastBlock = state.IV
+		for _, item := range []struct {
+			hash  hash.Hash
+			state []byte
+		}{{md.encryptedHash, state.EncryptedHashState}, {md.macHash, state.MACHashState}, {md.plaintextHash, state.PlaintextHashState}} {
+			if err = item.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(item.state); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidDownloadState, err)
+			}
+		}
+	}
+	md.mode = cipher.NewCBCDecrypter(block, md.lastBlock)
+	return md, nil
+}
+
+// process decrypts and writes full blocks of ciphertext that are known not to be the last block.
+// The state is only changed if the plaintext was written successfully.
+func (md *mediaDecrypter) process(ciphertext []byte) error {
+	if cap(md.plainBuf) < len(ciphertext) {
+		md.plainBuf = make([]byte, len(ciphertext))
+	}
+	plaintext := md.plainBuf[:len(ciphertext)]
+	md.mode.CryptBlocks(plaintext, ciphertext)
+	if _, err := md.w.Write(plaintext); err != nil {
+		return err
+	}
+	md.encryptedHash.Write(ciphertext)
+	md.macHash.Write(ciphertext)
+	md.plaintextHash.Write(plaintext)
+	md.lastBlock = append([]byte(nil), ciphertext[len(ciphertext)-aes.BlockSize:]...)
+	md.state.Offset += int64(len(ciphertext))
+	return nil
+}
+
+// finish decrypts the final blocks of the ciphertext, removes the padding and adds the MAC to the encrypted hash.
+// It returns the total length of the plaintext.
+func (md *mediaDecrypter) finish(ciphertext, mac []byte) (int64, error) {
+	plaintext := make([]byte, len(ciphertext))
+	md.mode.CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return 0, fmt.Errorf("failed to decrypt file: invalid padding length %d", padding)
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+	if _, err := md.w.Write(plaintext); err != nil {
+		return 0, err
+	}
+	md.encryptedHash.Write(ciphertext)
+	md.encryptedHash.Write(mac)
+	md.macHash.Write(ciphertext)
+	md.plaintextHash.Write(plaintext)
+	return md.state.Offset + int64(len(plaintext)), nil
+}
+
+func (md *mediaDecrypter) macSum() []byte {
+	outer := sha256.New()
+	outer.Write(hmacKeyPad(md.macKey, 0x5c))
+	outer.Write(md.macHash.Sum(nil))
+	return outer.Sum(nil)[:10]
+}
+
+func (md *mediaDecrypter) saveState() {
+	md.state.IV = md.lastBlock
+	md.state.EncryptedHashState, _ = md.encryptedHash.(encoding.BinaryMarshaler).MarshalBinary()
+	md.state.MACHashState, _ = md.macHash.(encoding.BinaryMarshaler).MarshalBinary()
+	md.state.PlaintextHashState, _ = md.plaintextHash.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+// hmacKeyPad returns the HMAC-SHA256 key XORed with the given padding byte (0x36 for the inner hash and 0x5c for the outer).
+func hmacKeyPad(key []byte, padByte byte) []byte {
+	padded := make([]byte, sha256.BlockSize)
+	copy(padded, key)
+	for i := range padded {
+		padded[i] ^= padByte
+	}
+	return padded
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+// newInterruptedMediaServer serves the given file, but drops the connection of the first request after cutAt bytes.
+// If ignoreRange is true, the server always sends the whole file like servers that don't support range requests.
+func newInterruptedMediaServer(t *testing.T, file []byte, cutAt int, ignoreRange bool) (*httptest.Server, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("failed to hijack connection: %v", err)
+				return
+			}
+			_, _ = fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(file))
+			_, _ = conn.Write(file[:cutAt])
+			_ = conn.Close()
+			return
+		}
+		if ignoreRange {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(file))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestDownloadResumable(t *testing.T) {
+	plaintext, encrypted, msg := encryptTestMedia(t, 100*1024+7, "")
+
+	for name, ignoreRange := range map[string]bool{"range request": false, "server ignores range": true} {
+		t.Run(name, func(t *testing.T) {
+			srv, requests := newInterruptedMediaServer(t, encrypted, len(encrypted)/2, ignoreRange)
+			cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+			msg := proto.Clone(msg).(*waProto.ImageMessage)
+			msg.Url = proto.String(srv.URL + "/media")
+
+			var output bytes.Buffer
+			state := &DownloadState{}
+			if err := cli.DownloadResumable(msg, &output, state, nil); err == nil {
+				t.Fatal("expected the interrupted download to fail")
+			}
+			if state.Offset <= 0 || state.Offset > int64(len(encrypted)/2) {
+				t.Fatalf("unexpected offset %d after interrupted download", state.Offset)
+			} else if int64(output.Len()) != state.Offset {
+				t.Fatalf("expected %d bytes of output after interrupted download, got %d", state.Offset, output.Len())
+			}
+
+			// Make sure the state works after being stored and loaded
+			stored, err := json.Marshal(state)
+			if err != nil {
+				t.Fatalf("failed to marshal state: %v", err)
+			}
+			var resumedState DownloadState
+			if err = json.Unmarshal(stored, &resumedState); err != nil {
+				t.Fatalf("failed to unmarshal state: %v", err)
+			}
+			if err = cli.DownloadResumable(msg, &output, &resumedState, nil); err != nil {
+				t.Fatalf("failed to resume download: %v", err)
+			} else if atomic.LoadInt32(requests) != 2 {
+				t.Errorf("expected 2 requests, got %d", atomic.LoadInt32(requests))
+			}
+			if !bytes.Equal(output.Bytes(), plaintext) {
+				t.Fatalf("resumed download doesn't match the original (got %d bytes, expected %d)", output.Len(), len(plaintext))
+			}
+		})
+	}
+}
+
+func TestDownloadResumable_DetectsCorruption(t *testing.T) {
+	_, file, msg := encryptTestMedia(t, 50*1024, "")
+	srv, _ := newInterruptedMediaServer(t, file, len(file)/2, false)
+	// Change a byte after the cut, so the corrupted data is only received when resuming
+	file[len(file)*3/4] ^= 1
+	msg.Url = proto.String(srv.URL + "/media")
+
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	var output bytes.Buffer
+	state := &DownloadState{}
+	if err := cli.DownloadResumable(msg, &output, state, nil); err == nil {
+		t.Fatal("expected the interrupted download to fail")
+	}
+	if err := cli.DownloadResumable(msg, &output, state, nil); !errors.Is(err, ErrInvalidMediaEncSHA256) {
+		t.Fatalf("expected ErrInvalidMediaEncSHA256 after resuming with corrupted data, got %v", err)
+	}
+}
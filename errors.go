@@ -25,8 +25,30 @@ var (
 
 	ErrQRAlreadyConnected = errors.New("GetQRChannel must be called before connecting")
 	ErrQRStoreContainsID  = errors.New("GetQRChannel can only be called when there's no user ID in the client's Store")
+	ErrQRItemNotCode      = errors.New("QR channel item doesn't contain a code")
+
+	ErrPhoneNumberTooShort           = errors.New("phone number too short")
+	ErrPhoneNumberIsNotInternational = errors.New("international phone number required (must not start with 0)")
 
 	ErrNoPushName = errors.New("can't send presence without PushName set")
+
+	ErrInvalidTwoFactorPIN = errors.New("two-step verification PIN must be 6 digits")
+
+	ErrDeviceNotOwn            = errors.New("device doesn't belong to the user's own account")
+	ErrCantRemovePrimaryDevice = errors.New("the primary device can't be removed")
+	ErrCantRemoveCurrentDevice = errors.New("use Logout to remove the current device")
+
+	ErrNoChatSettingsStore = errors.New("the store doesn't have a chat settings store")
+	ErrNoOutboxStore       = errors.New("the store doesn't have an outbox")
+	ErrNoScheduleStore     = errors.New("the store doesn't have a schedule store")
+	ErrNoReactionStore     = errors.New("the store doesn't have a reaction store")
+	ErrNoPollStore         = errors.New("the store doesn't have a poll store")
+
+	ErrUnsupportedProxyScheme = errors.New("proxy URL scheme must be http, https, socks5 or socks5h")
+
+	ErrKeepAliveTimedOut = errors.New("websocket keepalive ping timed out")
+
+	ErrClientShuttingDown = errors.New("client is shutting down")
 )
 
 var (
@@ -46,17 +68,24 @@ var (
 	ErrInviteLinkInvalid = errors.New("that group invite link is not valid")
 	// ErrInviteLinkRevoked is returned by methods that use group invite links if the invite link was valid, but has been revoked and can no longer be used.
 	ErrInviteLinkRevoked = errors.New("that group invite link has been revoked")
+	// ErrGroupJoinApprovalRequired is returned by JoinGroupWithLink if the group requires admins to approve new members.
+	// The join request was sent, but the user isn't a member of the group yet.
+	ErrGroupJoinApprovalRequired = errors.New("joining the group requires admin approval, a join request was sent")
+	// ErrNoAnnouncementGroup is returned by GetCommunityAnnouncementGroup if the community doesn't have an announcement group.
+	ErrNoAnnouncementGroup = errors.New("no announcement group found")
 	// ErrBusinessMessageLinkNotFound is returned by ResolveBusinessMessageLink if the link doesn't exist or has been revoked.
 	ErrBusinessMessageLinkNotFound = errors.New("that business message link does not exist or has been revoked")
 	// ErrContactQRLinkNotFound is returned by ResolveContactQRLink if the link doesn't exist or has been revoked.
 	ErrContactQRLinkNotFound = errors.New("that contact QR link does not exist or has been revoked")
-	// ErrInvalidImageFormat is returned by SetGroupPhoto if the given photo is not in the correct format.
+	// ErrInvalidImageFormat is returned by SetGroupPhoto if the given photo can't be decoded or is rejected by the server.
 	ErrInvalidImageFormat = errors.New("the given data is not a valid image")
 	// ErrMediaNotAvailableOnPhone is returned by DecryptMediaRetryNotification if the given event contains error code 2.
 	ErrMediaNotAvailableOnPhone = errors.New("media no longer available on phone")
 	// ErrUnknownMediaRetryError is returned by DecryptMediaRetryNotification if the given event contains an unknown error code.
 	ErrUnknownMediaRetryError = errors.New("unknown media retry error")
-	// ErrInvalidDisappearingTimer is returned by SetDisappearingTimer if the given timer is not one of the allowed values.
+	// ErrMediaRetryFailed is returned by RequestMediaRetry if the phone responds with something else than success.
+	ErrMediaRetryFailed = errors.New("phone failed to re-upload media")
+	// ErrInvalidDisappearingTimer is returned by SetDisappearingTimer and CreateGroupWithConfig if the given timer is not one of the allowed values.
 	ErrInvalidDisappearingTimer = errors.New("invalid disappearing timer provided")
 )
 
@@ -65,6 +94,44 @@ var (
 	ErrBroadcastListUnsupported = errors.New("sending to non-status broadcast lists is not yet supported")
 	ErrUnknownServer            = errors.New("can't send message to unknown server")
 	ErrRecipientADJID           = errors.New("message recipient must be normal (non-AD) JID")
+	ErrServerReturnedError      = errors.New("server returned error")
+)
+
+// Some errors that Client.DeleteForEveryone can return
+var (
+	ErrRevokeWindowExpired     = errors.New("message is too old to be revoked")
+	ErrCantRevokeOthersMessage = errors.New("other users' messages can only be revoked in groups")
+)
+
+// ErrCantForwardMessage is returned by Client.ForwardMessage if the given message type can't be forwarded.
+var ErrCantForwardMessage = errors.New("message can't be forwarded")
+
+// Some errors that Client.SendBulk can return
+var (
+	ErrBulkSendAborted = errors.New("bulk send aborted")
+)
+
+// ServerAckError is returned by Client.SendMessage if the server acknowledged the message with an error code.
+type ServerAckError struct {
+	Code int
+}
+
+func (err *ServerAckError) Error() string {
+	return fmt.Sprintf("%v %d", ErrServerReturnedError, err.Code)
+}
+
+func (err *ServerAckError) Is(other error) bool {
+	if other == ErrServerReturnedError {
+		return true
+	}
+	otherErr, ok := other.(*ServerAckError)
+	return ok && otherErr.Code == err.Code
+}
+
+// Error codes in message acks that mean the account is sending too much and may get banned if it continues.
+var (
+	ErrAckRateOverLimit  error = &ServerAckError{Code: 429}
+	ErrAckReachoutLocked error = &ServerAckError{Code: 463}
 )
 
 // Some errors that Client.Download can return
@@ -79,12 +146,23 @@ var (
 	ErrInvalidMediaSHA256         = errors.New("hash of media plaintext doesn't match")
 	ErrUnknownMediaType           = errors.New("unknown media type")
 	ErrNothingDownloadableFound   = errors.New("didn't find any attachments in message")
+	ErrInvalidDownloadState       = errors.New("invalid download state")
 )
 
+// ErrNoMediaHosts is returned when uploading or downloading media if there are no media hosts to use,
+// e.g. because Client.MediaHosts excludes all of them.
+var ErrNoMediaHosts = errors.New("no media hosts available")
+
+// ErrDownloadManagerClosed is returned for downloads that are still queued when a DownloadManager is closed.
+var ErrDownloadManagerClosed = errors.New("download manager closed")
+
 var (
 	ErrOriginalMessageSecretNotFound = errors.New("original message secret key not found")
 	ErrNotEncryptedReactionMessage   = errors.New("given message isn't an encrypted reaction message")
 	ErrNotPollUpdateMessage          = errors.New("given message isn't a poll update message")
+	ErrPollNotFound                  = errors.New("poll not found in store")
+	ErrInvalidPollOptions            = errors.New("polls must have between 2 and 12 unique options")
+	ErrInvalidSelectableOptionCount  = errors.New("selectable option count must be between 0 and the number of options")
 )
 
 type wrappedIQError struct {
@@ -124,6 +202,7 @@ var (
 	ErrIQNotFound      error = &IQError{Code: 404, Text: "item-not-found"}
 	ErrIQNotAcceptable error = &IQError{Code: 406, Text: "not-acceptable"}
 	ErrIQGone          error = &IQError{Code: 410, Text: "gone"}
+	ErrIQRateOverLimit error = &IQError{Code: 429, Text: "rate-overlimit"}
 )
 
 func parseIQError(node *waBinary.Node) error {
@@ -194,3 +273,52 @@ func (err *DisconnectedError) Is(other error) bool {
 	}
 	return otherDisc.Action == err.Action
 }
+
+// ServerDisconnectError is given to the ReconnectPolicy when the server closed the connection
+// after sending a <failure> or <stream:error> node.
+type ServerDisconnectError struct {
+	Code int
+	Raw  *waBinary.Node
+}
+
+func (err *ServerDisconnectError) Error() string {
+	if err.Raw != nil {
+		return fmt.Sprintf("server sent %s with code %d", err.Raw.Tag, err.Code)
+	}
+	return fmt.Sprintf("server closed connection with code %d", err.Code)
+}
+
+// Some errors that Client.UploadSticker and ConvertSticker can return
+var (
+	ErrUnsupportedStickerFormat = errors.New("unsupported sticker input format, expected PNG, JPEG or GIF")
+	ErrStickerTooLarge          = errors.New("sticker is too large even after reducing quality")
+)
+
+// ErrThumbnailUnsupported is returned by Thumbnailer implementations if they can't make a thumbnail for the given media.
+var ErrThumbnailUnsupported = errors.New("thumbnails aren't supported for this media")
+
+// ErrAudioEncoderRequired is returned by Client.UploadVoiceNote if the input isn't Ogg Opus and no encoder was given.
+var ErrAudioEncoderRequired = errors.New("input isn't Ogg Opus and no audio encoder was given")
+
+// ErrNoProductImage is returned by Client.DownloadProductImage if the message doesn't have a product or catalog image.
+var ErrNoProductImage = errors.New("product message doesn't have an image")
+
+// ErrNoAppStateKeys is returned by Client.SendAppState if the store doesn't have any app state keys to encrypt the patch with.
+var ErrNoAppStateKeys = errors.New("no app state keys found")
+
+// ErrAppStateUpdate is returned by Client.SendAppState if the server rejects the patch.
+var ErrAppStateUpdate = errors.New("server returned error updating app state")
+
+// ErrUploadSizeMismatch is returned by Client.UploadStream if the reader contained a different amount of data than the given size.
+var ErrUploadSizeMismatch = errors.New("upload size doesn't match the length of the data")
+
+// Errors returned by ValidateMedia and by Client.Upload if Client.ValidateOutgoingMedia is enabled.
+var (
+	ErrMediaTooLarge          = errors.New("media is too large")
+	ErrUnsupportedMediaFormat = errors.New("unsupported media format")
+	ErrMediaMimetypeMismatch  = errors.New("mime type doesn't match media contents")
+	ErrInvalidMediaData       = errors.New("invalid media data")
+)
+
+// ErrInvalidAlbum is returned by Client.SendAlbum if the album is too small or too large, or contains something other than images and videos.
+var ErrInvalidAlbum = errors.New("albums must contain between 2 and 30 images or videos")
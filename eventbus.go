@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+// Subscription is a handle to an event handler registered with Subscribe.
+type Subscription struct {
+	cli *Client
+	id  uint32
+}
+
+// ID returns the event handler ID of the subscription, which can also be passed to Client.RemoveEventHandler.
+func (sub *Subscription) ID() uint32 {
+	return sub.id
+}
+
+// Unsubscribe removes the event handler. It returns false if the handler had already been removed.
+// Like Client.RemoveEventHandler, this is safe to call from inside the handler itself.
+func (sub *Subscription) Unsubscribe() bool {
+	return sub.cli.RemoveEventHandler(sub.id)
+}
+
+// Subscribe registers a handler that only receives events of the type T. Handlers are called in the same
+// goroutine as all other event handlers, and a panic in one handler doesn't prevent other handlers from being called.
+//
+//	sub := whatsmeow.Subscribe(cli, func(evt *events.Message) {
+//		fmt.Println("Received a message from", evt.Info.Sender)
+//	})
+//	// later
+//	sub.Unsubscribe()
+func Subscribe[T any](cli *Client, handler func(T)) *Subscription {
+	return SubscribeWithPriority(cli, 0, handler)
+}
+
+// SubscribeWithPriority registers a handler for events of the type T like Subscribe, but with the given priority.
+// Handlers with a higher priority are called first. Handlers registered with AddEventHandler have priority 0.
+func SubscribeWithPriority[T any](cli *Client, priority int, handler func(T)) *Subscription {
+	id := cli.AddEventHandlerWithPriority(func(rawEvt interface{}) {
+		if evt, ok := rawEvt.(T); ok {
+			handler(evt)
+		}
+	}, priority)
+	return &Subscription{cli: cli, id: id}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestSubscribe(t *testing.T) {
+	cli := NewClient(&store.Device{}, nil)
+	var calls []string
+	cli.AddEventHandler(func(evt interface{}) {
+		calls = append(calls, "any")
+	})
+	var sub *Subscription
+	sub = SubscribeWithPriority(cli, 10, func(evt *events.Message) {
+		calls = append(calls, "message")
+		sub.Unsubscribe()
+	})
+	Subscribe(cli, func(evt *events.Receipt) {
+		panic("receipt handler failed")
+	})
+	SubscribeWithPriority(cli, -1, func(evt *events.Receipt) {
+		calls = append(calls, "receipt")
+	})
+
+	cli.dispatchEvent(&events.Message{})
+	cli.dispatchEvent(&events.Message{})
+	cli.dispatchEvent(&events.Receipt{})
+	expected := []string{"message", "any", "any", "any", "receipt"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected handler calls %v, got %v", expected, calls)
+	}
+}
+
+func TestEventMiddleware(t *testing.T) {
+	cli := NewClient(&store.Device{}, nil)
+	var calls []string
+	cli.AddEventHandler(func(evt interface{}) {
+		calls = append(calls, fmt.Sprintf("handler %T", evt))
+	})
+	cli.UseEventMiddleware(
+		func(next EventHandler) EventHandler {
+			return func(evt interface{}) {
+				calls = append(calls, "outer")
+				next(evt)
+			}
+		},
+		FilterMiddleware(func(evt interface{}) bool {
+			_, isReceipt := evt.(*events.Receipt)
+			return !isReceipt
+		}),
+		MetricsMiddleware(func(eventType string, duration time.Duration) {
+			calls = append(calls, "metrics "+eventType)
+		}),
+	)
+	cli.dispatchEvent(&events.Message{})
+	cli.dispatchEvent(&events.Receipt{})
+	expected := []string{"outer", "handler *events.Message", "metrics *events.Message", "outer"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestPerChatOrdering(t *testing.T) {
+	cli := NewClient(&store.Device{}, nil)
+	chatA := types.NewJID("1", types.DefaultUserServer)
+	chatB := types.NewJID("2", types.DefaultUserServer)
+	received := make(map[types.JID][]types.MessageID)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	Subscribe(cli, func(evt *events.Message) {
+		if evt.Info.Chat == chatA && evt.Info.ID == "A1" {
+			// Block chat A, chat B should still proceed
+			<-release
+		}
+		lock.Lock()
+		received[evt.Info.Chat] = append(received[evt.Info.Chat], evt.Info.ID)
+		lock.Unlock()
+		wg.Done()
+	})
+	cli.UseEventMiddleware(PerChatOrderingMiddleware())
+	send := func(chat types.JID, id types.MessageID) {
+		wg.Add(1)
+		cli.dispatchEvent(&events.Message{Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}, ID: id}})
+	}
+	send(chatA, "A1")
+	send(chatA, "A2")
+	send(chatB, "B1")
+	send(chatB, "B2")
+	for {
+		lock.Lock()
+		doneB := len(received[chatB]) == 2
+		lock.Unlock()
+		if doneB {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if !reflect.DeepEqual(received[chatA], []types.MessageID{"A1", "A2"}) || !reflect.DeepEqual(received[chatB], []types.MessageID{"B1", "B2"}) {
+		t.Errorf("Unexpected event order %v", received)
+	}
+}
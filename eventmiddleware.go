@@ -0,0 +1,105 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"fmt"
+	"time"
+
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// EventMiddleware wraps the dispatching of events to event handlers. The middleware receives the next step
+// in the chain and returns a function that is called for each event instead of it. It can do things before and
+// after calling next, or not call it at all to drop the event.
+type EventMiddleware func(next EventHandler) EventHandler
+
+// UseEventMiddleware adds middleware around the event dispatcher. Middleware added first is the outermost,
+// i.e. it sees events first and finishes last. The middleware is called once per event, not once per handler.
+//
+//	cli.UseEventMiddleware(
+//		whatsmeow.LoggingMiddleware(log.Sub("Events")),
+//		whatsmeow.FilterMiddleware(func(evt interface{}) bool {
+//			msg, ok := evt.(*events.Message)
+//			return !ok || !msg.Info.IsFromMe
+//		}),
+//	)
+func (cli *Client) UseEventMiddleware(middleware ...EventMiddleware) {
+	cli.eventHandlersLock.Lock()
+	defer cli.eventHandlersLock.Unlock()
+	cli.eventMiddlewares = append(cli.eventMiddlewares, middleware...)
+	var dispatch EventHandler = cli.dispatchToHandlers
+	for i := len(cli.eventMiddlewares) - 1; i >= 0; i-- {
+		dispatch = cli.eventMiddlewares[i](dispatch)
+	}
+	cli.eventMiddleware = dispatch
+}
+
+// RemoveEventMiddleware removes all middleware added with UseEventMiddleware.
+func (cli *Client) RemoveEventMiddleware() {
+	cli.eventHandlersLock.Lock()
+	cli.eventMiddlewares = nil
+	cli.eventMiddleware = nil
+	cli.eventHandlersLock.Unlock()
+}
+
+// LoggingMiddleware returns middleware that logs the type of every event and how long handling it took.
+func LoggingMiddleware(log waLog.Logger) EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		return func(evt interface{}) {
+			start := time.Now()
+			next(evt)
+			log.Debugf("Handled %T event in %s", evt, time.Since(start))
+		}
+	}
+}
+
+// FilterMiddleware returns middleware that only passes events to the rest of the chain if the filter function
+// returns true for them.
+func FilterMiddleware(filter func(evt interface{}) bool) EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		return func(evt interface{}) {
+			if filter(evt) {
+				next(evt)
+			}
+		}
+	}
+}
+
+// RecoveryMiddleware returns middleware that recovers panics in the rest of the middleware chain and calls
+// the given function with the event and the recovered value.
+//
+// Panics in event handlers themselves are always recovered separately for each handler, so that one broken
+// handler doesn't prevent others from receiving the event. This middleware is meant for the middleware that
+// comes after it, like filters calling user code.
+func RecoveryMiddleware(onPanic func(evt interface{}, err interface{})) EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		return func(evt interface{}) {
+			defer func() {
+				if err := recover(); err != nil {
+					onPanic(evt, err)
+				}
+			}()
+			next(evt)
+		}
+	}
+}
+
+// EventMetricsHook is called by MetricsMiddleware after every event with the type of the event, e.g. "*events.Message",
+// and how long the rest of the chain took to handle it.
+type EventMetricsHook func(eventType string, duration time.Duration)
+
+// MetricsMiddleware returns middleware that measures how long events take to handle.
+func MetricsMiddleware(hook EventMetricsHook) EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		return func(evt interface{}) {
+			start := time.Now()
+			next(evt)
+			hook(fmt.Sprintf("%T", evt), time.Since(start))
+		}
+	}
+}
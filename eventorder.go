@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"sync"
+
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// EventChat returns the chat that an event belongs to, or false if the event isn't specific to a chat.
+func EventChat(evt interface{}) (types.JID, bool) {
+	var chat types.JID
+	switch typedEvt := evt.(type) {
+	case *events.Message:
+		chat = typedEvt.Info.Chat
+	case *events.Album:
+		chat = typedEvt.Chat
+	case *events.UndecryptableMessage:
+		chat = typedEvt.Info.Chat
+	case *events.MessageEdit:
+		chat = typedEvt.Info.Chat
+	case *events.ReactionUpdate:
+		chat = typedEvt.Info.Chat
+	case *events.PollUpdate:
+		chat = typedEvt.Info.Chat
+	case *events.LiveLocationUpdate:
+		chat = typedEvt.Info.Chat
+	case *events.Receipt:
+		chat = typedEvt.Chat
+	case *events.ChatPresence:
+		chat = typedEvt.Chat
+	case *events.GroupInfo:
+		chat = typedEvt.JID
+	case *events.GroupJoinRequest:
+		chat = typedEvt.JID
+	case *events.CommunityLink:
+		chat = typedEvt.Community
+	case *events.Pin:
+		chat = typedEvt.JID
+	case *events.Star:
+		chat = typedEvt.ChatJID
+	case *events.DeleteForMe:
+		chat = typedEvt.ChatJID
+	case *events.Mute:
+		chat = typedEvt.JID
+	case *events.Archive:
+		chat = typedEvt.JID
+	case *events.MarkChatAsRead:
+		chat = typedEvt.JID
+	case *events.DeleteChat:
+		chat = typedEvt.JID
+	default:
+		return types.EmptyJID, false
+	}
+	return chat.ToNonAD(), !chat.IsEmpty()
+}
+
+type perChatDispatcher struct {
+	next   EventHandler
+	queues map[types.JID][]interface{}
+	lock   sync.Mutex
+}
+
+// PerChatOrderingMiddleware returns middleware that dispatches events of different chats in parallel,
+// while keeping the events of each chat in order. Events that don't belong to a chat (see EventChat)
+// are passed to the rest of the chain directly in the normal event goroutine.
+//
+// The event handlers and the middleware after this one will be called from multiple goroutines,
+// so they must be safe for concurrent use across chats. Events of a single chat are never handled concurrently.
+//
+//	cli.UseEventMiddleware(whatsmeow.PerChatOrderingMiddleware())
+func PerChatOrderingMiddleware() EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		dispatcher := &perChatDispatcher{
+			next:   next,
+			queues: make(map[types.JID][]interface{}),
+		}
+		return dispatcher.dispatch
+	}
+}
+
+func (pcd *perChatDispatcher) dispatch(evt interface{}) {
+	chat, ok := EventChat(evt)
+	if !ok {
+		pcd.next(evt)
+		return
+	}
+	pcd.lock.Lock()
+	queue, running := pcd.queues[chat]
+	pcd.queues[chat] = append(queue, evt)
+	pcd.lock.Unlock()
+	if !running {
+		go pcd.run(chat)
+	}
+}
+
+// run handles the events in the queue of a single chat until the queue is empty.
+func (pcd *perChatDispatcher) run(chat types.JID) {
+	for {
+		pcd.lock.Lock()
+		queue := pcd.queues[chat]
+		if len(queue) == 0 {
+			delete(pcd.queues, chat)
+			pcd.lock.Unlock()
+			return
+		}
+		evt := queue[0]
+		queue[0] = nil
+		pcd.queues[chat] = queue[1:]
+		pcd.lock.Unlock()
+		pcd.next(evt)
+	}
+}
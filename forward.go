@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// ForwardReuploadAge is the age of a media message's key after which ForwardMessage re-uploads the media
+// instead of reusing the original upload, as old uploads may have already been removed from the media servers.
+var ForwardReuploadAge = 7 * 24 * time.Hour
+
+// ForwardMessage forwards a received message to another chat.
+//
+// The message is copied with the forwarded flag set and the forwarding score incremented, while everything in the
+// context info that only makes sense in the original chat (replies, mentions, disappearing timer, etc.) is removed.
+// Media is re-uploaded if the original upload is older than ForwardReuploadAge or doesn't have a direct path.
+//
+// View-once messages and special messages like reactions, poll votes and protocol messages can't be forwarded.
+//
+//	resp, err := cli.ForwardMessage(context.Background(), targetChat, evt)
+func (cli *Client) ForwardMessage(ctx context.Context, to types.JID, original *events.Message) (SendResponse, error) {
+	msg, err := cli.BuildForward(ctx, original)
+	if err != nil {
+		return SendResponse{}, err
+	}
+	return cli.SendMessage(ctx, to, "", msg)
+}
+
+// BuildForward builds the message that ForwardMessage sends. The built message can be sent normally using Client.SendMessage.
+func (cli *Client) BuildForward(ctx context.Context, original *events.Message) (*waProto.Message, error) {
+	if original.IsViewOnce {
+		return nil, fmt.Errorf("%w: view-once messages can't be forwarded", ErrCantForwardMessage)
+	}
+	msg := proto.Clone(original.Message).(*waProto.Message)
+	if msg.Conversation != nil {
+		msg.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: msg.Conversation}
+		msg.Conversation = nil
+	}
+	// Message secrets are specific to the original message and may only be reused for the same message ID
+	msg.MessageContextInfo = nil
+	holder, field := findContextInfoHolder(msg.ProtoReflect())
+	if holder == nil {
+		return nil, fmt.Errorf("%w: unsupported message type %s", ErrCantForwardMessage, getTypeFromMessage(msg))
+	}
+	var score uint32
+	if holder.Has(field) {
+		score = holder.Get(field).Message().Interface().(*waProto.ContextInfo).GetForwardingScore()
+	}
+	newContextInfo := &waProto.ContextInfo{
+		IsForwarded:     proto.Bool(true),
+		ForwardingScore: proto.Uint32(score + 1),
+	}
+	holder.Set(field, protoreflect.ValueOfMessage(newContextInfo.ProtoReflect()))
+	err := cli.reuploadForwardedMedia(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (cli *Client) reuploadForwardedMedia(ctx context.Context, msg *waProto.Message) error {
+	var media DownloadableMessage
+	var mediaKeyTimestamp int64
+	switch {
+	case msg.ImageMessage != nil:
+		media, mediaKeyTimestamp = msg.ImageMessage, msg.ImageMessage.GetMediaKeyTimestamp()
+	case msg.VideoMessage != nil:
+		media, mediaKeyTimestamp = msg.VideoMessage, msg.VideoMessage.GetMediaKeyTimestamp()
+	case msg.AudioMessage != nil:
+		media, mediaKeyTimestamp = msg.AudioMessage, msg.AudioMessage.GetMediaKeyTimestamp()
+	case msg.DocumentMessage != nil:
+		media, mediaKeyTimestamp = msg.DocumentMessage, msg.DocumentMessage.GetMediaKeyTimestamp()
+	case msg.StickerMessage != nil:
+		media, mediaKeyTimestamp = msg.StickerMessage, msg.StickerMessage.GetMediaKeyTimestamp()
+	default:
+		return nil
+	}
+	if len(media.GetDirectPath()) > 0 && time.Since(time.Unix(mediaKeyTimestamp, 0)) < ForwardReuploadAge {
+		return nil
+	}
+	data, err := cli.Download(media)
+	if err != nil {
+		return fmt.Errorf("failed to download media to re-upload: %w", err)
+	}
+	uploaded, err := cli.upload(ctx, data, GetMediaType(media), nil)
+	if err != nil {
+		return fmt.Errorf("failed to re-upload media: %w", err)
+	}
+	mediaMsg := media.ProtoReflect()
+	fields := mediaMsg.Descriptor().Fields()
+	mediaMsg.Set(fields.ByName("url"), protoreflect.ValueOfString(uploaded.URL))
+	mediaMsg.Set(fields.ByName("directPath"), protoreflect.ValueOfString(uploaded.DirectPath))
+	mediaMsg.Set(fields.ByName("mediaKey"), protoreflect.ValueOfBytes(uploaded.MediaKey))
+	mediaMsg.Set(fields.ByName("fileEncSha256"), protoreflect.ValueOfBytes(uploaded.FileEncSHA256))
+	mediaMsg.Set(fields.ByName("fileSha256"), protoreflect.ValueOfBytes(uploaded.FileSHA256))
+	mediaMsg.Set(fields.ByName("fileLength"), protoreflect.ValueOfUint64(uploaded.FileLength))
+	mediaMsg.Set(fields.ByName("mediaKeyTimestamp"), protoreflect.ValueOfInt64(time.Now().Unix()))
+	return nil
+}
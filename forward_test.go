@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestBuildForward(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	ctx := context.Background()
+
+	text := &events.Message{Message: &waProto.Message{
+		Conversation:       proto.String("hello"),
+		MessageContextInfo: &waProto.MessageContextInfo{MessageSecret: []byte("secret")},
+	}}
+	msg, err := cli.BuildForward(ctx, text)
+	if err != nil {
+		t.Fatalf("Failed to build forward of text message: %v", err)
+	} else if msg.GetExtendedTextMessage().GetText() != "hello" || msg.Conversation != nil {
+		t.Errorf("Expected text to be moved to an extended text message, got %v", msg)
+	} else if ctxInfo := msg.GetExtendedTextMessage().GetContextInfo(); !ctxInfo.GetIsForwarded() || ctxInfo.GetForwardingScore() != 1 {
+		t.Errorf("Expected forwarded flag and score 1, got %v", ctxInfo)
+	} else if msg.MessageContextInfo != nil {
+		t.Error("Expected message secret to be removed")
+	}
+	if text.Message.Conversation == nil {
+		t.Error("The original message was modified")
+	}
+
+	image := &events.Message{Message: &waProto.Message{ImageMessage: &waProto.ImageMessage{
+		Url:               proto.String("https://mmg.whatsapp.net/original"),
+		DirectPath:        proto.String("/original"),
+		MediaKeyTimestamp: proto.Int64(time.Now().Add(-time.Hour).Unix()),
+		ContextInfo: &waProto.ContextInfo{
+			ForwardingScore: proto.Uint32(3),
+			IsForwarded:     proto.Bool(true),
+			StanzaId:        proto.String("quoted"),
+			MentionedJid:    []string{"2222@s.whatsapp.net"},
+			Expiration:      proto.Uint32(86400),
+		},
+	}}}
+	msg, err = cli.BuildForward(ctx, image)
+	if err != nil {
+		t.Fatalf("Failed to build forward of recent image: %v", err)
+	}
+	expectedContext := &waProto.ContextInfo{IsForwarded: proto.Bool(true), ForwardingScore: proto.Uint32(4)}
+	if ctxInfo := msg.GetImageMessage().GetContextInfo(); !proto.Equal(ctxInfo, expectedContext) {
+		t.Errorf("Expected only the forwarding info to be kept in the context, got %v", ctxInfo)
+	} else if msg.GetImageMessage().GetUrl() != "https://mmg.whatsapp.net/original" {
+		t.Error("Recent upload shouldn't be re-uploaded")
+	}
+}
+
+func TestBuildForward_Unsupported(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	tests := map[string]*events.Message{
+		"view once": {
+			Message:    &waProto.Message{ImageMessage: &waProto.ImageMessage{ViewOnce: proto.Bool(true)}},
+			IsViewOnce: true,
+		},
+		"reaction": {Message: &waProto.Message{ReactionMessage: &waProto.ReactionMessage{Text: proto.String("👍")}}},
+		"protocol": {Message: &waProto.Message{ProtocolMessage: &waProto.ProtocolMessage{Type: waProto.ProtocolMessage_REVOKE.Enum()}}},
+	}
+	for name, msg := range tests {
+		if _, err := cli.BuildForward(context.Background(), msg); !errors.Is(err, ErrCantForwardMessage) {
+			t.Errorf("%s: expected ErrCantForwardMessage, got %v", name, err)
+		}
+	}
+}
@@ -9,4 +9,7 @@ require (
 	google.golang.org/protobuf v1.28.1
 )
 
-require filippo.io/edwards25519 v1.0.0 // indirect
+require (
+	filippo.io/edwards25519 v1.0.0 // indirect
+	github.com/google/go-cmp v0.5.8 // indirect
+)
@@ -10,11 +10,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	waBinary "github.com/insomnius/whatsmeow/binary"
 	"github.com/insomnius/whatsmeow/types"
 	"github.com/insomnius/whatsmeow/types/events"
+	"github.com/insomnius/whatsmeow/util/imageutil"
 )
 
 const InviteLinkPrefix = "https://chat.whatsapp.com/"
@@ -47,9 +50,52 @@ type ReqCreateGroup struct {
 
 // CreateGroup creates a group on WhatsApp with the given name and participants.
 //
-// See ReqCreateGroup for parameters.
+// See ReqCreateGroup for parameters. To set other settings like the description when creating the group,
+// use CreateGroupWithConfig.
 func (cli *Client) CreateGroup(req ReqCreateGroup) (*types.GroupInfo, error) {
-	participantNodes := make([]waBinary.Node, len(req.Participants), len(req.Participants)+1)
+	return cli.CreateGroupWithConfig(context.TODO(), GroupConfig{ReqCreateGroup: req})
+}
+
+// GroupConfig contains the request data for CreateGroupWithConfig.
+type GroupConfig struct {
+	// The name, participants and community settings of the group.
+	ReqCreateGroup
+
+	// The initial description (topic) of the group.
+	Description string
+	// The disappearing message timer, one of the DisappearingTimer<Duration> constants. Zero means disappearing messages are off.
+	DisappearingTimer time.Duration
+	// If true, only admins can send messages, see SetGroupAnnounce.
+	Announce bool
+	// If true, only admins can edit the group info, see SetGroupLocked.
+	Locked bool
+	// If true, admins have to approve new members who join with an invite link.
+	MembershipApproval bool
+}
+
+// CreateGroupWithConfig creates a group with the given settings. The settings are sent as a part of the create
+// request instead of separate SetGroupTopic, SetDisappearingTimer etc calls after CreateGroup. Check the returned
+// info to see which settings the server actually applied.
+//
+// The disappearing timer must be one of the DisappearingTimer<Duration> constants, other values return
+// ErrInvalidDisappearingTimer without sending anything to the server.
+//
+//	info, err := cli.CreateGroupWithConfig(ctx, whatsmeow.GroupConfig{
+//		ReqCreateGroup: whatsmeow.ReqCreateGroup{
+//			Name:         "Announcements",
+//			Participants: participants,
+//		},
+//		Description:       "Only admins can post here",
+//		DisappearingTimer: 7 * 24 * time.Hour,
+//		Announce:          true,
+//		Locked:            true,
+//	})
+func (cli *Client) CreateGroupWithConfig(ctx context.Context, config GroupConfig) (*types.GroupInfo, error) {
+	if !isValidDisappearingTimer(config.DisappearingTimer) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDisappearingTimer, config.DisappearingTimer)
+	}
+	req := config.ReqCreateGroup
+	participantNodes := make([]waBinary.Node, len(req.Participants), len(req.Participants)+6)
 	for i, participant := range req.Participants {
 		participantNodes[i] = waBinary.Node{
 			Tag:   "participant",
@@ -75,9 +121,34 @@ func (cli *Client) CreateGroup(req ReqCreateGroup) (*types.GroupInfo, error) {
 			Attrs: waBinary.Attrs{"jid": req.LinkedParentJID},
 		})
 	}
+	if len(config.Description) > 0 {
+		participantNodes = append(participantNodes, waBinary.Node{
+			Tag:     "description",
+			Attrs:   waBinary.Attrs{"id": GenerateMessageID()},
+			Content: []waBinary.Node{{Tag: "body", Content: []byte(config.Description)}},
+		})
+	}
+	if config.DisappearingTimer > 0 {
+		participantNodes = append(participantNodes, waBinary.Node{
+			Tag:   "ephemeral",
+			Attrs: waBinary.Attrs{"expiration": strconv.Itoa(int(config.DisappearingTimer.Seconds()))},
+		})
+	}
+	if config.Announce {
+		participantNodes = append(participantNodes, waBinary.Node{Tag: "announcement"})
+	}
+	if config.Locked {
+		participantNodes = append(participantNodes, waBinary.Node{Tag: "locked"})
+	}
+	if config.MembershipApproval {
+		participantNodes = append(participantNodes, waBinary.Node{
+			Tag:     "membership_approval_mode",
+			Content: []waBinary.Node{{Tag: "group_join", Attrs: waBinary.Attrs{"state": "on"}}},
+		})
+	}
 	// WhatsApp web doesn't seem to include the static prefix for these
 	key := strings.TrimPrefix(req.CreateKey, "3EB0")
-	resp, err := cli.sendGroupIQ(context.TODO(), iqSet, types.GroupServerJID, waBinary.Node{
+	resp, err := cli.sendGroupIQ(ctx, iqSet, types.GroupServerJID, waBinary.Node{
 		Tag: "create",
 		Attrs: waBinary.Attrs{
 			"subject": req.Name,
@@ -92,7 +163,11 @@ func (cli *Client) CreateGroup(req ReqCreateGroup) (*types.GroupInfo, error) {
 	if !ok {
 		return nil, &ElementMissingError{Tag: "group", In: "response to create group query"}
 	}
-	return cli.parseGroupNode(&groupNode)
+	info, err := cli.parseGroupNode(&groupNode)
+	if err == nil {
+		cli.cacheGroupInfo(info)
+	}
+	return info, err
 }
 
 // UnlinkGroup removes a child group from a parent community.
@@ -110,7 +185,7 @@ func (cli *Client) UnlinkGroup(parent, child types.JID) error {
 
 // LinkGroup adds an existing group as a child group in a community.
 //
-// To create a new group within a community, set LinkedParentJID in the CreateGroup request.
+// To create a new group within a community, use CreateSubGroup.
 func (cli *Client) LinkGroup(parent, child types.JID) error {
 	_, err := cli.sendGroupIQ(context.TODO(), iqSet, parent, waBinary.Node{
 		Tag: "links",
@@ -148,6 +223,8 @@ const (
 )
 
 // UpdateGroupParticipants can be used to add, remove, promote and demote members in a WhatsApp group.
+//
+// To change many participants at once and get the outcome for each of them, use UpdateGroupParticipantsBulk.
 func (cli *Client) UpdateGroupParticipants(jid types.JID, participantChanges map[types.JID]ParticipantChange) (*waBinary.Node, error) {
 	content := make([]waBinary.Node, len(participantChanges))
 	i := 0
@@ -174,12 +251,25 @@ func (cli *Client) UpdateGroupParticipants(jid types.JID, participantChanges map
 	return resp, nil
 }
 
+// GroupPhotoSize is the maximum width and height of group photos set with SetGroupPhoto.
+const GroupPhotoSize = 640
+
 // SetGroupPhoto updates the group picture/icon of the given group on WhatsApp.
-// The avatar should be a JPEG photo, other formats may be rejected with ErrInvalidImageFormat.
-// The bytes can be nil to remove the photo. Returns the new picture ID.
+//
+// The avatar can be a JPEG, PNG or GIF image of any size. It's cropped to a square from the center and scaled down
+// to GroupPhotoSize, as the server only accepts square JPEGs. Square JPEGs that are at most GroupPhotoSize are sent
+// as-is without re-encoding. Images that can't be decoded return ErrInvalidImageFormat.
+// The bytes can be nil to remove the photo, see RemoveGroupPhoto. Returns the new picture ID.
+//
+// Other group members get an events.Picture with the group JID when the photo is changed.
 func (cli *Client) SetGroupPhoto(jid types.JID, avatar []byte) (string, error) {
 	var content interface{}
 	if avatar != nil {
+		var err error
+		avatar, _, err = imageutil.MakeSquareImage(avatar, GroupPhotoSize, 90)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidImageFormat, err)
+		}
 		content = []waBinary.Node{{
 			Tag:     "picture",
 			Attrs:   waBinary.Attrs{"type": "image"},
@@ -208,6 +298,29 @@ func (cli *Client) SetGroupPhoto(jid types.JID, avatar []byte) (string, error) {
 	return pictureID, nil
 }
 
+// RemoveGroupPhoto removes the group picture/icon of the given group.
+func (cli *Client) RemoveGroupPhoto(jid types.JID) error {
+	_, err := cli.SetGroupPhoto(jid, nil)
+	return err
+}
+
+// GetGroupPhoto gets the URL of the group picture/icon of the given group, either in full resolution or as a small
+// preview. If the group doesn't have a photo, the error wraps ErrProfilePictureNotSet.
+//
+// Communities are detected from the cached group info when Client.CacheGroupInfo is enabled, otherwise use
+// GetProfilePictureInfo with IsCommunity for them.
+//
+//	info, err := cli.GetGroupPhoto(group, true)
+//	// handle error
+//	fmt.Println("Group photo preview is at", info.URL)
+func (cli *Client) GetGroupPhoto(jid types.JID, preview bool) (*types.ProfilePictureInfo, error) {
+	params := &GetProfilePictureParams{Preview: preview}
+	if cached, ok := cli.CachedGroup(jid); ok {
+		params.IsCommunity = cached.IsParent
+	}
+	return cli.GetProfilePictureInfo(jid, params)
+}
+
 // SetGroupName updates the name (subject) of the given group on WhatsApp.
 func (cli *Client) SetGroupName(jid types.JID, name string) error {
 	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
@@ -300,6 +413,31 @@ func (cli *Client) GetGroupInviteLink(jid types.JID, reset bool) (string, error)
 	return InviteLinkPrefix + code, nil
 }
 
+// RevokeGroupInviteLink revokes the current invite link of the group and returns the new link.
+// Only admins can revoke the link.
+func (cli *Client) RevokeGroupInviteLink(jid types.JID) (string, error) {
+	return cli.GetGroupInviteLink(jid, true)
+}
+
+// ParseGroupInviteLink extracts the invite code from a group invite link. It accepts full links, links without
+// the https:// prefix and plain codes, and returns ErrInviteLinkInvalid if the input doesn't look like any of them.
+//
+//	code, err := whatsmeow.ParseGroupInviteLink("https://chat.whatsapp.com/AbCdEfGhIjK1234567890")
+func ParseGroupInviteLink(link string) (string, error) {
+	code := strings.TrimSpace(link)
+	code = strings.TrimPrefix(code, "https://")
+	code = strings.TrimPrefix(code, "http://")
+	code = strings.TrimPrefix(code, strings.TrimPrefix(InviteLinkPrefix, "https://"))
+	if idx := strings.IndexAny(code, "?#"); idx >= 0 {
+		code = code[:idx]
+	}
+	code = strings.TrimSuffix(code, "/")
+	if len(code) == 0 || strings.ContainsAny(code, "/. ") {
+		return "", fmt.Errorf("%w: %q", ErrInviteLinkInvalid, link)
+	}
+	return code, nil
+}
+
 // GetGroupInfoFromInvite gets the group info from an invite message.
 //
 // Note that this is specifically for invite messages, not invite links. Use GetGroupInfoFromLink for resolving chat.whatsapp.com links.
@@ -341,9 +479,13 @@ func (cli *Client) JoinGroupWithInvite(jid, inviter types.JID, code string, expi
 }
 
 // GetGroupInfoFromLink resolves the given invite link and asks the WhatsApp servers for info about the group.
-// This will not cause the user to join the group.
+// This will not cause the user to join the group, so it can be used to show a preview before joining: the name,
+// topic, ParticipantCount and IsJoinApprovalRequired fields are set, but the participant list usually isn't.
 func (cli *Client) GetGroupInfoFromLink(code string) (*types.GroupInfo, error) {
-	code = strings.TrimPrefix(code, InviteLinkPrefix)
+	code, err := ParseGroupInviteLink(code)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := cli.sendGroupIQ(context.TODO(), iqGet, types.GroupServerJID, waBinary.Node{
 		Tag:   "invite",
 		Attrs: waBinary.Attrs{"code": code},
@@ -363,8 +505,21 @@ func (cli *Client) GetGroupInfoFromLink(code string) (*types.GroupInfo, error) {
 }
 
 // JoinGroupWithLink joins the group using the given invite link.
+//
+// If the group requires admin approval for new members, a join request is sent instead, and the group JID is
+// returned along with ErrGroupJoinApprovalRequired. The user becomes a member once an admin approves the request.
+//
+//	preview, err := cli.GetGroupInfoFromLink(link)
+//	// handle error, show preview.Name and preview.ParticipantCount to the user
+//	jid, err := cli.JoinGroupWithLink(link)
+//	if errors.Is(err, whatsmeow.ErrGroupJoinApprovalRequired) {
+//		// wait for an admin to approve the request
+//	}
 func (cli *Client) JoinGroupWithLink(code string) (types.JID, error) {
-	code = strings.TrimPrefix(code, InviteLinkPrefix)
+	code, err := ParseGroupInviteLink(code)
+	if err != nil {
+		return types.EmptyJID, err
+	}
 	resp, err := cli.sendGroupIQ(context.TODO(), iqSet, types.GroupServerJID, waBinary.Node{
 		Tag:   "invite",
 		Attrs: waBinary.Attrs{"code": code},
@@ -376,6 +531,9 @@ func (cli *Client) JoinGroupWithLink(code string) (types.JID, error) {
 	} else if err != nil {
 		return types.EmptyJID, err
 	}
+	if approvalNode, ok := resp.GetOptionalChildByTag("membership_approval_request"); ok {
+		return approvalNode.AttrGetter().JID("jid"), ErrGroupJoinApprovalRequired
+	}
 	groupNode, ok := resp.GetOptionalChildByTag("group")
 	if !ok {
 		return types.EmptyJID, &ElementMissingError{Tag: "group", In: "response to group link join query"}
@@ -452,6 +610,8 @@ func (cli *Client) GetLinkedGroupsParticipants(community types.JID) ([]types.JID
 }
 
 // GetGroupInfo requests basic info about a group chat from the WhatsApp servers.
+//
+// This always queries the server. Use Client.Group to get the cached info if Client.CacheGroupInfo is enabled.
 func (cli *Client) GetGroupInfo(jid types.JID) (*types.GroupInfo, error) {
 	return cli.getGroupInfo(context.TODO(), jid, true)
 }
@@ -486,6 +646,7 @@ func (cli *Client) getGroupInfo(ctx context.Context, jid types.JID, lockParticip
 		participants[i] = part.JID
 	}
 	cli.groupParticipantsCache[jid] = participants
+	cli.cacheGroupInfo(groupInfo)
 	return groupInfo, nil
 }
 
@@ -516,6 +677,7 @@ func (cli *Client) parseGroupNode(groupNode *waBinary.Node) (*types.GroupInfo, e
 
 	group.AnnounceVersionID = ag.OptionalString("a_v_id")
 	group.ParticipantVersionID = ag.OptionalString("p_v_id")
+	group.ParticipantCount = ag.OptionalInt("size")
 
 	for _, child := range groupNode.GetChildren() {
 		childAG := child.AttrGetter()
@@ -555,6 +717,9 @@ func (cli *Client) parseGroupNode(groupNode *waBinary.Node) (*types.GroupInfo, e
 		case "ephemeral":
 			group.IsEphemeral = true
 			group.DisappearingTimer = uint32(childAG.Uint64("expiration"))
+		case "membership_approval_mode":
+			joinNode, ok := child.GetOptionalChildByTag("group_join")
+			group.IsJoinApprovalRequired = ok && joinNode.AttrGetter().OptionalString("state") == "on"
 		case "member_add_mode":
 			modeBytes, _ := child.Content.([]byte)
 			group.MemberAddMode = types.GroupMemberAddMode(modeBytes)
@@ -573,6 +738,12 @@ func (cli *Client) parseGroupNode(groupNode *waBinary.Node) (*types.GroupInfo, e
 		}
 	}
 
+	if group.ParticipantCount == 0 {
+		group.ParticipantCount = len(group.Participants)
+	}
+	if ag.OK() {
+		cli.cacheDisappearingTimer(group.JID, time.Duration(group.DisappearingTimer)*time.Second)
+	}
 	return &group, ag.Error()
 }
 
@@ -607,6 +778,67 @@ func parseParticipantList(node *waBinary.Node) (participants []types.JID) {
 	return
 }
 
+// fillParticipantChanges fills the detailed participant changes and push names in a group change event.
+func (cli *Client) fillParticipantChanges(evt *events.GroupInfo) {
+	if len(evt.Join) == 0 && len(evt.Leave) == 0 && len(evt.Promote) == 0 && len(evt.Demote) == 0 {
+		return
+	}
+	if evt.Sender != nil {
+		evt.SenderPushName = cli.getPushName(*evt.Sender)
+	}
+	isSender := func(jid types.JID) bool {
+		return evt.Sender == nil || evt.Sender.ToNonAD() == jid.ToNonAD()
+	}
+	addChanges := func(jids []types.JID, changeType events.GroupParticipantChangeType, reason func(types.JID) events.GroupParticipantChangeReason) {
+		for _, jid := range jids {
+			evt.ParticipantChanges = append(evt.ParticipantChanges, events.GroupParticipantChange{
+				JID:      jid,
+				Type:     changeType,
+				PushName: cli.getPushName(jid),
+				Reason:   reason(jid),
+			})
+		}
+	}
+	addChanges(evt.Join, events.GroupParticipantChangeJoin, func(jid types.JID) events.GroupParticipantChangeReason {
+		switch {
+		case evt.JoinReason == "linked_group_join":
+			return events.GroupParticipantChangeReasonCommunity
+		case evt.JoinReason == "invite" && isSender(jid):
+			return events.GroupParticipantChangeReasonInviteLink
+		case evt.JoinReason == "invite":
+			// Invite link joins done by someone else are admins approving join requests
+			return events.GroupParticipantChangeReasonJoinApproved
+		case isSender(jid):
+			return events.GroupParticipantChangeReasonJoined
+		default:
+			return events.GroupParticipantChangeReasonAdded
+		}
+	})
+	addChanges(evt.Leave, events.GroupParticipantChangeLeave, func(jid types.JID) events.GroupParticipantChangeReason {
+		if isSender(jid) {
+			return events.GroupParticipantChangeReasonLeft
+		}
+		return events.GroupParticipantChangeReasonRemoved
+	})
+	noReason := func(types.JID) events.GroupParticipantChangeReason { return "" }
+	addChanges(evt.Promote, events.GroupParticipantChangePromote, noReason)
+	addChanges(evt.Demote, events.GroupParticipantChangeDemote, noReason)
+}
+
+// getPushName returns the push name of the given user from the contact store, or an empty string if it's not known.
+func (cli *Client) getPushName(jid types.JID) string {
+	jid = jid.ToNonAD()
+	if cli.Store.ID != nil && jid.User == cli.Store.ID.User {
+		return cli.Store.PushName
+	}
+	contact, err := cli.Store.Contacts.GetContact(context.TODO(), jid)
+	if err != nil {
+		cli.Log.Debugf("Failed to get push name of %s: %v", jid, err)
+		return ""
+	}
+	return contact.PushName
+}
+
 func (cli *Client) parseGroupCreate(node *waBinary.Node) (*events.JoinedGroup, error) {
 	groupNode, ok := node.GetOptionalChildByTag("group")
 	if !ok {
@@ -707,6 +939,15 @@ func (cli *Client) parseGroupChange(node *waBinary.Node) (*events.GroupInfo, err
 			}
 		case "not_ephemeral":
 			evt.Ephemeral = &types.GroupEphemeral{IsEphemeral: false}
+		case "membership_approval_mode":
+			joinNode, ok := child.GetOptionalChildByTag("group_join")
+			evt.MembershipApprovalMode = &types.GroupMembershipApprovalMode{
+				IsJoinApprovalRequired: ok && joinNode.AttrGetter().OptionalString("state") == "on",
+			}
+		case "member_add_mode":
+			modeBytes, _ := child.Content.([]byte)
+			mode := types.GroupMemberAddMode(modeBytes)
+			evt.MemberAddMode = &mode
 		case "link":
 			evt.Link = &types.GroupLinkChange{
 				Type: types.GroupLinkChangeType(cag.String("link_type")),
@@ -741,6 +982,10 @@ func (cli *Client) parseGroupChange(node *waBinary.Node) (*events.GroupInfo, err
 			return nil, fmt.Errorf("group change %s element doesn't contain required attributes: %w", child.Tag, cag.Error())
 		}
 	}
+	if evt.Ephemeral != nil {
+		cli.cacheDisappearingTimer(evt.JID, time.Duration(evt.Ephemeral.DisappearingTimer)*time.Second)
+	}
+	cli.fillParticipantChanges(&evt)
 	return &evt, nil
 }
 
@@ -778,13 +1023,21 @@ Outer:
 func (cli *Client) parseGroupNotification(node *waBinary.Node) (interface{}, error) {
 	children := node.GetChildren()
 	if len(children) == 1 && children[0].Tag == "create" {
-		return cli.parseGroupCreate(&children[0])
+		joined, err := cli.parseGroupCreate(&children[0])
+		if err != nil {
+			return nil, err
+		}
+		cli.cacheGroupInfo(&joined.GroupInfo)
+		return joined, nil
+	} else if isGroupJoinRequestNotification(node) {
+		return cli.parseGroupJoinRequestNotification(node)
 	} else {
 		groupChange, err := cli.parseGroupChange(node)
 		if err != nil {
 			return nil, err
 		}
 		cli.updateGroupParticipantCache(groupChange)
+		cli.updateGroupInfoCache(groupChange)
 		return groupChange, nil
 	}
 }
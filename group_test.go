@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestCreateGroupWithConfig_InvalidDisappearingTimer(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	for _, timer := range []time.Duration{time.Hour, -DisappearingTimer24Hours, 30 * 24 * time.Hour} {
+		_, err := cli.CreateGroupWithConfig(context.Background(), GroupConfig{
+			ReqCreateGroup:    ReqCreateGroup{Name: "Test"},
+			DisappearingTimer: timer,
+		})
+		if !errors.Is(err, ErrInvalidDisappearingTimer) {
+			t.Errorf("expected ErrInvalidDisappearingTimer for %s, got %v", timer, err)
+		}
+	}
+	// Valid timers get past the validation and fail because the client isn't connected
+	_, err := cli.CreateGroupWithConfig(context.Background(), GroupConfig{
+		ReqCreateGroup:    ReqCreateGroup{Name: "Test"},
+		DisappearingTimer: DisappearingTimer7Days,
+	})
+	if err == nil || errors.Is(err, ErrInvalidDisappearingTimer) {
+		t.Errorf("expected a connection error for a valid timer, got %v", err)
+	}
+}
+
+func TestParseGroupInviteLink(t *testing.T) {
+	tests := map[string]string{
+		"https://chat.whatsapp.com/AbCdEfGhIjK1234567890":     "AbCdEfGhIjK1234567890",
+		"http://chat.whatsapp.com/AbCdEfGhIjK1234567890/":     "AbCdEfGhIjK1234567890",
+		"chat.whatsapp.com/AbCdEfGhIjK1234567890?utm=foo#bar": "AbCdEfGhIjK1234567890",
+		"  AbCdEfGhIjK1234567890\n":                           "AbCdEfGhIjK1234567890",
+		"":                                                    "",
+		"https://chat.whatsapp.com/":                          "",
+		"https://example.com/AbCdEfGhIjK":                     "",
+		"chat.whatsapp.com/invite/AbCdEfG":                    "",
+		"two words":                                           "",
+	}
+	for link, expected := range tests {
+		code, err := ParseGroupInviteLink(link)
+		if len(expected) == 0 {
+			if !errors.Is(err, ErrInviteLinkInvalid) {
+				t.Errorf("ParseGroupInviteLink(%q) returned %q, %v, expected ErrInviteLinkInvalid", link, code, err)
+			}
+		} else if err != nil || code != expected {
+			t.Errorf("ParseGroupInviteLink(%q) returned %q, %v, expected %q", link, code, err, expected)
+		}
+	}
+}
+
+func TestGroupInviteLink_Invalid(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	if _, err := cli.GetGroupInfoFromLink("https://example.com/foo"); !errors.Is(err, ErrInviteLinkInvalid) {
+		t.Errorf("Expected ErrInviteLinkInvalid from GetGroupInfoFromLink, got %v", err)
+	}
+	if _, err := cli.JoinGroupWithLink("https://example.com/foo"); !errors.Is(err, ErrInviteLinkInvalid) {
+		t.Errorf("Expected ErrInviteLinkInvalid from JoinGroupWithLink, got %v", err)
+	}
+}
+
+func TestParseGroupNode_InvitePreview(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	baseAttrs := func() waBinary.Attrs {
+		return waBinary.Attrs{"id": "123456789-987654321", "subject": "Test", "s_t": "1700000000", "creation": "1700000000"}
+	}
+
+	attrs := baseAttrs()
+	attrs["size"] = "42"
+	group, err := cli.parseGroupNode(&waBinary.Node{Tag: "group", Attrs: attrs, Content: []waBinary.Node{
+		{Tag: "membership_approval_mode", Content: []waBinary.Node{{Tag: "group_join", Attrs: waBinary.Attrs{"state": "on"}}}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to parse group: %v", err)
+	} else if group.ParticipantCount != 42 || !group.IsJoinApprovalRequired {
+		t.Errorf("Expected 42 participants and join approval, got %d and %t", group.ParticipantCount, group.IsJoinApprovalRequired)
+	}
+
+	// Without the size attribute, the count comes from the participant list
+	group, err = cli.parseGroupNode(&waBinary.Node{Tag: "group", Attrs: baseAttrs(), Content: []waBinary.Node{
+		{Tag: "participant", Attrs: waBinary.Attrs{"jid": types.NewJID("2222", types.DefaultUserServer)}},
+		{Tag: "participant", Attrs: waBinary.Attrs{"jid": types.NewJID("3333", types.DefaultUserServer), "type": "admin"}},
+		{Tag: "membership_approval_mode", Content: []waBinary.Node{{Tag: "group_join", Attrs: waBinary.Attrs{"state": "off"}}}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to parse group: %v", err)
+	} else if group.ParticipantCount != 2 || group.IsJoinApprovalRequired {
+		t.Errorf("Expected 2 participants and no join approval, got %d and %t", group.ParticipantCount, group.IsJoinApprovalRequired)
+	}
+}
+
+func TestFillParticipantChanges(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	ownJID := types.NewADJID("1111", 0, 1)
+	device.ID = &ownJID
+	device.PushName = "Me"
+	cli := NewClient(device, nil)
+	admin := types.NewADJID("2222", 0, 3)
+	user := types.NewJID("3333", types.DefaultUserServer)
+	_, _, _ = device.Contacts.PutPushName(context.Background(), admin.ToNonAD(), "Admin")
+	_, _, _ = device.Contacts.PutPushName(context.Background(), user, "User")
+
+	tests := []struct {
+		name     string
+		evt      events.GroupInfo
+		expected []events.GroupParticipantChange
+	}{
+		{"added", events.GroupInfo{Sender: &admin, Join: []types.JID{user}},
+			[]events.GroupParticipantChange{{JID: user, Type: events.GroupParticipantChangeJoin, PushName: "User", Reason: events.GroupParticipantChangeReasonAdded}}},
+		{"joined", events.GroupInfo{Sender: &user, Join: []types.JID{user}},
+			[]events.GroupParticipantChange{{JID: user, Type: events.GroupParticipantChangeJoin, PushName: "User", Reason: events.GroupParticipantChangeReasonJoined}}},
+		{"invite link", events.GroupInfo{Sender: &user, JoinReason: "invite", Join: []types.JID{user}},
+			[]events.GroupParticipantChange{{JID: user, Type: events.GroupParticipantChangeJoin, PushName: "User", Reason: events.GroupParticipantChangeReasonInviteLink}}},
+		{"join approved", events.GroupInfo{Sender: &admin, JoinReason: "invite", Join: []types.JID{user}},
+			[]events.GroupParticipantChange{{JID: user, Type: events.GroupParticipantChangeJoin, PushName: "User", Reason: events.GroupParticipantChangeReasonJoinApproved}}},
+		{"community", events.GroupInfo{Sender: &admin, JoinReason: "linked_group_join", Join: []types.JID{ownJID.ToNonAD()}},
+			[]events.GroupParticipantChange{{JID: ownJID.ToNonAD(), Type: events.GroupParticipantChangeJoin, PushName: "Me", Reason: events.GroupParticipantChangeReasonCommunity}}},
+		{"left", events.GroupInfo{Sender: &admin, Leave: []types.JID{admin.ToNonAD()}},
+			[]events.GroupParticipantChange{{JID: admin.ToNonAD(), Type: events.GroupParticipantChangeLeave, PushName: "Admin", Reason: events.GroupParticipantChangeReasonLeft}}},
+		{"removed and promoted", events.GroupInfo{Sender: &admin, Leave: []types.JID{user}, Promote: []types.JID{ownJID.ToNonAD()}},
+			[]events.GroupParticipantChange{
+				{JID: user, Type: events.GroupParticipantChangeLeave, PushName: "User", Reason: events.GroupParticipantChangeReasonRemoved},
+				{JID: ownJID.ToNonAD(), Type: events.GroupParticipantChangePromote, PushName: "Me"},
+			}},
+		{"unknown push name", events.GroupInfo{Demote: []types.JID{types.NewJID("4444", types.DefaultUserServer)}},
+			[]events.GroupParticipantChange{{JID: types.NewJID("4444", types.DefaultUserServer), Type: events.GroupParticipantChangeDemote}}},
+	}
+	for _, test := range tests {
+		evt := test.evt
+		cli.fillParticipantChanges(&evt)
+		if !reflect.DeepEqual(evt.ParticipantChanges, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, evt.ParticipantChanges)
+		}
+		if evt.Sender != nil && evt.Sender.User == admin.User && evt.SenderPushName != "Admin" {
+			t.Errorf("%s: expected sender push name to be filled, got %q", test.name, evt.SenderPushName)
+		}
+	}
+
+	evt := events.GroupInfo{Sender: &admin, Name: &types.GroupName{Name: "New name"}}
+	cli.fillParticipantChanges(&evt)
+	if evt.ParticipantChanges != nil || evt.SenderPushName != "" {
+		t.Errorf("Expected changes without participants to be left alone, got %+v", evt)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// Group returns the info of the given group. If Client.CacheGroupInfo is enabled and the group is cached, the cached
+// info is returned without contacting the server, so this is cheap to call for every incoming message:
+//
+//	cli.CacheGroupInfo = true
+//	cli.AddEventHandler(func(evt interface{}) {
+//		if msg, ok := evt.(*events.Message); ok && msg.Info.IsGroup {
+//			group, err := cli.Group(msg.Info.Chat)
+//			// handle error
+//			fmt.Println("Message in", group.Name)
+//		}
+//	})
+//
+// The returned struct is a copy, so it can be modified freely.
+func (cli *Client) Group(jid types.JID) (*types.GroupInfo, error) {
+	if cached, ok := cli.CachedGroup(jid); ok {
+		return cached, nil
+	}
+	return cli.GetGroupInfo(jid)
+}
+
+// CachedGroup returns the cached info of the given group, or false if it's not cached or Client.CacheGroupInfo is off.
+// Unlike Group, this never contacts the server.
+func (cli *Client) CachedGroup(jid types.JID) (*types.GroupInfo, bool) {
+	if !cli.CacheGroupInfo {
+		return nil, false
+	}
+	cli.groupInfoCacheLock.RLock()
+	cached, ok := cli.groupInfoCache[jid]
+	cli.groupInfoCacheLock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return copyGroupInfo(cached), true
+}
+
+// InvalidateGroup removes the given group from the cache, so that the next Group call fetches it from the server.
+func (cli *Client) InvalidateGroup(jid types.JID) {
+	cli.groupInfoCacheLock.Lock()
+	delete(cli.groupInfoCache, jid)
+	cli.groupInfoCacheLock.Unlock()
+}
+
+func copyGroupInfo(info *types.GroupInfo) *types.GroupInfo {
+	infoCopy := *info
+	infoCopy.Participants = make([]types.GroupParticipant, len(info.Participants))
+	copy(infoCopy.Participants, info.Participants)
+	return &infoCopy
+}
+
+func (cli *Client) cacheGroupInfo(info *types.GroupInfo) {
+	if !cli.CacheGroupInfo {
+		return
+	}
+	cli.groupInfoCacheLock.Lock()
+	cli.groupInfoCache[info.JID] = copyGroupInfo(info)
+	cli.groupInfoCacheLock.Unlock()
+}
+
+// updateGroupInfoCache applies a group change notification to the cached group info. Changes that can't be applied
+// to the cached info, like community links or unknown change types, remove the group from the cache instead.
+func (cli *Client) updateGroupInfoCache(evt *events.GroupInfo) {
+	if !cli.CacheGroupInfo {
+		return
+	}
+	cli.groupInfoCacheLock.Lock()
+	defer cli.groupInfoCacheLock.Unlock()
+	cached, ok := cli.groupInfoCache[evt.JID]
+	if !ok {
+		return
+	}
+	if (evt.Delete != nil && evt.Delete.Deleted) || evt.Link != nil || evt.Unlink != nil || len(evt.UnknownChanges) > 0 {
+		delete(cli.groupInfoCache, evt.JID)
+		return
+	}
+	ownID := cli.Store.ID
+	for _, jid := range evt.Leave {
+		if ownID != nil && jid.User == ownID.User && jid.Server == ownID.Server {
+			// We won't get notifications about the group anymore, so the info would go stale
+			delete(cli.groupInfoCache, evt.JID)
+			return
+		}
+	}
+
+	updated := copyGroupInfo(cached)
+	if evt.Name != nil {
+		updated.GroupName = *evt.Name
+	}
+	if evt.Topic != nil {
+		updated.GroupTopic = *evt.Topic
+	}
+	if evt.Locked != nil {
+		updated.GroupLocked = *evt.Locked
+	}
+	if evt.Announce != nil {
+		updated.GroupAnnounce = *evt.Announce
+	}
+	if evt.Ephemeral != nil {
+		updated.GroupEphemeral = *evt.Ephemeral
+	}
+	if evt.MembershipApprovalMode != nil {
+		updated.GroupMembershipApprovalMode = *evt.MembershipApprovalMode
+	}
+	if evt.MemberAddMode != nil {
+		updated.MemberAddMode = *evt.MemberAddMode
+	}
+	if len(evt.ParticipantVersionID) > 0 {
+		updated.ParticipantVersionID = evt.ParticipantVersionID
+	}
+	participantIndex := func(jid types.JID) int {
+		for i, participant := range updated.Participants {
+			if participant.JID == jid {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, jid := range evt.Join {
+		if participantIndex(jid) < 0 {
+			updated.Participants = append(updated.Participants, types.GroupParticipant{JID: jid})
+		}
+	}
+	for _, jid := range evt.Leave {
+		if i := participantIndex(jid); i >= 0 {
+			updated.Participants = append(updated.Participants[:i], updated.Participants[i+1:]...)
+		}
+	}
+	for _, jid := range evt.Promote {
+		if i := participantIndex(jid); i >= 0 {
+			updated.Participants[i].IsAdmin = true
+		}
+	}
+	for _, jid := range evt.Demote {
+		if i := participantIndex(jid); i >= 0 {
+			updated.Participants[i].IsAdmin = false
+			updated.Participants[i].IsSuperAdmin = false
+		}
+	}
+	if len(evt.Join) > 0 || len(evt.Leave) > 0 {
+		updated.ParticipantCount = len(updated.Participants)
+	}
+	cli.groupInfoCache[evt.JID] = updated
+}
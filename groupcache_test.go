@@ -0,0 +1,156 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"reflect"
+	"testing"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestUpdateGroupInfoCache(t *testing.T) {
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	ownJID := types.NewADJID("1111", 0, 2)
+	alice := types.NewJID("2222", types.DefaultUserServer)
+	bob := types.NewJID("3333", types.DefaultUserServer)
+	carol := types.NewJID("4444", types.DefaultUserServer)
+	newGroup := func() *types.GroupInfo {
+		return &types.GroupInfo{
+			JID:       group,
+			GroupName: types.GroupName{Name: "Old name"},
+			Participants: []types.GroupParticipant{
+				{JID: ownJID.ToNonAD()},
+				{JID: alice, IsAdmin: true, IsSuperAdmin: true},
+				{JID: bob},
+			},
+			ParticipantCount: 3,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		evt      events.GroupInfo
+		removed  bool
+		expected func(info *types.GroupInfo)
+	}{{
+		name: "metadata changes",
+		evt: events.GroupInfo{
+			Name:                   &types.GroupName{Name: "New name"},
+			Topic:                  &types.GroupTopic{Topic: "New topic"},
+			Locked:                 &types.GroupLocked{IsLocked: true},
+			Announce:               &types.GroupAnnounce{IsAnnounce: true},
+			Ephemeral:              &types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: 86400},
+			MembershipApprovalMode: &types.GroupMembershipApprovalMode{IsJoinApprovalRequired: true},
+			MemberAddMode:          func() *types.GroupMemberAddMode { mode := types.GroupMemberAddModeAllMember; return &mode }(),
+			ParticipantVersionID:   "new version",
+		},
+		expected: func(info *types.GroupInfo) {
+			info.Name = "New name"
+			info.Topic = "New topic"
+			info.IsLocked = true
+			info.IsAnnounce = true
+			info.IsEphemeral = true
+			info.DisappearingTimer = 86400
+			info.IsJoinApprovalRequired = true
+			info.MemberAddMode = types.GroupMemberAddModeAllMember
+			info.ParticipantVersionID = "new version"
+		},
+	}, {
+		name: "join and leave",
+		evt:  events.GroupInfo{Join: []types.JID{carol, alice}, Leave: []types.JID{bob}},
+		expected: func(info *types.GroupInfo) {
+			info.Participants = []types.GroupParticipant{
+				{JID: ownJID.ToNonAD()},
+				{JID: alice, IsAdmin: true, IsSuperAdmin: true},
+				{JID: carol},
+			}
+		},
+	}, {
+		name: "promote and demote",
+		evt:  events.GroupInfo{Promote: []types.JID{bob, carol}, Demote: []types.JID{alice}},
+		expected: func(info *types.GroupInfo) {
+			info.Participants[1].IsAdmin = false
+			info.Participants[1].IsSuperAdmin = false
+			info.Participants[2].IsAdmin = true
+		},
+	}, {
+		name:    "own user left",
+		evt:     events.GroupInfo{Leave: []types.JID{ownJID.ToNonAD()}},
+		removed: true,
+	}, {
+		name:    "group deleted",
+		evt:     events.GroupInfo{Delete: &types.GroupDelete{Deleted: true}},
+		removed: true,
+	}, {
+		name:    "community link",
+		evt:     events.GroupInfo{Link: &types.GroupLinkChange{Type: types.GroupLinkChangeTypeParent}},
+		removed: true,
+	}, {
+		name:    "community unlink",
+		evt:     events.GroupInfo{Unlink: &types.GroupLinkChange{Type: types.GroupLinkChangeTypeParent}},
+		removed: true,
+	}, {
+		name:    "unknown change",
+		evt:     events.GroupInfo{UnknownChanges: []*waBinary.Node{{Tag: "something_new"}}},
+		removed: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+			cli.Store.ID = &ownJID
+			cli.CacheGroupInfo = true
+			cli.cacheGroupInfo(newGroup())
+
+			evt := test.evt
+			evt.JID = group
+			cli.updateGroupInfoCache(&evt)
+			cached, ok := cli.CachedGroup(group)
+			if test.removed {
+				if ok {
+					t.Fatal("expected group to be removed from the cache")
+				}
+				return
+			} else if !ok {
+				t.Fatal("group was removed from the cache")
+			}
+			expected := newGroup()
+			test.expected(expected)
+			expected.ParticipantCount = len(expected.Participants)
+			if !reflect.DeepEqual(cached, expected) {
+				t.Errorf("unexpected cached info\nexpected: %+v\ngot:      %+v", expected, cached)
+			}
+		})
+	}
+}
+
+func TestUpdateGroupInfoCache_Uncached(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.CacheGroupInfo = true
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	cli.updateGroupInfoCache(&events.GroupInfo{JID: group, Name: &types.GroupName{Name: "Name"}})
+	if _, ok := cli.CachedGroup(group); ok {
+		t.Error("notification for an uncached group was added to the cache")
+	}
+}
+
+func TestCachedGroupReturnsCopy(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.CacheGroupInfo = true
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	cli.cacheGroupInfo(&types.GroupInfo{JID: group, Participants: []types.GroupParticipant{{JID: types.NewJID("2222", types.DefaultUserServer)}}})
+
+	cached, _ := cli.CachedGroup(group)
+	cached.Participants[0].IsAdmin = true
+	cached.Name = "Modified"
+	if again, _ := cli.CachedGroup(group); again.Participants[0].IsAdmin || again.Name != "" {
+		t.Error("modifying the returned info changed the cache")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// GetGroupJoinRequests returns the pending requests to join a group that requires admin approval
+// (see SetGroupJoinApprovalMode). Only admins can see the requests.
+func (cli *Client) GetGroupJoinRequests(jid types.JID) ([]types.GroupJoinRequest, error) {
+	resp, err := cli.sendGroupIQ(context.TODO(), iqGet, jid, waBinary.Node{Tag: "membership_approval_requests"})
+	if err != nil {
+		return nil, err
+	}
+	requestsNode, ok := resp.GetOptionalChildByTag("membership_approval_requests")
+	if !ok {
+		return nil, &ElementMissingError{Tag: "membership_approval_requests", In: "response to join request list query"}
+	}
+	return parseGroupJoinRequests(&requestsNode)
+}
+
+func parseGroupJoinRequests(requestsNode *waBinary.Node) ([]types.GroupJoinRequest, error) {
+	var requests []types.GroupJoinRequest
+	for _, child := range requestsNode.GetChildren() {
+		if child.Tag != "membership_approval_request" {
+			continue
+		}
+		ag := child.AttrGetter()
+		request := types.GroupJoinRequest{
+			JID:         ag.JID("jid"),
+			RequestedAt: ag.UnixTime("request_time"),
+			Method:      ag.OptionalString("request_method"),
+		}
+		if !ag.OK() {
+			return nil, fmt.Errorf("failed to parse join request: %w", ag.Error())
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// JoinRequestAction is an action that can be done to a group join request with UpdateGroupJoinRequests.
+type JoinRequestAction string
+
+const (
+	JoinRequestActionApprove JoinRequestAction = "approve"
+	JoinRequestActionReject  JoinRequestAction = "reject"
+)
+
+// UpdateGroupJoinRequests approves or rejects the join requests of the given users. Like UpdateGroupParticipantsBulk,
+// large lists are split into multiple requests and the outcome for each user is returned in the same order as
+// the input. Requests that were already handled or canceled get ParticipantUpdateAlreadyDone.
+//
+//	requests, err := cli.GetGroupJoinRequests(group)
+//	// handle error
+//	var requesters []types.JID
+//	for _, req := range requests {
+//		requesters = append(requesters, req.JID)
+//	}
+//	results, err := cli.UpdateGroupJoinRequests(ctx, group, requesters, whatsmeow.JoinRequestActionApprove)
+func (cli *Client) UpdateGroupJoinRequests(ctx context.Context, jid types.JID, requesters []types.JID, action JoinRequestAction) ([]ParticipantUpdateResult, error) {
+	// Approving a request adds the user to the group, so the errors are the same as when adding
+	change := ParticipantChangeAdd
+	if action == JoinRequestActionReject {
+		change = ParticipantChangeRemove
+	}
+	results := make([]ParticipantUpdateResult, 0, len(requesters))
+	for _, chunk := range splitParticipantChunks(requesters) {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		resp, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
+			Tag: "membership_requests_action",
+			Content: []waBinary.Node{{
+				Tag:     string(action),
+				Content: makeParticipantNodes(chunk),
+			}},
+		})
+		var parsed map[types.JID]ParticipantUpdateResult
+		if err == nil {
+			actionNode, _ := resp.GetOptionalChildByTag("membership_requests_action", string(action))
+			parsed = parseParticipantUpdates(&actionNode, change)
+		}
+		results = appendParticipantUpdateResults(results, chunk, parsed, err)
+	}
+	return results, ctx.Err()
+}
+
+// SetGroupJoinApprovalMode changes whether admins have to approve users who join the group with an invite link.
+func (cli *Client) SetGroupJoinApprovalMode(jid types.JID, required bool) error {
+	state := "off"
+	if required {
+		state = "on"
+	}
+	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+		Tag: "membership_approval_mode",
+		Content: []waBinary.Node{{
+			Tag:   "group_join",
+			Attrs: waBinary.Attrs{"state": state},
+		}},
+	})
+	return err
+}
+
+// isGroupJoinRequestNotification returns true if the group notification is about join requests
+// rather than changes to the group itself.
+func isGroupJoinRequestNotification(node *waBinary.Node) bool {
+	children := node.GetChildren()
+	if len(children) == 0 {
+		return false
+	}
+	for _, child := range children {
+		switch child.Tag {
+		case "membership_approval_request", "created_membership_requests", "revoked_membership_requests":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (cli *Client) parseGroupJoinRequestNotification(node *waBinary.Node) (*events.GroupJoinRequest, error) {
+	var evt events.GroupJoinRequest
+	ag := node.AttrGetter()
+	evt.JID = ag.JID("from")
+	evt.Timestamp = ag.UnixTime("t")
+	sender := ag.OptionalJIDOrEmpty("participant")
+	if !ag.OK() {
+		return nil, fmt.Errorf("join request notification doesn't contain required attributes: %w", ag.Error())
+	}
+	for _, child := range node.GetChildren() {
+		cag := child.AttrGetter()
+		switch child.Tag {
+		case "membership_approval_request":
+			// A user requested to join on their own, so the notification comes from them
+			evt.Method = cag.OptionalString("request_method")
+			if !sender.IsEmpty() {
+				evt.Requesters = append(evt.Requesters, sender)
+			}
+		case "created_membership_requests":
+			evt.Method = cag.OptionalString("request_method")
+			evt.Requesters = append(evt.Requesters, parseParticipantList(&child)...)
+		case "revoked_membership_requests":
+			evt.Revoked = true
+			evt.Requesters = append(evt.Requesters, parseParticipantList(&child)...)
+		}
+	}
+	return &evt, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestParseGroupJoinRequests(t *testing.T) {
+	requester := types.NewJID("2222", types.DefaultUserServer)
+	requests, err := parseGroupJoinRequests(&waBinary.Node{Tag: "membership_approval_requests", Content: []waBinary.Node{
+		{Tag: "membership_approval_request", Attrs: waBinary.Attrs{"jid": requester, "request_time": "1700000000", "request_method": "invite_link"}},
+		{Tag: "something_else"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to parse join requests: %v", err)
+	} else if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	} else if requests[0].JID != requester || requests[0].RequestedAt.Unix() != 1700000000 || requests[0].Method != "invite_link" {
+		t.Errorf("Unexpected request %+v", requests[0])
+	}
+
+	_, err = parseGroupJoinRequests(&waBinary.Node{Tag: "membership_approval_requests", Content: []waBinary.Node{
+		{Tag: "membership_approval_request", Attrs: waBinary.Attrs{"request_time": "1700000000"}},
+	}})
+	if err == nil {
+		t.Error("Expected error for a request without a JID")
+	}
+}
+
+func TestParseGroupJoinRequestNotification(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	requesters := []types.JID{types.NewJID("2222", types.DefaultUserServer), types.NewJID("3333", types.DefaultUserServer)}
+	participantNodes := makeParticipantNodes(requesters)
+	notifAttrs := func(participant types.JID) waBinary.Attrs {
+		attrs := waBinary.Attrs{"from": group, "t": "1700000000"}
+		if !participant.IsEmpty() {
+			attrs["participant"] = participant
+		}
+		return attrs
+	}
+
+	tests := []struct {
+		name     string
+		node     waBinary.Node
+		expected events.GroupJoinRequest
+	}{
+		{"self request", waBinary.Node{Tag: "notification", Attrs: notifAttrs(requesters[0]), Content: []waBinary.Node{
+			{Tag: "membership_approval_request", Attrs: waBinary.Attrs{"request_method": "invite_link"}},
+		}}, events.GroupJoinRequest{Requesters: requesters[:1], Method: "invite_link"}},
+		{"created", waBinary.Node{Tag: "notification", Attrs: notifAttrs(types.EmptyJID), Content: []waBinary.Node{
+			{Tag: "created_membership_requests", Attrs: waBinary.Attrs{"request_method": "linked_group_join"}, Content: participantNodes},
+		}}, events.GroupJoinRequest{Requesters: requesters, Method: "linked_group_join"}},
+		{"revoked", waBinary.Node{Tag: "notification", Attrs: notifAttrs(types.EmptyJID), Content: []waBinary.Node{
+			{Tag: "revoked_membership_requests", Content: participantNodes},
+		}}, events.GroupJoinRequest{Requesters: requesters, Revoked: true}},
+	}
+	for _, test := range tests {
+		if !isGroupJoinRequestNotification(&test.node) {
+			t.Errorf("%s: expected node to be detected as a join request notification", test.name)
+			continue
+		}
+		parsed, err := cli.parseGroupNotification(&test.node)
+		if err != nil {
+			t.Errorf("%s: failed to parse notification: %v", test.name, err)
+			continue
+		}
+		evt, ok := parsed.(*events.GroupJoinRequest)
+		if !ok {
+			t.Errorf("%s: expected GroupJoinRequest event, got %T", test.name, parsed)
+			continue
+		}
+		test.expected.JID = group
+		test.expected.Timestamp = time.Unix(1700000000, 0)
+		if !reflect.DeepEqual(*evt, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *evt)
+		}
+	}
+
+	for _, node := range []waBinary.Node{
+		{Tag: "notification"},
+		{Tag: "notification", Content: []waBinary.Node{{Tag: "created_membership_requests"}, {Tag: "add"}}},
+		{Tag: "notification", Content: []waBinary.Node{{Tag: "subject"}}},
+	} {
+		if isGroupJoinRequestNotification(&node) {
+			t.Errorf("Expected %s not to be detected as a join request notification", node.XMLString())
+		}
+	}
+}
+
+func TestUpdateGroupJoinRequests(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	requesters := makeTestParticipants(3)
+
+	results, err := cli.UpdateGroupJoinRequests(context.Background(), group, requesters, JoinRequestActionApprove)
+	if err != nil {
+		t.Fatalf("Expected failed requests not to return an error, got %v", err)
+	} else if len(results) != len(requesters) {
+		t.Fatalf("Expected a result for every requester, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.JID != requesters[i] || result.Status != ParticipantUpdateFailed || result.Err == nil {
+			t.Errorf("Expected result %d to be a failure for %s, got %+v", i, requesters[i], result)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = cli.UpdateGroupJoinRequests(ctx, group, requesters, JoinRequestActionReject); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context error, got %v", err)
+	}
+}
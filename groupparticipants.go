@@ -0,0 +1,243 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// MaxParticipantChangesPerRequest is the number of participants that UpdateGroupParticipantsBulk puts in a single
+// request. Larger lists are split into multiple requests.
+var MaxParticipantChangesPerRequest = 20
+
+// ParticipantUpdateStatus is the outcome of a change for a single participant in UpdateGroupParticipantsBulk.
+type ParticipantUpdateStatus string
+
+const (
+	// The change was applied.
+	ParticipantUpdateOK ParticipantUpdateStatus = "ok"
+	// The user is already in the group (when adding) or not in the group (when removing, promoting or demoting).
+	ParticipantUpdateAlreadyDone ParticipantUpdateStatus = "already_done"
+	// The user's privacy settings don't allow adding them directly. The result contains an invite code that can
+	// be sent to them in a GroupInviteMessage.
+	ParticipantUpdatePrivacyBlocked ParticipantUpdateStatus = "privacy_blocked"
+	// The user's privacy settings didn't allow adding them, so an invite message was sent to them instead.
+	ParticipantUpdateInviteSent ParticipantUpdateStatus = "invite_sent"
+	// The user isn't on WhatsApp.
+	ParticipantUpdateNotFound ParticipantUpdateStatus = "not_found"
+	// The user left the group recently and can't be added back yet.
+	ParticipantUpdateRecentlyLeft ParticipantUpdateStatus = "recently_left"
+	// The group is full.
+	ParticipantUpdateGroupFull ParticipantUpdateStatus = "group_full"
+	// The change failed for another reason, see the Error code or Err in the result.
+	ParticipantUpdateFailed ParticipantUpdateStatus = "failed"
+)
+
+// ParticipantUpdateResult is the result of a change for a single participant in UpdateGroupParticipantsBulk.
+type ParticipantUpdateResult struct {
+	JID    types.JID
+	Status ParticipantUpdateStatus
+	// The error code from the server, or zero if the change was successful.
+	Error int
+	// The invite code for adding the user, if their privacy settings didn't allow adding them directly.
+	AddRequest *types.GroupParticipantAddRequest
+	// Set if the request containing this participant failed entirely, or if sending the invite message failed.
+	Err error
+}
+
+// BulkParticipantOptions contains optional settings for UpdateGroupParticipantsBulk.
+type BulkParticipantOptions struct {
+	// If true, users who can't be added because of their privacy settings are sent an invite message,
+	// like the official clients do.
+	SendInvites bool
+	// The caption for invite messages.
+	InviteCaption string
+}
+
+func participantUpdateStatus(change ParticipantChange, code int, addRequest *types.GroupParticipantAddRequest) ParticipantUpdateStatus {
+	switch code {
+	case 0, 200:
+		return ParticipantUpdateOK
+	case 409:
+		return ParticipantUpdateAlreadyDone
+	case 404:
+		if change == ParticipantChangeAdd {
+			return ParticipantUpdateNotFound
+		}
+		return ParticipantUpdateAlreadyDone
+	case 403:
+		if addRequest != nil {
+			return ParticipantUpdatePrivacyBlocked
+		}
+	case 408:
+		return ParticipantUpdateRecentlyLeft
+	case 500:
+		if change == ParticipantChangeAdd {
+			return ParticipantUpdateGroupFull
+		}
+	}
+	return ParticipantUpdateFailed
+}
+
+// parseParticipantUpdates parses the per-participant results in the given element of the response to a participant
+// change request.
+func parseParticipantUpdates(changeNode *waBinary.Node, change ParticipantChange) map[types.JID]ParticipantUpdateResult {
+	results := make(map[types.JID]ParticipantUpdateResult)
+	for _, child := range changeNode.GetChildren() {
+		if child.Tag != "participant" {
+			continue
+		}
+		ag := child.AttrGetter()
+		result := ParticipantUpdateResult{
+			JID:   ag.JID("jid"),
+			Error: ag.OptionalInt("error"),
+		}
+		if addRequest, ok := child.GetOptionalChildByTag("add_request"); ok {
+			addAG := addRequest.AttrGetter()
+			result.AddRequest = &types.GroupParticipantAddRequest{
+				Code:       addAG.String("code"),
+				Expiration: addAG.UnixTime("expiration"),
+			}
+		}
+		if !ag.OK() {
+			continue
+		}
+		result.Status = participantUpdateStatus(change, result.Error, result.AddRequest)
+		results[result.JID] = result
+	}
+	return results
+}
+
+// UpdateGroupParticipantsBulk applies the same change to any number of participants in a group. The list is split
+// into requests of MaxParticipantChangesPerRequest participants, and the outcome for each participant is returned
+// in the same order as the input, so that a few failures don't hide which changes went through.
+//
+// If a whole request fails, the participants in it get ParticipantUpdateFailed with the error in Err and the other
+// requests are still sent. The returned error is only set if the context is canceled.
+//
+//	results, err := cli.UpdateGroupParticipantsBulk(ctx, group, members, whatsmeow.ParticipantChangeAdd, &whatsmeow.BulkParticipantOptions{
+//		SendInvites: true,
+//	})
+//	for _, result := range results {
+//		if result.Status != whatsmeow.ParticipantUpdateOK {
+//			fmt.Println("Couldn't add", result.JID, result.Status)
+//		}
+//	}
+func (cli *Client) UpdateGroupParticipantsBulk(ctx context.Context, jid types.JID, participants []types.JID, change ParticipantChange, opts *BulkParticipantOptions) ([]ParticipantUpdateResult, error) {
+	if opts == nil {
+		opts = &BulkParticipantOptions{}
+	}
+	results := make([]ParticipantUpdateResult, 0, len(participants))
+	for _, chunk := range splitParticipantChunks(participants) {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		resp, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
+			Tag:     string(change),
+			Content: makeParticipantNodes(chunk),
+		})
+		var parsed map[types.JID]ParticipantUpdateResult
+		if err == nil {
+			changeNode, _ := resp.GetOptionalChildByTag(string(change))
+			parsed = parseParticipantUpdates(&changeNode, change)
+		}
+		results = appendParticipantUpdateResults(results, chunk, parsed, err)
+	}
+	if opts.SendInvites && change == ParticipantChangeAdd {
+		cli.sendParticipantInvites(ctx, jid, results, opts.InviteCaption)
+	}
+	return results, ctx.Err()
+}
+
+// splitParticipantChunks splits the list into chunks of MaxParticipantChangesPerRequest participants.
+func splitParticipantChunks(participants []types.JID) [][]types.JID {
+	chunkSize := MaxParticipantChangesPerRequest
+	if chunkSize <= 0 || chunkSize > len(participants) {
+		chunkSize = len(participants)
+	}
+	if chunkSize == 0 {
+		return nil
+	}
+	chunks := make([][]types.JID, 0, (len(participants)+chunkSize-1)/chunkSize)
+	for start := 0; start < len(participants); start += chunkSize {
+		end := start + chunkSize
+		if end > len(participants) {
+			end = len(participants)
+		}
+		chunks = append(chunks, participants[start:end])
+	}
+	return chunks
+}
+
+func makeParticipantNodes(participants []types.JID) []waBinary.Node {
+	nodes := make([]waBinary.Node, len(participants))
+	for i, participant := range participants {
+		nodes[i] = waBinary.Node{
+			Tag:   "participant",
+			Attrs: waBinary.Attrs{"jid": participant},
+		}
+	}
+	return nodes
+}
+
+// appendParticipantUpdateResults adds the results of a single request to the list in the order of the request. If the
+// request failed or the response is missing a participant, the participant gets a failed result.
+func appendParticipantUpdateResults(results []ParticipantUpdateResult, chunk []types.JID, parsed map[types.JID]ParticipantUpdateResult, err error) []ParticipantUpdateResult {
+	for _, participant := range chunk {
+		result, ok := parsed[participant]
+		if err != nil {
+			result = ParticipantUpdateResult{JID: participant, Status: ParticipantUpdateFailed, Err: err}
+		} else if !ok {
+			result = ParticipantUpdateResult{
+				JID:    participant,
+				Status: ParticipantUpdateFailed,
+				Err:    &ElementMissingError{Tag: "participant", In: "response to participant update"},
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// sendParticipantInvites sends invite messages to the users in the results whose privacy settings blocked adding them.
+func (cli *Client) sendParticipantInvites(ctx context.Context, jid types.JID, results []ParticipantUpdateResult, caption string) {
+	var groupName string
+	for i, result := range results {
+		if result.Status != ParticipantUpdatePrivacyBlocked {
+			continue
+		}
+		if len(groupName) == 0 {
+			info, err := cli.Group(jid)
+			if err != nil {
+				results[i].Err = fmt.Errorf("failed to get group info for invite: %w", err)
+				continue
+			}
+			groupName = info.Name
+		}
+		msg := &waProto.Message{GroupInviteMessage: &waProto.GroupInviteMessage{
+			GroupJid:         proto.String(jid.String()),
+			InviteCode:       proto.String(result.AddRequest.Code),
+			InviteExpiration: proto.Int64(result.AddRequest.Expiration.Unix()),
+			GroupName:        proto.String(groupName),
+		}}
+		if len(caption) > 0 {
+			msg.GroupInviteMessage.Caption = proto.String(caption)
+		}
+		if _, err := cli.SendMessage(ctx, result.JID, "", msg); err != nil {
+			results[i].Err = fmt.Errorf("failed to send invite: %w", err)
+		} else {
+			results[i].Status = ParticipantUpdateInviteSent
+		}
+	}
+}
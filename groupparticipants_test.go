@@ -0,0 +1,187 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func makeTestParticipants(count int) []types.JID {
+	participants := make([]types.JID, count)
+	for i := range participants {
+		participants[i] = types.NewJID(strconv.Itoa(1000+i), types.DefaultUserServer)
+	}
+	return participants
+}
+
+func TestParticipantUpdateStatus(t *testing.T) {
+	addRequest := &types.GroupParticipantAddRequest{Code: "abc"}
+	tests := []struct {
+		change     ParticipantChange
+		code       int
+		addRequest *types.GroupParticipantAddRequest
+		expected   ParticipantUpdateStatus
+	}{
+		{ParticipantChangeAdd, 200, nil, ParticipantUpdateOK},
+		{ParticipantChangeRemove, 0, nil, ParticipantUpdateOK},
+		{ParticipantChangeAdd, 409, nil, ParticipantUpdateAlreadyDone},
+		{ParticipantChangeAdd, 404, nil, ParticipantUpdateNotFound},
+		{ParticipantChangeRemove, 404, nil, ParticipantUpdateAlreadyDone},
+		{ParticipantChangeAdd, 403, addRequest, ParticipantUpdatePrivacyBlocked},
+		{ParticipantChangeAdd, 403, nil, ParticipantUpdateFailed},
+		{ParticipantChangeAdd, 408, nil, ParticipantUpdateRecentlyLeft},
+		{ParticipantChangeAdd, 500, nil, ParticipantUpdateGroupFull},
+		{ParticipantChangePromote, 500, nil, ParticipantUpdateFailed},
+		{ParticipantChangeDemote, 401, nil, ParticipantUpdateFailed},
+	}
+	for _, test := range tests {
+		if status := participantUpdateStatus(test.change, test.code, test.addRequest); status != test.expected {
+			t.Errorf("participantUpdateStatus(%s, %d) = %s, expected %s", test.change, test.code, status, test.expected)
+		}
+	}
+}
+
+func TestParseParticipantUpdates(t *testing.T) {
+	participants := makeTestParticipants(3)
+	results := parseParticipantUpdates(&waBinary.Node{Tag: "add", Content: []waBinary.Node{
+		{Tag: "participant", Attrs: waBinary.Attrs{"jid": participants[0]}},
+		{Tag: "participant", Attrs: waBinary.Attrs{"jid": participants[1], "error": "403"}, Content: []waBinary.Node{
+			{Tag: "add_request", Attrs: waBinary.Attrs{"code": "invite-code", "expiration": "1700000000"}},
+		}},
+		{Tag: "participant", Attrs: waBinary.Attrs{"jid": participants[2], "error": "409"}},
+		{Tag: "participant"},
+		{Tag: "something_else", Attrs: waBinary.Attrs{"jid": participants[0]}},
+	}}, ParticipantChangeAdd)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[participants[0]].Status != ParticipantUpdateOK {
+		t.Errorf("Expected first participant to be added, got %+v", results[participants[0]])
+	}
+	blocked := results[participants[1]]
+	if blocked.Status != ParticipantUpdatePrivacyBlocked || blocked.Error != 403 || blocked.AddRequest == nil {
+		t.Errorf("Expected second participant to be privacy blocked, got %+v", blocked)
+	} else if blocked.AddRequest.Code != "invite-code" || blocked.AddRequest.Expiration.Unix() != 1700000000 {
+		t.Errorf("Unexpected add request %+v", blocked.AddRequest)
+	}
+	if results[participants[2]].Status != ParticipantUpdateAlreadyDone {
+		t.Errorf("Expected third participant to already be in the group, got %+v", results[participants[2]])
+	}
+}
+
+func TestSplitParticipantChunks(t *testing.T) {
+	defer func(orig int) { MaxParticipantChangesPerRequest = orig }(MaxParticipantChangesPerRequest)
+	MaxParticipantChangesPerRequest = 2
+	participants := makeTestParticipants(5)
+	chunks := splitParticipantChunks(participants)
+	if len(chunks) != 3 || len(chunks[0]) != 2 || len(chunks[1]) != 2 || len(chunks[2]) != 1 {
+		t.Fatalf("Unexpected chunks %v", chunks)
+	} else if chunks[2][0] != participants[4] {
+		t.Errorf("Expected chunks to keep the order, got %v", chunks)
+	}
+	if chunks = splitParticipantChunks(nil); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for an empty list, got %v", chunks)
+	}
+	MaxParticipantChangesPerRequest = 0
+	if chunks = splitParticipantChunks(participants); len(chunks) != 1 || len(chunks[0]) != 5 {
+		t.Errorf("Expected a single chunk without a limit, got %v", chunks)
+	}
+}
+
+func TestAppendParticipantUpdateResults(t *testing.T) {
+	participants := makeTestParticipants(2)
+	parsed := map[types.JID]ParticipantUpdateResult{
+		participants[1]: {JID: participants[1], Status: ParticipantUpdateOK},
+	}
+	results := appendParticipantUpdateResults(nil, participants, parsed, nil)
+	var missing *ElementMissingError
+	if len(results) != 2 || results[0].JID != participants[0] || results[1].Status != ParticipantUpdateOK {
+		t.Fatalf("Unexpected results %+v", results)
+	} else if results[0].Status != ParticipantUpdateFailed || !errors.As(results[0].Err, &missing) {
+		t.Errorf("Expected participant missing from the response to fail, got %+v", results[0])
+	}
+
+	requestErr := errors.New("request failed")
+	results = appendParticipantUpdateResults(results, participants, parsed, requestErr)
+	if len(results) != 4 {
+		t.Fatalf("Expected results to be appended, got %d", len(results))
+	}
+	for _, result := range results[2:] {
+		if result.Status != ParticipantUpdateFailed || result.Err != requestErr {
+			t.Errorf("Expected all participants in a failed request to fail, got %+v", result)
+		}
+	}
+}
+
+func TestUpdateGroupParticipantsBulk(t *testing.T) {
+	defer func(orig int) { MaxParticipantChangesPerRequest = orig }(MaxParticipantChangesPerRequest)
+	MaxParticipantChangesPerRequest = 2
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	participants := makeTestParticipants(5)
+
+	results, err := cli.UpdateGroupParticipantsBulk(context.Background(), group, participants, ParticipantChangeAdd, nil)
+	if err != nil {
+		t.Fatalf("Expected failed requests not to return an error, got %v", err)
+	} else if len(results) != len(participants) {
+		t.Fatalf("Expected a result for every participant, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.JID != participants[i] || result.Status != ParticipantUpdateFailed || result.Err == nil {
+			t.Errorf("Expected result %d to be a failure for %s, got %+v", i, participants[i], result)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = cli.UpdateGroupParticipantsBulk(ctx, group, participants, ParticipantChangeRemove, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context error, got %v", err)
+	} else if len(results) != 0 {
+		t.Errorf("Expected no requests to be sent after canceling, got %d results", len(results))
+	}
+}
+
+func TestSendParticipantInvites(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	cli := NewClient(device, nil)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	participants := makeTestParticipants(2)
+	makeResults := func() []ParticipantUpdateResult {
+		return []ParticipantUpdateResult{
+			{JID: participants[0], Status: ParticipantUpdateOK},
+			{JID: participants[1], Status: ParticipantUpdatePrivacyBlocked, AddRequest: &types.GroupParticipantAddRequest{Code: "abc"}},
+		}
+	}
+
+	results := makeResults()
+	cli.sendParticipantInvites(context.Background(), group, results, "")
+	if results[0].Err != nil {
+		t.Errorf("Expected added participant to be skipped, got %v", results[0].Err)
+	} else if results[1].Status != ParticipantUpdatePrivacyBlocked || results[1].Err == nil {
+		t.Errorf("Expected invite to fail without group info, got %+v", results[1])
+	}
+
+	// With the group info cached, the invite gets as far as sending the message
+	cli.CacheGroupInfo = true
+	cli.groupInfoCache[group] = &types.GroupInfo{JID: group, GroupName: types.GroupName{Name: "Test"}}
+	results = makeResults()
+	cli.sendParticipantInvites(context.Background(), group, results, "Join us")
+	if results[1].Status != ParticipantUpdatePrivacyBlocked || results[1].Err == nil || !strings.HasPrefix(results[1].Err.Error(), "failed to send invite") {
+		t.Errorf("Expected sending the invite to fail when not connected, got %+v", results[1])
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// GroupSettings contains the settings of a group that admins can change, see UpdateGroupSettings.
+//
+// Nil fields are left unchanged. Changes made by other admins, e.g. from their phones, are emitted
+// as events.GroupInfo with the corresponding fields set.
+type GroupSettings struct {
+	// If true, only admins can send messages, see SetGroupAnnounce.
+	Announce *bool
+	// If true, only admins can edit the group info, see SetGroupLocked.
+	Locked *bool
+	// Whether only admins or all members can add new members, see SetGroupMemberAddMode.
+	MemberAddMode *types.GroupMemberAddMode
+	// If true, admins have to approve new members who join with an invite link, see SetGroupJoinApprovalMode.
+	MembershipApproval *bool
+	// The disappearing message timer for new messages. Zero turns disappearing messages off, see SetDisappearingTimer.
+	DisappearingTimer *time.Duration
+}
+
+// GetGroupSettings gets the current settings of the given group. All fields in the returned struct are set.
+//
+// This uses Client.Group, so the cached group info is used if Client.CacheGroupInfo is enabled.
+func (cli *Client) GetGroupSettings(jid types.JID) (*GroupSettings, error) {
+	info, err := cli.Group(jid)
+	if err != nil {
+		return nil, err
+	}
+	memberAddMode := info.MemberAddMode
+	if len(memberAddMode) == 0 {
+		memberAddMode = types.GroupMemberAddModeAdmin
+	}
+	var timer time.Duration
+	if info.IsEphemeral {
+		timer = time.Duration(info.DisappearingTimer) * time.Second
+	}
+	return &GroupSettings{
+		Announce:           &info.IsAnnounce,
+		Locked:             &info.IsLocked,
+		MemberAddMode:      &memberAddMode,
+		MembershipApproval: &info.IsJoinApprovalRequired,
+		DisappearingTimer:  &timer,
+	}, nil
+}
+
+// UpdateGroupSettings changes all the non-nil settings of the given group. Each setting is a separate request,
+// so if one of them fails, the settings before it have already been changed and the ones after it are not sent.
+//
+//	announce := true
+//	addMode := types.GroupMemberAddModeAdmin
+//	err := cli.UpdateGroupSettings(ctx, group, whatsmeow.GroupSettings{
+//		Announce:      &announce,
+//		MemberAddMode: &addMode,
+//	})
+func (cli *Client) UpdateGroupSettings(ctx context.Context, jid types.JID, settings GroupSettings) error {
+	type settingChange struct {
+		name  string
+		apply func() error
+	}
+	var changes []settingChange
+	if settings.Announce != nil {
+		changes = append(changes, settingChange{"announce mode", func() error {
+			return cli.SetGroupAnnounce(jid, *settings.Announce)
+		}})
+	}
+	if settings.Locked != nil {
+		changes = append(changes, settingChange{"locked mode", func() error {
+			return cli.SetGroupLocked(jid, *settings.Locked)
+		}})
+	}
+	if settings.MemberAddMode != nil {
+		changes = append(changes, settingChange{"member add mode", func() error {
+			return cli.SetGroupMemberAddMode(jid, *settings.MemberAddMode)
+		}})
+	}
+	if settings.MembershipApproval != nil {
+		changes = append(changes, settingChange{"join approval mode", func() error {
+			return cli.SetGroupJoinApprovalMode(jid, *settings.MembershipApproval)
+		}})
+	}
+	if settings.DisappearingTimer != nil {
+		changes = append(changes, settingChange{"disappearing timer", func() error {
+			return cli.SetDisappearingTimer(jid, *settings.DisappearingTimer)
+		}})
+	}
+	for _, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := change.apply(); err != nil {
+			return fmt.Errorf("failed to change %s: %w", change.name, err)
+		}
+	}
+	return nil
+}
+
+// SetGroupMemberAddMode changes whether only admins or all members can add new members to the group.
+func (cli *Client) SetGroupMemberAddMode(jid types.JID, mode types.GroupMemberAddMode) error {
+	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+		Tag:     "member_add_mode",
+		Content: []byte(mode),
+	})
+	return err
+}
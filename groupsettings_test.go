@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestGetGroupSettings(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	if _, err := cli.GetGroupSettings(group); err == nil {
+		t.Fatal("Expected error when the group isn't cached and the client isn't connected")
+	}
+
+	cli.CacheGroupInfo = true
+	info := &types.GroupInfo{JID: group}
+	// The timer is left over from when disappearing messages were last on
+	info.DisappearingTimer = 86400
+	cli.groupInfoCache[group] = info
+	settings, err := cli.GetGroupSettings(group)
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	} else if *settings.Announce || *settings.Locked || *settings.MembershipApproval {
+		t.Errorf("Expected all modes to be off, got %+v", settings)
+	} else if *settings.MemberAddMode != types.GroupMemberAddModeAdmin {
+		t.Errorf("Expected missing member add mode to default to admins only, got %q", *settings.MemberAddMode)
+	} else if *settings.DisappearingTimer != 0 {
+		t.Errorf("Expected disappearing timer to be off, got %s", *settings.DisappearingTimer)
+	}
+
+	info.IsAnnounce = true
+	info.IsLocked = true
+	info.IsJoinApprovalRequired = true
+	info.IsEphemeral = true
+	info.MemberAddMode = types.GroupMemberAddModeAllMember
+	settings, err = cli.GetGroupSettings(group)
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	} else if !*settings.Announce || !*settings.Locked || !*settings.MembershipApproval {
+		t.Errorf("Expected all modes to be on, got %+v", settings)
+	} else if *settings.MemberAddMode != types.GroupMemberAddModeAllMember || *settings.DisappearingTimer != 24*time.Hour {
+		t.Errorf("Unexpected member add mode %q or timer %s", *settings.MemberAddMode, *settings.DisappearingTimer)
+	}
+}
+
+func TestUpdateGroupSettings(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	ctx := context.Background()
+	enabled := true
+	timer := DisappearingTimer7Days
+
+	if err := cli.UpdateGroupSettings(ctx, group, GroupSettings{}); err != nil {
+		t.Errorf("Expected no requests for empty settings, got %v", err)
+	}
+	// The settings are applied in a fixed order and the first failure stops the rest
+	tests := []struct {
+		settings GroupSettings
+		failed   string
+	}{
+		{GroupSettings{Announce: &enabled, Locked: &enabled, DisappearingTimer: &timer}, "announce mode"},
+		{GroupSettings{Locked: &enabled, MembershipApproval: &enabled}, "locked mode"},
+		{GroupSettings{MembershipApproval: &enabled, DisappearingTimer: &timer}, "join approval mode"},
+		{GroupSettings{DisappearingTimer: &timer}, "disappearing timer"},
+	}
+	for _, test := range tests {
+		err := cli.UpdateGroupSettings(ctx, group, test.settings)
+		if err == nil || !strings.HasPrefix(err.Error(), "failed to change "+test.failed+":") {
+			t.Errorf("Expected changing %s to fail first, got %v", test.failed, err)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := cli.UpdateGroupSettings(canceled, group, GroupSettings{Announce: &enabled}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context error before sending anything, got %v", err)
+	}
+}
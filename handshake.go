@@ -101,7 +101,7 @@ func (cli *Client) doHandshake(fs *socket.FrameSocket, ephemeralKP keys.KeyPair)
 		return fmt.Errorf("failed to mix noise private key in: %w", err)
 	}
 
-	clientFinishPayloadBytes, err := proto.Marshal(cli.Store.GetClientPayload())
+	clientFinishPayloadBytes, err := proto.Marshal(cli.Store.GetClientPayloadWithInfo(cli.DeviceInfo))
 	if err != nil {
 		return fmt.Errorf("failed to marshal client finish payload: %w", err)
 	}
@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// MaxHistoryRequestCount is the maximum number of messages that can be requested in a single on-demand history request.
+const MaxHistoryRequestCount = 50
+
+// RequestHistory asks the primary device (the phone) to send older messages of the given chat, starting from
+// the message before the given message ID.
+//
+// The phone responds with a normal history sync, which is emitted as an events.HistorySync event (or
+// events.HistorySyncConversation if StreamHistorySync is enabled) with the sync type historysync.SyncTypeOnDemand.
+// The count is capped at MaxHistoryRequestCount.
+//
+// If the timestamp of the message is known, RequestHistoryBefore should be preferred, as it lets the phone
+// find the message more reliably.
+//
+//	err := cli.RequestHistory(ctx, chat, oldestKnownMessage.Info.ID, 50)
+func (cli *Client) RequestHistory(ctx context.Context, chat types.JID, beforeMessageID types.MessageID, count int) error {
+	return cli.RequestHistoryBefore(ctx, &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat},
+		ID:            beforeMessageID,
+	}, count)
+}
+
+// RequestHistoryBefore asks the primary device to send older messages of a chat, starting from the message before
+// the given one, see RequestHistory. The chat, ID, IsFromMe and Timestamp fields of the message info are used.
+func (cli *Client) RequestHistoryBefore(ctx context.Context, before *types.MessageInfo, count int) error {
+	if cli.Store.ID == nil {
+		return ErrNotLoggedIn
+	}
+	if count <= 0 || count > MaxHistoryRequestCount {
+		count = MaxHistoryRequestCount
+	}
+	// HistorySyncOnDemandRequest {
+	//   string chatJid = 1; string oldestMsgId = 2; bool oldestMsgFromMe = 3;
+	//   int32 onDemandMsgCount = 4; int64 oldestMsgTimestampMs = 5;
+	// }
+	var request []byte
+	request = protowire.AppendTag(request, 1, protowire.BytesType)
+	request = protowire.AppendString(request, before.Chat.ToNonAD().String())
+	request = protowire.AppendTag(request, 2, protowire.BytesType)
+	request = protowire.AppendString(request, before.ID)
+	request = protowire.AppendTag(request, 3, protowire.VarintType)
+	request = protowire.AppendVarint(request, protowire.EncodeBool(before.IsFromMe))
+	request = protowire.AppendTag(request, 4, protowire.VarintType)
+	request = protowire.AppendVarint(request, uint64(count))
+	if !before.Timestamp.IsZero() {
+		request = protowire.AppendTag(request, 5, protowire.VarintType)
+		request = protowire.AppendVarint(request, uint64(before.Timestamp.UnixMilli()))
+	}
+	msg := buildPeerDataOperationRequest(peerDataOperationHistorySyncOnDemand, peerDataFieldHistorySyncOnDemand, request)
+	_, err := cli.SendMessage(ctx, cli.Store.ID.ToNonAD(), "", msg)
+	return err
+}
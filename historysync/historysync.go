@@ -0,0 +1,220 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package historysync contains a structured model of history sync payloads and a streaming reader for them.
+//
+// History sync blobs for accounts with a lot of history can be very large, so instead of unmarshaling the whole blob
+// at once, the Reader parses one conversation at a time:
+//
+//	reader := historysync.NewReader(bytes.NewReader(decompressedData), ownID)
+//	for {
+//		item, err := reader.Next()
+//		if err == io.EOF {
+//			break
+//		} else if err != nil {
+//			return err
+//		}
+//		if conv, ok := item.(*historysync.Conversation); ok {
+//			fmt.Println(conv.JID, "has", len(conv.Messages), "messages")
+//		}
+//	}
+package historysync
+
+import (
+	"fmt"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// SyncTypeOnDemand is the sync type of history syncs sent in response to Client.RequestHistory.
+// It's not in the protobuf definitions yet.
+const SyncTypeOnDemand waProto.HistorySync_HistorySyncType = 6
+
+// Conversation is a chat in a history sync payload.
+type Conversation struct {
+	JID  types.JID
+	Name string
+
+	LastMessageTimestamp time.Time
+	UnreadCount          int
+	MarkedAsUnread       bool
+	Archived             bool
+	Pinned               bool
+	ReadOnly             bool
+	// The time until which the chat is muted, or zero if it isn't muted.
+	MuteEndTime time.Time
+	// The disappearing message timer of the chat, or zero if disappearing messages are disabled.
+	DisappearingTimer time.Duration
+
+	// The participants of group chats.
+	Participants []Participant
+	// The messages in the conversation, usually from newest to oldest.
+	Messages []*Message
+
+	Raw *waProto.Conversation
+}
+
+// FindMessage returns the message with the given ID in the conversation, or nil if it's not found.
+func (conv *Conversation) FindMessage(id types.MessageID) *Message {
+	for _, msg := range conv.Messages {
+		if msg.Info.ID == id {
+			return msg
+		}
+	}
+	return nil
+}
+
+// Participant is a member of a group conversation.
+type Participant struct {
+	JID          types.JID
+	IsAdmin      bool
+	IsSuperAdmin bool
+}
+
+// Message is a single message in a history sync payload.
+//
+// The message content is not unwrapped, so it may be wrapped in e.g. an ephemeral or view-once message.
+// Use events.Message to unwrap it:
+//
+//	evt := (&events.Message{Info: msg.Info, RawMessage: msg.Message}).UnwrapRaw()
+type Message struct {
+	Info    types.MessageInfo
+	Message *waProto.Message
+	// The reactions to the message.
+	Reactions []Reaction
+
+	Raw *waProto.WebMessageInfo
+}
+
+// Reaction is a single user's reaction to a message in a history sync payload.
+type Reaction struct {
+	Sender    types.JID
+	Text      string
+	Timestamp time.Time
+}
+
+// Pushname is the push name of a user in a history sync payload.
+type Pushname struct {
+	JID  types.JID
+	Name string
+}
+
+// ParseConversation converts a history sync conversation into the structured model. The own JID is used as the
+// sender of messages sent by the user. Messages that can't be parsed are skipped.
+func ParseConversation(conv *waProto.Conversation, ownID types.JID) (*Conversation, error) {
+	chatJID, err := types.ParseJID(conv.GetId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse conversation JID: %w", err)
+	}
+	parsed := &Conversation{
+		JID:               chatJID,
+		Name:              conv.GetName(),
+		UnreadCount:       int(conv.GetUnreadCount()),
+		MarkedAsUnread:    conv.GetMarkedAsUnread(),
+		Archived:          conv.GetArchived(),
+		Pinned:            conv.GetPinned() > 0,
+		ReadOnly:          conv.GetReadOnly(),
+		DisappearingTimer: time.Duration(conv.GetEphemeralExpiration()) * time.Second,
+		Participants:      make([]Participant, 0, len(conv.GetParticipant())),
+		Messages:          make([]*Message, 0, len(conv.GetMessages())),
+		Raw:               conv,
+	}
+	if len(parsed.Name) == 0 {
+		parsed.Name = conv.GetDisplayName()
+	}
+	if ts := conv.GetLastMsgTimestamp(); ts > 0 {
+		parsed.LastMessageTimestamp = time.Unix(int64(ts), 0)
+	}
+	if ts := conv.GetMuteEndTime(); ts > 0 {
+		parsed.MuteEndTime = time.Unix(int64(ts), 0)
+	}
+	for _, participant := range conv.GetParticipant() {
+		jid, err := types.ParseJID(participant.GetUserJid())
+		if err != nil {
+			continue
+		}
+		parsed.Participants = append(parsed.Participants, Participant{
+			JID:          jid,
+			IsAdmin:      participant.GetRank() != waProto.GroupParticipant_REGULAR,
+			IsSuperAdmin: participant.GetRank() == waProto.GroupParticipant_SUPERADMIN,
+		})
+	}
+	for _, historyMsg := range conv.GetMessages() {
+		msg, err := ParseMessage(chatJID, ownID, historyMsg.GetMessage())
+		if err != nil {
+			continue
+		}
+		parsed.Messages = append(parsed.Messages, msg)
+	}
+	return parsed, nil
+}
+
+// ParseMessageInfo gets the message info from a WebMessageInfo. The own JID is used as the sender of messages
+// sent by the user.
+func ParseMessageInfo(chatJID, ownID types.JID, webMsg *waProto.WebMessageInfo) (types.MessageInfo, error) {
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJID,
+			IsFromMe: webMsg.GetKey().GetFromMe(),
+			IsGroup:  chatJID.Server == types.GroupServer,
+		},
+		ID:        webMsg.GetKey().GetId(),
+		PushName:  webMsg.GetPushName(),
+		Timestamp: time.Unix(int64(webMsg.GetMessageTimestamp()), 0),
+	}
+	var err error
+	if info.IsFromMe {
+		info.Sender = ownID.ToNonAD()
+	} else if chatJID.Server == types.DefaultUserServer {
+		info.Sender = chatJID
+	} else if webMsg.GetParticipant() != "" {
+		info.Sender, err = types.ParseJID(webMsg.GetParticipant())
+	} else if webMsg.GetKey().GetParticipant() != "" {
+		info.Sender, err = types.ParseJID(webMsg.GetKey().GetParticipant())
+	} else {
+		return info, fmt.Errorf("couldn't find sender of message %s", info.ID)
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to parse sender of message %s: %v", info.ID, err)
+	}
+	return info, nil
+}
+
+// ParseMessage converts a message in a history sync conversation into the structured model.
+func ParseMessage(chatJID, ownID types.JID, webMsg *waProto.WebMessageInfo) (*Message, error) {
+	info, err := ParseMessageInfo(chatJID, ownID, webMsg)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		Info:      info,
+		Message:   webMsg.GetMessage(),
+		Reactions: make([]Reaction, 0, len(webMsg.GetReactions())),
+		Raw:       webMsg,
+	}
+	for _, reaction := range webMsg.GetReactions() {
+		var sender types.JID
+		key := reaction.GetKey()
+		if key.GetFromMe() {
+			sender = ownID.ToNonAD()
+		} else if key.GetParticipant() != "" {
+			sender, _ = types.ParseJID(key.GetParticipant())
+		} else {
+			sender, _ = types.ParseJID(key.GetRemoteJid())
+		}
+		if sender.IsEmpty() {
+			continue
+		}
+		msg.Reactions = append(msg.Reactions, Reaction{
+			Sender:    sender,
+			Text:      reaction.GetText(),
+			Timestamp: time.UnixMilli(reaction.GetSenderTimestampMs()),
+		})
+	}
+	return msg, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package historysync_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/historysync"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestReader(t *testing.T) {
+	ownID := types.NewADJID("1111", 0, 5)
+	data, err := proto.Marshal(&waProto.HistorySync{
+		SyncType:   waProto.HistorySync_RECENT.Enum(),
+		ChunkOrder: proto.Uint32(3),
+		Conversations: []*waProto.Conversation{{
+			Id:                  proto.String("123-456@g.us"),
+			Name:                proto.String("Group"),
+			EphemeralExpiration: proto.Uint32(86400),
+			Participant: []*waProto.GroupParticipant{
+				{UserJid: proto.String("2222@s.whatsapp.net"), Rank: waProto.GroupParticipant_ADMIN.Enum()},
+			},
+			Messages: []*waProto.HistorySyncMsg{{Message: &waProto.WebMessageInfo{
+				Key:       &waProto.MessageKey{Id: proto.String("MSG1"), FromMe: proto.Bool(true)},
+				Message:   &waProto.Message{Conversation: proto.String("hello")},
+				Reactions: []*waProto.Reaction{{Key: &waProto.MessageKey{Participant: proto.String("2222@s.whatsapp.net")}, Text: proto.String("👍")}},
+			}}, {Message: &waProto.WebMessageInfo{
+				// No sender, should be skipped
+				Key: &waProto.MessageKey{Id: proto.String("MSG2")},
+			}}},
+		}},
+		Pushnames: []*waProto.Pushname{{Id: proto.String("2222@s.whatsapp.net"), Pushname: proto.String("Bob")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := historysync.NewReader(bytes.NewReader(data), ownID)
+	var items []interface{}
+	for {
+		item, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		items = append(items, item)
+	}
+	if reader.SyncType != waProto.HistorySync_RECENT || reader.ChunkOrder != 3 {
+		t.Errorf("Unexpected metadata %s/%d", reader.SyncType, reader.ChunkOrder)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+	conv, ok := items[0].(*historysync.Conversation)
+	if !ok || conv.Name != "Group" || conv.DisappearingTimer.Hours() != 24 || len(conv.Participants) != 1 || !conv.Participants[0].IsAdmin {
+		t.Fatalf("Unexpected conversation %+v", items[0])
+	}
+	msg := conv.FindMessage("MSG1")
+	if len(conv.Messages) != 1 || msg == nil || msg.Info.Sender != ownID.ToNonAD() || msg.Message.GetConversation() != "hello" {
+		t.Errorf("Unexpected messages %+v", conv.Messages)
+	} else if len(msg.Reactions) != 1 || msg.Reactions[0].Sender.User != "2222" || msg.Reactions[0].Text != "👍" {
+		t.Errorf("Unexpected reactions %+v", msg.Reactions)
+	}
+	if pushname, ok := items[1].(*historysync.Pushname); !ok || pushname.Name != "Bob" {
+		t.Errorf("Unexpected push name %+v", items[1])
+	}
+
+	truncated := historysync.NewReader(bytes.NewReader(data[:len(data)-3]), ownID)
+	for err == nil {
+		_, err = truncated.Next()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected unexpected EOF for truncated data, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package historysync
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// DefaultMaxItemSize is the default limit for the size of a single conversation or other item in a history sync blob.
+const DefaultMaxItemSize = 256 * 1024 * 1024
+
+// ErrItemTooLarge is returned by Reader.Next if an item is larger than Reader.MaxItemSize.
+var ErrItemTooLarge = errors.New("history sync item is too large")
+
+// Field numbers of the HistorySync protobuf message.
+const (
+	fieldSyncType      = 1
+	fieldConversations = 2
+	fieldStatusV3      = 3
+	fieldChunkOrder    = 5
+	fieldProgress      = 6
+	fieldPushnames     = 7
+)
+
+// Reader reads items from a history sync blob one at a time, so that the whole blob doesn't need to be in memory.
+type Reader struct {
+	// The sync type, chunk order and progress of the blob. They're filled as soon as they're read,
+	// which for the sync type is before any items, but the chunk order and progress are usually only
+	// known after all conversations have been read.
+	SyncType   waProto.HistorySync_HistorySyncType
+	ChunkOrder uint32
+	Progress   uint32
+
+	// MaxItemSize is the maximum size of a single item. Defaults to DefaultMaxItemSize.
+	MaxItemSize uint64
+
+	r     *bufio.Reader
+	ownID types.JID
+	buf   []byte
+}
+
+// NewReader creates a reader for decompressed history sync data. The own JID is used as the sender of messages
+// sent by the user.
+func NewReader(r io.Reader, ownID types.JID) *Reader {
+	return &Reader{
+		r:           bufio.NewReader(r),
+		ownID:       ownID,
+		MaxItemSize: DefaultMaxItemSize,
+	}
+}
+
+// NewCompressedReader creates a reader for zlib-compressed history sync data, i.e. a downloaded history sync blob.
+func NewCompressedReader(r io.Reader, ownID types.JID) (*Reader, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zlib reader: %w", err)
+	}
+	return NewReader(zr, ownID), nil
+}
+
+// Next returns the next item in the blob, which is a *Conversation, a *Message for status messages, or a *Pushname.
+// It returns io.EOF after the last item. Conversations and status messages that can't be parsed are skipped.
+func (hr *Reader) Next() (interface{}, error) {
+	for {
+		tag, err := binary.ReadUvarint(hr.r)
+		if err != nil {
+			// A clean EOF is only possible here between fields
+			return nil, err
+		}
+		num, typ := protowire.DecodeTag(tag)
+		switch typ {
+		case protowire.VarintType:
+			val, err := binary.ReadUvarint(hr.r)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			switch num {
+			case fieldSyncType:
+				hr.SyncType = waProto.HistorySync_HistorySyncType(val)
+			case fieldChunkOrder:
+				hr.ChunkOrder = uint32(val)
+			case fieldProgress:
+				hr.Progress = uint32(val)
+			}
+		case protowire.Fixed32Type:
+			if _, err = hr.r.Discard(4); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		case protowire.Fixed64Type:
+			if _, err = hr.r.Discard(8); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		case protowire.BytesType:
+			item, err := hr.readBytesField(num)
+			if err != nil || item != nil {
+				return item, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in history sync field %d", typ, num)
+		}
+	}
+}
+
+func (hr *Reader) readBytesField(num protowire.Number) (interface{}, error) {
+	length, err := binary.ReadUvarint(hr.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if num != fieldConversations && num != fieldStatusV3 && num != fieldPushnames {
+		// Skip fields that aren't exposed without buffering them
+		_, err = io.CopyN(io.Discard, hr.r, int64(length))
+		return nil, unexpectedEOF(err)
+	} else if length > hr.MaxItemSize {
+		return nil, fmt.Errorf("%w (field %d is %d bytes)", ErrItemTooLarge, num, length)
+	}
+	if uint64(cap(hr.buf)) < length {
+		hr.buf = make([]byte, length)
+	}
+	data := hr.buf[:length]
+	if _, err = io.ReadFull(hr.r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch num {
+	case fieldConversations:
+		var conv waProto.Conversation
+		if err = proto.Unmarshal(data, &conv); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conversation: %w", err)
+		}
+		parsed, err := ParseConversation(&conv, hr.ownID)
+		if err != nil {
+			// Conversations with invalid JIDs are skipped like invalid messages inside conversations
+			return nil, nil
+		}
+		return parsed, nil
+	case fieldStatusV3:
+		var webMsg waProto.WebMessageInfo
+		if err = proto.Unmarshal(data, &webMsg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal status message: %w", err)
+		}
+		parsed, err := ParseMessage(types.StatusBroadcastJID, hr.ownID, &webMsg)
+		if err != nil {
+			return nil, nil
+		}
+		return parsed, nil
+	default:
+		var pushname waProto.Pushname
+		if err = proto.Unmarshal(data, &pushname); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal push name: %w", err)
+		}
+		jid, _ := types.ParseJID(pushname.GetId())
+		return &Pushname{JID: jid, Name: pushname.GetPushname()}, nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -25,18 +25,46 @@ var (
 	KeepAliveIntervalMax = 30 * time.Second
 )
 
+// LastPingLatency returns the round-trip time of the latest successful keepalive ping,
+// or zero if no ping has succeeded yet.
+func (cli *Client) LastPingLatency() time.Duration {
+	latency, _ := cli.lastPingLatency.Load().(time.Duration)
+	return latency
+}
+
+func (cli *Client) keepAliveInterval() time.Duration {
+	min, max := cli.KeepAliveIntervalMin, cli.KeepAliveIntervalMax
+	if min <= 0 {
+		min = KeepAliveIntervalMin
+	}
+	if max <= 0 {
+		max = KeepAliveIntervalMax
+	}
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
+
+func (cli *Client) keepAliveResponseDeadline() time.Duration {
+	if cli.KeepAliveResponseDeadline <= 0 {
+		return KeepAliveResponseDeadline
+	}
+	return cli.KeepAliveResponseDeadline
+}
+
 func (cli *Client) keepAliveLoop(ctx context.Context) {
 	var lastSuccess time.Time
 	var errorCount int
 	for {
-		interval := rand.Int63n(KeepAliveIntervalMax.Milliseconds()-KeepAliveIntervalMin.Milliseconds()) + KeepAliveIntervalMin.Milliseconds()
 		select {
-		case <-time.After(time.Duration(interval) * time.Millisecond):
+		case <-time.After(cli.keepAliveInterval()):
 			isSuccess, shouldContinue := cli.sendKeepAlive(ctx)
 			if !shouldContinue {
 				return
 			} else if !isSuccess {
 				errorCount++
+				cli.setStateFrom(types.ConnectionStateOnline, types.ConnectionStateDegraded, ErrKeepAliveTimedOut)
 				go cli.dispatchEvent(&events.KeepAliveTimeout{
 					ErrorCount:  errorCount,
 					LastSuccess: lastSuccess,
@@ -44,6 +72,7 @@ func (cli *Client) keepAliveLoop(ctx context.Context) {
 			} else {
 				if errorCount > 0 {
 					errorCount = 0
+					cli.setStateFrom(types.ConnectionStateDegraded, types.ConnectionStateOnline, nil)
 					go cli.dispatchEvent(&events.KeepAliveRestored{})
 				}
 				lastSuccess = time.Now()
@@ -55,6 +84,7 @@ func (cli *Client) keepAliveLoop(ctx context.Context) {
 }
 
 func (cli *Client) sendKeepAlive(ctx context.Context) (isSuccess, shouldContinue bool) {
+	start := time.Now()
 	respCh, err := cli.sendIQAsync(infoQuery{
 		Namespace: "w:p",
 		Type:      "get",
@@ -67,9 +97,11 @@ func (cli *Client) sendKeepAlive(ctx context.Context) (isSuccess, shouldContinue
 	}
 	select {
 	case <-respCh:
-		// All good
+		latency := time.Since(start)
+		cli.lastPingLatency.Store(latency)
+		go cli.dispatchEvent(&events.KeepAliveLatency{Latency: latency})
 		return true, true
-	case <-time.After(KeepAliveResponseDeadline):
+	case <-time.After(cli.keepAliveResponseDeadline()):
 		cli.Log.Warnf("Keepalive timed out")
 		return false, true
 	case <-ctx.Done():
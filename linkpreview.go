@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/util/linkpreview"
+)
+
+// AttachLinkPreview returns a copy of the given text message with a link preview for the first URL in the text.
+// Plain conversation messages are converted to extended text messages. If the message isn't a text message,
+// already has a preview, or doesn't contain a URL, it's returned as-is.
+//
+// Client.LinkPreviews is used for generating the preview, or a default generator if it's not set. SendMessage calls
+// this automatically when Client.LinkPreviews is set, so this is only needed when previews are opt-in per message.
+//
+//	msg, err := cli.AttachLinkPreview(ctx, &waProto.Message{Conversation: proto.String("Look at https://example.com")})
+func (cli *Client) AttachLinkPreview(ctx context.Context, message *waProto.Message) (*waProto.Message, error) {
+	var text string
+	if message.Conversation != nil {
+		text = message.GetConversation()
+	} else if ext := message.GetExtendedTextMessage(); ext != nil && len(ext.GetMatchedText()) == 0 {
+		text = ext.GetText()
+	} else {
+		return message, nil
+	}
+	gen := cli.LinkPreviews
+	if gen == nil {
+		gen = &linkpreview.Generator{}
+	}
+	preview, err := gen.Generate(ctx, text)
+	if errors.Is(err, linkpreview.ErrNoURL) {
+		return message, nil
+	} else if err != nil {
+		return message, err
+	}
+	message = proto.Clone(message).(*waProto.Message)
+	if message.Conversation != nil {
+		message.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: message.Conversation}
+		message.Conversation = nil
+	}
+	ext := message.ExtendedTextMessage
+	ext.MatchedText = proto.String(preview.MatchedText)
+	ext.CanonicalUrl = proto.String(preview.URL)
+	ext.PreviewType = waProto.ExtendedTextMessage_NONE.Enum()
+	if len(preview.Title) > 0 {
+		ext.Title = proto.String(preview.Title)
+	}
+	if len(preview.Description) > 0 {
+		ext.Description = proto.String(preview.Description)
+	}
+	if len(preview.Thumbnail) > 0 {
+		ext.JpegThumbnail = preview.Thumbnail
+		ext.ThumbnailWidth = proto.Uint32(uint32(preview.ThumbnailWidth))
+		ext.ThumbnailHeight = proto.Uint32(uint32(preview.ThumbnailHeight))
+	}
+	return message, nil
+}
+
+// attachLinkPreview adds a link preview to outgoing text messages if Client.LinkPreviews is set.
+// Failing to generate a preview isn't fatal, the message is just sent without one.
+func (cli *Client) attachLinkPreview(ctx context.Context, message *waProto.Message) *waProto.Message {
+	if cli.LinkPreviews == nil {
+		return message
+	}
+	withPreview, err := cli.AttachLinkPreview(ctx, message)
+	if err != nil {
+		cli.Log.Debugf("Failed to generate link preview: %v", err)
+	}
+	return withPreview
+}
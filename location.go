@@ -0,0 +1,224 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// BuildLocation builds a static location message. The name and address are optional.
+//
+//	resp, err := cli.SendMessage(context.Background(), chat, "", cli.BuildLocation(60.1699, 24.9384, "Helsinki", ""))
+func (cli *Client) BuildLocation(latitude, longitude float64, name, address string) *waProto.Message {
+	msg := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(latitude),
+		DegreesLongitude: proto.Float64(longitude),
+	}
+	if len(name) > 0 {
+		msg.Name = proto.String(name)
+	}
+	if len(address) > 0 {
+		msg.Address = proto.String(address)
+	}
+	return &waProto.Message{LocationMessage: msg}
+}
+
+// LiveLocation is a single position in a live location share.
+type LiveLocation struct {
+	Latitude         float64
+	Longitude        float64
+	AccuracyInMeters uint32
+	SpeedInMps       float32
+	// The direction of the movement in degrees clockwise from magnetic north.
+	Heading uint32
+}
+
+// LiveLocationOptions contains optional parameters for StartLiveLocation.
+type LiveLocationOptions struct {
+	// The caption shown with the live location.
+	Caption string
+	// How often the current position is sent. Defaults to 30 seconds.
+	UpdateInterval time.Duration
+	// How long to share the location for. Defaults to 15 minutes. The session stops automatically afterwards.
+	Duration time.Duration
+}
+
+// Defaults for LiveLocationOptions.
+const (
+	DefaultLiveLocationUpdateInterval = 30 * time.Second
+	DefaultLiveLocationDuration       = 15 * time.Minute
+)
+
+// LiveLocationSession is an ongoing live location share started with StartLiveLocation.
+type LiveLocationSession struct {
+	cli *Client
+
+	// The chat that the location is shared in.
+	Chat types.JID
+	// The ID of the initial live location message.
+	ID types.MessageID
+	// When the share was started.
+	Started time.Time
+
+	caption  string
+	interval time.Duration
+
+	lock     sync.Mutex
+	current  LiveLocation
+	sequence int64
+	lastErr  error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// StartLiveLocation sends a live location message to the given chat and returns a session that
+// keeps sending the latest position given to LiveLocationSession.Update until it's stopped.
+//
+//	session, err := cli.StartLiveLocation(ctx, chat, whatsmeow.LiveLocation{Latitude: 60.1699, Longitude: 24.9384}, nil)
+//	// handle error
+//	session.Update(whatsmeow.LiveLocation{Latitude: 60.1700, Longitude: 24.9390})
+//	// later
+//	session.Stop()
+func (cli *Client) StartLiveLocation(ctx context.Context, chat types.JID, location LiveLocation, opts *LiveLocationOptions) (*LiveLocationSession, error) {
+	if opts == nil {
+		opts = &LiveLocationOptions{}
+	}
+	session := &LiveLocationSession{
+		cli:      cli,
+		Chat:     chat,
+		Started:  time.Now(),
+		caption:  opts.Caption,
+		interval: opts.UpdateInterval,
+		current:  location,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if session.interval <= 0 {
+		session.interval = DefaultLiveLocationUpdateInterval
+	}
+	duration := opts.Duration
+	if duration <= 0 {
+		duration = DefaultLiveLocationDuration
+	}
+	resp, err := cli.SendMessage(ctx, chat, "", session.buildMessage(location, 0))
+	if err != nil {
+		return nil, err
+	}
+	session.ID = resp.ID
+	go session.loop(duration)
+	return session, nil
+}
+
+func (lls *LiveLocationSession) buildMessage(location LiveLocation, sequence int64) *waProto.Message {
+	msg := &waProto.LiveLocationMessage{
+		DegreesLatitude:  proto.Float64(location.Latitude),
+		DegreesLongitude: proto.Float64(location.Longitude),
+		SequenceNumber:   proto.Int64(sequence),
+		TimeOffset:       proto.Uint32(uint32(time.Since(lls.Started).Seconds())),
+	}
+	if location.AccuracyInMeters > 0 {
+		msg.AccuracyInMeters = proto.Uint32(location.AccuracyInMeters)
+	}
+	if location.SpeedInMps > 0 {
+		msg.SpeedInMps = proto.Float32(location.SpeedInMps)
+		msg.DegreesClockwiseFromMagneticNorth = proto.Uint32(location.Heading)
+	}
+	if len(lls.caption) > 0 {
+		msg.Caption = proto.String(lls.caption)
+	}
+	return &waProto.Message{LiveLocationMessage: msg}
+}
+
+func (lls *LiveLocationSession) loop(duration time.Duration) {
+	defer close(lls.done)
+	ticker := time.NewTicker(lls.interval)
+	defer ticker.Stop()
+	expire := time.After(duration)
+	for {
+		select {
+		case <-ticker.C:
+			lls.sendUpdate()
+		case <-expire:
+			return
+		case <-lls.stop:
+			return
+		}
+	}
+}
+
+func (lls *LiveLocationSession) sendUpdate() {
+	lls.lock.Lock()
+	lls.sequence++
+	msg := lls.buildMessage(lls.current, lls.sequence)
+	lls.lock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), lls.interval)
+	defer cancel()
+	_, err := lls.cli.SendMessage(ctx, lls.Chat, "", msg)
+	if err != nil {
+		lls.cli.Log.Warnf("Failed to send live location update to %s: %v", lls.Chat, err)
+	}
+	lls.lock.Lock()
+	lls.lastErr = err
+	lls.lock.Unlock()
+}
+
+// Update changes the current position. It's sent to the chat on the next update interval.
+func (lls *LiveLocationSession) Update(location LiveLocation) {
+	lls.lock.Lock()
+	lls.current = location
+	lls.lock.Unlock()
+}
+
+// Err returns the error from the latest update, or nil if it was sent successfully.
+func (lls *LiveLocationSession) Err() error {
+	lls.lock.Lock()
+	defer lls.lock.Unlock()
+	return lls.lastErr
+}
+
+// Done returns a channel that is closed when the session ends, either because Stop was called
+// or because the duration given to StartLiveLocation ran out.
+func (lls *LiveLocationSession) Done() <-chan struct{} {
+	return lls.done
+}
+
+// Stop stops sending updates and waits for an in-progress update to finish.
+//
+// There's no separate message for ending a share: recipients stop seeing the location as live
+// when they stop receiving updates.
+func (lls *LiveLocationSession) Stop() {
+	lls.stopOnce.Do(func() {
+		close(lls.stop)
+	})
+	<-lls.done
+}
+
+func (cli *Client) handleLiveLocationMessage(evt *events.Message) {
+	msg := evt.Message.GetLiveLocationMessage()
+	cli.dispatchEvent(&events.LiveLocationUpdate{
+		Info:             evt.Info,
+		Initial:          msg.GetSequenceNumber() == 0 && evt.Info.Chat != types.LocationBroadcastJID,
+		Latitude:         msg.GetDegreesLatitude(),
+		Longitude:        msg.GetDegreesLongitude(),
+		AccuracyInMeters: msg.GetAccuracyInMeters(),
+		SpeedInMps:       msg.GetSpeedInMps(),
+		Heading:          msg.GetDegreesClockwiseFromMagneticNorth(),
+		Caption:          msg.GetCaption(),
+		SequenceNumber:   msg.GetSequenceNumber(),
+		TimeOffset:       time.Duration(msg.GetTimeOffset()) * time.Second,
+	})
+}
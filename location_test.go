@@ -0,0 +1,128 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestBuildLocation(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	msg := cli.BuildLocation(60.1699, 24.9384, "Helsinki", "")
+	expected := &waProto.Message{LocationMessage: &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(60.1699),
+		DegreesLongitude: proto.Float64(24.9384),
+		Name:             proto.String("Helsinki"),
+	}}
+	if !proto.Equal(msg, expected) {
+		t.Errorf("Unexpected location message %v", msg)
+	}
+}
+
+func newTestLiveLocationSession(cli *Client, interval time.Duration) *LiveLocationSession {
+	return &LiveLocationSession{
+		cli:      cli,
+		Chat:     types.NewJID("2222", types.DefaultUserServer),
+		Started:  time.Now().Add(-time.Minute),
+		caption:  "On my way",
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func TestLiveLocationBuildMessage(t *testing.T) {
+	session := newTestLiveLocationSession(nil, time.Second)
+	msg := session.buildMessage(LiveLocation{Latitude: 1.5, Longitude: 2.5, AccuracyInMeters: 10}, 3).GetLiveLocationMessage()
+	if msg.GetDegreesLatitude() != 1.5 || msg.GetDegreesLongitude() != 2.5 || msg.GetAccuracyInMeters() != 10 {
+		t.Errorf("Unexpected position in %v", msg)
+	} else if msg.GetSequenceNumber() != 3 || msg.GetCaption() != "On my way" {
+		t.Errorf("Unexpected sequence number or caption in %v", msg)
+	} else if msg.GetTimeOffset() < 60 {
+		t.Errorf("Expected time offset to be at least 60 seconds, got %d", msg.GetTimeOffset())
+	} else if msg.SpeedInMps != nil || msg.DegreesClockwiseFromMagneticNorth != nil {
+		t.Error("Expected no speed or heading when not moving")
+	}
+	msg = session.buildMessage(LiveLocation{SpeedInMps: 1.5, Heading: 90}, 4).GetLiveLocationMessage()
+	if msg.GetSpeedInMps() != 1.5 || msg.DegreesClockwiseFromMagneticNorth == nil || msg.GetDegreesClockwiseFromMagneticNorth() != 90 {
+		t.Errorf("Expected speed and heading to be set, got %v", msg)
+	}
+}
+
+func TestLiveLocationSessionLoop(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	session := newTestLiveLocationSession(NewClient(device, nil), 10*time.Millisecond)
+	go session.loop(time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	session.Stop()
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("Expected session to be done after Stop")
+	}
+	session.lock.Lock()
+	sequence := session.sequence
+	session.lock.Unlock()
+	if sequence == 0 {
+		t.Error("Expected updates to be sent on every interval")
+	} else if session.Err() == nil {
+		t.Error("Expected the update error to be stored when not connected")
+	}
+	// Stopping twice must not panic
+	session.Stop()
+
+	expiring := newTestLiveLocationSession(session.cli, time.Hour)
+	go expiring.loop(10 * time.Millisecond)
+	select {
+	case <-expiring.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Session didn't stop after the duration ran out")
+	}
+}
+
+func TestHandleLiveLocationMessage(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	var updates []*events.LiveLocationUpdate
+	cli.AddEventHandler(func(evt interface{}) {
+		if update, ok := evt.(*events.LiveLocationUpdate); ok {
+			updates = append(updates, update)
+		}
+	})
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	for _, msg := range []struct {
+		chat     types.JID
+		sequence int64
+	}{{chat, 0}, {types.LocationBroadcastJID, 0}, {chat, 5}} {
+		cli.handleLiveLocationMessage(&events.Message{
+			Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: msg.chat}},
+			Message: &waProto.Message{LiveLocationMessage: &waProto.LiveLocationMessage{
+				DegreesLatitude: proto.Float64(1),
+				SequenceNumber:  proto.Int64(msg.sequence),
+				TimeOffset:      proto.Uint32(90),
+			}},
+		})
+	}
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates, got %d", len(updates))
+	}
+	if !updates[0].Initial || updates[1].Initial || updates[2].Initial {
+		t.Errorf("Expected only the first message in the chat to be initial, got %t, %t, %t", updates[0].Initial, updates[1].Initial, updates[2].Initial)
+	}
+	if updates[2].SequenceNumber != 5 || updates[2].TimeOffset != 90*time.Second || updates[2].Latitude != 1 {
+		t.Errorf("Unexpected update %+v", updates[2])
+	}
+}
@@ -66,7 +66,7 @@ func main() {
 		log.Errorf("Failed to connect to database: %v", err)
 		return
 	}
-	device, err := storeContainer.GetFirstDevice()
+	device, err := storeContainer.GetFirstDevice(context.Background())
 	if err != nil {
 		log.Errorf("Failed to get device: %v", err)
 		return
@@ -0,0 +1,206 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MaxCachedUploadAge is the maximum age of cached uploads that Upload reuses. Media is deleted from the WhatsApp
+// servers some time after it's uploaded, so old uploads are uploaded again instead.
+var MaxCachedUploadAge = 7 * 24 * time.Hour
+
+// CachedUpload is an upload stored in a MediaCache.
+type CachedUpload struct {
+	UploadResponse
+	MediaType  MediaType
+	UploadedAt time.Time
+}
+
+// MediaCache stores uploaded and downloaded media keyed by the SHA-256 hash of the plaintext file, see Client.MediaCache.
+//
+// The get methods should return nil without an error if the item isn't in the cache. The returned data must not be
+// modified by the caller.
+type MediaCache interface {
+	GetUpload(ctx context.Context, fileSHA256 []byte, mediaType MediaType) (*CachedUpload, error)
+	PutUpload(ctx context.Context, upload *CachedUpload) error
+	GetDownload(ctx context.Context, fileSHA256 []byte) ([]byte, error)
+	PutDownload(ctx context.Context, fileSHA256 []byte, data []byte) error
+}
+
+// MemoryMediaCache is an in-memory MediaCache that evicts the least recently used items when the total size of the
+// cached data would exceed the maximum size.
+type MemoryMediaCache struct {
+	maxSize int64
+	size    int64
+	items   map[memoryMediaCacheKey]*list.Element
+	lru     *list.List
+	lock    sync.Mutex
+}
+
+var _ MediaCache = (*MemoryMediaCache)(nil)
+
+type memoryMediaCacheKey struct {
+	hash      [32]byte
+	mediaType MediaType
+	upload    bool
+}
+
+type memoryMediaCacheItem struct {
+	key    memoryMediaCacheKey
+	size   int64
+	upload *CachedUpload
+	data   []byte
+}
+
+// NewMemoryMediaCache creates an in-memory media cache that holds up to maxSize bytes.
+//
+//	cli.MediaCache = whatsmeow.NewMemoryMediaCache(256 * 1024 * 1024)
+func NewMemoryMediaCache(maxSize int64) *MemoryMediaCache {
+	return &MemoryMediaCache{
+		maxSize: maxSize,
+		items:   make(map[memoryMediaCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Size returns the total size of the cached items in bytes.
+func (mc *MemoryMediaCache) Size() int64 {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	return mc.size
+}
+
+func (mc *MemoryMediaCache) get(key memoryMediaCacheKey) *memoryMediaCacheItem {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	elem, ok := mc.items[key]
+	if !ok {
+		return nil
+	}
+	mc.lru.MoveToFront(elem)
+	return elem.Value.(*memoryMediaCacheItem)
+}
+
+func (mc *MemoryMediaCache) put(item *memoryMediaCacheItem) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	if item.size > mc.maxSize {
+		return
+	}
+	if elem, ok := mc.items[item.key]; ok {
+		mc.size -= elem.Value.(*memoryMediaCacheItem).size
+		mc.lru.Remove(elem)
+	}
+	for mc.size+item.size > mc.maxSize {
+		oldest := mc.lru.Back()
+		oldestItem := oldest.Value.(*memoryMediaCacheItem)
+		mc.lru.Remove(oldest)
+		delete(mc.items, oldestItem.key)
+		mc.size -= oldestItem.size
+	}
+	mc.items[item.key] = mc.lru.PushFront(item)
+	mc.size += item.size
+}
+
+func (mc *MemoryMediaCache) GetUpload(_ context.Context, fileSHA256 []byte, mediaType MediaType) (*CachedUpload, error) {
+	if len(fileSHA256) != 32 {
+		return nil, nil
+	}
+	item := mc.get(memoryMediaCacheKey{hash: *(*[32]byte)(fileSHA256), mediaType: mediaType, upload: true})
+	if item == nil {
+		return nil, nil
+	}
+	return item.upload, nil
+}
+
+func (mc *MemoryMediaCache) PutUpload(_ context.Context, upload *CachedUpload) error {
+	if len(upload.FileSHA256) != 32 {
+		return nil
+	}
+	size := int64(len(upload.URL) + len(upload.DirectPath) + len(upload.MediaKey) + len(upload.FileEncSHA256) +
+		len(upload.FileSHA256) + len(upload.JPEGThumbnail))
+	mc.put(&memoryMediaCacheItem{
+		key:    memoryMediaCacheKey{hash: *(*[32]byte)(upload.FileSHA256), mediaType: upload.MediaType, upload: true},
+		size:   size,
+		upload: upload,
+	})
+	return nil
+}
+
+func (mc *MemoryMediaCache) GetDownload(_ context.Context, fileSHA256 []byte) ([]byte, error) {
+	if len(fileSHA256) != 32 {
+		return nil, nil
+	}
+	item := mc.get(memoryMediaCacheKey{hash: *(*[32]byte)(fileSHA256)})
+	if item == nil {
+		return nil, nil
+	}
+	return item.data, nil
+}
+
+func (mc *MemoryMediaCache) PutDownload(_ context.Context, fileSHA256 []byte, data []byte) error {
+	if len(fileSHA256) != 32 {
+		return nil
+	}
+	mc.put(&memoryMediaCacheItem{
+		key:  memoryMediaCacheKey{hash: *(*[32]byte)(fileSHA256)},
+		size: int64(len(data)),
+		data: data,
+	})
+	return nil
+}
+
+// getCachedUpload returns a previous upload of the same file if Client.MediaCache is set and the upload isn't too old.
+func (cli *Client) getCachedUpload(ctx context.Context, fileSHA256 []byte, mediaType MediaType) *UploadResponse {
+	if cli.MediaCache == nil {
+		return nil
+	}
+	cached, err := cli.MediaCache.GetUpload(ctx, fileSHA256, mediaType)
+	if err != nil {
+		cli.Log.Warnf("Failed to get cached upload: %v", err)
+		return nil
+	} else if cached == nil || time.Since(cached.UploadedAt) > MaxCachedUploadAge {
+		return nil
+	}
+	return &cached.UploadResponse
+}
+
+func (cli *Client) cacheUpload(ctx context.Context, resp UploadResponse, mediaType MediaType) {
+	if cli.MediaCache == nil {
+		return
+	}
+	err := cli.MediaCache.PutUpload(ctx, &CachedUpload{UploadResponse: resp, MediaType: mediaType, UploadedAt: time.Now()})
+	if err != nil {
+		cli.Log.Warnf("Failed to cache upload: %v", err)
+	}
+}
+
+func (cli *Client) getCachedDownload(ctx context.Context, fileSHA256 []byte) []byte {
+	if cli.MediaCache == nil || len(fileSHA256) != 32 {
+		return nil
+	}
+	data, err := cli.MediaCache.GetDownload(ctx, fileSHA256)
+	if err != nil {
+		cli.Log.Warnf("Failed to get cached download: %v", err)
+		return nil
+	}
+	return data
+}
+
+func (cli *Client) cacheDownload(ctx context.Context, fileSHA256 []byte, data []byte) {
+	// Downloads are only verified if the message contains the plaintext hash
+	if cli.MediaCache == nil || len(fileSHA256) != 32 {
+		return
+	}
+	if err := cli.MediaCache.PutDownload(ctx, fileSHA256, data); err != nil {
+		cli.Log.Warnf("Failed to cache download: %v", err)
+	}
+}
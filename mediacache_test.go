@@ -0,0 +1,50 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/insomnius/whatsmeow"
+)
+
+func TestMemoryMediaCache(t *testing.T) {
+	ctx := context.Background()
+	cache := whatsmeow.NewMemoryMediaCache(10)
+	hashes := make([][]byte, 3)
+	for i := range hashes {
+		hash := sha256.Sum256([]byte{byte(i)})
+		hashes[i] = hash[:]
+	}
+	_ = cache.PutDownload(ctx, hashes[0], []byte("aaaa"))
+	_ = cache.PutDownload(ctx, hashes[1], []byte("bbbb"))
+	// Using the first item makes the second one the least recently used
+	_, _ = cache.GetDownload(ctx, hashes[0])
+	_ = cache.PutDownload(ctx, hashes[2], []byte("cccc"))
+	for i, expected := range []string{"aaaa", "", "cccc"} {
+		if data, _ := cache.GetDownload(ctx, hashes[i]); string(data) != expected {
+			t.Errorf("Expected item %d to be %q, got %q", i, expected, data)
+		}
+	}
+	if size := cache.Size(); size != 8 {
+		t.Errorf("Expected cache size to be 8, got %d", size)
+	}
+
+	cache = whatsmeow.NewMemoryMediaCache(1024)
+	_ = cache.PutUpload(ctx, &whatsmeow.CachedUpload{
+		UploadResponse: whatsmeow.UploadResponse{FileSHA256: hashes[1]},
+		MediaType:      whatsmeow.MediaImage,
+	})
+	if upload, _ := cache.GetUpload(ctx, hashes[1], whatsmeow.MediaImage); upload == nil {
+		t.Errorf("Expected upload to be cached")
+	}
+	if upload, _ := cache.GetUpload(ctx, hashes[1], whatsmeow.MediaDocument); upload != nil {
+		t.Errorf("Expected upload with another media type not to be cached")
+	}
+}
@@ -22,6 +22,8 @@ import (
 // MediaConnHost represents a single host to download media from.
 type MediaConnHost struct {
 	Hostname string
+	// Fallback is true if the server marked the host as a fallback, which should only be used if the others fail.
+	Fallback bool
 	//IPs      []MediaConnIP
 }
 
@@ -40,6 +42,21 @@ func (mc *MediaConn) Expiry() time.Time {
 	return mc.FetchedAt.Add(time.Duration(mc.TTL) * time.Second)
 }
 
+// MediaHostConfig controls which media servers are used for uploading and downloading media, see Client.MediaHosts.
+type MediaHostConfig struct {
+	// Hosts are custom media hosts that are tried before the ones provided by the server.
+	Hosts []string
+	// IgnoreServerHosts makes the client only use the custom hosts.
+	IgnoreServerHosts bool
+	// ExcludedHosts are hosts provided by the server that should never be used, e.g. because they're blocked
+	// in the user's region.
+	ExcludedHosts []string
+	// FailureCooldown is how long a host that failed is moved to the end of the list. Defaults to 5 minutes.
+	FailureCooldown time.Duration
+}
+
+const defaultMediaHostFailureCooldown = 5 * time.Minute
+
 func (cli *Client) refreshMediaConn(force bool) (*MediaConn, error) {
 	cli.mediaConnLock.Lock()
 	defer cli.mediaConnLock.Unlock()
@@ -84,6 +101,7 @@ func (cli *Client) queryMediaConn() (*MediaConn, error) {
 		cag := child.AttrGetter()
 		mc.Hosts = append(mc.Hosts, MediaConnHost{
 			Hostname: cag.String("hostname"),
+			Fallback: cag.OptionalString("type") == "fallback",
 		})
 		if !cag.OK() {
 			return nil, fmt.Errorf("failed to parse media connection host: %+v", ag.Errors)
@@ -91,3 +109,70 @@ func (cli *Client) queryMediaConn() (*MediaConn, error) {
 	}
 	return &mc, nil
 }
+
+// getMediaHosts returns the media hosts to use in the order they should be tried: custom hosts first, then the primary
+// and fallback hosts provided by the server. Hosts that failed recently are moved to the end.
+func (cli *Client) getMediaHosts() (*MediaConn, []string, error) {
+	mediaConn, err := cli.refreshMediaConn(false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refresh media connections: %w", err)
+	}
+	config := cli.MediaHosts
+	if config == nil {
+		config = &MediaHostConfig{}
+	}
+	excluded := make(map[string]struct{}, len(config.ExcludedHosts))
+	for _, host := range config.ExcludedHosts {
+		excluded[host] = struct{}{}
+	}
+	hosts := make([]string, 0, len(config.Hosts)+len(mediaConn.Hosts))
+	addHost := func(host string) {
+		if _, skip := excluded[host]; !skip && len(host) > 0 {
+			excluded[host] = struct{}{}
+			hosts = append(hosts, host)
+		}
+	}
+	for _, host := range config.Hosts {
+		addHost(host)
+	}
+	if !config.IgnoreServerHosts {
+		for _, fallback := range []bool{false, true} {
+			for _, host := range mediaConn.Hosts {
+				if host.Fallback == fallback {
+					addHost(host.Hostname)
+				}
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, nil, ErrNoMediaHosts
+	}
+
+	cooldown := config.FailureCooldown
+	if cooldown <= 0 {
+		cooldown = defaultMediaHostFailureCooldown
+	}
+	cli.mediaHostFailuresLock.Lock()
+	ordered := make([]string, 0, len(hosts))
+	var failed []string
+	for _, host := range hosts {
+		if failedAt, ok := cli.mediaHostFailures[host]; ok && time.Since(failedAt) < cooldown {
+			failed = append(failed, host)
+		} else {
+			ordered = append(ordered, host)
+		}
+	}
+	cli.mediaHostFailuresLock.Unlock()
+	return mediaConn, append(ordered, failed...), nil
+}
+
+// reportMediaHost records whether a request to a media host worked, which is used to order hosts in getMediaHosts.
+func (cli *Client) reportMediaHost(host string, failed bool) {
+	cli.mediaHostFailuresLock.Lock()
+	if failed {
+		cli.mediaHostFailures[host] = time.Now()
+	} else {
+		delete(cli.mediaHostFailures, host)
+	}
+	cli.mediaHostFailuresLock.Unlock()
+}
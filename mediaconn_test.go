@@ -0,0 +1,123 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+func newMediaHostTestClient(hosts ...MediaConnHost) *Client {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.mediaConnCache = &MediaConn{FetchedAt: time.Now(), TTL: 3600, Hosts: hosts}
+	return cli
+}
+
+func TestGetMediaHosts(t *testing.T) {
+	serverHosts := []MediaConnHost{
+		{Hostname: "fallback.example", Fallback: true},
+		{Hostname: "primary1.example"},
+		{Hostname: "primary2.example"},
+	}
+	tests := []struct {
+		name     string
+		config   *MediaHostConfig
+		expected []string
+	}{
+		{"default", nil, []string{"primary1.example", "primary2.example", "fallback.example"}},
+		{"custom first", &MediaHostConfig{Hosts: []string{"custom.example", "primary2.example"}}, []string{"custom.example", "primary2.example", "primary1.example", "fallback.example"}},
+		{"excluded", &MediaHostConfig{ExcludedHosts: []string{"primary1.example", "fallback.example"}}, []string{"primary2.example"}},
+		{"only custom", &MediaHostConfig{Hosts: []string{"custom.example"}, IgnoreServerHosts: true}, []string{"custom.example"}},
+	}
+	for _, test := range tests {
+		cli := newMediaHostTestClient(serverHosts...)
+		cli.MediaHosts = test.config
+		_, hosts, err := cli.getMediaHosts()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !reflect.DeepEqual(hosts, test.expected) {
+			t.Errorf("%s: expected hosts %v, got %v", test.name, test.expected, hosts)
+		}
+	}
+
+	cli := newMediaHostTestClient(serverHosts...)
+	cli.MediaHosts = &MediaHostConfig{IgnoreServerHosts: true}
+	if _, _, err := cli.getMediaHosts(); !errors.Is(err, ErrNoMediaHosts) {
+		t.Errorf("Expected ErrNoMediaHosts, got %v", err)
+	}
+}
+
+func TestReportMediaHost(t *testing.T) {
+	cli := newMediaHostTestClient(MediaConnHost{Hostname: "a.example"}, MediaConnHost{Hostname: "b.example"}, MediaConnHost{Hostname: "c.example"})
+	cli.MediaHosts = &MediaHostConfig{FailureCooldown: time.Minute}
+	checkOrder := func(expected ...string) {
+		t.Helper()
+		if _, hosts, err := cli.getMediaHosts(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		} else if !reflect.DeepEqual(hosts, expected) {
+			t.Errorf("Expected hosts %v, got %v", expected, hosts)
+		}
+	}
+
+	cli.reportMediaHost("a.example", true)
+	cli.reportMediaHost("b.example", true)
+	checkOrder("c.example", "a.example", "b.example")
+	cli.reportMediaHost("a.example", false)
+	checkOrder("a.example", "c.example", "b.example")
+
+	// Failures older than the cooldown don't affect the order anymore
+	cli.mediaHostFailures["b.example"] = time.Now().Add(-2 * time.Minute)
+	checkOrder("a.example", "b.example", "c.example")
+}
+
+func TestDownloadMediaWithPath_Failover(t *testing.T) {
+	var badRequests int
+	bad := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badRequests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	var file []byte
+	good := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(file)
+	}))
+	defer good.Close()
+	plaintext, file, msg := encryptTestMedia(t, 4096, "")
+	badHost, goodHost := bad.Listener.Addr().String(), good.Listener.Addr().String()
+
+	cli := newMediaHostTestClient(MediaConnHost{Hostname: goodHost})
+	// Both test servers use the same certificate, so either client trusts both
+	cli.SetHTTPClient(good.Client())
+	cli.MediaHosts = &MediaHostConfig{Hosts: []string{badHost}}
+
+	data, err := cli.DownloadMediaWithPath("/v/media?ccb=1", msg.FileEncSha256, msg.FileSha256, msg.MediaKey, len(plaintext), MediaImage, "")
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	} else if !bytes.Equal(data, plaintext) {
+		t.Fatal("Downloaded data doesn't match the original")
+	} else if badRequests != 1 {
+		t.Errorf("Expected one request to the failing host, got %d", badRequests)
+	}
+	if _, hosts, _ := cli.getMediaHosts(); !reflect.DeepEqual(hosts, []string{goodHost, badHost}) {
+		t.Errorf("Expected failed host to be tried last, got %v", hosts)
+	}
+
+	// Permanent errors are returned immediately instead of trying the next host
+	msg.FileEncSha256[0] ^= 1
+	if _, err = cli.DownloadMediaWithPath("/v/media?ccb=1", msg.FileEncSha256, msg.FileSha256, msg.MediaKey, len(plaintext), MediaImage, ""); !errors.Is(err, ErrInvalidMediaEncSHA256) {
+		t.Errorf("Expected ErrInvalidMediaEncSHA256, got %v", err)
+	} else if badRequests != 1 {
+		t.Errorf("Expected failing host not to be tried after a permanent error, got %d requests", badRequests)
+	}
+}
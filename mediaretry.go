@@ -7,10 +7,14 @@
 package whatsmeow
 
 import (
+	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"time"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	waBinary "github.com/insomnius/whatsmeow/binary"
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
@@ -46,6 +50,7 @@ func encryptMediaRetryReceipt(messageID types.MessageID, mediaKey []byte) (ciphe
 // SendMediaRetryReceipt sends a request to the phone to re-upload the media in a message.
 //
 // This is mostly relevant when handling history syncs and getting a 404 or 410 error downloading media.
+// RequestMediaRetry and DownloadAnyWithRetry implement the whole flow below, this is the low-level version.
 // Rough example on how to use it (will not work out of the box, you must adjust it depending on what you need exactly):
 //
 //	var mediaRetryCache map[types.MessageID]*waProto.ImageMessage
@@ -177,5 +182,95 @@ func (cli *Client) handleMediaRetryNotification(node *waBinary.Node) {
 		cli.Log.Warnf("Failed to parse media retry notification: %v", err)
 		return
 	}
+	cli.mediaRetryWaitersLock.Lock()
+	waiters := cli.mediaRetryWaiters[evt.MessageID]
+	delete(cli.mediaRetryWaiters, evt.MessageID)
+	cli.mediaRetryWaitersLock.Unlock()
+	for _, waiter := range waiters {
+		waiter <- evt
+	}
 	cli.dispatchEvent(evt)
 }
+
+// MediaRetryTimeout is the maximum time RequestMediaRetry waits for the phone to respond, unless the context
+// has an earlier deadline. The phone has to be online to re-upload the media.
+var MediaRetryTimeout = 1 * time.Minute
+
+// RequestMediaRetry asks the phone to re-upload the media in a message with SendMediaRetryReceipt, and waits for the
+// response. If the re-upload was successful, the returned notification contains the new direct path of the media.
+//
+// The events.MediaRetry event is still dispatched normally when the response arrives.
+func (cli *Client) RequestMediaRetry(ctx context.Context, message *types.MessageInfo, mediaKey []byte) (*waProto.MediaRetryNotification, error) {
+	ctx, cancel := context.WithTimeout(ctx, MediaRetryTimeout)
+	defer cancel()
+	waiter := make(chan *events.MediaRetry, 1)
+	cli.mediaRetryWaitersLock.Lock()
+	cli.mediaRetryWaiters[message.ID] = append(cli.mediaRetryWaiters[message.ID], waiter)
+	cli.mediaRetryWaitersLock.Unlock()
+	defer cli.cancelMediaRetryWaiter(message.ID, waiter)
+
+	if err := cli.SendMediaRetryReceipt(message, mediaKey); err != nil {
+		return nil, fmt.Errorf("failed to send media retry receipt: %w", err)
+	}
+	var evt *events.MediaRetry
+	select {
+	case evt = <-waiter:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	notif, err := DecryptMediaRetryNotification(evt, mediaKey)
+	if err != nil {
+		return nil, err
+	} else if notif.GetResult() != waProto.MediaRetryNotification_SUCCESS {
+		return notif, fmt.Errorf("%w: %s", ErrMediaRetryFailed, notif.GetResult())
+	}
+	return notif, nil
+}
+
+func (cli *Client) cancelMediaRetryWaiter(id types.MessageID, waiter chan *events.MediaRetry) {
+	cli.mediaRetryWaitersLock.Lock()
+	defer cli.mediaRetryWaitersLock.Unlock()
+	waiters := cli.mediaRetryWaiters[id]
+	for i, existing := range waiters {
+		if existing == waiter {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(cli.mediaRetryWaiters, id)
+	} else {
+		cli.mediaRetryWaiters[id] = waiters
+	}
+}
+
+// DownloadAnyWithRetry downloads the first downloadable part of the given message like DownloadAny, but if the media
+// has expired from the server (i.e. the download fails with a 404 or 410 error), it asks the phone to re-upload the
+// media with RequestMediaRetry and downloads it again from the new path.
+//
+// The message info is required for the retry request, so this works with both live messages and history syncs:
+//
+//	data, err := cli.DownloadAnyWithRetry(ctx, &evt.Info, evt.Message)
+func (cli *Client) DownloadAnyWithRetry(ctx context.Context, info *types.MessageInfo, msg *waProto.Message) ([]byte, error) {
+	part := getDownloadablePart(msg)
+	if part == nil {
+		return nil, ErrNothingDownloadableFound
+	}
+	data, err := cli.Download(part)
+	if !errors.Is(err, ErrMediaDownloadFailedWith404) && !errors.Is(err, ErrMediaDownloadFailedWith410) {
+		return data, err
+	}
+	cli.Log.Debugf("Media in %s expired (%v), requesting re-upload from phone", info.ID, err)
+	notif, err := cli.RequestMediaRetry(ctx, info, part.GetMediaKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to request media re-upload: %w", err)
+	}
+	// The old URL doesn't work anymore, so clear it to make Download use the new direct path
+	retried := proto.Clone(part).(DownloadableMessage)
+	fields := retried.ProtoReflect().Descriptor().Fields()
+	retried.ProtoReflect().Set(fields.ByName("directPath"), protoreflect.ValueOfString(notif.GetDirectPath()))
+	if urlField := fields.ByName("url"); urlField != nil {
+		retried.ProtoReflect().Clear(urlField)
+	}
+	return cli.Download(retried)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+	"github.com/insomnius/whatsmeow/util/gcmutil"
+)
+
+func TestGetDownloadablePart(t *testing.T) {
+	image := &waProto.ImageMessage{}
+	document := &waProto.DocumentMessage{}
+	tests := []struct {
+		msg      *waProto.Message
+		expected DownloadableMessage
+	}{
+		{nil, nil},
+		{&waProto.Message{Conversation: proto.String("hi")}, nil},
+		{&waProto.Message{ImageMessage: image}, image},
+		{&waProto.Message{DocumentMessage: document}, document},
+	}
+	for _, test := range tests {
+		if part := getDownloadablePart(test.msg); part != test.expected {
+			t.Errorf("getDownloadablePart(%v) = %v, expected %v", test.msg, part, test.expected)
+		}
+	}
+}
+
+func TestHandleMediaRetryNotification(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	mediaKey := make([]byte, 32)
+	const id = "MSG"
+	plaintext, _ := proto.Marshal(&waProto.MediaRetryNotification{
+		StanzaId:   proto.String(id),
+		DirectPath: proto.String("/v/new-path"),
+		Result:     waProto.MediaRetryNotification_SUCCESS.Enum(),
+	})
+	iv := make([]byte, 12)
+	ciphertext, err := gcmutil.Encrypt(getMediaRetryKey(mediaKey), iv, plaintext, []byte(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter := make(chan *events.MediaRetry, 1)
+	cli.mediaRetryWaiters[id] = []chan *events.MediaRetry{waiter}
+
+	cli.handleMediaRetryNotification(&waBinary.Node{
+		Tag:   "receipt",
+		Attrs: waBinary.Attrs{"id": id, "t": "1700000000"},
+		Content: []waBinary.Node{
+			{Tag: "encrypt", Content: []waBinary.Node{{Tag: "enc_p", Content: ciphertext}, {Tag: "enc_iv", Content: iv}}},
+			{Tag: "rmr", Attrs: waBinary.Attrs{"jid": types.NewJID("2222", types.DefaultUserServer), "from_me": "true"}},
+		},
+	})
+	var evt *events.MediaRetry
+	select {
+	case evt = <-waiter:
+	default:
+		t.Fatal("Waiter didn't get the notification")
+	}
+	if len(cli.mediaRetryWaiters) != 0 {
+		t.Error("Expected waiter to be removed after the notification")
+	}
+	notif, err := DecryptMediaRetryNotification(evt, mediaKey)
+	if err != nil {
+		t.Fatalf("Failed to decrypt notification: %v", err)
+	} else if notif.GetDirectPath() != "/v/new-path" {
+		t.Errorf("Expected new direct path, got %q", notif.GetDirectPath())
+	}
+	if _, err = DecryptMediaRetryNotification(evt, bytes.Repeat([]byte{1}, 32)); err == nil {
+		t.Error("Expected decrypting with the wrong key to fail")
+	}
+
+	if _, err = DecryptMediaRetryNotification(&events.MediaRetry{Error: &events.MediaRetryError{Code: 2}}, mediaKey); !errors.Is(err, ErrMediaNotAvailableOnPhone) {
+		t.Errorf("Expected ErrMediaNotAvailableOnPhone, got %v", err)
+	}
+	if _, err = DecryptMediaRetryNotification(&events.MediaRetry{Error: &events.MediaRetryError{Code: 1}}, mediaKey); !errors.Is(err, ErrUnknownMediaRetryError) {
+		t.Errorf("Expected ErrUnknownMediaRetryError, got %v", err)
+	}
+}
+
+func TestDownloadAnyWithRetry(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	cli := NewClient(device, nil)
+	ctx := context.Background()
+	if _, err := cli.DownloadAnyWithRetry(ctx, &types.MessageInfo{}, &waProto.Message{Conversation: proto.String("hi")}); !errors.Is(err, ErrNothingDownloadableFound) {
+		t.Errorf("Expected ErrNothingDownloadableFound, got %v", err)
+	}
+
+	for _, status := range []int{http.StatusNotFound, http.StatusGone, http.StatusInternalServerError} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+			msg := &waProto.Message{ImageMessage: &waProto.ImageMessage{Url: proto.String(srv.URL + "/media"), MediaKey: make([]byte, 32)}}
+			_, err := cli.DownloadAnyWithRetry(ctx, &types.MessageInfo{ID: "MSG"}, msg)
+			if err == nil {
+				t.Fatal("Expected download to fail")
+			}
+			// The retry request can't be sent without a connection, so only expired media gets that far
+			requestedRetry := errors.Is(err, ErrNotConnected)
+			expired := status != http.StatusInternalServerError
+			if requestedRetry != expired {
+				t.Errorf("Expected retry to be requested: %t, got error %v", expired, err)
+			}
+			// DownloadAny only retries if it has the message info
+			if _, err = cli.DownloadAny(msg, &types.MessageInfo{ID: "MSG"}); errors.Is(err, ErrNotConnected) != expired {
+				t.Errorf("Expected DownloadAny with info to request retry: %t, got error %v", expired, err)
+			}
+			if _, err = cli.DownloadAny(msg); err == nil || errors.Is(err, ErrNotConnected) {
+				t.Errorf("Expected DownloadAny without info to fail without requesting retry, got %v", err)
+			}
+			if len(cli.mediaRetryWaiters) != 0 {
+				t.Error("Expected media retry waiter to be removed")
+			}
+		})
+	}
+}
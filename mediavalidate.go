@@ -0,0 +1,170 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/insomnius/whatsmeow/util/mp3"
+	"github.com/insomnius/whatsmeow/util/mp4"
+	"github.com/insomnius/whatsmeow/util/oggopus"
+)
+
+// MaxMediaSizes contains the maximum size of the plaintext file for each media type that the server accepts.
+// ValidateMedia and Client.ValidateOutgoingMedia use these limits to fail before uploading.
+var MaxMediaSizes = map[MediaType]int64{
+	MediaImage:    16 * 1024 * 1024,
+	MediaVideo:    16 * 1024 * 1024,
+	MediaAudio:    16 * 1024 * 1024,
+	MediaDocument: 2 * 1024 * 1024 * 1024,
+}
+
+// allowedMediaMimetypes contains the formats that the official clients can display for each media type.
+// Documents can be any type of file, so they're not checked.
+var allowedMediaMimetypes = map[MediaType][]string{
+	MediaImage: {"image/jpeg", "image/png", "image/webp"},
+	MediaVideo: {"video/mp4", "video/3gpp"},
+	MediaAudio: {"audio/ogg", "audio/mpeg", "audio/mp4", "audio/aac", "audio/amr"},
+}
+
+// MediaInfo contains the metadata of a file that was checked with ValidateMedia.
+type MediaInfo struct {
+	// The mime type detected from the file contents.
+	Mimetype string
+	Size     int64
+
+	// The dimensions of images and videos, and the duration of videos and audio.
+	// They're zero if the format doesn't have them or they couldn't be read.
+	Width    int
+	Height   int
+	Duration time.Duration
+}
+
+// ValidateMedia checks that the given file can be sent as the given media type: it must be within the size limit in
+// MaxMediaSizes and in a format that the official clients can display. If a mime type is given (e.g. the one that
+// will be put in the message), it must match the type detected from the data. Documents are only checked for size.
+//
+// The returned errors wrap ErrMediaTooLarge, ErrUnsupportedMediaFormat, ErrMediaMimetypeMismatch or
+// ErrInvalidMediaData, so they can be checked with errors.Is.
+//
+//	info, err := whatsmeow.ValidateMedia(data, whatsmeow.MediaImage, "image/jpeg")
+//	if errors.Is(err, whatsmeow.ErrMediaTooLarge) {
+//		// compress the image
+//	}
+//	msg := &waProto.ImageMessage{
+//		Mimetype: proto.String(info.Mimetype),
+//		Width:    proto.Uint32(uint32(info.Width)),
+//		Height:   proto.Uint32(uint32(info.Height)),
+//		// other fields
+//	}
+func ValidateMedia(data []byte, mediaType MediaType, mimetype string) (*MediaInfo, error) {
+	allowed, ok := allowedMediaMimetypes[mediaType]
+	if !ok && mediaType != MediaDocument {
+		return nil, fmt.Errorf("%w %s", ErrUnknownMediaType, mediaType)
+	}
+	info := &MediaInfo{Size: int64(len(data))}
+	if err := checkMediaSize(info.Size, mediaType); err != nil {
+		return nil, err
+	} else if info.Size == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidMediaData)
+	}
+	info.Mimetype = sniffMediaMimetype(data)
+	if mediaType == MediaDocument {
+		return info, nil
+	}
+	if !containsString(allowed, info.Mimetype) {
+		return nil, fmt.Errorf("%w: %s can't be sent as %s", ErrUnsupportedMediaFormat, info.Mimetype, mediaTypeToMMSType[mediaType])
+	}
+	if len(mimetype) > 0 {
+		declared, _, err := mime.ParseMediaType(mimetype)
+		if err != nil || declared != info.Mimetype {
+			return nil, fmt.Errorf("%w: declared %s, but file is %s", ErrMediaMimetypeMismatch, mimetype, info.Mimetype)
+		}
+	}
+	switch mediaType {
+	case MediaImage:
+		if info.Mimetype == "image/webp" {
+			// There's no WebP decoder in the standard library, so the dimensions are left empty.
+			break
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read image: %v", ErrInvalidMediaData, err)
+		} else if config.Width <= 0 || config.Height <= 0 {
+			return nil, fmt.Errorf("%w: image has no dimensions", ErrInvalidMediaData)
+		}
+		info.Width, info.Height = config.Width, config.Height
+	case MediaVideo:
+		parsed, err := mp4.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read video: %v", ErrInvalidMediaData, err)
+		} else if !parsed.HasVideo() {
+			return nil, fmt.Errorf("%w: video doesn't have a video track", ErrInvalidMediaData)
+		}
+		info.Width, info.Height, info.Duration = parsed.Width, parsed.Height, parsed.Duration
+	case MediaAudio:
+		if info.Mimetype == "audio/ogg" || info.Mimetype == "audio/mpeg" || info.Mimetype == "audio/mp4" {
+			probed, err := ProbeAudio(data)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = probed.Duration
+		}
+	}
+	return info, nil
+}
+
+// checkMediaSize returns an error if the given file size is over the limit for the media type.
+func checkMediaSize(size int64, mediaType MediaType) error {
+	if limit, ok := MaxMediaSizes[mediaType]; ok && limit > 0 && size > limit {
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d bytes", ErrMediaTooLarge, mediaTypeToMMSType[mediaType], size, limit)
+	}
+	return nil
+}
+
+// sniffMediaMimetype detects the mime type of the given file. It's like http.DetectContentType, but also knows the
+// audio and video formats that the official clients send.
+func sniffMediaMimetype(data []byte) string {
+	switch {
+	case oggopus.IsOggOpus(data):
+		return "audio/ogg"
+	case mp4.IsMP4(data):
+		parsed, err := mp4.Parse(data)
+		if err != nil {
+			return "video/mp4"
+		} else if strings.HasPrefix(parsed.Brand, "3gp") {
+			return "video/3gpp"
+		} else if !parsed.HasVideo() {
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(data, []byte("#!AMR\n")):
+		return "audio/amr"
+	case len(data) >= 2 && data[0] == 0xff && data[1]&0xf6 == 0xf0:
+		// ADTS frame header: 12-bit sync word followed by layer 0
+		return "audio/aac"
+	case mp3.IsMP3(data):
+		return "audio/mpeg"
+	}
+	mimetype, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mimetype
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/messagebuilder"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// GetMentionedJIDs returns the users mentioned in the given message.
+func GetMentionedJIDs(msg *waProto.Message) []types.JID {
+	mentioned := getContextInfo(msg).GetMentionedJid()
+	jids := make([]types.JID, 0, len(mentioned))
+	for _, jidStr := range mentioned {
+		jid, err := types.ParseJID(jidStr)
+		if err == nil {
+			jids = append(jids, jid)
+		}
+	}
+	return jids
+}
+
+// getMessageText returns the text or caption of the message.
+func getMessageText(msg *waProto.Message) string {
+	switch {
+	case msg.Conversation != nil:
+		return msg.GetConversation()
+	case msg.ExtendedTextMessage != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.ImageMessage != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.VideoMessage != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.DocumentMessage != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	default:
+		return ""
+	}
+}
+
+// ResolveMentions returns the text (or caption) of the given message with the "@<phone number>" tokens of mentioned
+// users replaced with "@<name>", using the names from the contact store. The full name from the address book is
+// preferred, followed by the push name and business name. Users without any known name are left as phone numbers.
+//
+//	text, err := cli.ResolveMentions(context.Background(), evt.Message)
+func (cli *Client) ResolveMentions(ctx context.Context, msg *waProto.Message) (string, error) {
+	text := getMessageText(msg)
+	mentioned := GetMentionedJIDs(msg)
+	if len(text) == 0 || len(mentioned) == 0 {
+		return text, nil
+	}
+	names := make(map[types.JID]string, len(mentioned))
+	for _, jid := range mentioned {
+		jid = jid.ToNonAD()
+		if cli.Store.ID != nil && jid.User == cli.Store.ID.User && len(cli.Store.PushName) > 0 {
+			names[jid] = cli.Store.PushName
+			continue
+		}
+		contact, err := cli.Store.Contacts.GetContact(ctx, jid)
+		if err != nil {
+			return text, err
+		}
+		switch {
+		case len(contact.FullName) > 0:
+			names[jid] = contact.FullName
+		case len(contact.PushName) > 0:
+			names[jid] = contact.PushName
+		case len(contact.BusinessName) > 0:
+			names[jid] = contact.BusinessName
+		}
+	}
+	return messagebuilder.ReplaceMentions(text, mentioned, func(jid types.JID) string {
+		if name, ok := names[jid]; ok {
+			return "@" + name
+		}
+		return messagebuilder.MentionToken(jid)
+	}), nil
+}
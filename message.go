@@ -9,6 +9,7 @@ package whatsmeow
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
@@ -28,6 +29,7 @@ import (
 	"github.com/insomnius/whatsmeow/appstate"
 	waBinary "github.com/insomnius/whatsmeow/binary"
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/historysync"
 	"github.com/insomnius/whatsmeow/store"
 	"github.com/insomnius/whatsmeow/types"
 	"github.com/insomnius/whatsmeow/types/events"
@@ -123,9 +125,14 @@ func (cli *Client) parseMessageInfo(node *waBinary.Node) (*types.MessageInfo, er
 
 func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node) {
 	go cli.sendAck(node)
+	if cli.isDuplicateMessage(context.TODO(), info) {
+		cli.Log.Debugf("Ignoring duplicate message %s from %s", info.ID, info.SourceString())
+		go cli.sendMessageReceipt(info)
+		return
+	}
 	if len(node.GetChildrenByTag("unavailable")) > 0 && len(node.GetChildrenByTag("enc")) == 0 {
 		cli.Log.Warnf("Unavailable message %s from %s", info.ID, info.SourceString())
-		go cli.sendRetryReceipt(node, true)
+		cli.handleDecryptFailure(info, node, true)
 		cli.dispatchEvent(&events.UndecryptableMessage{Info: *info, IsUnavailable: true})
 		return
 	}
@@ -155,7 +162,7 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 		if err != nil {
 			cli.Log.Warnf("Error decrypting message from %s: %v", info.SourceString(), err)
 			isUnavailable := encType == "skmsg" && !containsDirectMsg && errors.Is(err, signalerror.ErrNoSenderKeyForUser)
-			go cli.sendRetryReceipt(node, isUnavailable)
+			cli.handleDecryptFailure(info, node, isUnavailable)
 			cli.dispatchEvent(&events.UndecryptableMessage{Info: *info, IsUnavailable: isUnavailable})
 			return
 		}
@@ -171,16 +178,18 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 		handled = true
 	}
 	if handled {
+		cli.markMessageSeen(context.TODO(), info)
+		cli.cancelRequestFromPhone(info.ID)
 		go cli.sendMessageReceipt(info)
 	}
 }
 
 func (cli *Client) clearUntrustedIdentity(target types.JID) {
-	err := cli.Store.Identities.DeleteIdentity(target.SignalAddress().String())
+	err := cli.Store.Identities.DeleteIdentity(context.TODO(), target.SignalAddress().String())
 	if err != nil {
 		cli.Log.Warnf("Failed to delete untrusted identity of %s from store: %v", target, err)
 	}
-	err = cli.Store.Sessions.DeleteSession(target.SignalAddress().String())
+	err = cli.Store.Sessions.DeleteSession(context.TODO(), target.SignalAddress().String())
 	if err != nil {
 		cli.Log.Warnf("Failed to delete session with %s (untrusted identity) from store: %v", target, err)
 	}
@@ -299,6 +308,10 @@ func (cli *Client) handleHistorySyncNotificationLoop() {
 }
 
 func (cli *Client) handleHistorySyncNotification(notif *waProto.HistorySyncNotification) {
+	if cli.StreamHistorySync {
+		cli.streamHistorySyncNotification(notif)
+		return
+	}
 	var historySync waProto.HistorySync
 	if data, err := cli.Download(notif); err != nil {
 		cli.Log.Errorf("Failed to download history sync data: %v", err)
@@ -314,6 +327,8 @@ func (cli *Client) handleHistorySyncNotification(notif *waProto.HistorySyncNotif
 			go cli.handleHistoricalPushNames(historySync.GetPushnames())
 		} else if len(historySync.GetConversations()) > 0 {
 			go cli.storeHistoricalMessageSecrets(historySync.GetConversations())
+			cli.updateDisappearingTimersFromHistory(historySync.GetConversations())
+			cli.updateUnreadFromHistory(historySync.GetConversations())
 		}
 		cli.dispatchEvent(&events.HistorySync{
 			Data: &historySync,
@@ -321,6 +336,67 @@ func (cli *Client) handleHistorySyncNotification(notif *waProto.HistorySyncNotif
 	}
 }
 
+// streamHistorySyncNotification parses a history sync blob one conversation at a time and dispatches
+// a HistorySyncConversation event for each one.
+func (cli *Client) streamHistorySyncNotification(notif *waProto.HistorySyncNotification) {
+	data, err := cli.Download(notif)
+	if err != nil {
+		cli.Log.Errorf("Failed to download history sync data: %v", err)
+		return
+	}
+	reader, err := historysync.NewCompressedReader(bytes.NewReader(data), *cli.Store.ID)
+	if err != nil {
+		cli.Log.Errorf("Failed to read history sync data: %v", err)
+		return
+	}
+	var statuses []*historysync.Message
+	var pushnames []historysync.Pushname
+	var rawPushnames []*waProto.Pushname
+	conversations := 0
+	for {
+		item, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			cli.Log.Errorf("Failed to parse history sync data: %v", err)
+			return
+		}
+		switch typedItem := item.(type) {
+		case *historysync.Conversation:
+			conversations++
+			rawConv := []*waProto.Conversation{typedItem.Raw}
+			cli.storeHistoricalMessageSecrets(rawConv)
+			cli.updateDisappearingTimersFromHistory(rawConv)
+			cli.updateUnreadFromHistory(rawConv)
+			cli.dispatchEvent(&events.HistorySyncConversation{SyncType: reader.SyncType, Conversation: typedItem})
+		case *historysync.Message:
+			statuses = append(statuses, typedItem)
+		case *historysync.Pushname:
+			pushnames = append(pushnames, *typedItem)
+			rawPushnames = append(rawPushnames, &waProto.Pushname{
+				Id:       proto.String(typedItem.JID.String()),
+				Pushname: proto.String(typedItem.Name),
+			})
+		}
+	}
+	cli.Log.Debugf("Streamed history sync (type %s, chunk %d) with %d conversations", reader.SyncType, reader.ChunkOrder, conversations)
+	if len(rawPushnames) > 0 {
+		go cli.handleHistoricalPushNames(rawPushnames)
+	}
+	if len(statuses) > 0 {
+		cli.dispatchEvent(&events.HistorySyncConversation{
+			SyncType:     reader.SyncType,
+			Conversation: &historysync.Conversation{JID: types.StatusBroadcastJID, Messages: statuses},
+		})
+	}
+	cli.dispatchEvent(&events.HistorySyncComplete{
+		SyncType:   reader.SyncType,
+		ChunkOrder: reader.ChunkOrder,
+		Progress:   reader.Progress,
+		Pushnames:  pushnames,
+	})
+}
+
 func (cli *Client) handleAppStateSyncKeyShare(keys *waProto.AppStateSyncKeyShare) {
 	onlyResyncIfNotSynced := true
 
@@ -336,7 +412,7 @@ func (cli *Client) handleAppStateSyncKeyShare(keys *waProto.AppStateSyncKeyShare
 		if isReRequest {
 			onlyResyncIfNotSynced = false
 		}
-		err = cli.Store.AppStateKeys.PutAppStateSyncKey(key.GetKeyId().GetKeyId(), store.AppStateSyncKey{
+		err = cli.Store.AppStateKeys.PutAppStateSyncKey(context.TODO(), key.GetKeyId().GetKeyId(), store.AppStateSyncKey{
 			Data:        key.GetKeyData().GetKeyData(),
 			Fingerprint: marshaledFingerprint,
 			Timestamp:   key.GetKeyData().GetTimestamp(),
@@ -383,7 +459,10 @@ func (cli *Client) processProtocolParts(info *types.MessageInfo, msg *waProto.Me
 		msg = msg.GetDeviceSentMessage().GetMessage()
 	}
 	if msg.GetSenderKeyDistributionMessage() != nil {
-		if !info.IsGroup {
+		if msg.GetSenderKeyDistributionMessage().GetGroupId() == types.LocationBroadcastJID.String() {
+			// Live location updates are encrypted with a sender key that is distributed in the chat the location is shared in
+			cli.handleSenderKeyDistributionMessage(types.LocationBroadcastJID, info.Sender, msg.SenderKeyDistributionMessage)
+		} else if !info.IsGroup {
 			cli.Log.Warnf("Got sender key distribution message in non-group chat from", info.Sender)
 		} else {
 			cli.handleSenderKeyDistributionMessage(info.Chat, info.Sender, msg.SenderKeyDistributionMessage)
@@ -395,7 +474,7 @@ func (cli *Client) processProtocolParts(info *types.MessageInfo, msg *waProto.Me
 		cli.handleProtocolMessage(info, msg)
 	}
 	if msgSecret := msg.GetMessageContextInfo().GetMessageSecret(); len(msgSecret) > 0 {
-		err := cli.Store.MsgSecrets.PutMessageSecret(info.Chat, info.Sender, info.ID, msgSecret)
+		err := cli.Store.MsgSecrets.PutMessageSecret(context.TODO(), info.Chat, info.Sender, info.ID, msgSecret)
 		if err != nil {
 			cli.Log.Errorf("Failed to store message secret key for %s: %v", info.ID, err)
 		} else {
@@ -439,7 +518,7 @@ func (cli *Client) storeHistoricalMessageSecrets(conversations []*waProto.Conver
 	}
 	if len(secrets) > 0 {
 		cli.Log.Debugf("Storing %d message secret keys in history sync", len(secrets))
-		err := cli.Store.MsgSecrets.PutMessageSecrets(secrets)
+		err := cli.Store.MsgSecrets.PutMessageSecrets(context.TODO(), secrets)
 		if err != nil {
 			cli.Log.Errorf("Failed to store message secret keys in history sync: %v", err)
 		} else {
@@ -451,7 +530,63 @@ func (cli *Client) storeHistoricalMessageSecrets(conversations []*waProto.Conver
 func (cli *Client) handleDecryptedMessage(info *types.MessageInfo, msg *waProto.Message) {
 	cli.processProtocolParts(info, msg)
 	evt := &events.Message{Info: *info, RawMessage: msg}
-	cli.dispatchEvent(evt.UnwrapRaw())
+	evt.UnwrapRaw()
+	cli.updateDisappearingTimerFromMessage(info, evt.Message)
+	cli.storeMessage(context.TODO(), &store.StoredMessage{
+		Chat:      info.Chat,
+		Sender:    info.Sender,
+		ID:        info.ID,
+		Timestamp: info.Timestamp,
+		FromMe:    info.IsFromMe,
+		PushName:  info.PushName,
+		Message:   evt.Message,
+	})
+	cli.dispatchEvent(evt)
+	cli.trackUnreadMessage(info, evt.Message)
+	if protoMsg := evt.Message.GetProtocolMessage(); protoMsg.GetType() == waProto.ProtocolMessage_MESSAGE_EDIT {
+		cli.dispatchEvent(cli.resolveMessageEdit(context.TODO(), info, protoMsg))
+	} else if evt.Message.GetReactionMessage() != nil || evt.Message.GetEncReactionMessage() != nil {
+		cli.handleReactionMessage(context.TODO(), evt)
+	} else if evt.Message.GetPollCreationMessage() != nil {
+		cli.storePoll(context.TODO(), info.Chat, info.Sender, info.ID, evt.Message.GetPollCreationMessage())
+	} else if evt.Message.GetPollUpdateMessage() != nil {
+		cli.handlePollUpdateMessage(context.TODO(), evt)
+	} else if evt.Message.GetLiveLocationMessage() != nil {
+		cli.handleLiveLocationMessage(evt)
+	}
+}
+
+func (cli *Client) resolveMessageEdit(ctx context.Context, info *types.MessageInfo, protoMsg *waProto.ProtocolMessage) *events.MessageEdit {
+	evt := &events.MessageEdit{
+		Info:       *info,
+		OriginalID: protoMsg.GetKey().GetId(),
+		NewContent: protoMsg.GetEditedMessage(),
+	}
+	if protoMsg.TimestampMs != nil {
+		evt.EditTimestamp = time.UnixMilli(protoMsg.GetTimestampMs())
+	} else {
+		evt.EditTimestamp = info.Timestamp
+	}
+	if cli.Store.Messages != nil && len(evt.OriginalID) > 0 {
+		original, err := cli.Store.Messages.GetMessage(ctx, info.Chat, info.Sender.ToNonAD(), evt.OriginalID)
+		if err != nil {
+			cli.Log.Warnf("Failed to get original message %s of edit %s from store: %v", evt.OriginalID, info.ID, err)
+		} else if original != nil {
+			evt.Original = original.Message
+			evt.OriginalTimestamp = original.Timestamp
+		}
+	}
+	return evt
+}
+
+func (cli *Client) storeMessage(ctx context.Context, msg *store.StoredMessage) {
+	if cli.Store.Messages == nil {
+		return
+	}
+	err := cli.Store.Messages.PutMessage(ctx, msg)
+	if err != nil {
+		cli.Log.Warnf("Failed to store message %s from %s in %s: %v", msg.ID, msg.Sender, msg.Chat, err)
+	}
 }
 
 func (cli *Client) sendProtocolMessageReceipt(id, msgType string) {
@@ -0,0 +1,137 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package messagebuilder contains a fluent API for building text messages with quotes, mentions and other context,
+// as well as interactive messages with buttons and lists.
+//
+//	msg := messagebuilder.Text("hi @1234").Mention(jid).Quote(evt).ContextTTL(24 * time.Hour).Build()
+//	resp, err := cli.SendMessage(context.Background(), evt.Info.Chat, "", msg)
+package messagebuilder
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// Builder builds a text message. The zero value is not usable, use Text to create a builder.
+type Builder struct {
+	text      string
+	mentions  []types.JID
+	quote     *quote
+	ttl       time.Duration
+	forwarded bool
+}
+
+type quote struct {
+	id      types.MessageID
+	chat    types.JID
+	sender  types.JID
+	message *waProto.Message
+}
+
+// Text starts building a text message with the given content.
+func Text(text string) *Builder {
+	return &Builder{text: text}
+}
+
+// Mention adds users to the list of mentioned users. WhatsApp highlights the mentions only if the text
+// also contains "@" followed by the user part of the JID, e.g. "@1234" for 1234@s.whatsapp.net.
+func (b *Builder) Mention(jids ...types.JID) *Builder {
+	for _, jid := range jids {
+		jid = jid.ToNonAD()
+		duplicate := false
+		for _, existing := range b.mentions {
+			if existing == jid {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			b.mentions = append(b.mentions, jid)
+		}
+	}
+	return b
+}
+
+// Quote makes the message a reply to the given received message.
+func (b *Builder) Quote(evt *events.Message) *Builder {
+	return b.QuoteMessage(evt.Info.MessageSource, evt.Info.ID, evt.Message)
+}
+
+// QuoteMessage makes the message a reply to a message with the given source, ID and content.
+// This is useful for replying to messages that were stored earlier, rather than a message event.
+func (b *Builder) QuoteMessage(source types.MessageSource, id types.MessageID, message *waProto.Message) *Builder {
+	b.quote = &quote{
+		id:      id,
+		chat:    source.Chat,
+		sender:  source.Sender,
+		message: message,
+	}
+	return b
+}
+
+// ContextTTL sets the disappearing message timer of the message, which should match the timer of the chat.
+func (b *Builder) ContextTTL(ttl time.Duration) *Builder {
+	b.ttl = ttl
+	return b
+}
+
+// Forwarded marks the message as forwarded.
+func (b *Builder) Forwarded() *Builder {
+	b.forwarded = true
+	return b
+}
+
+func (b *Builder) contextInfo() *waProto.ContextInfo {
+	if b.quote == nil && len(b.mentions) == 0 && b.ttl <= 0 && !b.forwarded {
+		return nil
+	}
+	var ctx waProto.ContextInfo
+	if b.quote != nil {
+		ctx.StanzaId = proto.String(b.quote.id)
+		ctx.Participant = proto.String(b.quote.sender.ToNonAD().String())
+		if b.quote.message != nil {
+			ctx.QuotedMessage = proto.Clone(b.quote.message).(*waProto.Message)
+		}
+		if b.quote.chat == types.StatusBroadcastJID {
+			ctx.RemoteJid = proto.String(b.quote.chat.String())
+		}
+	}
+	if len(b.mentions) > 0 {
+		ctx.MentionedJid = make([]string, len(b.mentions))
+		for i, jid := range b.mentions {
+			ctx.MentionedJid[i] = jid.String()
+		}
+	}
+	if b.ttl > 0 {
+		ctx.Expiration = proto.Uint32(uint32(b.ttl.Seconds()))
+	}
+	if b.forwarded {
+		ctx.IsForwarded = proto.Bool(true)
+		ctx.ForwardingScore = proto.Uint32(1)
+	}
+	return &ctx
+}
+
+// Build creates the message. A plain conversation message is used if no context was added,
+// otherwise the text is put in an extended text message with the context info.
+func (b *Builder) Build() *waProto.Message {
+	ctx := b.contextInfo()
+	if ctx == nil {
+		return &waProto.Message{Conversation: proto.String(b.text)}
+	}
+	return &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text:        proto.String(b.text),
+			ContextInfo: ctx,
+		},
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package messagebuilder_test
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/messagebuilder"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestBuilder(t *testing.T) {
+	if msg := messagebuilder.Text("hi").Build(); msg.GetConversation() != "hi" || msg.ExtendedTextMessage != nil {
+		t.Errorf("Expected plain conversation message, got %v", msg)
+	}
+
+	sender := types.NewADJID("1234", 0, 5)
+	evt := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: sender.ToNonAD(), Sender: sender},
+			ID:            "ABCD",
+		},
+		Message: &waProto.Message{Conversation: proto.String("original")},
+	}
+	msg := messagebuilder.Text("hi @1234").
+		Mention(sender).
+		Mention(sender.ToNonAD()).
+		Quote(evt).
+		ContextTTL(24 * time.Hour).
+		Build()
+	ctx := msg.GetExtendedTextMessage().GetContextInfo()
+	if msg.GetExtendedTextMessage().GetText() != "hi @1234" {
+		t.Errorf("Unexpected text %q", msg.GetExtendedTextMessage().GetText())
+	}
+	if len(ctx.GetMentionedJid()) != 1 || ctx.GetMentionedJid()[0] != "1234@s.whatsapp.net" {
+		t.Errorf("Unexpected mentions %v", ctx.GetMentionedJid())
+	}
+	if ctx.GetStanzaId() != "ABCD" || ctx.GetParticipant() != "1234@s.whatsapp.net" || ctx.GetQuotedMessage().GetConversation() != "original" {
+		t.Errorf("Unexpected quote in %v", ctx)
+	}
+	if ctx.GetExpiration() != 86400 {
+		t.Errorf("Expected expiration 86400, got %d", ctx.GetExpiration())
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	jids := messagebuilder.ParseMentions("@6281234567 hi @1234567, mail me at a@7654321 or @6281234567")
+	if len(jids) != 2 || jids[0].User != "6281234567" || jids[1].User != "1234567" || jids[0].Server != types.DefaultUserServer {
+		t.Fatalf("Unexpected mentions %v", jids)
+	}
+	replaced := messagebuilder.ReplaceMentions("hi @6281234567 and @7654321", jids[:1], func(jid types.JID) string {
+		return "@Alice"
+	})
+	if replaced != "hi @Alice and @7654321" {
+		t.Errorf("Unexpected replaced text %q", replaced)
+	}
+}
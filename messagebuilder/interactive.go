@@ -0,0 +1,365 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package messagebuilder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+)
+
+// Limits of interactive messages enforced by the official clients.
+const (
+	MaxButtons         = 3
+	MaxListRows        = 10
+	MaxNativeFlowItems = 10
+)
+
+// Errors returned by the Build methods of interactive message builders.
+var (
+	ErrNoButtons       = errors.New("interactive message has no buttons")
+	ErrTooManyButtons  = errors.New("too many buttons in interactive message")
+	ErrNoListRows      = errors.New("list message has no rows")
+	ErrTooManyListRows = errors.New("too many rows in list message")
+	ErrDuplicateID     = errors.New("duplicate button or row ID in interactive message")
+	ErrMissingText     = errors.New("interactive message is missing a required text")
+)
+
+// Button is a reply button in a buttons message.
+type Button struct {
+	// The ID that is sent back when the button is clicked.
+	ID string
+	// The text shown on the button.
+	Text string
+}
+
+// ButtonsBuilder builds a message with up to three reply buttons. Use Buttons to create a builder.
+type ButtonsBuilder struct {
+	text    string
+	header  string
+	footer  string
+	buttons []Button
+}
+
+// Buttons starts building a buttons message with the given text and buttons.
+//
+//	msg, err := messagebuilder.Buttons("Do you like pizza?", messagebuilder.Button{ID: "yes", Text: "Yes"}, messagebuilder.Button{ID: "no", Text: "No"}).Build()
+func Buttons(text string, buttons ...Button) *ButtonsBuilder {
+	return &ButtonsBuilder{text: text, buttons: buttons}
+}
+
+// Header sets a text header for the message.
+func (b *ButtonsBuilder) Header(text string) *ButtonsBuilder {
+	b.header = text
+	return b
+}
+
+// Footer sets the footer text of the message.
+func (b *ButtonsBuilder) Footer(text string) *ButtonsBuilder {
+	b.footer = text
+	return b
+}
+
+// Build creates the message.
+func (b *ButtonsBuilder) Build() (*waProto.Message, error) {
+	if len(b.text) == 0 {
+		return nil, fmt.Errorf("%w: buttons message text", ErrMissingText)
+	} else if len(b.buttons) == 0 {
+		return nil, ErrNoButtons
+	} else if len(b.buttons) > MaxButtons {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooManyButtons, len(b.buttons), MaxButtons)
+	}
+	seen := make(map[string]struct{}, len(b.buttons))
+	buttons := make([]*waProto.ButtonsMessage_Button, len(b.buttons))
+	for i, button := range b.buttons {
+		if _, ok := seen[button.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateID, button.ID)
+		} else if len(button.Text) == 0 {
+			return nil, fmt.Errorf("%w: text of button %q", ErrMissingText, button.ID)
+		}
+		seen[button.ID] = struct{}{}
+		buttons[i] = &waProto.ButtonsMessage_Button{
+			ButtonId:   proto.String(button.ID),
+			ButtonText: &waProto.ButtonsMessage_Button_ButtonText{DisplayText: proto.String(button.Text)},
+			Type:       waProto.ButtonsMessage_Button_RESPONSE.Enum(),
+		}
+	}
+	msg := &waProto.ButtonsMessage{
+		ContentText: proto.String(b.text),
+		Buttons:     buttons,
+		HeaderType:  waProto.ButtonsMessage_EMPTY.Enum(),
+	}
+	if len(b.header) > 0 {
+		msg.HeaderType = waProto.ButtonsMessage_TEXT.Enum()
+		msg.Header = &waProto.ButtonsMessage_Text{Text: b.header}
+	}
+	if len(b.footer) > 0 {
+		msg.FooterText = proto.String(b.footer)
+	}
+	return &waProto.Message{ButtonsMessage: msg}, nil
+}
+
+// ListRow is a single selectable row in a list message.
+type ListRow struct {
+	// The ID that is sent back when the row is selected.
+	ID          string
+	Title       string
+	Description string
+}
+
+// ListSection is a titled group of rows in a list message.
+type ListSection struct {
+	Title string
+	Rows  []ListRow
+}
+
+// ListBuilder builds a list message, which shows a button that opens a list of rows to choose from.
+// Use List to create a builder.
+type ListBuilder struct {
+	title       string
+	description string
+	buttonText  string
+	footer      string
+	sections    []ListSection
+}
+
+// List starts building a list message. The button text is shown on the button that opens the list.
+//
+//	msg, err := messagebuilder.List("Menu", "What would you like to order?", "View menu", messagebuilder.ListSection{
+//		Title: "Pizzas",
+//		Rows:  []messagebuilder.ListRow{{ID: "margherita", Title: "Margherita"}, {ID: "pepperoni", Title: "Pepperoni"}},
+//	}).Build()
+func List(title, description, buttonText string, sections ...ListSection) *ListBuilder {
+	return &ListBuilder{title: title, description: description, buttonText: buttonText, sections: sections}
+}
+
+// Footer sets the footer text of the message.
+func (b *ListBuilder) Footer(text string) *ListBuilder {
+	b.footer = text
+	return b
+}
+
+// Build creates the message.
+func (b *ListBuilder) Build() (*waProto.Message, error) {
+	if len(b.buttonText) == 0 {
+		return nil, fmt.Errorf("%w: list button text", ErrMissingText)
+	}
+	seen := make(map[string]struct{})
+	sections := make([]*waProto.ListMessage_Section, len(b.sections))
+	for i, section := range b.sections {
+		rows := make([]*waProto.ListMessage_Row, len(section.Rows))
+		for j, row := range section.Rows {
+			if _, ok := seen[row.ID]; ok {
+				return nil, fmt.Errorf("%w: %q", ErrDuplicateID, row.ID)
+			} else if len(row.Title) == 0 {
+				return nil, fmt.Errorf("%w: title of row %q", ErrMissingText, row.ID)
+			}
+			seen[row.ID] = struct{}{}
+			rows[j] = &waProto.ListMessage_Row{RowId: proto.String(row.ID), Title: proto.String(row.Title)}
+			if len(row.Description) > 0 {
+				rows[j].Description = proto.String(row.Description)
+			}
+		}
+		sections[i] = &waProto.ListMessage_Section{Title: proto.String(section.Title), Rows: rows}
+	}
+	if len(seen) == 0 {
+		return nil, ErrNoListRows
+	} else if len(seen) > MaxListRows {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooManyListRows, len(seen), MaxListRows)
+	}
+	msg := &waProto.ListMessage{
+		Title:       proto.String(b.title),
+		Description: proto.String(b.description),
+		ButtonText:  proto.String(b.buttonText),
+		ListType:    waProto.ListMessage_SINGLE_SELECT.Enum(),
+		Sections:    sections,
+	}
+	if len(b.footer) > 0 {
+		msg.FooterText = proto.String(b.footer)
+	}
+	return &waProto.Message{ListMessage: msg}, nil
+}
+
+// NativeFlowButton is a button in a native flow message. The name decides what kind of button it is
+// and the parameters are specific to each kind. The helper functions like QuickReplyButton and URLButton
+// create buttons for the common kinds.
+type NativeFlowButton struct {
+	Name string
+	// The parameters of the button. They're encoded as JSON when the message is built.
+	Params interface{}
+}
+
+// QuickReplyButton creates a native flow button that sends the ID back as a response when clicked.
+func QuickReplyButton(id, text string) NativeFlowButton {
+	return NativeFlowButton{Name: "quick_reply", Params: map[string]string{"display_text": text, "id": id}}
+}
+
+// URLButton creates a native flow button that opens the given URL.
+func URLButton(text, url string) NativeFlowButton {
+	return NativeFlowButton{Name: "cta_url", Params: map[string]string{"display_text": text, "url": url, "merchant_url": url}}
+}
+
+// CopyButton creates a native flow button that copies the given code to the clipboard.
+func CopyButton(text, code string) NativeFlowButton {
+	return NativeFlowButton{Name: "cta_copy", Params: map[string]string{"display_text": text, "copy_code": code}}
+}
+
+// CallButton creates a native flow button that calls the given phone number.
+func CallButton(text, phoneNumber string) NativeFlowButton {
+	return NativeFlowButton{Name: "cta_call", Params: map[string]string{"display_text": text, "phone_number": phoneNumber}}
+}
+
+// NativeFlowBuilder builds an interactive message with native flow buttons. Use NativeFlow to create a builder.
+type NativeFlowBuilder struct {
+	body    string
+	header  string
+	footer  string
+	buttons []NativeFlowButton
+}
+
+// NativeFlow starts building an interactive native flow message with the given body text and buttons.
+//
+//	msg, err := messagebuilder.NativeFlow("Your order has been shipped",
+//		messagebuilder.URLButton("Track package", "https://example.com/track/123"),
+//		messagebuilder.QuickReplyButton("help", "I need help"),
+//	).Build()
+func NativeFlow(body string, buttons ...NativeFlowButton) *NativeFlowBuilder {
+	return &NativeFlowBuilder{body: body, buttons: buttons}
+}
+
+// Header sets the header title of the message.
+func (b *NativeFlowBuilder) Header(title string) *NativeFlowBuilder {
+	b.header = title
+	return b
+}
+
+// Footer sets the footer text of the message.
+func (b *NativeFlowBuilder) Footer(text string) *NativeFlowBuilder {
+	b.footer = text
+	return b
+}
+
+// Build creates the message.
+func (b *NativeFlowBuilder) Build() (*waProto.Message, error) {
+	if len(b.body) == 0 {
+		return nil, fmt.Errorf("%w: interactive message body", ErrMissingText)
+	} else if len(b.buttons) == 0 {
+		return nil, ErrNoButtons
+	} else if len(b.buttons) > MaxNativeFlowItems {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooManyButtons, len(b.buttons), MaxNativeFlowItems)
+	}
+	buttons := make([]*waProto.InteractiveMessage_NativeFlowMessage_NativeFlowButton, len(b.buttons))
+	for i, button := range b.buttons {
+		params, err := json.Marshal(button.Params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode parameters of %s button: %w", button.Name, err)
+		}
+		buttons[i] = &waProto.InteractiveMessage_NativeFlowMessage_NativeFlowButton{
+			Name:             proto.String(button.Name),
+			ButtonParamsJson: proto.String(string(params)),
+		}
+	}
+	msg := &waProto.InteractiveMessage{
+		Body: &waProto.InteractiveMessage_Body{Text: proto.String(b.body)},
+		InteractiveMessage: &waProto.InteractiveMessage_NativeFlowMessage_{
+			NativeFlowMessage: &waProto.InteractiveMessage_NativeFlowMessage{
+				Buttons:        buttons,
+				MessageVersion: proto.Int32(1),
+			},
+		},
+	}
+	if len(b.header) > 0 {
+		msg.Header = &waProto.InteractiveMessage_Header{Title: proto.String(b.header), HasMediaAttachment: proto.Bool(false)}
+	}
+	if len(b.footer) > 0 {
+		msg.Footer = &waProto.InteractiveMessage_Footer{Text: proto.String(b.footer)}
+	}
+	return &waProto.Message{InteractiveMessage: msg}, nil
+}
+
+// ResponseType is the kind of interactive message that a Response is a reply to.
+type ResponseType int
+
+// The types of interactive responses.
+const (
+	ResponseButton ResponseType = iota + 1
+	ResponseList
+	ResponseNativeFlow
+	ResponseTemplateButton
+)
+
+// Response is a user's reply to an interactive message, i.e. a clicked button or a selected list row.
+type Response struct {
+	Type ResponseType
+	// The ID of the interactive message that was replied to.
+	MessageID string
+	// The ID of the selected button or row. For native flow responses, this is the id parameter if there is one.
+	SelectedID string
+	// The text of the selected button or row.
+	SelectedText string
+
+	// The name and raw JSON parameters of native flow responses.
+	FlowName   string
+	FlowParams json.RawMessage
+}
+
+// ParseResponse parses a reply to an interactive message. It returns nil if the message isn't one.
+//
+//	if resp := messagebuilder.ParseResponse(evt.Message); resp != nil {
+//		fmt.Println("User selected", resp.SelectedID)
+//	}
+func ParseResponse(msg *waProto.Message) *Response {
+	switch {
+	case msg.GetButtonsResponseMessage() != nil:
+		resp := msg.GetButtonsResponseMessage()
+		return &Response{
+			Type:         ResponseButton,
+			MessageID:    resp.GetContextInfo().GetStanzaId(),
+			SelectedID:   resp.GetSelectedButtonId(),
+			SelectedText: resp.GetSelectedDisplayText(),
+		}
+	case msg.GetListResponseMessage() != nil:
+		resp := msg.GetListResponseMessage()
+		return &Response{
+			Type:         ResponseList,
+			MessageID:    resp.GetContextInfo().GetStanzaId(),
+			SelectedID:   resp.GetSingleSelectReply().GetSelectedRowId(),
+			SelectedText: resp.GetTitle(),
+		}
+	case msg.GetTemplateButtonReplyMessage() != nil:
+		resp := msg.GetTemplateButtonReplyMessage()
+		return &Response{
+			Type:         ResponseTemplateButton,
+			MessageID:    resp.GetContextInfo().GetStanzaId(),
+			SelectedID:   resp.GetSelectedId(),
+			SelectedText: resp.GetSelectedDisplayText(),
+		}
+	case msg.GetInteractiveResponseMessage().GetNativeFlowResponseMessage() != nil:
+		resp := msg.GetInteractiveResponseMessage()
+		flow := resp.GetNativeFlowResponseMessage()
+		parsed := &Response{
+			Type:         ResponseNativeFlow,
+			MessageID:    resp.GetContextInfo().GetStanzaId(),
+			SelectedText: resp.GetBody().GetText(),
+			FlowName:     flow.GetName(),
+			FlowParams:   json.RawMessage(flow.GetParamsJson()),
+		}
+		var params struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(parsed.FlowParams, &params) == nil {
+			parsed.SelectedID = params.ID
+		}
+		return parsed
+	default:
+		return nil
+	}
+}
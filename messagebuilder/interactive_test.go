@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package messagebuilder_test
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/messagebuilder"
+)
+
+func TestButtons(t *testing.T) {
+	msg, err := messagebuilder.Buttons("Pizza?", messagebuilder.Button{ID: "yes", Text: "Yes"}, messagebuilder.Button{ID: "no", Text: "No"}).
+		Header("Question").
+		Footer("Answer quickly").
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buttons := msg.GetButtonsMessage()
+	if buttons.GetContentText() != "Pizza?" || buttons.GetText() != "Question" || buttons.GetFooterText() != "Answer quickly" {
+		t.Errorf("Unexpected buttons message %v", buttons)
+	} else if len(buttons.GetButtons()) != 2 || buttons.GetButtons()[1].GetButtonId() != "no" {
+		t.Errorf("Unexpected buttons %v", buttons.GetButtons())
+	}
+
+	_, err = messagebuilder.Buttons("x", messagebuilder.Button{ID: "a", Text: "A"}, messagebuilder.Button{ID: "a", Text: "B"}).Build()
+	if !errors.Is(err, messagebuilder.ErrDuplicateID) {
+		t.Errorf("Expected duplicate ID error, got %v", err)
+	}
+	many := make([]messagebuilder.Button, messagebuilder.MaxButtons+1)
+	for i := range many {
+		many[i] = messagebuilder.Button{ID: string(rune('a' + i)), Text: "x"}
+	}
+	if _, err = messagebuilder.Buttons("x", many...).Build(); !errors.Is(err, messagebuilder.ErrTooManyButtons) {
+		t.Errorf("Expected too many buttons error, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	msg, err := messagebuilder.List("Menu", "Pick one", "View", messagebuilder.ListSection{
+		Title: "Pizzas",
+		Rows:  []messagebuilder.ListRow{{ID: "m", Title: "Margherita"}, {ID: "p", Title: "Pepperoni", Description: "Spicy"}},
+	}).Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rows := msg.GetListMessage().GetSections()[0].GetRows()
+	if len(rows) != 2 || rows[1].GetRowId() != "p" || rows[1].GetDescription() != "Spicy" {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+	if _, err = messagebuilder.List("Menu", "", "View").Build(); !errors.Is(err, messagebuilder.ErrNoListRows) {
+		t.Errorf("Expected no rows error, got %v", err)
+	}
+}
+
+func TestNativeFlow(t *testing.T) {
+	msg, err := messagebuilder.NativeFlow("Shipped", messagebuilder.URLButton("Track", "https://example.com")).Footer("Thanks").Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buttons := msg.GetInteractiveMessage().GetNativeFlowMessage().GetButtons()
+	if len(buttons) != 1 || buttons[0].GetName() != "cta_url" ||
+		buttons[0].GetButtonParamsJson() != `{"display_text":"Track","merchant_url":"https://example.com","url":"https://example.com"}` {
+		t.Errorf("Unexpected native flow buttons %v", buttons)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	resp := messagebuilder.ParseResponse(&waProto.Message{ButtonsResponseMessage: &waProto.ButtonsResponseMessage{
+		SelectedButtonId: proto.String("yes"),
+		Response:         &waProto.ButtonsResponseMessage_SelectedDisplayText{SelectedDisplayText: "Yes"},
+		ContextInfo:      &waProto.ContextInfo{StanzaId: proto.String("ABCD")},
+	}})
+	if resp == nil || resp.Type != messagebuilder.ResponseButton || resp.SelectedID != "yes" || resp.SelectedText != "Yes" || resp.MessageID != "ABCD" {
+		t.Errorf("Unexpected buttons response %+v", resp)
+	}
+
+	resp = messagebuilder.ParseResponse(&waProto.Message{InteractiveResponseMessage: &waProto.InteractiveResponseMessage{
+		Body: &waProto.InteractiveResponseMessage_Body{Text: proto.String("I need help")},
+		InteractiveResponseMessage: &waProto.InteractiveResponseMessage_NativeFlowResponseMessage_{
+			NativeFlowResponseMessage: &waProto.InteractiveResponseMessage_NativeFlowResponseMessage{
+				Name:       proto.String("quick_reply"),
+				ParamsJson: proto.String(`{"id":"help"}`),
+			},
+		},
+	}})
+	if resp == nil || resp.Type != messagebuilder.ResponseNativeFlow || resp.SelectedID != "help" || resp.FlowName != "quick_reply" {
+		t.Errorf("Unexpected native flow response %+v", resp)
+	}
+
+	if resp = messagebuilder.ParseResponse(&waProto.Message{Conversation: proto.String("hi")}); resp != nil {
+		t.Errorf("Expected nil response for text message, got %+v", resp)
+	}
+}
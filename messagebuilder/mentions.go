@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package messagebuilder
+
+import (
+	"regexp"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// mentionRegex matches "@" followed by a phone number, as long as the @ isn't part of a word (e.g. an email address).
+var mentionRegex = regexp.MustCompile(`(^|[^\p{L}\p{N}_])@(\d{5,20})`)
+
+// ParseMentions finds all "@<phone number>" tokens in the text and returns the corresponding user JIDs
+// in the order they first appear, without duplicates.
+//
+//	messagebuilder.ParseMentions("hi @6281234567890") // [6281234567890@s.whatsapp.net]
+func ParseMentions(text string) []types.JID {
+	var jids []types.JID
+	seen := make(map[string]struct{})
+	for _, match := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		if _, ok := seen[match[2]]; !ok {
+			seen[match[2]] = struct{}{}
+			jids = append(jids, types.NewJID(match[2], types.DefaultUserServer))
+		}
+	}
+	return jids
+}
+
+// MentionToken returns the token that mentions the given user in a message text, e.g. "@6281234567890".
+func MentionToken(jid types.JID) string {
+	return "@" + jid.User
+}
+
+// ReplaceMentions replaces the mention tokens of the given mentioned users in the text with the return value
+// of the replacer function. Tokens of users who aren't in the mentioned list are left untouched, because
+// WhatsApp only treats them as mentions if the user is also listed in the message's ContextInfo.
+//
+//	text := messagebuilder.ReplaceMentions(msg.GetExtendedTextMessage().GetText(), mentioned, func(jid types.JID) string {
+//		return "@" + names[jid]
+//	})
+func ReplaceMentions(text string, mentioned []types.JID, replacer func(jid types.JID) string) string {
+	if len(mentioned) == 0 {
+		return text
+	}
+	users := make(map[string]types.JID, len(mentioned))
+	for _, jid := range mentioned {
+		users[jid.User] = jid.ToNonAD()
+	}
+	return mentionRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := mentionRegex.FindStringSubmatch(match)
+		jid, ok := users[parts[2]]
+		if !ok {
+			return match
+		}
+		return parts[1] + replacer(jid)
+	})
+}
+
+// AutoMention adds all users mentioned with "@<phone number>" tokens in the text to the list of mentioned users.
+func (b *Builder) AutoMention() *Builder {
+	return b.Mention(ParseMentions(b.text)...)
+}
@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
@@ -79,7 +80,7 @@ func (cli *Client) decryptMsgSecret(msg *events.Message, useCase MsgSecretType,
 	if err != nil {
 		return nil, err
 	}
-	baseEncKey, err := cli.Store.MsgSecrets.GetMessageSecret(msg.Info.Chat, pollSender, origMsgKey.GetId())
+	baseEncKey, err := cli.Store.MsgSecrets.GetMessageSecret(context.TODO(), msg.Info.Chat, pollSender, origMsgKey.GetId())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get original message secret key: %w", err)
 	} else if baseEncKey == nil {
@@ -96,7 +97,7 @@ func (cli *Client) decryptMsgSecret(msg *events.Message, useCase MsgSecretType,
 func (cli *Client) encryptMsgSecret(chat, origSender types.JID, origMsgID types.MessageID, useCase MsgSecretType, plaintext []byte) (ciphertext, iv []byte, err error) {
 	ownID := *cli.Store.ID
 
-	baseEncKey, err := cli.Store.MsgSecrets.GetMessageSecret(chat, origSender, origMsgID)
+	baseEncKey, err := cli.Store.MsgSecrets.GetMessageSecret(context.TODO(), chat, origSender, origMsgID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get original message secret key: %w", err)
 	} else if baseEncKey == nil {
@@ -129,7 +130,7 @@ func (cli *Client) encryptMsgSecret(chat, origSender types.JID, origMsgID types.
 //	}
 func (cli *Client) DecryptReaction(reaction *events.Message) (*waProto.ReactionMessage, error) {
 	encReaction := reaction.Message.GetEncReactionMessage()
-	if encReaction != nil {
+	if encReaction == nil {
 		return nil, ErrNotEncryptedReactionMessage
 	}
 	plaintext, err := cli.decryptMsgSecret(reaction, EncSecretReaction, encReaction, encReaction.GetTargetMessageKey())
@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"errors"
 
 	"github.com/insomnius/whatsmeow/appstate"
@@ -26,16 +27,16 @@ func (cli *Client) handleEncryptNotification(node *waBinary.Node) {
 			return
 		}
 		cli.Log.Infof("Got prekey count from server: %s", node.XMLString())
-		if otksLeft < MinPreKeyCount {
+		if otksLeft < cli.minPreKeyCount() {
 			cli.uploadPreKeys()
 		}
 	} else if _, ok := node.GetOptionalChildByTag("identity"); ok {
 		cli.Log.Debugf("Got identity change for %s: %s, deleting all identities/sessions for that number", from, node.XMLString())
-		err := cli.Store.Identities.DeleteAllIdentities(from.User)
+		err := cli.Store.Identities.DeleteAllIdentities(context.TODO(), from.User)
 		if err != nil {
 			cli.Log.Warnf("Failed to delete all identities of %s from store after identity change: %v", from, err)
 		}
-		err = cli.Store.Sessions.DeleteAllSessions(from.User)
+		err = cli.Store.Sessions.DeleteAllSessions(context.TODO(), from.User)
 		if err != nil {
 			cli.Log.Warnf("Failed to delete all sessions of %s from store after identity change: %v", from, err)
 		}
@@ -194,12 +195,14 @@ func (cli *Client) handleNotification(node *waBinary.Node) {
 		if err != nil {
 			cli.Log.Errorf("Failed to parse group notification: %v", err)
 		} else {
-			go cli.dispatchEvent(evt)
+			go cli.dispatchGroupNotification(evt)
 		}
 	case "picture":
 		go cli.handlePictureNotification(node)
 	case "mediaretry":
 		go cli.handleMediaRetryNotification(node)
+	case "link_code_companion_reg":
+		go cli.tryHandleCodePairNotification(node)
 	// Other types: business, disappearing_mode, server, status, pay, psa, privacy_token
 	default:
 		cli.Log.Debugf("Unhandled notification with type %s", notifType)
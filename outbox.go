@@ -0,0 +1,151 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// OutboxCallback is called after a message from the outbox has been sent. If sending failed for a reason
+// other than the connection being lost, err contains the error, and the message is not retried.
+type OutboxCallback func(msg *store.OutboxMessage, resp SendResponse, err error)
+
+// QueueMessage puts the given message in the outbox, even if the client is connected. Queued messages are
+// sent in the order they were queued, either right away or after the client reconnects.
+//
+// The callback is called after the message has been sent, in addition to Client.OutboxCallback. It's only kept
+// in memory, so if the process restarts before the message is sent, only Client.OutboxCallback will be called.
+//
+// This requires the device store to have an outbox, e.g. with the EnableOutbox option of sqlstore.
+func (cli *Client) QueueMessage(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message, callback OutboxCallback) (types.MessageID, error) {
+	if cli.Store.Outbox == nil {
+		return "", ErrNoOutboxStore
+	} else if len(id) == 0 {
+		id = GenerateMessageID()
+	}
+	cli.outboxLock.Lock()
+	defer cli.outboxLock.Unlock()
+	return id, cli.unlockedQueueMessage(ctx, to, id, message, callback)
+}
+
+func (cli *Client) unlockedQueueMessage(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message, callback OutboxCallback) error {
+	err := cli.Store.Outbox.PutOutboxMessage(ctx, &store.OutboxMessage{
+		To:       to,
+		ID:       id,
+		Message:  message,
+		QueuedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	cli.Log.Debugf("Queued message %s to %s in outbox", id, to)
+	cli.outboxKnownEmpty = false
+	if callback != nil {
+		if cli.outboxCallbacks == nil {
+			cli.outboxCallbacks = make(map[types.MessageID]OutboxCallback)
+		}
+		cli.outboxCallbacks[id] = callback
+	}
+	if cli.IsLoggedIn() && !cli.outboxFlushing {
+		cli.outboxFlushing = true
+		go cli.flushOutbox()
+	}
+	return nil
+}
+
+// queueIfNeeded puts the message in the outbox if the client isn't logged in, or if there are earlier messages
+// in the outbox that haven't been sent yet, so that messages are always sent in order.
+func (cli *Client) queueIfNeeded(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message) (queued bool, err error) {
+	if cli.Store.Outbox == nil {
+		return false, nil
+	}
+	cli.outboxLock.Lock()
+	defer cli.outboxLock.Unlock()
+	if cli.IsLoggedIn() && !cli.outboxFlushing && cli.outboxKnownEmpty {
+		return false, nil
+	}
+	return true, cli.unlockedQueueMessage(ctx, to, id, message, nil)
+}
+
+func (cli *Client) startFlushingOutbox() {
+	if cli.Store.Outbox == nil {
+		return
+	}
+	cli.outboxLock.Lock()
+	defer cli.outboxLock.Unlock()
+	if !cli.outboxFlushing {
+		cli.outboxFlushing = true
+		go cli.flushOutbox()
+	}
+}
+
+func (cli *Client) nextOutboxMessages() []*store.OutboxMessage {
+	cli.outboxLock.Lock()
+	defer cli.outboxLock.Unlock()
+	messages, err := cli.Store.Outbox.GetOutboxMessages(context.TODO())
+	if err != nil {
+		cli.Log.Errorf("Failed to get messages from outbox: %v", err)
+	} else if len(messages) == 0 {
+		cli.outboxKnownEmpty = true
+	}
+	if len(messages) == 0 {
+		cli.outboxFlushing = false
+	}
+	return messages
+}
+
+func (cli *Client) stopFlushingOutbox() {
+	cli.outboxLock.Lock()
+	cli.outboxFlushing = false
+	cli.outboxLock.Unlock()
+}
+
+func (cli *Client) flushOutbox() {
+	for {
+		messages := cli.nextOutboxMessages()
+		if len(messages) == 0 {
+			return
+		}
+		cli.Log.Debugf("Sending %d messages from outbox", len(messages))
+		for _, msg := range messages {
+			if !cli.IsLoggedIn() || cli.startOperation(true) != nil {
+				cli.stopFlushingOutbox()
+				return
+			}
+			resp, err := cli.sendMessage(context.TODO(), msg.To, msg.ID, msg.Message)
+			cli.finishOperation()
+			if err != nil && !cli.IsLoggedIn() {
+				cli.Log.Debugf("Connection lost while sending %s from outbox, will retry after reconnecting: %v", msg.ID, err)
+				cli.stopFlushingOutbox()
+				return
+			} else if err != nil {
+				cli.Log.Warnf("Failed to send %s from outbox: %v", msg.ID, err)
+			}
+			err2 := cli.Store.Outbox.DeleteOutboxMessage(context.TODO(), msg.ID)
+			if err2 != nil {
+				cli.Log.Errorf("Failed to delete %s from outbox: %v", msg.ID, err2)
+				cli.stopFlushingOutbox()
+				return
+			}
+			cli.outboxLock.Lock()
+			callback := cli.outboxCallbacks[msg.ID]
+			delete(cli.outboxCallbacks, msg.ID)
+			cli.outboxLock.Unlock()
+			if callback != nil {
+				callback(msg, resp, err)
+			}
+			if cli.OutboxCallback != nil {
+				cli.OutboxCallback(msg, resp, err)
+			}
+		}
+	}
+}
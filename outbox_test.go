@@ -0,0 +1,171 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+type testOutboxStore struct {
+	lock     sync.Mutex
+	messages []*store.OutboxMessage
+}
+
+func (s *testOutboxStore) PutOutboxMessage(_ context.Context, msg *store.OutboxMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *testOutboxStore) GetOutboxMessages(_ context.Context) ([]*store.OutboxMessage, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*store.OutboxMessage(nil), s.messages...), nil
+}
+
+func (s *testOutboxStore) DeleteOutboxMessage(_ context.Context, id types.MessageID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, msg := range s.messages {
+		if msg.ID == id {
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *testOutboxStore) ids() []types.MessageID {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ids := make([]types.MessageID, len(s.messages))
+	for i, msg := range s.messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func newOutboxTestClient(outbox *testOutboxStore) *Client {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	device.Outbox = outbox
+	return NewClient(device, nil)
+}
+
+// collectOutboxCallbacks makes the client send the IDs of messages handled by the outbox to the returned channel.
+func collectOutboxCallbacks(cli *Client) <-chan types.MessageID {
+	handled := make(chan types.MessageID, 10)
+	cli.OutboxCallback = func(msg *store.OutboxMessage, _ SendResponse, _ error) {
+		handled <- msg.ID
+	}
+	return handled
+}
+
+func waitOutboxCallbacks(t *testing.T, handled <-chan types.MessageID, count int) []types.MessageID {
+	t.Helper()
+	var ids []types.MessageID
+	for len(ids) < count {
+		select {
+		case id := <-handled:
+			ids = append(ids, id)
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for outbox, got %v", ids)
+		}
+	}
+	return ids
+}
+
+func TestOutboxFlushOnReconnect(t *testing.T) {
+	outbox := &testOutboxStore{}
+	cli := newOutboxTestClient(outbox)
+	handled := collectOutboxCallbacks(cli)
+	ctx := context.Background()
+	to := types.NewJID("2222", types.DefaultUserServer)
+	msg := &waProto.Message{Conversation: proto.String("hi")}
+	for _, id := range []types.MessageID{"first", "second", "third"} {
+		resp, err := cli.SendMessage(ctx, to, id, msg)
+		if err != nil {
+			t.Fatalf("Failed to send message while disconnected: %v", err)
+		} else if !resp.Queued {
+			t.Fatalf("Expected %s to be queued while disconnected", id)
+		}
+	}
+	if ids := outbox.ids(); !reflect.DeepEqual(ids, []types.MessageID{"first", "second", "third"}) {
+		t.Fatalf("Unexpected outbox contents %v", ids)
+	}
+
+	var callbackID types.MessageID
+	if _, err := cli.QueueMessage(ctx, to, "fourth", msg, func(msg *store.OutboxMessage, _ SendResponse, _ error) {
+		callbackID = msg.ID
+	}); err != nil {
+		t.Fatalf("Failed to queue message: %v", err)
+	}
+
+	// Sending fails without a connection, but the client is logged in, so the messages aren't retried
+	cli.setState(types.ConnectionStateOnline, nil)
+	cli.startFlushingOutbox()
+	if ids := waitOutboxCallbacks(t, handled, 4); !reflect.DeepEqual(ids, []types.MessageID{"first", "second", "third", "fourth"}) {
+		t.Errorf("Unexpected flush order %v", ids)
+	}
+	if callbackID != "fourth" {
+		t.Errorf("Expected per-message callback to be called for fourth, got %q", callbackID)
+	}
+	if ids := outbox.ids(); len(ids) != 0 {
+		t.Errorf("Expected outbox to be empty after flushing, got %v", ids)
+	}
+}
+
+func TestOutboxStopsWhenDisconnected(t *testing.T) {
+	outbox := &testOutboxStore{}
+	cli := newOutboxTestClient(outbox)
+	handled := collectOutboxCallbacks(cli)
+	ctx := context.Background()
+	to := types.NewJID("2222", types.DefaultUserServer)
+	for _, id := range []types.MessageID{"first", "second"} {
+		_ = outbox.PutOutboxMessage(ctx, &store.OutboxMessage{To: to, ID: id, Message: &waProto.Message{Conversation: proto.String("hi")}})
+	}
+	callback := cli.OutboxCallback
+	cli.OutboxCallback = func(msg *store.OutboxMessage, resp SendResponse, err error) {
+		// Simulate the connection dropping after the first message
+		cli.setState(types.ConnectionStateDisconnected, nil)
+		callback(msg, resp, err)
+	}
+
+	cli.setState(types.ConnectionStateOnline, nil)
+	cli.startFlushingOutbox()
+	waitOutboxCallbacks(t, handled, 1)
+	time.Sleep(50 * time.Millisecond)
+	if ids := outbox.ids(); !reflect.DeepEqual(ids, []types.MessageID{"second"}) {
+		t.Errorf("Expected second message to stay in the outbox, got %v", ids)
+	}
+
+	// New messages must be queued behind the remaining one even after reconnecting
+	cli.setState(types.ConnectionStateOnline, nil)
+	cli.OutboxCallback = callback
+	resp, err := cli.SendMessage(ctx, to, "third", &waProto.Message{Conversation: proto.String("hi")})
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	} else if !resp.Queued {
+		t.Fatal("Expected message to be queued behind the unsent outbox message")
+	}
+	if ids := waitOutboxCallbacks(t, handled, 2); !reflect.DeepEqual(ids, []types.MessageID{"second", "third"}) {
+		t.Errorf("Unexpected flush order %v", ids)
+	}
+}
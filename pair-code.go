@@ -0,0 +1,261 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/pbkdf2"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+	"github.com/insomnius/whatsmeow/util/hkdfutil"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// PairClientType is the type of client to use with PairPhone. The type is shown to the user in the notification
+// and in the list of linked devices on the phone.
+type PairClientType int
+
+const (
+	PairClientUnknown PairClientType = iota
+	PairClientChrome
+	PairClientEdge
+	PairClientFirefox
+	PairClientIE
+	PairClientOpera
+	PairClientSafari
+	PairClientElectron
+	PairClientUWP
+	PairClientOtherWebClient
+)
+
+var pairClientTypeNames = map[PairClientType]string{
+	PairClientChrome:   "Chrome",
+	PairClientEdge:     "Edge",
+	PairClientFirefox:  "Firefox",
+	PairClientIE:       "IE",
+	PairClientOpera:    "Opera",
+	PairClientSafari:   "Safari",
+	PairClientElectron: "Electron",
+	PairClientUWP:      "UWP",
+}
+
+// String returns the browser name shown for the client type.
+func (pct PairClientType) String() string {
+	name, ok := pairClientTypeNames[pct]
+	if !ok {
+		return "Other"
+	}
+	return name
+}
+
+var notNumbers = regexp.MustCompile("[^0-9]")
+var linkingBase32 = base32.NewEncoding("123456789ABCDEFGHJKLMNPQRSTVWXYZ")
+
+type phoneLinkingCache struct {
+	jid         types.JID
+	keyPair     *keys.KeyPair
+	linkingCode string
+	pairingRef  string
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	_, err := rand.Read(data)
+	if err != nil {
+		// Out of entropy
+		panic(err)
+	}
+	return data
+}
+
+func generateCompanionEphemeralKey() (ephemeralKeyPair *keys.KeyPair, ephemeralKey []byte, encodedLinkingCode string) {
+	ephemeralKeyPair = keys.NewKeyPair()
+	salt := randomBytes(32)
+	iv := randomBytes(16)
+	linkingCode := randomBytes(5)
+	encodedLinkingCode = linkingBase32.EncodeToString(linkingCode)
+	linkCodeKey := pbkdf2.Key([]byte(encodedLinkingCode), salt, 2<<16, 32, sha256.New)
+	linkCipherBlock, _ := aes.NewCipher(linkCodeKey)
+	encryptedPubkey := make([]byte, 32)
+	cipher.NewCTR(linkCipherBlock, iv).XORKeyStream(encryptedPubkey, ephemeralKeyPair.Pub[:])
+	ephemeralKey = concatBytes(salt, iv, encryptedPubkey)
+	return
+}
+
+// PairPhone generates a pairing code that can be used to link to a phone without scanning a QR code.
+//
+// The exact expiry of pairing codes is unknown, but QR codes are always generated and the login websocket is closed
+// after the QR codes run out, which means there's a 160-second time limit. It is recommended to generate the pairing
+// code immediately after connecting to the websocket to have the maximum time.
+//
+// The phone number must be in international format with the country code, but any non-digit characters are ignored.
+// If showPushNotification is true, the phone shows a notification asking to enter the code, so the user doesn't have to
+// open the linked devices screen manually. The client type and the device name from Client.DeviceInfo (or the OS name
+// from store.DeviceProps if it's not set) are shown on the phone.
+//
+//	err := cli.Connect()
+//	// handle error
+//	code, err := cli.PairPhone("+1 555 123 4567", true, whatsmeow.PairClientChrome)
+//	// handle error, then show the code to the user, who enters it on the phone
+//
+// The pairing will be completed asynchronously, and a PairSuccess event is emitted when the phone accepts the code.
+func (cli *Client) PairPhone(phone string, showPushNotification bool, clientType PairClientType) (string, error) {
+	ephemeralKeyPair, ephemeralKey, encodedLinkingCode := generateCompanionEphemeralKey()
+	phone = notNumbers.ReplaceAllString(phone, "")
+	if len(phone) <= 6 {
+		return "", ErrPhoneNumberTooShort
+	} else if phone[0] == '0' {
+		return "", ErrPhoneNumberIsNotInternational
+	}
+	jid := types.NewJID(phone, types.DefaultUserServer)
+	clientDisplayName := fmt.Sprintf("%s (%s)", clientType, cli.DeviceInfo.DeviceProps().GetOs())
+	resp, err := cli.sendIQ(infoQuery{
+		Namespace: "md",
+		Type:      iqSet,
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag: "link_code_companion_reg",
+			Attrs: waBinary.Attrs{
+				"jid":                           jid,
+				"stage":                         "companion_hello",
+				"should_show_push_notification": strconv.FormatBool(showPushNotification),
+			},
+			Content: []waBinary.Node{
+				{Tag: "link_code_pairing_wrapped_companion_ephemeral_pub", Content: ephemeralKey},
+				{Tag: "companion_server_auth_key_pub", Content: cli.Store.NoiseKey.Pub[:]},
+				{Tag: "companion_platform_id", Content: strconv.Itoa(int(clientType))},
+				{Tag: "companion_platform_display", Content: clientDisplayName},
+				{Tag: "link_code_pairing_nonce", Content: []byte{0}},
+			},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	pairingRefNode, ok := resp.GetOptionalChildByTag("link_code_companion_reg", "link_code_pairing_ref")
+	if !ok {
+		return "", &ElementMissingError{Tag: "link_code_pairing_ref", In: "code link registration response"}
+	}
+	pairingRef, ok := pairingRefNode.Content.([]byte)
+	if !ok {
+		return "", fmt.Errorf("unexpected type %T in content of link_code_pairing_ref tag", pairingRefNode.Content)
+	}
+	cli.phoneLinkingCache = &phoneLinkingCache{
+		jid:         jid,
+		keyPair:     ephemeralKeyPair,
+		linkingCode: encodedLinkingCode,
+		pairingRef:  string(pairingRef),
+	}
+	cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageCodeGenerated, Method: events.PairingMethodPhoneCode, ID: jid})
+	return encodedLinkingCode[0:4] + "-" + encodedLinkingCode[4:], nil
+}
+
+func (cli *Client) tryHandleCodePairNotification(parentNode *waBinary.Node) {
+	err := cli.handleCodePairNotification(parentNode)
+	if err != nil {
+		cli.Log.Errorf("Failed to handle code pair notification: %v", err)
+		cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageFailed, Method: events.PairingMethodPhoneCode, Error: err})
+	}
+}
+
+func (cli *Client) handleCodePairNotification(parentNode *waBinary.Node) error {
+	node, ok := parentNode.GetOptionalChildByTag("link_code_companion_reg")
+	if !ok {
+		return &ElementMissingError{Tag: "link_code_companion_reg", In: "notification"}
+	}
+	linkCache := cli.phoneLinkingCache
+	if linkCache == nil {
+		return fmt.Errorf("received code pair notification without a pending pairing")
+	}
+	linkCodePairingRef, _ := node.GetChildByTag("link_code_pairing_ref").Content.([]byte)
+	if string(linkCodePairingRef) != linkCache.pairingRef {
+		return fmt.Errorf("pairing ref mismatch in code pair notification")
+	}
+	cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageScanned, Method: events.PairingMethodPhoneCode, ID: linkCache.jid})
+	wrappedPrimaryEphemeralPub, ok := node.GetChildByTag("link_code_pairing_wrapped_primary_ephemeral_pub").Content.([]byte)
+	if !ok || len(wrappedPrimaryEphemeralPub) != 80 {
+		return &ElementMissingError{Tag: "link_code_pairing_wrapped_primary_ephemeral_pub", In: "notification"}
+	}
+	primaryIdentityPub, ok := node.GetChildByTag("primary_identity_pub").Content.([]byte)
+	if !ok {
+		return &ElementMissingError{Tag: "primary_identity_pub", In: "notification"}
+	}
+
+	advSecretRandom := randomBytes(32)
+	keyBundleSalt := randomBytes(32)
+	keyBundleNonce := randomBytes(12)
+
+	// Decrypt the primary device's ephemeral public key, which was encrypted with the 8-character pairing code,
+	// then compute the DH shared secret using our ephemeral private key we generated earlier.
+	primarySalt := wrappedPrimaryEphemeralPub[0:32]
+	primaryIV := wrappedPrimaryEphemeralPub[32:48]
+	primaryEncryptedPubkey := wrappedPrimaryEphemeralPub[48:80]
+	linkCodeKey := pbkdf2.Key([]byte(linkCache.linkingCode), primarySalt, 2<<16, 32, sha256.New)
+	linkCipherBlock, err := aes.NewCipher(linkCodeKey)
+	if err != nil {
+		return fmt.Errorf("failed to create link cipher: %w", err)
+	}
+	primaryDecryptedPubkey := make([]byte, 32)
+	cipher.NewCTR(linkCipherBlock, primaryIV).XORKeyStream(primaryDecryptedPubkey, primaryEncryptedPubkey)
+	ephemeralSharedSecret, err := curve25519.X25519(linkCache.keyPair.Priv[:], primaryDecryptedPubkey)
+	if err != nil {
+		return fmt.Errorf("failed to compute ephemeral shared secret: %w", err)
+	}
+
+	// Encrypt and wrap the key bundle containing our identity key, the primary device's identity key
+	// and the randomness used for the adv key.
+	keyBundleEncryptionKey := hkdfutil.SHA256(ephemeralSharedSecret, keyBundleSalt, []byte("link_code_pairing_key_bundle_encryption_key"), 32)
+	keyBundleCipherBlock, err := aes.NewCipher(keyBundleEncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to create key bundle cipher: %w", err)
+	}
+	keyBundleGCM, err := cipher.NewGCM(keyBundleCipherBlock)
+	if err != nil {
+		return fmt.Errorf("failed to create key bundle GCM: %w", err)
+	}
+	plaintextKeyBundle := concatBytes(cli.Store.IdentityKey.Pub[:], primaryIdentityPub, advSecretRandom)
+	encryptedKeyBundle := keyBundleGCM.Seal(nil, keyBundleNonce, plaintextKeyBundle, nil)
+	wrappedKeyBundle := concatBytes(keyBundleSalt, keyBundleNonce, encryptedKeyBundle)
+
+	// Compute the adv secret key (which is used to authenticate the pair-success event later)
+	identitySharedKey, err := curve25519.X25519(cli.Store.IdentityKey.Priv[:], primaryIdentityPub)
+	if err != nil {
+		return fmt.Errorf("failed to compute identity shared key: %w", err)
+	}
+	advSecretInput := concatBytes(ephemeralSharedSecret, identitySharedKey, advSecretRandom)
+	cli.Store.AdvSecretKey = hkdfutil.SHA256(advSecretInput, nil, []byte("adv_secret"), 32)
+
+	_, err = cli.sendIQ(infoQuery{
+		Namespace: "md",
+		Type:      iqSet,
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag: "link_code_companion_reg",
+			Attrs: waBinary.Attrs{
+				"jid":   linkCache.jid,
+				"stage": "companion_finish",
+			},
+			Content: []waBinary.Node{
+				{Tag: "link_code_pairing_wrapped_key_bundle", Content: wrappedKeyBundle},
+				{Tag: "companion_identity_public", Content: cli.Store.IdentityKey.Pub[:]},
+				{Tag: "link_code_pairing_ref", Content: linkCodePairingRef},
+			},
+		}},
+	})
+	return err
+}
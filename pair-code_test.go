@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+func TestGenerateCompanionEphemeralKey(t *testing.T) {
+	keyPair, ephemeralKey, code := generateCompanionEphemeralKey()
+	if len(code) != 8 {
+		t.Fatalf("Expected 8-character linking code, got %q", code)
+	}
+	for _, char := range code {
+		if !strings.ContainsRune("123456789ABCDEFGHJKLMNPQRSTVWXYZ", char) {
+			t.Errorf("Unexpected character %q in linking code %q", char, code)
+		}
+	}
+	if len(ephemeralKey) != 80 {
+		t.Fatalf("Expected 80-byte wrapped key, got %d bytes", len(ephemeralKey))
+	}
+	// The phone decrypts the public key with the code that the user entered
+	linkCodeKey := pbkdf2.Key([]byte(code), ephemeralKey[:32], 2<<16, 32, sha256.New)
+	block, err := aes.NewCipher(linkCodeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted := make([]byte, 32)
+	cipher.NewCTR(block, ephemeralKey[32:48]).XORKeyStream(decrypted, ephemeralKey[48:])
+	if !bytes.Equal(decrypted, keyPair.Pub[:]) {
+		t.Error("Decrypting the wrapped key with the linking code didn't return the public key")
+	}
+}
+
+func TestPairClientTypeString(t *testing.T) {
+	if name := PairClientChrome.String(); name != "Chrome" {
+		t.Errorf("Expected Chrome, got %q", name)
+	}
+	if name := PairClientOtherWebClient.String(); name != "Other" {
+		t.Errorf("Expected Other, got %q", name)
+	}
+}
+
+func TestPairPhone_InvalidNumber(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	tests := map[string]error{
+		"+1 555":         ErrPhoneNumberTooShort,
+		"(0) 555 123 45": ErrPhoneNumberIsNotInternational,
+	}
+	for phone, expected := range tests {
+		if _, err := cli.PairPhone(phone, false, PairClientChrome); !errors.Is(err, expected) {
+			t.Errorf("Expected %v for %q, got %v", expected, phone, err)
+		}
+	}
+}
+
+func TestHandleCodePairNotification_Unexpected(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	notification := &waBinary.Node{Tag: "notification", Content: []waBinary.Node{{
+		Tag:     "link_code_companion_reg",
+		Content: []waBinary.Node{{Tag: "link_code_pairing_ref", Content: []byte("ref")}},
+	}}}
+	if err := cli.handleCodePairNotification(notification); err == nil {
+		t.Error("Expected error for a notification without a pending pairing")
+	}
+	cli.phoneLinkingCache = &phoneLinkingCache{pairingRef: "other ref"}
+	if err := cli.handleCodePairNotification(notification); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Errorf("Expected pairing ref mismatch error, got %v", err)
+	}
+}
@@ -8,9 +8,11 @@ package whatsmeow
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -70,6 +72,42 @@ func (cli *Client) handlePairDevice(node *waBinary.Node) {
 	}
 
 	cli.dispatchEvent(evt)
+	cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageCodeGenerated, Codes: len(evt.Codes)})
+}
+
+func (cli *Client) pairingMethod() events.PairingMethod {
+	if cli.phoneLinkingCache != nil {
+		return events.PairingMethodPhoneCode
+	}
+	return events.PairingMethodQR
+}
+
+func (cli *Client) dispatchPairProgress(evt *events.PairProgress) {
+	if len(evt.Method) == 0 {
+		evt.Method = cli.pairingMethod()
+	}
+	evt.Timestamp = time.Now()
+	cli.dispatchEvent(evt)
+}
+
+// pairingError is returned by handlePair with the error code that was sent to the server.
+type pairingError struct {
+	code int
+	err  error
+}
+
+func (pe *pairingError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *pairingError) Unwrap() error {
+	return pe.err
+}
+
+// failPairing sends the given error code to the server and wraps the error so the code is included in PairProgress.
+func (cli *Client) failPairing(reqID string, code int, text string, err error) error {
+	cli.sendIQError(reqID, code, text)
+	return &pairingError{code: code, err: err}
 }
 
 func (cli *Client) makeQRData(ref string) string {
@@ -89,14 +127,27 @@ func (cli *Client) handlePairSuccess(node *waBinary.Node) {
 	platform, _ := pairSuccess.GetChildByTag("platform").Attrs["name"].(string)
 
 	go func() {
+		method := cli.pairingMethod()
+		if method == events.PairingMethodQR {
+			// For phone codes, the scanned stage is emitted when the phone sends the code pairing notification
+			cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageScanned, Method: method, ID: jid})
+		}
 		err := cli.handlePair(deviceIdentityBytes, id, businessName, platform, jid)
 		if err != nil {
 			cli.Log.Errorf("Failed to pair device: %v", err)
 			cli.Disconnect()
 			cli.dispatchEvent(&events.PairError{ID: jid, BusinessName: businessName, Platform: platform, Error: err})
+			var pairErr *pairingError
+			errorCode := 0
+			if errors.As(err, &pairErr) {
+				errorCode = pairErr.code
+			}
+			cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageFailed, Method: method, ID: jid, Error: err, ErrorCode: errorCode})
 		} else {
 			cli.Log.Infof("Successfully paired %s", cli.Store.ID)
+			cli.phoneLinkingCache = nil
 			cli.dispatchEvent(&events.PairSuccess{ID: jid, BusinessName: businessName, Platform: platform})
+			cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageSuccess, Method: method, ID: jid})
 		}
 	}()
 }
@@ -105,28 +156,24 @@ func (cli *Client) handlePair(deviceIdentityBytes []byte, reqID, businessName, p
 	var deviceIdentityContainer waProto.ADVSignedDeviceIdentityHMAC
 	err := proto.Unmarshal(deviceIdentityBytes, &deviceIdentityContainer)
 	if err != nil {
-		cli.sendIQError(reqID, 500, "internal-error")
-		return fmt.Errorf("failed to parse device identity container in pair success message: %w", err)
+		return cli.failPairing(reqID, 500, "internal-error", fmt.Errorf("failed to parse device identity container in pair success message: %w", err))
 	}
 
 	h := hmac.New(sha256.New, cli.Store.AdvSecretKey)
 	h.Write(deviceIdentityContainer.Details)
 	if !bytes.Equal(h.Sum(nil), deviceIdentityContainer.Hmac) {
 		cli.Log.Warnf("Invalid HMAC from pair success message")
-		cli.sendIQError(reqID, 401, "not-authorized")
-		return fmt.Errorf("invalid device identity HMAC in pair success message")
+		return cli.failPairing(reqID, 401, "not-authorized", fmt.Errorf("invalid device identity HMAC in pair success message"))
 	}
 
 	var deviceIdentity waProto.ADVSignedDeviceIdentity
 	err = proto.Unmarshal(deviceIdentityContainer.Details, &deviceIdentity)
 	if err != nil {
-		cli.sendIQError(reqID, 500, "internal-error")
-		return fmt.Errorf("failed to parse signed device identity in pair success message: %w", err)
+		return cli.failPairing(reqID, 500, "internal-error", fmt.Errorf("failed to parse signed device identity in pair success message: %w", err))
 	}
 
 	if !verifyDeviceIdentityAccountSignature(&deviceIdentity, cli.Store.IdentityKey) {
-		cli.sendIQError(reqID, 401, "not-authorized")
-		return fmt.Errorf("invalid device signature in pair success message")
+		return cli.failPairing(reqID, 401, "not-authorized", fmt.Errorf("invalid device signature in pair success message"))
 	}
 
 	deviceIdentity.DeviceSignature = generateDeviceSignature(&deviceIdentity, cli.Store.IdentityKey)[:]
@@ -134,10 +181,11 @@ func (cli *Client) handlePair(deviceIdentityBytes []byte, reqID, businessName, p
 	var deviceIdentityDetails waProto.ADVDeviceIdentity
 	err = proto.Unmarshal(deviceIdentity.Details, &deviceIdentityDetails)
 	if err != nil {
-		cli.sendIQError(reqID, 500, "internal-error")
-		return fmt.Errorf("failed to parse device identity details in pair success message: %w", err)
+		return cli.failPairing(reqID, 500, "internal-error", fmt.Errorf("failed to parse device identity details in pair success message: %w", err))
 	}
 
+	cli.dispatchPairProgress(&events.PairProgress{Stage: events.PairingStageKeysExchanged, ID: jid})
+
 	cli.Store.Account = proto.Clone(&deviceIdentity).(*waProto.ADVSignedDeviceIdentity)
 
 	mainDeviceJID := jid
@@ -147,23 +195,20 @@ func (cli *Client) handlePair(deviceIdentityBytes []byte, reqID, businessName, p
 
 	selfSignedDeviceIdentity, err := proto.Marshal(&deviceIdentity)
 	if err != nil {
-		cli.sendIQError(reqID, 500, "internal-error")
-		return fmt.Errorf("failed to marshal self-signed device identity: %w", err)
+		return cli.failPairing(reqID, 500, "internal-error", fmt.Errorf("failed to marshal self-signed device identity: %w", err))
 	}
 
 	cli.Store.ID = &jid
 	cli.Store.BusinessName = businessName
 	cli.Store.Platform = platform
-	err = cli.Store.Save()
+	err = cli.Store.Save(context.TODO())
 	if err != nil {
-		cli.sendIQError(reqID, 500, "internal-error")
-		return fmt.Errorf("failed to save device store: %w", err)
+		return cli.failPairing(reqID, 500, "internal-error", fmt.Errorf("failed to save device store: %w", err))
 	}
-	err = cli.Store.Identities.PutIdentity(mainDeviceJID.SignalAddress().String(), mainDeviceIdentity)
+	err = cli.Store.Identities.PutIdentity(context.TODO(), mainDeviceJID.SignalAddress().String(), mainDeviceIdentity)
 	if err != nil {
-		_ = cli.Store.Delete()
-		cli.sendIQError(reqID, 500, "internal-error")
-		return fmt.Errorf("failed to store main device identity: %w", err)
+		_ = cli.Store.Delete(context.TODO())
+		return cli.failPairing(reqID, 500, "internal-error", fmt.Errorf("failed to store main device identity: %w", err))
 	}
 
 	// Expect a disconnect after this and don't dispatch the usual Disconnected event
@@ -188,7 +233,7 @@ func (cli *Client) handlePair(deviceIdentityBytes []byte, reqID, businessName, p
 		}},
 	})
 	if err != nil {
-		_ = cli.Store.Delete()
+		_ = cli.Store.Delete(context.TODO())
 		return fmt.Errorf("failed to send pairing confirmation: %w", err)
 	}
 	return nil
@@ -225,8 +270,8 @@ func generateDeviceSignature(deviceIdentity *waProto.ADVSignedDeviceIdentity, ik
 	return &sig
 }
 
-func (cli *Client) sendIQError(id string, code int, text string) waBinary.Node {
-	return waBinary.Node{
+func (cli *Client) sendIQError(id string, code int, text string) {
+	err := cli.sendNode(waBinary.Node{
 		Tag: "iq",
 		Attrs: waBinary.Attrs{
 			"to":   types.ServerJID,
@@ -240,5 +285,8 @@ func (cli *Client) sendIQError(id string, code int, text string) waBinary.Node {
 				"text": text,
 			},
 		}},
+	})
+	if err != nil {
+		cli.Log.Warnf("Failed to send %d error response to %s: %v", code, id, err)
 	}
 }
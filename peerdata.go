@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+)
+
+// Some peer data operations aren't in the protobuf definitions yet, so their request types and payload fields
+// are encoded manually. The rest of the PeerDataOperationRequestMessage is normal.
+const (
+	peerDataOperationHistorySyncOnDemand      = 3
+	peerDataOperationPlaceholderMessageResend = 4
+
+	peerDataFieldHistorySyncOnDemand = 4
+	peerDataFieldPlaceholderResend   = 5
+)
+
+// buildPeerDataOperationRequest builds a peer message asking the primary device to do something.
+// The payload is the already encoded request that goes in the given field of the PeerDataOperationRequestMessage.
+func buildPeerDataOperationRequest(requestType int32, field protowire.Number, payload []byte) *waProto.Message {
+	unknown := protowire.AppendTag(nil, field, protowire.BytesType)
+	unknown = protowire.AppendBytes(unknown, payload)
+	request := &waProto.PeerDataOperationRequestMessage{
+		PeerDataOperationRequestType: waProto.PeerDataOperationRequestType(requestType).Enum(),
+	}
+	request.ProtoReflect().SetUnknown(unknown)
+	return &waProto.Message{ProtocolMessage: &waProto.ProtocolMessage{
+		Type:                            waProto.ProtocolMessage_PEER_DATA_OPERATION_REQUEST_MESSAGE.Enum(),
+		PeerDataOperationRequestMessage: request,
+	}}
+}
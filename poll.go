@@ -0,0 +1,175 @@
+// Copyright (c) 2022 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+const maxPollOptions = 12
+
+// SendPoll creates a poll in the given chat. If selectableOptionCount is 1, voters can only choose one option,
+// if it's zero, they can choose any number of options.
+//
+// If the device store has a poll store (see store.PollStore), the poll is stored so that incoming votes can be
+// matched to the options and the running results can be fetched with GetPollResults.
+//
+//	resp, err := cli.SendPoll(context.Background(), chat, "meow?", []string{"yes", "no"}, 1)
+func (cli *Client) SendPoll(ctx context.Context, chat types.JID, name string, optionNames []string, selectableOptionCount int) (SendResponse, error) {
+	if len(optionNames) < 2 || len(optionNames) > maxPollOptions {
+		return SendResponse{}, ErrInvalidPollOptions
+	} else if selectableOptionCount < 0 || selectableOptionCount > len(optionNames) {
+		return SendResponse{}, ErrInvalidSelectableOptionCount
+	}
+	seen := make(map[string]struct{}, len(optionNames))
+	for _, option := range optionNames {
+		if _, ok := seen[option]; ok {
+			return SendResponse{}, ErrInvalidPollOptions
+		}
+		seen[option] = struct{}{}
+	}
+	msg := cli.BuildPollCreation(name, optionNames, selectableOptionCount)
+	resp, err := cli.SendMessage(ctx, chat, "", msg)
+	if err == nil {
+		cli.storePoll(ctx, chat, *cli.Store.ID, resp.ID, msg.GetPollCreationMessage())
+	}
+	return resp, err
+}
+
+// SendPollVote votes in a poll, replacing any previous vote of this user. Passing no options removes the vote.
+//
+//	if evt.Message.GetPollCreationMessage() != nil {
+//		resp, err := cli.SendPollVote(context.Background(), &evt.Info, []string{"yes"})
+//	}
+func (cli *Client) SendPollVote(ctx context.Context, pollInfo *types.MessageInfo, optionNames []string) (SendResponse, error) {
+	msg, err := cli.BuildPollVote(pollInfo, optionNames)
+	if err != nil {
+		return SendResponse{}, err
+	}
+	resp, err := cli.SendMessage(ctx, pollInfo.Chat, "", msg)
+	if err == nil && cli.Store.Polls != nil {
+		err2 := cli.Store.Polls.PutPollVote(ctx, &store.PollVote{
+			Chat:            pollInfo.Chat,
+			PollID:          pollInfo.ID,
+			Voter:           cli.Store.ID.ToNonAD(),
+			SelectedOptions: HashPollOptions(optionNames),
+			Timestamp:       time.Now(),
+		})
+		if err2 != nil {
+			cli.Log.Warnf("Failed to store own vote in poll %s: %v", pollInfo.ID, err2)
+		}
+	}
+	return resp, err
+}
+
+// GetPollResults returns the current results of the given poll.
+//
+// This requires the device store to have a poll store, e.g. with the TrackPolls option of sqlstore.
+// If the poll isn't in the store, ErrPollNotFound is returned.
+func (cli *Client) GetPollResults(ctx context.Context, chat types.JID, pollID types.MessageID) (*types.PollResults, error) {
+	if cli.Store.Polls == nil {
+		return nil, ErrNoPollStore
+	}
+	poll, err := cli.Store.Polls.GetPoll(ctx, chat, pollID)
+	if err != nil {
+		return nil, err
+	} else if poll == nil {
+		return nil, ErrPollNotFound
+	}
+	votes, err := cli.Store.Polls.GetPollVotes(ctx, chat, pollID)
+	if err != nil {
+		return nil, err
+	}
+	results := &types.PollResults{
+		Chat:                  poll.Chat,
+		PollID:                pollID,
+		Name:                  poll.Poll.GetName(),
+		SelectableOptionCount: int(poll.Poll.GetSelectableOptionsCount()),
+		Options:               make([]types.PollOptionResult, len(poll.Poll.GetOptions())),
+	}
+	optionIndexes := make(map[string]int, len(results.Options))
+	for i, option := range poll.Poll.GetOptions() {
+		results.Options[i].Name = option.GetOptionName()
+		optionIndexes[string(HashPollOptions([]string{option.GetOptionName()})[0])] = i
+	}
+	for _, vote := range votes {
+		for _, hash := range vote.SelectedOptions {
+			if i, ok := optionIndexes[string(hash)]; ok {
+				results.Options[i].Voters = append(results.Options[i].Voters, vote.Voter)
+			}
+		}
+	}
+	return results, nil
+}
+
+func (cli *Client) storePoll(ctx context.Context, chat, sender types.JID, id types.MessageID, poll *waProto.PollCreationMessage) {
+	if cli.Store.Polls == nil {
+		return
+	}
+	err := cli.Store.Polls.PutPoll(ctx, &store.StoredPoll{
+		Chat:   chat,
+		Sender: sender,
+		ID:     id,
+		Poll:   poll,
+	})
+	if err != nil {
+		cli.Log.Warnf("Failed to store poll %s in %s: %v", id, chat, err)
+	}
+}
+
+func (cli *Client) handlePollUpdateMessage(ctx context.Context, evt *events.Message) {
+	vote, err := cli.DecryptPollVote(evt)
+	if err != nil {
+		cli.Log.Warnf("Failed to decrypt poll vote %s from %s: %v", evt.Info.ID, evt.Info.SourceString(), err)
+		return
+	}
+	pollUpdate := evt.Message.GetPollUpdateMessage()
+	update := &events.PollUpdate{
+		Info:           evt.Info,
+		PollID:         pollUpdate.GetPollCreationMessageKey().GetId(),
+		SelectedHashes: vote.GetSelectedOptions(),
+	}
+	if cli.Store.Polls != nil && len(update.PollID) > 0 {
+		ts := evt.Info.Timestamp
+		if pollUpdate.SenderTimestampMs != nil {
+			ts = time.UnixMilli(pollUpdate.GetSenderTimestampMs())
+		}
+		err = cli.Store.Polls.PutPollVote(ctx, &store.PollVote{
+			Chat:            evt.Info.Chat,
+			PollID:          update.PollID,
+			Voter:           evt.Info.Sender.ToNonAD(),
+			SelectedOptions: update.SelectedHashes,
+			Timestamp:       ts,
+		})
+		if err != nil {
+			cli.Log.Warnf("Failed to store poll vote %s from %s: %v", evt.Info.ID, evt.Info.SourceString(), err)
+		}
+		update.Results, err = cli.GetPollResults(ctx, evt.Info.Chat, update.PollID)
+		if err != nil && !errors.Is(err, ErrPollNotFound) {
+			cli.Log.Warnf("Failed to get results of poll %s: %v", update.PollID, err)
+		}
+		if update.Results != nil {
+			selected := make(map[string]struct{}, len(update.SelectedHashes))
+			for _, hash := range update.SelectedHashes {
+				selected[string(hash)] = struct{}{}
+			}
+			for _, option := range update.Results.Options {
+				if _, ok := selected[string(HashPollOptions([]string{option.Name})[0])]; ok {
+					update.SelectedOptions = append(update.SelectedOptions, option.Name)
+				}
+			}
+		}
+	}
+	cli.dispatchEvent(update)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// testPollStore is an in-memory store.PollStore that keeps the latest vote of each voter.
+type testPollStore struct {
+	polls map[types.MessageID]*store.StoredPoll
+	votes map[types.MessageID]map[types.JID]*store.PollVote
+}
+
+func (ps *testPollStore) PutPoll(ctx context.Context, poll *store.StoredPoll) error {
+	ps.polls[poll.ID] = poll
+	return nil
+}
+
+func (ps *testPollStore) GetPoll(ctx context.Context, chat types.JID, id types.MessageID) (*store.StoredPoll, error) {
+	return ps.polls[id], nil
+}
+
+func (ps *testPollStore) PutPollVote(ctx context.Context, vote *store.PollVote) error {
+	voters, ok := ps.votes[vote.PollID]
+	if !ok {
+		voters = make(map[types.JID]*store.PollVote)
+		ps.votes[vote.PollID] = voters
+	}
+	if existing, ok := voters[vote.Voter]; ok && existing.Timestamp.After(vote.Timestamp) {
+		return nil
+	} else if len(vote.SelectedOptions) == 0 {
+		delete(voters, vote.Voter)
+	} else {
+		voters[vote.Voter] = vote
+	}
+	return nil
+}
+
+func (ps *testPollStore) GetPollVotes(ctx context.Context, chat types.JID, id types.MessageID) ([]*store.PollVote, error) {
+	var votes []*store.PollVote
+	for _, vote := range ps.votes[id] {
+		votes = append(votes, vote)
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].Timestamp.Before(votes[j].Timestamp)
+	})
+	return votes, nil
+}
+
+func TestSendPollValidation(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	ctx := context.Background()
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	tooMany := make([]string, maxPollOptions+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("option %d", i+1)
+	}
+	tests := []struct {
+		name       string
+		options    []string
+		selectable int
+		expected   error
+	}{
+		{"one option", []string{"yes"}, 1, ErrInvalidPollOptions},
+		{"too many options", tooMany, 1, ErrInvalidPollOptions},
+		{"duplicate options", []string{"yes", "no", "yes"}, 1, ErrInvalidPollOptions},
+		{"negative selectable count", []string{"yes", "no"}, -1, ErrInvalidSelectableOptionCount},
+		{"selectable count above options", []string{"yes", "no"}, 3, ErrInvalidSelectableOptionCount},
+	}
+	for _, test := range tests {
+		if _, err := cli.SendPoll(ctx, chat, "meow?", test.options, test.selectable); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+	// Valid polls get as far as sending the message
+	jid := types.NewADJID("1111", 0, 1)
+	cli.Store.ID = &jid
+	for _, selectable := range []int{0, 2, maxPollOptions} {
+		_, err := cli.SendPoll(ctx, chat, "meow?", tooMany[:maxPollOptions], selectable)
+		if errors.Is(err, ErrInvalidPollOptions) || errors.Is(err, ErrInvalidSelectableOptionCount) {
+			t.Errorf("Expected poll with %d selectable options to be valid, got %v", selectable, err)
+		}
+	}
+}
+
+func TestGetPollResults(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	cli := NewClient(device, nil)
+	ctx := context.Background()
+	chat := types.NewJID("123456789-987654321", types.GroupServer)
+	alice := types.NewJID("2222", types.DefaultUserServer)
+	bob := types.NewJID("3333", types.DefaultUserServer)
+	if _, err := cli.GetPollResults(ctx, chat, "POLL"); !errors.Is(err, ErrNoPollStore) {
+		t.Errorf("Expected ErrNoPollStore, got %v", err)
+	}
+	polls := &testPollStore{polls: make(map[types.MessageID]*store.StoredPoll), votes: make(map[types.MessageID]map[types.JID]*store.PollVote)}
+	device.Polls = polls
+	if _, err := cli.GetPollResults(ctx, chat, "POLL"); !errors.Is(err, ErrPollNotFound) {
+		t.Errorf("Expected ErrPollNotFound, got %v", err)
+	}
+
+	cli.storePoll(ctx, chat, alice, "POLL", cli.BuildPollCreation("meow?", []string{"yes", "no", "maybe"}, 0).GetPollCreationMessage())
+	base := time.Unix(1700000000, 0)
+	vote := func(voter types.JID, ts time.Time, options ...string) {
+		_ = polls.PutPollVote(ctx, &store.PollVote{Chat: chat, PollID: "POLL", Voter: voter, SelectedOptions: HashPollOptions(options), Timestamp: ts})
+	}
+	vote(alice, base.Add(1*time.Second), "yes")
+	vote(bob, base.Add(2*time.Second), "yes", "maybe", "an option that doesn't exist")
+	vote(alice, base.Add(3*time.Second), "no")
+	// A vote delivered out of order doesn't replace the newer one
+	vote(alice, base.Add(2500*time.Millisecond), "maybe")
+
+	results, err := cli.GetPollResults(ctx, chat, "POLL")
+	if err != nil {
+		t.Fatalf("Failed to get poll results: %v", err)
+	} else if results.Name != "meow?" || results.SelectableOptionCount != 0 || len(results.Options) != 3 {
+		t.Fatalf("Unexpected poll results %+v", results)
+	}
+	counts := results.Counts()
+	if counts["yes"] != 1 || counts["no"] != 1 || counts["maybe"] != 1 {
+		t.Errorf("Unexpected vote counts %v", counts)
+	} else if results.Options[0].Name != "yes" || results.Options[0].Voters[0] != bob {
+		t.Errorf("Expected options in the original order, got %+v", results.Options)
+	}
+
+	vote(bob, base.Add(4*time.Second))
+	if results, _ = cli.GetPollResults(ctx, chat, "POLL"); len(results.Options[0].Voters) != 0 || len(results.Options[1].Voters) != 1 {
+		t.Errorf("Expected bob's vote to be removed, got %+v", results.Options)
+	}
+}
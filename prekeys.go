@@ -27,8 +27,55 @@ const (
 	WantedPreKeyCount = 50
 	// MinPreKeyCount is the number of prekeys when the client will upload a new batch of prekeys to the WhatsApp servers.
 	MinPreKeyCount = 5
+	// DefaultPreKeyCheckInterval is the default interval for checking the number of prekeys on the server while connected.
+	DefaultPreKeyCheckInterval = 6 * time.Hour
 )
 
+func (cli *Client) preKeyBatchSize() int {
+	if cli.PreKeyUploadBatchSize <= 0 {
+		return WantedPreKeyCount
+	}
+	return cli.PreKeyUploadBatchSize
+}
+
+func (cli *Client) minPreKeyCount() int {
+	if cli.MinServerPreKeyCount <= 0 {
+		return MinPreKeyCount
+	}
+	return cli.MinServerPreKeyCount
+}
+
+// preKeyCheckLoop periodically checks the number of prekeys on the server and uploads more if there are too few left.
+func (cli *Client) preKeyCheckLoop(ctx context.Context) {
+	if cli.PreKeyCheckInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cli.PreKeyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if cli.IsLoggedIn() {
+				cli.checkServerPreKeyCount()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (cli *Client) checkServerPreKeyCount() {
+	serverCount, err := cli.getServerPreKeyCount()
+	if err != nil {
+		cli.Log.Warnf("Failed to get number of prekeys on server: %v", err)
+		return
+	}
+	cli.Log.Debugf("Server says we have %d prekeys", serverCount)
+	if serverCount < cli.minPreKeyCount() {
+		cli.uploadPreKeys()
+	}
+}
+
 func (cli *Client) getServerPreKeyCount() (int, error) {
 	resp, err := cli.sendIQ(infoQuery{
 		Namespace: "encrypt",
@@ -52,14 +99,14 @@ func (cli *Client) uploadPreKeys() {
 	defer cli.uploadPreKeysLock.Unlock()
 	if cli.lastPreKeyUpload.Add(10 * time.Minute).After(time.Now()) {
 		sc, _ := cli.getServerPreKeyCount()
-		if sc >= WantedPreKeyCount {
+		if sc >= cli.preKeyBatchSize() {
 			cli.Log.Debugf("Canceling prekey upload request due to likely race condition")
 			return
 		}
 	}
 	var registrationIDBytes [4]byte
 	binary.BigEndian.PutUint32(registrationIDBytes[:], cli.Store.RegistrationID)
-	preKeys, err := cli.Store.PreKeys.GetOrGenPreKeys(WantedPreKeyCount)
+	preKeys, err := cli.Store.PreKeys.GetOrGenPreKeys(context.TODO(), uint32(cli.preKeyBatchSize()))
 	if err != nil {
 		cli.Log.Errorf("Failed to get prekeys to upload: %v", err)
 		return
@@ -82,7 +129,7 @@ func (cli *Client) uploadPreKeys() {
 		return
 	}
 	cli.Log.Debugf("Got response to uploading prekeys")
-	err = cli.Store.PreKeys.MarkPreKeysAsUploaded(preKeys[len(preKeys)-1].KeyID)
+	err = cli.Store.PreKeys.MarkPreKeysAsUploaded(context.TODO(), preKeys[len(preKeys)-1].KeyID)
 	if err != nil {
 		cli.Log.Warnf("Failed to mark prekeys as uploaded: %v", err)
 	}
@@ -14,8 +14,9 @@ import (
 
 // TryFetchPrivacySettings will fetch the user's privacy settings, either from the in-memory cache or from the server.
 func (cli *Client) TryFetchPrivacySettings(ignoreCache bool) (*types.PrivacySettings, error) {
-	if val := cli.privacySettingsCache.Load(); val != nil && !ignoreCache {
-		return val.(*types.PrivacySettings), nil
+	// The cache contains a nil pointer after it has been cleared
+	if val, _ := cli.privacySettingsCache.Load().(*types.PrivacySettings); val != nil && !ignoreCache {
+		return val, nil
 	}
 	resp, err := cli.sendIQ(infoQuery{
 		Namespace: "privacy",
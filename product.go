@@ -0,0 +1,191 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/imageutil"
+)
+
+const CatalogLinkPrefix = "https://wa.me/c/"
+const CatalogLinkDirectPrefix = "https://api.whatsapp.com/c/"
+
+// The size of the thumbnails embedded in product and catalog messages.
+const productThumbnailSize = 100
+
+// Product contains the info of a product in a business catalog.
+type Product struct {
+	ID          string
+	RetailerID  string
+	Title       string
+	Description string
+	URL         string
+
+	// The ISO 4217 currency code and the price in thousandths of the currency unit,
+	// e.g. 12500 with currency USD means $12.50. A zero sale price means the product isn't on sale.
+	CurrencyCode    string
+	PriceAmount1000 int64
+	SalePrice1000   int64
+
+	ImageCount int
+}
+
+// CatalogLink returns the link to the business catalog of the given user.
+func CatalogLink(owner types.JID) string {
+	return CatalogLinkPrefix + owner.User
+}
+
+// ParseCatalogLink parses a link to a business catalog and returns the JID of the owner.
+// The links look like https://wa.me/c/<phone> or https://api.whatsapp.com/c/<phone>.
+func ParseCatalogLink(link string) (types.JID, bool) {
+	var user string
+	if strings.HasPrefix(link, CatalogLinkPrefix) {
+		user = strings.TrimPrefix(link, CatalogLinkPrefix)
+	} else if strings.HasPrefix(link, CatalogLinkDirectPrefix) {
+		user = strings.TrimPrefix(link, CatalogLinkDirectPrefix)
+	} else {
+		return types.EmptyJID, false
+	}
+	user = strings.TrimRight(user, "/")
+	if len(user) == 0 || strings.Trim(user, "0123456789") != "" {
+		return types.EmptyJID, false
+	}
+	return types.NewJID(user, types.DefaultUserServer), true
+}
+
+// ParseProduct gets the product info from a product message. It returns nil if the message doesn't contain a product.
+func ParseProduct(msg *waProto.ProductMessage) *Product {
+	snapshot := msg.GetProduct()
+	if snapshot == nil {
+		return nil
+	}
+	return &Product{
+		ID:              snapshot.GetProductId(),
+		RetailerID:      snapshot.GetRetailerId(),
+		Title:           snapshot.GetTitle(),
+		Description:     snapshot.GetDescription(),
+		URL:             snapshot.GetUrl(),
+		CurrencyCode:    snapshot.GetCurrencyCode(),
+		PriceAmount1000: snapshot.GetPriceAmount1000(),
+		SalePrice1000:   snapshot.GetSalePriceAmount1000(),
+		ImageCount:      int(snapshot.GetProductImageCount()),
+	}
+}
+
+// uploadProductImage uploads an image for a product or catalog message.
+func (cli *Client) uploadProductImage(ctx context.Context, data []byte) (*waProto.ImageMessage, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	thumbnail, _, _, err := imageutil.MakeThumbnail(data, productThumbnailSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make thumbnail: %w", err)
+	}
+	uploaded, err := cli.upload(ctx, data, MediaImage, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload image: %w", err)
+	}
+	return &waProto.ImageMessage{
+		Url:               proto.String(uploaded.URL),
+		DirectPath:        proto.String(uploaded.DirectPath),
+		MediaKey:          uploaded.MediaKey,
+		Mimetype:          proto.String(http.DetectContentType(data)),
+		FileEncSha256:     uploaded.FileEncSHA256,
+		FileSha256:        uploaded.FileSHA256,
+		FileLength:        proto.Uint64(uploaded.FileLength),
+		Width:             proto.Uint32(uint32(config.Width)),
+		Height:            proto.Uint32(uint32(config.Height)),
+		JpegThumbnail:     thumbnail,
+		MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+	}, nil
+}
+
+// UploadProduct uploads the image of a product and returns a product message for it. The owner is the business
+// whose catalog the product is in, which is usually the current user. The image must be JPEG, PNG or GIF.
+//
+// The message body and footer can be set in the returned message before sending it.
+//
+//	msg, err := cli.UploadProduct(ctx, cli.Store.ID.ToNonAD(), &whatsmeow.Product{
+//		ID:              "1234567890",
+//		Title:           "Pizza",
+//		CurrencyCode:    "EUR",
+//		PriceAmount1000: 9500,
+//	}, imageData)
+//	// handle error
+//	msg.ProductMessage.Body = proto.String("Today's special")
+//	resp, err := cli.SendMessage(ctx, chat, "", msg)
+func (cli *Client) UploadProduct(ctx context.Context, owner types.JID, product *Product, productImage []byte) (*waProto.Message, error) {
+	imageMsg, err := cli.uploadProductImage(ctx, productImage)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &waProto.ProductMessage_ProductSnapshot{
+		ProductImage:      imageMsg,
+		ProductId:         proto.String(product.ID),
+		Title:             proto.String(product.Title),
+		CurrencyCode:      proto.String(product.CurrencyCode),
+		PriceAmount1000:   proto.Int64(product.PriceAmount1000),
+		ProductImageCount: proto.Uint32(uint32(product.ImageCount)),
+	}
+	if snapshot.GetProductImageCount() == 0 {
+		snapshot.ProductImageCount = proto.Uint32(1)
+	}
+	if len(product.RetailerID) > 0 {
+		snapshot.RetailerId = proto.String(product.RetailerID)
+	}
+	if len(product.Description) > 0 {
+		snapshot.Description = proto.String(product.Description)
+	}
+	if len(product.URL) > 0 {
+		snapshot.Url = proto.String(product.URL)
+	}
+	if product.SalePrice1000 > 0 {
+		snapshot.SalePriceAmount1000 = proto.Int64(product.SalePrice1000)
+	}
+	return &waProto.Message{ProductMessage: &waProto.ProductMessage{
+		Product:          snapshot,
+		BusinessOwnerJid: proto.String(owner.ToNonAD().String()),
+	}}, nil
+}
+
+// UploadCatalog uploads a cover image and returns a message linking to the catalog of the given business.
+func (cli *Client) UploadCatalog(ctx context.Context, owner types.JID, title, description string, coverImage []byte) (*waProto.Message, error) {
+	imageMsg, err := cli.uploadProductImage(ctx, coverImage)
+	if err != nil {
+		return nil, err
+	}
+	return &waProto.Message{ProductMessage: &waProto.ProductMessage{
+		Catalog: &waProto.ProductMessage_CatalogSnapshot{
+			CatalogImage: imageMsg,
+			Title:        proto.String(title),
+			Description:  proto.String(description),
+		},
+		BusinessOwnerJid: proto.String(owner.ToNonAD().String()),
+	}}, nil
+}
+
+// DownloadProductImage downloads the product image or catalog cover image in a product message.
+func (cli *Client) DownloadProductImage(msg *waProto.ProductMessage) ([]byte, error) {
+	if img := msg.GetProduct().GetProductImage(); img != nil {
+		return cli.Download(img)
+	} else if img = msg.GetCatalog().GetCatalogImage(); img != nil {
+		return cli.Download(img)
+	}
+	return nil, ErrNoProductImage
+}
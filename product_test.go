@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestParseCatalogLink(t *testing.T) {
+	owner := types.NewJID("15551234567", types.DefaultUserServer)
+	tests := map[string]bool{
+		CatalogLink(owner):                         true,
+		"https://api.whatsapp.com/c/15551234567":   true,
+		"https://wa.me/c/15551234567/":             true,
+		"https://wa.me/15551234567":                false,
+		"https://wa.me/c/":                         false,
+		"https://wa.me/c/1555abc":                  false,
+		"https://example.com/c/15551234567":        false,
+		"https://chat.whatsapp.com/c/15551234567 ": false,
+	}
+	for link, valid := range tests {
+		jid, ok := ParseCatalogLink(link)
+		if ok != valid {
+			t.Errorf("ParseCatalogLink(%q) returned %t, expected %t", link, ok, valid)
+		} else if ok && jid != owner {
+			t.Errorf("ParseCatalogLink(%q) returned %s, expected %s", link, jid, owner)
+		}
+	}
+}
+
+func TestParseProduct(t *testing.T) {
+	if ParseProduct(&waProto.ProductMessage{Catalog: &waProto.ProductMessage_CatalogSnapshot{}}) != nil {
+		t.Error("Expected nil product for a catalog message")
+	}
+	product := ParseProduct(&waProto.ProductMessage{Product: &waProto.ProductMessage_ProductSnapshot{
+		ProductId:           proto.String("123"),
+		RetailerId:          proto.String("SKU-1"),
+		Title:               proto.String("Pizza"),
+		CurrencyCode:        proto.String("EUR"),
+		PriceAmount1000:     proto.Int64(9500),
+		SalePriceAmount1000: proto.Int64(7500),
+		ProductImageCount:   proto.Uint32(2),
+	}})
+	expected := Product{ID: "123", RetailerID: "SKU-1", Title: "Pizza", CurrencyCode: "EUR", PriceAmount1000: 9500, SalePrice1000: 7500, ImageCount: 2}
+	if product == nil || *product != expected {
+		t.Errorf("Expected %+v, got %+v", expected, product)
+	}
+}
+
+func TestDownloadProductImage_NoImage(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	if _, err := cli.DownloadProductImage(&waProto.ProductMessage{Product: &waProto.ProductMessage_ProductSnapshot{}}); !errors.Is(err, ErrNoProductImage) {
+		t.Errorf("Expected ErrNoProductImage, got %v", err)
+	}
+}
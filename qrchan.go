@@ -8,12 +8,14 @@ package whatsmeow
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/insomnius/whatsmeow/types/events"
 	waLog "github.com/insomnius/whatsmeow/util/log"
+	"github.com/insomnius/whatsmeow/util/qrcode"
 )
 
 type QRChannelItem struct {
@@ -26,6 +28,62 @@ type QRChannelItem struct {
 	Code string
 	// The timeout after which the next code will be sent down the channel.
 	Timeout time.Duration
+	// The time when the code expires, i.e. when the Timeout elapses.
+	ExpiresAt time.Time
+}
+
+// QRCodeLevel is the error correction level used when rendering QR codes with the QRChannelItem helper methods.
+var QRCodeLevel = qrcode.Low
+
+// Encode encodes the code in the item as a QR code, which can be rendered in other formats than the helper methods support.
+func (item QRChannelItem) Encode() (*qrcode.Code, error) {
+	if item.Event != "code" {
+		return nil, ErrQRItemNotCode
+	}
+	return qrcode.Encode([]byte(item.Code), QRCodeLevel)
+}
+
+// PNG renders the code in the item as a PNG image with each module being scale pixels wide.
+func (item QRChannelItem) PNG(scale int) ([]byte, error) {
+	code, err := item.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(scale, qrcode.QuietZone)
+}
+
+// SVG renders the code in the item as an SVG image.
+func (item QRChannelItem) SVG() (string, error) {
+	code, err := item.Encode()
+	if err != nil {
+		return "", err
+	}
+	return code.SVG(qrcode.QuietZone), nil
+}
+
+// Terminal renders the code in the item as text that can be scanned when printed in a terminal with a dark background.
+func (item QRChannelItem) Terminal() (string, error) {
+	code, err := item.Encode()
+	if err != nil {
+		return "", err
+	}
+	return code.Terminal(qrcode.QuietZone), nil
+}
+
+// QRChannelOptions contains options for GetQRChannelWithOptions.
+type QRChannelOptions struct {
+	// AutoRefresh makes the channel reconnect to get a new batch of codes when the previous codes run out,
+	// instead of emitting QRChannelTimeout and closing the channel.
+	AutoRefresh bool
+	// MaxRefreshes is the maximum number of times new codes are fetched when AutoRefresh is enabled. Zero means no limit.
+	MaxRefreshes int
+
+	// OnCode is called with every new code before it's sent to the channel.
+	OnCode func(item QRChannelItem)
+	// OnCountdown is called every CountdownInterval while a code is valid with the time remaining until it expires.
+	OnCountdown func(item QRChannelItem, remaining time.Duration)
+	// CountdownInterval is the interval between OnCountdown calls. Defaults to one second.
+	CountdownInterval time.Duration
 }
 
 var (
@@ -47,17 +105,91 @@ type qrChannel struct {
 	cli       *Client
 	log       waLog.Logger
 	ctx       context.Context
+	opts      QRChannelOptions
 	handlerID uint32
 	closed    uint32
+	refreshes int
 	output    chan<- QRChannelItem
 	stopQRs   chan struct{}
 }
 
+// closeWithError closes the channel after emitting an error item, unless it's already closed.
+func (qrc *qrChannel) closeWithError(err error) {
+	if atomic.CompareAndSwapUint32(&qrc.closed, 0, 1) {
+		qrc.log.Debugf("Closing channel with error %v", err)
+		qrc.output <- QRChannelItem{Event: "error", Error: err}
+		close(qrc.output)
+		go qrc.cli.RemoveEventHandler(qrc.handlerID)
+		qrc.cli.Disconnect()
+	}
+}
+
+// tryRefresh reconnects to get a new batch of codes if auto-refresh is enabled and the limit hasn't been reached.
+func (qrc *qrChannel) tryRefresh() bool {
+	qrc.Lock()
+	defer qrc.Unlock()
+	if !qrc.opts.AutoRefresh || (qrc.opts.MaxRefreshes > 0 && qrc.refreshes >= qrc.opts.MaxRefreshes) ||
+		atomic.LoadUint32(&qrc.closed) == 1 || qrc.ctx.Err() != nil {
+		return false
+	}
+	qrc.refreshes++
+	qrc.log.Debugf("Ran out of QR codes, reconnecting to get new ones (refresh #%d)", qrc.refreshes)
+	go func() {
+		qrc.cli.Disconnect()
+		err := qrc.cli.Connect()
+		if err != nil {
+			qrc.closeWithError(fmt.Errorf("failed to reconnect to refresh QR codes: %w", err))
+		}
+	}()
+	return true
+}
+
+// waitForExpiry waits until the given code expires, calling the countdown callback if one is set.
+// It returns false if the emitter should stop before the code expires.
+func (qrc *qrChannel) waitForExpiry(item QRChannelItem) bool {
+	expiry := time.NewTimer(item.Timeout)
+	defer expiry.Stop()
+	var countdown <-chan time.Time
+	if qrc.opts.OnCountdown != nil {
+		interval := qrc.opts.CountdownInterval
+		if interval <= 0 {
+			interval = 1 * time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		countdown = ticker.C
+		qrc.opts.OnCountdown(item, item.Timeout)
+	}
+	for {
+		select {
+		case <-expiry.C:
+			return true
+		case <-countdown:
+			if remaining := time.Until(item.ExpiresAt); remaining > 0 {
+				qrc.opts.OnCountdown(item, remaining)
+			}
+		case <-qrc.stopQRs:
+			qrc.log.Debugf("Got signal to stop QR emitter")
+			return false
+		case <-qrc.ctx.Done():
+			qrc.log.Debugf("Context is done, stopping QR emitter")
+			if atomic.CompareAndSwapUint32(&qrc.closed, 0, 1) {
+				close(qrc.output)
+				go qrc.cli.RemoveEventHandler(qrc.handlerID)
+				qrc.cli.Disconnect()
+			}
+			return false
+		}
+	}
+}
+
 func (qrc *qrChannel) emitQRs(evt *events.QR) {
 	var nextCode string
 	for {
 		if len(evt.Codes) == 0 {
-			if atomic.CompareAndSwapUint32(&qrc.closed, 0, 1) {
+			if qrc.tryRefresh() {
+				return
+			} else if atomic.CompareAndSwapUint32(&qrc.closed, 0, 1) {
 				qrc.log.Debugf("Ran out of QR codes, closing channel with status %s and disconnecting client", QRChannelTimeout)
 				qrc.output <- QRChannelTimeout
 				close(qrc.output)
@@ -77,8 +209,12 @@ func (qrc *qrChannel) emitQRs(evt *events.QR) {
 		}
 		nextCode, evt.Codes = evt.Codes[0], evt.Codes[1:]
 		qrc.log.Debugf("Emitting QR code %s", nextCode)
+		item := QRChannelItem{Code: nextCode, Timeout: timeout, ExpiresAt: time.Now().Add(timeout), Event: "code"}
+		if qrc.opts.OnCode != nil {
+			qrc.opts.OnCode(item)
+		}
 		select {
-		case qrc.output <- QRChannelItem{Code: nextCode, Timeout: timeout, Event: "code"}:
+		case qrc.output <- item:
 		default:
 			qrc.log.Debugf("Output channel didn't accept code, exiting QR emitter")
 			if atomic.CompareAndSwapUint32(&qrc.closed, 0, 1) {
@@ -88,18 +224,8 @@ func (qrc *qrChannel) emitQRs(evt *events.QR) {
 			}
 			return
 		}
-		select {
-		case <-time.After(timeout):
-		case <-qrc.stopQRs:
-			qrc.log.Debugf("Got signal to stop QR emitter")
+		if !qrc.waitForExpiry(item) {
 			return
-		case <-qrc.ctx.Done():
-			qrc.log.Debugf("Context is done, stopping QR emitter")
-			if atomic.CompareAndSwapUint32(&qrc.closed, 0, 1) {
-				close(qrc.output)
-				go qrc.cli.RemoveEventHandler(qrc.handlerID)
-				qrc.cli.Disconnect()
-			}
 		}
 	}
 }
@@ -154,19 +280,43 @@ func (qrc *qrChannel) handleEvent(rawEvt interface{}) {
 // The last value to be emitted will be a special string, either "success", "timeout" or "err-already-have-id",
 // depending on the result of the pairing. The channel will be closed immediately after one of those.
 func (cli *Client) GetQRChannel(ctx context.Context) (<-chan QRChannelItem, error) {
+	return cli.GetQRChannelWithOptions(ctx, QRChannelOptions{})
+}
+
+// GetQRChannelWithOptions returns a QR channel like GetQRChannel, but with additional options, such as automatically
+// fetching new codes when the previous ones run out and callbacks for counting down until the current code expires.
+//
+//	qrChan, _ := cli.GetQRChannelWithOptions(context.Background(), whatsmeow.QRChannelOptions{AutoRefresh: true})
+//	err := cli.Connect()
+//	// handle error
+//	for item := range qrChan {
+//		if item.Event == "code" {
+//			text, _ := item.Terminal()
+//			fmt.Print(text)
+//		} else {
+//			fmt.Println("Login event:", item.Event)
+//		}
+//	}
+func (cli *Client) GetQRChannelWithOptions(ctx context.Context, opts QRChannelOptions) (<-chan QRChannelItem, error) {
+	_, ch, err := cli.newQRChannel(ctx, opts)
+	return ch, err
+}
+
+func (cli *Client) newQRChannel(ctx context.Context, opts QRChannelOptions) (*qrChannel, <-chan QRChannelItem, error) {
 	if cli.IsConnected() {
-		return nil, ErrQRAlreadyConnected
+		return nil, nil, ErrQRAlreadyConnected
 	} else if cli.Store.ID != nil {
-		return nil, ErrQRStoreContainsID
+		return nil, nil, ErrQRStoreContainsID
 	}
 	ch := make(chan QRChannelItem, 8)
-	qrc := qrChannel{
+	qrc := &qrChannel{
 		output:  ch,
 		stopQRs: make(chan struct{}),
 		cli:     cli,
 		log:     cli.Log.Sub("QRChannel"),
 		ctx:     ctx,
+		opts:    opts,
 	}
 	qrc.handlerID = cli.AddEventHandler(qrc.handleEvent)
-	return ch, nil
+	return qrc, ch, nil
 }
@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// SendReaction reacts to a message with the given emoji, or removes your reaction if the reaction is empty.
+//
+// To react to your own messages, pass your JID or an empty JID as the sender. If the device store has a reaction
+// store (see store.ReactionStore), the reaction is also included in the results of GetMessageReactions.
+//
+//	resp, err := cli.SendReaction(context.Background(), evt.Info.Chat, evt.Info.Sender, evt.Info.ID, "👍")
+func (cli *Client) SendReaction(ctx context.Context, chat, sender types.JID, id types.MessageID, reaction string) (SendResponse, error) {
+	resp, err := cli.SendMessage(ctx, chat, "", cli.BuildReaction(chat, sender, id, reaction))
+	if err == nil && cli.Store.Reactions != nil {
+		_, err2 := cli.applyReaction(ctx, chat, cli.Store.ID.ToNonAD(), id, reaction, time.Now())
+		if err2 != nil {
+			cli.Log.Warnf("Failed to store own reaction to %s: %v", id, err2)
+		}
+	}
+	return resp, err
+}
+
+// GetMessageReactions returns the current reactions to the given message.
+//
+// This requires the device store to have a reaction store, e.g. with the TrackReactions option of sqlstore.
+// Only reactions received while the reaction store was enabled are included.
+func (cli *Client) GetMessageReactions(ctx context.Context, chat types.JID, id types.MessageID) (*types.MessageReactions, error) {
+	if cli.Store.Reactions == nil {
+		return nil, ErrNoReactionStore
+	}
+	reactions, err := cli.Store.Reactions.GetReactions(ctx, chat, id)
+	if err != nil {
+		return nil, err
+	}
+	result := &types.MessageReactions{
+		Chat:      chat.ToNonAD(),
+		MessageID: id,
+		Reactions: make(map[string][]types.JID),
+	}
+	for _, reaction := range reactions {
+		result.Reactions[reaction.Text] = append(result.Reactions[reaction.Text], reaction.Sender)
+	}
+	return result, nil
+}
+
+func (cli *Client) applyReaction(ctx context.Context, chat, sender types.JID, id types.MessageID, reaction string, ts time.Time) (*types.MessageReactions, error) {
+	err := cli.Store.Reactions.PutReaction(ctx, &store.MessageReaction{
+		Chat:      chat,
+		MessageID: id,
+		Sender:    sender,
+		Text:      reaction,
+		Timestamp: ts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cli.GetMessageReactions(ctx, chat, id)
+}
+
+func (cli *Client) handleReactionMessage(ctx context.Context, evt *events.Message) {
+	reaction := evt.Message.GetReactionMessage()
+	if reaction == nil {
+		var err error
+		reaction, err = cli.DecryptReaction(evt)
+		if err != nil {
+			cli.Log.Warnf("Failed to decrypt encrypted reaction %s from %s: %v", evt.Info.ID, evt.Info.SourceString(), err)
+			return
+		}
+	}
+	update := &events.ReactionUpdate{
+		Info:     evt.Info,
+		TargetID: reaction.GetKey().GetId(),
+		Reaction: reaction.GetText(),
+		Removed:  reaction.GetText() == RemoveReactionText,
+	}
+	if cli.Store.Reactions != nil && len(update.TargetID) > 0 {
+		ts := evt.Info.Timestamp
+		if reaction.SenderTimestampMs != nil {
+			ts = time.UnixMilli(reaction.GetSenderTimestampMs())
+		}
+		var err error
+		update.Reactions, err = cli.applyReaction(ctx, evt.Info.Chat, evt.Info.Sender.ToNonAD(), update.TargetID, update.Reaction, ts)
+		if err != nil {
+			cli.Log.Warnf("Failed to store reaction %s from %s: %v", evt.Info.ID, evt.Info.SourceString(), err)
+		}
+	}
+	cli.dispatchEvent(update)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// testReactionStore is an in-memory store.ReactionStore that keeps the latest reaction of each sender.
+type testReactionStore struct {
+	reactions map[types.MessageID]map[types.JID]*store.MessageReaction
+}
+
+func (rs *testReactionStore) PutReaction(ctx context.Context, reaction *store.MessageReaction) error {
+	senders, ok := rs.reactions[reaction.MessageID]
+	if !ok {
+		senders = make(map[types.JID]*store.MessageReaction)
+		rs.reactions[reaction.MessageID] = senders
+	}
+	if existing, ok := senders[reaction.Sender]; ok && existing.Timestamp.After(reaction.Timestamp) {
+		return nil
+	} else if len(reaction.Text) == 0 {
+		delete(senders, reaction.Sender)
+	} else {
+		senders[reaction.Sender] = reaction
+	}
+	return nil
+}
+
+func (rs *testReactionStore) GetReactions(ctx context.Context, chat types.JID, id types.MessageID) ([]*store.MessageReaction, error) {
+	var reactions []*store.MessageReaction
+	for _, reaction := range rs.reactions[id] {
+		reactions = append(reactions, reaction)
+	}
+	sort.Slice(reactions, func(i, j int) bool {
+		return reactions[i].Timestamp.Before(reactions[j].Timestamp)
+	})
+	return reactions, nil
+}
+
+func TestHandleReactionMessage(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	cli := NewClient(device, nil)
+	ctx := context.Background()
+	chat := types.NewJID("123456789-987654321", types.GroupServer)
+	alice := types.NewJID("2222", types.DefaultUserServer)
+	bob := types.NewJID("3333", types.DefaultUserServer)
+	if _, err := cli.GetMessageReactions(ctx, chat, "TARGET"); !errors.Is(err, ErrNoReactionStore) {
+		t.Errorf("Expected ErrNoReactionStore, got %v", err)
+	}
+	device.Reactions = &testReactionStore{reactions: make(map[types.MessageID]map[types.JID]*store.MessageReaction)}
+
+	var updates []*events.ReactionUpdate
+	cli.AddEventHandler(func(evt interface{}) {
+		if update, ok := evt.(*events.ReactionUpdate); ok {
+			updates = append(updates, update)
+		}
+	})
+	base := time.Unix(1700000000, 0)
+	react := func(sender types.JID, text string, ts time.Time) {
+		cli.handleReactionMessage(ctx, &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: types.NewADJID(sender.User, 0, 1)},
+				ID:            "REACTION",
+				Timestamp:     base,
+			},
+			Message: &waProto.Message{ReactionMessage: &waProto.ReactionMessage{
+				Key:               &waProto.MessageKey{Id: proto.String("TARGET")},
+				Text:              proto.String(text),
+				SenderTimestampMs: proto.Int64(ts.UnixMilli()),
+			}},
+		})
+	}
+	react(alice, "👍", base.Add(1*time.Second))
+	react(bob, "👍", base.Add(2*time.Second))
+	react(alice, "❤️", base.Add(3*time.Second))
+	// A reaction delivered out of order doesn't replace the newer one
+	react(alice, "😂", base.Add(2500*time.Millisecond))
+
+	if len(updates) != 4 {
+		t.Fatalf("Expected 4 reaction updates, got %d", len(updates))
+	} else if last := updates[3]; last.TargetID != "TARGET" || last.Reaction != "😂" || last.Removed || last.Reactions == nil {
+		t.Fatalf("Unexpected reaction update %+v", last)
+	}
+	counts := updates[3].Reactions.Counts()
+	if len(counts) != 2 || counts["👍"] != 1 || counts["❤️"] != 1 {
+		t.Errorf("Unexpected reaction counts %v", counts)
+	} else if senders := updates[3].Reactions.Reactions["👍"]; senders[0] != bob {
+		t.Errorf("Expected senders to be stored without the device, got %v", senders)
+	}
+
+	react(alice, RemoveReactionText, base.Add(4*time.Second))
+	if update := updates[4]; !update.Removed {
+		t.Error("Expected empty reaction to be a removal")
+	}
+	reactions, err := cli.GetMessageReactions(ctx, chat, "TARGET")
+	if err != nil {
+		t.Fatalf("Failed to get reactions: %v", err)
+	} else if counts = reactions.Counts(); len(counts) != 1 || counts["👍"] != 1 {
+		t.Errorf("Expected only bob's reaction to be left, got %v", counts)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// DefaultReadReceiptBatchDelay is the default value of Client.ReadReceiptBatchDelay.
+const DefaultReadReceiptBatchDelay = 2 * time.Second
+
+type readReceiptBatchKey struct {
+	chat   types.JID
+	sender types.JID
+}
+
+type readReceiptBatch struct {
+	ids       []types.MessageID
+	timestamp time.Time
+}
+
+// MarkReadBatch queues read receipts for the given message IDs and sends them after Client.ReadReceiptBatchDelay.
+// The parameters are the same as in MarkRead.
+//
+// All receipts queued for the same chat (and the same sender in group chats) before the delay runs out are combined
+// into a single receipt stanza, which reduces the number of stanzas a lot for bots that mark every message as read.
+// Failures to send the receipts are only logged. Use FlushReadReceipts to send the queued receipts immediately.
+//
+//	cli.MarkReadBatch([]types.MessageID{evt.Info.ID}, time.Now(), evt.Info.Chat, evt.Info.Sender)
+func (cli *Client) MarkReadBatch(ids []types.MessageID, timestamp time.Time, chat, sender types.JID) {
+	if len(ids) == 0 {
+		return
+	}
+	key := readReceiptBatchKey{chat: chat.ToNonAD()}
+	if chat.Server != types.DefaultUserServer {
+		key.sender = sender.ToNonAD()
+	}
+	cli.readReceiptBatchLock.Lock()
+	defer cli.readReceiptBatchLock.Unlock()
+	if cli.readReceiptBatches == nil {
+		cli.readReceiptBatches = make(map[readReceiptBatchKey]*readReceiptBatch)
+	}
+	batch, ok := cli.readReceiptBatches[key]
+	if !ok {
+		batch = &readReceiptBatch{}
+		cli.readReceiptBatches[key] = batch
+	}
+Outer:
+	for _, id := range ids {
+		for _, existingID := range batch.ids {
+			if existingID == id {
+				continue Outer
+			}
+		}
+		batch.ids = append(batch.ids, id)
+	}
+	if timestamp.After(batch.timestamp) {
+		batch.timestamp = timestamp
+	}
+	if cli.readReceiptBatchTimer == nil {
+		delay := cli.ReadReceiptBatchDelay
+		if delay <= 0 {
+			delay = DefaultReadReceiptBatchDelay
+		}
+		cli.readReceiptBatchTimer = time.AfterFunc(delay, func() {
+			_ = cli.FlushReadReceipts()
+		})
+	}
+}
+
+// FlushReadReceipts sends all read receipts queued with MarkReadBatch right away.
+//
+// Receipts that fail to send are dropped rather than queued again. If any of them fail, the first error is returned.
+func (cli *Client) FlushReadReceipts() error {
+	cli.readReceiptBatchLock.Lock()
+	batches := cli.readReceiptBatches
+	cli.readReceiptBatches = nil
+	if cli.readReceiptBatchTimer != nil {
+		cli.readReceiptBatchTimer.Stop()
+		cli.readReceiptBatchTimer = nil
+	}
+	cli.readReceiptBatchLock.Unlock()
+	var firstErr error
+	for key, batch := range batches {
+		err := cli.MarkRead(batch.ids, batch.timestamp, key.chat, key.sender)
+		if err != nil {
+			cli.Log.Warnf("Failed to send batched read receipt for %d messages in %s: %v", len(batch.ids), key.chat, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestMarkReadBatch(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.ReadReceiptBatchDelay = time.Hour
+	user := types.NewJID("2222", types.DefaultUserServer)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	alice := types.NewADJID("3333", 0, 1)
+	bob := types.NewJID("4444", types.DefaultUserServer)
+	base := time.Unix(1700000000, 0)
+
+	cli.MarkReadBatch(nil, base, user, user)
+	if cli.readReceiptBatches != nil || cli.readReceiptBatchTimer != nil {
+		t.Fatal("Expected empty batch to be ignored")
+	}
+	// Private chats are batched by chat, groups by chat and sender
+	cli.MarkReadBatch([]types.MessageID{"A", "B"}, base.Add(2*time.Second), types.NewADJID("2222", 0, 1), user)
+	cli.MarkReadBatch([]types.MessageID{"B", "C"}, base.Add(1*time.Second), user, types.EmptyJID)
+	cli.MarkReadBatch([]types.MessageID{"D"}, base, group, alice)
+	cli.MarkReadBatch([]types.MessageID{"E"}, base, group, bob)
+	cli.MarkReadBatch([]types.MessageID{"F"}, base.Add(3*time.Second), group, alice.ToNonAD())
+
+	if len(cli.readReceiptBatches) != 3 {
+		t.Fatalf("Expected 3 batches, got %d", len(cli.readReceiptBatches))
+	} else if cli.readReceiptBatchTimer == nil {
+		t.Fatal("Expected flush timer to be started")
+	}
+	expected := map[readReceiptBatchKey]readReceiptBatch{
+		{chat: user}:                           {ids: []types.MessageID{"A", "B", "C"}, timestamp: base.Add(2 * time.Second)},
+		{chat: group, sender: alice.ToNonAD()}: {ids: []types.MessageID{"D", "F"}, timestamp: base.Add(3 * time.Second)},
+		{chat: group, sender: bob}:             {ids: []types.MessageID{"E"}, timestamp: base},
+	}
+	for key, expectedBatch := range expected {
+		batch, ok := cli.readReceiptBatches[key]
+		if !ok {
+			t.Errorf("Missing batch for %+v", key)
+		} else if !reflect.DeepEqual(batch.ids, expectedBatch.ids) || !batch.timestamp.Equal(expectedBatch.timestamp) {
+			t.Errorf("Expected batch for %+v to be %+v, got %+v", key, expectedBatch, *batch)
+		}
+	}
+
+	// Without a connection, sending fails, but the batch is cleared anyway
+	if err := cli.FlushReadReceipts(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected receipts to be sent, got %v", err)
+	}
+	if cli.readReceiptBatches != nil || cli.readReceiptBatchTimer != nil {
+		t.Error("Expected batches and timer to be cleared after flushing")
+	}
+	if err := cli.FlushReadReceipts(); err != nil {
+		t.Errorf("Expected flushing nothing to succeed, got %v", err)
+	}
+}
+
+func TestMarkReadBatchTimer(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	cli.ReadReceiptBatchDelay = 10 * time.Millisecond
+	cli.MarkReadBatch([]types.MessageID{"A"}, time.Now(), types.NewJID("2222", types.DefaultUserServer), types.EmptyJID)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		cli.readReceiptBatchLock.Lock()
+		flushed := cli.readReceiptBatches == nil
+		cli.readReceiptBatchLock.Unlock()
+		if flushed {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Expected batch to be flushed after the delay")
+}
@@ -7,11 +7,16 @@
 package whatsmeow
 
 import (
+	"context"
 	"fmt"
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/protobuf/proto"
+
+	"github.com/insomnius/whatsmeow/appstate"
 	waBinary "github.com/insomnius/whatsmeow/binary"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
 	"github.com/insomnius/whatsmeow/types"
 	"github.com/insomnius/whatsmeow/types/events"
 )
@@ -29,6 +34,10 @@ func (cli *Client) handleReceipt(node *waBinary.Node) {
 				}
 			}()
 		}
+		cli.notifyDeliveryWaiters(receipt)
+		if receipt.IsFromMe && (receipt.Type == events.ReceiptTypeRead || receipt.Type == events.ReceiptTypeReadSelf) {
+			cli.trackUnreadRead(receipt.Chat, receipt.MessageIDs, receipt.Timestamp)
+		}
 		go cli.dispatchEvent(receipt)
 	}
 	go cli.sendAck(node)
@@ -50,6 +59,7 @@ func (cli *Client) handleGroupedReceipt(partialReceipt events.Receipt, participa
 			cli.Log.Warnf("Failed to parse user node %s in grouped receipt: %v", child.XMLString(), ag.Error())
 			continue
 		}
+		cli.notifyDeliveryWaiters(&receipt)
 		go cli.dispatchEvent(&receipt)
 	}
 }
@@ -125,6 +135,9 @@ func (cli *Client) sendAck(node *waBinary.Node) {
 // The first JID parameter (chat) must always be set to the chat ID (user ID in DMs and group ID in group chats).
 // The second JID parameter (sender) must be set in group chats and must be the user ID who sent the message.
 func (cli *Client) MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID) error {
+	// Read receipts are still allowed during shutdown, as they might be sent by event handlers that Shutdown waits for.
+	_ = cli.startOperation(false)
+	defer cli.finishOperation()
 	node := waBinary.Node{
 		Tag: "receipt",
 		Attrs: waBinary.Attrs{
@@ -151,7 +164,71 @@ func (cli *Client) MarkRead(ids []types.MessageID, timestamp time.Time, chat, se
 			Content: children,
 		}}
 	}
-	return cli.sendNode(node)
+	err := cli.sendNode(node)
+	if err == nil {
+		cli.trackUnreadRead(chat, ids, timestamp)
+	}
+	return err
+}
+
+// MarkChatAsRead marks a whole chat as read up to the given message on all of the user's devices.
+//
+// It sends read receipts for the unread messages and a markChatAsRead app state patch, so that the chat is also shown
+// as read in the official apps. If lastMessage is nil, the chat is marked as read up to now.
+//
+// Read receipts can only be sent for messages whose IDs are known: if EnableUnreadTracking is set, they're sent for
+// all tracked unread messages up to lastMessage. Otherwise, only lastMessage itself gets a read receipt.
+//
+//	err := cli.MarkChatAsRead(ctx, evt.Info.Chat, &evt.Info)
+func (cli *Client) MarkChatAsRead(ctx context.Context, chat types.JID, lastMessage *types.MessageInfo) error {
+	chat = chat.ToNonAD()
+	unread := cli.unreadMessagesUntil(chat, lastMessage)
+	if len(unread) == 0 && lastMessage != nil && !lastMessage.IsFromMe {
+		unread = []unreadMessage{{id: lastMessage.ID, sender: lastMessage.Sender, timestamp: lastMessage.Timestamp}}
+	}
+	// Read receipts in groups are per sender, but DMs only need one
+	var senders []types.JID
+	idsBySender := make(map[types.JID][]types.MessageID)
+	for _, msg := range unread {
+		var sender types.JID
+		if chat.Server != types.DefaultUserServer {
+			sender = msg.sender.ToNonAD()
+		}
+		if _, ok := idsBySender[sender]; !ok {
+			senders = append(senders, sender)
+		}
+		idsBySender[sender] = append(idsBySender[sender], msg.id)
+	}
+	now := time.Now()
+	for _, sender := range senders {
+		err := cli.MarkRead(idsBySender[sender], now, chat, sender)
+		if err != nil {
+			return fmt.Errorf("failed to send read receipt: %w", err)
+		}
+	}
+
+	lastTimestamp := now
+	var lastKey *waProto.MessageKey
+	if lastMessage == nil && len(unread) > 0 {
+		newest := unread[len(unread)-1]
+		lastMessage = &types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: newest.sender, IsGroup: chat.Server == types.GroupServer},
+			ID:            newest.id,
+			Timestamp:     newest.timestamp,
+		}
+	}
+	if lastMessage != nil {
+		lastTimestamp = lastMessage.Timestamp
+		lastKey = &waProto.MessageKey{
+			RemoteJid: proto.String(chat.String()),
+			FromMe:    proto.Bool(lastMessage.IsFromMe),
+			Id:        proto.String(lastMessage.ID),
+		}
+		if lastMessage.IsGroup && !lastMessage.IsFromMe {
+			lastKey.Participant = proto.String(lastMessage.Sender.ToNonAD().String())
+		}
+	}
+	return cli.SendAppState(ctx, appstate.BuildMarkChatAsRead(chat, true, lastTimestamp, lastKey))
 }
 
 // SetForceActiveDeliveryReceipts will force the client to send normal delivery
@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// ReconnectPolicy decides whether and when the client should try to reconnect after the websocket is closed by the server.
+type ReconnectPolicy interface {
+	// NextReconnect is called before each reconnection attempt. The attempt number starts from 1 and is reset after
+	// a successful connection. The error is the reason why the previous connection or reconnection attempt failed,
+	// or nil if the server closed the websocket without a reason.
+	//
+	// It returns how long to wait before the attempt, or false if the client should stop reconnecting.
+	NextReconnect(attempt int, err error) (delay time.Duration, ok bool)
+}
+
+// ExponentialBackoff is a ReconnectPolicy that waits exponentially longer between attempts.
+type ExponentialBackoff struct {
+	// MaxAttempts is the number of attempts after which the client stops reconnecting. Zero means no limit.
+	MaxAttempts int
+	// InitialDelay is the delay before the first attempt.
+	InitialDelay time.Duration
+	// ImmediateFirstAttempt makes the first attempt without any delay. The delays of the following attempts
+	// start from InitialDelay, i.e. the second attempt waits InitialDelay, the third InitialDelay*Multiplier and so on.
+	ImmediateFirstAttempt bool
+	// MaxDelay caps the delay between attempts. Zero means no limit.
+	MaxDelay time.Duration
+	// Multiplier is the factor by which the delay grows after each attempt. Values below 1 are treated as 2.
+	Multiplier float64
+	// Jitter randomizes each delay by up to the given fraction in either direction, e.g. 0.2 means ±20%,
+	// so that many clients disconnected at the same time don't all reconnect at once.
+	Jitter float64
+	// StopCodes are the ServerDisconnectError codes after which the policy stops reconnecting immediately,
+	// e.g. 401 and 403 mean that the session is no longer valid and reconnecting won't help.
+	StopCodes []int
+}
+
+// DefaultReconnectPolicy is the ReconnectPolicy used by clients that don't have one set.
+// It reconnects immediately after the first disconnection and never gives up unless the server rejects
+// the connection with a 401 or 403 code. The client doesn't reconnect at all after connect failures like logouts and bans.
+var DefaultReconnectPolicy ReconnectPolicy = &ExponentialBackoff{
+	InitialDelay:          2 * time.Second,
+	ImmediateFirstAttempt: true,
+	MaxDelay:              5 * time.Minute,
+	Multiplier:            2,
+	Jitter:                0.2,
+	StopCodes:             []int{401, 403},
+}
+
+// NextReconnect implements ReconnectPolicy.
+func (eb *ExponentialBackoff) NextReconnect(attempt int, err error) (time.Duration, bool) {
+	var sde *ServerDisconnectError
+	if errors.As(err, &sde) && eb.isStopCode(sde.Code) {
+		return 0, false
+	} else if eb.MaxAttempts > 0 && attempt > eb.MaxAttempts {
+		return 0, false
+	}
+	exponent := attempt - 1
+	if eb.ImmediateFirstAttempt {
+		if attempt == 1 {
+			return 0, true
+		}
+		exponent--
+	}
+	multiplier := eb.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(eb.InitialDelay) * math.Pow(multiplier, float64(exponent))
+	if eb.MaxDelay > 0 && delay > float64(eb.MaxDelay) {
+		delay = float64(eb.MaxDelay)
+	}
+	if eb.Jitter > 0 {
+		delay += delay * eb.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay), true
+}
+
+func (eb *ExponentialBackoff) isStopCode(code int) bool {
+	for _, stopCode := range eb.StopCodes {
+		if stopCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (cli *Client) reconnectPolicy() ReconnectPolicy {
+	if cli.ReconnectPolicy != nil {
+		return cli.ReconnectPolicy
+	}
+	return DefaultReconnectPolicy
+}
+
+func (cli *Client) autoReconnect(err error) {
+	if !cli.EnableAutoReconnect || cli.Store.ID == nil {
+		return
+	}
+	policy := cli.reconnectPolicy()
+	for {
+		attempt := cli.AutoReconnectErrors + 1
+		delay, ok := policy.NextReconnect(attempt, err)
+		if !ok {
+			cli.Log.Warnf("Reconnect policy gave up after %d attempts (last error: %v)", cli.AutoReconnectErrors, err)
+			cli.dispatchEvent(&events.ReconnectStopped{Attempts: cli.AutoReconnectErrors, Error: err})
+			return
+		}
+		cli.Log.Debugf("Automatically reconnecting after %v (attempt #%d)", delay, attempt)
+		cli.AutoReconnectErrors = attempt
+		cli.dispatchEvent(&events.ReconnectAttempt{Attempt: attempt, Delay: delay, Error: err})
+		time.Sleep(delay)
+		err = cli.Connect()
+		if errors.Is(err, ErrAlreadyConnected) {
+			cli.Log.Debugf("Connect() said we're already connected after autoreconnect sleep")
+			return
+		} else if err != nil {
+			cli.Log.Errorf("Error reconnecting after autoreconnect sleep: %v", err)
+		} else {
+			return
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	policy := &whatsmeow.ExponentialBackoff{
+		MaxAttempts:  5,
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, expectedDelay := range expected {
+		if delay, ok := policy.NextReconnect(i+1, nil); !ok || delay != expectedDelay {
+			t.Errorf("Expected attempt #%d to wait %v, got %v (%t)", i+1, expectedDelay, delay, ok)
+		}
+	}
+	if _, ok := policy.NextReconnect(6, nil); ok {
+		t.Errorf("Expected policy to give up after max attempts")
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay, _ := policy.NextReconnect(2, nil); delay < time.Second || delay > 3*time.Second {
+			t.Fatalf("Jittered delay %v is out of range", delay)
+		}
+	}
+}
+
+func TestExponentialBackoffImmediateFirstAttempt(t *testing.T) {
+	policy := &whatsmeow.ExponentialBackoff{InitialDelay: time.Second, Multiplier: 2, ImmediateFirstAttempt: true}
+	expected := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, expectedDelay := range expected {
+		if delay, ok := policy.NextReconnect(i+1, nil); !ok || delay != expectedDelay {
+			t.Errorf("Expected attempt #%d to wait %v, got %v (%t)", i+1, expectedDelay, delay, ok)
+		}
+	}
+	if delay, ok := whatsmeow.DefaultReconnectPolicy.NextReconnect(1, nil); !ok || delay != 0 {
+		t.Errorf("Expected the default policy to reconnect immediately, got %v (%t)", delay, ok)
+	}
+}
+
+func TestExponentialBackoffStopCodes(t *testing.T) {
+	policy := &whatsmeow.ExponentialBackoff{InitialDelay: time.Second, StopCodes: []int{401, 403}}
+	forbidden := fmt.Errorf("stream error: %w", &whatsmeow.ServerDisconnectError{Code: 403})
+	if _, ok := policy.NextReconnect(1, forbidden); ok {
+		t.Error("Expected policy to give up after 403 error")
+	}
+	unavailable := &whatsmeow.ServerDisconnectError{Code: 503}
+	if _, ok := policy.NextReconnect(1, unavailable); !ok {
+		t.Error("Expected policy to keep reconnecting after 503 error")
+	}
+	policy.StopCodes = nil
+	if _, ok := policy.NextReconnect(1, forbidden); !ok {
+		t.Error("Expected policy without stop codes to keep reconnecting after 403 error")
+	}
+	if _, ok := whatsmeow.DefaultReconnectPolicy.NextReconnect(1, &whatsmeow.ServerDisconnectError{Code: 401}); ok {
+		t.Error("Expected the default policy to give up after 401 error")
+	}
+}
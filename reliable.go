@@ -0,0 +1,221 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// SendOutcome is the result of SendMessageReliable.
+type SendOutcome int
+
+const (
+	// SendFailed means the message couldn't be sent even after retrying.
+	SendFailed SendOutcome = iota
+	// SendServerAcked means the server accepted the message, but no delivery receipt was received in time.
+	SendServerAcked
+	// SendDelivered means a delivery receipt (or a read or played receipt) was received for the message.
+	SendDelivered
+)
+
+// String returns a human-readable name for the outcome.
+func (so SendOutcome) String() string {
+	switch so {
+	case SendServerAcked:
+		return "server acked"
+	case SendDelivered:
+		return "delivered"
+	default:
+		return "failed"
+	}
+}
+
+// ReliableSendPolicy configures retries and delivery tracking for SendMessageReliable.
+type ReliableSendPolicy struct {
+	// MaxAttempts is the maximum number of times to try sending the message. Defaults to 3.
+	MaxAttempts int
+	// AckTimeout is how long to wait for the server to acknowledge each attempt. Defaults to 30 seconds.
+	AckTimeout time.Duration
+	// RetryDelay is the delay between attempts. Defaults to 2 seconds.
+	RetryDelay time.Duration
+	// DeliveryTimeout is how long to wait for a delivery receipt after the server has acknowledged the message.
+	// If it's zero, delivery receipts aren't waited for and the best outcome is SendServerAcked.
+	DeliveryTimeout time.Duration
+}
+
+// DefaultReliableSendPolicy is used by SendMessageReliable if the policy is nil.
+var DefaultReliableSendPolicy = ReliableSendPolicy{
+	MaxAttempts:     3,
+	AckTimeout:      30 * time.Second,
+	RetryDelay:      2 * time.Second,
+	DeliveryTimeout: 1 * time.Minute,
+}
+
+// ReliableSendResponse is the return value of SendMessageReliable.
+type ReliableSendResponse struct {
+	SendResponse
+	Outcome SendOutcome
+	// The number of attempts that were made to send the message.
+	Attempts int
+	// The receipt that marked the message as delivered, if the outcome is SendDelivered.
+	Receipt *events.Receipt
+}
+
+// isRetryableSendError returns true if the error means that the message may not have reached the server,
+// so sending it again with the same ID is safe and may succeed.
+func isRetryableSendError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrMessageTimedOut) ||
+		errors.Is(err, ErrNotConnected) ||
+		errors.Is(err, ErrIQDisconnected)
+}
+
+// SendMessageReliable sends a message like SendMessage, but retries with the same message ID if the server
+// doesn't acknowledge it in time, and optionally waits for a delivery receipt.
+//
+// The message is never put in the outbox, attempts made while disconnected just fail and are retried after RetryDelay.
+// If the message couldn't be sent, the outcome is SendFailed and the error from the last attempt is returned.
+//
+//	resp, err := cli.SendMessageReliable(ctx, chat, &waProto.Message{Conversation: proto.String("hi")}, nil)
+//	if resp.Outcome == whatsmeow.SendDelivered {
+//		// The recipient's phone has received the message
+//	}
+func (cli *Client) SendMessageReliable(ctx context.Context, to types.JID, message *waProto.Message, policy *ReliableSendPolicy) (resp ReliableSendResponse, err error) {
+	if policy == nil {
+		policy = &DefaultReliableSendPolicy
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultReliableSendPolicy.MaxAttempts
+	}
+	ackTimeout := policy.AckTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = DefaultReliableSendPolicy.AckTimeout
+	}
+	retryDelay := policy.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = DefaultReliableSendPolicy.RetryDelay
+	}
+	if to.AD && to.User != cli.Store.ID.User {
+		err = ErrRecipientADJID
+		return
+	}
+
+	id := GenerateMessageID()
+	resp.ID = id
+	var delivered chan *events.Receipt
+	if policy.DeliveryTimeout > 0 {
+		// Register the waiter before sending, in case the receipt arrives before the server ack is processed
+		delivered = cli.addDeliveryWaiter(id)
+		defer cli.removeDeliveryWaiter(id, delivered)
+	}
+
+	for resp.Attempts < maxAttempts {
+		if resp.Attempts > 0 {
+			cli.Log.Debugf("Retrying sending %s to %s in %s (attempt %d/%d): %v", id, to, retryDelay, resp.Attempts+1, maxAttempts, err)
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+		resp.Attempts++
+		err = cli.sendReliableAttempt(ctx, to, id, message, ackTimeout, &resp.SendResponse)
+		if err == nil {
+			break
+		} else if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		} else if !isRetryableSendError(err) {
+			return
+		}
+	}
+	if err != nil {
+		return
+	}
+	resp.Outcome = SendServerAcked
+	if delivered == nil {
+		return
+	}
+	select {
+	case resp.Receipt = <-delivered:
+		resp.Outcome = SendDelivered
+	case <-time.After(policy.DeliveryTimeout):
+		cli.Log.Debugf("Didn't get delivery receipt for %s in %s", id, policy.DeliveryTimeout)
+	case <-ctx.Done():
+	}
+	return
+}
+
+func (cli *Client) sendReliableAttempt(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message, timeout time.Duration, resp *SendResponse) error {
+	if err := cli.startOperation(true); err != nil {
+		return err
+	}
+	defer cli.finishOperation()
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var err error
+	*resp, err = cli.sendMessage(attemptCtx, to, id, message)
+	return err
+}
+
+func (cli *Client) addDeliveryWaiter(id types.MessageID) chan *events.Receipt {
+	ch := make(chan *events.Receipt, 1)
+	cli.deliveryWaitersLock.Lock()
+	if cli.deliveryWaiters == nil {
+		cli.deliveryWaiters = make(map[types.MessageID][]chan<- *events.Receipt)
+	}
+	cli.deliveryWaiters[id] = append(cli.deliveryWaiters[id], ch)
+	cli.deliveryWaitersLock.Unlock()
+	return ch
+}
+
+func (cli *Client) removeDeliveryWaiter(id types.MessageID, ch chan *events.Receipt) {
+	cli.deliveryWaitersLock.Lock()
+	defer cli.deliveryWaitersLock.Unlock()
+	waiters := cli.deliveryWaiters[id]
+	for i, waiter := range waiters {
+		if waiter == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(cli.deliveryWaiters, id)
+	} else {
+		cli.deliveryWaiters[id] = waiters
+	}
+}
+
+func (cli *Client) notifyDeliveryWaiters(receipt *events.Receipt) {
+	switch receipt.Type {
+	case events.ReceiptTypeDelivered, events.ReceiptTypeRead, events.ReceiptTypePlayed:
+	default:
+		return
+	}
+	cli.deliveryWaitersLock.Lock()
+	defer cli.deliveryWaitersLock.Unlock()
+	if len(cli.deliveryWaiters) == 0 {
+		return
+	}
+	for _, id := range receipt.MessageIDs {
+		for _, waiter := range cli.deliveryWaiters[id] {
+			select {
+			case waiter <- receipt:
+			default:
+				// Already got a receipt
+			}
+		}
+	}
+}
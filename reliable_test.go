@@ -0,0 +1,105 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestIsRetryableSendError(t *testing.T) {
+	tests := map[error]bool{
+		ErrNotConnected:                              true,
+		ErrMessageTimedOut:                           true,
+		ErrIQDisconnected:                            true,
+		context.DeadlineExceeded:                     true,
+		fmt.Errorf("wrapped: %w", ErrIQDisconnected): true,
+		ErrRecipientADJID:                            false,
+		ErrServerReturnedError:                       false,
+		errors.New("something else"):                 false,
+	}
+	for err, expected := range tests {
+		if retryable := isRetryableSendError(err); retryable != expected {
+			t.Errorf("isRetryableSendError(%v) = %t, expected %t", err, retryable, expected)
+		}
+	}
+}
+
+func TestSendMessageReliableRetries(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	cli := NewClient(device, nil)
+
+	resp, err := cli.SendMessageReliable(context.Background(), types.NewJID("2222", types.DefaultUserServer), &waProto.Message{
+		Conversation: proto.String("hi"),
+	}, &ReliableSendPolicy{MaxAttempts: 3, RetryDelay: time.Millisecond, DeliveryTimeout: time.Second})
+	if !isRetryableSendError(err) {
+		t.Fatalf("Expected retryable error from the last attempt while disconnected, got %v", err)
+	} else if resp.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", resp.Attempts)
+	} else if resp.Outcome != SendFailed {
+		t.Errorf("Expected outcome to be failed, got %s", resp.Outcome)
+	}
+	if len(cli.deliveryWaiters) != 0 {
+		t.Errorf("Expected delivery waiter to be removed, got %v", cli.deliveryWaiters)
+	}
+
+	_, err = cli.SendMessageReliable(context.Background(), types.NewADJID("2222", 0, 1), &waProto.Message{}, nil)
+	if !errors.Is(err, ErrRecipientADJID) {
+		t.Errorf("Expected ErrRecipientADJID, got %v", err)
+	}
+}
+
+func TestDeliveryWaiters(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	first := cli.addDeliveryWaiter("msg1")
+	second := cli.addDeliveryWaiter("msg1")
+	other := cli.addDeliveryWaiter("msg2")
+
+	// Sender receipts from our other devices don't mean the message was delivered to the recipient
+	cli.notifyDeliveryWaiters(&events.Receipt{MessageIDs: []types.MessageID{"msg1"}, Type: events.ReceiptTypeSender})
+	receipt := &events.Receipt{MessageIDs: []types.MessageID{"msg1"}, Type: events.ReceiptTypeDelivered}
+	cli.notifyDeliveryWaiters(receipt)
+	// A second receipt must not block even though the channels are full
+	cli.notifyDeliveryWaiters(&events.Receipt{MessageIDs: []types.MessageID{"msg1"}, Type: events.ReceiptTypeRead})
+	for i, ch := range []chan *events.Receipt{first, second} {
+		select {
+		case got := <-ch:
+			if got != receipt {
+				t.Errorf("Waiter %d got the wrong receipt %+v", i, got)
+			}
+		default:
+			t.Errorf("Waiter %d didn't get a receipt", i)
+		}
+	}
+	select {
+	case got := <-other:
+		t.Errorf("Waiter for another message got a receipt %+v", got)
+	default:
+	}
+
+	cli.removeDeliveryWaiter("msg1", first)
+	if waiters := cli.deliveryWaiters["msg1"]; len(waiters) != 1 {
+		t.Errorf("Expected one waiter to be left for msg1, got %d", len(waiters))
+	}
+	cli.removeDeliveryWaiter("msg1", second)
+	cli.removeDeliveryWaiter("msg2", other)
+	if len(cli.deliveryWaiters) != 0 {
+		t.Errorf("Expected all waiters to be removed, got %v", cli.deliveryWaiters)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// BuildReply returns a copy of the given content that replies to (quotes) the given received message.
+// The built message can be sent normally using Client.SendMessage.
+//
+// Any message type with a ContextInfo can be used as the content, plain Conversation messages are converted to
+// ExtendedTextMessages. The quoted message can be of any type, including media and polls.
+//
+//	resp, err := cli.SendMessage(context.Background(), evt.Info.Chat, "", cli.BuildReply(evt, &waProto.Message{
+//		Conversation: proto.String("hello"),
+//	}))
+func (cli *Client) BuildReply(quoted *events.Message, content *waProto.Message) *waProto.Message {
+	return cli.BuildReplyTo(quoted.Info.MessageSource, quoted.Info.ID, quoted.Message, content)
+}
+
+// BuildReplyTo is like BuildReply, but takes the source, ID and content of the quoted message separately.
+// This is useful for replying to messages that were stored earlier, rather than a message event.
+func (cli *Client) BuildReplyTo(source types.MessageSource, id types.MessageID, quotedMessage, content *waProto.Message) *waProto.Message {
+	content = proto.Clone(content).(*waProto.Message)
+	if content.Conversation != nil {
+		content.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: content.Conversation}
+		content.Conversation = nil
+	}
+	holder, field := findContextInfoHolder(content.ProtoReflect())
+	if holder == nil {
+		cli.Log.Warnf("Can't add reply context to %s message", getTypeFromMessage(content))
+		return content
+	}
+	ctxInfo := holder.Mutable(field).Message().Interface().(*waProto.ContextInfo)
+	ctxInfo.StanzaId = proto.String(id)
+	ctxInfo.Participant = proto.String(source.Sender.ToNonAD().String())
+	if source.Chat == types.StatusBroadcastJID {
+		ctxInfo.RemoteJid = proto.String(source.Chat.String())
+	} else {
+		ctxInfo.RemoteJid = nil
+	}
+	ctxInfo.QuotedMessage = stripQuotedMessage(quotedMessage)
+	return content
+}
+
+// stripQuotedMessage makes a copy of a message for including it in the ContextInfo of a reply.
+// The copy doesn't contain the message secret or the quoted message's own reply context,
+// so that reply chains don't keep growing.
+func stripQuotedMessage(msg *waProto.Message) *waProto.Message {
+	if msg == nil {
+		return nil
+	}
+	msg = proto.Clone(msg).(*waProto.Message)
+	msg.MessageContextInfo = nil
+	if ctxInfo := getContextInfo(msg); ctxInfo != nil {
+		ctxInfo.QuotedMessage = nil
+		ctxInfo.StanzaId = nil
+		ctxInfo.Participant = nil
+		ctxInfo.RemoteJid = nil
+	}
+	return msg
+}
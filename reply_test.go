@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestBuildReply(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	sender := types.NewADJID("2222", 0, 3)
+	quoted := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: types.NewJID("123456789-987654321", types.GroupServer), Sender: sender},
+			ID:            "QUOTED",
+		},
+		Message: &waProto.Message{
+			ExtendedTextMessage: &waProto.ExtendedTextMessage{
+				Text: proto.String("original"),
+				ContextInfo: &waProto.ContextInfo{
+					StanzaId:      proto.String("OLDER"),
+					Participant:   proto.String("3333@s.whatsapp.net"),
+					QuotedMessage: &waProto.Message{Conversation: proto.String("older message")},
+				},
+			},
+			MessageContextInfo: &waProto.MessageContextInfo{MessageSecret: []byte("secret")},
+		},
+	}
+	content := &waProto.Message{Conversation: proto.String("reply")}
+	reply := cli.BuildReply(quoted, content)
+
+	if content.Conversation == nil {
+		t.Error("The content message was modified")
+	}
+	if reply.GetExtendedTextMessage().GetText() != "reply" {
+		t.Fatalf("Expected reply to be an extended text message, got %v", reply)
+	}
+	ctxInfo := reply.GetExtendedTextMessage().GetContextInfo()
+	if ctxInfo.GetStanzaId() != "QUOTED" {
+		t.Errorf("Expected stanza ID QUOTED, got %q", ctxInfo.GetStanzaId())
+	} else if ctxInfo.GetParticipant() != "2222@s.whatsapp.net" {
+		t.Errorf("Expected participant without device, got %q", ctxInfo.GetParticipant())
+	} else if ctxInfo.RemoteJid != nil {
+		t.Errorf("Expected no remote JID outside status broadcasts, got %q", ctxInfo.GetRemoteJid())
+	}
+	expectedQuoted := &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+		Text:        proto.String("original"),
+		ContextInfo: &waProto.ContextInfo{},
+	}}
+	if !proto.Equal(ctxInfo.GetQuotedMessage(), expectedQuoted) {
+		t.Errorf("Expected stripped quoted message, got %v", ctxInfo.GetQuotedMessage())
+	}
+	if quoted.Message.GetExtendedTextMessage().GetContextInfo().GetQuotedMessage() == nil || quoted.Message.MessageContextInfo == nil {
+		t.Error("The quoted message was modified")
+	}
+}
+
+func TestBuildReplyTo_StatusBroadcast(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	source := types.MessageSource{Chat: types.StatusBroadcastJID, Sender: types.NewJID("2222", types.DefaultUserServer)}
+	reply := cli.BuildReplyTo(source, "STATUS", &waProto.Message{ImageMessage: &waProto.ImageMessage{}}, &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String("nice")},
+	})
+	if remoteJID := reply.GetExtendedTextMessage().GetContextInfo().GetRemoteJid(); remoteJID != types.StatusBroadcastJID.String() {
+		t.Errorf("Expected remote JID to be the status broadcast, got %q", remoteJID)
+	}
+	// Reactions can't quote messages, so they're returned as-is
+	reaction := &waProto.Message{ReactionMessage: &waProto.ReactionMessage{Text: proto.String("👍")}}
+	if result := cli.BuildReplyTo(source, "STATUS", nil, reaction); !proto.Equal(result, reaction) {
+		t.Errorf("Expected reaction to be unchanged, got %v", result)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/insomnius/whatsmeow/appstate"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// RequirePairing is emitted when Client.ReregisterOnLogout is enabled and the device was logged out remotely.
+// The client has already switched to a fresh device with new keys and connected to get new QR codes,
+// so the codes from QRChannel just need to be shown to the user.
+//
+// It's defined in this package rather than in the events package, as it contains a QR channel.
+type RequirePairing struct {
+	// The LoggedOut event that caused the client to re-register.
+	LoggedOut *events.LoggedOut
+	// The channel with QR codes for pairing the new device, as returned by GetQRChannelWithOptions.
+	QRChannel <-chan QRChannelItem
+}
+
+// ReregistrationFailed is emitted if Client.ReregisterOnLogout is enabled, but starting to pair a new device failed.
+type ReregistrationFailed struct {
+	LoggedOut *events.LoggedOut
+	Error     error
+}
+
+type deviceCreator interface {
+	NewDevice() *store.Device
+}
+
+func (cli *Client) handleLoggedOut(evt *events.LoggedOut) {
+	cli.dispatchEvent(evt)
+	if !cli.ReregisterOnLogout {
+		return
+	}
+	qrChan, err := cli.reregister()
+	if err != nil {
+		cli.Log.Errorf("Failed to re-register after logout: %v", err)
+		cli.dispatchEvent(&ReregistrationFailed{LoggedOut: evt, Error: err})
+		return
+	}
+	cli.dispatchEvent(&RequirePairing{LoggedOut: evt, QRChannel: qrChan})
+}
+
+// reregister replaces the deleted device with a new one from the same container and connects to start pairing.
+func (cli *Client) reregister() (<-chan QRChannelItem, error) {
+	container, ok := cli.Store.Container.(deviceCreator)
+	if !ok {
+		return nil, fmt.Errorf("device container %T can't create new devices", cli.Store.Container)
+	}
+	cli.Disconnect()
+	oldDevice := cli.Store
+	newDevice := container.NewDevice()
+	if oldDevice.DatabaseErrorHandler != nil {
+		newDevice.DatabaseErrorHandler = oldDevice.DatabaseErrorHandler
+	}
+	// Connect reads the store while holding the socket lock, so hold it too to make sure
+	// a concurrent Connect call doesn't see a half-replaced device.
+	cli.socketLock.Lock()
+	cli.Store = newDevice
+	cli.appStateProc = appstate.NewProcessor(newDevice, cli.Log.Sub("AppState"))
+	cli.socketLock.Unlock()
+	cli.resetAccountState()
+	cli.Log.Infof("Switched to a new device after logout, connecting to get new QR codes")
+	qrc, qrChan, err := cli.newQRChannel(context.Background(), cli.ReregisterQROptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get QR channel: %w", err)
+	}
+	err = cli.Connect()
+	if err != nil {
+		err = fmt.Errorf("failed to connect: %w", err)
+		qrc.closeWithError(err)
+		return nil, err
+	}
+	return qrChan, nil
+}
+
+// resetAccountState clears everything the client has cached about the previous account,
+// so that none of it is used with the new device after re-registering.
+func (cli *Client) resetAccountState() {
+	cli.groupParticipantsCacheLock.Lock()
+	cli.groupParticipantsCache = make(map[types.JID][]types.JID)
+	cli.groupParticipantsCacheLock.Unlock()
+	cli.groupInfoCacheLock.Lock()
+	cli.groupInfoCache = make(map[types.JID]*types.GroupInfo)
+	cli.groupInfoCacheLock.Unlock()
+	cli.userDevicesCacheLock.Lock()
+	cli.userDevicesCache = make(map[types.JID][]types.JID)
+	cli.userDevicesCacheLock.Unlock()
+	cli.disappearingTimersLock.Lock()
+	cli.disappearingTimers = make(map[types.JID]time.Duration)
+	cli.disappearingTimersLock.Unlock()
+	cli.unreadChatsLock.Lock()
+	cli.unreadChats = make(map[types.JID]*unreadChat)
+	cli.unreadChatsLock.Unlock()
+	cli.outboxLock.Lock()
+	cli.outboxCallbacks = nil
+	cli.outboxFlushing = false
+	cli.outboxKnownEmpty = false
+	cli.outboxLock.Unlock()
+	cli.mediaConnLock.Lock()
+	cli.mediaConnCache = nil
+	cli.mediaConnLock.Unlock()
+	cli.privacySettingsCache.Store((*types.PrivacySettings)(nil))
+	cli.recentMessagesLock.Lock()
+	cli.recentMessagesMap = make(map[recentMessageKey]*waProto.Message, recentMessagesSize)
+	cli.recentMessagesList = [recentMessagesSize]recentMessageKey{}
+	cli.recentMessagesPtr = 0
+	cli.recentMessagesLock.Unlock()
+	cli.messageRetriesLock.Lock()
+	cli.messageRetries = make(map[string]int)
+	cli.messageRetriesLock.Unlock()
+	cli.sessionRecreateHistoryLock.Lock()
+	cli.sessionRecreateHistory = make(map[types.JID]time.Time)
+	cli.sessionRecreateHistoryLock.Unlock()
+	cli.appStateKeyRequestsLock.Lock()
+	cli.appStateKeyRequests = make(map[string]time.Time)
+	cli.appStateKeyRequestsLock.Unlock()
+	cli.uploadPreKeysLock.Lock()
+	cli.lastPreKeyUpload = time.Time{}
+	cli.uploadPreKeysLock.Unlock()
+}
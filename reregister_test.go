@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestReregisterOnLogout(t *testing.T) {
+	ctx := context.Background()
+	container := inmemstore.New(nil)
+	oldDevice := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	oldDevice.ID = &jid
+	if err := oldDevice.Save(ctx); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+
+	cli := NewClient(oldDevice, nil)
+	cli.ReregisterOnLogout = true
+	errOffline := errors.New("offline")
+	cli.SetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errOffline
+	})
+	var failed *ReregistrationFailed
+	cli.AddEventHandler(func(evt interface{}) {
+		if evt, ok := evt.(*ReregistrationFailed); ok {
+			failed = evt
+		}
+	})
+
+	group := types.NewJID("123-456", types.GroupServer)
+	cli.groupInfoCache[group] = &types.GroupInfo{JID: group}
+	cli.groupParticipantsCache[group] = []types.JID{jid.ToNonAD()}
+	cli.disappearingTimers[group] = time.Hour
+	cli.unreadChats[group] = &unreadChat{}
+	cli.outboxKnownEmpty = true
+	cli.privacySettingsCache.Store(&types.PrivacySettings{})
+	oldProcessor := cli.appStateProc
+
+	cli.handleLoggedOut(&events.LoggedOut{Reason: events.ConnectFailureLoggedOut})
+
+	// There's no server to connect to, but everything before connecting should have been done
+	if failed == nil || !errors.Is(failed.Error, errOffline) {
+		t.Fatalf("expected re-registration to fail with the dial error, got %+v", failed)
+	}
+	if cli.Store == oldDevice || cli.Store.ID != nil || cli.Store.Container != container {
+		t.Fatal("client didn't switch to a new device from the same container")
+	} else if *cli.Store.IdentityKey.Priv == *oldDevice.IdentityKey.Priv {
+		t.Fatal("new device has the same keys as the old one")
+	}
+	if cli.appStateProc == oldProcessor || cli.appStateProc.Store != cli.Store {
+		t.Fatal("app state processor wasn't recreated for the new device")
+	}
+	if len(cli.groupInfoCache) != 0 || len(cli.groupParticipantsCache) != 0 || len(cli.disappearingTimers) != 0 || len(cli.unreadChats) != 0 {
+		t.Fatal("caches of the old account weren't cleared")
+	} else if cli.outboxKnownEmpty {
+		t.Fatal("outbox state of the old account wasn't cleared")
+	} else if settings, _ := cli.privacySettingsCache.Load().(*types.PrivacySettings); settings != nil {
+		t.Fatal("privacy settings of the old account weren't cleared")
+	}
+}
@@ -223,10 +223,19 @@ func (cli *Client) sendRetryReceipt(node *waBinary.Node, forceIncludeIdentity bo
 		cli.messageRetries[id] = retryCount
 	}
 	cli.messageRetriesLock.Unlock()
-	if retryCount >= 5 {
+	policy := cli.retryPolicy()
+	if maxRetries := policy.maxRetries(); retryCount > maxRetries {
 		cli.Log.Warnf("Not sending any more retry receipts for %s", id)
+		if retryCount == maxRetries+1 {
+			cli.permanentDecryptFailure(node, maxRetries)
+		}
 		return
 	}
+	if policy.Backoff != nil {
+		if delay := policy.Backoff(retryCount); delay > 0 {
+			time.Sleep(delay)
+		}
+	}
 
 	var registrationIDBytes [4]byte
 	binary.BigEndian.PutUint32(registrationIDBytes[:], cli.Store.RegistrationID)
@@ -255,7 +264,7 @@ func (cli *Client) sendRetryReceipt(node *waBinary.Node, forceIncludeIdentity bo
 		},
 	}
 	if retryCount > 1 || forceIncludeIdentity {
-		if key, err := cli.Store.PreKeys.GenOnePreKey(); err != nil {
+		if key, err := cli.Store.PreKeys.GenOnePreKey(context.TODO()); err != nil {
 			cli.Log.Errorf("Failed to get prekey for retry receipt: %v", err)
 		} else if deviceIdentity, err := proto.Marshal(cli.Store.Account); err != nil {
 			cli.Log.Errorf("Failed to marshal account info: %v", err)
@@ -0,0 +1,152 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// RetryPolicy controls what the client does when an incoming message fails to decrypt.
+//
+// By default, the client sends a retry receipt to the sender, which makes the sender's device re-encrypt and
+// resend the message, possibly with a new Signal session. This is repeated until the message decrypts or
+// MaxRetries is reached.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retry receipts to send for a single message. Zero means 4,
+	// and a negative value disables retry receipts entirely.
+	MaxRetries int
+	// Backoff returns how long to wait before sending the given retry receipt (the first one is 1).
+	// If nil, retry receipts are sent immediately.
+	Backoff func(retryCount int) time.Duration
+
+	// RequestFromPhone makes the client also ask the primary device (the phone) to resend the message if it
+	// hasn't been decrypted after PhoneRequestDelay. The phone resends the message contents as a peer message,
+	// which works even if the sender's device is offline or doesn't respond to retry receipts.
+	RequestFromPhone bool
+	// PhoneRequestDelay is how long to wait for a normal retry before asking the phone. Defaults to 5 seconds.
+	PhoneRequestDelay time.Duration
+
+	// OnPermanentFailure is called when a message still fails to decrypt after MaxRetries retry receipts
+	// and the client gives up on it.
+	OnPermanentFailure func(info *types.MessageInfo, retryCount int)
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by clients that don't have one set.
+var DefaultRetryPolicy = &RetryPolicy{}
+
+const defaultMaxRetries = 4
+const defaultPhoneRequestDelay = 5 * time.Second
+
+func (rp *RetryPolicy) maxRetries() int {
+	if rp.MaxRetries == 0 {
+		return defaultMaxRetries
+	} else if rp.MaxRetries < 0 {
+		return 0
+	}
+	return rp.MaxRetries
+}
+
+func (rp *RetryPolicy) phoneRequestDelay() time.Duration {
+	if rp.PhoneRequestDelay <= 0 {
+		return defaultPhoneRequestDelay
+	}
+	return rp.PhoneRequestDelay
+}
+
+func (cli *Client) retryPolicy() *RetryPolicy {
+	if cli.RetryPolicy != nil {
+		return cli.RetryPolicy
+	}
+	return DefaultRetryPolicy
+}
+
+// handleDecryptFailure sends a retry receipt for a message that failed to decrypt, and schedules a request to the
+// phone if the retry policy says so.
+func (cli *Client) handleDecryptFailure(info *types.MessageInfo, node *waBinary.Node, forceIncludeIdentity bool) {
+	go cli.sendRetryReceipt(node, forceIncludeIdentity)
+	if cli.retryPolicy().RequestFromPhone {
+		cli.scheduleRequestFromPhone(info)
+	}
+}
+
+// permanentDecryptFailure is called by sendRetryReceipt when the retry limit is reached.
+func (cli *Client) permanentDecryptFailure(node *waBinary.Node, retryCount int) {
+	callback := cli.retryPolicy().OnPermanentFailure
+	if callback == nil {
+		return
+	}
+	info, err := cli.parseMessageInfo(node)
+	if err != nil {
+		cli.Log.Warnf("Failed to parse message info for permanent decryption failure callback: %v", err)
+		return
+	}
+	callback(info, retryCount)
+}
+
+func (cli *Client) scheduleRequestFromPhone(info *types.MessageInfo) {
+	if cli.Store.ID == nil || info.Sender.User == cli.Store.ID.User && info.Sender.Device == 0 {
+		// The phone itself sent the message, so asking it to resend it is pointless
+		return
+	}
+	cli.pendingPhoneRequestsLock.Lock()
+	defer cli.pendingPhoneRequestsLock.Unlock()
+	if _, alreadyScheduled := cli.pendingPhoneRequests[info.ID]; alreadyScheduled {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cli.pendingPhoneRequests[info.ID] = cancel
+	go func() {
+		defer cli.cancelRequestFromPhone(info.ID)
+		select {
+		case <-time.After(cli.retryPolicy().phoneRequestDelay()):
+		case <-ctx.Done():
+			return
+		}
+		cli.Log.Debugf("Message %s from %s still not decrypted, asking phone to resend it", info.ID, info.SourceString())
+		_, err := cli.SendMessage(ctx, cli.Store.ID.ToNonAD(), "", buildPlaceholderResendRequest(info))
+		if err != nil {
+			cli.Log.Warnf("Failed to ask phone to resend %s: %v", info.ID, err)
+		}
+	}()
+}
+
+// cancelRequestFromPhone cancels a scheduled request to the phone, e.g. because the message was decrypted.
+func (cli *Client) cancelRequestFromPhone(id types.MessageID) {
+	cli.pendingPhoneRequestsLock.Lock()
+	cancel, ok := cli.pendingPhoneRequests[id]
+	if ok {
+		delete(cli.pendingPhoneRequests, id)
+	}
+	cli.pendingPhoneRequestsLock.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func buildPlaceholderResendRequest(info *types.MessageInfo) *waProto.Message {
+	key := &waProto.MessageKey{
+		RemoteJid: proto.String(info.Chat.String()),
+		FromMe:    proto.Bool(info.IsFromMe),
+		Id:        proto.String(info.ID),
+	}
+	if info.IsGroup {
+		key.Participant = proto.String(info.Sender.ToNonAD().String())
+	}
+	keyBytes, _ := proto.Marshal(key)
+	// PlaceholderMessageResendRequest { MessageKey messageKey = 1; }
+	resendRequest := protowire.AppendTag(nil, 1, protowire.BytesType)
+	resendRequest = protowire.AppendBytes(resendRequest, keyBytes)
+	return buildPeerDataOperationRequest(peerDataOperationPlaceholderMessageResend, peerDataFieldPlaceholderResend, resendRequest)
+}
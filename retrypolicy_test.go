@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	tests := []struct {
+		policy     RetryPolicy
+		maxRetries int
+		delay      time.Duration
+	}{
+		{RetryPolicy{}, defaultMaxRetries, defaultPhoneRequestDelay},
+		{RetryPolicy{MaxRetries: 2, PhoneRequestDelay: time.Second}, 2, time.Second},
+		{RetryPolicy{MaxRetries: -1, PhoneRequestDelay: -time.Second}, 0, defaultPhoneRequestDelay},
+	}
+	for _, test := range tests {
+		if maxRetries := test.policy.maxRetries(); maxRetries != test.maxRetries {
+			t.Errorf("Expected %+v to allow %d retries, got %d", test.policy, test.maxRetries, maxRetries)
+		}
+		if delay := test.policy.phoneRequestDelay(); delay != test.delay {
+			t.Errorf("Expected %+v to have phone request delay %s, got %s", test.policy, test.delay, delay)
+		}
+	}
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	if cli.retryPolicy() != DefaultRetryPolicy {
+		t.Error("Expected client without a retry policy to use the default")
+	}
+	custom := &RetryPolicy{MaxRetries: 1}
+	cli.RetryPolicy = custom
+	if cli.retryPolicy() != custom {
+		t.Error("Expected client to use its own retry policy")
+	}
+}
+
+func TestScheduleRequestFromPhone(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	ownJID := types.NewADJID("1111", 0, 2)
+	device.ID = &ownJID
+	cli := NewClient(device, nil)
+	cli.RetryPolicy = &RetryPolicy{RequestFromPhone: true, PhoneRequestDelay: time.Hour}
+	pending := func() int {
+		cli.pendingPhoneRequestsLock.Lock()
+		defer cli.pendingPhoneRequestsLock.Unlock()
+		return len(cli.pendingPhoneRequests)
+	}
+
+	fromPhone := &types.MessageInfo{ID: "FROMPHONE", MessageSource: types.MessageSource{Sender: types.NewADJID("1111", 0, 0)}}
+	cli.scheduleRequestFromPhone(fromPhone)
+	if pending() != 0 {
+		t.Fatal("Request shouldn't be scheduled for messages sent by the phone itself")
+	}
+	info := &types.MessageInfo{ID: "MSG", MessageSource: types.MessageSource{Sender: types.NewADJID("2222", 0, 1)}}
+	cli.scheduleRequestFromPhone(info)
+	cli.scheduleRequestFromPhone(info)
+	if pending() != 1 {
+		t.Fatalf("Expected one scheduled request, got %d", pending())
+	}
+	cli.cancelRequestFromPhone(info.ID)
+	if pending() != 0 {
+		t.Error("Expected scheduled request to be removed after canceling")
+	}
+}
+
+func TestBuildPlaceholderResendRequest(t *testing.T) {
+	info := &types.MessageInfo{
+		ID: "MSG",
+		MessageSource: types.MessageSource{
+			Chat:    types.NewJID("123456789-987654321", types.GroupServer),
+			Sender:  types.NewADJID("2222", 0, 3),
+			IsGroup: true,
+		},
+	}
+	msg := buildPlaceholderResendRequest(info)
+	request := msg.GetProtocolMessage().GetPeerDataOperationRequestMessage()
+	if request.GetPeerDataOperationRequestType() != waProto.PeerDataOperationRequestType(peerDataOperationPlaceholderMessageResend) {
+		t.Fatalf("Unexpected request type %v", request.GetPeerDataOperationRequestType())
+	}
+	// Unwrap the placeholderMessageResendRequest list item and the message key inside it
+	payload := []byte(request.ProtoReflect().GetUnknown())
+	for _, expectedField := range []protowire.Number{peerDataFieldPlaceholderResend, 1} {
+		num, typ, n := protowire.ConsumeTag(payload)
+		if n < 0 || num != expectedField || typ != protowire.BytesType {
+			t.Fatalf("Expected bytes field %d, got field %d of type %d", expectedField, num, typ)
+		}
+		payload, n = protowire.ConsumeBytes(payload[n:])
+		if n < 0 {
+			t.Fatalf("Failed to read field %d", expectedField)
+		}
+	}
+	var key waProto.MessageKey
+	if err := proto.Unmarshal(payload, &key); err != nil {
+		t.Fatalf("Failed to unmarshal message key: %v", err)
+	}
+	expected := &waProto.MessageKey{
+		RemoteJid:   proto.String("123456789-987654321@g.us"),
+		FromMe:      proto.Bool(false),
+		Id:          proto.String("MSG"),
+		Participant: proto.String("2222@s.whatsapp.net"),
+	}
+	if !proto.Equal(&key, expected) {
+		t.Errorf("Expected key %v, got %v", expected, &key)
+	}
+}
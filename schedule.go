@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// ScheduledMessageCallback is called after a scheduled message has been sent, or sending it has failed.
+type ScheduledMessageCallback func(msg *store.ScheduledMessage, resp SendResponse, err error)
+
+// ScheduleOptions contains optional parameters for ScheduleMessage.
+type ScheduleOptions struct {
+	// Jitter adds a random delay between zero and the given duration to the send time, so that messages
+	// scheduled for the same moment (like daily reminders) aren't all sent at exactly the same time.
+	Jitter time.Duration
+}
+
+// scheduleFailureRetryDelay is how long the scheduler waits before trying again after a database error.
+const scheduleFailureRetryDelay = 1 * time.Minute
+
+// ScheduleMessage stores a message to be sent at the given time. The message is sent by the client when it's due,
+// which means the client must be connected at that time. Messages that became due while the client was offline
+// (or the process wasn't running) are sent right after connecting.
+//
+// This requires the device store to have a schedule store, e.g. with the EnableScheduler option of sqlstore.
+// Client.ScheduledMessageCallback is called after each scheduled message is sent.
+//
+//	id, err := cli.ScheduleMessage(context.Background(), chat, "", msg, time.Now().Add(2*time.Hour), nil)
+func (cli *Client) ScheduleMessage(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message, sendAt time.Time, opts *ScheduleOptions) (types.MessageID, error) {
+	if cli.Store.Schedule == nil {
+		return "", ErrNoScheduleStore
+	} else if to.AD && cli.Store.ID != nil && to.User != cli.Store.ID.User {
+		return "", ErrRecipientADJID
+	}
+	if len(id) == 0 {
+		id = GenerateMessageID()
+	}
+	if opts != nil && opts.Jitter > 0 {
+		sendAt = sendAt.Add(time.Duration(rand.Int63n(int64(opts.Jitter))))
+	}
+	err := cli.Store.Schedule.PutScheduledMessage(ctx, &store.ScheduledMessage{
+		To:      to,
+		ID:      id,
+		Message: message,
+		SendAt:  sendAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	cli.Log.Debugf("Scheduled message %s to %s to be sent at %s", id, to, sendAt)
+	cli.wakeScheduler()
+	return id, nil
+}
+
+// CancelScheduledMessage removes a message that was scheduled with ScheduleMessage, unless it has already been sent.
+func (cli *Client) CancelScheduledMessage(ctx context.Context, id types.MessageID) error {
+	if cli.Store.Schedule == nil {
+		return ErrNoScheduleStore
+	}
+	err := cli.Store.Schedule.DeleteScheduledMessage(ctx, id)
+	if err == nil {
+		cli.wakeScheduler()
+	}
+	return err
+}
+
+func (cli *Client) wakeScheduler() {
+	select {
+	case cli.schedulerWake <- struct{}{}:
+	default:
+	}
+}
+
+func (cli *Client) startScheduler() {
+	if cli.Store.Schedule == nil {
+		return
+	}
+	cli.socketLock.RLock()
+	sock := cli.socket
+	cli.socketLock.RUnlock()
+	if sock != nil {
+		go cli.schedulerLoop(sock.Context())
+	}
+}
+
+func (cli *Client) schedulerLoop(ctx context.Context) {
+	var retry bool
+	for {
+		var timer <-chan time.Time
+		if retry {
+			timer = time.After(scheduleFailureRetryDelay)
+		} else if next, err := cli.Store.Schedule.GetNextScheduledTime(ctx); err != nil {
+			cli.Log.Errorf("Failed to get next scheduled message time: %v", err)
+			timer = time.After(scheduleFailureRetryDelay)
+		} else if !next.IsZero() {
+			timer = time.After(time.Until(next))
+		}
+		select {
+		case <-timer:
+			retry = !cli.sendDueScheduledMessages(ctx)
+			if retry && (ctx.Err() != nil || !cli.IsLoggedIn()) {
+				// startScheduler is called again after the next login
+				return
+			}
+		case <-cli.schedulerWake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDueScheduledMessages sends all scheduled messages that are due. It returns false if it stopped before
+// handling all of them, in which case the scheduler shouldn't try again right away.
+func (cli *Client) sendDueScheduledMessages(ctx context.Context) bool {
+	messages, err := cli.Store.Schedule.GetDueScheduledMessages(ctx, time.Now())
+	if err != nil {
+		cli.Log.Errorf("Failed to get due scheduled messages: %v", err)
+		return false
+	}
+	for _, msg := range messages {
+		if ctx.Err() != nil || !cli.IsLoggedIn() {
+			return false
+		}
+		resp, err := cli.SendMessage(ctx, msg.To, msg.ID, msg.Message)
+		if err != nil && (!cli.IsLoggedIn() || errors.Is(err, ErrClientShuttingDown)) {
+			cli.Log.Debugf("Connection lost while sending scheduled message %s, will retry after reconnecting: %v", msg.ID, err)
+			return false
+		} else if err != nil {
+			cli.Log.Warnf("Failed to send scheduled message %s: %v", msg.ID, err)
+		}
+		err2 := cli.Store.Schedule.DeleteScheduledMessage(ctx, msg.ID)
+		if err2 != nil {
+			cli.Log.Errorf("Failed to delete scheduled message %s after sending: %v", msg.ID, err2)
+			return false
+		}
+		if cli.ScheduledMessageCallback != nil {
+			cli.ScheduledMessageCallback(msg, resp, err)
+		}
+	}
+	return true
+}
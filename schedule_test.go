@@ -0,0 +1,174 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+type testScheduleStore struct {
+	lock      sync.Mutex
+	messages  []*store.ScheduledMessage
+	deleteErr error
+	dueCalls  int
+}
+
+func (s *testScheduleStore) PutScheduledMessage(_ context.Context, msg *store.ScheduledMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.messages = append(s.messages, msg)
+	sort.SliceStable(s.messages, func(i, j int) bool {
+		return s.messages[i].SendAt.Before(s.messages[j].SendAt)
+	})
+	return nil
+}
+
+func (s *testScheduleStore) GetDueScheduledMessages(_ context.Context, now time.Time) ([]*store.ScheduledMessage, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dueCalls++
+	var due []*store.ScheduledMessage
+	for _, msg := range s.messages {
+		if !msg.SendAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	return due, nil
+}
+
+func (s *testScheduleStore) GetNextScheduledTime(_ context.Context) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.messages) == 0 {
+		return time.Time{}, nil
+	}
+	return s.messages[0].SendAt, nil
+}
+
+func (s *testScheduleStore) DeleteScheduledMessage(_ context.Context, id types.MessageID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	for i, msg := range s.messages {
+		if msg.ID == id {
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *testScheduleStore) getDueCalls() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dueCalls
+}
+
+func newScheduleTestClient(t *testing.T, scheduleStore *testScheduleStore) *Client {
+	t.Helper()
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+	device.Schedule = scheduleStore
+	cli := NewClient(device, nil)
+	cli.setState(types.ConnectionStateOnline, nil)
+	return cli
+}
+
+func TestScheduledMessageOrder(t *testing.T) {
+	scheduleStore := &testScheduleStore{}
+	cli := newScheduleTestClient(t, scheduleStore)
+	var sent []types.MessageID
+	cli.ScheduledMessageCallback = func(msg *store.ScheduledMessage, _ SendResponse, _ error) {
+		sent = append(sent, msg.ID)
+	}
+	ctx := context.Background()
+	to := types.NewJID("2222", types.DefaultUserServer)
+	now := time.Now()
+	for _, msg := range []struct {
+		id     types.MessageID
+		sendAt time.Time
+	}{{"third", now.Add(-time.Second)}, {"first", now.Add(-time.Hour)}, {"later", now.Add(time.Hour)}, {"second", now.Add(-time.Minute)}} {
+		_, err := cli.ScheduleMessage(ctx, to, msg.id, &waProto.Message{Conversation: proto.String("hi")}, msg.sendAt, nil)
+		if err != nil {
+			t.Fatalf("Failed to schedule message: %v", err)
+		}
+	}
+
+	// Sending fails because there's no connection, but the messages are still handled in order and removed
+	if !cli.sendDueScheduledMessages(ctx) {
+		t.Fatal("Expected all due messages to be handled")
+	}
+	if len(sent) != 3 || sent[0] != "first" || sent[1] != "second" || sent[2] != "third" {
+		t.Errorf("Unexpected send order %v", sent)
+	}
+	if next, _ := scheduleStore.GetNextScheduledTime(ctx); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected only the later message to be left, next send time is %v", next)
+	}
+}
+
+func TestSchedulerWaitsAfterFailure(t *testing.T) {
+	scheduleStore := &testScheduleStore{deleteErr: errors.New("database is locked")}
+	cli := newScheduleTestClient(t, scheduleStore)
+	_ = scheduleStore.PutScheduledMessage(context.Background(), &store.ScheduledMessage{
+		To:      types.NewJID("2222", types.DefaultUserServer),
+		ID:      "due",
+		Message: &waProto.Message{Conversation: proto.String("hi")},
+		SendAt:  time.Now().Add(-time.Minute),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cli.schedulerLoop(ctx)
+		close(done)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if calls := scheduleStore.getDueCalls(); calls != 1 {
+		t.Errorf("Expected scheduler to wait after failing to delete the message, got %d send passes", calls)
+	}
+	cancel()
+	<-done
+}
+
+func TestSchedulerStopsWhenLoggedOut(t *testing.T) {
+	scheduleStore := &testScheduleStore{}
+	cli := newScheduleTestClient(t, scheduleStore)
+	cli.setState(types.ConnectionStateDisconnected, nil)
+	_ = scheduleStore.PutScheduledMessage(context.Background(), &store.ScheduledMessage{
+		ID:     "due",
+		SendAt: time.Now().Add(-time.Minute),
+	})
+
+	done := make(chan struct{})
+	go func() {
+		cli.schedulerLoop(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Scheduler didn't stop while logged out")
+	}
+	if calls := scheduleStore.getDueCalls(); calls != 1 {
+		t.Errorf("Expected one send pass, got %d", calls)
+	}
+}
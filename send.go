@@ -29,6 +29,7 @@ import (
 
 	waBinary "github.com/insomnius/whatsmeow/binary"
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
 	"github.com/insomnius/whatsmeow/types"
 )
 
@@ -67,6 +68,10 @@ type SendResponse struct {
 	// The ID of the sent message
 	ID types.MessageID
 
+	// Queued is true if the message was put in the outbox instead of being sent right away.
+	// The timestamp isn't set in that case, as the message will only be sent after reconnecting.
+	Queued bool
+
 	// Message handling duration, used for debugging
 	DebugTimings MessageDebugTimings
 }
@@ -76,7 +81,9 @@ type SendResponse struct {
 // If the message ID is not provided, a random message ID will be generated.
 //
 // This method will wait for the server to acknowledge the message before returning.
-// The return value is the timestamp of the message from the server.
+// The return value is the timestamp of the message from the server. If the server acknowledges the message
+// with an error code, the returned error is a *ServerAckError, e.g. ErrAckRateOverLimit if the account is
+// sending too many messages.
 //
 // The message itself can contain anything you want (within the protobuf schema).
 // e.g. for a simple text message, use the Conversation field:
@@ -90,19 +97,50 @@ type SendResponse struct {
 //
 // For uploading and sending media/attachments, see the Upload method.
 //
+// If the device store has an outbox (see store.OutboxStore), messages sent while the client isn't logged in
+// are queued instead of failing with an error. Queued messages are sent in order after reconnecting, and the
+// returned SendResponse has the Queued flag set. Use Client.OutboxCallback to find out when they're sent.
+//
 // For other message types, you'll have to figure it out yourself. Looking at the protobuf schema
 // in binary/proto/def.proto may be useful to find out all the allowed fields.
 func (cli *Client) SendMessage(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message) (resp SendResponse, err error) {
+	return cli.prepareAndSendMessage(ctx, to, id, message, true)
+}
+
+// prepareAndSendMessage does everything SendMessage does. If allowQueue is false, the outbox is skipped,
+// so that the result is always the server's response to the message.
+func (cli *Client) prepareAndSendMessage(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message, allowQueue bool) (resp SendResponse, err error) {
 	isPeerMessage := to.User == cli.Store.ID.User
 	if to.AD && !isPeerMessage {
 		err = ErrRecipientADJID
 		return
 	}
 
+	if err = cli.startOperation(true); err != nil {
+		return
+	}
+	defer cli.finishOperation()
+
 	if len(id) == 0 {
 		id = GenerateMessageID()
 	}
 	resp.ID = id
+	if !isPeerMessage {
+		message = cli.applyDisappearingTimer(to, message)
+	}
+	message = cli.attachLinkPreview(ctx, message)
+	if allowQueue {
+		resp.Queued, err = cli.queueIfNeeded(ctx, to, id, message)
+		if resp.Queued || err != nil {
+			return
+		}
+	}
+	return cli.sendMessage(ctx, to, id, message)
+}
+
+func (cli *Client) sendMessage(ctx context.Context, to types.JID, id types.MessageID, message *waProto.Message) (resp SendResponse, err error) {
+	isPeerMessage := to.User == cli.Store.ID.User
+	resp.ID = id
 
 	start := time.Now()
 	// Sending multiple messages at a time can cause weird issues and makes it harder to retry safely
@@ -116,7 +154,7 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, id types.Messa
 		cli.addRecentMessage(to, id, message)
 	}
 	if message.GetMessageContextInfo().GetMessageSecret() != nil {
-		err = cli.Store.MsgSecrets.PutMessageSecret(to, *cli.Store.ID, id, message.GetMessageContextInfo().GetMessageSecret())
+		err = cli.Store.MsgSecrets.PutMessageSecret(ctx, to, *cli.Store.ID, id, message.GetMessageContextInfo().GetMessageSecret())
 		if err != nil {
 			cli.Log.Warnf("Failed to store message secret key for outgoing message %s: %v", id, err)
 		} else {
@@ -160,6 +198,10 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, id types.Messa
 	}
 	ag := respNode.AttrGetter()
 	resp.Timestamp = ag.UnixTime("t")
+	if errorCode := ag.OptionalInt("error"); errorCode != 0 {
+		err = &ServerAckError{Code: errorCode}
+		return
+	}
 	expectedPHash := ag.OptionalString("phash")
 	if len(expectedPHash) > 0 && phash != expectedPHash {
 		cli.Log.Warnf("Server returned different participant list hash when sending to %s. Some devices may not have received the message.", to)
@@ -168,17 +210,83 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, id types.Messa
 		delete(cli.groupParticipantsCache, to)
 		cli.groupParticipantsCacheLock.Unlock()
 	}
+	if !isPeerMessage {
+		cli.storeMessage(ctx, &store.StoredMessage{
+			Chat:      to,
+			Sender:    cli.Store.ID.ToNonAD(),
+			ID:        id,
+			Timestamp: resp.Timestamp,
+			FromMe:    true,
+			PushName:  cli.Store.PushName,
+			Message:   message,
+		})
+		cli.trackUnreadMessage(&types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: to, IsFromMe: true},
+			ID:            id,
+			Timestamp:     resp.Timestamp,
+		}, message)
+	}
 	return
 }
 
+// RevokeWindow is the maximum age of a message that can still be deleted for everyone. The server rejects older revocations.
+const RevokeWindow = 60 * time.Hour
+
 // RevokeMessage deletes the given message from everyone in the chat.
 //
+// To revoke your own messages, pass your JID or an empty JID as the sender. To revoke someone else's message when
+// you're a group admin, pass the sender of the message.
+//
 // This method will wait for the server to acknowledge the revocation message before returning.
 // The return value is the timestamp of the message from the server.
 //
-// Deprecated: This method is deprecated in favor of BuildRevoke
-func (cli *Client) RevokeMessage(chat types.JID, id types.MessageID) (SendResponse, error) {
-	return cli.SendMessage(context.TODO(), chat, "", cli.BuildRevoke(chat, types.EmptyJID, id))
+// Deprecated: This method is deprecated in favor of DeleteForEveryone, which can check the revocation window
+// using the timestamp in the message info.
+func (cli *Client) RevokeMessage(chat, sender types.JID, id types.MessageID) (SendResponse, error) {
+	return cli.DeleteForEveryone(context.TODO(), &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: sender},
+		ID:            id,
+	})
+}
+
+// DeleteForEveryone deletes the given message from everyone in the chat.
+//
+// The chat, sender, ID and timestamp of the message are taken from the message info. Your own messages can be revoked
+// anywhere, but other users' messages can only be revoked in groups where you're an admin.
+//
+// If the message is older than RevokeWindow, ErrRevokeWindowExpired is returned instead of sending a revocation that
+// the server would reject. If the info doesn't have a timestamp, it's taken from the message store of the device
+// (see store.MessageStore) if it has one and the message is found there. Otherwise the server is left to decide.
+//
+// This method will wait for the server to acknowledge the revocation message before returning.
+// The return value is the timestamp of the message from the server.
+//
+//	resp, err := cli.DeleteForEveryone(ctx, &evt.Info)
+func (cli *Client) DeleteForEveryone(ctx context.Context, info *types.MessageInfo) (SendResponse, error) {
+	if cli.Store.ID == nil {
+		return SendResponse{}, ErrNotLoggedIn
+	}
+	ownID := cli.Store.ID.ToNonAD()
+	sender := info.Sender
+	if sender.IsEmpty() || info.IsFromMe {
+		sender = ownID
+	}
+	if sender.User != ownID.User && info.Chat.Server != types.GroupServer {
+		return SendResponse{}, ErrCantRevokeOthersMessage
+	}
+	sentAt := info.Timestamp
+	if sentAt.IsZero() && cli.Store.Messages != nil {
+		original, err := cli.Store.Messages.GetMessage(ctx, info.Chat, sender.ToNonAD(), info.ID)
+		if err != nil {
+			cli.Log.Warnf("Failed to get message %s from store to check revocation window: %v", info.ID, err)
+		} else if original != nil {
+			sentAt = original.Timestamp
+		}
+	}
+	if !sentAt.IsZero() && time.Since(sentAt) > RevokeWindow {
+		return SendResponse{}, ErrRevokeWindowExpired
+	}
+	return cli.SendMessage(ctx, info.Chat, "", cli.BuildRevoke(info.Chat, sender, info.ID))
 }
 
 // BuildRevoke builds a message revocation message using the given variables.
@@ -192,6 +300,19 @@ func (cli *Client) RevokeMessage(chat types.JID, id types.MessageID) (SendRespon
 //
 //	resp, err := cli.SendMessage(context.Background(), chat, "", cli.BuildRevoke(chat, senderJID, originalMessageID)
 func (cli *Client) BuildRevoke(chat, sender types.JID, id types.MessageID) *waProto.Message {
+	return &waProto.Message{
+		ProtocolMessage: &waProto.ProtocolMessage{
+			Type: waProto.ProtocolMessage_REVOKE.Enum(),
+			Key:  cli.BuildMessageKey(chat, sender, id),
+		},
+	}
+}
+
+// BuildMessageKey builds a MessageKey object, which is used to refer to previous messages
+// for things such as replies, revocations and reactions.
+//
+// To refer to your own messages, pass your JID or an empty JID as the sender.
+func (cli *Client) BuildMessageKey(chat, sender types.JID, id types.MessageID) *waProto.MessageKey {
 	key := &waProto.MessageKey{
 		FromMe:    proto.Bool(true),
 		Id:        proto.String(id),
@@ -203,10 +324,22 @@ func (cli *Client) BuildRevoke(chat, sender types.JID, id types.MessageID) *waPr
 			key.Participant = proto.String(sender.ToNonAD().String())
 		}
 	}
+	return key
+}
+
+// BuildReaction builds a message reaction message using the given variables.
+// The built message can be sent normally using Client.SendMessage, but SendReaction should usually be used instead.
+//
+// To react to your own messages, pass your JID or an empty JID as the second parameter (sender).
+// To remove a reaction, pass RemoveReactionText (an empty string) as the reaction.
+//
+//	resp, err := cli.SendMessage(context.Background(), chat, "", cli.BuildReaction(chat, senderJID, targetMessageID, "🐈️")
+func (cli *Client) BuildReaction(chat, sender types.JID, id types.MessageID, reaction string) *waProto.Message {
 	return &waProto.Message{
-		ProtocolMessage: &waProto.ProtocolMessage{
-			Type: waProto.ProtocolMessage_REVOKE.Enum(),
-			Key:  key,
+		ReactionMessage: &waProto.ReactionMessage{
+			Key:               cli.BuildMessageKey(chat, sender, id),
+			Text:              proto.String(reaction),
+			SenderTimestampMs: proto.Int64(time.Now().UnixMilli()),
 		},
 	}
 }
@@ -236,6 +369,40 @@ func (cli *Client) BuildEdit(chat types.JID, id types.MessageID, newContent *waP
 	}
 }
 
+// EditMessage edits a message previously sent by this client by sending an edit built with BuildEdit.
+// Only the content of the message can be changed, e.g. the text of a text message or the caption of a media message.
+//
+//	resp, err := cli.EditMessage(context.Background(), chat, originalMessageID, &waProto.Message{
+//		Conversation: proto.String("edited message"),
+//	})
+func (cli *Client) EditMessage(ctx context.Context, chat types.JID, originalID types.MessageID, newContent *waProto.Message) (SendResponse, error) {
+	return cli.SendMessage(ctx, chat, "", cli.BuildEdit(chat, originalID, newContent))
+}
+
+// BuildViewOnce wraps the given media message so that the recipient can only view it once.
+// The built message can be sent normally using Client.SendMessage.
+//
+// Images and videos are marked as view-once and wrapped in a ViewOnceMessageV2, while audio messages are wrapped
+// in a ViewOnceMessageV2Extension like the official clients do for view-once voice messages.
+// Other message types can't be view-once and are returned as-is.
+//
+//	uploaded, err := cli.Upload(context.Background(), data, whatsmeow.MediaImage)
+//	// handle error, build the ImageMessage as usual
+//	resp, err := cli.SendMessage(context.Background(), chat, "", cli.BuildViewOnce(&waProto.Message{ImageMessage: imageMsg}))
+func (cli *Client) BuildViewOnce(msg *waProto.Message) *waProto.Message {
+	switch {
+	case msg.ImageMessage != nil:
+		msg.ImageMessage.ViewOnce = proto.Bool(true)
+	case msg.VideoMessage != nil:
+		msg.VideoMessage.ViewOnce = proto.Bool(true)
+	case msg.AudioMessage != nil:
+		return &waProto.Message{ViewOnceMessageV2Extension: &waProto.FutureProofMessage{Message: msg}}
+	default:
+		return msg
+	}
+	return &waProto.Message{ViewOnceMessageV2: &waProto.FutureProofMessage{Message: msg}}
+}
+
 const (
 	DisappearingTimerOff     = time.Duration(0)
 	DisappearingTimer24Hours = 24 * time.Hour
@@ -243,6 +410,17 @@ const (
 	DisappearingTimer90Days  = 90 * 24 * time.Hour
 )
 
+// isValidDisappearingTimer checks whether the timer is one of the DisappearingTimer<Duration> constants,
+// which are the only values that the official WhatsApp apps and the server accept in groups.
+func isValidDisappearingTimer(timer time.Duration) bool {
+	switch timer {
+	case DisappearingTimerOff, DisappearingTimer24Hours, DisappearingTimer7Days, DisappearingTimer90Days:
+		return true
+	default:
+		return false
+	}
+}
+
 // ParseDisappearingTimerString parses common human-readable disappearing message timer strings into Duration values.
 // If the string doesn't look like one of the allowed values (0, 24h, 7d, 90d), the second return value is false.
 func ParseDisappearingTimerString(val string) (time.Duration, bool) {
@@ -293,6 +471,9 @@ func (cli *Client) SetDisappearingTimer(chat types.JID, timer time.Duration) (er
 	default:
 		err = fmt.Errorf("can't set disappearing time in a %s chat", chat.Server)
 	}
+	if err == nil {
+		cli.cacheDisappearingTimer(chat, timer)
+	}
 	return
 }
 
@@ -420,6 +601,8 @@ func getTypeFromMessage(msg *waProto.Message) string {
 		return getTypeFromMessage(msg.ViewOnceMessage.Message)
 	case msg.ViewOnceMessageV2 != nil:
 		return getTypeFromMessage(msg.ViewOnceMessageV2.Message)
+	case msg.ViewOnceMessageV2Extension != nil:
+		return getTypeFromMessage(msg.ViewOnceMessageV2Extension.Message)
 	case msg.EphemeralMessage != nil:
 		return getTypeFromMessage(msg.EphemeralMessage.Message)
 	case msg.DocumentWithCaptionMessage != nil:
@@ -470,6 +653,37 @@ func getEditAttribute(msg *waProto.Message) string {
 	return EditAttributeEmpty
 }
 
+// getBizNode returns the <biz> node that the server requires for delivering interactive messages,
+// or nil if the message isn't interactive.
+func getBizNode(msg *waProto.Message) *waBinary.Node {
+	switch {
+	case msg.ViewOnceMessage != nil:
+		return getBizNode(msg.ViewOnceMessage.Message)
+	case msg.ViewOnceMessageV2 != nil:
+		return getBizNode(msg.ViewOnceMessageV2.Message)
+	case msg.EphemeralMessage != nil:
+		return getBizNode(msg.EphemeralMessage.Message)
+	case msg.ButtonsMessage != nil:
+		return &waBinary.Node{Tag: "biz", Content: []waBinary.Node{{Tag: "buttons"}}}
+	case msg.ListMessage != nil:
+		return &waBinary.Node{Tag: "biz", Content: []waBinary.Node{{
+			Tag:   "list",
+			Attrs: waBinary.Attrs{"v": "2", "type": "product_list"},
+		}}}
+	case msg.InteractiveMessage.GetNativeFlowMessage() != nil:
+		return &waBinary.Node{Tag: "biz", Content: []waBinary.Node{{
+			Tag:   "interactive",
+			Attrs: waBinary.Attrs{"v": "1", "type": "native_flow"},
+			Content: []waBinary.Node{{
+				Tag:   "native_flow",
+				Attrs: waBinary.Attrs{"v": "9", "name": "mixed"},
+			}},
+		}}}
+	default:
+		return nil
+	}
+}
+
 func (cli *Client) preparePeerMessageNode(to types.JID, id types.MessageID, message *waProto.Message, timings *MessageDebugTimings) (*waBinary.Node, error) {
 	attrs := waBinary.Attrs{
 		"id":       id,
@@ -543,6 +757,9 @@ func (cli *Client) prepareMessageNode(ctx context.Context, to types.JID, id type
 			},
 		})
 	}
+	if bizNode := getBizNode(message); bizNode != nil {
+		content = append(content, *bizNode)
+	}
 	return &waBinary.Node{
 		Tag:     "message",
 		Attrs:   attrs,
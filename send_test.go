@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+type testMessageStore struct {
+	messages map[types.MessageID]*store.StoredMessage
+}
+
+func (ms *testMessageStore) PutMessage(ctx context.Context, msg *store.StoredMessage) error {
+	ms.messages[msg.ID] = msg
+	return nil
+}
+
+func (ms *testMessageStore) GetMessage(ctx context.Context, chat, sender types.JID, id types.MessageID) (*store.StoredMessage, error) {
+	return ms.messages[id], nil
+}
+
+func (ms *testMessageStore) GetMessages(ctx context.Context, query store.MessageQuery) ([]*store.StoredMessage, error) {
+	return nil, nil
+}
+
+func TestDeleteForEveryone(t *testing.T) {
+	device := inmemstore.New(nil).NewDevice()
+	cli := NewClient(device, nil)
+	ctx := context.Background()
+	chat := types.NewJID("2222", types.DefaultUserServer)
+	group := types.NewJID("123456789-987654321", types.GroupServer)
+	if _, err := cli.DeleteForEveryone(ctx, &types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}, ID: "MSG"}); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn, got %v", err)
+	}
+	jid := types.NewADJID("1111", 0, 1)
+	device.ID = &jid
+
+	// If the check passes, the revocation gets as far as sending the message
+	expectSendFailure := func(name string, err error) {
+		if err == nil || errors.Is(err, ErrRevokeWindowExpired) || errors.Is(err, ErrCantRevokeOthersMessage) {
+			t.Errorf("%s: expected revocation to be sent, got %v", name, err)
+		}
+	}
+	old := time.Now().Add(-RevokeWindow - time.Hour)
+	tests := []struct {
+		name     string
+		info     types.MessageInfo
+		expected error
+	}{
+		{"others outside group", types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, Sender: chat}, ID: "MSG"}, ErrCantRevokeOthersMessage},
+		{"expired", types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, IsFromMe: true}, ID: "MSG", Timestamp: old}, ErrRevokeWindowExpired},
+		{"expired in group", types.MessageInfo{MessageSource: types.MessageSource{Chat: group, Sender: chat}, ID: "MSG", Timestamp: old}, ErrRevokeWindowExpired},
+	}
+	for _, test := range tests {
+		if _, err := cli.DeleteForEveryone(ctx, &test.info); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+	_, err := cli.DeleteForEveryone(ctx, &types.MessageInfo{MessageSource: types.MessageSource{Chat: group, Sender: chat}, ID: "MSG", Timestamp: time.Now()})
+	expectSendFailure("recent", err)
+	_, err = cli.DeleteForEveryone(ctx, &types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}, ID: "MSG"})
+	expectSendFailure("no timestamp", err)
+
+	// Without a timestamp in the info, it's taken from the message store
+	device.Messages = &testMessageStore{messages: map[types.MessageID]*store.StoredMessage{
+		"OLD": {Chat: chat, Sender: jid.ToNonAD(), ID: "OLD", Timestamp: old},
+		"NEW": {Chat: chat, Sender: jid.ToNonAD(), ID: "NEW", Timestamp: time.Now()},
+	}}
+	if _, err = cli.RevokeMessage(chat, types.EmptyJID, "OLD"); !errors.Is(err, ErrRevokeWindowExpired) {
+		t.Errorf("Expected stored timestamp to be checked, got %v", err)
+	}
+	_, err = cli.RevokeMessage(chat, types.EmptyJID, "NEW")
+	expectSendFailure("recent stored", err)
+}
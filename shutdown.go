@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"fmt"
+)
+
+// Shutdown gracefully disconnects the client, e.g. when the process is being restarted for a deploy.
+//
+// New SendMessage and Upload calls are rejected with ErrClientShuttingDown right away. Then Shutdown waits for
+// the sends and uploads that are already in progress to finish (which means that the server has acknowledged
+// the messages), and for the incoming events that have already been received to be handled, so that their
+// receipts and acks are sent. Finally, read receipts queued with MarkReadBatch are sent and the websocket is disconnected.
+//
+// If the context is done before everything has finished, the client is disconnected anyway, and an error
+// wrapping the context error is returned. Calling Connect afterwards makes the client accept sends again.
+func (cli *Client) Shutdown(ctx context.Context) error {
+	cli.inFlightLock.Lock()
+	cli.shuttingDown = true
+	var drained chan struct{}
+	if cli.inFlight > 0 {
+		if cli.inFlightDrained == nil {
+			cli.inFlightDrained = make(chan struct{})
+		}
+		drained = cli.inFlightDrained
+	}
+	cli.inFlightLock.Unlock()
+
+	var err error
+	if drained != nil {
+		cli.Log.Debugf("Waiting for pending sends to finish before shutting down")
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = fmt.Errorf("timed out waiting for pending sends: %w", ctx.Err())
+		}
+	}
+	if err == nil {
+		err = cli.waitHandlerQueue(ctx)
+	}
+	// Event handlers may have queued read receipts with MarkReadBatch
+	_ = cli.FlushReadReceipts()
+	cli.Disconnect()
+	return err
+}
+
+// waitHandlerQueue waits until all incoming nodes that have been received so far have been handled,
+// including the one that is currently being handled. If the client gets disconnected while waiting,
+// this returns once the handler loop has stopped, as the remaining nodes won't be handled before reconnecting.
+func (cli *Client) waitHandlerQueue(ctx context.Context) error {
+	cli.pendingNodesLock.Lock()
+	if cli.pendingNodes == 0 || cli.handlerLoops == 0 {
+		cli.pendingNodesLock.Unlock()
+		return nil
+	} else if cli.pendingNodesDrained == nil {
+		cli.pendingNodesDrained = make(chan struct{})
+	}
+	drained := cli.pendingNodesDrained
+	cli.pendingNodesLock.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for incoming events to be handled: %w", ctx.Err())
+	}
+}
+
+func (cli *Client) startHandlerLoop() {
+	cli.pendingNodesLock.Lock()
+	cli.handlerLoops++
+	cli.pendingNodesLock.Unlock()
+}
+
+func (cli *Client) stopHandlerLoop() {
+	cli.pendingNodesLock.Lock()
+	defer cli.pendingNodesLock.Unlock()
+	cli.handlerLoops--
+	if cli.handlerLoops == 0 && cli.pendingNodesDrained != nil {
+		close(cli.pendingNodesDrained)
+		cli.pendingNodesDrained = nil
+	}
+}
+
+func (cli *Client) addPendingNode() {
+	cli.pendingNodesLock.Lock()
+	cli.pendingNodes++
+	cli.pendingNodesLock.Unlock()
+}
+
+func (cli *Client) donePendingNode() {
+	cli.pendingNodesLock.Lock()
+	defer cli.pendingNodesLock.Unlock()
+	cli.pendingNodes--
+	if cli.pendingNodes == 0 && cli.pendingNodesDrained != nil {
+		close(cli.pendingNodesDrained)
+		cli.pendingNodesDrained = nil
+	}
+}
+
+// startOperation registers an in-flight operation that Shutdown should wait for. If reject is true,
+// the operation is refused with ErrClientShuttingDown when Shutdown has already been called.
+func (cli *Client) startOperation(reject bool) error {
+	cli.inFlightLock.Lock()
+	defer cli.inFlightLock.Unlock()
+	if reject && cli.shuttingDown {
+		return ErrClientShuttingDown
+	}
+	cli.inFlight++
+	return nil
+}
+
+func (cli *Client) finishOperation() {
+	cli.inFlightLock.Lock()
+	defer cli.inFlightLock.Unlock()
+	cli.inFlight--
+	if cli.inFlight == 0 && cli.inFlightDrained != nil {
+		close(cli.inFlightDrained)
+		cli.inFlightDrained = nil
+	}
+}
+
+func (cli *Client) resetShutdown() {
+	cli.inFlightLock.Lock()
+	cli.shuttingDown = false
+	cli.inFlightLock.Unlock()
+}
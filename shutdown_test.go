@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+func TestWaitHandlerQueueWaitsForRunningHandler(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cli.nodeHandlers["test"] = func(node *waBinary.Node) {
+		close(started)
+		<-release
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cli.handlerQueueLoop(ctx)
+
+	data, _ := waBinary.Marshal(waBinary.Node{Tag: "test"})
+	cli.handleFrame(data)
+	<-started
+	// The queue is empty now, but the handler is still running
+	timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	if err := cli.waitHandlerQueue(timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected waiting to time out while the handler is running, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cli.waitHandlerQueue(context.Background())
+	}()
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitHandlerQueue didn't return after the handler finished")
+	}
+	if err := cli.waitHandlerQueue(context.Background()); err != nil {
+		t.Errorf("Expected waiting with no pending nodes to return immediately, got %v", err)
+	}
+}
+
+func TestShutdownAfterDisconnectWithQueuedNodes(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	cli.nodeHandlers["test"] = func(node *waBinary.Node) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		cli.handlerQueueLoop(ctx)
+		close(stopped)
+	}()
+
+	data, _ := waBinary.Marshal(waBinary.Node{Tag: "test"})
+	for i := 0; i < 3; i++ {
+		cli.handleFrame(data)
+	}
+	<-started
+	// Disconnect while the first node is being handled and the others are still queued
+	cancel()
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Handler loop didn't stop after disconnecting")
+	}
+	cli.pendingNodesLock.Lock()
+	pending := cli.pendingNodes
+	cli.pendingNodesLock.Unlock()
+	if pending != 2 {
+		t.Fatalf("Expected 2 nodes to be left in the queue, got %d", pending)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShutdown()
+	start := time.Now()
+	if err := cli.Shutdown(shutdownCtx); err != nil {
+		t.Errorf("Expected shutdown not to wait for nodes that won't be handled, got %v", err)
+	} else if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Shutdown took %s", time.Since(start))
+	}
+
+	// The queued nodes are handled after reconnecting, and then the queue is empty again
+	reconnectCtx, cancelReconnect := context.WithCancel(context.Background())
+	defer cancelReconnect()
+	go cli.handlerQueueLoop(reconnectCtx)
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+	for {
+		cli.pendingNodesLock.Lock()
+		running := cli.handlerLoops > 0
+		cli.pendingNodesLock.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := cli.waitHandlerQueue(waitCtx); err != nil {
+		t.Errorf("Expected queued nodes to be handled after reconnecting, got %v", err)
+	}
+	cli.pendingNodesLock.Lock()
+	pending = cli.pendingNodes
+	cli.pendingNodesLock.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected no pending nodes, got %d", pending)
+	}
+}
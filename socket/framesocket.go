@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +36,12 @@ type FrameSocket struct {
 
 	Header []byte
 	Proxy  Proxy
+	// Dialer is used to open the websocket connection if set. Its Proxy field is replaced with the Proxy of the FrameSocket,
+	// and NetDialContext is wrapped if the proxy is an HTTPS proxy.
+	Dialer *websocket.Dialer
+	// EnableCompression makes the socket ask the server for permessage-deflate compression (RFC 7692).
+	EnableCompression bool
+	compressed        bool
 
 	incomingLength int
 	receivedLength int
@@ -57,6 +64,11 @@ func (fs *FrameSocket) IsConnected() bool {
 	return fs.conn != nil
 }
 
+// IsCompressed returns true if the server agreed to compress the websocket messages.
+func (fs *FrameSocket) IsCompressed() bool {
+	return fs.compressed
+}
+
 func (fs *FrameSocket) Context() context.Context {
 	return fs.ctx
 }
@@ -98,17 +110,29 @@ func (fs *FrameSocket) Connect() error {
 		return ErrSocketAlreadyOpen
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	dialer := websocket.Dialer{
-		Proxy: fs.Proxy,
+	var dialer websocket.Dialer
+	if fs.Dialer != nil {
+		dialer = *fs.Dialer
+	}
+	if err := setWebsocketProxy(&dialer, fs.Proxy); err != nil {
+		cancel()
+		return err
+	}
+	if fs.EnableCompression {
+		dialer.EnableCompression = true
 	}
 
 	headers := http.Header{"Origin": []string{Origin}}
 	fs.log.Debugf("Dialing %s", URL)
-	conn, _, err := dialer.Dial(URL, headers)
+	conn, resp, err := dialer.Dial(URL, headers)
 	if err != nil {
 		cancel()
 		return fmt.Errorf("couldn't dial whatsapp web websocket: %w", err)
 	}
+	fs.compressed = strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	if dialer.EnableCompression {
+		fs.log.Debugf("Websocket compression negotiated: %t", fs.compressed)
+	}
 
 	fs.ctx, fs.cancel = ctx, cancel
 	fs.conn = conn
@@ -106,3 +106,7 @@ func (ns *NoiseSocket) receiveEncryptedFrame(ciphertext []byte) {
 func (ns *NoiseSocket) IsConnected() bool {
 	return ns.fs.IsConnected()
 }
+
+func (ns *NoiseSocket) IsCompressed() bool {
+	return ns.fs.IsCompressed()
+}
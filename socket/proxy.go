@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package socket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrHTTPSProxyWithCustomTLS is returned by FrameSocket.Connect if an HTTPS proxy is used together with a dialer
+// that does its own TLS handshake (NetDialTLSContext), as the websocket library wouldn't use the proxy in that case.
+var ErrHTTPSProxyWithCustomTLS = errors.New("https proxies can't be used with a websocket dialer that has NetDialTLSContext")
+
+// setWebsocketProxy configures the dialer to connect through the proxy that the given function returns for the
+// websocket URL. The websocket library only knows http and socks5 proxies, so HTTPS proxies are dialed here
+// and socks5h is changed to socks5 (the library always lets the proxy resolve hostnames).
+func setWebsocketProxy(dialer *websocket.Dialer, proxy Proxy) error {
+	dialer.Proxy = nil
+	if proxy == nil {
+		return nil
+	}
+	wsURL, _ := url.Parse(URL)
+	wsURL.Scheme = "https"
+	proxyURL, err := proxy(&http.Request{Method: http.MethodGet, URL: wsURL, Host: wsURL.Host, Header: make(http.Header)})
+	if err != nil {
+		return err
+	} else if proxyURL == nil {
+		return nil
+	}
+	switch proxyURL.Scheme {
+	case "https":
+		if dialer.NetDialTLSContext != nil {
+			return ErrHTTPSProxyWithCustomTLS
+		}
+		forwardDial := dialer.NetDialContext
+		if forwardDial == nil && dialer.NetDial != nil {
+			netDial := dialer.NetDial
+			forwardDial = func(_ context.Context, network, addr string) (net.Conn, error) {
+				return netDial(network, addr)
+			}
+		} else if forwardDial == nil {
+			forwardDial = (&net.Dialer{}).DialContext
+		}
+		tlsConfig := &tls.Config{ServerName: proxyURL.Hostname()}
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialHTTPSProxy(ctx, proxyURL, tlsConfig, forwardDial, network, addr)
+		}
+		dialer.NetDial = nil
+	case "socks5h":
+		copied := *proxyURL
+		copied.Scheme = "socks5"
+		dialer.Proxy = http.ProxyURL(&copied)
+	default:
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+	return nil
+}
+
+// dialHTTPSProxy opens a TLS connection to the given proxy and asks it to tunnel the connection to addr with CONNECT.
+func dialHTTPSProxy(ctx context.Context, proxyURL *url.URL, tlsConfig *tls.Config, forwardDial func(ctx context.Context, network, addr string) (net.Conn, error), network, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+	}
+	rawConn, err := forwardDial(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, tlsConfig)
+	if err = conn.HandshakeContext(ctx); err != nil {
+		_ = rawConn.Close()
+		return nil, fmt.Errorf("proxy TLS handshake failed: %w", err)
+	}
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+	if err = connectReq.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, connectReq)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+	} else if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were already read into a buffer while reading the CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(p []byte) (int, error) {
+	return bc.reader.Read(p)
+}
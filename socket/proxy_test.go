@@ -0,0 +1,124 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package socket
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// startConnectProxy starts an HTTPS proxy that tunnels CONNECT requests to the given address.
+func startConnectProxy(t *testing.T, target string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var authHeaders []string
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Proxy-Authorization"))
+		if r.Method != http.MethodConnect || r.Host != "web.whatsapp.com:443" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, &authHeaders
+}
+
+func TestDialHTTPSProxy(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer target.Close()
+	go func() {
+		conn, err := target.Accept()
+		if err == nil {
+			_, _ = conn.Write([]byte("hello through the tunnel"))
+			_ = conn.Close()
+		}
+	}()
+	proxy, authHeaders := startConnectProxy(t, target.Addr().String())
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "password")
+	roots := x509.NewCertPool()
+	roots.AddCert(proxy.Certificate())
+
+	conn, err := dialHTTPSProxy(context.Background(), proxyURL, &tls.Config{RootCAs: roots, ServerName: "example.com"}, (&net.Dialer{}).DialContext, "tcp", "web.whatsapp.com:443")
+	if err != nil {
+		t.Fatalf("Failed to dial through proxy: %v", err)
+	}
+	defer conn.Close()
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "hello through the tunnel" {
+		t.Fatalf("Unexpected data from tunnel: %q (error: %v)", data, err)
+	}
+	if len(*authHeaders) != 1 || (*authHeaders)[0] != "Basic dXNlcjpwYXNzd29yZA==" {
+		t.Errorf("Unexpected proxy authorization headers %v", *authHeaders)
+	}
+
+	_, err = dialHTTPSProxy(context.Background(), proxyURL, &tls.Config{RootCAs: roots, ServerName: "example.com"}, (&net.Dialer{}).DialContext, "tcp", "example.com:443")
+	if err == nil {
+		t.Error("Expected an error when the proxy refuses the CONNECT request")
+	}
+}
+
+func TestSetWebsocketProxy(t *testing.T) {
+	proxyFor := func(addr string) Proxy {
+		parsed, _ := url.Parse(addr)
+		return http.ProxyURL(parsed)
+	}
+	var dialer websocket.Dialer
+	if err := setWebsocketProxy(&dialer, proxyFor("socks5h://proxy.example.com:1080")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if proxyURL, _ := dialer.Proxy(nil); proxyURL.Scheme != "socks5" {
+		t.Errorf("Expected socks5h to be changed to socks5, got %s", proxyURL.Scheme)
+	}
+
+	dialer = websocket.Dialer{}
+	if err := setWebsocketProxy(&dialer, proxyFor("https://proxy.example.com")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if dialer.Proxy != nil || dialer.NetDialContext == nil {
+		t.Error("Expected HTTPS proxy to be dialed with NetDialContext instead of the websocket library's proxy support")
+	}
+
+	dialer = websocket.Dialer{NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("not used")
+	}}
+	if err := setWebsocketProxy(&dialer, proxyFor("https://proxy.example.com")); !errors.Is(err, ErrHTTPSProxyWithCustomTLS) {
+		t.Errorf("Expected ErrHTTPSProxyWithCustomTLS, got %v", err)
+	}
+
+	dialer = websocket.Dialer{Proxy: proxyFor("http://old.example.com")}
+	if err := setWebsocketProxy(&dialer, nil); err != nil || dialer.Proxy != nil {
+		t.Errorf("Expected nil proxy to clear the dialer proxy (error: %v)", err)
+	}
+}
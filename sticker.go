@@ -0,0 +1,246 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/util/imageutil"
+	"github.com/insomnius/whatsmeow/util/webp"
+)
+
+// Sticker requirements of the official clients.
+const (
+	StickerDimension       = 512
+	MaxStickerSize         = 100 * 1024
+	MaxAnimatedStickerSize = 500 * 1024
+)
+
+// The default delay for GIF frames that don't specify one, matching what browsers do.
+const defaultGIFFrameDelay = 100 * time.Millisecond
+
+// StickerMetadata is the sticker pack info that is embedded in stickers as EXIF data.
+type StickerMetadata struct {
+	PackID    string   `json:"sticker-pack-id,omitempty"`
+	PackName  string   `json:"sticker-pack-name,omitempty"`
+	Publisher string   `json:"sticker-pack-publisher,omitempty"`
+	Emojis    []string `json:"emojis,omitempty"`
+}
+
+// The EXIF tag that WhatsApp stores the sticker metadata JSON in.
+const stickerMetadataEXIFTag = 0x5741
+
+func (meta *StickerMetadata) exif() ([]byte, error) {
+	if meta == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	// A little-endian TIFF header with a single IFD containing a single tag of type UNDEFINED (7)
+	exif := make([]byte, 22, 22+len(data))
+	copy(exif, "II")
+	binary.LittleEndian.PutUint16(exif[2:], 42)
+	binary.LittleEndian.PutUint32(exif[4:], 8)
+	binary.LittleEndian.PutUint16(exif[8:], 1)
+	binary.LittleEndian.PutUint16(exif[10:], stickerMetadataEXIFTag)
+	binary.LittleEndian.PutUint16(exif[12:], 7)
+	binary.LittleEndian.PutUint32(exif[14:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(exif[18:], 22)
+	return append(exif, data...), nil
+}
+
+// fitSticker scales the image to fit in the sticker dimensions and centers it on a transparent canvas.
+func fitSticker(src image.Image) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, StickerDimension, StickerDimension))
+	bounds := src.Bounds()
+	width, height := imageutil.FitSize(bounds.Dx(), bounds.Dy(), StickerDimension)
+	scaled := imageutil.Resize(src, width, height)
+	offset := image.Pt((StickerDimension-scaled.Rect.Dx())/2, (StickerDimension-scaled.Rect.Dy())/2)
+	draw.Draw(dst, scaled.Rect.Add(offset), scaled, image.Point{}, draw.Src)
+	return dst
+}
+
+// quantizeSticker drops the lowest bits of each color channel, which makes the image compress better.
+func quantizeSticker(img *image.NRGBA, bits uint) *image.NRGBA {
+	if bits == 0 {
+		return img
+	}
+	mask := uint8(0xff << bits)
+	quantized := image.NewNRGBA(img.Rect)
+	for i, val := range img.Pix {
+		if i%4 == 3 {
+			quantized.Pix[i] = val
+		} else {
+			quantized.Pix[i] = val & mask
+		}
+	}
+	return quantized
+}
+
+// maxStickerQuantization is the maximum number of bits per color channel that ConvertSticker drops
+// to make a sticker fit in the size limit.
+const maxStickerQuantization = 4
+
+type stickerFrame struct {
+	image    *image.NRGBA
+	duration time.Duration
+}
+
+// decodeGIFFrames renders the frames of an animated GIF into full images.
+func decodeGIFFrames(data []byte) ([]stickerFrame, error) {
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, anim.Config.Width, anim.Config.Height))
+	frames := make([]stickerFrame, len(anim.Image))
+	for i, frame := range anim.Image {
+		var previous *image.NRGBA
+		if i < len(anim.Disposal) && anim.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvas.Rect)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames[i].image = fitSticker(canvas)
+		frames[i].duration = time.Duration(anim.Delay[i]) * 10 * time.Millisecond
+		if frames[i].duration <= 0 {
+			frames[i].duration = defaultGIFFrameDelay
+		}
+		if i < len(anim.Disposal) {
+			switch anim.Disposal[i] {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				canvas = previous
+			}
+		}
+	}
+	return frames, nil
+}
+
+// encodeAnimatedSticker encodes the frames, dropping quality and then every other frame until
+// the result fits in MaxAnimatedStickerSize.
+func encodeAnimatedSticker(frames []stickerFrame, opts *webp.Options) ([]byte, error) {
+	for {
+		for bits := uint(0); bits <= maxStickerQuantization; bits++ {
+			webpFrames := make([]webp.Frame, len(frames))
+			for i, frame := range frames {
+				webpFrames[i] = webp.Frame{Image: quantizeSticker(frame.image, bits), Duration: frame.duration}
+			}
+			var buf bytes.Buffer
+			err := webp.EncodeAnimation(&buf, webpFrames, 0, opts)
+			if err != nil {
+				return nil, err
+			} else if buf.Len() <= MaxAnimatedStickerSize {
+				return buf.Bytes(), nil
+			}
+		}
+		if len(frames) < 2 {
+			return nil, ErrStickerTooLarge
+		}
+		reduced := make([]stickerFrame, 0, (len(frames)+1)/2)
+		for i := 0; i < len(frames); i += 2 {
+			frame := frames[i]
+			if i+1 < len(frames) {
+				frame.duration += frames[i+1].duration
+			}
+			reduced = append(reduced, frame)
+		}
+		frames = reduced
+	}
+}
+
+// ConvertSticker converts a PNG, JPEG or GIF image into a WebP sticker that meets the requirements of
+// the official clients: the image is scaled to fit in 512×512 pixels, quality is reduced if necessary
+// to fit in the size limit, and the metadata (if any) is embedded as EXIF data. Animated GIFs are converted
+// into animated stickers.
+//
+// The built-in encoder is lossless, so it works best for the flat-colored images typically used as stickers.
+// Detailed photos may not fit in the size limit even with reduced quality, in which case ErrStickerTooLarge
+// is returned.
+func ConvertSticker(data []byte, meta *StickerMetadata) (webpData []byte, animated bool, err error) {
+	exif, err := meta.exif()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode sticker metadata: %w", err)
+	}
+	opts := &webp.Options{EXIF: exif}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrUnsupportedStickerFormat, err)
+	}
+	if format == "gif" {
+		var frames []stickerFrame
+		frames, err = decodeGIFFrames(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decode gif: %w", err)
+		} else if len(frames) > 1 {
+			webpData, err = encodeAnimatedSticker(frames, opts)
+			return webpData, true, err
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+	fitted := fitSticker(img)
+	for bits := uint(0); bits <= maxStickerQuantization; bits++ {
+		var buf bytes.Buffer
+		err = webp.Encode(&buf, quantizeSticker(fitted, bits), opts)
+		if err != nil {
+			return nil, false, err
+		} else if buf.Len() <= MaxStickerSize {
+			return buf.Bytes(), false, nil
+		}
+	}
+	return nil, false, ErrStickerTooLarge
+}
+
+// UploadSticker converts the given PNG, JPEG or GIF image into a sticker with ConvertSticker, uploads it and
+// returns a message containing the sticker. The metadata is optional.
+//
+//	msg, err := cli.UploadSticker(ctx, pngData, &whatsmeow.StickerMetadata{PackName: "My stickers", Publisher: "Me"})
+//	// handle error
+//	resp, err := cli.SendMessage(ctx, chat, "", msg)
+func (cli *Client) UploadSticker(ctx context.Context, data []byte, meta *StickerMetadata) (*waProto.Message, error) {
+	webpData, animated, err := ConvertSticker(data, meta)
+	if err != nil {
+		return nil, err
+	}
+	uploaded, err := cli.upload(ctx, webpData, MediaImage, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload sticker: %w", err)
+	}
+	return &waProto.Message{StickerMessage: &waProto.StickerMessage{
+		Url:               proto.String(uploaded.URL),
+		DirectPath:        proto.String(uploaded.DirectPath),
+		MediaKey:          uploaded.MediaKey,
+		Mimetype:          proto.String("image/webp"),
+		FileEncSha256:     uploaded.FileEncSHA256,
+		FileSha256:        uploaded.FileSHA256,
+		FileLength:        proto.Uint64(uploaded.FileLength),
+		Width:             proto.Uint32(StickerDimension),
+		Height:            proto.Uint32(StickerDimension),
+		IsAnimated:        proto.Bool(animated),
+		MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+	}}, nil
+}
@@ -0,0 +1,418 @@
+// Package badgerstore contains a BadgerDB-backed implementation of the interfaces in the store package.
+//
+// Badger is a pure Go embedded key-value database based on an LSM tree, so unlike SQLite and bbolt,
+// writes don't have to wait for a single global file lock. This makes it a good fit for bots that handle
+// large amounts of messages, where every message updates Signal sessions and other keys.
+package badgerstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// Container is a wrapper for a Badger database that can contain multiple whatsmeow sessions.
+//
+// Device records are stored under `<prefix>device/<jid>` and all other data of a device under
+// `<prefix>data/<jid>/<store>/`, where the prefix is `whatsmeow/` for the default tenant.
+type Container struct {
+	db     *badger.DB
+	log    waLog.Logger
+	prefix string
+	tenant string
+
+	ownsDB bool
+
+	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	ReadOnly bool
+}
+
+var _ store.Container = (*Container)(nil)
+
+const basePrefix = "whatsmeow"
+
+// maxConflictRetries is the number of times a read-write transaction is retried if it conflicts with another transaction.
+const maxConflictRetries = 10
+
+// New opens the Badger database in the given directory and wraps it in a Container.
+// The directory will be created if it doesn't exist.
+//
+// The database is opened with badger.DefaultOptions, which means writes are not synced to disk
+// immediately. Use Open with custom options if you need SyncWrites or other tuning.
+//
+// The logger can be nil and will default to a no-op logger.
+//
+//	container, err := badgerstore.New("whatsmeow-data", nil)
+func New(dir string, log waLog.Logger) (*Container, error) {
+	return Open(badger.DefaultOptions(dir), log)
+}
+
+// Open opens a Badger database with the given options and wraps it in a Container.
+//
+// If the options don't have a logger, Badger's log messages are sent to a sublogger of the given logger.
+func Open(opts badger.Options, log waLog.Logger) (*Container, error) {
+	if log == nil {
+		log = waLog.Noop
+	}
+	if opts.Logger == nil {
+		opts.Logger = &badgerLogger{log.Sub("Badger")}
+	}
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	container := NewWithDB(db, log)
+	container.ownsDB = true
+	return container, nil
+}
+
+// NewWithDB wraps an existing Badger database in a Container.
+//
+// The logger can be nil and will default to a no-op logger.
+func NewWithDB(db *badger.DB, log waLog.Logger) *Container {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Container{
+		db:     db,
+		log:    log,
+		prefix: basePrefix + "/",
+	}
+}
+
+// WithTenant returns a Container that shares the database with this one, but only sees the devices of the
+// given tenant. The keys of each tenant are stored under a separate `whatsmeow:tenant:<tenant>/` prefix.
+//
+// Containers created with New, Open or NewWithDB use the empty default tenant, which doesn't see the devices
+// of other tenants. Tenant names shouldn't contain slashes. Only the original container closes the database in Close.
+func (c *Container) WithTenant(tenant string) *Container {
+	prefix := basePrefix + "/"
+	if tenant != "" {
+		prefix = basePrefix + ":tenant:" + tenant + "/"
+	}
+	return &Container{
+		db:     c.db,
+		log:    c.log,
+		prefix: prefix,
+		tenant: tenant,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
+// Close closes the underlying database if it was opened by New or Open.
+func (c *Container) Close() error {
+	if c.ownsDB {
+		return c.db.Close()
+	}
+	return nil
+}
+
+// RunValueLogGC runs Badger's value log garbage collection until there's nothing left to rewrite.
+//
+// Badger doesn't reclaim the space of overwritten values automatically, so this should be called
+// periodically (e.g. every few minutes) in long-running programs. The discard ratio is passed to
+// badger.DB.RunValueLogGC, 0.5 is a good default.
+func (c *Container) RunValueLogGC(discardRatio float64) error {
+	for {
+		err := c.db.RunValueLogGC(discardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// update runs the given function in a read-write transaction, retrying if the transaction conflicts with another one.
+func (c *Container) update(fn func(txn *badger.Txn) error) (err error) {
+	for i := 0; i < maxConflictRetries; i++ {
+		err = c.db.Update(fn)
+		if !errors.Is(err, badger.ErrConflict) {
+			return
+		}
+	}
+	return
+}
+
+func (c *Container) deviceKey(jid string) []byte {
+	return []byte(c.prefix + "device/" + jid)
+}
+
+func (c *Container) dataPrefix(jid string) []byte {
+	return []byte(c.prefix + "data/" + jid + "/")
+}
+
+type badgerDevice struct {
+	RegistrationID   uint32 `json:"registration_id"`
+	NoiseKey         []byte `json:"noise_key"`
+	IdentityKey      []byte `json:"identity_key"`
+	SignedPreKey     []byte `json:"signed_pre_key"`
+	SignedPreKeyID   uint32 `json:"signed_pre_key_id"`
+	SignedPreKeySig  []byte `json:"signed_pre_key_sig"`
+	AdvKey           []byte `json:"adv_key"`
+	AdvDetails       []byte `json:"adv_details"`
+	AdvAccountSig    []byte `json:"adv_account_sig"`
+	AdvAccountSigKey []byte `json:"adv_account_sig_key"`
+	AdvDeviceSig     []byte `json:"adv_device_sig"`
+	Platform         string `json:"platform"`
+	BusinessName     string `json:"business_name"`
+	PushName         string `json:"push_name"`
+	LastSeen         int64  `json:"last_seen,omitempty"`
+}
+
+func (c *Container) scanDevice(jid types.JID, data []byte) (*store.Device, error) {
+	var stored badgerDevice
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	} else if len(stored.NoiseKey) != 32 || len(stored.IdentityKey) != 32 || len(stored.SignedPreKey) != 32 || len(stored.SignedPreKeySig) != 64 {
+		return nil, ErrInvalidLength
+	}
+
+	var device store.Device
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	device.Log = c.log
+	device.ID = &jid
+	device.RegistrationID = stored.RegistrationID
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.NoiseKey))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.IdentityKey))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.SignedPreKey)),
+		KeyID:     stored.SignedPreKeyID,
+		Signature: (*[64]byte)(stored.SignedPreKeySig),
+	}
+	device.AdvSecretKey = stored.AdvKey
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             stored.AdvDetails,
+		AccountSignature:    stored.AdvAccountSig,
+		AccountSignatureKey: stored.AdvAccountSigKey,
+		DeviceSignature:     stored.AdvDeviceSig,
+	}
+	device.Platform = stored.Platform
+	device.BusinessName = stored.BusinessName
+	device.PushName = stored.PushName
+	if stored.LastSeen != 0 {
+		device.LastSeen = time.Unix(stored.LastSeen, 0)
+	}
+
+	c.initStores(&device)
+	return &device, nil
+}
+
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewBadgerStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	if device.Contacts == nil {
+		device.Contacts = innerStore
+	}
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.Container = c
+	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "badgerstore", c.MetricsHook)
+}
+
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	sessions := make([]*store.Device, 0)
+	devicePrefix := c.deviceKey("")
+	err := c.db.View(func(txn *badger.Txn) error {
+		return forEachWithPrefix(txn, devicePrefix, func(k, v []byte) error {
+			jid, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse device JID %q: %w", k, err)
+			}
+			sess, err := c.scanDevice(jid, v)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, sess)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the database.
+//
+// If the device is not found, nil is returned instead.
+//
+// Note that the parameter usually must be an AD-JID.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	var data []byte
+	err := c.db.View(func(txn *badger.Txn) (err error) {
+		data, err = getValue(txn, c.deviceKey(jid.String()))
+		return
+	})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return c.scanDevice(jid, data)
+}
+
+// NewDevice creates a new device in this database.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	return device
+}
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+// ErrInvalidLength is returned by some database getters if the database returned a byte array with an unexpected length.
+var ErrInvalidLength = errors.New("database returned byte array with illegal length")
+
+// PutDevice stores the given device in this database. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	data, err := json.Marshal(&badgerDevice{
+		RegistrationID:   device.RegistrationID,
+		NoiseKey:         device.NoiseKey.Priv[:],
+		IdentityKey:      device.IdentityKey.Priv[:],
+		SignedPreKey:     device.SignedPreKey.Priv[:],
+		SignedPreKeyID:   device.SignedPreKey.KeyID,
+		SignedPreKeySig:  device.SignedPreKey.Signature[:],
+		AdvKey:           device.AdvSecretKey,
+		AdvDetails:       device.Account.Details,
+		AdvAccountSig:    device.Account.AccountSignature,
+		AdvAccountSigKey: device.Account.AccountSignatureKey,
+		AdvDeviceSig:     device.Account.DeviceSignature,
+		Platform:         device.Platform,
+		BusinessName:     device.BusinessName,
+		PushName:         device.PushName,
+		LastSeen:         lastSeen,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %w", err)
+	}
+	err = c.update(func(txn *badger.Txn) error {
+		return txn.Set(c.deviceKey(device.ID.String()), data)
+	})
+
+	if !device.Initialized {
+		c.initStores(device)
+	}
+	return err
+}
+
+// DeleteDevice deletes the given device and all of its data from this database. This should be called through Device.Delete()
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	jid := device.ID.String()
+	err := c.update(func(txn *badger.Txn) error {
+		return txn.Delete(c.deviceKey(jid))
+	})
+	if err != nil {
+		return err
+	}
+	// The data of a device may not fit in a single transaction, so it's deleted with a write batch
+	var dataKeys [][]byte
+	err = c.db.View(func(txn *badger.Txn) error {
+		dataKeys = keysWithPrefix(txn, c.dataPrefix(jid))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	wb := c.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range dataKeys {
+		err = wb.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// badgerLogger sends Badger's log messages to a whatsmeow logger.
+type badgerLogger struct {
+	waLog.Logger
+}
+
+var _ badger.Logger = (*badgerLogger)(nil)
+
+func (bl *badgerLogger) Warningf(msg string, args ...interface{}) {
+	bl.Warnf(strings.TrimSuffix(msg, "\n"), args...)
+}
+
+func (bl *badgerLogger) Errorf(msg string, args ...interface{}) {
+	bl.Logger.Errorf(strings.TrimSuffix(msg, "\n"), args...)
+}
+
+func (bl *badgerLogger) Infof(msg string, args ...interface{}) {
+	// Badger logs a lot of internal details (like compaction) at the info level
+	bl.Logger.Debugf(strings.TrimSuffix(msg, "\n"), args...)
+}
+
+func (bl *badgerLogger) Debugf(msg string, args ...interface{}) {
+	bl.Logger.Debugf(strings.TrimSuffix(msg, "\n"), args...)
+}
@@ -0,0 +1,187 @@
+package badgerstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.DataExporter = (*BadgerStore)(nil)
+var _ store.PreKeyImporter = (*BadgerStore)(nil)
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *BadgerStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	data := &store.ExportedData{
+		Identities:   make(map[string][32]byte),
+		Sessions:     make(map[string][]byte),
+		Contacts:     make(map[types.JID]types.ContactInfo),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+	err := s.db.View(func(txn *badger.Txn) error {
+		err := forEachWithPrefix(txn, s.key(identitiesPrefix, nil), func(k, v []byte) error {
+			if len(v) != 32 {
+				return ErrInvalidLength
+			}
+			data.Identities[string(k)] = *(*[32]byte)(v)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export identities: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(sessionsPrefix, nil), func(k, v []byte) error {
+			data.Sessions[string(k)] = v
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export sessions: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(preKeysPrefix, nil), func(k, v []byte) error {
+			key, uploaded, err := parsePreKey(k, v)
+			if err != nil {
+				return err
+			}
+			data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *key, Uploaded: uploaded})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export prekeys: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(senderKeysPrefix, nil), func(k, v []byte) error {
+			parts, ok := splitKey(k, 2)
+			if !ok {
+				return fmt.Errorf("invalid sender key ID %q", k)
+			}
+			data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{
+				Group: string(parts[0]),
+				User:  string(parts[1]),
+				Key:   v,
+			})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export sender keys: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(appStateSyncKeysPrefix, nil), func(k, v []byte) error {
+			entry := store.AppStateSyncKeyEntry{ID: k}
+			err := json.Unmarshal(v, &entry.Key)
+			if err != nil {
+				return fmt.Errorf("failed to parse app state sync key: %w", err)
+			}
+			data.AppStateSyncKeys = append(data.AppStateSyncKeys, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export app state sync keys: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(appStateVersionPrefix, nil), func(k, v []byte) error {
+			if len(v) != 8+128 {
+				return ErrInvalidLength
+			}
+			data.AppStates = append(data.AppStates, store.AppStateEntry{
+				Name:    string(k),
+				Version: binary.BigEndian.Uint64(v),
+				Hash:    *(*[128]byte)(v[8:]),
+			})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export app state: %w", err)
+		}
+		for i := range data.AppStates {
+			entry := &data.AppStates[i]
+			err = forEachWithPrefix(txn, s.key(appStateMACsPrefix, mutationMACKey(entry.Name, nil)), func(indexMAC, value []byte) error {
+				if len(value) < 8 {
+					return ErrInvalidLength
+				}
+				entry.MutationMACs = append(entry.MutationMACs, store.AppStateMutationMACEntry{
+					AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: indexMAC, ValueMAC: value[8:]},
+					Version:             binary.BigEndian.Uint64(value),
+				})
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to export app state mutation MACs of %s: %w", entry.Name, err)
+			}
+		}
+		err = forEachWithPrefix(txn, s.key(contactsPrefix, nil), func(k, v []byte) error {
+			jid, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse contact JID %q: %w", k, err)
+			}
+			var contact badgerContact
+			err = json.Unmarshal(v, &contact)
+			if err != nil {
+				return fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+			}
+			data.Contacts[jid] = contact.toInfo()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export contacts: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(chatSettingsPrefix, nil), func(k, v []byte) error {
+			chat, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse chat JID %q: %w", k, err)
+			}
+			var stored badgerChatSettings
+			err = json.Unmarshal(v, &stored)
+			if err != nil {
+				return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+			}
+			data.ChatSettings[chat] = stored.toInfo()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export chat settings: %w", err)
+		}
+		err = forEachWithPrefix(txn, s.key(msgSecretsPrefix, nil), func(k, v []byte) error {
+			parts, ok := splitKey(k, 3)
+			if !ok {
+				return fmt.Errorf("invalid message secret key %q", k)
+			}
+			entry := store.MessageSecretInsert{ID: string(parts[2]), Secret: v}
+			var err error
+			entry.Chat, err = types.ParseJID(string(parts[0]))
+			if err != nil {
+				return fmt.Errorf("failed to parse chat JID %q: %w", parts[0], err)
+			}
+			entry.Sender, err = types.ParseJID(string(parts[1]))
+			if err != nil {
+				return fmt.Errorf("failed to parse sender JID %q: %w", parts[1], err)
+			}
+			data.MessageSecrets = append(data.MessageSecrets, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export message secrets: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *BadgerStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, preKey := range preKeys {
+		key := preKey.PreKey
+		err := wb.Set(s.key(preKeysPrefix, preKeyID(key.KeyID)), encodePreKey(&key, preKey.Uploaded))
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
@@ -0,0 +1,770 @@
+package badgerstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+const (
+	identitiesPrefix       = "identities/"
+	sessionsPrefix         = "sessions/"
+	preKeysPrefix          = "pre_keys/"
+	senderKeysPrefix       = "sender_keys/"
+	appStateSyncKeysPrefix = "app_state_sync_keys/"
+	appStateVersionPrefix  = "app_state_version/"
+	appStateMACsPrefix     = "app_state_mutation_macs/"
+	contactsPrefix         = "contacts/"
+	chatSettingsPrefix     = "chat_settings/"
+	msgSecretsPrefix       = "message_secrets/"
+)
+
+// contactBatchSize is the number of contacts written in a single transaction by PutAllContactNames,
+// which keeps large contact lists from exceeding Badger's transaction size limit.
+const contactBatchSize = 1000
+
+type BadgerStore struct {
+	*Container
+	JID string
+
+	prefix     []byte
+	preKeyLock sync.Mutex
+}
+
+// NewBadgerStore creates a new BadgerStore with the given container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewBadgerStore(c *Container, jid types.JID) *BadgerStore {
+	return &BadgerStore{
+		Container: c,
+		JID:       jid.String(),
+		prefix:    c.dataPrefix(jid.String()),
+	}
+}
+
+var _ store.IdentityStore = (*BadgerStore)(nil)
+var _ store.SessionStore = (*BadgerStore)(nil)
+var _ store.PreKeyStore = (*BadgerStore)(nil)
+var _ store.SenderKeyStore = (*BadgerStore)(nil)
+var _ store.AppStateSyncKeyStore = (*BadgerStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*BadgerStore)(nil)
+var _ store.AppStateStore = (*BadgerStore)(nil)
+var _ store.ContactStore = (*BadgerStore)(nil)
+var _ store.ChatSettingsStore = (*BadgerStore)(nil)
+var _ store.MsgSecretStore = (*BadgerStore)(nil)
+
+// getValue returns a copy of the value of the given key, or nil if it doesn't exist.
+func getValue(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// forEachWithPrefix calls the given function for every key that starts with the given prefix, in lexicographical order.
+// The prefix is removed from the keys passed to the function, and both the key and value are copies that stay valid
+// after the transaction.
+func forEachWithPrefix(txn *badger.Txn, prefix []byte, fn func(k, v []byte) error) error {
+	it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: true, PrefetchSize: 100, Prefix: prefix})
+	defer it.Close()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		err = fn(item.KeyCopy(nil)[len(prefix):], value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keysWithPrefix returns all keys that start with the given prefix without reading their values.
+func keysWithPrefix(txn *badger.Txn, prefix []byte) (output [][]byte) {
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		output = append(output, it.Item().KeyCopy(nil))
+	}
+	return
+}
+
+// key returns the full database key for the given key in the given store of this device.
+func (s *BadgerStore) key(storePrefix string, key []byte) []byte {
+	fullKey := make([]byte, 0, len(s.prefix)+len(storePrefix)+len(key))
+	fullKey = append(fullKey, s.prefix...)
+	fullKey = append(fullKey, storePrefix...)
+	return append(fullKey, key...)
+}
+
+func (s *BadgerStore) get(storePrefix string, key []byte) (value []byte, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		value, err = getValue(txn, s.key(storePrefix, key))
+		return err
+	})
+	return
+}
+
+func (s *BadgerStore) put(storePrefix string, key, value []byte) error {
+	return s.update(func(txn *badger.Txn) error {
+		return txn.Set(s.key(storePrefix, key), value)
+	})
+}
+
+func (s *BadgerStore) delete(storePrefix string, key []byte) error {
+	return s.update(func(txn *badger.Txn) error {
+		return txn.Delete(s.key(storePrefix, key))
+	})
+}
+
+func (s *BadgerStore) deleteWithPrefix(storePrefix string, prefix []byte) error {
+	return s.update(func(txn *badger.Txn) error {
+		for _, key := range keysWithPrefix(txn, s.key(storePrefix, prefix)) {
+			err := txn.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.put(identitiesPrefix, []byte(address), key[:])
+}
+
+func (s *BadgerStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deleteWithPrefix(identitiesPrefix, []byte(phone+":"))
+}
+
+func (s *BadgerStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.delete(identitiesPrefix, []byte(address))
+}
+
+func (s *BadgerStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existingIdentity, err := s.get(identitiesPrefix, []byte(address))
+	if err != nil {
+		return false, err
+	} else if existingIdentity == nil {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	} else if len(existingIdentity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existingIdentity) == key, nil
+}
+
+func (s *BadgerStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.get(sessionsPrefix, []byte(address))
+}
+
+func (s *BadgerStore) HasSession(ctx context.Context, address string) (has bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(s.key(sessionsPrefix, []byte(address)))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		has = true
+		return nil
+	})
+	return
+}
+
+func (s *BadgerStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.put(sessionsPrefix, []byte(address), session)
+}
+
+func (s *BadgerStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deleteWithPrefix(sessionsPrefix, []byte(phone+":"))
+}
+
+func (s *BadgerStore) DeleteSession(ctx context.Context, address string) error {
+	return s.delete(sessionsPrefix, []byte(address))
+}
+
+// Prekeys are stored with big-endian IDs as keys, so that iteration is in ID order.
+// The first byte of the value is the uploaded flag, followed by the 32-byte private key.
+
+func preKeyID(id uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, id)
+	return key
+}
+
+func parsePreKey(k, v []byte) (*keys.PreKey, bool, error) {
+	if len(k) != 4 || len(v) != 33 {
+		return nil, false, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(v[1:])),
+		KeyID:   binary.BigEndian.Uint32(k),
+	}, v[0] == 1, nil
+}
+
+func encodePreKey(key *keys.PreKey, uploaded bool) []byte {
+	value := make([]byte, 33)
+	if uploaded {
+		value[0] = 1
+	}
+	copy(value[1:], key.Priv[:])
+	return value
+}
+
+// lastPreKeyID returns the highest prekey ID stored for this device, or 0 if there are no prekeys.
+func (s *BadgerStore) lastPreKeyID(txn *badger.Txn) uint32 {
+	prefix := s.key(preKeysPrefix, nil)
+	it := txn.NewIterator(badger.IteratorOptions{Reverse: true, Prefix: prefix})
+	defer it.Close()
+	// Seeking in reverse goes to the last key that is less than or equal to the given key
+	it.Seek(append(prefix, 0xff, 0xff, 0xff, 0xff, 0xff))
+	if !it.ValidForPrefix(prefix) {
+		return 0
+	}
+	k := it.Item().Key()[len(prefix):]
+	if len(k) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(k)
+}
+
+func (s *BadgerStore) genOnePreKey(txn *badger.Txn, markUploaded bool) (*keys.PreKey, error) {
+	key := keys.NewPreKey(s.lastPreKeyID(txn) + 1)
+	return key, txn.Set(s.key(preKeysPrefix, preKeyID(key.KeyID)), encodePreKey(key, markUploaded))
+}
+
+func (s *BadgerStore) GenOnePreKey(ctx context.Context) (key *keys.PreKey, err error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	err = s.update(func(txn *badger.Txn) error {
+		key, err = s.genOnePreKey(txn, true)
+		return err
+	})
+	return
+}
+
+func (s *BadgerStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	var newKeys []*keys.PreKey
+	err := s.update(func(txn *badger.Txn) error {
+		newKeys = make([]*keys.PreKey, 0, count)
+		errEnoughKeys := errors.New("enough keys")
+		err := forEachWithPrefix(txn, s.key(preKeysPrefix, nil), func(k, v []byte) error {
+			key, uploaded, err := parsePreKey(k, v)
+			if err != nil {
+				return err
+			} else if !uploaded {
+				newKeys = append(newKeys, key)
+				if uint32(len(newKeys)) >= count {
+					return errEnoughKeys
+				}
+			}
+			return nil
+		})
+		if err != nil && err != errEnoughKeys {
+			return err
+		}
+		for uint32(len(newKeys)) < count {
+			key, err := s.genOnePreKey(txn, false)
+			if err != nil {
+				return fmt.Errorf("failed to generate prekey: %w", err)
+			}
+			newKeys = append(newKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newKeys, nil
+}
+
+func (s *BadgerStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	k := preKeyID(id)
+	v, err := s.get(preKeysPrefix, k)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	key, _, err := parsePreKey(k, v)
+	return key, err
+}
+
+func (s *BadgerStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.delete(preKeysPrefix, preKeyID(id))
+}
+
+func (s *BadgerStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	return s.update(func(txn *badger.Txn) error {
+		errDone := errors.New("done")
+		err := forEachWithPrefix(txn, s.key(preKeysPrefix, nil), func(k, v []byte) error {
+			if len(k) != 4 {
+				return ErrInvalidLength
+			} else if binary.BigEndian.Uint32(k) > upToID {
+				return errDone
+			} else if len(v) > 0 && v[0] != 1 {
+				v[0] = 1
+				return txn.Set(s.key(preKeysPrefix, k), v)
+			}
+			return nil
+		})
+		if err == errDone {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *BadgerStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		return forEachWithPrefix(txn, s.key(preKeysPrefix, nil), func(k, v []byte) error {
+			if len(v) > 0 && v[0] == 1 {
+				count++
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func senderKeyID(group, user string) []byte {
+	return []byte(group + "|" + user)
+}
+
+func (s *BadgerStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.put(senderKeysPrefix, senderKeyID(group, user), session)
+}
+
+func (s *BadgerStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.get(senderKeysPrefix, senderKeyID(group, user))
+}
+
+func (s *BadgerStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	data, err := json.Marshal(&key)
+	if err != nil {
+		return err
+	}
+	return s.put(appStateSyncKeysPrefix, id, data)
+}
+
+func (s *BadgerStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	data, err := s.get(appStateSyncKeysPrefix, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var key store.AppStateSyncKey
+	err = json.Unmarshal(data, &key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app state sync key: %w", err)
+	}
+	return &key, nil
+}
+
+func (s *BadgerStore) GetLatestAppStateSyncKeyID(ctx context.Context) (latestID []byte, err error) {
+	var latestTimestamp int64
+	err = s.db.View(func(txn *badger.Txn) error {
+		return forEachWithPrefix(txn, s.key(appStateSyncKeysPrefix, nil), func(k, v []byte) error {
+			var key store.AppStateSyncKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return fmt.Errorf("failed to parse app state sync key: %w", err)
+			} else if latestID == nil || key.Timestamp > latestTimestamp {
+				latestID, latestTimestamp = k, key.Timestamp
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (s *BadgerStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	data := make([]byte, 8+len(hash))
+	binary.BigEndian.PutUint64(data, version)
+	copy(data[8:], hash[:])
+	return s.put(appStateVersionPrefix, []byte(name), data)
+}
+
+func (s *BadgerStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var data []byte
+	data, err = s.get(appStateVersionPrefix, []byte(name))
+	if err != nil || data == nil {
+		// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+		return
+	} else if len(data) != 8+len(hash) {
+		err = ErrInvalidLength
+		return
+	}
+	version = binary.BigEndian.Uint64(data)
+	hash = *(*[128]byte)(data[8:])
+	return
+}
+
+func (s *BadgerStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.delete(appStateVersionPrefix, []byte(name))
+}
+
+// Mutation MACs are stored under `app_state_mutation_macs/<name>/<index MAC>`, with the big-endian
+// version followed by the value MAC as the value.
+
+func mutationMACKey(name string, indexMAC []byte) []byte {
+	return append([]byte(name+"/"), indexMAC...)
+}
+
+func (s *BadgerStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	return s.update(func(txn *badger.Txn) error {
+		for _, mutation := range mutations {
+			key := s.key(appStateMACsPrefix, mutationMACKey(name, mutation.IndexMAC))
+			existing, err := getValue(txn, key)
+			if err != nil {
+				return err
+			} else if len(existing) >= 8 && binary.BigEndian.Uint64(existing) > version {
+				continue
+			}
+			value := make([]byte, 8+len(mutation.ValueMAC))
+			binary.BigEndian.PutUint64(value, version)
+			copy(value[8:], mutation.ValueMAC)
+			err = txn.Set(key, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	if len(indexMACs) == 0 {
+		return nil
+	}
+	return s.update(func(txn *badger.Txn) error {
+		for _, indexMAC := range indexMACs {
+			err := txn.Delete(s.key(appStateMACsPrefix, mutationMACKey(name, indexMAC)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) (valueMAC []byte, err error) {
+	value, err := s.get(appStateMACsPrefix, mutationMACKey(name, indexMAC))
+	if err != nil || value == nil {
+		return nil, err
+	} else if len(value) < 8 {
+		return nil, ErrInvalidLength
+	}
+	return value[8:], nil
+}
+
+type badgerContact struct {
+	FirstName    string `json:"first_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+}
+
+func (bc *badgerContact) toInfo() types.ContactInfo {
+	return types.ContactInfo{
+		Found:        true,
+		FirstName:    bc.FirstName,
+		FullName:     bc.FullName,
+		PushName:     bc.PushName,
+		BusinessName: bc.BusinessName,
+	}
+}
+
+func getContact(txn *badger.Txn, key []byte) (*badgerContact, error) {
+	var contact badgerContact
+	data, err := getValue(txn, key)
+	if err != nil {
+		return nil, err
+	} else if data != nil {
+		err = json.Unmarshal(data, &contact)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact info of %s: %w", key, err)
+		}
+	}
+	return &contact, nil
+}
+
+func putContact(txn *badger.Txn, key []byte, contact *badgerContact) error {
+	data, err := json.Marshal(contact)
+	if err != nil {
+		return err
+	}
+	return txn.Set(key, data)
+}
+
+// updateContact applies the given function to the stored contact info and saves the result if it returns true.
+func (s *BadgerStore) updateContact(user types.JID, update func(contact *badgerContact) bool) error {
+	return s.update(func(txn *badger.Txn) error {
+		key := s.key(contactsPrefix, []byte(user.String()))
+		contact, err := getContact(txn, key)
+		if err != nil {
+			return err
+		}
+		if update(contact) {
+			return putContact(txn, key, contact)
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) PutPushName(ctx context.Context, user types.JID, pushName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(user, func(contact *badgerContact) bool {
+		// The function may be called multiple times if the transaction conflicts
+		changed, previousName = false, ""
+		if contact.PushName != pushName {
+			previousName = contact.PushName
+			contact.PushName = pushName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *BadgerStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(user, func(contact *badgerContact) bool {
+		changed, previousName = false, ""
+		if contact.BusinessName != businessName {
+			previousName = contact.BusinessName
+			contact.BusinessName = businessName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *BadgerStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	return s.updateContact(user, func(contact *badgerContact) bool {
+		if contact.FirstName != firstName || contact.FullName != fullName {
+			contact.FirstName = firstName
+			contact.FullName = fullName
+			return true
+		}
+		return false
+	})
+}
+
+func (s *BadgerStore) putContactNamesBatch(contacts []store.ContactEntry) error {
+	return s.update(func(txn *badger.Txn) error {
+		for _, entry := range contacts {
+			key := s.key(contactsPrefix, []byte(entry.JID.String()))
+			contact, err := getContact(txn, key)
+			if err != nil {
+				return err
+			}
+			contact.FirstName = entry.FirstName
+			contact.FullName = entry.FullName
+			err = putContact(txn, key, contact)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	filtered := make([]store.ContactEntry, 0, len(contacts))
+	for _, entry := range contacts {
+		if entry.JID.IsEmpty() {
+			s.log.Warnf("Empty contact info in mass insert: %+v", entry)
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	for i := 0; i < len(filtered); i += contactBatchSize {
+		end := i + contactBatchSize
+		if end > len(filtered) {
+			end = len(filtered)
+		}
+		err := s.putContactNamesBatch(filtered[i:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BadgerStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	data, err := s.get(contactsPrefix, []byte(user.String()))
+	if err != nil || data == nil {
+		return types.ContactInfo{}, err
+	}
+	var contact badgerContact
+	err = json.Unmarshal(data, &contact)
+	if err != nil {
+		return types.ContactInfo{}, fmt.Errorf("failed to parse contact info of %s: %w", user, err)
+	}
+	return contact.toInfo(), nil
+}
+
+func (s *BadgerStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	output := make(map[types.JID]types.ContactInfo)
+	err := s.db.View(func(txn *badger.Txn) error {
+		return forEachWithPrefix(txn, s.key(contactsPrefix, nil), func(k, v []byte) error {
+			jid, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse contact JID %q: %w", k, err)
+			}
+			var contact badgerContact
+			err = json.Unmarshal(v, &contact)
+			if err != nil {
+				return fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+			}
+			output[jid] = contact.toInfo()
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+type badgerChatSettings struct {
+	MutedUntil int64 `json:"muted_until,omitempty"`
+	Pinned     bool  `json:"pinned,omitempty"`
+	Archived   bool  `json:"archived,omitempty"`
+}
+
+func (bcs *badgerChatSettings) toInfo() types.LocalChatSettings {
+	settings := types.LocalChatSettings{Found: true, Pinned: bcs.Pinned, Archived: bcs.Archived}
+	if bcs.MutedUntil != 0 {
+		settings.MutedUntil = time.Unix(bcs.MutedUntil, 0)
+	}
+	return settings
+}
+
+func (s *BadgerStore) updateChatSettings(chat types.JID, update func(settings *badgerChatSettings)) error {
+	return s.update(func(txn *badger.Txn) error {
+		key := s.key(chatSettingsPrefix, []byte(chat.String()))
+		var settings badgerChatSettings
+		data, err := getValue(txn, key)
+		if err != nil {
+			return err
+		} else if data != nil {
+			err = json.Unmarshal(data, &settings)
+			if err != nil {
+				return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+			}
+		}
+		update(&settings)
+		data, err = json.Marshal(&settings)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, data)
+	})
+}
+
+func (s *BadgerStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
+	}
+	return s.updateChatSettings(chat, func(settings *badgerChatSettings) {
+		settings.MutedUntil = val
+	})
+}
+
+func (s *BadgerStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.updateChatSettings(chat, func(settings *badgerChatSettings) {
+		settings.Pinned = pinned
+	})
+}
+
+func (s *BadgerStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.updateChatSettings(chat, func(settings *badgerChatSettings) {
+		settings.Archived = archived
+	})
+}
+
+func (s *BadgerStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var data []byte
+	data, err = s.get(chatSettingsPrefix, []byte(chat.String()))
+	if err != nil || data == nil {
+		return
+	}
+	var stored badgerChatSettings
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		err = fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		return
+	}
+	return stored.toInfo(), nil
+}
+
+func msgSecretKey(chat, sender types.JID, id types.MessageID) []byte {
+	return []byte(chat.ToNonAD().String() + "|" + sender.ToNonAD().String() + "|" + id)
+}
+
+func (s *BadgerStore) putMessageSecret(txn *badger.Txn, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	key := s.key(msgSecretsPrefix, msgSecretKey(chat, sender, id))
+	_, err := txn.Get(key)
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+	return txn.Set(key, secret)
+}
+
+func (s *BadgerStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	return s.update(func(txn *badger.Txn) error {
+		for _, insert := range inserts {
+			err := s.putMessageSecret(txn, insert.Chat, insert.Sender, insert.ID, insert.Secret)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	return s.update(func(txn *badger.Txn) error {
+		return s.putMessageSecret(txn, chat, sender, id, secret)
+	})
+}
+
+func (s *BadgerStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.get(msgSecretsPrefix, msgSecretKey(chat, sender, id))
+}
+
+// splitKey splits a key that was joined with | into the given number of parts.
+func splitKey(key []byte, parts int) ([][]byte, bool) {
+	split := bytes.SplitN(key, []byte("|"), parts)
+	return split, len(split) == parts
+}
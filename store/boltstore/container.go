@@ -0,0 +1,373 @@
+// Package boltstore contains a bbolt-backed implementation of the interfaces in the store package.
+//
+// bbolt is a pure Go embedded key-value database, so this backend provides durable storage in a
+// single file without requiring CGO or an external database server.
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// Container is a wrapper for a bbolt database that can contain multiple whatsmeow sessions.
+//
+// Each device gets its own bucket inside the root bucket, which in turn contains separate buckets for
+// sessions, prekeys, app state, contacts and so on.
+type Container struct {
+	db     *bbolt.DB
+	log    waLog.Logger
+	root   []byte
+	tenant string
+
+	ownsDB bool
+
+	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	ReadOnly bool
+}
+
+var _ store.Container = (*Container)(nil)
+
+var rootBucket = []byte("whatsmeow")
+
+// deviceInfoKey is the key of the device record stored directly in the device bucket.
+var deviceInfoKey = []byte("device")
+
+// New opens the bbolt database at the given path and wraps it in a Container.
+// The file will be created if it doesn't exist.
+//
+// The logger can be nil and will default to a no-op logger.
+//
+//	container, err := boltstore.New("whatsmeow.db", nil)
+func New(path string, log waLog.Logger) (*Container, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	container, err := NewWithDB(db, log)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	container.ownsDB = true
+	return container, nil
+}
+
+// NewWithDB wraps an existing bbolt database in a Container.
+//
+// The logger can be nil and will default to a no-op logger.
+func NewWithDB(db *bbolt.DB, log waLog.Logger) (*Container, error) {
+	if log == nil {
+		log = waLog.Noop
+	}
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rootBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root bucket: %w", err)
+	}
+	return &Container{
+		db:   db,
+		log:  log,
+		root: rootBucket,
+	}, nil
+}
+
+// WithTenant returns a Container that shares the database with this one, but only sees the devices of the
+// given tenant. The devices of each tenant are stored in a separate root bucket, which is created when the
+// first device of the tenant is saved.
+//
+// Containers created with New or NewWithDB use the empty default tenant, which doesn't see the devices of
+// other tenants. Only the original container closes the database in Close.
+func (c *Container) WithTenant(tenant string) *Container {
+	root := rootBucket
+	if tenant != "" {
+		root = []byte(string(rootBucket) + ":tenant:" + tenant)
+	}
+	return &Container{
+		db:     c.db,
+		log:    c.log,
+		root:   root,
+		tenant: tenant,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
+// deviceBucket returns the bucket of the given device, or nil if it doesn't exist.
+func (c *Container) deviceBucket(tx *bbolt.Tx, jid string) *bbolt.Bucket {
+	root := tx.Bucket(c.root)
+	if root == nil {
+		return nil
+	}
+	return root.Bucket([]byte(jid))
+}
+
+// createDeviceBucket returns the bucket of the given device, creating it and the root bucket if necessary.
+func (c *Container) createDeviceBucket(tx *bbolt.Tx, jid string) (*bbolt.Bucket, error) {
+	root, err := tx.CreateBucketIfNotExists(c.root)
+	if err != nil {
+		return nil, err
+	}
+	return root.CreateBucketIfNotExists([]byte(jid))
+}
+
+// Close closes the underlying database if it was opened by New.
+func (c *Container) Close() error {
+	if c.ownsDB {
+		return c.db.Close()
+	}
+	return nil
+}
+
+type boltDevice struct {
+	RegistrationID   uint32 `json:"registration_id"`
+	NoiseKey         []byte `json:"noise_key"`
+	IdentityKey      []byte `json:"identity_key"`
+	SignedPreKey     []byte `json:"signed_pre_key"`
+	SignedPreKeyID   uint32 `json:"signed_pre_key_id"`
+	SignedPreKeySig  []byte `json:"signed_pre_key_sig"`
+	AdvKey           []byte `json:"adv_key"`
+	AdvDetails       []byte `json:"adv_details"`
+	AdvAccountSig    []byte `json:"adv_account_sig"`
+	AdvAccountSigKey []byte `json:"adv_account_sig_key"`
+	AdvDeviceSig     []byte `json:"adv_device_sig"`
+	Platform         string `json:"platform"`
+	BusinessName     string `json:"business_name"`
+	PushName         string `json:"push_name"`
+	LastSeen         int64  `json:"last_seen,omitempty"`
+}
+
+func (c *Container) scanDevice(jid types.JID, data []byte) (*store.Device, error) {
+	var stored boltDevice
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	} else if len(stored.NoiseKey) != 32 || len(stored.IdentityKey) != 32 || len(stored.SignedPreKey) != 32 || len(stored.SignedPreKeySig) != 64 {
+		return nil, ErrInvalidLength
+	}
+
+	var device store.Device
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	device.Log = c.log
+	device.ID = &jid
+	device.RegistrationID = stored.RegistrationID
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.NoiseKey))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.IdentityKey))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.SignedPreKey)),
+		KeyID:     stored.SignedPreKeyID,
+		Signature: (*[64]byte)(stored.SignedPreKeySig),
+	}
+	device.AdvSecretKey = stored.AdvKey
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             stored.AdvDetails,
+		AccountSignature:    stored.AdvAccountSig,
+		AccountSignatureKey: stored.AdvAccountSigKey,
+		DeviceSignature:     stored.AdvDeviceSig,
+	}
+	device.Platform = stored.Platform
+	device.BusinessName = stored.BusinessName
+	device.PushName = stored.PushName
+	if stored.LastSeen != 0 {
+		device.LastSeen = time.Unix(stored.LastSeen, 0)
+	}
+
+	c.initStores(&device)
+	return &device, nil
+}
+
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewBoltStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	if device.Contacts == nil {
+		device.Contacts = innerStore
+	}
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.Container = c
+	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "boltstore", c.MetricsHook)
+}
+
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	sessions := make([]*store.Device, 0)
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		root := tx.Bucket(c.root)
+		if root == nil {
+			return nil
+		}
+		return root.ForEach(func(k, v []byte) error {
+			deviceBucket := root.Bucket(k)
+			if v != nil || deviceBucket == nil {
+				return nil
+			}
+			data := deviceBucket.Get(deviceInfoKey)
+			if data == nil {
+				return nil
+			}
+			jid, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse device JID %q: %w", k, err)
+			}
+			sess, err := c.scanDevice(jid, data)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, sess)
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the database.
+//
+// If the device is not found, nil is returned instead.
+//
+// Note that the parameter usually must be an AD-JID.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (device *store.Device, err error) {
+	err = c.db.View(func(tx *bbolt.Tx) error {
+		deviceBucket := c.deviceBucket(tx, jid.String())
+		if deviceBucket == nil {
+			return nil
+		}
+		data := deviceBucket.Get(deviceInfoKey)
+		if data == nil {
+			return nil
+		}
+		device, err = c.scanDevice(jid, data)
+		return err
+	})
+	return
+}
+
+// NewDevice creates a new device in this database.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	return device
+}
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+// ErrInvalidLength is returned by some database getters if the database returned a byte array with an unexpected length.
+var ErrInvalidLength = errors.New("database returned byte array with illegal length")
+
+// PutDevice stores the given device in this database. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	data, err := json.Marshal(&boltDevice{
+		RegistrationID:   device.RegistrationID,
+		NoiseKey:         device.NoiseKey.Priv[:],
+		IdentityKey:      device.IdentityKey.Priv[:],
+		SignedPreKey:     device.SignedPreKey.Priv[:],
+		SignedPreKeyID:   device.SignedPreKey.KeyID,
+		SignedPreKeySig:  device.SignedPreKey.Signature[:],
+		AdvKey:           device.AdvSecretKey,
+		AdvDetails:       device.Account.Details,
+		AdvAccountSig:    device.Account.AccountSignature,
+		AdvAccountSigKey: device.Account.AccountSignatureKey,
+		AdvDeviceSig:     device.Account.DeviceSignature,
+		Platform:         device.Platform,
+		BusinessName:     device.BusinessName,
+		PushName:         device.PushName,
+		LastSeen:         lastSeen,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %w", err)
+	}
+	err = c.db.Update(func(tx *bbolt.Tx) error {
+		deviceBucket, err := c.createDeviceBucket(tx, device.ID.String())
+		if err != nil {
+			return err
+		}
+		return deviceBucket.Put(deviceInfoKey, data)
+	})
+
+	if !device.Initialized {
+		c.initStores(device)
+	}
+	return err
+}
+
+// DeleteDevice deletes the given device and all of its data from this database. This should be called through Device.Delete()
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket(c.root)
+		if root == nil {
+			return nil
+		}
+		err := root.DeleteBucket([]byte(device.ID.String()))
+		if errors.Is(err, bbolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,218 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func newTestContainer(t *testing.T) *Container {
+	t.Helper()
+	c, err := New(filepath.Join(t.TempDir(), "whatsmeow.db"), nil)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c
+}
+
+func newTestDevice(t *testing.T, c *Container) *store.Device {
+	t.Helper()
+	device := c.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             []byte("details"),
+		AccountSignature:    []byte("account signature"),
+		AccountSignatureKey: []byte("account signature key"),
+		DeviceSignature:     []byte("device signature"),
+	}
+	device.PushName = "Tester"
+	if err := device.Save(context.Background()); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+	return device
+}
+
+func TestDeviceSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "whatsmeow.db")
+	c, err := New(path, nil)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err = c.NewDevice().Save(ctx); err != ErrDeviceIDMustBeSet {
+		t.Fatalf("expected ErrDeviceIDMustBeSet, got %v", err)
+	}
+	device := newTestDevice(t, c)
+	_ = device.Sessions.PutSession(ctx, "4567:0", []byte("session"))
+	if err = c.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+
+	// Reopen the file to make sure the data was actually persisted
+	c, err = New(path, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer c.Close()
+	loaded, err := c.GetDevice(ctx, *device.ID)
+	if err != nil || loaded == nil {
+		t.Fatalf("failed to load device: %v", err)
+	}
+	if *loaded.NoiseKey.Priv != *device.NoiseKey.Priv || *loaded.IdentityKey.Priv != *device.IdentityKey.Priv {
+		t.Fatal("loaded keys don't match")
+	} else if *loaded.SignedPreKey.Signature != *device.SignedPreKey.Signature || loaded.SignedPreKey.KeyID != device.SignedPreKey.KeyID {
+		t.Fatal("loaded signed prekey doesn't match")
+	} else if loaded.RegistrationID != device.RegistrationID || loaded.PushName != "Tester" {
+		t.Fatal("loaded metadata doesn't match")
+	} else if !bytes.Equal(loaded.Account.DeviceSignature, device.Account.DeviceSignature) {
+		t.Fatal("loaded account doesn't match")
+	}
+	if sess, _ := loaded.Sessions.GetSession(ctx, "4567:0"); string(sess) != "session" {
+		t.Fatalf("session wasn't persisted, got %q", sess)
+	}
+	if all, _ := c.GetAllDevices(ctx); len(all) != 1 || *all[0].ID != *device.ID {
+		t.Fatalf("unexpected devices %v", all)
+	} else if tenant, _ := c.WithTenant("tenant").GetAllDevices(ctx); len(tenant) != 0 {
+		t.Fatal("device is visible in a different tenant")
+	}
+
+	if err = c.DeleteDevice(ctx, loaded); err != nil {
+		t.Fatalf("failed to delete device: %v", err)
+	}
+	if deleted, _ := c.GetDevice(ctx, *device.ID); deleted != nil {
+		t.Fatal("device wasn't deleted")
+	}
+}
+
+func TestIdentityRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	device := newTestDevice(t, newTestContainer(t))
+	key := [32]byte{1, 2, 3}
+	if trusted, err := device.Identities.IsTrustedIdentity(ctx, "4567:0", key); err != nil || !trusted {
+		t.Fatalf("expected unknown identity to be trusted (error: %v)", err)
+	}
+	if err := device.Identities.PutIdentity(ctx, "4567:0", key); err != nil {
+		t.Fatalf("failed to put identity: %v", err)
+	}
+	_ = device.Identities.PutIdentity(ctx, "45678:0", key)
+	if trusted, _ := device.Identities.IsTrustedIdentity(ctx, "4567:0", [32]byte{4, 5, 6}); trusted {
+		t.Fatal("changed identity was trusted")
+	}
+	if err := device.Identities.DeleteAllIdentities(ctx, "4567"); err != nil {
+		t.Fatalf("failed to delete identities: %v", err)
+	}
+	if trusted, _ := device.Identities.IsTrustedIdentity(ctx, "4567:0", [32]byte{4, 5, 6}); !trusted {
+		t.Fatal("identity wasn't deleted")
+	} else if trusted, _ = device.Identities.IsTrustedIdentity(ctx, "45678:0", [32]byte{4, 5, 6}); trusted {
+		t.Fatal("identity of a user with the same prefix was deleted")
+	}
+}
+
+func TestSessionRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	device := newTestDevice(t, newTestContainer(t))
+	if err := device.Sessions.PutSession(ctx, "4567:0", []byte("session")); err != nil {
+		t.Fatalf("failed to put session: %v", err)
+	}
+	_ = device.Sessions.PutSession(ctx, "4567:1", []byte("other session"))
+	_ = device.Sessions.PutSession(ctx, "45678:0", []byte("other user"))
+	if sess, err := device.Sessions.GetSession(ctx, "4567:0"); err != nil || string(sess) != "session" {
+		t.Fatalf("unexpected session %q (error: %v)", sess, err)
+	}
+	if err := device.Sessions.DeleteAllSessions(ctx, "4567"); err != nil {
+		t.Fatalf("failed to delete sessions: %v", err)
+	}
+	if has, _ := device.Sessions.HasSession(ctx, "4567:1"); has {
+		t.Fatal("session wasn't deleted")
+	} else if has, _ = device.Sessions.HasSession(ctx, "45678:0"); !has {
+		t.Fatal("session of a user with the same prefix was deleted")
+	}
+}
+
+func TestPreKeyRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	device := newTestDevice(t, newTestContainer(t))
+	preKeys, err := device.PreKeys.GetOrGenPreKeys(ctx, 12)
+	if err != nil || len(preKeys) != 12 {
+		t.Fatalf("failed to generate prekeys: %v", err)
+	}
+	for i, key := range preKeys {
+		if key.KeyID != uint32(i+1) {
+			t.Fatalf("expected prekey %d to have ID %d, got %d", i, i+1, key.KeyID)
+		}
+	}
+	if again, _ := device.PreKeys.GetOrGenPreKeys(ctx, 12); again[11].KeyID != 12 {
+		t.Fatal("unuploaded prekeys weren't reused")
+	}
+
+	if err = device.PreKeys.MarkPreKeysAsUploaded(ctx, 10); err != nil {
+		t.Fatalf("failed to mark prekeys as uploaded: %v", err)
+	}
+	if count, _ := device.PreKeys.UploadedPreKeyCount(ctx); count != 10 {
+		t.Fatalf("expected 10 uploaded prekeys, got %d", count)
+	}
+	next, _ := device.PreKeys.GetOrGenPreKeys(ctx, 3)
+	if len(next) != 3 || next[0].KeyID != 11 || next[2].KeyID != 13 {
+		t.Fatalf("unexpected prekeys after upload: %v", next)
+	}
+
+	loaded, err := device.PreKeys.GetPreKey(ctx, 5)
+	if err != nil || loaded == nil || *loaded.Priv != *preKeys[4].Priv {
+		t.Fatalf("loaded prekey doesn't match (error: %v)", err)
+	}
+	_ = device.PreKeys.RemovePreKey(ctx, 5)
+	if loaded, _ = device.PreKeys.GetPreKey(ctx, 5); loaded != nil {
+		t.Fatal("prekey wasn't removed")
+	}
+}
+
+func TestAppStateRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	device := newTestDevice(t, newTestContainer(t))
+	syncKey := store.AppStateSyncKey{Data: []byte("key data"), Fingerprint: []byte("fingerprint"), Timestamp: 1700000000}
+	if err := device.AppStateKeys.PutAppStateSyncKey(ctx, []byte{0xab}, syncKey); err != nil {
+		t.Fatalf("failed to put app state sync key: %v", err)
+	}
+	if loaded, err := device.AppStateKeys.GetAppStateSyncKey(ctx, []byte{0xab}); err != nil || loaded == nil {
+		t.Fatalf("failed to get app state sync key: %v", err)
+	} else if !bytes.Equal(loaded.Data, syncKey.Data) || !bytes.Equal(loaded.Fingerprint, syncKey.Fingerprint) || loaded.Timestamp != syncKey.Timestamp {
+		t.Fatalf("loaded app state sync key doesn't match: %+v", loaded)
+	}
+	if missing, _ := device.AppStateKeys.GetAppStateSyncKey(ctx, []byte{0xcd}); missing != nil {
+		t.Fatal("got a key that wasn't stored")
+	}
+
+	hash := [128]byte{1, 2, 3}
+	if err := device.AppState.PutAppStateVersion(ctx, "regular", 5, hash); err != nil {
+		t.Fatalf("failed to put app state version: %v", err)
+	}
+	if version, loadedHash, err := device.AppState.GetAppStateVersion(ctx, "regular"); err != nil || version != 5 || loadedHash != hash {
+		t.Fatalf("unexpected app state version %d (error: %v)", version, err)
+	}
+	mutations := []store.AppStateMutationMAC{{IndexMAC: []byte("index 1"), ValueMAC: []byte("value 1")}, {IndexMAC: []byte("index 2"), ValueMAC: []byte("value 2")}}
+	if err := device.AppState.PutAppStateMutationMACs(ctx, "regular", 5, mutations); err != nil {
+		t.Fatalf("failed to put mutation MACs: %v", err)
+	}
+	if valueMAC, _ := device.AppState.GetAppStateMutationMAC(ctx, "regular", []byte("index 2")); string(valueMAC) != "value 2" {
+		t.Fatalf("unexpected value MAC %q", valueMAC)
+	}
+	_ = device.AppState.DeleteAppStateMutationMACs(ctx, "regular", [][]byte{[]byte("index 1")})
+	if valueMAC, _ := device.AppState.GetAppStateMutationMAC(ctx, "regular", []byte("index 1")); valueMAC != nil {
+		t.Fatal("mutation MAC wasn't deleted")
+	}
+	if err := device.AppState.DeleteAppStateVersion(ctx, "regular"); err != nil {
+		t.Fatalf("failed to delete app state version: %v", err)
+	}
+	if version, _, _ := device.AppState.GetAppStateVersion(ctx, "regular"); version != 0 {
+		t.Fatalf("expected app state version to be deleted, got %d", version)
+	}
+}
@@ -0,0 +1,211 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.DataExporter = (*BoltStore)(nil)
+var _ store.PreKeyImporter = (*BoltStore)(nil)
+
+// forEach calls the given function for each key-value pair in the named sub-bucket of the device bucket.
+func forEach(deviceBucket *bbolt.Bucket, name []byte, fn func(k, v []byte) error) error {
+	b := deviceBucket.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(fn)
+}
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *BoltStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	data := &store.ExportedData{
+		Identities:   make(map[string][32]byte),
+		Sessions:     make(map[string][]byte),
+		Contacts:     make(map[types.JID]types.ContactInfo),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		deviceBucket := s.deviceBucket(tx, s.JID)
+		if deviceBucket == nil {
+			return nil
+		}
+		err := forEach(deviceBucket, identitiesBucket, func(k, v []byte) error {
+			if len(v) != 32 {
+				return ErrInvalidLength
+			}
+			data.Identities[string(k)] = *(*[32]byte)(v)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export identities: %w", err)
+		}
+		err = forEach(deviceBucket, sessionsBucket, func(k, v []byte) error {
+			data.Sessions[string(k)] = cloneBytes(v)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export sessions: %w", err)
+		}
+		err = forEach(deviceBucket, preKeysBucket, func(k, v []byte) error {
+			key, uploaded, err := parsePreKey(k, v)
+			if err != nil {
+				return err
+			}
+			data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *key, Uploaded: uploaded})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export prekeys: %w", err)
+		}
+		err = forEach(deviceBucket, senderKeysBucket, func(k, v []byte) error {
+			parts := bytes.SplitN(k, []byte("|"), 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid sender key ID %q", k)
+			}
+			data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{
+				Group: string(parts[0]),
+				User:  string(parts[1]),
+				Key:   cloneBytes(v),
+			})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export sender keys: %w", err)
+		}
+		err = forEach(deviceBucket, appStateSyncKeysBucket, func(k, v []byte) error {
+			entry := store.AppStateSyncKeyEntry{ID: cloneBytes(k)}
+			err := json.Unmarshal(v, &entry.Key)
+			if err != nil {
+				return fmt.Errorf("failed to parse app state sync key: %w", err)
+			}
+			data.AppStateSyncKeys = append(data.AppStateSyncKeys, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export app state sync keys: %w", err)
+		}
+		macsBucket := deviceBucket.Bucket(appStateMACsBucket)
+		err = forEach(deviceBucket, appStateVersionBucket, func(k, v []byte) error {
+			if len(v) != 8+128 {
+				return ErrInvalidLength
+			}
+			entry := store.AppStateEntry{
+				Name:    string(k),
+				Version: binary.BigEndian.Uint64(v),
+				Hash:    *(*[128]byte)(v[8:]),
+			}
+			if macsBucket != nil {
+				err := forEach(macsBucket, k, func(indexMAC, value []byte) error {
+					if len(value) < 8 {
+						return ErrInvalidLength
+					}
+					entry.MutationMACs = append(entry.MutationMACs, store.AppStateMutationMACEntry{
+						AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: cloneBytes(indexMAC), ValueMAC: cloneBytes(value[8:])},
+						Version:             binary.BigEndian.Uint64(value),
+					})
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			data.AppStates = append(data.AppStates, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export app state: %w", err)
+		}
+		err = forEach(deviceBucket, contactsBucket, func(k, v []byte) error {
+			jid, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse contact JID %q: %w", k, err)
+			}
+			var contact boltContact
+			err = json.Unmarshal(v, &contact)
+			if err != nil {
+				return fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+			}
+			data.Contacts[jid] = contact.toInfo()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export contacts: %w", err)
+		}
+		err = forEach(deviceBucket, chatSettingsBucket, func(k, v []byte) error {
+			chat, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse chat JID %q: %w", k, err)
+			}
+			var stored boltChatSettings
+			err = json.Unmarshal(v, &stored)
+			if err != nil {
+				return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+			}
+			settings := types.LocalChatSettings{Found: true, Pinned: stored.Pinned, Archived: stored.Archived}
+			if stored.MutedUntil != 0 {
+				settings.MutedUntil = time.Unix(stored.MutedUntil, 0)
+			}
+			data.ChatSettings[chat] = settings
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export chat settings: %w", err)
+		}
+		err = forEach(deviceBucket, msgSecretsBucket, func(k, v []byte) error {
+			parts := bytes.SplitN(k, []byte("|"), 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("invalid message secret key %q", k)
+			}
+			entry := store.MessageSecretInsert{ID: string(parts[2]), Secret: cloneBytes(v)}
+			var err error
+			entry.Chat, err = types.ParseJID(string(parts[0]))
+			if err != nil {
+				return fmt.Errorf("failed to parse chat JID %q: %w", parts[0], err)
+			}
+			entry.Sender, err = types.ParseJID(string(parts[1]))
+			if err != nil {
+				return fmt.Errorf("failed to parse sender JID %q: %w", parts[1], err)
+			}
+			data.MessageSecrets = append(data.MessageSecrets, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export message secrets: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *BoltStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	return s.update(preKeysBucket, func(b *bbolt.Bucket) error {
+		for _, preKey := range preKeys {
+			value := make([]byte, 33)
+			if preKey.Uploaded {
+				value[0] = 1
+			}
+			copy(value[1:], preKey.Priv[:])
+			err := b.Put(preKeyID(preKey.KeyID), value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,18 @@
+module github.com/insomnius/whatsmeow/store/boltstore
+
+go 1.18
+
+require (
+	github.com/insomnius/whatsmeow v0.0.0
+	go.etcd.io/bbolt v1.3.7
+)
+
+require (
+	filippo.io/edwards25519 v1.0.0 // indirect
+	go.mau.fi/libsignal v0.0.0-20221015105917-d970e7c3c9cf // indirect
+	golang.org/x/crypto v0.0.0-20221012134737-56aed061732a // indirect
+	golang.org/x/sys v0.4.0 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+replace github.com/insomnius/whatsmeow => ../..
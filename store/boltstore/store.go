@@ -0,0 +1,699 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+var (
+	identitiesBucket       = []byte("identities")
+	sessionsBucket         = []byte("sessions")
+	preKeysBucket          = []byte("pre_keys")
+	senderKeysBucket       = []byte("sender_keys")
+	appStateSyncKeysBucket = []byte("app_state_sync_keys")
+	appStateVersionBucket  = []byte("app_state_version")
+	appStateMACsBucket     = []byte("app_state_mutation_macs")
+	contactsBucket         = []byte("contacts")
+	chatSettingsBucket     = []byte("chat_settings")
+	msgSecretsBucket       = []byte("message_secrets")
+)
+
+type BoltStore struct {
+	*Container
+	JID string
+
+	preKeyLock sync.Mutex
+}
+
+// NewBoltStore creates a new BoltStore with the given container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewBoltStore(c *Container, jid types.JID) *BoltStore {
+	return &BoltStore{
+		Container: c,
+		JID:       jid.String(),
+	}
+}
+
+var _ store.IdentityStore = (*BoltStore)(nil)
+var _ store.SessionStore = (*BoltStore)(nil)
+var _ store.PreKeyStore = (*BoltStore)(nil)
+var _ store.SenderKeyStore = (*BoltStore)(nil)
+var _ store.AppStateSyncKeyStore = (*BoltStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*BoltStore)(nil)
+var _ store.AppStateStore = (*BoltStore)(nil)
+var _ store.ContactStore = (*BoltStore)(nil)
+var _ store.ChatSettingsStore = (*BoltStore)(nil)
+var _ store.MsgSecretStore = (*BoltStore)(nil)
+
+// view calls the given function with the named bucket of this device in a read-only transaction.
+// If the bucket doesn't exist yet, the function is not called.
+func (s *BoltStore) view(name []byte, fn func(b *bbolt.Bucket) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		deviceBucket := s.deviceBucket(tx, s.JID)
+		if deviceBucket == nil {
+			return nil
+		}
+		b := deviceBucket.Bucket(name)
+		if b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
+
+// update calls the given function with the named bucket of this device in a read-write transaction,
+// creating the bucket if it doesn't exist yet.
+func (s *BoltStore) update(name []byte, fn func(b *bbolt.Bucket) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		deviceBucket, err := s.createDeviceBucket(tx, s.JID)
+		if err != nil {
+			return err
+		}
+		b, err := deviceBucket.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// get returns a copy of the value with the given key in the named bucket, or nil if it doesn't exist.
+func (s *BoltStore) get(name, key []byte) (value []byte, err error) {
+	err = s.view(name, func(b *bbolt.Bucket) error {
+		if data := b.Get(key); data != nil {
+			// Values returned by bbolt are only valid for the duration of the transaction
+			value = cloneBytes(data)
+		}
+		return nil
+	})
+	return
+}
+
+func (s *BoltStore) put(name, key, value []byte) error {
+	return s.update(name, func(b *bbolt.Bucket) error {
+		return b.Put(key, value)
+	})
+}
+
+func (s *BoltStore) delete(name, key []byte) error {
+	return s.update(name, func(b *bbolt.Bucket) error {
+		return b.Delete(key)
+	})
+}
+
+func (s *BoltStore) deleteWithPrefix(name, prefix []byte) error {
+	return s.update(name, func(b *bbolt.Bucket) error {
+		cur := b.Cursor()
+		for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Seek(prefix) {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.put(identitiesBucket, []byte(address), key[:])
+}
+
+func (s *BoltStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deleteWithPrefix(identitiesBucket, []byte(phone+":"))
+}
+
+func (s *BoltStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.delete(identitiesBucket, []byte(address))
+}
+
+func (s *BoltStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existingIdentity, err := s.get(identitiesBucket, []byte(address))
+	if err != nil {
+		return false, err
+	} else if existingIdentity == nil {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	} else if len(existingIdentity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existingIdentity) == key, nil
+}
+
+func (s *BoltStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.get(sessionsBucket, []byte(address))
+}
+
+func (s *BoltStore) HasSession(ctx context.Context, address string) (has bool, err error) {
+	err = s.view(sessionsBucket, func(b *bbolt.Bucket) error {
+		has = b.Get([]byte(address)) != nil
+		return nil
+	})
+	return
+}
+
+func (s *BoltStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.put(sessionsBucket, []byte(address), session)
+}
+
+func (s *BoltStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deleteWithPrefix(sessionsBucket, []byte(phone+":"))
+}
+
+func (s *BoltStore) DeleteSession(ctx context.Context, address string) error {
+	return s.delete(sessionsBucket, []byte(address))
+}
+
+// Prekeys are stored with big-endian IDs as keys, so that cursor iteration is in ID order.
+// The first byte of the value is the uploaded flag, followed by the 32-byte private key.
+
+func preKeyID(id uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, id)
+	return key
+}
+
+func parsePreKey(k, v []byte) (*keys.PreKey, bool, error) {
+	if len(k) != 4 || len(v) != 33 {
+		return nil, false, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(v[1:])),
+		KeyID:   binary.BigEndian.Uint32(k),
+	}, v[0] == 1, nil
+}
+
+func genOnePreKey(b *bbolt.Bucket, markUploaded bool) (*keys.PreKey, error) {
+	var nextKeyID uint32 = 1
+	if lastKey, _ := b.Cursor().Last(); lastKey != nil {
+		nextKeyID = binary.BigEndian.Uint32(lastKey) + 1
+	}
+	key := keys.NewPreKey(nextKeyID)
+	value := make([]byte, 33)
+	if markUploaded {
+		value[0] = 1
+	}
+	copy(value[1:], key.Priv[:])
+	return key, b.Put(preKeyID(key.KeyID), value)
+}
+
+func (s *BoltStore) GenOnePreKey(ctx context.Context) (key *keys.PreKey, err error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	err = s.update(preKeysBucket, func(b *bbolt.Bucket) error {
+		key, err = genOnePreKey(b, true)
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	newKeys := make([]*keys.PreKey, 0, count)
+	err := s.update(preKeysBucket, func(b *bbolt.Bucket) error {
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil && uint32(len(newKeys)) < count; k, v = cur.Next() {
+			key, uploaded, err := parsePreKey(k, v)
+			if err != nil {
+				return err
+			} else if !uploaded {
+				newKeys = append(newKeys, key)
+			}
+		}
+		for uint32(len(newKeys)) < count {
+			key, err := genOnePreKey(b, false)
+			if err != nil {
+				return fmt.Errorf("failed to generate prekey: %w", err)
+			}
+			newKeys = append(newKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newKeys, nil
+}
+
+func (s *BoltStore) GetPreKey(ctx context.Context, id uint32) (key *keys.PreKey, err error) {
+	err = s.view(preKeysBucket, func(b *bbolt.Bucket) error {
+		k := preKeyID(id)
+		v := b.Get(k)
+		if v == nil {
+			return nil
+		}
+		key, _, err = parsePreKey(k, v)
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.delete(preKeysBucket, preKeyID(id))
+}
+
+func (s *BoltStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	return s.update(preKeysBucket, func(b *bbolt.Bucket) error {
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil && binary.BigEndian.Uint32(k) <= upToID; k, v = cur.Next() {
+			if len(v) > 0 && v[0] != 1 {
+				updated := cloneBytes(v)
+				updated[0] = 1
+				err := b.Put(k, updated)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	err = s.view(preKeysBucket, func(b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			if len(v) > 0 && v[0] == 1 {
+				count++
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func senderKeyID(group, user string) []byte {
+	return []byte(group + "|" + user)
+}
+
+func (s *BoltStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.put(senderKeysBucket, senderKeyID(group, user), session)
+}
+
+func (s *BoltStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.get(senderKeysBucket, senderKeyID(group, user))
+}
+
+func (s *BoltStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	data, err := json.Marshal(&key)
+	if err != nil {
+		return err
+	}
+	return s.put(appStateSyncKeysBucket, id, data)
+}
+
+func (s *BoltStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	data, err := s.get(appStateSyncKeysBucket, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var key store.AppStateSyncKey
+	err = json.Unmarshal(data, &key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app state sync key: %w", err)
+	}
+	return &key, nil
+}
+
+func (s *BoltStore) GetLatestAppStateSyncKeyID(ctx context.Context) (latestID []byte, err error) {
+	var latestTimestamp int64
+	err = s.view(appStateSyncKeysBucket, func(b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var key store.AppStateSyncKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return fmt.Errorf("failed to parse app state sync key: %w", err)
+			} else if latestID == nil || key.Timestamp > latestTimestamp {
+				latestID, latestTimestamp = cloneBytes(k), key.Timestamp
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (s *BoltStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	data := make([]byte, 8+len(hash))
+	binary.BigEndian.PutUint64(data, version)
+	copy(data[8:], hash[:])
+	return s.put(appStateVersionBucket, []byte(name), data)
+}
+
+func (s *BoltStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var data []byte
+	data, err = s.get(appStateVersionBucket, []byte(name))
+	if err != nil || data == nil {
+		// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+		return
+	} else if len(data) != 8+len(hash) {
+		err = ErrInvalidLength
+		return
+	}
+	version = binary.BigEndian.Uint64(data)
+	hash = *(*[128]byte)(data[8:])
+	return
+}
+
+func (s *BoltStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.delete(appStateVersionBucket, []byte(name))
+}
+
+// Mutation MACs are stored in a nested bucket per app state name, with the index MAC as the key
+// and the big-endian version followed by the value MAC as the value.
+
+func (s *BoltStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	return s.update(appStateMACsBucket, func(b *bbolt.Bucket) error {
+		nameBucket, err := b.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		for _, mutation := range mutations {
+			if existing := nameBucket.Get(mutation.IndexMAC); len(existing) >= 8 && binary.BigEndian.Uint64(existing) > version {
+				continue
+			}
+			value := make([]byte, 8+len(mutation.ValueMAC))
+			binary.BigEndian.PutUint64(value, version)
+			copy(value[8:], mutation.ValueMAC)
+			err = nameBucket.Put(mutation.IndexMAC, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	if len(indexMACs) == 0 {
+		return nil
+	}
+	return s.update(appStateMACsBucket, func(b *bbolt.Bucket) error {
+		nameBucket := b.Bucket([]byte(name))
+		if nameBucket == nil {
+			return nil
+		}
+		for _, indexMAC := range indexMACs {
+			err := nameBucket.Delete(indexMAC)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) (valueMAC []byte, err error) {
+	err = s.view(appStateMACsBucket, func(b *bbolt.Bucket) error {
+		nameBucket := b.Bucket([]byte(name))
+		if nameBucket == nil {
+			return nil
+		}
+		value := nameBucket.Get(indexMAC)
+		if value == nil {
+			return nil
+		} else if len(value) < 8 {
+			return ErrInvalidLength
+		}
+		valueMAC = cloneBytes(value[8:])
+		return nil
+	})
+	return
+}
+
+type boltContact struct {
+	FirstName    string `json:"first_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+}
+
+func (bc *boltContact) toInfo() types.ContactInfo {
+	return types.ContactInfo{
+		Found:        true,
+		FirstName:    bc.FirstName,
+		FullName:     bc.FullName,
+		PushName:     bc.PushName,
+		BusinessName: bc.BusinessName,
+	}
+}
+
+func getContact(b *bbolt.Bucket, user []byte) (*boltContact, error) {
+	var contact boltContact
+	if data := b.Get(user); data != nil {
+		err := json.Unmarshal(data, &contact)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact info of %s: %w", user, err)
+		}
+	}
+	return &contact, nil
+}
+
+func putContact(b *bbolt.Bucket, user []byte, contact *boltContact) error {
+	data, err := json.Marshal(contact)
+	if err != nil {
+		return err
+	}
+	return b.Put(user, data)
+}
+
+// updateContact applies the given function to the stored contact info and saves the result if it returns true.
+func (s *BoltStore) updateContact(user types.JID, update func(contact *boltContact) bool) error {
+	return s.update(contactsBucket, func(b *bbolt.Bucket) error {
+		key := []byte(user.String())
+		contact, err := getContact(b, key)
+		if err != nil {
+			return err
+		}
+		if update(contact) {
+			return putContact(b, key, contact)
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) PutPushName(ctx context.Context, user types.JID, pushName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(user, func(contact *boltContact) bool {
+		if contact.PushName != pushName {
+			previousName = contact.PushName
+			contact.PushName = pushName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *BoltStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(user, func(contact *boltContact) bool {
+		if contact.BusinessName != businessName {
+			previousName = contact.BusinessName
+			contact.BusinessName = businessName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *BoltStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	return s.updateContact(user, func(contact *boltContact) bool {
+		if contact.FirstName != firstName || contact.FullName != fullName {
+			contact.FirstName = firstName
+			contact.FullName = fullName
+			return true
+		}
+		return false
+	})
+}
+
+func (s *BoltStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	return s.update(contactsBucket, func(b *bbolt.Bucket) error {
+		for _, entry := range contacts {
+			if entry.JID.IsEmpty() {
+				s.log.Warnf("Empty contact info in mass insert: %+v", entry)
+				continue
+			}
+			key := []byte(entry.JID.String())
+			contact, err := getContact(b, key)
+			if err != nil {
+				return err
+			}
+			contact.FirstName = entry.FirstName
+			contact.FullName = entry.FullName
+			err = putContact(b, key, contact)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetContact(ctx context.Context, user types.JID) (info types.ContactInfo, err error) {
+	err = s.view(contactsBucket, func(b *bbolt.Bucket) error {
+		key := []byte(user.String())
+		if b.Get(key) == nil {
+			return nil
+		}
+		contact, err := getContact(b, key)
+		if err != nil {
+			return err
+		}
+		info = contact.toInfo()
+		return nil
+	})
+	return
+}
+
+func (s *BoltStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	output := make(map[types.JID]types.ContactInfo)
+	err := s.view(contactsBucket, func(b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			jid, err := types.ParseJID(string(k))
+			if err != nil {
+				return fmt.Errorf("failed to parse contact JID %q: %w", k, err)
+			}
+			var contact boltContact
+			err = json.Unmarshal(v, &contact)
+			if err != nil {
+				return fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+			}
+			output[jid] = contact.toInfo()
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+type boltChatSettings struct {
+	MutedUntil int64 `json:"muted_until,omitempty"`
+	Pinned     bool  `json:"pinned,omitempty"`
+	Archived   bool  `json:"archived,omitempty"`
+}
+
+func (s *BoltStore) updateChatSettings(chat types.JID, update func(settings *boltChatSettings)) error {
+	return s.update(chatSettingsBucket, func(b *bbolt.Bucket) error {
+		key := []byte(chat.String())
+		var settings boltChatSettings
+		if data := b.Get(key); data != nil {
+			err := json.Unmarshal(data, &settings)
+			if err != nil {
+				return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+			}
+		}
+		update(&settings)
+		data, err := json.Marshal(&settings)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, data)
+	})
+}
+
+func (s *BoltStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
+	}
+	return s.updateChatSettings(chat, func(settings *boltChatSettings) {
+		settings.MutedUntil = val
+	})
+}
+
+func (s *BoltStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.updateChatSettings(chat, func(settings *boltChatSettings) {
+		settings.Pinned = pinned
+	})
+}
+
+func (s *BoltStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.updateChatSettings(chat, func(settings *boltChatSettings) {
+		settings.Archived = archived
+	})
+}
+
+func (s *BoltStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var data []byte
+	data, err = s.get(chatSettingsBucket, []byte(chat.String()))
+	if err != nil || data == nil {
+		return
+	}
+	var stored boltChatSettings
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		err = fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		return
+	}
+	settings.Found = true
+	settings.Pinned = stored.Pinned
+	settings.Archived = stored.Archived
+	if stored.MutedUntil != 0 {
+		settings.MutedUntil = time.Unix(stored.MutedUntil, 0)
+	}
+	return
+}
+
+func msgSecretKey(chat, sender types.JID, id types.MessageID) []byte {
+	return []byte(chat.ToNonAD().String() + "|" + sender.ToNonAD().String() + "|" + id)
+}
+
+func putMessageSecret(b *bbolt.Bucket, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	key := msgSecretKey(chat, sender, id)
+	if b.Get(key) != nil {
+		return nil
+	}
+	return b.Put(key, secret)
+}
+
+func (s *BoltStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	return s.update(msgSecretsBucket, func(b *bbolt.Bucket) error {
+		for _, insert := range inserts {
+			err := putMessageSecret(b, insert.Chat, insert.Sender, insert.ID, insert.Secret)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	return s.update(msgSecretsBucket, func(b *bbolt.Bucket) error {
+		return putMessageSecret(b, chat, sender, id, secret)
+	})
+}
+
+func (s *BoltStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.get(msgSecretsBucket, msgSecretKey(chat, sender, id))
+}
+
+func cloneBytes(data []byte) []byte {
+	return append([]byte(nil), data...)
+}
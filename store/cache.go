@@ -0,0 +1,324 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// DefaultCacheSize is the cache size used if a non-positive size is passed to NewCachedContainer.
+const DefaultCacheSize = 1024
+
+// lruCache is a simple least-recently-used cache. It's not safe for concurrent use.
+type lruCache struct {
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (lru *lruCache) get(key string) (interface{}, bool) {
+	elem, ok := lru.items[key]
+	if !ok {
+		return nil, false
+	}
+	lru.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+func (lru *lruCache) set(key string, value interface{}) {
+	if elem, ok := lru.items[key]; ok {
+		elem.Value.(*lruEntry).value = value
+		lru.order.MoveToFront(elem)
+		return
+	}
+	lru.items[key] = lru.order.PushFront(&lruEntry{key: key, value: value})
+	for lru.order.Len() > lru.size {
+		lru.remove(lru.order.Back().Value.(*lruEntry).key)
+	}
+}
+
+// setIfAbsent stores the value only if the key isn't cached yet and returns the cached value.
+func (lru *lruCache) setIfAbsent(key string, value interface{}) interface{} {
+	if existing, ok := lru.get(key); ok {
+		return existing
+	}
+	lru.set(key, value)
+	return value
+}
+
+func (lru *lruCache) remove(key string) {
+	if elem, ok := lru.items[key]; ok {
+		lru.order.Remove(elem)
+		delete(lru.items, key)
+	}
+}
+
+func (lru *lruCache) removePrefix(prefix string) {
+	for key := range lru.items {
+		if strings.HasPrefix(key, prefix) {
+			lru.remove(key)
+		}
+	}
+}
+
+// CachedContainer wraps another Container and caches devices and Signal sessions in memory.
+//
+// All writes go through to the inner container before the cache is updated, so the inner container always
+// has the latest data. Changes made directly through the inner container (or by other processes using the
+// same database) are not noticed, so the same devices shouldn't be written from multiple places.
+type CachedContainer struct {
+	inner Container
+
+	lock     sync.Mutex
+	devices  *lruCache
+	sessions *lruCache
+}
+
+var _ Container = (*CachedContainer)(nil)
+
+// NewCachedContainer wraps the given container with an in-memory cache.
+//
+// The size is the maximum number of devices and the maximum number of sessions (across all devices) that are cached.
+// If the size is zero or negative, DefaultCacheSize is used.
+//
+//	container := store.NewCachedContainer(sqlContainer, 10000)
+func NewCachedContainer(inner Container, size int) *CachedContainer {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &CachedContainer{
+		inner:    inner,
+		devices:  newLRUCache(size),
+		sessions: newLRUCache(size),
+	}
+}
+
+// Unwrap returns the underlying container.
+func (cc *CachedContainer) Unwrap() Container {
+	return cc.inner
+}
+
+func (cc *CachedContainer) wrapDevice(device *Device) *Device {
+	if device == nil {
+		return nil
+	}
+	device.Container = cc
+	if device.ID == nil {
+		// Stores are only wrapped once the JID is known, see PutDevice
+		return device
+	}
+	if _, alreadyWrapped := device.Sessions.(*cachedSessionStore); !alreadyWrapped && device.Sessions != nil {
+		device.Sessions = &cachedSessionStore{SessionStore: device.Sessions, cc: cc, prefix: device.ID.String() + "/"}
+	}
+	return device
+}
+
+// cacheDevice stores the device in the cache unless another instance of the same device is already cached,
+// in which case the cached instance is returned.
+func (cc *CachedContainer) cacheDevice(device *Device) *Device {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return cc.devices.setIfAbsent(device.ID.String(), device).(*Device)
+}
+
+// NewDevice creates a new device in the underlying container. It's only cached after it's saved.
+func (cc *CachedContainer) NewDevice() *Device {
+	return cc.wrapDevice(cc.inner.NewDevice())
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (cc *CachedContainer) GetFirstDevice(ctx context.Context) (*Device, error) {
+	devices, err := cc.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return cc.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice returns the cached device with the specified JID, or gets it from the underlying container.
+//
+// If the device is not found, nil is returned instead.
+func (cc *CachedContainer) GetDevice(ctx context.Context, jid types.JID) (*Device, error) {
+	cc.lock.Lock()
+	cached, ok := cc.devices.get(jid.String())
+	cc.lock.Unlock()
+	if ok {
+		return cached.(*Device), nil
+	}
+	device, err := cc.inner.GetDevice(ctx, jid)
+	if err != nil || device == nil {
+		return device, err
+	}
+	return cc.cacheDevice(cc.wrapDevice(device)), nil
+}
+
+// GetAllDevices gets all devices from the underlying container. Devices that are already cached
+// are returned as the cached instances.
+func (cc *CachedContainer) GetAllDevices(ctx context.Context) ([]*Device, error) {
+	devices, err := cc.inner.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, device := range devices {
+		devices[i] = cc.cacheDevice(cc.wrapDevice(device))
+	}
+	return devices, nil
+}
+
+var _ DeviceLister = (*CachedContainer)(nil)
+
+// ListDevices gets a page of devices from the underlying container. Devices that are already cached
+// are returned as the cached instances.
+func (cc *CachedContainer) ListDevices(ctx context.Context, offset, limit int, filter DeviceFilter) ([]*Device, error) {
+	devices, err := ListDevices(ctx, cc.inner, offset, limit, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i, device := range devices {
+		devices[i] = cc.cacheDevice(cc.wrapDevice(device))
+	}
+	return devices, nil
+}
+
+// PutDevice stores the given device in the underlying container and caches it.
+func (cc *CachedContainer) PutDevice(ctx context.Context, device *Device) error {
+	err := cc.inner.PutDevice(ctx, device)
+	// The inner container may have initialized the stores and replaced the container field
+	cc.wrapDevice(device)
+	if err == nil && device.ID != nil {
+		cc.lock.Lock()
+		cc.devices.set(device.ID.String(), device)
+		cc.lock.Unlock()
+	}
+	return err
+}
+
+// PutLastSeen stores the last seen time of the given device in the underlying container.
+func (cc *CachedContainer) PutLastSeen(ctx context.Context, device *Device) error {
+	if updater, ok := cc.inner.(LastSeenUpdater); ok {
+		return updater.PutLastSeen(ctx, device)
+	}
+	return cc.PutDevice(ctx, device)
+}
+
+// DeleteDevice deletes the given device from the underlying container and drops it and its sessions from the cache.
+func (cc *CachedContainer) DeleteDevice(ctx context.Context, device *Device) error {
+	err := cc.inner.DeleteDevice(ctx, device)
+	if err == nil && device.ID != nil {
+		cc.lock.Lock()
+		cc.devices.remove(device.ID.String())
+		cc.sessions.removePrefix(device.ID.String() + "/")
+		cc.lock.Unlock()
+	}
+	return err
+}
+
+type cachedSessionStore struct {
+	SessionStore
+	cc     *CachedContainer
+	prefix string
+}
+
+func (s *cachedSessionStore) get(ctx context.Context, address string) ([]byte, error) {
+	key := s.prefix + address
+	s.cc.lock.Lock()
+	cached, ok := s.cc.sessions.get(key)
+	s.cc.lock.Unlock()
+	if ok {
+		return cached.([]byte), nil
+	}
+	session, err := s.SessionStore.GetSession(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	s.cc.lock.Lock()
+	// Don't overwrite the value if it was changed while the session was being fetched
+	session = s.cc.sessions.setIfAbsent(key, session).([]byte)
+	s.cc.lock.Unlock()
+	return session, nil
+}
+
+func (s *cachedSessionStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.get(ctx, address)
+}
+
+func (s *cachedSessionStore) HasSession(ctx context.Context, address string) (bool, error) {
+	session, err := s.get(ctx, address)
+	return session != nil, err
+}
+
+func (s *cachedSessionStore) PutSession(ctx context.Context, address string, session []byte) error {
+	err := s.SessionStore.PutSession(ctx, address, session)
+	if err == nil {
+		s.cc.lock.Lock()
+		s.cc.sessions.set(s.prefix+address, session)
+		s.cc.lock.Unlock()
+	}
+	return err
+}
+
+func (s *cachedSessionStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	err := s.SessionStore.DeleteAllSessions(ctx, phone)
+	if err == nil {
+		s.cc.lock.Lock()
+		s.cc.sessions.removePrefix(s.prefix + phone + ":")
+		s.cc.lock.Unlock()
+	}
+	return err
+}
+
+func (s *cachedSessionStore) DeleteSession(ctx context.Context, address string) error {
+	err := s.SessionStore.DeleteSession(ctx, address)
+	if err == nil {
+		s.cc.lock.Lock()
+		// A nil session means the session is known to not exist
+		s.cc.sessions.set(s.prefix+address, []byte(nil))
+		s.cc.lock.Unlock()
+	}
+	return err
+}
+
+// ExportData passes through to the wrapped store, so that Migrate and Device.ExportJSON work on cached devices.
+func (s *cachedSessionStore) ExportData(ctx context.Context) (*ExportedData, error) {
+	exporter, ok := s.SessionStore.(DataExporter)
+	if !ok {
+		return nil, ErrExportNotSupported
+	}
+	return exporter.ExportData(ctx)
+}
+
+// PruneSessions passes through to the wrapped store and drops the sessions of the device from the cache.
+func (s *cachedSessionStore) PruneSessions(ctx context.Context, before time.Time) (int, error) {
+	pruner, ok := s.SessionStore.(SessionPruner)
+	if !ok {
+		return 0, ErrPruneNotSupported
+	}
+	count, err := pruner.PruneSessions(ctx, before)
+	s.cc.lock.Lock()
+	s.cc.sessions.removePrefix(s.prefix)
+	s.cc.lock.Unlock()
+	return count, err
+}
@@ -0,0 +1,69 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+type countingSessionStore struct {
+	store.SessionStore
+	gets int
+}
+
+func (s *countingSessionStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	s.gets++
+	return s.SessionStore.GetSession(ctx, address)
+}
+
+func TestCachedContainer(t *testing.T) {
+	ctx := context.Background()
+	inner := inmemstore.New(nil)
+	container := store.NewCachedContainer(inner, 2)
+
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	counter := &countingSessionStore{}
+	_ = inner.PutDevice(ctx, device)
+	counter.SessionStore = device.Sessions
+	device.Sessions = counter
+	if err := container.PutDevice(ctx, device); err != nil {
+		t.Fatalf("Failed to put device: %v", err)
+	}
+
+	if cached, _ := container.GetDevice(ctx, jid); cached != device {
+		t.Fatalf("Expected GetDevice to return the cached instance")
+	}
+
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("one"))
+	_ = device.Sessions.PutSession(ctx, "222:1", []byte("two"))
+	for i := 0; i < 3; i++ {
+		if session, _ := device.Sessions.GetSession(ctx, "111:1"); string(session) != "one" {
+			t.Fatalf("Unexpected session %q", session)
+		}
+	}
+	if counter.gets != 0 {
+		t.Errorf("Expected cached sessions to not be fetched, got %d fetches", counter.gets)
+	}
+
+	// The cache only fits two sessions, so 222:1 (the least recently used) is evicted
+	_ = device.Sessions.PutSession(ctx, "333:1", []byte("three"))
+	if session, _ := device.Sessions.GetSession(ctx, "222:1"); string(session) != "two" {
+		t.Fatalf("Unexpected session %q after eviction", session)
+	}
+	if counter.gets != 1 {
+		t.Errorf("Expected evicted session to be fetched once, got %d fetches", counter.gets)
+	}
+
+	_ = device.Sessions.DeleteSession(ctx, "222:1")
+	if has, _ := device.Sessions.HasSession(ctx, "222:1"); has {
+		t.Errorf("Expected deleted session to be gone")
+	}
+	if counter.gets != 1 {
+		t.Errorf("Expected deleted session to be cached as missing, got %d fetches", counter.gets)
+	}
+}
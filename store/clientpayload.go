@@ -142,13 +142,49 @@ func SetOSInfo(name string, version [3]uint32) {
 	BaseClientPayload.UserAgent.OsBuildNumber = BaseClientPayload.UserAgent.OsVersion
 }
 
-func (device *Device) getRegistrationPayload() *waProto.ClientPayload {
+// DeviceInfo customizes how a single companion device is shown on the phone, as an alternative to changing the
+// package-level DeviceProps and BaseClientPayload, which apply to every device. Empty fields use the global values.
+type DeviceInfo struct {
+	// Name is shown as the name of the device in the list of linked devices. It's sent in the Os field of DeviceProps.
+	Name string
+	// OSVersion is the operating system version string sent in the user agent, e.g. "10.15.7".
+	OSVersion string
+	// Platform decides which browser or platform icon is shown next to the device.
+	Platform waProto.DeviceProps_PlatformType
+}
+
+// DeviceProps returns a copy of the global DeviceProps with the fields from this DeviceInfo applied.
+// It's safe to call on a nil DeviceInfo.
+func (info *DeviceInfo) DeviceProps() *waProto.DeviceProps {
+	props := proto.Clone(DeviceProps).(*waProto.DeviceProps)
+	if info == nil {
+		return props
+	}
+	if len(info.Name) > 0 {
+		props.Os = proto.String(info.Name)
+	}
+	if info.Platform != waProto.DeviceProps_UNKNOWN {
+		props.PlatformType = info.Platform.Enum()
+	}
+	return props
+}
+
+func (info *DeviceInfo) basePayload() *waProto.ClientPayload {
 	payload := proto.Clone(BaseClientPayload).(*waProto.ClientPayload)
+	if info != nil && len(info.OSVersion) > 0 {
+		payload.UserAgent.OsVersion = proto.String(info.OSVersion)
+		payload.UserAgent.OsBuildNumber = proto.String(info.OSVersion)
+	}
+	return payload
+}
+
+func (device *Device) getRegistrationPayload(info *DeviceInfo) *waProto.ClientPayload {
+	payload := info.basePayload()
 	regID := make([]byte, 4)
 	binary.BigEndian.PutUint32(regID, device.RegistrationID)
 	preKeyID := make([]byte, 4)
 	binary.BigEndian.PutUint32(preKeyID, device.SignedPreKey.KeyID)
-	deviceProps, _ := proto.Marshal(DeviceProps)
+	deviceProps, _ := proto.Marshal(info.DeviceProps())
 	payload.DevicePairingData = &waProto.ClientPayload_DevicePairingRegistrationData{
 		ERegid:      regID,
 		EKeytype:    []byte{ecc.DjbType},
@@ -163,8 +199,8 @@ func (device *Device) getRegistrationPayload() *waProto.ClientPayload {
 	return payload
 }
 
-func (device *Device) getLoginPayload() *waProto.ClientPayload {
-	payload := proto.Clone(BaseClientPayload).(*waProto.ClientPayload)
+func (device *Device) getLoginPayload(info *DeviceInfo) *waProto.ClientPayload {
+	payload := info.basePayload()
 	payload.Username = proto.Uint64(device.ID.UserInt())
 	payload.Device = proto.Uint32(uint32(device.ID.Device))
 	payload.Passive = proto.Bool(true)
@@ -172,9 +208,15 @@ func (device *Device) getLoginPayload() *waProto.ClientPayload {
 }
 
 func (device *Device) GetClientPayload() *waProto.ClientPayload {
+	return device.GetClientPayloadWithInfo(nil)
+}
+
+// GetClientPayloadWithInfo returns the client payload like GetClientPayload, but with the given device info
+// applied on top of the global DeviceProps and BaseClientPayload.
+func (device *Device) GetClientPayloadWithInfo(info *DeviceInfo) *waProto.ClientPayload {
 	if device.ID != nil {
-		return device.getLoginPayload()
+		return device.getLoginPayload(info)
 	} else {
-		return device.getRegistrationPayload()
+		return device.getRegistrationPayload(info)
 	}
 }
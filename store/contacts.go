@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// ContactStoreFactory creates the contact store for the device with the given JID.
+type ContactStoreFactory func(ourJID types.JID) ContactStore
+
+// ContactsContainer wraps another Container and stores the contacts and push names of its devices in a
+// separate backend, while Signal keys and all other data stay in the inner container.
+//
+// Contacts are not copied by Migrate or Device.ExportJSON, as those only read the data of the inner
+// container, and they're not deleted from the separate backend when a device is deleted.
+type ContactsContainer struct {
+	inner   Container
+	factory ContactStoreFactory
+}
+
+var _ Container = (*ContactsContainer)(nil)
+
+// NewContactsContainer wraps the given container so that the contact store of every device is created with the given factory.
+//
+// The stores of the built-in backends can be used as the factory, e.g. to keep Signal keys in SQLite
+// and contacts in Redis:
+//
+//	container := store.NewContactsContainer(sqlContainer, func(ourJID types.JID) store.ContactStore {
+//		return redisstore.NewRedisStore(redisContainer, ourJID)
+//	})
+func NewContactsContainer(inner Container, factory ContactStoreFactory) *ContactsContainer {
+	return &ContactsContainer{inner: inner, factory: factory}
+}
+
+// Unwrap returns the underlying container.
+func (cc *ContactsContainer) Unwrap() Container {
+	return cc.inner
+}
+
+type separateContactStore struct {
+	ContactStore
+}
+
+func (s *separateContactStore) unwrapStore() interface{} { return s.ContactStore }
+
+func (cc *ContactsContainer) wrapDevice(device *Device) *Device {
+	if device == nil {
+		return nil
+	}
+	device.Container = cc
+	if device.ID == nil {
+		// The contact store is only replaced once the JID is known, see PutDevice
+		return device
+	}
+	if _, alreadyReplaced := device.Contacts.(*separateContactStore); !alreadyReplaced {
+		device.Contacts = &separateContactStore{ContactStore: cc.factory(*device.ID)}
+	}
+	return device
+}
+
+// NewDevice creates a new device in the underlying container.
+func (cc *ContactsContainer) NewDevice() *Device {
+	return cc.wrapDevice(cc.inner.NewDevice())
+}
+
+// GetFirstDevice gets the first device from the underlying container.
+func (cc *ContactsContainer) GetFirstDevice(ctx context.Context) (*Device, error) {
+	device, err := cc.inner.GetFirstDevice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cc.wrapDevice(device), nil
+}
+
+// GetDevice gets the device with the specified JID from the underlying container.
+func (cc *ContactsContainer) GetDevice(ctx context.Context, jid types.JID) (*Device, error) {
+	device, err := cc.inner.GetDevice(ctx, jid)
+	if err != nil {
+		return nil, err
+	}
+	return cc.wrapDevice(device), nil
+}
+
+// GetAllDevices gets all devices from the underlying container.
+func (cc *ContactsContainer) GetAllDevices(ctx context.Context) ([]*Device, error) {
+	devices, err := cc.inner.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		cc.wrapDevice(device)
+	}
+	return devices, nil
+}
+
+var _ DeviceLister = (*ContactsContainer)(nil)
+
+// ListDevices gets a page of devices from the underlying container.
+func (cc *ContactsContainer) ListDevices(ctx context.Context, offset, limit int, filter DeviceFilter) ([]*Device, error) {
+	devices, err := ListDevices(ctx, cc.inner, offset, limit, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		cc.wrapDevice(device)
+	}
+	return devices, nil
+}
+
+// PutDevice stores the given device in the underlying container.
+func (cc *ContactsContainer) PutDevice(ctx context.Context, device *Device) error {
+	err := cc.inner.PutDevice(ctx, device)
+	// The inner container may have initialized the stores and replaced the container field
+	cc.wrapDevice(device)
+	return err
+}
+
+// PutLastSeen stores the last seen time of the given device in the underlying container.
+func (cc *ContactsContainer) PutLastSeen(ctx context.Context, device *Device) error {
+	if updater, ok := cc.inner.(LastSeenUpdater); ok {
+		return updater.PutLastSeen(ctx, device)
+	}
+	return cc.PutDevice(ctx, device)
+}
+
+// DeleteDevice deletes the given device from the underlying container.
+func (cc *ContactsContainer) DeleteDevice(ctx context.Context, device *Device) error {
+	return cc.inner.DeleteDevice(ctx, device)
+}
@@ -0,0 +1,39 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestContactsContainer(t *testing.T) {
+	ctx := context.Background()
+	contacts := make(map[types.JID]*inmemstore.MemoryStore)
+	inner := inmemstore.New(nil)
+	container := store.NewContactsContainer(inner, func(ourJID types.JID) store.ContactStore {
+		if _, ok := contacts[ourJID]; !ok {
+			contacts[ourJID] = inmemstore.NewMemoryStore()
+		}
+		return contacts[ourJID]
+	})
+
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	friend := types.NewJID("111", types.DefaultUserServer)
+	_, _, _ = device.Contacts.PutPushName(ctx, friend, "Friend")
+
+	if contact, _ := contacts[jid].GetContact(ctx, friend); contact.PushName != "Friend" {
+		t.Errorf("Expected contact to be stored in the separate store, got %+v", contact)
+	}
+	loaded, _ := container.GetDevice(ctx, jid)
+	if contact, _ := loaded.Contacts.GetContact(ctx, friend); contact.PushName != "Friend" {
+		t.Errorf("Expected loaded device to use the separate store, got %+v", contact)
+	}
+}
@@ -0,0 +1,424 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// DeviceExportVersion is the version of the format produced by Device.ExportJSON.
+// It's increased whenever the format changes in a way that older versions can't read.
+const DeviceExportVersion = 1
+
+var (
+	// ErrDeviceNotPaired is returned by Device.ExportJSON if the device doesn't have a JID yet.
+	ErrDeviceNotPaired = errors.New("device must be paired before exporting")
+	// ErrUnsupportedExportVersion is returned by ImportDeviceJSON if the export was made by a newer version of the library.
+	ErrUnsupportedExportVersion = errors.New("unsupported device export version")
+	// ErrInvalidDeviceExport is returned by ImportDeviceJSON if the export is missing required data.
+	ErrInvalidDeviceExport = errors.New("invalid device export")
+)
+
+type jsonPreKey struct {
+	ID       uint32 `json:"id"`
+	Key      []byte `json:"key"`
+	Uploaded bool   `json:"uploaded,omitempty"`
+}
+
+type jsonSignedPreKey struct {
+	ID        uint32 `json:"id"`
+	Key       []byte `json:"key"`
+	Signature []byte `json:"signature"`
+}
+
+type jsonSenderKey struct {
+	Group string `json:"group"`
+	User  string `json:"user"`
+	Key   []byte `json:"key"`
+}
+
+type jsonAppStateSyncKey struct {
+	ID          []byte `json:"id"`
+	Data        []byte `json:"data"`
+	Fingerprint []byte `json:"fingerprint"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+type jsonMutationMAC struct {
+	IndexMAC []byte `json:"index_mac"`
+	ValueMAC []byte `json:"value_mac"`
+	Version  uint64 `json:"version"`
+}
+
+type jsonAppState struct {
+	Name         string            `json:"name"`
+	Version      uint64            `json:"version"`
+	Hash         []byte            `json:"hash"`
+	MutationMACs []jsonMutationMAC `json:"mutation_macs,omitempty"`
+}
+
+type jsonContact struct {
+	FirstName    string `json:"first_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+}
+
+type jsonChatSettings struct {
+	MutedUntil int64 `json:"muted_until,omitempty"`
+	Pinned     bool  `json:"pinned,omitempty"`
+	Archived   bool  `json:"archived,omitempty"`
+}
+
+type jsonMessageSecret struct {
+	Chat   types.JID       `json:"chat"`
+	Sender types.JID       `json:"sender"`
+	ID     types.MessageID `json:"id"`
+	Secret []byte          `json:"secret"`
+}
+
+// jsonData is the JSON format of ExportedData. It's embedded in jsonDevice, so the data of a device
+// is stored in the same object as the device itself.
+type jsonData struct {
+	Identities       map[string][]byte              `json:"identities,omitempty"`
+	Sessions         map[string][]byte              `json:"sessions,omitempty"`
+	SessionTimes     map[string]int64               `json:"session_times,omitempty"`
+	PreKeys          []jsonPreKey                   `json:"pre_keys,omitempty"`
+	LastPreKeyID     uint32                         `json:"last_pre_key_id,omitempty"`
+	SenderKeys       []jsonSenderKey                `json:"sender_keys,omitempty"`
+	AppStateSyncKeys []jsonAppStateSyncKey          `json:"app_state_sync_keys,omitempty"`
+	AppStates        []jsonAppState                 `json:"app_states,omitempty"`
+	Contacts         map[types.JID]jsonContact      `json:"contacts,omitempty"`
+	ChatSettings     map[types.JID]jsonChatSettings `json:"chat_settings,omitempty"`
+	MessageSecrets   []jsonMessageSecret            `json:"message_secrets,omitempty"`
+}
+
+// jsonDevice is the format produced by Device.ExportJSON. Only private keys are included,
+// the public keys are derived from them when importing.
+type jsonDevice struct {
+	Version int `json:"version"`
+
+	JID            types.JID        `json:"jid"`
+	RegistrationID uint32           `json:"registration_id"`
+	NoiseKey       []byte           `json:"noise_key"`
+	IdentityKey    []byte           `json:"identity_key"`
+	SignedPreKey   jsonSignedPreKey `json:"signed_pre_key"`
+	AdvSecretKey   []byte           `json:"adv_secret_key"`
+	Account        []byte           `json:"account"`
+	Platform       string           `json:"platform,omitempty"`
+	BusinessName   string           `json:"business_name,omitempty"`
+	PushName       string           `json:"push_name,omitempty"`
+	LastSeen       int64            `json:"last_seen,omitempty"`
+
+	jsonData
+}
+
+func newJSONData(data *ExportedData) jsonData {
+	export := jsonData{
+		Identities:   make(map[string][]byte, len(data.Identities)),
+		Sessions:     data.Sessions,
+		LastPreKeyID: data.LastPreKeyID,
+		Contacts:     make(map[types.JID]jsonContact, len(data.Contacts)),
+		ChatSettings: make(map[types.JID]jsonChatSettings, len(data.ChatSettings)),
+	}
+	for address, key := range data.Identities {
+		key := key
+		export.Identities[address] = key[:]
+	}
+	if len(data.SessionTimes) > 0 {
+		export.SessionTimes = make(map[string]int64, len(data.SessionTimes))
+		for address, updatedAt := range data.SessionTimes {
+			export.SessionTimes[address] = updatedAt.Unix()
+		}
+	}
+	for _, preKey := range data.PreKeys {
+		export.PreKeys = append(export.PreKeys, jsonPreKey{ID: preKey.KeyID, Key: preKey.Priv[:], Uploaded: preKey.Uploaded})
+	}
+	for _, senderKey := range data.SenderKeys {
+		export.SenderKeys = append(export.SenderKeys, jsonSenderKey(senderKey))
+	}
+	for _, syncKey := range data.AppStateSyncKeys {
+		export.AppStateSyncKeys = append(export.AppStateSyncKeys, jsonAppStateSyncKey{
+			ID:          syncKey.ID,
+			Data:        syncKey.Key.Data,
+			Fingerprint: syncKey.Key.Fingerprint,
+			Timestamp:   syncKey.Key.Timestamp,
+		})
+	}
+	for _, state := range data.AppStates {
+		state := state
+		exportState := jsonAppState{Name: state.Name, Version: state.Version, Hash: state.Hash[:]}
+		for _, mac := range state.MutationMACs {
+			exportState.MutationMACs = append(exportState.MutationMACs, jsonMutationMAC{
+				IndexMAC: mac.IndexMAC,
+				ValueMAC: mac.ValueMAC,
+				Version:  mac.Version,
+			})
+		}
+		export.AppStates = append(export.AppStates, exportState)
+	}
+	for jid, contact := range data.Contacts {
+		export.Contacts[jid] = jsonContact{
+			FirstName:    contact.FirstName,
+			FullName:     contact.FullName,
+			PushName:     contact.PushName,
+			BusinessName: contact.BusinessName,
+		}
+	}
+	for chat, settings := range data.ChatSettings {
+		exportSettings := jsonChatSettings{Pinned: settings.Pinned, Archived: settings.Archived}
+		if !settings.MutedUntil.IsZero() {
+			exportSettings.MutedUntil = settings.MutedUntil.Unix()
+		}
+		export.ChatSettings[chat] = exportSettings
+	}
+	for _, secret := range data.MessageSecrets {
+		export.MessageSecrets = append(export.MessageSecrets, jsonMessageSecret(secret))
+	}
+	return export
+}
+
+func privateKey(data []byte, name string) (*keys.KeyPair, error) {
+	if len(data) != 32 {
+		return nil, fmt.Errorf("%w: %s must be 32 bytes", ErrInvalidDeviceExport, name)
+	}
+	return keys.NewKeyPairFromPrivateKey(*(*[32]byte)(data)), nil
+}
+
+// parse converts the JSON data back into ExportedData.
+func (export *jsonData) parse() (*ExportedData, error) {
+	data := &ExportedData{
+		Identities:   make(map[string][32]byte, len(export.Identities)),
+		Sessions:     export.Sessions,
+		LastPreKeyID: export.LastPreKeyID,
+		Contacts:     make(map[types.JID]types.ContactInfo, len(export.Contacts)),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings, len(export.ChatSettings)),
+	}
+	for address, key := range export.Identities {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%w: identity of %s must be 32 bytes", ErrInvalidDeviceExport, address)
+		}
+		data.Identities[address] = *(*[32]byte)(key)
+	}
+	if len(export.SessionTimes) > 0 {
+		data.SessionTimes = make(map[string]time.Time, len(export.SessionTimes))
+		for address, updatedAt := range export.SessionTimes {
+			data.SessionTimes[address] = time.Unix(updatedAt, 0)
+		}
+	}
+	for _, preKey := range export.PreKeys {
+		keyPair, err := privateKey(preKey.Key, fmt.Sprintf("prekey %d", preKey.ID))
+		if err != nil {
+			return nil, err
+		}
+		data.PreKeys = append(data.PreKeys, PreKeyEntry{PreKey: keys.PreKey{KeyPair: *keyPair, KeyID: preKey.ID}, Uploaded: preKey.Uploaded})
+	}
+	for _, senderKey := range export.SenderKeys {
+		data.SenderKeys = append(data.SenderKeys, SenderKeyEntry(senderKey))
+	}
+	for _, syncKey := range export.AppStateSyncKeys {
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, AppStateSyncKeyEntry{
+			ID:  syncKey.ID,
+			Key: AppStateSyncKey{Data: syncKey.Data, Fingerprint: syncKey.Fingerprint, Timestamp: syncKey.Timestamp},
+		})
+	}
+	for _, state := range export.AppStates {
+		if len(state.Hash) != 128 {
+			return nil, fmt.Errorf("%w: hash of %s app state must be 128 bytes", ErrInvalidDeviceExport, state.Name)
+		}
+		entry := AppStateEntry{Name: state.Name, Version: state.Version, Hash: *(*[128]byte)(state.Hash)}
+		for _, mac := range state.MutationMACs {
+			entry.MutationMACs = append(entry.MutationMACs, AppStateMutationMACEntry{
+				AppStateMutationMAC: AppStateMutationMAC{IndexMAC: mac.IndexMAC, ValueMAC: mac.ValueMAC},
+				Version:             mac.Version,
+			})
+		}
+		data.AppStates = append(data.AppStates, entry)
+	}
+	for jid, contact := range export.Contacts {
+		data.Contacts[jid] = types.ContactInfo{
+			Found:        true,
+			FirstName:    contact.FirstName,
+			FullName:     contact.FullName,
+			PushName:     contact.PushName,
+			BusinessName: contact.BusinessName,
+		}
+	}
+	for chat, settings := range export.ChatSettings {
+		importSettings := types.LocalChatSettings{Found: true, Pinned: settings.Pinned, Archived: settings.Archived}
+		if settings.MutedUntil != 0 {
+			importSettings.MutedUntil = time.Unix(settings.MutedUntil, 0)
+		}
+		data.ChatSettings[chat] = importSettings
+	}
+	for _, secret := range export.MessageSecrets {
+		data.MessageSecrets = append(data.MessageSecrets, MessageSecretInsert(secret))
+	}
+	return data, nil
+}
+
+// MarshalJSON encodes the data in the same format that Device.ExportJSON uses for the data of a device.
+func (data *ExportedData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONData(data))
+}
+
+// UnmarshalJSON decodes data encoded with MarshalJSON. Keys with an invalid length cause an ErrInvalidDeviceExport.
+func (data *ExportedData) UnmarshalJSON(raw []byte) error {
+	var export jsonData
+	err := json.Unmarshal(raw, &export)
+	if err != nil {
+		return err
+	}
+	parsed, err := export.parse()
+	if err != nil {
+		return err
+	}
+	*data = *parsed
+	return nil
+}
+
+// MarshalDeviceJSON encodes the credentials of the given device and the given data in the format used by
+// Device.ExportJSON. The data can be nil to only include the device itself. The stores of the device are
+// not used, which allows stores to use this format for persisting devices without a DataExporter.
+//
+//	raw, err := store.MarshalDeviceJSON(device, nil)
+func MarshalDeviceJSON(device *Device, data *ExportedData) ([]byte, error) {
+	if device.ID == nil {
+		return nil, ErrDeviceNotPaired
+	}
+	account, err := proto.Marshal(device.Account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account: %w", err)
+	}
+	export := &jsonDevice{
+		Version:        DeviceExportVersion,
+		JID:            *device.ID,
+		RegistrationID: device.RegistrationID,
+		NoiseKey:       device.NoiseKey.Priv[:],
+		IdentityKey:    device.IdentityKey.Priv[:],
+		SignedPreKey: jsonSignedPreKey{
+			ID:        device.SignedPreKey.KeyID,
+			Key:       device.SignedPreKey.Priv[:],
+			Signature: device.SignedPreKey.Signature[:],
+		},
+		AdvSecretKey: device.AdvSecretKey,
+		Account:      account,
+		Platform:     device.Platform,
+		BusinessName: device.BusinessName,
+		PushName:     device.PushName,
+	}
+	if !device.LastSeen.IsZero() {
+		export.LastSeen = device.LastSeen.Unix()
+	}
+	if data != nil {
+		export.jsonData = newJSONData(data)
+	}
+	return json.Marshal(export)
+}
+
+// UnmarshalDeviceJSON decodes a device encoded with MarshalDeviceJSON or Device.ExportJSON.
+//
+// The returned device only contains the credentials and metadata, the caller must set the container and
+// stores before using it. The returned data is empty if the device was encoded without data.
+func UnmarshalDeviceJSON(raw []byte) (*Device, *ExportedData, error) {
+	var export jsonDevice
+	err := json.Unmarshal(raw, &export)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidDeviceExport, err)
+	} else if export.Version < 1 || export.Version > DeviceExportVersion {
+		return nil, nil, fmt.Errorf("%w %d", ErrUnsupportedExportVersion, export.Version)
+	}
+	return export.parse()
+}
+
+// parse converts the JSON export back into a device and its data.
+func (export *jsonDevice) parse() (*Device, *ExportedData, error) {
+	var device Device
+	var err error
+	if export.JID.IsEmpty() {
+		return nil, nil, fmt.Errorf("%w: missing JID", ErrInvalidDeviceExport)
+	} else if device.NoiseKey, err = privateKey(export.NoiseKey, "noise key"); err != nil {
+		return nil, nil, err
+	} else if device.IdentityKey, err = privateKey(export.IdentityKey, "identity key"); err != nil {
+		return nil, nil, err
+	}
+	signedPreKey, err := privateKey(export.SignedPreKey.Key, "signed prekey")
+	if err != nil {
+		return nil, nil, err
+	} else if len(export.SignedPreKey.Signature) != 64 {
+		return nil, nil, fmt.Errorf("%w: signed prekey signature must be 64 bytes", ErrInvalidDeviceExport)
+	}
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *signedPreKey,
+		KeyID:     export.SignedPreKey.ID,
+		Signature: (*[64]byte)(export.SignedPreKey.Signature),
+	}
+	device.Account = &waProto.ADVSignedDeviceIdentity{}
+	err = proto.Unmarshal(export.Account, device.Account)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to parse account: %v", ErrInvalidDeviceExport, err)
+	}
+	jid := export.JID
+	device.ID = &jid
+	device.RegistrationID = export.RegistrationID
+	device.AdvSecretKey = export.AdvSecretKey
+	device.Platform = export.Platform
+	device.BusinessName = export.BusinessName
+	device.PushName = export.PushName
+	if export.LastSeen != 0 {
+		device.LastSeen = time.Unix(export.LastSeen, 0)
+	}
+	data, err := export.jsonData.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &device, data, nil
+}
+
+// ExportJSON returns a self-contained JSON blob with the credentials of this device and all of its data,
+// which can be imported into any container with ImportDeviceJSON.
+//
+// The blob contains private keys and can be used to take over the session, so it must be stored securely.
+// The stores of the device must implement DataExporter, which all the stores in the subpackages of this package do.
+func (device *Device) ExportJSON(ctx context.Context) ([]byte, error) {
+	if device.ID == nil {
+		return nil, ErrDeviceNotPaired
+	}
+	exporter, ok := device.Sessions.(DataExporter)
+	if !ok {
+		return nil, ErrExportNotSupported
+	}
+	data, err := exporter.ExportData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+	return MarshalDeviceJSON(device, data)
+}
+
+// ImportDeviceJSON imports a device exported with Device.ExportJSON into the given container
+// and returns the new device.
+//
+// If the container already has a device with the same JID, ErrDeviceAlreadyExists is returned
+// and nothing is changed. Importing data other than prekeys only uses the standard store interfaces,
+// but the prekey store of the container must implement PreKeyImporter.
+func ImportDeviceJSON(ctx context.Context, container Container, data []byte) (*Device, error) {
+	device, exportedData, err := UnmarshalDeviceJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := container.GetDevice(ctx, *device.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if device exists: %w", err)
+	} else if existing != nil {
+		return nil, ErrDeviceAlreadyExists
+	}
+	return saveCopy(ctx, device, exportedData, container)
+}
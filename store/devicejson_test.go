@@ -0,0 +1,67 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestDeviceJSONRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	device.Account = &waProto.ADVSignedDeviceIdentity{Details: []byte("details")}
+	device.PushName = "Tester"
+	alice := types.NewJID("4567", types.DefaultUserServer)
+	_ = device.Sessions.PutSession(ctx, "4567:0", []byte("session"))
+	_ = device.Identities.PutIdentity(ctx, "4567:0", [32]byte{1, 2, 3})
+	_, _ = device.PreKeys.GetOrGenPreKeys(ctx, 3)
+	_ = device.AppState.PutAppStateVersion(ctx, "regular", 5, [128]byte{9})
+	_, _, _ = device.Contacts.PutPushName(ctx, alice, "Alice")
+
+	data, err := device.ExportJSON(ctx)
+	if err != nil {
+		t.Fatalf("failed to export device: %v", err)
+	}
+	imported, err := store.ImportDeviceJSON(ctx, inmemstore.New(nil), data)
+	if err != nil {
+		t.Fatalf("failed to import device: %v", err)
+	}
+	if *imported.ID != jid || *imported.IdentityKey.Pub != *device.IdentityKey.Pub || imported.PushName != "Tester" {
+		t.Fatal("imported device doesn't match exported device")
+	} else if !bytes.Equal(imported.Account.Details, device.Account.Details) {
+		t.Fatal("imported account doesn't match exported account")
+	}
+	if sess, _ := imported.Sessions.GetSession(ctx, "4567:0"); string(sess) != "session" {
+		t.Fatalf("unexpected session %q", sess)
+	}
+	if trusted, _ := imported.Identities.IsTrustedIdentity(ctx, "4567:0", [32]byte{1, 2, 3}); !trusted {
+		t.Fatal("identity wasn't imported")
+	}
+	if count, _ := imported.PreKeys.UploadedPreKeyCount(ctx); count != 0 {
+		t.Fatalf("unexpected uploaded prekey count %d", count)
+	} else if key, _ := imported.PreKeys.GetPreKey(ctx, 3); key == nil {
+		t.Fatal("prekey wasn't imported")
+	}
+	if version, hash, _ := imported.AppState.GetAppStateVersion(ctx, "regular"); version != 5 || hash[0] != 9 {
+		t.Fatalf("unexpected app state version %d", version)
+	}
+	if contact, _ := imported.Contacts.GetContact(ctx, alice); contact.PushName != "Alice" {
+		t.Fatalf("unexpected contact %+v", contact)
+	}
+}
+
+func TestImportDeviceJSONVersion(t *testing.T) {
+	ctx := context.Background()
+	_, err := store.ImportDeviceJSON(ctx, inmemstore.New(nil), []byte(`{"version":99}`))
+	if !errors.Is(err, store.ErrUnsupportedExportVersion) {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeviceFilter specifies which devices ListDevices returns. Empty fields match all devices.
+type DeviceFilter struct {
+	// PushName only matches devices whose push name contains the given string, ignoring case.
+	PushName string
+	// Platform only matches devices with exactly the given platform.
+	Platform string
+	// LastSeenAfter and LastSeenBefore only match devices that were last connected within the given range.
+	// Devices that haven't connected since they were paired have a zero LastSeen, so they never match LastSeenAfter.
+	LastSeenAfter  time.Time
+	LastSeenBefore time.Time
+}
+
+// Match checks whether the given device matches the filter.
+func (filter *DeviceFilter) Match(device *Device) bool {
+	if filter.PushName != "" && !strings.Contains(strings.ToLower(device.PushName), strings.ToLower(filter.PushName)) {
+		return false
+	} else if filter.Platform != "" && device.Platform != filter.Platform {
+		return false
+	} else if !filter.LastSeenAfter.IsZero() && !device.LastSeen.After(filter.LastSeenAfter) {
+		return false
+	} else if !filter.LastSeenBefore.IsZero() && !device.LastSeen.Before(filter.LastSeenBefore) {
+		return false
+	}
+	return true
+}
+
+// DeviceLister is implemented by containers that can filter and paginate devices in the database
+// instead of loading all of them into memory.
+type DeviceLister interface {
+	// ListDevices returns at most limit devices that match the filter, skipping the first offset ones.
+	// Devices are sorted by JID, so that the same offset always returns the same page.
+	// A limit of zero or less returns all matching devices.
+	ListDevices(ctx context.Context, offset, limit int, filter DeviceFilter) ([]*Device, error)
+}
+
+// ListDevices returns a page of the devices in the given container that match the filter, sorted by JID.
+// A limit of zero or less returns all matching devices after the offset.
+//
+// If the container implements DeviceLister, the filtering is done by the database. Otherwise, all
+// devices are fetched with GetAllDevices and filtered in memory.
+//
+//	page, err := store.ListDevices(ctx, container, 100, 50, store.DeviceFilter{Platform: "android"})
+func ListDevices(ctx context.Context, container Container, offset, limit int, filter DeviceFilter) ([]*Device, error) {
+	if lister, ok := container.(DeviceLister); ok {
+		return lister.ListDevices(ctx, offset, limit, filter)
+	}
+	devices, err := container.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return FilterDevices(devices, offset, limit, filter), nil
+}
+
+// FilterDevices sorts the given devices by JID and returns the page that matches the filter.
+// It's meant for implementing DeviceLister in containers that can't filter devices in the database.
+func FilterDevices(devices []*Device, offset, limit int, filter DeviceFilter) []*Device {
+	matching := make([]*Device, 0, len(devices))
+	for _, device := range devices {
+		if device.ID != nil && filter.Match(device) {
+			matching = append(matching, device)
+		}
+	}
+	sortDevices(matching)
+	return pageDevices(matching, offset, limit)
+}
+
+func sortDevices(devices []*Device) {
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID.String() < devices[j].ID.String()
+	})
+}
+
+func pageDevices(devices []*Device, offset, limit int) []*Device {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(devices) {
+		return []*Device{}
+	}
+	devices = devices[offset:]
+	if limit > 0 && limit < len(devices) {
+		devices = devices[:limit]
+	}
+	return devices
+}
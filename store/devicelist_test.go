@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestListDevices(t *testing.T) {
+	ctx := context.Background()
+	container := store.NewShardedContainer(inmemstore.New(nil), inmemstore.New(nil))
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		device := container.NewDevice()
+		jid := types.NewADJID(strconv.Itoa(1000+i), 0, 1)
+		device.ID = &jid
+		device.PushName = "Device " + strconv.Itoa(i)
+		device.Platform = "android"
+		if i%2 == 1 {
+			device.Platform = "ios"
+			device.LastSeen = now.Add(-time.Duration(i) * time.Hour)
+		}
+		if err := device.Save(ctx); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+	}
+
+	page, err := store.ListDevices(ctx, container, 5, 5, store.DeviceFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list devices: %v", err)
+	} else if len(page) != 5 || page[0].ID.User != "1005" || page[4].ID.User != "1009" {
+		t.Errorf("Unexpected page %v", page)
+	}
+	if page, _ = store.ListDevices(ctx, container, 0, 0, store.DeviceFilter{Platform: "ios"}); len(page) != 10 {
+		t.Errorf("Expected 10 iOS devices, got %d", len(page))
+	}
+	if page, _ = store.ListDevices(ctx, container, 0, 0, store.DeviceFilter{PushName: "device 1"}); len(page) != 11 {
+		t.Errorf("Expected 11 devices with a matching push name, got %d", len(page))
+	}
+	page, _ = store.ListDevices(ctx, container, 0, 0, store.DeviceFilter{LastSeenAfter: now.Add(-6 * time.Hour)})
+	if len(page) != 3 || page[0].ID.User != "1001" {
+		t.Errorf("Expected 3 recently seen devices, got %v", page)
+	}
+	if page, _ = store.ListDevices(ctx, container, 0, 0, store.DeviceFilter{LastSeenBefore: now.Add(-6 * time.Hour)}); len(page) != 17 {
+		t.Errorf("Expected 17 devices that weren't seen recently, got %d", len(page))
+	}
+	if page, _ = store.ListDevices(ctx, container, 30, 10, store.DeviceFilter{}); len(page) != 0 {
+		t.Errorf("Expected no devices after the end, got %d", len(page))
+	}
+}
@@ -0,0 +1,391 @@
+// Package dynamostore contains an AWS DynamoDB implementation of the interfaces in the store package.
+//
+// All data is stored in a single table with a string partition key (pk) and a string sort key (sk).
+// Devices are stored in one partition, and all the data of a device is stored in its own partition,
+// so deleting a device or listing its sessions only needs queries, never scans. Operations that
+// would race between multiple instances (allocating prekey IDs, updating push names, inserting
+// message secrets) use atomic updates or conditional writes instead of local locks.
+package dynamostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// Client contains the subset of the DynamoDB API used by the store. It's implemented by *dynamodb.Client.
+type Client interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+}
+
+var _ Client = (*dynamodb.Client)(nil)
+
+// Container is a wrapper for a DynamoDB table that can contain multiple whatsmeow sessions.
+type Container struct {
+	client Client
+	table  string
+	tenant string
+	log    waLog.Logger
+
+	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	ReadOnly bool
+}
+
+var _ store.Container = (*Container)(nil)
+
+// New wraps the given DynamoDB client in a Container that uses the given table.
+//
+// The table must have a string partition key called pk and a string sort key called sk.
+// CreateTable can be used to create it. The logger can be nil and will default to a no-op logger.
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	container := dynamostore.New(dynamodb.NewFromConfig(cfg), "whatsmeow", nil)
+func New(client Client, table string, log waLog.Logger) *Container {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Container{
+		client: client,
+		table:  table,
+		log:    log,
+	}
+}
+
+// WithTenant returns a Container that shares the client and table with this one, but only sees the devices
+// of the given tenant. The partition keys of the tenant are prefixed with `tenant#<tenant>#`, so the devices
+// and data of different tenants never collide.
+//
+// Containers created with New use the empty default tenant, which doesn't see the devices of other tenants.
+//
+//	customerContainer := container.WithTenant("customer-42")
+//	devices, err := customerContainer.GetAllDevices(ctx)
+func (c *Container) WithTenant(tenant string) *Container {
+	return &Container{
+		client: c.client,
+		table:  c.table,
+		tenant: tenant,
+		log:    c.log,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
+// CreateTable creates the table used by this container with on-demand billing.
+//
+// DynamoDB creates tables asynchronously, so the table may not be usable immediately after this returns.
+// Use dynamodb.NewTableExistsWaiter to wait until the table is active.
+func (c *Container) CreateTable(ctx context.Context) error {
+	_, err := c.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(c.table),
+		BillingMode: ddbtypes.BillingModePayPerRequest,
+		AttributeDefinitions: []ddbtypes.AttributeDefinition{
+			{AttributeName: aws.String(attrPK), AttributeType: ddbtypes.ScalarAttributeTypeS},
+			{AttributeName: aws.String(attrSK), AttributeType: ddbtypes.ScalarAttributeTypeS},
+		},
+		KeySchema: []ddbtypes.KeySchemaElement{
+			{AttributeName: aws.String(attrPK), KeyType: ddbtypes.KeyTypeHash},
+			{AttributeName: aws.String(attrSK), KeyType: ddbtypes.KeyTypeRange},
+		},
+	})
+	return err
+}
+
+const (
+	attrPK    = "pk"
+	attrSK    = "sk"
+	attrValue = "v"
+
+	// devicesPartitionName is the partition key of the items containing the devices themselves.
+	devicesPartitionName = "devices"
+)
+
+const (
+	fieldRegistrationID   = "registration_id"
+	fieldNoiseKey         = "noise_key"
+	fieldIdentityKey      = "identity_key"
+	fieldSignedPreKey     = "signed_pre_key"
+	fieldSignedPreKeyID   = "signed_pre_key_id"
+	fieldSignedPreKeySig  = "signed_pre_key_sig"
+	fieldAdvKey           = "adv_key"
+	fieldAdvDetails       = "adv_details"
+	fieldAdvAccountSig    = "adv_account_sig"
+	fieldAdvAccountSigKey = "adv_account_sig_key"
+	fieldAdvDeviceSig     = "adv_device_sig"
+	fieldPlatform         = "platform"
+	fieldBusinessName     = "business_name"
+	fieldPushName         = "push_name"
+	fieldLastSeen         = "last_seen"
+)
+
+// tenantPartition returns the given partition key namespaced with the tenant of this container.
+func (c *Container) tenantPartition(name string) string {
+	if c.tenant == "" {
+		return name
+	}
+	return "tenant#" + c.tenant + "#" + name
+}
+
+func (c *Container) devicesPartition() string {
+	return c.tenantPartition(devicesPartitionName)
+}
+
+// dataPartition returns the partition key of the items containing the data of the given device.
+func (c *Container) dataPartition(jid string) string {
+	return c.tenantPartition("data#" + jid)
+}
+
+func (c *Container) scanDevice(item map[string]ddbtypes.AttributeValue) (*store.Device, error) {
+	rawJID := getString(item, attrSK)
+	jid, err := types.ParseJID(rawJID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device JID %q: %w", rawJID, err)
+	}
+	noisePriv := getBytes(item, fieldNoiseKey)
+	identityPriv := getBytes(item, fieldIdentityKey)
+	preKeyPriv := getBytes(item, fieldSignedPreKey)
+	preKeySig := getBytes(item, fieldSignedPreKeySig)
+	if len(noisePriv) != 32 || len(identityPriv) != 32 || len(preKeyPriv) != 32 || len(preKeySig) != 64 {
+		return nil, ErrInvalidLength
+	}
+	registrationID, err := getUint(item, fieldRegistrationID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registration ID: %w", err)
+	}
+	preKeyID, err := getUint(item, fieldSignedPreKeyID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signed prekey ID: %w", err)
+	}
+	lastSeen, err := getUint(item, fieldLastSeen, 63)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse last seen timestamp: %w", err)
+	}
+
+	var device store.Device
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	device.Log = c.log
+	device.ID = &jid
+	device.RegistrationID = uint32(registrationID)
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(noisePriv))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(identityPriv))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(preKeyPriv)),
+		KeyID:     uint32(preKeyID),
+		Signature: (*[64]byte)(preKeySig),
+	}
+	device.AdvSecretKey = getBytes(item, fieldAdvKey)
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             getBytes(item, fieldAdvDetails),
+		AccountSignature:    getBytes(item, fieldAdvAccountSig),
+		AccountSignatureKey: getBytes(item, fieldAdvAccountSigKey),
+		DeviceSignature:     getBytes(item, fieldAdvDeviceSig),
+	}
+	device.Platform = getString(item, fieldPlatform)
+	device.BusinessName = getString(item, fieldBusinessName)
+	device.PushName = getString(item, fieldPushName)
+	if lastSeen != 0 {
+		device.LastSeen = time.Unix(int64(lastSeen), 0)
+	}
+
+	c.initStores(&device)
+	return &device, nil
+}
+
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewDynamoStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	if device.Contacts == nil {
+		device.Contacts = innerStore
+	}
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.Container = c
+	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "dynamostore", c.MetricsHook)
+}
+
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	sessions := make([]*store.Device, 0)
+	err := c.queryPrefix(ctx, c.devicesPartition(), "", func(item map[string]ddbtypes.AttributeValue) error {
+		sess, err := c.scanDevice(item)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, sess)
+		return nil
+	})
+	if err != nil {
+		return sessions, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the database.
+//
+// If the device is not found, nil is returned instead.
+//
+// Note that the parameter usually must be an AD-JID.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	item, err := c.getItem(ctx, c.devicesPartition(), jid.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	} else if item == nil {
+		return nil, nil
+	}
+	return c.scanDevice(item)
+}
+
+// NewDevice creates a new device in this database.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	return device
+}
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+// ErrInvalidLength is returned by some database getters if the database returned a byte array with an unexpected length.
+var ErrInvalidLength = errors.New("database returned byte array with illegal length")
+
+// PutDevice stores the given device in this database. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen uint64
+	if !device.LastSeen.IsZero() {
+		lastSeen = uint64(device.LastSeen.Unix())
+	}
+	_, err := c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.table),
+		Item: map[string]ddbtypes.AttributeValue{
+			attrPK:                avS(c.devicesPartition()),
+			attrSK:                avS(device.ID.String()),
+			fieldRegistrationID:   avN(uint64(device.RegistrationID)),
+			fieldNoiseKey:         avB(device.NoiseKey.Priv[:]),
+			fieldIdentityKey:      avB(device.IdentityKey.Priv[:]),
+			fieldSignedPreKey:     avB(device.SignedPreKey.Priv[:]),
+			fieldSignedPreKeyID:   avN(uint64(device.SignedPreKey.KeyID)),
+			fieldSignedPreKeySig:  avB(device.SignedPreKey.Signature[:]),
+			fieldAdvKey:           avB(device.AdvSecretKey),
+			fieldAdvDetails:       avB(device.Account.Details),
+			fieldAdvAccountSig:    avB(device.Account.AccountSignature),
+			fieldAdvAccountSigKey: avB(device.Account.AccountSignatureKey),
+			fieldAdvDeviceSig:     avB(device.Account.DeviceSignature),
+			fieldPlatform:         avS(device.Platform),
+			fieldBusinessName:     avS(device.BusinessName),
+			fieldPushName:         avS(device.PushName),
+			fieldLastSeen:         avN(lastSeen),
+		},
+	})
+
+	if !device.Initialized {
+		c.initStores(device)
+	}
+	return err
+}
+
+// PutLastSeen stores only the last seen time of the given device, which is cheaper than saving the whole device.
+func (c *Container) PutLastSeen(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutLastSeen"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen uint64
+	if !device.LastSeen.IsZero() {
+		lastSeen = uint64(device.LastSeen.Unix())
+	}
+	_, err := c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(c.table),
+		Key:              itemKey(c.devicesPartition(), device.ID.String()),
+		UpdateExpression: aws.String("SET #f = :value"),
+		// Don't create a partial device if it was deleted in the meantime
+		ConditionExpression:       aws.String("attribute_exists(sk)"),
+		ExpressionAttributeNames:  map[string]string{"#f": fieldLastSeen},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":value": avN(lastSeen)},
+	})
+	if isConditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteDevice deletes the given device and all of its data from this database. This should be called through Device.Delete()
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	jid := device.ID.String()
+	_, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.table),
+		Key:       itemKey(c.devicesPartition(), jid),
+	})
+	if err != nil {
+		return err
+	}
+	return c.deletePrefix(ctx, c.dataPartition(jid), "")
+}
@@ -0,0 +1,168 @@
+package dynamostore
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.DataExporter = (*DynamoStore)(nil)
+var _ store.PreKeyImporter = (*DynamoStore)(nil)
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *DynamoStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	data := &store.ExportedData{
+		Identities:   make(map[string][32]byte),
+		Sessions:     make(map[string][]byte),
+		Contacts:     make(map[types.JID]types.ContactInfo),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+	appStates := make(map[string]*store.AppStateEntry)
+	macs := make(map[string][]store.AppStateMutationMACEntry)
+	// All the data of a device is in the same partition, so a single query is enough
+	err := s.queryPrefix(ctx, s.partition, "", func(item map[string]ddbtypes.AttributeValue) error {
+		sk := getString(item, attrSK)
+		switch {
+		case strings.HasPrefix(sk, identityPrefix):
+			identity := getBytes(item, attrValue)
+			if len(identity) != 32 {
+				return ErrInvalidLength
+			}
+			data.Identities[strings.TrimPrefix(sk, identityPrefix)] = *(*[32]byte)(identity)
+		case strings.HasPrefix(sk, sessionPrefix):
+			data.Sessions[strings.TrimPrefix(sk, sessionPrefix)] = getBytes(item, attrValue)
+		case strings.HasPrefix(sk, preKeyPrefix):
+			key, err := parsePreKey(item)
+			if err != nil {
+				return err
+			}
+			data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *key, Uploaded: getBool(item, attrUploaded)})
+		case strings.HasPrefix(sk, senderKeyPrefix):
+			parts := strings.SplitN(strings.TrimPrefix(sk, senderKeyPrefix), "#", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid sender key ID %q", sk)
+			}
+			data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{Group: parts[0], User: parts[1], Key: getBytes(item, attrValue)})
+		case strings.HasPrefix(sk, appStateSyncKeyPrefix):
+			id, err := hex.DecodeString(strings.TrimPrefix(sk, appStateSyncKeyPrefix))
+			if err != nil {
+				return fmt.Errorf("invalid app state sync key ID %q: %w", sk, err)
+			}
+			key, err := parseAppStateSyncKey(item)
+			if err != nil {
+				return err
+			}
+			data.AppStateSyncKeys = append(data.AppStateSyncKeys, store.AppStateSyncKeyEntry{ID: id, Key: *key})
+		case strings.HasPrefix(sk, appStateVersionPrefix):
+			name := strings.TrimPrefix(sk, appStateVersionPrefix)
+			hash := getBytes(item, attrHash)
+			if len(hash) != 128 {
+				return ErrInvalidLength
+			}
+			version, err := getUint(item, attrVersion, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse app state version: %w", err)
+			}
+			appStates[name] = &store.AppStateEntry{Name: name, Version: version, Hash: *(*[128]byte)(hash)}
+		case strings.HasPrefix(sk, appStateMACPrefix):
+			parts := strings.SplitN(strings.TrimPrefix(sk, appStateMACPrefix), "#", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid mutation MAC key %q", sk)
+			}
+			indexMAC, err := hex.DecodeString(parts[1])
+			if err != nil {
+				return fmt.Errorf("invalid index MAC in %q: %w", sk, err)
+			}
+			version, err := getUint(item, attrVersion, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse mutation MAC version: %w", err)
+			}
+			macs[parts[0]] = append(macs[parts[0]], store.AppStateMutationMACEntry{
+				AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: indexMAC, ValueMAC: getBytes(item, attrValue)},
+				Version:             version,
+			})
+		case strings.HasPrefix(sk, contactPrefix):
+			rawJID := strings.TrimPrefix(sk, contactPrefix)
+			jid, err := types.ParseJID(rawJID)
+			if err != nil {
+				return fmt.Errorf("failed to parse contact JID %q: %w", rawJID, err)
+			}
+			data.Contacts[jid] = contactInfo(item)
+		case strings.HasPrefix(sk, chatSettingsPrefix):
+			rawJID := strings.TrimPrefix(sk, chatSettingsPrefix)
+			chat, err := types.ParseJID(rawJID)
+			if err != nil {
+				return fmt.Errorf("failed to parse chat JID %q: %w", rawJID, err)
+			}
+			data.ChatSettings[chat], err = chatSettings(item)
+			if err != nil {
+				return err
+			}
+		case strings.HasPrefix(sk, msgSecretPrefix):
+			parts := strings.SplitN(strings.TrimPrefix(sk, msgSecretPrefix), "#", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("invalid message secret key %q", sk)
+			}
+			entry := store.MessageSecretInsert{ID: parts[2], Secret: getBytes(item, attrValue)}
+			var err error
+			entry.Chat, err = types.ParseJID(parts[0])
+			if err != nil {
+				return fmt.Errorf("failed to parse chat JID %q: %w", parts[0], err)
+			}
+			entry.Sender, err = types.ParseJID(parts[1])
+			if err != nil {
+				return fmt.Errorf("failed to parse sender JID %q: %w", parts[1], err)
+			}
+			data.MessageSecrets = append(data.MessageSecrets, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export device data: %w", err)
+	}
+	for name, entry := range appStates {
+		entry.MutationMACs = macs[name]
+		data.AppStates = append(data.AppStates, *entry)
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *DynamoStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	if len(preKeys) == 0 {
+		return nil
+	}
+	var maxID uint32
+	items := make([]map[string]ddbtypes.AttributeValue, len(preKeys))
+	for i, preKey := range preKeys {
+		key := preKey.PreKey
+		items[i] = s.preKeyItem(&key, preKey.Uploaded)
+		if key.KeyID > maxID {
+			maxID = key.KeyID
+		}
+	}
+	err := s.putPreKeys(ctx, items)
+	if err != nil {
+		return err
+	}
+	// Move the counter forward so that new keys don't reuse the imported IDs, but never move it backwards
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.table),
+		Key:                       itemKey(s.partition, preKeyCounterKey),
+		UpdateExpression:          aws.String("SET last_id = :id"),
+		ConditionExpression:       aws.String("attribute_not_exists(last_id) OR last_id < :id"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":id": avN(uint64(maxID))},
+	})
+	if isConditionFailed(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,24 @@
+module github.com/insomnius/whatsmeow/store/dynamostore
+
+go 1.18
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.18.1
+	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.19.11
+	github.com/insomnius/whatsmeow v0.0.0
+)
+
+require (
+	filippo.io/edwards25519 v1.0.0 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.1.34 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.4.28 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.9.11 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/endpoint-discovery v1.7.28 // indirect
+	github.com/aws/smithy-go v1.13.5 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	go.mau.fi/libsignal v0.0.0-20221015105917-d970e7c3c9cf // indirect
+	golang.org/x/crypto v0.0.0-20221012134737-56aed061732a // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+replace github.com/insomnius/whatsmeow => ../..
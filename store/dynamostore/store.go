@@ -0,0 +1,813 @@
+package dynamostore
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// Sort key prefixes of the different kinds of items in a device data partition.
+const (
+	identityPrefix        = "identity#"
+	sessionPrefix         = "session#"
+	preKeyPrefix          = "prekey#"
+	senderKeyPrefix       = "senderkey#"
+	appStateSyncKeyPrefix = "appstatekey#"
+	appStateVersionPrefix = "appstate#"
+	appStateMACPrefix     = "appstatemac#"
+	contactPrefix         = "contact#"
+	chatSettingsPrefix    = "chat#"
+	msgSecretPrefix       = "msgsecret#"
+
+	// preKeyCounterKey is the sort key of the item containing the last allocated prekey ID.
+	preKeyCounterKey = "prekey_counter"
+)
+
+const (
+	attrUploaded    = "uploaded"
+	attrLastID      = "last_id"
+	attrTimestamp   = "timestamp"
+	attrFingerprint = "fingerprint"
+	attrVersion     = "version"
+	attrHash        = "hash"
+	attrFirstName   = "first_name"
+	attrFullName    = "full_name"
+	attrMutedUntil  = "muted_until"
+	attrPinned      = "pinned"
+	attrArchived    = "archived"
+)
+
+// maxBatchSize is the maximum number of requests in a single BatchWriteItem call.
+const maxBatchSize = 25
+
+type DynamoStore struct {
+	*Container
+	JID string
+
+	partition string
+}
+
+// NewDynamoStore creates a new DynamoStore with the given container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewDynamoStore(c *Container, jid types.JID) *DynamoStore {
+	return &DynamoStore{
+		Container: c,
+		JID:       jid.String(),
+		partition: c.dataPartition(jid.String()),
+	}
+}
+
+var _ store.IdentityStore = (*DynamoStore)(nil)
+var _ store.SessionStore = (*DynamoStore)(nil)
+var _ store.PreKeyStore = (*DynamoStore)(nil)
+var _ store.SenderKeyStore = (*DynamoStore)(nil)
+var _ store.AppStateSyncKeyStore = (*DynamoStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*DynamoStore)(nil)
+var _ store.AppStateStore = (*DynamoStore)(nil)
+var _ store.ContactStore = (*DynamoStore)(nil)
+var _ store.ChatSettingsStore = (*DynamoStore)(nil)
+var _ store.MsgSecretStore = (*DynamoStore)(nil)
+
+func avS(value string) ddbtypes.AttributeValue {
+	return &ddbtypes.AttributeValueMemberS{Value: value}
+}
+
+func avB(value []byte) ddbtypes.AttributeValue {
+	if value == nil {
+		value = []byte{}
+	}
+	return &ddbtypes.AttributeValueMemberB{Value: value}
+}
+
+func avN(value uint64) ddbtypes.AttributeValue {
+	return &ddbtypes.AttributeValueMemberN{Value: strconv.FormatUint(value, 10)}
+}
+
+func avBool(value bool) ddbtypes.AttributeValue {
+	return &ddbtypes.AttributeValueMemberBOOL{Value: value}
+}
+
+func getString(item map[string]ddbtypes.AttributeValue, name string) string {
+	val, _ := item[name].(*ddbtypes.AttributeValueMemberS)
+	if val == nil {
+		return ""
+	}
+	return val.Value
+}
+
+func getBytes(item map[string]ddbtypes.AttributeValue, name string) []byte {
+	val, _ := item[name].(*ddbtypes.AttributeValueMemberB)
+	if val == nil {
+		return nil
+	}
+	return val.Value
+}
+
+func getUint(item map[string]ddbtypes.AttributeValue, name string, bitSize int) (uint64, error) {
+	val, _ := item[name].(*ddbtypes.AttributeValueMemberN)
+	if val == nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(val.Value, 10, bitSize)
+}
+
+func getBool(item map[string]ddbtypes.AttributeValue, name string) bool {
+	val, _ := item[name].(*ddbtypes.AttributeValueMemberBOOL)
+	return val != nil && val.Value
+}
+
+func itemKey(pk, sk string) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{attrPK: avS(pk), attrSK: avS(sk)}
+}
+
+func isConditionFailed(err error) bool {
+	var condErr *ddbtypes.ConditionalCheckFailedException
+	return errors.As(err, &condErr)
+}
+
+// getItem returns the item with the given key, or nil if it doesn't exist. Reads are always strongly consistent.
+func (c *Container) getItem(ctx context.Context, pk, sk string) (map[string]ddbtypes.AttributeValue, error) {
+	resp, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(c.table),
+		Key:            itemKey(pk, sk),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	} else if len(resp.Item) == 0 {
+		return nil, nil
+	}
+	return resp.Item, nil
+}
+
+// query runs the given query and calls the function for every returned item, following pagination.
+func (c *Container) query(ctx context.Context, input *dynamodb.QueryInput, fn func(item map[string]ddbtypes.AttributeValue) error) error {
+	input.TableName = aws.String(c.table)
+	input.ConsistentRead = aws.Bool(true)
+	for {
+		resp, err := c.client.Query(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, item := range resp.Items {
+			err = fn(item)
+			if err != nil {
+				return err
+			}
+		}
+		if len(resp.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// queryPrefix calls the given function for every item in the partition whose sort key starts with the given prefix.
+func (c *Container) queryPrefix(ctx context.Context, pk, skPrefix string, fn func(item map[string]ddbtypes.AttributeValue) error) error {
+	input := &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":pk": avS(pk)},
+	}
+	if skPrefix != "" {
+		input.KeyConditionExpression = aws.String("pk = :pk AND begins_with(sk, :prefix)")
+		input.ExpressionAttributeValues[":prefix"] = avS(skPrefix)
+	}
+	return c.query(ctx, input, fn)
+}
+
+// batchWrite executes the given write requests in batches, retrying unprocessed items until all of them are done.
+func (c *Container) batchWrite(ctx context.Context, requests []ddbtypes.WriteRequest) error {
+	for len(requests) > 0 {
+		batchSize := len(requests)
+		if batchSize > maxBatchSize {
+			batchSize = maxBatchSize
+		}
+		pending := map[string][]ddbtypes.WriteRequest{c.table: requests[:batchSize]}
+		requests = requests[batchSize:]
+		for attempt := 0; len(pending[c.table]) > 0; attempt++ {
+			if attempt > 0 {
+				// Unprocessed items are usually caused by throttling, so back off before retrying
+				time.Sleep(time.Duration(attempt) * 50 * time.Millisecond)
+			}
+			resp, err := c.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = resp.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// deletePrefix deletes all items in the partition whose sort key starts with the given prefix.
+func (c *Container) deletePrefix(ctx context.Context, pk, skPrefix string) error {
+	var requests []ddbtypes.WriteRequest
+	err := c.queryPrefix(ctx, pk, skPrefix, func(item map[string]ddbtypes.AttributeValue) error {
+		requests = append(requests, ddbtypes.WriteRequest{DeleteRequest: &ddbtypes.DeleteRequest{
+			Key: itemKey(pk, getString(item, attrSK)),
+		}})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.batchWrite(ctx, requests)
+}
+
+func (s *DynamoStore) get(ctx context.Context, sk string) (map[string]ddbtypes.AttributeValue, error) {
+	return s.getItem(ctx, s.partition, sk)
+}
+
+func (s *DynamoStore) getValue(ctx context.Context, sk string) ([]byte, error) {
+	item, err := s.get(ctx, sk)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return getBytes(item, attrValue), nil
+}
+
+func (s *DynamoStore) item(sk string, attrs map[string]ddbtypes.AttributeValue) map[string]ddbtypes.AttributeValue {
+	attrs[attrPK] = avS(s.partition)
+	attrs[attrSK] = avS(sk)
+	return attrs
+}
+
+func (s *DynamoStore) put(ctx context.Context, sk string, attrs map[string]ddbtypes.AttributeValue) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      s.item(sk, attrs),
+	})
+	return err
+}
+
+func (s *DynamoStore) putValue(ctx context.Context, sk string, value []byte) error {
+	return s.put(ctx, sk, map[string]ddbtypes.AttributeValue{attrValue: avB(value)})
+}
+
+func (s *DynamoStore) delete(ctx context.Context, sk string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key:       itemKey(s.partition, sk),
+	})
+	return err
+}
+
+// setAttrs sets the given attributes in the item with the given sort key, creating the item if it doesn't exist.
+func (s *DynamoStore) setAttrs(ctx context.Context, sk string, attrs map[string]ddbtypes.AttributeValue) error {
+	names := make(map[string]string, len(attrs))
+	values := make(map[string]ddbtypes.AttributeValue, len(attrs))
+	sets := make([]string, 0, len(attrs))
+	for name, value := range attrs {
+		placeholder := strconv.Itoa(len(sets))
+		names["#a"+placeholder] = name
+		values[":v"+placeholder] = value
+		sets = append(sets, "#a"+placeholder+" = :v"+placeholder)
+	}
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.table),
+		Key:                       itemKey(s.partition, sk),
+		UpdateExpression:          aws.String("SET " + strings.Join(sets, ", ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	return err
+}
+
+func (s *DynamoStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.putValue(ctx, identityPrefix+address, key[:])
+}
+
+func (s *DynamoStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deletePrefix(ctx, s.partition, identityPrefix+phone+":")
+}
+
+func (s *DynamoStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.delete(ctx, identityPrefix+address)
+}
+
+func (s *DynamoStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	item, err := s.get(ctx, identityPrefix+address)
+	if err != nil {
+		return false, err
+	} else if item == nil {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	}
+	existingIdentity := getBytes(item, attrValue)
+	if len(existingIdentity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existingIdentity) == key, nil
+}
+
+func (s *DynamoStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.getValue(ctx, sessionPrefix+address)
+}
+
+func (s *DynamoStore) HasSession(ctx context.Context, address string) (bool, error) {
+	item, err := s.get(ctx, sessionPrefix+address)
+	return item != nil, err
+}
+
+func (s *DynamoStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.putValue(ctx, sessionPrefix+address, session)
+}
+
+func (s *DynamoStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deletePrefix(ctx, s.partition, sessionPrefix+phone+":")
+}
+
+func (s *DynamoStore) DeleteSession(ctx context.Context, address string) error {
+	return s.delete(ctx, sessionPrefix+address)
+}
+
+// Prekey IDs are zero-padded in sort keys, so that queries return them in ID order.
+
+func preKeySortKey(id uint32) string {
+	return fmt.Sprintf("%s%010d", preKeyPrefix, id)
+}
+
+func parsePreKey(item map[string]ddbtypes.AttributeValue) (*keys.PreKey, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(getString(item, attrSK), preKeyPrefix), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prekey ID: %w", err)
+	}
+	priv := getBytes(item, attrValue)
+	if len(priv) != 32 {
+		return nil, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(priv)),
+		KeyID:   uint32(id),
+	}, nil
+}
+
+func (s *DynamoStore) preKeyItem(key *keys.PreKey, uploaded bool) map[string]ddbtypes.AttributeValue {
+	return s.item(preKeySortKey(key.KeyID), map[string]ddbtypes.AttributeValue{
+		attrValue:    avB(key.Priv[:]),
+		attrUploaded: avBool(uploaded),
+	})
+}
+
+func (s *DynamoStore) putPreKeys(ctx context.Context, items []map[string]ddbtypes.AttributeValue) error {
+	requests := make([]ddbtypes.WriteRequest, len(items))
+	for i, item := range items {
+		requests[i] = ddbtypes.WriteRequest{PutRequest: &ddbtypes.PutRequest{Item: item}}
+	}
+	return s.batchWrite(ctx, requests)
+}
+
+func (s *DynamoStore) genPreKeys(ctx context.Context, count uint32, markUploaded bool) ([]*keys.PreKey, error) {
+	// The counter is incremented atomically, so multiple instances can never allocate the same IDs
+	resp, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.table),
+		Key:                       itemKey(s.partition, preKeyCounterKey),
+		UpdateExpression:          aws.String("ADD last_id :count"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":count": avN(uint64(count))},
+		ReturnValues:              ddbtypes.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve prekey IDs: %w", err)
+	}
+	lastID, err := getUint(resp.Attributes, attrLastID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prekey ID counter: %w", err)
+	}
+	firstID := uint32(lastID) - count + 1
+	newKeys := make([]*keys.PreKey, count)
+	items := make([]map[string]ddbtypes.AttributeValue, count)
+	for i := range newKeys {
+		newKeys[i] = keys.NewPreKey(firstID + uint32(i))
+		items[i] = s.preKeyItem(newKeys[i], markUploaded)
+	}
+	err = s.putPreKeys(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys, nil
+}
+
+func (s *DynamoStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	newKeys, err := s.genPreKeys(ctx, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys[0], nil
+}
+
+// errEnoughPreKeys is used to stop the query in GetOrGenPreKeys once enough keys have been found.
+var errEnoughPreKeys = errors.New("enough prekeys found")
+
+func (s *DynamoStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	newKeys := make([]*keys.PreKey, 0, count)
+	err := s.query(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		FilterExpression:       aws.String("uploaded = :false"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":pk":     avS(s.partition),
+			":prefix": avS(preKeyPrefix),
+			":false":  avBool(false),
+		},
+	}, func(item map[string]ddbtypes.AttributeValue) error {
+		if uint32(len(newKeys)) >= count {
+			return errEnoughPreKeys
+		}
+		key, err := parsePreKey(item)
+		if err != nil {
+			return err
+		}
+		newKeys = append(newKeys, key)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEnoughPreKeys) {
+		return nil, fmt.Errorf("failed to query existing prekeys: %w", err)
+	}
+
+	if missing := count - uint32(len(newKeys)); missing > 0 {
+		var generated []*keys.PreKey
+		generated, err = s.genPreKeys(ctx, missing, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate prekeys: %w", err)
+		}
+		newKeys = append(newKeys, generated...)
+	}
+	return newKeys, nil
+}
+
+func (s *DynamoStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	item, err := s.get(ctx, preKeySortKey(id))
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return parsePreKey(item)
+}
+
+func (s *DynamoStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.delete(ctx, preKeySortKey(id))
+}
+
+func (s *DynamoStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	var toMark []string
+	err := s.query(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("pk = :pk AND sk BETWEEN :from AND :to"),
+		FilterExpression:       aws.String("uploaded = :false"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":pk":    avS(s.partition),
+			":from":  avS(preKeyPrefix),
+			":to":    avS(preKeySortKey(upToID)),
+			":false": avBool(false),
+		},
+		ProjectionExpression: aws.String("sk"),
+	}, func(item map[string]ddbtypes.AttributeValue) error {
+		toMark = append(toMark, getString(item, attrSK))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, sk := range toMark {
+		_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:        aws.String(s.table),
+			Key:              itemKey(s.partition, sk),
+			UpdateExpression: aws.String("SET uploaded = :true"),
+			// Don't recreate keys that were removed in the meantime
+			ConditionExpression:       aws.String("attribute_exists(sk)"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":true": avBool(true)},
+		})
+		if err != nil && !isConditionFailed(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		FilterExpression:       aws.String("uploaded = :true"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":pk":     avS(s.partition),
+			":prefix": avS(preKeyPrefix),
+			":true":   avBool(true),
+		},
+		Select:         ddbtypes.SelectCount,
+		ConsistentRead: aws.Bool(true),
+	}
+	for {
+		var resp *dynamodb.QueryOutput
+		resp, err = s.client.Query(ctx, input)
+		if err != nil {
+			return
+		}
+		count += int(resp.Count)
+		if len(resp.LastEvaluatedKey) == 0 {
+			return
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+func senderKeySortKey(group, user string) string {
+	return senderKeyPrefix + group + "#" + user
+}
+
+func (s *DynamoStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.putValue(ctx, senderKeySortKey(group, user), session)
+}
+
+func (s *DynamoStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.getValue(ctx, senderKeySortKey(group, user))
+}
+
+func (s *DynamoStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	return s.put(ctx, appStateSyncKeyPrefix+hex.EncodeToString(id), map[string]ddbtypes.AttributeValue{
+		attrValue:       avB(key.Data),
+		attrTimestamp:   &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(key.Timestamp, 10)},
+		attrFingerprint: avB(key.Fingerprint),
+	})
+}
+
+func parseAppStateSyncKey(item map[string]ddbtypes.AttributeValue) (*store.AppStateSyncKey, error) {
+	key := &store.AppStateSyncKey{
+		Data:        getBytes(item, attrValue),
+		Fingerprint: getBytes(item, attrFingerprint),
+	}
+	if ts, ok := item[attrTimestamp].(*ddbtypes.AttributeValueMemberN); ok {
+		var err error
+		key.Timestamp, err = strconv.ParseInt(ts.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse app state sync key timestamp: %w", err)
+		}
+	}
+	return key, nil
+}
+
+func (s *DynamoStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	item, err := s.get(ctx, appStateSyncKeyPrefix+hex.EncodeToString(id))
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return parseAppStateSyncKey(item)
+}
+
+func (s *DynamoStore) GetLatestAppStateSyncKeyID(ctx context.Context) (latestID []byte, err error) {
+	var latestTimestamp int64
+	err = s.queryPrefix(ctx, s.partition, appStateSyncKeyPrefix, func(item map[string]ddbtypes.AttributeValue) error {
+		key, err := parseAppStateSyncKey(item)
+		if err != nil {
+			return err
+		} else if latestID != nil && key.Timestamp <= latestTimestamp {
+			return nil
+		}
+		sk := getString(item, attrSK)
+		id, err := hex.DecodeString(strings.TrimPrefix(sk, appStateSyncKeyPrefix))
+		if err != nil {
+			return fmt.Errorf("invalid app state sync key ID %q: %w", sk, err)
+		}
+		latestID, latestTimestamp = id, key.Timestamp
+		return nil
+	})
+	return
+}
+
+func (s *DynamoStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	return s.put(ctx, appStateVersionPrefix+name, map[string]ddbtypes.AttributeValue{
+		attrVersion: avN(version),
+		attrHash:    avB(hash[:]),
+	})
+}
+
+func (s *DynamoStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var item map[string]ddbtypes.AttributeValue
+	item, err = s.get(ctx, appStateVersionPrefix+name)
+	if err != nil || item == nil {
+		// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+		return
+	}
+	storedHash := getBytes(item, attrHash)
+	if len(storedHash) != len(hash) {
+		err = ErrInvalidLength
+		return
+	}
+	version, err = getUint(item, attrVersion, 64)
+	if err != nil {
+		err = fmt.Errorf("failed to parse app state version: %w", err)
+		return
+	}
+	hash = *(*[128]byte)(storedHash)
+	return
+}
+
+func (s *DynamoStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.delete(ctx, appStateVersionPrefix+name)
+}
+
+func mutationMACSortKey(name string, indexMAC []byte) string {
+	return appStateMACPrefix + name + "#" + hex.EncodeToString(indexMAC)
+}
+
+func (s *DynamoStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	requests := make([]ddbtypes.WriteRequest, len(mutations))
+	for i, mutation := range mutations {
+		requests[i] = ddbtypes.WriteRequest{PutRequest: &ddbtypes.PutRequest{
+			Item: s.item(mutationMACSortKey(name, mutation.IndexMAC), map[string]ddbtypes.AttributeValue{
+				attrValue:   avB(mutation.ValueMAC),
+				attrVersion: avN(version),
+			}),
+		}}
+	}
+	return s.batchWrite(ctx, requests)
+}
+
+func (s *DynamoStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	requests := make([]ddbtypes.WriteRequest, len(indexMACs))
+	for i, indexMAC := range indexMACs {
+		requests[i] = ddbtypes.WriteRequest{DeleteRequest: &ddbtypes.DeleteRequest{
+			Key: itemKey(s.partition, mutationMACSortKey(name, indexMAC)),
+		}}
+	}
+	return s.batchWrite(ctx, requests)
+}
+
+func (s *DynamoStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	return s.getValue(ctx, mutationMACSortKey(name, indexMAC))
+}
+
+func contactInfo(item map[string]ddbtypes.AttributeValue) types.ContactInfo {
+	return types.ContactInfo{
+		Found:        true,
+		FirstName:    getString(item, attrFirstName),
+		FullName:     getString(item, attrFullName),
+		PushName:     getString(item, fieldPushName),
+		BusinessName: getString(item, fieldBusinessName),
+	}
+}
+
+// putContactField updates a single contact field if it's different from the stored value.
+//
+// The comparison is done by DynamoDB as a condition of the update, so concurrent updates from
+// multiple instances can't both report the same change.
+func (s *DynamoStore) putContactField(ctx context.Context, user types.JID, field, value string) (bool, string, error) {
+	condition := "attribute_not_exists(#f) OR #f <> :value"
+	if value == "" {
+		// A missing field is the same as an empty one
+		condition = "attribute_exists(#f) AND #f <> :value"
+	}
+	resp, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.table),
+		Key:                       itemKey(s.partition, contactPrefix+user.String()),
+		UpdateExpression:          aws.String("SET #f = :value"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#f": field},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":value": avS(value)},
+		ReturnValues:              ddbtypes.ReturnValueUpdatedOld,
+	})
+	if isConditionFailed(err) {
+		return false, "", nil
+	} else if err != nil {
+		return false, "", err
+	}
+	return true, getString(resp.Attributes, field), nil
+}
+
+func (s *DynamoStore) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	return s.putContactField(ctx, user, fieldPushName, pushName)
+}
+
+func (s *DynamoStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (bool, string, error) {
+	return s.putContactField(ctx, user, fieldBusinessName, businessName)
+}
+
+func (s *DynamoStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	return s.setAttrs(ctx, contactPrefix+user.String(), map[string]ddbtypes.AttributeValue{
+		attrFirstName: avS(firstName),
+		attrFullName:  avS(fullName),
+	})
+}
+
+func (s *DynamoStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	// BatchWriteItem can only replace whole items, which would remove push names, so update contacts one by one
+	for _, contact := range contacts {
+		if contact.JID.IsEmpty() {
+			s.log.Warnf("Empty contact info in mass insert: %+v", contact)
+			continue
+		}
+		err := s.PutContactName(ctx, contact.JID, contact.FirstName, contact.FullName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	item, err := s.get(ctx, contactPrefix+user.String())
+	if err != nil || item == nil {
+		return types.ContactInfo{}, err
+	}
+	return contactInfo(item), nil
+}
+
+func (s *DynamoStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	output := make(map[types.JID]types.ContactInfo)
+	err := s.queryPrefix(ctx, s.partition, contactPrefix, func(item map[string]ddbtypes.AttributeValue) error {
+		rawJID := strings.TrimPrefix(getString(item, attrSK), contactPrefix)
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return fmt.Errorf("failed to parse contact JID %q: %w", rawJID, err)
+		}
+		output[jid] = contactInfo(item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func chatSettings(item map[string]ddbtypes.AttributeValue) (types.LocalChatSettings, error) {
+	settings := types.LocalChatSettings{
+		Found:    true,
+		Pinned:   getBool(item, attrPinned),
+		Archived: getBool(item, attrArchived),
+	}
+	mutedUntil, err := getUint(item, attrMutedUntil, 63)
+	if err != nil {
+		return settings, fmt.Errorf("failed to parse muted until timestamp: %w", err)
+	} else if mutedUntil != 0 {
+		settings.MutedUntil = time.Unix(int64(mutedUntil), 0)
+	}
+	return settings, nil
+}
+
+func (s *DynamoStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val uint64
+	if !mutedUntil.IsZero() {
+		val = uint64(mutedUntil.Unix())
+	}
+	return s.setAttrs(ctx, chatSettingsPrefix+chat.String(), map[string]ddbtypes.AttributeValue{attrMutedUntil: avN(val)})
+}
+
+func (s *DynamoStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.setAttrs(ctx, chatSettingsPrefix+chat.String(), map[string]ddbtypes.AttributeValue{attrPinned: avBool(pinned)})
+}
+
+func (s *DynamoStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.setAttrs(ctx, chatSettingsPrefix+chat.String(), map[string]ddbtypes.AttributeValue{attrArchived: avBool(archived)})
+}
+
+func (s *DynamoStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var item map[string]ddbtypes.AttributeValue
+	item, err = s.get(ctx, chatSettingsPrefix+chat.String())
+	if err != nil || item == nil {
+		return
+	}
+	return chatSettings(item)
+}
+
+func msgSecretSortKey(chat, sender types.JID, id types.MessageID) string {
+	return msgSecretPrefix + chat.ToNonAD().String() + "#" + sender.ToNonAD().String() + "#" + id
+}
+
+func (s *DynamoStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	// BatchWriteItem doesn't support conditions, so the secrets have to be inserted one by one
+	for _, insert := range inserts {
+		err := s.PutMessageSecret(ctx, insert.Chat, insert.Sender, insert.ID, insert.Secret)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      s.item(msgSecretSortKey(chat, sender, id), map[string]ddbtypes.AttributeValue{attrValue: avB(secret)}),
+		// Existing secrets are never overwritten
+		ConditionExpression: aws.String("attribute_not_exists(sk)"),
+	})
+	if isConditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *DynamoStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.getValue(ctx, msgSecretSortKey(chat, sender, id))
+}
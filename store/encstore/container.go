@@ -0,0 +1,248 @@
+// Package encstore contains a store container decorator that encrypts key material before it's
+// passed to another container, so that the database only contains ciphertext.
+package encstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+
+	"golang.org/x/crypto/xts"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/gcmutil"
+	"github.com/insomnius/whatsmeow/util/hkdfutil"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// ErrInvalidKeyLength is returned by New if the given encryption key is not 32 bytes long.
+var ErrInvalidKeyLength = errors.New("encryption key must be 32 bytes")
+
+// ErrDecryptionFailed is returned when stored data can't be decrypted, e.g. because it was encrypted
+// with a different key or was stored before the encrypting container was used.
+var ErrDecryptionFailed = errors.New("failed to decrypt stored data")
+
+// Container wraps another store.Container and transparently encrypts data before it's persisted.
+//
+// The device's private keys (noise key, identity key, signed prekey and ADV secret) are encrypted
+// with AES-XTS, which preserves the length of the data, because most backends enforce their lengths.
+// XTS doesn't detect tampering, but a modified private key just fails the handshake or signature checks. Signal sessions,
+// sender keys, app state sync keys and message secrets are encrypted with AES-GCM, using the
+// owner JID and lookup key as associated data, so ciphertexts can't be swapped between rows.
+//
+// One-time prekeys are generated inside the underlying store and are therefore not encrypted.
+// Contacts, chat settings and app state hashes aren't key material and are stored as-is.
+type Container struct {
+	inner store.Container
+
+	aead        cipher.AEAD
+	fixedCipher *xts.Cipher
+}
+
+var _ store.Container = (*Container)(nil)
+
+// New wraps the given container so that all key material is encrypted with the given 32-byte key.
+//
+// The key must be kept somewhere other than the database (e.g. a KMS or an environment variable),
+// and losing it means losing access to all sessions in the container.
+//
+//	inner, err := sqlstore.New("postgres", "...", nil)
+//	if err != nil {
+//	    panic(err)
+//	}
+//	container, err := encstore.New(inner, key)
+func New(inner store.Container, key []byte) (*Container, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKeyLength
+	}
+	aead, err := gcmutil.Prepare(hkdfutil.SHA256(key, nil, []byte("whatsmeow encrypted store data"), 32))
+	if err != nil {
+		return nil, err
+	}
+	// XTS uses two AES-256 keys, one for the data and one for the tweak
+	fixedCipher, err := xts.NewCipher(aes.NewCipher, hkdfutil.SHA256(key, nil, []byte("whatsmeow encrypted store keys"), 64))
+	if err != nil {
+		return nil, err
+	}
+	return &Container{
+		inner:       inner,
+		aead:        aead,
+		fixedCipher: fixedCipher,
+	}, nil
+}
+
+// Unwrap returns the underlying container.
+func (c *Container) Unwrap() store.Container {
+	return c.inner
+}
+
+func (c *Container) decryptKeyPair(jid types.JID, field string, kp *keys.KeyPair) *keys.KeyPair {
+	return keys.NewKeyPairFromPrivateKey(c.decryptFixed(fixedTweak(jid, field), *kp.Priv))
+}
+
+func (c *Container) encryptKeyPair(jid types.JID, field string, kp *keys.KeyPair) *keys.KeyPair {
+	encrypted := c.encryptFixed(fixedTweak(jid, field), *kp.Priv)
+	// The public key doesn't matter, it's derived from the decrypted private key when loading
+	return &keys.KeyPair{Pub: kp.Pub, Priv: &encrypted}
+}
+
+// wrapDevice replaces the private keys and stores of a device loaded from the inner container with decrypting versions.
+func (c *Container) wrapDevice(device *store.Device) (*store.Device, error) {
+	if device == nil {
+		return nil, nil
+	}
+	// Don't modify the device returned by the inner container, it may be cached there
+	decrypted := *device
+	device = &decrypted
+	if device.ID != nil {
+		jid := *device.ID
+		device.NoiseKey = c.decryptKeyPair(jid, "noise", device.NoiseKey)
+		device.IdentityKey = c.decryptKeyPair(jid, "identity", device.IdentityKey)
+		device.SignedPreKey = &keys.PreKey{
+			KeyPair:   *c.decryptKeyPair(jid, "signed_pre_key", &device.SignedPreKey.KeyPair),
+			KeyID:     device.SignedPreKey.KeyID,
+			Signature: device.SignedPreKey.Signature,
+		}
+		if len(device.AdvSecretKey) == 32 {
+			advKey := c.decryptFixed(fixedTweak(jid, "adv"), *(*[32]byte)(device.AdvSecretKey))
+			device.AdvSecretKey = advKey[:]
+		}
+	}
+	c.wrapStores(device)
+	return device, nil
+}
+
+func (c *Container) wrapStores(device *store.Device) {
+	if device.ID != nil {
+		jid := device.ID.String()
+		if device.Sessions != nil {
+			device.Sessions = &sessionStore{SessionStore: device.Sessions, c: c, jid: jid}
+		}
+		if device.SenderKeys != nil {
+			device.SenderKeys = &senderKeyStore{SenderKeyStore: device.SenderKeys, c: c, jid: jid}
+		}
+		if device.AppStateKeys != nil {
+			device.AppStateKeys = &appStateSyncKeyStore{AppStateSyncKeyStore: device.AppStateKeys, c: c, jid: jid}
+		}
+		if device.MsgSecrets != nil {
+			device.MsgSecrets = &msgSecretStore{MsgSecretStore: device.MsgSecrets, c: c, jid: jid}
+		}
+	}
+	device.Container = c
+}
+
+// NewDevice creates a new device in the underlying container.
+func (c *Container) NewDevice() *store.Device {
+	device := c.inner.NewDevice()
+	// Stores are only wrapped once the JID is known, see PutDevice
+	device.Container = c
+	return device
+}
+
+// GetFirstDevice gets the first device from the underlying container and decrypts it.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	device, err := c.inner.GetFirstDevice(ctx)
+	if err != nil {
+		return nil, err
+	} else if device.ID == nil {
+		device.Container = c
+		return device, nil
+	}
+	return c.wrapDevice(device)
+}
+
+// GetDevice gets the device with the specified JID from the underlying container and decrypts it.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	device, err := c.inner.GetDevice(ctx, jid)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrapDevice(device)
+}
+
+// GetAllDevices gets all devices from the underlying container and decrypts them.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	devices, err := c.inner.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, device := range devices {
+		devices[i], err = c.wrapDevice(device)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+var _ store.DeviceLister = (*Container)(nil)
+
+// ListDevices gets a page of devices from the underlying container and decrypts them.
+// Only the private keys are encrypted, so the filtering can still be done by the underlying container.
+func (c *Container) ListDevices(ctx context.Context, offset, limit int, filter store.DeviceFilter) ([]*store.Device, error) {
+	devices, err := store.ListDevices(ctx, c.inner, offset, limit, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i, device := range devices {
+		devices[i], err = c.wrapDevice(device)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+// PutDevice encrypts the private keys of the given device and stores it in the underlying container.
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if device.ID == nil {
+		return c.inner.PutDevice(ctx, device)
+	}
+	jid := *device.ID
+	encrypted := *device
+	encrypted.Container = c.inner
+	encrypted.NoiseKey = c.encryptKeyPair(jid, "noise", device.NoiseKey)
+	encrypted.IdentityKey = c.encryptKeyPair(jid, "identity", device.IdentityKey)
+	encrypted.SignedPreKey = &keys.PreKey{
+		KeyPair:   *c.encryptKeyPair(jid, "signed_pre_key", &device.SignedPreKey.KeyPair),
+		KeyID:     device.SignedPreKey.KeyID,
+		Signature: device.SignedPreKey.Signature,
+	}
+	if len(device.AdvSecretKey) == 32 {
+		advKey := c.encryptFixed(fixedTweak(jid, "adv"), *(*[32]byte)(device.AdvSecretKey))
+		encrypted.AdvSecretKey = advKey[:]
+	}
+	_, alreadyWrapped := device.Sessions.(*sessionStore)
+	err := c.inner.PutDevice(ctx, &encrypted)
+	if !alreadyWrapped {
+		// The inner container may have initialized the stores in PutDevice, so copy them back and wrap them.
+		device.Identities = encrypted.Identities
+		device.Sessions = encrypted.Sessions
+		device.PreKeys = encrypted.PreKeys
+		device.SenderKeys = encrypted.SenderKeys
+		device.AppStateKeys = encrypted.AppStateKeys
+		device.AppState = encrypted.AppState
+		device.Contacts = encrypted.Contacts
+		device.ChatSettings = encrypted.ChatSettings
+		device.MsgSecrets = encrypted.MsgSecrets
+		device.Initialized = encrypted.Initialized
+		c.wrapStores(device)
+	}
+	return err
+}
+
+// PutLastSeen stores the last seen time of the given device in the underlying container.
+// The last seen time isn't encrypted, so the underlying container can update it directly if it supports that.
+func (c *Container) PutLastSeen(ctx context.Context, device *store.Device) error {
+	if updater, ok := c.inner.(store.LastSeenUpdater); ok {
+		return updater.PutLastSeen(ctx, device)
+	}
+	return c.PutDevice(ctx, device)
+}
+
+// DeleteDevice deletes the given device from the underlying container.
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	return c.inner.DeleteDevice(ctx, device)
+}
@@ -0,0 +1,140 @@
+package encstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func newTestContainer(t *testing.T, key byte) *Container {
+	t.Helper()
+	c, err := New(inmemstore.New(nil), bytes.Repeat([]byte{key}, 32))
+	if err != nil {
+		t.Fatalf("failed to create container: %v", err)
+	}
+	return c
+}
+
+func TestNew_InvalidKey(t *testing.T) {
+	if _, err := New(inmemstore.New(nil), make([]byte, 16)); !errors.Is(err, ErrInvalidKeyLength) {
+		t.Fatalf("expected ErrInvalidKeyLength, got %v", err)
+	}
+}
+
+func TestEncryptFixed(t *testing.T) {
+	c := newTestContainer(t, 1)
+	jid := types.NewADJID("1234567890", 0, 1)
+	var plaintext [32]byte
+	copy(plaintext[:], "0123456789abcdef0123456789abcdef")
+
+	tweak := fixedTweak(jid, "noise")
+	encrypted := c.encryptFixed(tweak, plaintext)
+	if encrypted == plaintext {
+		t.Fatal("ciphertext is equal to plaintext")
+	} else if c.encryptFixed(tweak, plaintext) != encrypted {
+		t.Fatal("encryption isn't deterministic")
+	} else if c.decryptFixed(tweak, encrypted) != plaintext {
+		t.Fatal("decrypted value doesn't match plaintext")
+	}
+	if c.encryptFixed(fixedTweak(jid, "identity"), plaintext) == encrypted {
+		t.Error("different fields produced the same ciphertext")
+	}
+	otherJID := types.NewADJID("1234567890", 0, 2)
+	if c.encryptFixed(fixedTweak(otherJID, "noise"), plaintext) == encrypted {
+		t.Error("different devices produced the same ciphertext")
+	}
+	if newTestContainer(t, 2).decryptFixed(tweak, encrypted) == plaintext {
+		t.Error("decrypting with the wrong key returned the plaintext")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	c := newTestContainer(t, 1)
+	plaintext := []byte("session data")
+	ad := sessionAD("1234567890.0:1@s.whatsapp.net", "111.0")
+
+	sealed, err := c.seal(ad, plaintext)
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	sealedAgain, _ := c.seal(ad, plaintext)
+	if bytes.Equal(sealed, sealedAgain) {
+		t.Error("sealing the same value twice produced the same ciphertext")
+	}
+	if opened, err := c.open(ad, sealed); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("expected %q, got %q (error: %v)", plaintext, opened, err)
+	}
+	if _, err = newTestContainer(t, 2).open(ad, sealed); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed with the wrong key, got %v", err)
+	}
+	if _, err = c.open(sessionAD("1234567890.0:1@s.whatsapp.net", "222.0"), sealed); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed with the wrong associated data, got %v", err)
+	}
+	for i := range sealed {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 1
+		if _, err = c.open(ad, tampered); !errors.Is(err, ErrDecryptionFailed) {
+			t.Fatalf("expected ErrDecryptionFailed after modifying byte %d, got %v", i, err)
+		}
+	}
+	if _, err = c.open(ad, sealed[:10]); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed for truncated data, got %v", err)
+	}
+}
+
+func TestDeviceRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	inner := inmemstore.New(nil)
+	key := bytes.Repeat([]byte{1}, 32)
+	c, _ := New(inner, key)
+
+	device := c.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	noisePriv := *device.NoiseKey.Priv
+	identityPriv := *device.IdentityKey.Priv
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+	if err := device.Sessions.PutSession(ctx, "111.0", []byte("session data")); err != nil {
+		t.Fatalf("failed to save session: %v", err)
+	}
+
+	stored, _ := inner.GetDevice(ctx, jid)
+	if *stored.NoiseKey.Priv == noisePriv || *stored.IdentityKey.Priv == identityPriv {
+		t.Fatal("private keys were stored unencrypted")
+	}
+	if raw, _ := stored.Sessions.GetSession(ctx, "111.0"); bytes.Contains(raw, []byte("session data")) {
+		t.Fatal("session was stored unencrypted")
+	}
+
+	// Loading twice makes sure the cached device in the inner container isn't decrypted in place
+	for i := 0; i < 2; i++ {
+		loaded, err := c.GetDevice(ctx, jid)
+		if err != nil {
+			t.Fatalf("failed to load device: %v", err)
+		} else if *loaded.NoiseKey.Priv != noisePriv || *loaded.IdentityKey.Priv != identityPriv {
+			t.Fatal("loaded private keys don't match")
+		} else if *loaded.NoiseKey.Pub != *device.NoiseKey.Pub {
+			t.Fatal("loaded public key doesn't match")
+		}
+		if session, err := loaded.Sessions.GetSession(ctx, "111.0"); err != nil || string(session) != "session data" {
+			t.Fatalf("expected session data, got %q (error: %v)", session, err)
+		}
+	}
+
+	wrongKey, _ := New(inner, bytes.Repeat([]byte{2}, 32))
+	loaded, err := wrongKey.GetDevice(ctx, jid)
+	if err != nil {
+		t.Fatalf("failed to load device: %v", err)
+	} else if *loaded.NoiseKey.Priv == noisePriv {
+		t.Error("wrong key decrypted the private key")
+	}
+	if _, err = loaded.Sessions.GetSession(ctx, "111.0"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed with the wrong key, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package encstore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func fixedTweak(jid types.JID, field string) uint64 {
+	// XTS only has a 64-bit tweak, so hash the field and owner down to one
+	hash := sha256.Sum256([]byte(field + "|" + jid.String()))
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// encryptFixed encrypts a 32-byte value with AES-XTS, so that the ciphertext has the same length as the plaintext.
+// The owner JID and field name are used as the tweak, so equal keys in different fields don't look the same.
+func (c *Container) encryptFixed(tweak uint64, data [32]byte) (out [32]byte) {
+	c.fixedCipher.Encrypt(out[:], data[:], tweak)
+	return
+}
+
+func (c *Container) decryptFixed(tweak uint64, data [32]byte) (out [32]byte) {
+	c.fixedCipher.Decrypt(out[:], data[:], tweak)
+	return
+}
+
+func (c *Container) seal(ad string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, []byte(ad)), nil
+}
+
+func (c *Container) open(ad string, ciphertext []byte) ([]byte, error) {
+	if ciphertext == nil {
+		return nil, nil
+	} else if len(ciphertext) < c.aead.NonceSize()+c.aead.Overhead() {
+		return nil, ErrDecryptionFailed
+	}
+	nonceSize := c.aead.NonceSize()
+	plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(ad))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+type sessionStore struct {
+	store.SessionStore
+	c   *Container
+	jid string
+}
+
+func sessionAD(jid, address string) string {
+	return "session|" + jid + "|" + address
+}
+
+func senderKeyAD(jid, group, user string) string {
+	return "sender_key|" + jid + "|" + group + "|" + user
+}
+
+func appStateSyncKeyAD(jid string, id []byte) string {
+	return fmt.Sprintf("app_state_sync_key|%s|%X", jid, id)
+}
+
+func msgSecretAD(jid string, chat, sender types.JID, id types.MessageID) string {
+	return "message_secret|" + jid + "|" + chat.ToNonAD().String() + "|" + sender.ToNonAD().String() + "|" + id
+}
+
+func (s *sessionStore) ad(address string) string {
+	return sessionAD(s.jid, address)
+}
+
+func (s *sessionStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	session, err := s.SessionStore.GetSession(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.open(s.ad(address), session)
+}
+
+func (s *sessionStore) PutSession(ctx context.Context, address string, session []byte) error {
+	encrypted, err := s.c.seal(s.ad(address), session)
+	if err != nil {
+		return err
+	}
+	return s.SessionStore.PutSession(ctx, address, encrypted)
+}
+
+// PruneSessions passes through to the underlying store, as pruning doesn't need the session contents.
+func (s *sessionStore) PruneSessions(ctx context.Context, before time.Time) (int, error) {
+	pruner, ok := s.SessionStore.(store.SessionPruner)
+	if !ok {
+		return 0, store.ErrPruneNotSupported
+	}
+	return pruner.PruneSessions(ctx, before)
+}
+
+// ExportData exports the data of the underlying store and decrypts it, so that store.Migrate
+// can be used to move devices out of an encrypted container.
+func (s *sessionStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	exporter, ok := s.SessionStore.(store.DataExporter)
+	if !ok {
+		return nil, store.ErrExportNotSupported
+	}
+	data, err := exporter.ExportData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for address, session := range data.Sessions {
+		data.Sessions[address], err = s.c.open(sessionAD(s.jid, address), session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt session with %s: %w", address, err)
+		}
+	}
+	for i, senderKey := range data.SenderKeys {
+		data.SenderKeys[i].Key, err = s.c.open(senderKeyAD(s.jid, senderKey.Group, senderKey.User), senderKey.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt sender key of %s in %s: %w", senderKey.User, senderKey.Group, err)
+		}
+	}
+	for i, syncKey := range data.AppStateSyncKeys {
+		data.AppStateSyncKeys[i].Key.Data, err = s.c.open(appStateSyncKeyAD(s.jid, syncKey.ID), syncKey.Key.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt app state sync key %X: %w", syncKey.ID, err)
+		}
+	}
+	for i, secret := range data.MessageSecrets {
+		data.MessageSecrets[i].Secret, err = s.c.open(msgSecretAD(s.jid, secret.Chat, secret.Sender, secret.ID), secret.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt message secret of %s: %w", secret.ID, err)
+		}
+	}
+	return data, nil
+}
+
+type senderKeyStore struct {
+	store.SenderKeyStore
+	c   *Container
+	jid string
+}
+
+func (s *senderKeyStore) ad(group, user string) string {
+	return senderKeyAD(s.jid, group, user)
+}
+
+func (s *senderKeyStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	key, err := s.SenderKeyStore.GetSenderKey(ctx, group, user)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.open(s.ad(group, user), key)
+}
+
+func (s *senderKeyStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	encrypted, err := s.c.seal(s.ad(group, user), session)
+	if err != nil {
+		return err
+	}
+	return s.SenderKeyStore.PutSenderKey(ctx, group, user, encrypted)
+}
+
+type appStateSyncKeyStore struct {
+	store.AppStateSyncKeyStore
+	c   *Container
+	jid string
+}
+
+func (s *appStateSyncKeyStore) ad(id []byte) string {
+	return appStateSyncKeyAD(s.jid, id)
+}
+
+func (s *appStateSyncKeyStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	key, err := s.AppStateSyncKeyStore.GetAppStateSyncKey(ctx, id)
+	if err != nil || key == nil {
+		return key, err
+	}
+	key.Data, err = s.c.open(s.ad(id), key.Data)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetLatestAppStateSyncKeyID passes through to the underlying store, as key IDs aren't encrypted.
+func (s *appStateSyncKeyStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	getter, ok := s.AppStateSyncKeyStore.(store.LatestAppStateSyncKeyGetter)
+	if !ok {
+		return nil, store.ErrLatestAppStateSyncKeyNotSupported
+	}
+	return getter.GetLatestAppStateSyncKeyID(ctx)
+}
+
+func (s *appStateSyncKeyStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) (err error) {
+	key.Data, err = s.c.seal(s.ad(id), key.Data)
+	if err != nil {
+		return err
+	}
+	return s.AppStateSyncKeyStore.PutAppStateSyncKey(ctx, id, key)
+}
+
+type msgSecretStore struct {
+	store.MsgSecretStore
+	c   *Container
+	jid string
+}
+
+func (s *msgSecretStore) ad(chat, sender types.JID, id types.MessageID) string {
+	return msgSecretAD(s.jid, chat, sender, id)
+}
+
+func (s *msgSecretStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	secret, err := s.MsgSecretStore.GetMessageSecret(ctx, chat, sender, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.open(s.ad(chat, sender, id), secret)
+}
+
+func (s *msgSecretStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	encrypted, err := s.c.seal(s.ad(chat, sender, id), secret)
+	if err != nil {
+		return err
+	}
+	return s.MsgSecretStore.PutMessageSecret(ctx, chat, sender, id, encrypted)
+}
+
+func (s *msgSecretStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	encrypted := make([]store.MessageSecretInsert, len(inserts))
+	for i, insert := range inserts {
+		secret, err := s.c.seal(s.ad(insert.Chat, insert.Sender, insert.ID), insert.Secret)
+		if err != nil {
+			return err
+		}
+		encrypted[i] = insert
+		encrypted[i].Secret = secret
+	}
+	return s.MsgSecretStore.PutMessageSecrets(ctx, encrypted)
+}
@@ -1,54 +1,92 @@
 package inmemstore
 
 import (
-	"crypto/rand"
+	"context"
 	"errors"
+	"os"
 	"sync"
-
-	mathRand "math/rand"
+	"sync/atomic"
+	"time"
 
 	"github.com/insomnius/whatsmeow/store"
 	"github.com/insomnius/whatsmeow/types"
-	"github.com/insomnius/whatsmeow/util/keys"
 	waLog "github.com/insomnius/whatsmeow/util/log"
 )
 
+// Container is an in-memory store container that can contain multiple whatsmeow sessions.
+//
+// The device list is copy-on-write: readers load the current list without locking, and writers
+// replace it with a modified copy. The data of each device is protected by its own MemoryStore lock,
+// so concurrent use of different devices never contends on a shared mutex.
 type Container struct {
-	devices []*store.Device
-	log     waLog.Logger
-	locker  *sync.RWMutex
+	devices   atomic.Value // *deviceList
+	writeLock sync.Mutex
+	log       waLog.Logger
+
+	maxDevices int
+	idleTTL    time.Duration
+	onEvict    func(device *store.Device)
+	onPut      func(device *store.Device)
+	now        func() time.Time
+
+	metricsHook store.MetricsHook
+	readOnly    bool
+
+	wal     *walWriter
+	walFile *os.File
 }
 
+var _ store.Container = (*Container)(nil)
+
 // New creates a new in-memory store container.
 //
-// The logger can be nil and will default to a no-op logger.
+// The logger can be nil and will default to a no-op logger. Options can be used to limit how many
+// devices are kept in memory, see WithMaxDevices and WithIdleTTL.
 //
-// container := inmemstore.New(nil)
-func New(log waLog.Logger) *Container {
+//	container := inmemstore.New(nil, inmemstore.WithMaxDevices(100), inmemstore.WithIdleTTL(time.Hour))
+func New(log waLog.Logger, opts ...Option) *Container {
 	if log == nil {
 		log = waLog.Noop
 	}
 
-	return &Container{
-		devices: []*store.Device{},
-		log:     log,
-		locker:  &sync.RWMutex{},
+	c := &Container{
+		log: log,
+		now: time.Now,
 	}
+	c.devices.Store(&deviceList{byJID: make(map[types.JID]*deviceEntry)})
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// GetAllDevices return all devices from devices array.
-func (c *Container) GetAllDevices() []*store.Device {
-	return c.devices
+// GetAllDevices returns all devices in the container. The returned slice is a copy and can be modified freely.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	evicted := c.evictExpired()
+	entries := c.list().entries
+	devices := make([]*store.Device, len(entries))
+	for i, entry := range entries {
+		devices[i] = entry.device
+	}
+	c.fireEvicted(evicted)
+	return devices, nil
 }
 
 // GetFirstDevice is a convenience method for getting the first device in device array. If there are
 // no devices, then a new device will be created. You should only use this if you don't want to
 // have multiple sessions simultaneously.
-func (c *Container) GetFirstDevice() (*store.Device, error) {
-	if len(c.devices) == 0 {
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	evicted := c.evictExpired()
+	var device *store.Device
+	if entries := c.list().entries; len(entries) > 0 {
+		c.touch(entries[0])
+		device = entries[0].device
+	}
+	c.fireEvicted(evicted)
+	if device == nil {
 		return c.NewDevice(), nil
 	} else {
-		return c.devices[0], nil
+		return device, nil
 	}
 }
 
@@ -57,66 +95,111 @@ func (c *Container) GetFirstDevice() (*store.Device, error) {
 // No data is actually stored before Save is called. However, the pairing process will automatically
 // call Save after a successful pairing, so you most likely don't need to call it yourself.
 func (c *Container) NewDevice() *store.Device {
-	device := &store.Device{
-		Log:       c.log,
-		Container: c,
-
-		NoiseKey:       keys.NewKeyPair(),
-		IdentityKey:    keys.NewKeyPair(),
-		RegistrationID: mathRand.Uint32(),
-		AdvSecretKey:   make([]byte, 32),
-	}
-	_, err := rand.Read(device.AdvSecretKey)
-	if err != nil {
-		panic(err)
-	}
-	device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(1)
+	device := store.NewBlankDevice(c, c.log)
+	c.setStores(device, NewMemoryStore())
 
 	return device
 }
 
-// GetDevice finds the device with the specified JID in the device array.
+func (c *Container) setStores(device *store.Device, memStore *MemoryStore) {
+	memStore.lock.now = c.now
+	device.Identities = memStore
+	device.Sessions = memStore
+	device.PreKeys = memStore
+	device.SenderKeys = memStore
+	device.AppStateKeys = memStore
+	device.AppState = memStore
+	device.Contacts = memStore
+	device.ChatSettings = memStore
+	device.MsgSecrets = memStore
+	if c.readOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "inmemstore", c.metricsHook)
+}
+
+// GetDevice finds the device with the specified JID in the container.
 //
 // If the device is not found, nil is returned instead.
 //
 // Note that the parameter usually must be an AD-JID.
-func (c *Container) GetDevice(jid types.JID) (*store.Device, error) {
-	c.locker.RLock()
-	defer c.locker.RUnlock()
-
-	for _, device := range c.devices {
-		if device.ID != nil && *device.ID == jid {
-			return device, nil
-		}
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	evicted := c.evictExpired()
+	var found *store.Device
+	if entry, ok := c.list().byJID[jid]; ok {
+		c.touch(entry)
+		found = entry.device
 	}
-
-	return nil, nil
+	c.fireEvicted(evicted)
+	return found, nil
 }
 
 // ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
 var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
 
-// PutDevice stores the given device in this database. This should be called through Device.Save()
+// PutDevice stores the given device in this container. This should be called through Device.Save()
 // (which usually doesn't need to be called manually, as the library does that automatically when relevant).
-// in this package this would be ignored, instead we let the package users save it in their own way.
-func (c *Container) PutDevice(device *store.Device) error {
+//
+// If the container already has a different device object with the same JID, it's replaced with the given one.
+// The hook set with OnPut is called after the device has been stored.
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.readOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	c.writeLock.Lock()
+	existing, ok := c.list().byJID[*device.ID]
+	if ok && existing.device != device {
+		// Record the removal of the old device before the new one is added to the log
+		c.detachWAL(c.removeEntries(map[*deviceEntry]struct{}{existing: {}}))
+		ok = false
+	}
+	if err := c.attachWAL(device); err != nil {
+		c.writeLock.Unlock()
+		return err
+	}
+	var evicted []*store.Device
+	if ok {
+		c.touch(existing)
+	} else {
+		evicted = c.addDevice(device)
+	}
+	device.Initialized = true
+	onPut := c.onPut
+	c.writeLock.Unlock()
+
+	c.fireEvicted(evicted)
+	if onPut != nil {
+		onPut(device)
+	}
 	return nil
 }
 
+// OnPut sets a function that is called every time a device is saved with PutDevice,
+// which can be used to mirror devices to persistent storage.
+//
+// The function is called synchronously after the device has been stored in the container.
+func (c *Container) OnPut(fn func(device *store.Device)) {
+	c.writeLock.Lock()
+	c.onPut = fn
+	c.writeLock.Unlock()
+}
+
 // DeleteDevice deletes the given device from this database. This should be called through Device.Delete()
-func (c *Container) DeleteDevice(store *store.Device) error {
-	if store.ID == nil {
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.readOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
 		return ErrDeviceIDMustBeSet
 	}
-	c.locker.Lock()
-	defer c.locker.Unlock()
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
 
-	for key, device := range c.devices {
-		if device.ID != nil && *device.ID == *store.ID {
-			c.devices = append(c.devices[:key], c.devices[key+1:]...)
-			return nil
-		}
+	if entry, ok := c.list().byJID[*device.ID]; ok {
+		c.detachWAL(c.removeEntries(map[*deviceEntry]struct{}{entry: {}}))
 	}
-
 	return nil
 }
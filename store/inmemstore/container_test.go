@@ -0,0 +1,42 @@
+package inmemstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestPutDevice(t *testing.T) {
+	ctx := context.Background()
+	container := New(nil)
+	var saved []*store.Device
+	container.OnPut(func(device *store.Device) {
+		saved = append(saved, device)
+	})
+
+	device := container.NewDevice()
+	if err := device.Save(ctx); err != ErrDeviceIDMustBeSet {
+		t.Fatalf("expected ErrDeviceIDMustBeSet, got %v", err)
+	}
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+	if found, _ := container.GetDevice(ctx, jid); found != device {
+		t.Fatal("saved device not found in container")
+	}
+
+	replacement := container.NewDevice()
+	replacement.ID = &jid
+	_ = replacement.Save(ctx)
+	_ = replacement.Save(ctx)
+	if all, _ := container.GetAllDevices(ctx); len(all) != 1 || all[0] != replacement {
+		t.Fatalf("expected device to be replaced, got %v", all)
+	}
+	if len(saved) != 3 {
+		t.Fatalf("expected OnPut to be called 3 times, got %d", len(saved))
+	}
+}
@@ -0,0 +1,226 @@
+package inmemstore
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// Option is a function that configures a Container, passed to New or Restore.
+type Option func(c *Container)
+
+// WithMaxDevices limits the number of devices kept in the container. When a new device is added
+// to a full container, the least recently used device is evicted.
+//
+// Both getting a device from the container and using its stores count as using the device.
+// Evicted devices keep working, but they're no longer returned by the container. If the container
+// has a write-ahead log, changes to evicted devices are still recorded in it until it's compacted.
+func WithMaxDevices(n int) Option {
+	return func(c *Container) {
+		c.maxDevices = n
+	}
+}
+
+// WithIdleTTL makes the container evict devices that haven't been used for the given duration.
+// Getting the device from the container and using any of its stores both count as using it.
+//
+// Expired devices are removed lazily when the container is accessed, or when EvictExpired is called.
+func WithIdleTTL(ttl time.Duration) Option {
+	return func(c *Container) {
+		c.idleTTL = ttl
+	}
+}
+
+// WithEvictionCallback sets a function that is called with every device evicted because of
+// WithMaxDevices or WithIdleTTL, which can be used to persist the device elsewhere before it's gone.
+//
+// The callback is called synchronously after the device has been removed from the container,
+// but it's not called for devices removed with DeleteDevice.
+func WithEvictionCallback(fn func(device *store.Device)) Option {
+	return func(c *Container) {
+		c.onEvict = fn
+	}
+}
+
+// WithMetricsHook sets a function that is called after every operation on the stores of the devices in the container.
+func WithMetricsHook(hook store.MetricsHook) Option {
+	return func(c *Container) {
+		c.metricsHook = hook
+	}
+}
+
+// WithReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+// with a store.ReadOnlyError, which is useful for inspecting a snapshot loaded with Restore without modifying it.
+func WithReadOnly() Option {
+	return func(c *Container) {
+		c.readOnly = true
+	}
+}
+
+// EvictExpired removes all devices that have been idle for longer than the TTL set with WithIdleTTL
+// and returns the number of devices that were evicted.
+//
+// Expired devices are also evicted automatically whenever the container is accessed, so this only
+// needs to be called periodically if memory should be freed even when the container isn't used.
+func (c *Container) EvictExpired() int {
+	c.writeLock.Lock()
+	evicted := c.removeExpired()
+	c.writeLock.Unlock()
+	c.fireEvicted(evicted)
+	return len(evicted)
+}
+
+// deviceEntry is a single device in the container along with the time it was last used.
+type deviceEntry struct {
+	device *store.Device
+	// memStore is the store of the device, which tracks when the stores were last used. It's nil if the
+	// stores of the device were replaced with something other than a MemoryStore.
+	memStore *MemoryStore
+	// lastUsed is a unix timestamp in nanoseconds of when the device was last fetched from the container.
+	// It's only accessed atomically, so reading devices doesn't require taking the container write lock.
+	lastUsed int64
+}
+
+// lastUsedAt returns when the device or its stores were last used, as a unix timestamp in nanoseconds.
+func (entry *deviceEntry) lastUsedAt() int64 {
+	lastUsed := atomic.LoadInt64(&entry.lastUsed)
+	if entry.memStore != nil {
+		if storeUsed := atomic.LoadInt64(&entry.memStore.lock.lastUsed); storeUsed > lastUsed {
+			return storeUsed
+		}
+	}
+	return lastUsed
+}
+
+// deviceList is a snapshot of the devices in the container. It's never modified after being stored
+// in the container, writers always create a new list instead.
+type deviceList struct {
+	entries []*deviceEntry
+	byJID   map[types.JID]*deviceEntry
+}
+
+func (c *Container) list() *deviceList {
+	return c.devices.Load().(*deviceList)
+}
+
+// setEntries replaces the device list. The write lock must be held when calling this.
+func (c *Container) setEntries(entries []*deviceEntry) {
+	byJID := make(map[types.JID]*deviceEntry, len(entries))
+	for _, entry := range entries {
+		if entry.device.ID != nil {
+			byJID[*entry.device.ID] = entry
+		}
+	}
+	c.devices.Store(&deviceList{entries: entries, byJID: byJID})
+}
+
+// touch marks the given device as recently used.
+func (c *Container) touch(entry *deviceEntry) {
+	atomic.StoreInt64(&entry.lastUsed, c.now().UnixNano())
+}
+
+// removeEntries removes the given entries from the device list and returns their devices.
+// The write-ahead log of the devices is not detached, see detachWAL.
+// The write lock must be held when calling this.
+func (c *Container) removeEntries(remove map[*deviceEntry]struct{}) []*store.Device {
+	if len(remove) == 0 {
+		return nil
+	}
+	oldEntries := c.list().entries
+	entries := make([]*deviceEntry, 0, len(oldEntries))
+	removed := make([]*store.Device, 0, len(remove))
+	for _, entry := range oldEntries {
+		if _, ok := remove[entry]; ok {
+			removed = append(removed, entry.device)
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	c.setEntries(entries)
+	return removed
+}
+
+// addDevice adds the given device to the container and returns the devices that had to be evicted
+// to make room for it. The write lock must be held when calling this.
+func (c *Container) addDevice(device *store.Device) []*store.Device {
+	c.appendDevice(device)
+	return c.enforceLimits()
+}
+
+// appendDevice adds the given device to the container without evicting other devices.
+// The write lock must be held when calling this.
+func (c *Container) appendDevice(device *store.Device) {
+	oldEntries := c.list().entries
+	entries := make([]*deviceEntry, len(oldEntries), len(oldEntries)+1)
+	copy(entries, oldEntries)
+	entry := &deviceEntry{device: device}
+	entry.memStore, _ = memoryStoreOf(device)
+	c.touch(entry)
+	c.setEntries(append(entries, entry))
+}
+
+// enforceLimits evicts expired devices and the least recently used devices over the limit, and returns them.
+// The write lock must be held when calling this.
+func (c *Container) enforceLimits() []*store.Device {
+	evicted := c.removeExpired()
+	if entries := c.list().entries; c.maxDevices > 0 && len(entries) > c.maxDevices {
+		sorted := make([]*deviceEntry, len(entries))
+		copy(sorted, entries)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].lastUsedAt() < sorted[j].lastUsedAt()
+		})
+		remove := make(map[*deviceEntry]struct{}, len(entries)-c.maxDevices)
+		for _, oldest := range sorted[:len(entries)-c.maxDevices] {
+			remove[oldest] = struct{}{}
+		}
+		evicted = append(evicted, c.removeEntries(remove)...)
+	}
+	return evicted
+}
+
+// findExpired returns the entries that have been idle for longer than the TTL.
+func (c *Container) findExpired() map[*deviceEntry]struct{} {
+	if c.idleTTL <= 0 {
+		return nil
+	}
+	deadline := c.now().Add(-c.idleTTL).UnixNano()
+	var expired map[*deviceEntry]struct{}
+	for _, entry := range c.list().entries {
+		if entry.lastUsedAt() < deadline {
+			if expired == nil {
+				expired = make(map[*deviceEntry]struct{})
+			}
+			expired[entry] = struct{}{}
+		}
+	}
+	return expired
+}
+
+// removeExpired removes and returns devices that have been idle for longer than the TTL.
+// The write lock must be held when calling this.
+func (c *Container) removeExpired() []*store.Device {
+	return c.removeEntries(c.findExpired())
+}
+
+// evictExpired is like removeExpired, but it only takes the write lock if there are expired devices.
+func (c *Container) evictExpired() []*store.Device {
+	if len(c.findExpired()) == 0 {
+		return nil
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.removeExpired()
+}
+
+// fireEvicted calls the eviction callback for the given devices. The write lock must not be held when calling this.
+func (c *Container) fireEvicted(devices []*store.Device) {
+	if c.onEvict == nil {
+		return
+	}
+	for _, device := range devices {
+		c.onEvict(device)
+	}
+}
@@ -0,0 +1,120 @@
+package inmemstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	var evicted []*store.Device
+	container := New(nil, WithMaxDevices(2), WithIdleTTL(time.Hour), WithEvictionCallback(func(device *store.Device) {
+		evicted = append(evicted, device)
+	}))
+	now := time.Now()
+	container.now = func() time.Time { return now }
+
+	devices := make([]*store.Device, 3)
+	for i := range devices {
+		devices[i] = container.NewDevice()
+		jid := types.NewADJID("1234567890", 0, uint8(i+1))
+		devices[i].ID = &jid
+	}
+	container.writeLock.Lock()
+	container.addDevice(devices[0])
+	now = now.Add(time.Minute)
+	container.addDevice(devices[1])
+	container.writeLock.Unlock()
+
+	now = now.Add(time.Minute)
+	_, _ = container.GetDevice(ctx, *devices[0].ID)
+	container.writeLock.Lock()
+	container.fireEvicted(container.addDevice(devices[2]))
+	container.writeLock.Unlock()
+	if len(evicted) != 1 || evicted[0] != devices[1] {
+		t.Fatalf("expected least recently used device to be evicted, got %v", evicted)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if count := container.EvictExpired(); count != 2 {
+		t.Fatalf("expected 2 expired devices, got %d", count)
+	}
+	if all, _ := container.GetAllDevices(ctx); len(all) != 0 {
+		t.Fatalf("expected container to be empty, got %d devices", len(all))
+	}
+}
+
+func TestIdleTTLStoreAccess(t *testing.T) {
+	ctx := context.Background()
+	container := New(nil, WithIdleTTL(time.Hour))
+	now := time.Now()
+	container.now = func() time.Time { return now }
+
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	_ = device.Save(ctx)
+
+	now = now.Add(50 * time.Minute)
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	now = now.Add(50 * time.Minute)
+	if count := container.EvictExpired(); count != 0 {
+		t.Fatalf("expected device used through its store not to expire, but %d devices were evicted", count)
+	}
+	now = now.Add(50 * time.Minute)
+	if count := container.EvictExpired(); count != 1 {
+		t.Fatalf("expected idle device to expire, got %d evicted devices", count)
+	}
+}
+
+func TestEvictionKeepsWAL(t *testing.T) {
+	ctx := context.Background()
+	var wal bytes.Buffer
+	container := New(nil, WithMaxDevices(1), WithWAL(&wal))
+	now := time.Now()
+	container.now = func() time.Time { return now }
+
+	devices := make([]*store.Device, 2)
+	for i := range devices {
+		devices[i] = container.NewDevice()
+		jid := types.NewADJID("1234567890", 0, uint8(i+1))
+		devices[i].ID = &jid
+		_ = devices[i].Save(ctx)
+		now = now.Add(time.Minute)
+	}
+	if found, _ := container.GetDevice(ctx, *devices[0].ID); found != nil {
+		t.Fatal("expected first device to be evicted")
+	}
+	// The evicted device may still be used by a client, so its changes must still be logged
+	now = now.Add(time.Minute)
+	_ = devices[0].Sessions.PutSession(ctx, "111:1", []byte("after eviction"))
+
+	var evicted []*store.Device
+	// Every store operation while replaying advances the clock, so the usage order matches the record order
+	tickingClock := func(c *Container) {
+		c.now = func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}
+	}
+	restored, err := Replay(&wal, nil, WithMaxDevices(1), tickingClock, WithEvictionCallback(func(device *store.Device) {
+		evicted = append(evicted, device)
+	}))
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if len(evicted) != 1 || *evicted[0].ID != *devices[1].ID {
+		t.Fatalf("expected the least recently used device to be evicted after replay, got %v", evicted)
+	}
+	restoredDevice, _ := restored.GetDevice(ctx, *devices[0].ID)
+	if restoredDevice == nil {
+		t.Fatal("recently used device wasn't restored")
+	} else if session, _ := restoredDevice.Sessions.GetSession(ctx, "111:1"); string(session) != "after eviction" {
+		t.Fatalf("change made after eviction wasn't restored, got %q", session)
+	}
+}
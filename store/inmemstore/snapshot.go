@@ -0,0 +1,166 @@
+package inmemstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// SnapshotVersion is the current version of the snapshot format written by Container.Snapshot.
+const SnapshotVersion = 2
+
+// ErrUnsupportedSnapshotVersion is returned by Restore if the snapshot was written by a different version of the library.
+// Version 1 snapshots used a separate format, so they have to be restored with the version that wrote them and
+// exported with Device.ExportJSON instead.
+var ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+
+// snapshot is the format written by Container.Snapshot. Each device is in the format of store.MarshalDeviceJSON,
+// which is the same format used by Device.ExportJSON.
+type snapshot struct {
+	Version int               `json:"version"`
+	Devices []json.RawMessage `json:"devices"`
+}
+
+func restoreMemoryStore(data *store.ExportedData) *MemoryStore {
+	s := NewMemoryStore()
+	s.lastPreKeyID = data.LastPreKeyID
+	for address, key := range data.Identities {
+		s.identities[address] = key
+	}
+	now := time.Now()
+	for address, session := range data.Sessions {
+		s.sessions[address] = session
+		// Sessions without a stored time count as freshly updated
+		s.sessionUpdated[address] = now
+		if updatedAt, ok := data.SessionTimes[address]; ok {
+			s.sessionUpdated[address] = updatedAt
+		}
+	}
+	for _, preKey := range data.PreKeys {
+		key := preKey.PreKey
+		s.preKeys[key.KeyID] = &memPreKey{key: &key, uploaded: preKey.Uploaded}
+		if key.KeyID > s.lastPreKeyID {
+			s.lastPreKeyID = key.KeyID
+		}
+	}
+	for _, key := range data.SenderKeys {
+		s.senderKeys[senderKeyID{key.Group, key.User}] = key.Key
+	}
+	for _, key := range data.AppStateSyncKeys {
+		s.appStateSyncKeys[string(key.ID)] = key.Key
+	}
+	for _, state := range data.AppStates {
+		s.appStateVersions[state.Name] = appStateVersion{version: state.Version, hash: state.Hash}
+		if len(state.MutationMACs) > 0 {
+			macs := make(map[string]mutationMAC, len(state.MutationMACs))
+			for _, mac := range state.MutationMACs {
+				macs[string(mac.IndexMAC)] = mutationMAC{version: mac.Version, valueMAC: mac.ValueMAC}
+			}
+			s.mutationMACs[state.Name] = macs
+		}
+	}
+	for jid, contact := range data.Contacts {
+		s.contacts[jid] = contact
+	}
+	for jid, settings := range data.ChatSettings {
+		s.chatSettings[jid] = settings
+	}
+	for _, secret := range data.MessageSecrets {
+		s.msgSecrets[msgSecretID{secret.Chat, secret.Sender, secret.ID}] = secret.Secret
+	}
+	return s
+}
+
+// memoryStoreOf returns the MemoryStore of the given device. The prekey store is checked first,
+// as wrappers like store.WatchedContainer only replace some of the stores.
+func memoryStoreOf(device *store.Device) (*MemoryStore, bool) {
+	for _, deviceStore := range []interface{}{device.PreKeys, device.Identities, device.Sessions} {
+		if memStore, ok := store.UnwrapStore(deviceStore).(*MemoryStore); ok {
+			return memStore, true
+		}
+	}
+	return nil, false
+}
+
+// restoreDevice sets up a device decoded with store.UnmarshalDeviceJSON to use this container and the given store.
+func (c *Container) restoreDevice(device *store.Device, memStore *MemoryStore) {
+	device.Log = c.log
+	device.Container = c
+	device.Initialized = true
+	c.setStores(device, memStore)
+}
+
+// Snapshot serializes all devices in the container, including their Signal sessions, prekeys,
+// app state and contacts, and writes them to the given writer.
+//
+// The output can be loaded back with Restore. Note that the snapshot contains private keys,
+// so it should be stored as securely as the session itself.
+//
+// Store data is only included for devices using the in-memory stores created by this package.
+func (c *Container) Snapshot(w io.Writer) error {
+	devices, _ := c.GetAllDevices(context.Background())
+
+	snap := snapshot{
+		Version: SnapshotVersion,
+		Devices: make([]json.RawMessage, len(devices)),
+	}
+	for i, device := range devices {
+		var data *store.ExportedData
+		if memStore, ok := memoryStoreOf(device); ok {
+			// Taking a snapshot isn't a use of the device, so lock without updating the last use time
+			memStore.lock.RWMutex.RLock()
+			data = memStore.exportDataLocked()
+			memStore.lock.RWMutex.RUnlock()
+		}
+		var err error
+		snap.Devices[i], err = store.MarshalDeviceJSON(device, data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", device.ID, err)
+		}
+	}
+	err := json.NewEncoder(w).Encode(&snap)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore creates a new in-memory store container from a snapshot previously written by Container.Snapshot.
+//
+// The logger can be nil and will default to a no-op logger. The options are the same as for New.
+//
+//	file, err := os.Open("whatsmeow-snapshot.json")
+//	if err != nil {
+//	    panic(err)
+//	}
+//	container, err := inmemstore.Restore(file, nil)
+func Restore(r io.Reader, log waLog.Logger, opts ...Option) (*Container, error) {
+	var snap snapshot
+	err := json.NewDecoder(r).Decode(&snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	} else if snap.Version != SnapshotVersion {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedSnapshotVersion, snap.Version)
+	}
+	c := New(log, opts...)
+	c.writeLock.Lock()
+	var evicted []*store.Device
+	for i, raw := range snap.Devices {
+		device, data, err := store.UnmarshalDeviceJSON(raw)
+		if err != nil {
+			c.writeLock.Unlock()
+			return nil, fmt.Errorf("failed to restore device #%d: %w", i+1, err)
+		}
+		c.restoreDevice(device, restoreMemoryStore(data))
+		evicted = append(evicted, c.addDevice(device)...)
+	}
+	c.writeLock.Unlock()
+	c.fireEvicted(evicted)
+	return c, nil
+}
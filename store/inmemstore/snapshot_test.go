@@ -0,0 +1,60 @@
+package inmemstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	container := New(nil)
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 5)
+	device.ID = &jid
+	device.Account = &waProto.ADVSignedDeviceIdentity{Details: []byte("details")}
+	device.PushName = "Test"
+	container.writeLock.Lock()
+	container.addDevice(device)
+	container.writeLock.Unlock()
+
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	_ = device.Identities.PutIdentity(ctx, "111:1", [32]byte{1, 2, 3})
+	preKeys, _ := device.PreKeys.GetOrGenPreKeys(ctx, 3)
+	_ = device.PreKeys.MarkPreKeysAsUploaded(ctx, preKeys[1].KeyID)
+	_, _, _ = device.Contacts.PutPushName(ctx, types.NewJID("111", types.DefaultUserServer), "Friend")
+
+	var buf bytes.Buffer
+	if err := container.Snapshot(&buf); err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+	restored, err := Restore(&buf, nil)
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	restoredDevice, _ := restored.GetDevice(ctx, jid)
+	if restoredDevice == nil {
+		t.Fatal("restored container is missing device")
+	}
+	if *restoredDevice.IdentityKey.Pub != *device.IdentityKey.Pub || restoredDevice.PushName != "Test" {
+		t.Error("restored device doesn't match original")
+	}
+	if string(restoredDevice.Account.GetDetails()) != "details" {
+		t.Error("restored account doesn't match original")
+	}
+	if sess, _ := restoredDevice.Sessions.GetSession(ctx, "111:1"); string(sess) != "session" {
+		t.Error("restored session doesn't match original")
+	}
+	if trusted, _ := restoredDevice.Identities.IsTrustedIdentity(ctx, "111:1", [32]byte{1, 2, 3}); !trusted {
+		t.Error("restored identity doesn't match original")
+	}
+	if count, _ := restoredDevice.PreKeys.UploadedPreKeyCount(ctx); count != 2 {
+		t.Errorf("expected 2 uploaded prekeys, got %d", count)
+	}
+	if contact, _ := restoredDevice.Contacts.GetContact(ctx, types.NewJID("111", types.DefaultUserServer)); contact.PushName != "Friend" {
+		t.Error("restored contact doesn't match original")
+	}
+}
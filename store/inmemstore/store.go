@@ -0,0 +1,734 @@
+package inmemstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+type memPreKey struct {
+	key      *keys.PreKey
+	uploaded bool
+}
+
+type senderKeyID struct {
+	group string
+	user  string
+}
+
+type appStateVersion struct {
+	version uint64
+	hash    [128]byte
+}
+
+type mutationMAC struct {
+	version  uint64
+	valueMAC []byte
+}
+
+type msgSecretID struct {
+	chat   types.JID
+	sender types.JID
+	id     types.MessageID
+}
+
+// MemoryStore is an in-memory implementation of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice instead of creating these manually.
+type MemoryStore struct {
+	lock usageLock
+
+	identities       map[string][32]byte
+	sessions         map[string][]byte
+	sessionUpdated   map[string]time.Time
+	preKeys          map[uint32]*memPreKey
+	lastPreKeyID     uint32
+	senderKeys       map[senderKeyID][]byte
+	appStateSyncKeys map[string]store.AppStateSyncKey
+	appStateVersions map[string]appStateVersion
+	mutationMACs     map[string]map[string]mutationMAC
+	contacts         map[types.JID]types.ContactInfo
+	chatSettings     map[types.JID]types.LocalChatSettings
+	msgSecrets       map[msgSecretID][]byte
+
+	// wal is the write-ahead log that mutations are recorded in, or nil if the container doesn't have one.
+	wal    *walWriter
+	walJID types.JID
+}
+
+// usageLock is a RWMutex that records when it was last locked, so that the container can evict
+// devices based on when their stores were last used, not only when they were fetched from the container.
+//
+// Internal operations that shouldn't count as using the store lock the embedded RWMutex directly.
+type usageLock struct {
+	sync.RWMutex
+	now func() time.Time
+	// lastUsed is a unix timestamp in nanoseconds. It's only accessed atomically.
+	lastUsed int64
+}
+
+func (l *usageLock) Lock() {
+	l.RWMutex.Lock()
+	l.markUsed()
+}
+
+func (l *usageLock) RLock() {
+	l.RWMutex.RLock()
+	l.markUsed()
+}
+
+func (l *usageLock) markUsed() {
+	if l.now != nil {
+		atomic.StoreInt64(&l.lastUsed, l.now().UnixNano())
+	}
+}
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		identities:       make(map[string][32]byte),
+		sessions:         make(map[string][]byte),
+		sessionUpdated:   make(map[string]time.Time),
+		preKeys:          make(map[uint32]*memPreKey),
+		senderKeys:       make(map[senderKeyID][]byte),
+		appStateSyncKeys: make(map[string]store.AppStateSyncKey),
+		appStateVersions: make(map[string]appStateVersion),
+		mutationMACs:     make(map[string]map[string]mutationMAC),
+		contacts:         make(map[types.JID]types.ContactInfo),
+		chatSettings:     make(map[types.JID]types.LocalChatSettings),
+		msgSecrets:       make(map[msgSecretID][]byte),
+	}
+}
+
+var _ store.IdentityStore = (*MemoryStore)(nil)
+var _ store.SessionStore = (*MemoryStore)(nil)
+var _ store.SessionPruner = (*MemoryStore)(nil)
+var _ store.PreKeyStore = (*MemoryStore)(nil)
+var _ store.SenderKeyStore = (*MemoryStore)(nil)
+var _ store.AppStateSyncKeyStore = (*MemoryStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*MemoryStore)(nil)
+var _ store.AppStateStore = (*MemoryStore)(nil)
+var _ store.ContactStore = (*MemoryStore)(nil)
+var _ store.ChatSettingsStore = (*MemoryStore)(nil)
+var _ store.MsgSecretStore = (*MemoryStore)(nil)
+var _ store.DataExporter = (*MemoryStore)(nil)
+var _ store.PreKeyImporter = (*MemoryStore)(nil)
+
+// record appends the given mutation to the write-ahead log, if there is one. The write lock must be held when calling this.
+func (s *MemoryStore) record(rec walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+	rec.Device = s.walJID
+	return s.wal.write(&rec)
+}
+
+func (s *MemoryStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walPutIdentity, Address: address, Data: key[:]}); err != nil {
+		return err
+	}
+	s.identities[address] = key
+	return nil
+}
+
+func (s *MemoryStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walDeleteAllIdentities, Address: phone}); err != nil {
+		return err
+	}
+	for address := range s.identities {
+		if strings.HasPrefix(address, phone+":") {
+			delete(s.identities, address)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdentity(ctx context.Context, address string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walDeleteIdentity, Address: address}); err != nil {
+		return err
+	}
+	delete(s.identities, address)
+	return nil
+}
+
+func (s *MemoryStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	s.lock.RLock()
+	existingIdentity, ok := s.identities[address]
+	s.lock.RUnlock()
+	if !ok {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	}
+	return existingIdentity == key, nil
+}
+
+func (s *MemoryStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.sessions[address], nil
+}
+
+func (s *MemoryStore) HasSession(ctx context.Context, address string) (bool, error) {
+	s.lock.RLock()
+	_, ok := s.sessions[address]
+	s.lock.RUnlock()
+	return ok, nil
+}
+
+func (s *MemoryStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.putSession(address, session, time.Now())
+}
+
+func (s *MemoryStore) putSession(address string, session []byte, updatedAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walPutSession, Address: address, Data: session, Timestamp: updatedAt.Unix()}); err != nil {
+		return err
+	}
+	s.sessions[address] = session
+	s.sessionUpdated[address] = updatedAt
+	return nil
+}
+
+func (s *MemoryStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walDeleteAllSessions, Address: phone}); err != nil {
+		return err
+	}
+	for address := range s.sessions {
+		if strings.HasPrefix(address, phone+":") {
+			delete(s.sessions, address)
+			delete(s.sessionUpdated, address)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteSession(ctx context.Context, address string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walDeleteSession, Address: address}); err != nil {
+		return err
+	}
+	delete(s.sessions, address)
+	delete(s.sessionUpdated, address)
+	return nil
+}
+
+func (s *MemoryStore) PruneSessions(ctx context.Context, before time.Time) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := 0
+	for address, updatedAt := range s.sessionUpdated {
+		if !updatedAt.Before(before) {
+			continue
+		}
+		if err := s.record(walRecord{Op: walDeleteSession, Address: address}); err != nil {
+			return count, err
+		}
+		delete(s.sessions, address)
+		delete(s.sessionUpdated, address)
+		count++
+	}
+	return count, nil
+}
+
+// putPreKeys records the given prekeys in the write-ahead log and stores them. The write lock must be held when calling this.
+func (s *MemoryStore) putPreKeys(preKeys []*memPreKey) error {
+	if len(preKeys) == 0 {
+		return nil
+	} else if s.wal != nil {
+		entries := make([]store.PreKeyEntry, len(preKeys))
+		for i, preKey := range preKeys {
+			entries[i] = store.PreKeyEntry{PreKey: *preKey.key, Uploaded: preKey.uploaded}
+		}
+		if err := s.record(walRecord{Op: walPutPreKeys, BulkData: &store.ExportedData{PreKeys: entries}}); err != nil {
+			return err
+		}
+	}
+	for _, preKey := range preKeys {
+		s.preKeys[preKey.key.KeyID] = preKey
+		if preKey.key.KeyID > s.lastPreKeyID {
+			s.lastPreKeyID = preKey.key.KeyID
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := keys.NewPreKey(s.lastPreKeyID + 1)
+	if err := s.putPreKeys([]*memPreKey{{key: key, uploaded: true}}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *MemoryStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	existing := make([]*keys.PreKey, 0, count)
+	for _, preKey := range s.preKeys {
+		if !preKey.uploaded {
+			existing = append(existing, preKey.key)
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool {
+		return existing[i].KeyID < existing[j].KeyID
+	})
+	if uint32(len(existing)) > count {
+		existing = existing[:count]
+	}
+	newKeys := make([]*keys.PreKey, count)
+	copy(newKeys, existing)
+	generated := make([]*memPreKey, 0, count-uint32(len(existing)))
+	for i := uint32(len(existing)); i < count; i++ {
+		newKeys[i] = keys.NewPreKey(s.lastPreKeyID + 1 + uint32(len(generated)))
+		generated = append(generated, &memPreKey{key: newKeys[i]})
+	}
+	if len(generated) > 0 {
+		if err := s.putPreKeys(generated); err != nil {
+			return nil, err
+		}
+	}
+	return newKeys, nil
+}
+
+func (s *MemoryStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	preKey, ok := s.preKeys[id]
+	if !ok {
+		return nil, nil
+	}
+	return preKey.key, nil
+}
+
+func (s *MemoryStore) RemovePreKey(ctx context.Context, id uint32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walRemovePreKey, ID: id}); err != nil {
+		return err
+	}
+	delete(s.preKeys, id)
+	return nil
+}
+
+func (s *MemoryStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walMarkPreKeysUploaded, ID: upToID}); err != nil {
+		return err
+	}
+	for id, preKey := range s.preKeys {
+		if id <= upToID {
+			preKey.uploaded = true
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	s.lock.RLock()
+	for _, preKey := range s.preKeys {
+		if preKey.uploaded {
+			count++
+		}
+	}
+	s.lock.RUnlock()
+	return
+}
+
+func (s *MemoryStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walPutSenderKey, Name: group, Address: user, Data: session}); err != nil {
+		return err
+	}
+	s.senderKeys[senderKeyID{group, user}] = session
+	return nil
+}
+
+func (s *MemoryStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.senderKeys[senderKeyID{group, user}], nil
+}
+
+func (s *MemoryStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.record(walRecord{Op: walPutAppStateSyncKey, BulkData: &store.ExportedData{
+		AppStateSyncKeys: []store.AppStateSyncKeyEntry{{ID: id, Key: key}},
+	}})
+	if err != nil {
+		return err
+	}
+	s.appStateSyncKeys[string(id)] = key
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key, ok := s.appStateSyncKeys[string(id)]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func (s *MemoryStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var latestID []byte
+	var latestTimestamp int64
+	for id, key := range s.appStateSyncKeys {
+		if latestID == nil || key.Timestamp > latestTimestamp {
+			latestID, latestTimestamp = []byte(id), key.Timestamp
+		}
+	}
+	return latestID, nil
+}
+
+func (s *MemoryStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walPutAppStateVersion, Name: name, Version: version, Data: hash[:]}); err != nil {
+		return err
+	}
+	s.appStateVersions[name] = appStateVersion{version, hash}
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateVersion(ctx context.Context, name string) (uint64, [128]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+	state := s.appStateVersions[name]
+	return state.version, state.hash, nil
+}
+
+func (s *MemoryStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walDeleteAppStateVersion, Name: name}); err != nil {
+		return err
+	}
+	delete(s.appStateVersions, name)
+	return nil
+}
+
+func (s *MemoryStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.wal != nil {
+		entries := make([]store.AppStateMutationMACEntry, len(mutations))
+		for i, mutation := range mutations {
+			entries[i] = store.AppStateMutationMACEntry{AppStateMutationMAC: mutation, Version: version}
+		}
+		err := s.record(walRecord{Op: walPutMutationMACs, BulkData: &store.ExportedData{
+			AppStates: []store.AppStateEntry{{Name: name, Version: version, MutationMACs: entries}},
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	macs, ok := s.mutationMACs[name]
+	if !ok {
+		macs = make(map[string]mutationMAC, len(mutations))
+		s.mutationMACs[name] = macs
+	}
+	for _, mutation := range mutations {
+		existing, ok := macs[string(mutation.IndexMAC)]
+		if !ok || existing.version <= version {
+			macs[string(mutation.IndexMAC)] = mutationMAC{version, mutation.ValueMAC}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.record(walRecord{Op: walDeleteMutationMACs, Name: name, IndexMACs: indexMACs}); err != nil {
+		return err
+	}
+	macs, ok := s.mutationMACs[name]
+	if !ok {
+		return nil
+	}
+	for _, indexMAC := range indexMACs {
+		delete(macs, string(indexMAC))
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.mutationMACs[name][string(indexMAC)].valueMAC, nil
+}
+
+func (s *MemoryStore) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	contact := s.contacts[user]
+	if contact.PushName != pushName {
+		previousName := contact.PushName
+		contact.PushName = pushName
+		contact.Found = true
+		if err := s.putContacts(map[types.JID]types.ContactInfo{user: contact}); err != nil {
+			return false, "", err
+		}
+		return true, previousName, nil
+	}
+	return false, "", nil
+}
+
+func (s *MemoryStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (bool, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	contact := s.contacts[user]
+	if contact.BusinessName != businessName {
+		previousName := contact.BusinessName
+		contact.BusinessName = businessName
+		contact.Found = true
+		if err := s.putContacts(map[types.JID]types.ContactInfo{user: contact}); err != nil {
+			return false, "", err
+		}
+		return true, previousName, nil
+	}
+	return false, "", nil
+}
+
+// putContacts records the given contacts in the write-ahead log and stores them. The write lock must be held when calling this.
+func (s *MemoryStore) putContacts(contacts map[types.JID]types.ContactInfo) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	if err := s.record(walRecord{Op: walPutContacts, BulkData: &store.ExportedData{Contacts: contacts}}); err != nil {
+		return err
+	}
+	for jid, contact := range contacts {
+		s.contacts[jid] = contact
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	contact := s.contacts[user]
+	contact.FirstName = firstName
+	contact.FullName = fullName
+	contact.Found = true
+	return s.putContacts(map[types.JID]types.ContactInfo{user: contact})
+}
+
+func (s *MemoryStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	updated := make(map[types.JID]types.ContactInfo, len(contacts))
+	for _, entry := range contacts {
+		if entry.JID.IsEmpty() {
+			continue
+		}
+		contact, ok := updated[entry.JID]
+		if !ok {
+			contact = s.contacts[entry.JID]
+		}
+		contact.FirstName = entry.FirstName
+		contact.FullName = entry.FullName
+		contact.Found = true
+		updated[entry.JID] = contact
+	}
+	return s.putContacts(updated)
+}
+
+func (s *MemoryStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.contacts[user], nil
+}
+
+func (s *MemoryStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	output := make(map[types.JID]types.ContactInfo, len(s.contacts))
+	for jid, contact := range s.contacts {
+		output[jid] = contact
+	}
+	return output, nil
+}
+
+// putChatSettings records the given chat settings in the write-ahead log and stores them. The write lock must be held when calling this.
+func (s *MemoryStore) putChatSettings(chat types.JID, settings types.LocalChatSettings) error {
+	if s.wal != nil {
+		err := s.record(walRecord{Op: walPutChatSettings, BulkData: &store.ExportedData{
+			ChatSettings: map[types.JID]types.LocalChatSettings{chat: settings},
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	s.chatSettings[chat] = settings
+	return nil
+}
+
+func (s *MemoryStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	settings := s.chatSettings[chat]
+	settings.MutedUntil = mutedUntil
+	settings.Found = true
+	return s.putChatSettings(chat, settings)
+}
+
+func (s *MemoryStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	settings := s.chatSettings[chat]
+	settings.Pinned = pinned
+	settings.Found = true
+	return s.putChatSettings(chat, settings)
+}
+
+func (s *MemoryStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	settings := s.chatSettings[chat]
+	settings.Archived = archived
+	settings.Found = true
+	return s.putChatSettings(chat, settings)
+}
+
+func (s *MemoryStore) GetChatSettings(ctx context.Context, chat types.JID) (types.LocalChatSettings, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.chatSettings[chat], nil
+}
+
+func (s *MemoryStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.putMessageSecrets(inserts)
+}
+
+// putMessageSecrets records the given secrets in the write-ahead log and stores the ones that don't exist yet.
+// The write lock must be held when calling this.
+func (s *MemoryStore) putMessageSecrets(inserts []store.MessageSecretInsert) error {
+	if s.wal != nil {
+		if err := s.record(walRecord{Op: walPutMessageSecrets, BulkData: &store.ExportedData{MessageSecrets: inserts}}); err != nil {
+			return err
+		}
+	}
+	for _, insert := range inserts {
+		key := msgSecretID{insert.Chat.ToNonAD(), insert.Sender.ToNonAD(), insert.ID}
+		if _, exists := s.msgSecrets[key]; !exists {
+			s.msgSecrets[key] = insert.Secret
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.putMessageSecrets([]store.MessageSecretInsert{{Chat: chat, Sender: sender, ID: id, Secret: secret}})
+}
+
+func (s *MemoryStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.msgSecrets[msgSecretID{chat.ToNonAD(), sender.ToNonAD(), id}], nil
+}
+
+func (s *MemoryStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.exportDataLocked(), nil
+}
+
+// exportDataLocked is like ExportData, but the caller must hold the lock.
+func (s *MemoryStore) exportDataLocked() *store.ExportedData {
+	data := &store.ExportedData{
+		Identities:     make(map[string][32]byte, len(s.identities)),
+		Sessions:       make(map[string][]byte, len(s.sessions)),
+		SessionTimes:   make(map[string]time.Time, len(s.sessionUpdated)),
+		PreKeys:        make([]store.PreKeyEntry, 0, len(s.preKeys)),
+		LastPreKeyID:   s.lastPreKeyID,
+		SenderKeys:     make([]store.SenderKeyEntry, 0, len(s.senderKeys)),
+		Contacts:       make(map[types.JID]types.ContactInfo, len(s.contacts)),
+		ChatSettings:   make(map[types.JID]types.LocalChatSettings, len(s.chatSettings)),
+		MessageSecrets: make([]store.MessageSecretInsert, 0, len(s.msgSecrets)),
+	}
+	for address, key := range s.identities {
+		data.Identities[address] = key
+	}
+	for address, session := range s.sessions {
+		data.Sessions[address] = session
+	}
+	for address, updatedAt := range s.sessionUpdated {
+		data.SessionTimes[address] = updatedAt
+	}
+	for _, preKey := range s.preKeys {
+		data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *preKey.key, Uploaded: preKey.uploaded})
+	}
+	for id, key := range s.senderKeys {
+		data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{Group: id.group, User: id.user, Key: key})
+	}
+	for id, key := range s.appStateSyncKeys {
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, store.AppStateSyncKeyEntry{ID: []byte(id), Key: key})
+	}
+	for name, state := range s.appStateVersions {
+		entry := store.AppStateEntry{Name: name, Version: state.version, Hash: state.hash}
+		for indexMAC, mac := range s.mutationMACs[name] {
+			entry.MutationMACs = append(entry.MutationMACs, store.AppStateMutationMACEntry{
+				AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: []byte(indexMAC), ValueMAC: mac.valueMAC},
+				Version:             mac.version,
+			})
+		}
+		data.AppStates = append(data.AppStates, entry)
+	}
+	for jid, contact := range s.contacts {
+		data.Contacts[jid] = contact
+	}
+	for jid, settings := range s.chatSettings {
+		data.ChatSettings[jid] = settings
+	}
+	for id, secret := range s.msgSecrets {
+		data.MessageSecrets = append(data.MessageSecrets, store.MessageSecretInsert{Chat: id.chat, Sender: id.sender, ID: id.id, Secret: secret})
+	}
+	return data
+}
+
+func (s *MemoryStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	imported := make([]*memPreKey, len(preKeys))
+	for i, preKey := range preKeys {
+		key := preKey.PreKey
+		imported[i] = &memPreKey{key: &key, uploaded: preKey.Uploaded}
+	}
+	return s.putPreKeys(imported)
+}
@@ -0,0 +1,398 @@
+package inmemstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+var (
+	// ErrUnknownWALRecord is returned by Replay if the log contains a record written by a newer version of the library.
+	ErrUnknownWALRecord = errors.New("unknown write-ahead log record")
+	// ErrInvalidDeviceRecord is returned by Replay if a device record in the log is malformed.
+	ErrInvalidDeviceRecord = errors.New("invalid device record in write-ahead log")
+	// ErrInvalidLength is returned by Replay if a key in the log has an unexpected length.
+	ErrInvalidLength = errors.New("write-ahead log contains byte array with illegal length")
+)
+
+// walOp is the type of mutation stored in a walRecord.
+type walOp string
+
+const (
+	walPutDevice             walOp = "put_device"
+	walDeleteDevice          walOp = "delete_device"
+	walPutIdentity           walOp = "put_identity"
+	walDeleteAllIdentities   walOp = "delete_all_identities"
+	walDeleteIdentity        walOp = "delete_identity"
+	walPutSession            walOp = "put_session"
+	walDeleteAllSessions     walOp = "delete_all_sessions"
+	walDeleteSession         walOp = "delete_session"
+	walPutPreKeys            walOp = "put_pre_keys"
+	walRemovePreKey          walOp = "remove_pre_key"
+	walMarkPreKeysUploaded   walOp = "mark_pre_keys_uploaded"
+	walPutSenderKey          walOp = "put_sender_key"
+	walPutAppStateSyncKey    walOp = "put_app_state_sync_key"
+	walPutAppStateVersion    walOp = "put_app_state_version"
+	walDeleteAppStateVersion walOp = "delete_app_state_version"
+	walPutMutationMACs       walOp = "put_mutation_macs"
+	walDeleteMutationMACs    walOp = "delete_mutation_macs"
+	walPutContacts           walOp = "put_contacts"
+	walPutChatSettings       walOp = "put_chat_settings"
+	walPutMessageSecrets     walOp = "put_message_secrets"
+)
+
+// walRecord is a single line in the write-ahead log. Only the fields relevant to the operation are set.
+type walRecord struct {
+	Op     walOp     `json:"op"`
+	Device types.JID `json:"device"`
+
+	// DeviceInfo is set for put_device, in the format of store.MarshalDeviceJSON without data.
+	DeviceInfo json.RawMessage `json:"device_info,omitempty"`
+	// Store is the full store data of a put_device record. It's only included when the device is first added to the log.
+	Store *store.ExportedData `json:"store,omitempty"`
+
+	// Address is the Signal address or phone number for identities and sessions, and the user for sender keys.
+	Address string `json:"address,omitempty"`
+	// Name is the app state name, or the group for sender keys.
+	Name    string `json:"name,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+	ID      uint32 `json:"id,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	// Timestamp is the unix time when a session was stored.
+	Timestamp int64 `json:"ts,omitempty"`
+
+	IndexMACs [][]byte `json:"index_macs,omitempty"`
+	// BulkData contains the prekeys, sync keys, mutation MACs, contacts, chat settings or message secrets
+	// of the operations that store multiple values at once.
+	BulkData *store.ExportedData `json:"bulk_data,omitempty"`
+}
+
+// walWriter writes records to the log. Each record is written with a single Write call, so records of
+// different devices never interleave.
+type walWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (ww *walWriter) write(rec *walRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode write-ahead log record: %w", err)
+	}
+	data = append(data, '\n')
+	ww.lock.Lock()
+	_, err = ww.w.Write(data)
+	ww.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to write to write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// WithWAL makes the container append every mutation to the given writer, so that the contents of the
+// container can be recovered with Replay after a crash. If the write fails, the mutation is not applied
+// and the error is returned from the store method.
+//
+// Records are not synced to disk automatically. Use OpenWAL to use a file that is compacted on startup.
+func WithWAL(w io.Writer) Option {
+	return func(c *Container) {
+		c.wal = &walWriter{w: w}
+	}
+}
+
+// attachWAL records the given device in the write-ahead log and makes its store record further mutations.
+// The full store data is only written if the store wasn't attached to the log yet.
+// The container write lock must be held when calling this.
+func (c *Container) attachWAL(device *store.Device) error {
+	if c.wal == nil {
+		return nil
+	}
+	info, err := store.MarshalDeviceJSON(device, nil)
+	if err != nil {
+		return err
+	}
+	rec := &walRecord{Op: walPutDevice, Device: *device.ID, DeviceInfo: info}
+	memStore, ok := memoryStoreOf(device)
+	if !ok {
+		return c.wal.write(rec)
+	}
+	// Attaching the log isn't a use of the device, so lock without updating the last use time
+	memStore.lock.RWMutex.Lock()
+	defer memStore.lock.RWMutex.Unlock()
+	if memStore.wal != c.wal || memStore.walJID != *device.ID {
+		rec.Store = memStore.exportDataLocked()
+	}
+	err = c.wal.write(rec)
+	if err != nil {
+		return err
+	}
+	memStore.wal = c.wal
+	memStore.walJID = *device.ID
+	return nil
+}
+
+// detachWAL records the removal of the given devices in the write-ahead log and stops recording mutations of
+// their stores. Failures are only logged, as the devices have already been removed from the container.
+//
+// This is only used for devices that were deleted or replaced. Evicted devices stay attached, as they may
+// still be in use, and their records are kept in the log until it's compacted.
+// The container write lock must be held when calling this.
+func (c *Container) detachWAL(devices []*store.Device) {
+	if c.wal == nil {
+		return
+	}
+	for _, device := range devices {
+		memStore, ok := memoryStoreOf(device)
+		if ok {
+			memStore.lock.RWMutex.Lock()
+		}
+		err := c.wal.write(&walRecord{Op: walDeleteDevice, Device: *device.ID})
+		if err != nil {
+			c.log.Warnf("Failed to record removal of %s: %v", device.ID, err)
+		}
+		if ok {
+			memStore.wal = nil
+			memStore.lock.RWMutex.Unlock()
+		}
+	}
+}
+
+// Replay creates a new in-memory store container from a write-ahead log previously written with WithWAL.
+//
+// If the last record is incomplete (e.g. because the process crashed while writing it), it's ignored.
+// If the options include WithWAL, the full contents of the container are written to the new log after
+// replaying, so the new log can be used for the next replay on its own. The other options are the same
+// as for New.
+func Replay(r io.Reader, log waLog.Logger, opts ...Option) (*Container, error) {
+	c := New(log, opts...)
+	wal := c.wal
+	c.wal = nil
+
+	c.writeLock.Lock()
+	var evicted []*store.Device
+	err := c.replay(r)
+	if err == nil {
+		// Limits are only enforced after replaying everything, as devices evicted in the previous run
+		// were still recorded in the log, and may have been changed after they were evicted.
+		evicted = c.enforceLimits()
+		c.wal = wal
+		for _, entry := range c.list().entries {
+			if err = c.attachWAL(entry.device); err != nil {
+				break
+			}
+		}
+	}
+	c.writeLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	c.fireEvicted(evicted)
+	return c, nil
+}
+
+// replay applies all records in the given log. Devices are not evicted while replaying.
+// The container write lock must be held when calling this.
+func (c *Container) replay(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var rec walRecord
+		err := decoder.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			c.log.Warnf("Ignoring incomplete record at the end of the write-ahead log")
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read write-ahead log: %w", err)
+		}
+		err = c.applyWAL(&rec)
+		if err != nil {
+			return fmt.Errorf("failed to replay %s record of %s: %w", rec.Op, rec.Device, err)
+		}
+	}
+}
+
+// applyWAL applies a single record. The container write lock must be held when calling this.
+func (c *Container) applyWAL(rec *walRecord) error {
+	existing, exists := c.list().byJID[rec.Device]
+	switch rec.Op {
+	case walPutDevice:
+		if rec.DeviceInfo == nil {
+			return ErrInvalidDeviceRecord
+		}
+		device, _, err := store.UnmarshalDeviceJSON(rec.DeviceInfo)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDeviceRecord, err)
+		} else if *device.ID != rec.Device {
+			return ErrInvalidDeviceRecord
+		}
+		memStore := NewMemoryStore()
+		if rec.Store != nil {
+			memStore = restoreMemoryStore(rec.Store)
+		} else if exists {
+			// The store data was recorded earlier, only the device itself changed
+			if existingStore, ok := memoryStoreOf(existing.device); ok {
+				memStore = existingStore
+			}
+		}
+		c.restoreDevice(device, memStore)
+		if exists {
+			c.detachWAL(c.removeEntries(map[*deviceEntry]struct{}{existing: {}}))
+		}
+		c.appendDevice(device)
+		return nil
+	case walDeleteDevice:
+		if exists {
+			c.detachWAL(c.removeEntries(map[*deviceEntry]struct{}{existing: {}}))
+		}
+		return nil
+	}
+	if !exists {
+		// The device was deleted, so its data isn't needed anymore
+		return nil
+	}
+	memStore, ok := memoryStoreOf(existing.device)
+	if !ok {
+		return nil
+	}
+	return memStore.applyWAL(rec)
+}
+
+func (s *MemoryStore) applyWAL(rec *walRecord) error {
+	ctx := context.Background()
+	data := rec.BulkData
+	if data == nil {
+		data = &store.ExportedData{}
+	}
+	switch rec.Op {
+	case walPutIdentity:
+		if len(rec.Data) != 32 {
+			return ErrInvalidLength
+		}
+		return s.PutIdentity(ctx, rec.Address, *(*[32]byte)(rec.Data))
+	case walDeleteAllIdentities:
+		return s.DeleteAllIdentities(ctx, rec.Address)
+	case walDeleteIdentity:
+		return s.DeleteIdentity(ctx, rec.Address)
+	case walPutSession:
+		updatedAt := time.Now()
+		if rec.Timestamp != 0 {
+			updatedAt = time.Unix(rec.Timestamp, 0)
+		}
+		return s.putSession(rec.Address, rec.Data, updatedAt)
+	case walDeleteAllSessions:
+		return s.DeleteAllSessions(ctx, rec.Address)
+	case walDeleteSession:
+		return s.DeleteSession(ctx, rec.Address)
+	case walPutPreKeys:
+		return s.ImportPreKeys(ctx, data.PreKeys)
+	case walRemovePreKey:
+		return s.RemovePreKey(ctx, rec.ID)
+	case walMarkPreKeysUploaded:
+		return s.MarkPreKeysAsUploaded(ctx, rec.ID)
+	case walPutSenderKey:
+		return s.PutSenderKey(ctx, rec.Name, rec.Address, rec.Data)
+	case walPutAppStateSyncKey:
+		for _, syncKey := range data.AppStateSyncKeys {
+			if err := s.PutAppStateSyncKey(ctx, syncKey.ID, syncKey.Key); err != nil {
+				return err
+			}
+		}
+		return nil
+	case walPutAppStateVersion:
+		if len(rec.Data) != 128 {
+			return ErrInvalidLength
+		}
+		return s.PutAppStateVersion(ctx, rec.Name, rec.Version, *(*[128]byte)(rec.Data))
+	case walDeleteAppStateVersion:
+		return s.DeleteAppStateVersion(ctx, rec.Name)
+	case walPutMutationMACs:
+		for _, state := range data.AppStates {
+			for _, mac := range state.MutationMACs {
+				err := s.PutAppStateMutationMACs(ctx, state.Name, mac.Version, []store.AppStateMutationMAC{mac.AppStateMutationMAC})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case walDeleteMutationMACs:
+		return s.DeleteAppStateMutationMACs(ctx, rec.Name, rec.IndexMACs)
+	case walPutContacts:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return s.putContacts(data.Contacts)
+	case walPutChatSettings:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		for chat, settings := range data.ChatSettings {
+			s.chatSettings[chat] = settings
+		}
+		return nil
+	case walPutMessageSecrets:
+		return s.PutMessageSecrets(ctx, data.MessageSecrets)
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownWALRecord, rec.Op)
+	}
+}
+
+// OpenWAL creates an in-memory store container that is backed by a write-ahead log file at the given path.
+//
+// If the file exists, it's replayed first. The log is then compacted by writing the current contents of
+// the container to a new file, which replaces the old one, so the file doesn't grow forever across restarts.
+// Call Close to close the file when the container is no longer used.
+//
+// The logger can be nil and will default to a no-op logger. The options are the same as for New.
+//
+//	container, err := inmemstore.OpenWAL("whatsmeow.wal", nil)
+func OpenWAL(path string, log waLog.Logger, opts ...Option) (*Container, error) {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create write-ahead log: %w", err)
+	}
+	opts = append(opts, WithWAL(file))
+
+	var c *Container
+	existing, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		c = New(log, opts...)
+	} else if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	} else {
+		c, err = Replay(existing, log, opts...)
+		_ = existing.Close()
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to sync write-ahead log: %w", err)
+	} else if err = os.Rename(tmpPath, path); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to replace write-ahead log: %w", err)
+	}
+	c.walFile = file
+	return c, nil
+}
+
+// Close closes the write-ahead log file opened by OpenWAL. It does nothing for other containers.
+func (c *Container) Close() error {
+	if c.walFile != nil {
+		return c.walFile.Close()
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package inmemstore
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestWALReplay(t *testing.T) {
+	ctx := context.Background()
+	var wal bytes.Buffer
+	container := New(nil, WithWAL(&wal))
+	device := container.NewDevice()
+	_, _ = device.PreKeys.GetOrGenPreKeys(ctx, 2)
+	jid := types.NewADJID("1234567890", 0, 5)
+	device.ID = &jid
+	device.Account = &waProto.ADVSignedDeviceIdentity{Details: []byte("details")}
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	_ = device.Sessions.PutSession(ctx, "222:1", []byte("session"))
+	_ = device.Sessions.DeleteSession(ctx, "222:1")
+	preKeys, _ := device.PreKeys.GetOrGenPreKeys(ctx, 3)
+	_ = device.PreKeys.MarkPreKeysAsUploaded(ctx, preKeys[1].KeyID)
+	_, _, _ = device.Contacts.PutPushName(ctx, types.NewJID("111", types.DefaultUserServer), "Friend")
+	_ = device.ChatSettings.PutPinned(ctx, types.NewJID("111", types.DefaultUserServer), true)
+	_ = device.AppStateKeys.PutAppStateSyncKey(ctx, []byte("key id"), store.AppStateSyncKey{Data: []byte("key data")})
+	_ = device.AppState.PutAppStateMutationMACs(ctx, "regular", 3, []store.AppStateMutationMAC{
+		{IndexMAC: []byte("index"), ValueMAC: []byte("value")},
+	})
+	device.PushName = "Test"
+	_ = device.Save(ctx)
+
+	deleted := container.NewDevice()
+	deletedJID := types.NewADJID("1234567891", 0, 5)
+	deleted.ID = &deletedJID
+	_ = deleted.Save(ctx)
+	_ = deleted.Delete(ctx)
+
+	// Simulate a crash in the middle of writing a record
+	wal.WriteString(`{"op":"put_session","dev`)
+
+	restored, err := Replay(&wal, nil)
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if all, _ := restored.GetAllDevices(ctx); len(all) != 1 {
+		t.Fatalf("expected 1 device after replay, got %d", len(all))
+	}
+	restoredDevice, _ := restored.GetDevice(ctx, jid)
+	if restoredDevice == nil || restoredDevice.PushName != "Test" {
+		t.Fatalf("device not restored correctly: %+v", restoredDevice)
+	}
+	if session, _ := restoredDevice.Sessions.GetSession(ctx, "111:1"); string(session) != "session" {
+		t.Errorf("session not restored, got %q", session)
+	}
+	if has, _ := restoredDevice.Sessions.HasSession(ctx, "222:1"); has {
+		t.Errorf("deleted session was restored")
+	}
+	if count, _ := restoredDevice.PreKeys.UploadedPreKeyCount(ctx); count != 2 {
+		t.Errorf("expected 2 uploaded prekeys, got %d", count)
+	}
+	if key, _ := restoredDevice.PreKeys.GetPreKey(ctx, preKeys[2].KeyID); key == nil || *key.Priv != *preKeys[2].Priv {
+		t.Errorf("prekey not restored correctly")
+	}
+	contact, _ := restoredDevice.Contacts.GetContact(ctx, types.NewJID("111", types.DefaultUserServer))
+	if contact.PushName != "Friend" {
+		t.Errorf("contact not restored, got %+v", contact)
+	}
+	if settings, _ := restoredDevice.ChatSettings.GetChatSettings(ctx, types.NewJID("111", types.DefaultUserServer)); !settings.Pinned {
+		t.Errorf("chat settings not restored, got %+v", settings)
+	}
+	if key, _ := restoredDevice.AppStateKeys.GetAppStateSyncKey(ctx, []byte("key id")); key == nil || string(key.Data) != "key data" {
+		t.Errorf("app state sync key not restored, got %+v", key)
+	}
+	restoredStore, _ := memoryStoreOf(restoredDevice)
+	if mac := restoredStore.mutationMACs["regular"]["index"]; mac.version != 3 || string(mac.valueMAC) != "value" {
+		t.Errorf("mutation MAC not restored, got %+v", mac)
+	}
+}
+
+func TestOpenWAL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "whatsmeow.wal")
+	container, err := OpenWAL(path, nil)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 5)
+	device.ID = &jid
+	_ = device.Save(ctx)
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	_ = container.Close()
+
+	reopened, err := OpenWAL(path, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL: %v", err)
+	}
+	restoredDevice, _ := reopened.GetDevice(ctx, jid)
+	if restoredDevice == nil {
+		t.Fatal("device not restored")
+	}
+	_ = restoredDevice.Sessions.PutSession(ctx, "222:1", []byte("session 2"))
+	_ = reopened.Close()
+
+	compacted, err := OpenWAL(path, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen compacted WAL: %v", err)
+	}
+	defer compacted.Close()
+	restoredDevice, _ = compacted.GetDevice(ctx, jid)
+	for _, address := range []string{"111:1", "222:1"} {
+		if has, _ := restoredDevice.Sessions.HasSession(ctx, address); !has {
+			t.Errorf("session %s not restored after compaction", address)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Package kvstore contains an implementation of the interfaces in the store package on top of a
+// simple key-value interface, which makes it easy to use any key-value database (like etcd or Consul)
+// without reimplementing every store method.
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// KV is the interface that a key-value database must implement to be used with this package.
+//
+// Keys are printable strings separated with slashes, values are arbitrary bytes.
+type KV interface {
+	// Get returns the value of the given key, or nil without an error if the key doesn't exist.
+	Get(key string) ([]byte, error)
+	// Put sets the value of the given key, overwriting any existing value.
+	Put(key string, value []byte) error
+	// Delete removes the given key. Deleting a key that doesn't exist is not an error.
+	Delete(key string) error
+	// Scan calls the given function for every key that starts with the given prefix.
+	// The keys should be sorted in lexicographical order. The function must not modify the database,
+	// and returning an error from it stops the scan and returns the error.
+	Scan(prefix string, fn func(key string, value []byte) error) error
+}
+
+// Container is a wrapper for a key-value database that can contain multiple whatsmeow sessions.
+//
+// Operations that read and then update values (like generating prekeys) are protected with locks
+// inside the store, but the KV interface has no transactions, so the same device must not be used
+// by multiple processes at the same time.
+type Container struct {
+	kv         KV
+	basePrefix string
+	prefix     string
+	tenant     string
+	log        waLog.Logger
+
+	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	ReadOnly bool
+}
+
+var _ store.Container = (*Container)(nil)
+
+// New wraps the given key-value database in a Container.
+//
+// All keys are prefixed with the given prefix, which allows sharing one database with other
+// applications. The prefix can be empty.
+//
+// The logger can be nil and will default to a no-op logger.
+//
+//	container := kvstore.New(myEtcdAdapter, "whatsmeow/", nil)
+func New(kv KV, prefix string, log waLog.Logger) *Container {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Container{
+		kv:         kv,
+		basePrefix: prefix,
+		prefix:     prefix,
+		log:        log,
+	}
+}
+
+// WithTenant returns a Container that shares the key-value database with this one, but only sees the
+// devices of the given tenant. The keys of the tenant are stored under `<prefix>tenant/<tenant>/`.
+//
+// Containers created with New use the empty default tenant, which doesn't see the devices of other tenants.
+// Tenant names shouldn't contain slashes, as a tenant could otherwise see the devices of another tenant.
+func (c *Container) WithTenant(tenant string) *Container {
+	prefix := c.basePrefix
+	if tenant != "" {
+		prefix = c.basePrefix + "tenant/" + tenant + "/"
+	}
+	return &Container{
+		kv:         c.kv,
+		basePrefix: c.basePrefix,
+		prefix:     prefix,
+		tenant:     tenant,
+		log:        c.log,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
+func (c *Container) deviceKey(jid string) string {
+	return c.prefix + "device/" + jid
+}
+
+func (c *Container) dataPrefix(jid string) string {
+	return c.prefix + "data/" + jid + "/"
+}
+
+type kvDevice struct {
+	RegistrationID   uint32 `json:"registration_id"`
+	NoiseKey         []byte `json:"noise_key"`
+	IdentityKey      []byte `json:"identity_key"`
+	SignedPreKey     []byte `json:"signed_pre_key"`
+	SignedPreKeyID   uint32 `json:"signed_pre_key_id"`
+	SignedPreKeySig  []byte `json:"signed_pre_key_sig"`
+	AdvKey           []byte `json:"adv_key"`
+	AdvDetails       []byte `json:"adv_details"`
+	AdvAccountSig    []byte `json:"adv_account_sig"`
+	AdvAccountSigKey []byte `json:"adv_account_sig_key"`
+	AdvDeviceSig     []byte `json:"adv_device_sig"`
+	Platform         string `json:"platform"`
+	BusinessName     string `json:"business_name"`
+	PushName         string `json:"push_name"`
+	LastSeen         int64  `json:"last_seen,omitempty"`
+}
+
+func (c *Container) scanDevice(jid types.JID, data []byte) (*store.Device, error) {
+	var stored kvDevice
+	err := json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	} else if len(stored.NoiseKey) != 32 || len(stored.IdentityKey) != 32 || len(stored.SignedPreKey) != 32 || len(stored.SignedPreKeySig) != 64 {
+		return nil, ErrInvalidLength
+	}
+
+	var device store.Device
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	device.Log = c.log
+	device.ID = &jid
+	device.RegistrationID = stored.RegistrationID
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.NoiseKey))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.IdentityKey))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.SignedPreKey)),
+		KeyID:     stored.SignedPreKeyID,
+		Signature: (*[64]byte)(stored.SignedPreKeySig),
+	}
+	device.AdvSecretKey = stored.AdvKey
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             stored.AdvDetails,
+		AccountSignature:    stored.AdvAccountSig,
+		AccountSignatureKey: stored.AdvAccountSigKey,
+		DeviceSignature:     stored.AdvDeviceSig,
+	}
+	device.Platform = stored.Platform
+	device.BusinessName = stored.BusinessName
+	device.PushName = stored.PushName
+	if stored.LastSeen != 0 {
+		device.LastSeen = time.Unix(stored.LastSeen, 0)
+	}
+
+	c.initStores(&device)
+	return &device, nil
+}
+
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewKVStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	if device.Contacts == nil {
+		device.Contacts = innerStore
+	}
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.Container = c
+	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "kvstore", c.MetricsHook)
+}
+
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	sessions := make([]*store.Device, 0)
+	devicePrefix := c.deviceKey("")
+	err := c.kv.Scan(devicePrefix, func(key string, value []byte) error {
+		rawJID := strings.TrimPrefix(key, devicePrefix)
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return fmt.Errorf("failed to parse device JID %q: %w", rawJID, err)
+		}
+		sess, err := c.scanDevice(jid, value)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, sess)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the database.
+//
+// If the device is not found, nil is returned instead.
+//
+// Note that the parameter usually must be an AD-JID.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	data, err := c.kv.Get(c.deviceKey(jid.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	} else if data == nil {
+		return nil, nil
+	}
+	return c.scanDevice(jid, data)
+}
+
+// NewDevice creates a new device in this database.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	return device
+}
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+// ErrInvalidLength is returned by some database getters if the database returned a byte array with an unexpected length.
+var ErrInvalidLength = errors.New("database returned byte array with illegal length")
+
+// PutDevice stores the given device in this database. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	data, err := json.Marshal(&kvDevice{
+		RegistrationID:   device.RegistrationID,
+		NoiseKey:         device.NoiseKey.Priv[:],
+		IdentityKey:      device.IdentityKey.Priv[:],
+		SignedPreKey:     device.SignedPreKey.Priv[:],
+		SignedPreKeyID:   device.SignedPreKey.KeyID,
+		SignedPreKeySig:  device.SignedPreKey.Signature[:],
+		AdvKey:           device.AdvSecretKey,
+		AdvDetails:       device.Account.Details,
+		AdvAccountSig:    device.Account.AccountSignature,
+		AdvAccountSigKey: device.Account.AccountSignatureKey,
+		AdvDeviceSig:     device.Account.DeviceSignature,
+		Platform:         device.Platform,
+		BusinessName:     device.BusinessName,
+		PushName:         device.PushName,
+		LastSeen:         lastSeen,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %w", err)
+	}
+	err = c.kv.Put(c.deviceKey(device.ID.String()), data)
+
+	if !device.Initialized {
+		c.initStores(device)
+	}
+	return err
+}
+
+// DeleteDevice deletes the given device and all of its data from this database. This should be called through Device.Delete()
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	jid := device.ID.String()
+	err := c.kv.Delete(c.deviceKey(jid))
+	if err != nil {
+		return err
+	}
+	return c.deleteWithPrefix(c.dataPrefix(jid))
+}
+
+// deleteWithPrefix deletes all keys with the given prefix. The keys are collected first,
+// because the KV interface doesn't allow modifying the database during a scan.
+func (c *Container) deleteWithPrefix(prefix string) error {
+	var keysToDelete []string
+	err := c.kv.Scan(prefix, func(key string, _ []byte) error {
+		keysToDelete = append(keysToDelete, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keysToDelete {
+		err = c.kv.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
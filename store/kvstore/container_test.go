@@ -0,0 +1,128 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func newTestDevice(t *testing.T, c *Container) *store.Device {
+	ctx := context.Background()
+	t.Helper()
+	device := c.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             []byte("details"),
+		AccountSignature:    []byte("account signature"),
+		AccountSignatureKey: []byte("account signature key"),
+		DeviceSignature:     []byte("device signature"),
+	}
+	device.PushName = "Tester"
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+	return device
+}
+
+func TestDeviceSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+	c := New(kv, "whatsmeow/", nil)
+	if err := c.NewDevice().Save(ctx); err != ErrDeviceIDMustBeSet {
+		t.Fatalf("expected ErrDeviceIDMustBeSet, got %v", err)
+	}
+	device := newTestDevice(t, c)
+
+	loaded, err := New(kv, "whatsmeow/", nil).GetDevice(ctx, *device.ID)
+	if err != nil || loaded == nil {
+		t.Fatalf("failed to load device: %v", err)
+	}
+	if *loaded.NoiseKey.Priv != *device.NoiseKey.Priv || *loaded.IdentityKey.Priv != *device.IdentityKey.Priv {
+		t.Fatal("loaded keys don't match")
+	} else if *loaded.SignedPreKey.Signature != *device.SignedPreKey.Signature || loaded.SignedPreKey.KeyID != device.SignedPreKey.KeyID {
+		t.Fatal("loaded signed prekey doesn't match")
+	} else if loaded.RegistrationID != device.RegistrationID || loaded.PushName != "Tester" {
+		t.Fatal("loaded metadata doesn't match")
+	} else if !bytes.Equal(loaded.Account.DeviceSignature, device.Account.DeviceSignature) {
+		t.Fatal("loaded account doesn't match")
+	}
+	if all, _ := c.GetAllDevices(ctx); len(all) != 1 || *all[0].ID != *device.ID {
+		t.Fatalf("unexpected devices %v", all)
+	}
+	if other, _ := New(kv, "other/", nil).GetAllDevices(ctx); len(other) != 0 {
+		t.Fatal("device is visible with a different prefix")
+	} else if tenant, _ := c.WithTenant("tenant").GetAllDevices(ctx); len(tenant) != 0 {
+		t.Fatal("device is visible in a different tenant")
+	}
+
+	_ = device.Sessions.PutSession(context.Background(), "4567:0", []byte("session"))
+	if err = c.DeleteDevice(ctx, device); err != nil {
+		t.Fatalf("failed to delete device: %v", err)
+	}
+	if len(kv.values) != 0 {
+		t.Fatalf("expected deleting the device to remove all keys, %d left", len(kv.values))
+	}
+}
+
+func TestSessionRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	device := newTestDevice(t, New(NewMemoryKV(), "", nil))
+	if err := device.Sessions.PutSession(ctx, "4567:0", []byte("session")); err != nil {
+		t.Fatalf("failed to put session: %v", err)
+	}
+	_ = device.Sessions.PutSession(ctx, "4567:1", []byte("other session"))
+	_ = device.Sessions.PutSession(ctx, "45678:0", []byte("other user"))
+	if sess, err := device.Sessions.GetSession(ctx, "4567:0"); err != nil || string(sess) != "session" {
+		t.Fatalf("unexpected session %q (error: %v)", sess, err)
+	}
+	if err := device.Sessions.DeleteAllSessions(ctx, "4567"); err != nil {
+		t.Fatalf("failed to delete sessions: %v", err)
+	}
+	if has, _ := device.Sessions.HasSession(ctx, "4567:1"); has {
+		t.Fatal("session wasn't deleted")
+	} else if has, _ = device.Sessions.HasSession(ctx, "45678:0"); !has {
+		t.Fatal("session of a user with the same prefix was deleted")
+	}
+}
+
+func TestPreKeyRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	device := newTestDevice(t, New(NewMemoryKV(), "", nil))
+	preKeys, err := device.PreKeys.GetOrGenPreKeys(ctx, 12)
+	if err != nil || len(preKeys) != 12 {
+		t.Fatalf("failed to generate prekeys: %v", err)
+	}
+	for i, key := range preKeys {
+		if key.KeyID != uint32(i+1) {
+			t.Fatalf("expected prekey %d to have ID %d, got %d", i, i+1, key.KeyID)
+		}
+	}
+	if again, _ := device.PreKeys.GetOrGenPreKeys(ctx, 12); again[11].KeyID != 12 {
+		t.Fatal("unuploaded prekeys weren't reused")
+	}
+
+	if err = device.PreKeys.MarkPreKeysAsUploaded(ctx, 10); err != nil {
+		t.Fatalf("failed to mark prekeys as uploaded: %v", err)
+	}
+	if count, _ := device.PreKeys.UploadedPreKeyCount(ctx); count != 10 {
+		t.Fatalf("expected 10 uploaded prekeys, got %d", count)
+	}
+	next, _ := device.PreKeys.GetOrGenPreKeys(ctx, 3)
+	if len(next) != 3 || next[0].KeyID != 11 || next[2].KeyID != 13 {
+		t.Fatalf("unexpected prekeys after upload: %v", next)
+	}
+
+	loaded, err := device.PreKeys.GetPreKey(ctx, 5)
+	if err != nil || loaded == nil || *loaded.Priv != *preKeys[4].Priv {
+		t.Fatalf("loaded prekey doesn't match (error: %v)", err)
+	}
+	_ = device.PreKeys.RemovePreKey(ctx, 5)
+	if loaded, _ = device.PreKeys.GetPreKey(ctx, 5); loaded != nil {
+		t.Fatal("prekey wasn't removed")
+	}
+}
@@ -0,0 +1,195 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.DataExporter = (*KVStore)(nil)
+var _ store.PreKeyImporter = (*KVStore)(nil)
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *KVStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	data := &store.ExportedData{
+		Identities:   make(map[string][32]byte),
+		Sessions:     make(map[string][]byte),
+		Contacts:     make(map[types.JID]types.ContactInfo),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+	err := s.scan(identitiesBucket, "", func(address string, value []byte) error {
+		if len(value) != 32 {
+			return ErrInvalidLength
+		}
+		data.Identities[address] = *(*[32]byte)(value)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export identities: %w", err)
+	}
+	err = s.scan(sessionsBucket, "", func(address string, value []byte) error {
+		data.Sessions[address] = cloneBytes(value)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	err = s.scan(preKeysBucket, "", func(rawID string, value []byte) error {
+		key, uploaded, err := parsePreKey(rawID, value)
+		if err != nil {
+			return err
+		}
+		data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *key, Uploaded: uploaded})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export prekeys: %w", err)
+	}
+	err = s.scan(senderKeysBucket, "", func(id string, value []byte) error {
+		parts := strings.SplitN(id, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid sender key ID %q", id)
+		}
+		data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{
+			Group: parts[0],
+			User:  parts[1],
+			Key:   cloneBytes(value),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sender keys: %w", err)
+	}
+	err = s.scan(appStateSyncKeysBucket, "", func(hexID string, value []byte) error {
+		id, err := hex.DecodeString(hexID)
+		if err != nil {
+			return fmt.Errorf("invalid app state sync key ID %q: %w", hexID, err)
+		}
+		entry := store.AppStateSyncKeyEntry{ID: id}
+		err = json.Unmarshal(value, &entry.Key)
+		if err != nil {
+			return fmt.Errorf("failed to parse app state sync key: %w", err)
+		}
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state sync keys: %w", err)
+	}
+	err = s.scan(appStateVersionBucket, "", func(name string, value []byte) error {
+		if len(value) != 8+128 {
+			return ErrInvalidLength
+		}
+		entry := store.AppStateEntry{
+			Name:    name,
+			Version: binary.BigEndian.Uint64(value),
+			Hash:    *(*[128]byte)(value[8:]),
+		}
+		data.AppStates = append(data.AppStates, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state: %w", err)
+	}
+	// The KV interface doesn't allow nested scans, so mutation MACs are collected separately
+	for i := range data.AppStates {
+		entry := &data.AppStates[i]
+		err = s.scan(appStateMACsBucket, entry.Name+"/", func(id string, value []byte) error {
+			indexMAC, err := hex.DecodeString(strings.TrimPrefix(id, entry.Name+"/"))
+			if err != nil {
+				return fmt.Errorf("invalid index MAC in %q: %w", id, err)
+			} else if len(value) < 8 {
+				return ErrInvalidLength
+			}
+			entry.MutationMACs = append(entry.MutationMACs, store.AppStateMutationMACEntry{
+				AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: indexMAC, ValueMAC: cloneBytes(value[8:])},
+				Version:             binary.BigEndian.Uint64(value),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export app state mutation MACs: %w", err)
+		}
+	}
+	err = s.scan(contactsBucket, "", func(rawJID string, value []byte) error {
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return fmt.Errorf("failed to parse contact JID %q: %w", rawJID, err)
+		}
+		var contact kvContact
+		err = json.Unmarshal(value, &contact)
+		if err != nil {
+			return fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+		}
+		data.Contacts[jid] = contact.toInfo()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export contacts: %w", err)
+	}
+	err = s.scan(chatSettingsBucket, "", func(rawJID string, value []byte) error {
+		chat, err := types.ParseJID(rawJID)
+		if err != nil {
+			return fmt.Errorf("failed to parse chat JID %q: %w", rawJID, err)
+		}
+		var stored kvChatSettings
+		err = json.Unmarshal(value, &stored)
+		if err != nil {
+			return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		}
+		data.ChatSettings[chat] = stored.toSettings()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export chat settings: %w", err)
+	}
+	err = s.scan(msgSecretsBucket, "", func(id string, value []byte) error {
+		parts := strings.SplitN(id, "/", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid message secret key %q", id)
+		}
+		entry := store.MessageSecretInsert{ID: parts[2], Secret: cloneBytes(value)}
+		var err error
+		entry.Chat, err = types.ParseJID(parts[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse chat JID %q: %w", parts[0], err)
+		}
+		entry.Sender, err = types.ParseJID(parts[1])
+		if err != nil {
+			return fmt.Errorf("failed to parse sender JID %q: %w", parts[1], err)
+		}
+		data.MessageSecrets = append(data.MessageSecrets, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export message secrets: %w", err)
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *KVStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	lastID, err := s.getLastPreKeyID()
+	if err != nil {
+		return err
+	}
+	for _, preKey := range preKeys {
+		key := preKey.PreKey
+		err = s.putPreKey(&key, preKey.Uploaded)
+		if err != nil {
+			return err
+		}
+		if key.KeyID > lastID {
+			lastID = key.KeyID
+		}
+	}
+	return s.setLastPreKeyID(lastID)
+}
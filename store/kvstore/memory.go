@@ -0,0 +1,67 @@
+package kvstore
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryKV is a KV that stores everything in a map. It's mostly useful for tests, as nothing is persisted.
+//
+//	container := kvstore.New(kvstore.NewMemoryKV(), "", nil)
+type MemoryKV struct {
+	values map[string][]byte
+	lock   sync.RWMutex
+}
+
+var _ KV = (*MemoryKV)(nil)
+
+// NewMemoryKV creates an empty MemoryKV.
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{values: make(map[string][]byte)}
+}
+
+func (kv *MemoryKV) Get(key string) ([]byte, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	value, ok := kv.values[key]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (kv *MemoryKV) Put(key string, value []byte) error {
+	kv.lock.Lock()
+	kv.values[key] = append([]byte(nil), value...)
+	kv.lock.Unlock()
+	return nil
+}
+
+func (kv *MemoryKV) Delete(key string) error {
+	kv.lock.Lock()
+	delete(kv.values, key)
+	kv.lock.Unlock()
+	return nil
+}
+
+func (kv *MemoryKV) Scan(prefix string, fn func(key string, value []byte) error) error {
+	kv.lock.RLock()
+	keys := make([]string, 0, len(kv.values))
+	values := make(map[string][]byte)
+	for key, value := range kv.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+			values[key] = value
+		}
+	}
+	// Release the lock before calling fn, as other goroutines may write while the scan is running
+	kv.lock.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
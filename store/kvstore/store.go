@@ -0,0 +1,642 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+const (
+	identitiesBucket       = "identities"
+	sessionsBucket         = "sessions"
+	preKeysBucket          = "pre_keys"
+	senderKeysBucket       = "sender_keys"
+	appStateSyncKeysBucket = "app_state_sync_keys"
+	appStateVersionBucket  = "app_state_version"
+	appStateMACsBucket     = "app_state_mutation_macs"
+	contactsBucket         = "contacts"
+	chatSettingsBucket     = "chat_settings"
+	msgSecretsBucket       = "message_secrets"
+)
+
+// lastPreKeyIDKey is the key of the prekey ID counter inside the device data prefix.
+const lastPreKeyIDKey = "pre_key_last_id"
+
+type KVStore struct {
+	*Container
+	JID string
+
+	preKeyLock       sync.Mutex
+	contactLock      sync.Mutex
+	chatSettingsLock sync.Mutex
+}
+
+// NewKVStore creates a new KVStore with the given container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewKVStore(c *Container, jid types.JID) *KVStore {
+	return &KVStore{
+		Container: c,
+		JID:       jid.String(),
+	}
+}
+
+var _ store.IdentityStore = (*KVStore)(nil)
+var _ store.SessionStore = (*KVStore)(nil)
+var _ store.PreKeyStore = (*KVStore)(nil)
+var _ store.SenderKeyStore = (*KVStore)(nil)
+var _ store.AppStateSyncKeyStore = (*KVStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*KVStore)(nil)
+var _ store.AppStateStore = (*KVStore)(nil)
+var _ store.ContactStore = (*KVStore)(nil)
+var _ store.ChatSettingsStore = (*KVStore)(nil)
+var _ store.MsgSecretStore = (*KVStore)(nil)
+
+// k returns the full key of the given item in the named bucket of this device.
+func (s *KVStore) k(bucket, key string) string {
+	return s.dataPrefix(s.JID) + bucket + "/" + key
+}
+
+// scan calls the given function for each item in the named bucket of this device, with the bucket prefix
+// removed from the key. If keyPrefix is not empty, only keys starting with it are included.
+func (s *KVStore) scan(bucket, keyPrefix string, fn func(key string, value []byte) error) error {
+	bucketPrefix := s.k(bucket, "")
+	return s.kv.Scan(bucketPrefix+keyPrefix, func(key string, value []byte) error {
+		return fn(strings.TrimPrefix(key, bucketPrefix), value)
+	})
+}
+
+func (s *KVStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.kv.Put(s.k(identitiesBucket, address), key[:])
+}
+
+func (s *KVStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deleteWithPrefix(s.k(identitiesBucket, phone+":"))
+}
+
+func (s *KVStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.kv.Delete(s.k(identitiesBucket, address))
+}
+
+func (s *KVStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existingIdentity, err := s.kv.Get(s.k(identitiesBucket, address))
+	if err != nil {
+		return false, err
+	} else if existingIdentity == nil {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	} else if len(existingIdentity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existingIdentity) == key, nil
+}
+
+func (s *KVStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.kv.Get(s.k(sessionsBucket, address))
+}
+
+func (s *KVStore) HasSession(ctx context.Context, address string) (bool, error) {
+	session, err := s.kv.Get(s.k(sessionsBucket, address))
+	return session != nil, err
+}
+
+func (s *KVStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.kv.Put(s.k(sessionsBucket, address), session)
+}
+
+func (s *KVStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deleteWithPrefix(s.k(sessionsBucket, phone+":"))
+}
+
+func (s *KVStore) DeleteSession(ctx context.Context, address string) error {
+	return s.kv.Delete(s.k(sessionsBucket, address))
+}
+
+// Prekey IDs are zero-padded in keys, so that scanning returns them in ID order.
+// The first byte of the value is the uploaded flag, followed by the 32-byte private key.
+
+func preKeyID(id uint32) string {
+	return fmt.Sprintf("%010d", id)
+}
+
+func parsePreKey(rawID string, value []byte) (*keys.PreKey, bool, error) {
+	id, err := strconv.ParseUint(rawID, 10, 32)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse prekey ID: %w", err)
+	} else if len(value) != 33 {
+		return nil, false, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(value[1:])),
+		KeyID:   uint32(id),
+	}, value[0] == 1, nil
+}
+
+func (s *KVStore) putPreKey(key *keys.PreKey, uploaded bool) error {
+	value := make([]byte, 33)
+	if uploaded {
+		value[0] = 1
+	}
+	copy(value[1:], key.Priv[:])
+	return s.kv.Put(s.k(preKeysBucket, preKeyID(key.KeyID)), value)
+}
+
+func (s *KVStore) getLastPreKeyID() (uint32, error) {
+	data, err := s.kv.Get(s.dataPrefix(s.JID) + lastPreKeyIDKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query next prekey ID: %w", err)
+	} else if data == nil {
+		return 0, nil
+	} else if len(data) != 4 {
+		return 0, ErrInvalidLength
+	}
+	return binary.BigEndian.Uint32(data), nil
+}
+
+func (s *KVStore) setLastPreKeyID(id uint32) error {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, id)
+	return s.kv.Put(s.dataPrefix(s.JID)+lastPreKeyIDKey, data)
+}
+
+func (s *KVStore) genPreKeys(count uint32, markUploaded bool) ([]*keys.PreKey, error) {
+	lastID, err := s.getLastPreKeyID()
+	if err != nil {
+		return nil, err
+	}
+	// Reserve the IDs before storing the keys, so a failure in the middle can't cause ID reuse
+	err = s.setLastPreKeyID(lastID + count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve prekey IDs: %w", err)
+	}
+	newKeys := make([]*keys.PreKey, count)
+	for i := range newKeys {
+		newKeys[i] = keys.NewPreKey(lastID + uint32(i) + 1)
+		err = s.putPreKey(newKeys[i], markUploaded)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newKeys, nil
+}
+
+func (s *KVStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	newKeys, err := s.genPreKeys(1, true)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys[0], nil
+}
+
+func (s *KVStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	newKeys := make([]*keys.PreKey, 0, count)
+	err := s.scan(preKeysBucket, "", func(rawID string, value []byte) error {
+		if uint32(len(newKeys)) >= count {
+			return nil
+		}
+		key, uploaded, err := parsePreKey(rawID, value)
+		if err != nil {
+			return err
+		} else if !uploaded {
+			newKeys = append(newKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing prekeys: %w", err)
+	}
+
+	if missing := count - uint32(len(newKeys)); missing > 0 {
+		var generated []*keys.PreKey
+		generated, err = s.genPreKeys(missing, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate prekeys: %w", err)
+		}
+		newKeys = append(newKeys, generated...)
+	}
+	return newKeys, nil
+}
+
+func (s *KVStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	rawID := preKeyID(id)
+	value, err := s.kv.Get(s.k(preKeysBucket, rawID))
+	if err != nil || value == nil {
+		return nil, err
+	}
+	key, _, err := parsePreKey(rawID, value)
+	return key, err
+}
+
+func (s *KVStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.kv.Delete(s.k(preKeysBucket, preKeyID(id)))
+}
+
+func (s *KVStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	var toMark []*keys.PreKey
+	err := s.scan(preKeysBucket, "", func(rawID string, value []byte) error {
+		key, uploaded, err := parsePreKey(rawID, value)
+		if err != nil {
+			return err
+		} else if !uploaded && key.KeyID <= upToID {
+			toMark = append(toMark, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range toMark {
+		err = s.putPreKey(key, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	err = s.scan(preKeysBucket, "", func(_ string, value []byte) error {
+		if len(value) > 0 && value[0] == 1 {
+			count++
+		}
+		return nil
+	})
+	return
+}
+
+func senderKeyID(group, user string) string {
+	return group + "/" + user
+}
+
+func (s *KVStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.kv.Put(s.k(senderKeysBucket, senderKeyID(group, user)), session)
+}
+
+func (s *KVStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.kv.Get(s.k(senderKeysBucket, senderKeyID(group, user)))
+}
+
+func (s *KVStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	data, err := json.Marshal(&key)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(s.k(appStateSyncKeysBucket, hex.EncodeToString(id)), data)
+}
+
+func (s *KVStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	data, err := s.kv.Get(s.k(appStateSyncKeysBucket, hex.EncodeToString(id)))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var key store.AppStateSyncKey
+	err = json.Unmarshal(data, &key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app state sync key: %w", err)
+	}
+	return &key, nil
+}
+
+func (s *KVStore) GetLatestAppStateSyncKeyID(ctx context.Context) (latestID []byte, err error) {
+	var latestTimestamp int64
+	err = s.scan(appStateSyncKeysBucket, "", func(hexID string, value []byte) error {
+		var key store.AppStateSyncKey
+		if err := json.Unmarshal(value, &key); err != nil {
+			return fmt.Errorf("failed to parse app state sync key: %w", err)
+		} else if latestID != nil && key.Timestamp <= latestTimestamp {
+			return nil
+		}
+		id, err := hex.DecodeString(hexID)
+		if err != nil {
+			return fmt.Errorf("invalid app state sync key ID %q: %w", hexID, err)
+		}
+		latestID, latestTimestamp = id, key.Timestamp
+		return nil
+	})
+	return
+}
+
+func (s *KVStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	data := make([]byte, 8+len(hash))
+	binary.BigEndian.PutUint64(data, version)
+	copy(data[8:], hash[:])
+	return s.kv.Put(s.k(appStateVersionBucket, name), data)
+}
+
+func (s *KVStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var data []byte
+	data, err = s.kv.Get(s.k(appStateVersionBucket, name))
+	if err != nil || data == nil {
+		// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+		return
+	} else if len(data) != 8+len(hash) {
+		err = ErrInvalidLength
+		return
+	}
+	version = binary.BigEndian.Uint64(data)
+	hash = *(*[128]byte)(data[8:])
+	return
+}
+
+func (s *KVStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.kv.Delete(s.k(appStateVersionBucket, name))
+}
+
+// Mutation MACs are stored with the app state name and hex-encoded index MAC as the key,
+// and the big-endian version followed by the value MAC as the value.
+
+func mutationMACID(name string, indexMAC []byte) string {
+	return name + "/" + hex.EncodeToString(indexMAC)
+}
+
+func (s *KVStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	for _, mutation := range mutations {
+		value := make([]byte, 8+len(mutation.ValueMAC))
+		binary.BigEndian.PutUint64(value, version)
+		copy(value[8:], mutation.ValueMAC)
+		err := s.kv.Put(s.k(appStateMACsBucket, mutationMACID(name, mutation.IndexMAC)), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	for _, indexMAC := range indexMACs {
+		err := s.kv.Delete(s.k(appStateMACsBucket, mutationMACID(name, indexMAC)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	value, err := s.kv.Get(s.k(appStateMACsBucket, mutationMACID(name, indexMAC)))
+	if err != nil || value == nil {
+		return nil, err
+	} else if len(value) < 8 {
+		return nil, ErrInvalidLength
+	}
+	return value[8:], nil
+}
+
+type kvContact struct {
+	FirstName    string `json:"first_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+}
+
+func (kc *kvContact) toInfo() types.ContactInfo {
+	return types.ContactInfo{
+		Found:        true,
+		FirstName:    kc.FirstName,
+		FullName:     kc.FullName,
+		PushName:     kc.PushName,
+		BusinessName: kc.BusinessName,
+	}
+}
+
+func (s *KVStore) getContact(user types.JID) (*kvContact, bool, error) {
+	var contact kvContact
+	data, err := s.kv.Get(s.k(contactsBucket, user.String()))
+	if err != nil || data == nil {
+		return &contact, false, err
+	}
+	err = json.Unmarshal(data, &contact)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse contact info of %s: %w", user, err)
+	}
+	return &contact, true, nil
+}
+
+func (s *KVStore) putContact(user types.JID, contact *kvContact) error {
+	data, err := json.Marshal(contact)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(s.k(contactsBucket, user.String()), data)
+}
+
+// updateContact applies the given function to the stored contact info and saves the result if it returns true.
+func (s *KVStore) updateContact(user types.JID, update func(contact *kvContact) bool) error {
+	s.contactLock.Lock()
+	defer s.contactLock.Unlock()
+	contact, _, err := s.getContact(user)
+	if err != nil {
+		return err
+	}
+	if update(contact) {
+		return s.putContact(user, contact)
+	}
+	return nil
+}
+
+func (s *KVStore) PutPushName(ctx context.Context, user types.JID, pushName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(user, func(contact *kvContact) bool {
+		if contact.PushName != pushName {
+			previousName = contact.PushName
+			contact.PushName = pushName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *KVStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(user, func(contact *kvContact) bool {
+		if contact.BusinessName != businessName {
+			previousName = contact.BusinessName
+			contact.BusinessName = businessName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *KVStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	return s.updateContact(user, func(contact *kvContact) bool {
+		if contact.FirstName != firstName || contact.FullName != fullName {
+			contact.FirstName = firstName
+			contact.FullName = fullName
+			return true
+		}
+		return false
+	})
+}
+
+func (s *KVStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	for _, entry := range contacts {
+		if entry.JID.IsEmpty() {
+			s.log.Warnf("Empty contact info in mass insert: %+v", entry)
+			continue
+		}
+		err := s.PutContactName(ctx, entry.JID, entry.FirstName, entry.FullName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	contact, found, err := s.getContact(user)
+	if err != nil || !found {
+		return types.ContactInfo{}, err
+	}
+	return contact.toInfo(), nil
+}
+
+func (s *KVStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	output := make(map[types.JID]types.ContactInfo)
+	err := s.scan(contactsBucket, "", func(rawJID string, value []byte) error {
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return fmt.Errorf("failed to parse contact JID %q: %w", rawJID, err)
+		}
+		var contact kvContact
+		err = json.Unmarshal(value, &contact)
+		if err != nil {
+			return fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+		}
+		output[jid] = contact.toInfo()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+type kvChatSettings struct {
+	MutedUntil int64 `json:"muted_until,omitempty"`
+	Pinned     bool  `json:"pinned,omitempty"`
+	Archived   bool  `json:"archived,omitempty"`
+}
+
+func (kcs *kvChatSettings) toSettings() types.LocalChatSettings {
+	settings := types.LocalChatSettings{Found: true, Pinned: kcs.Pinned, Archived: kcs.Archived}
+	if kcs.MutedUntil != 0 {
+		settings.MutedUntil = time.Unix(kcs.MutedUntil, 0)
+	}
+	return settings
+}
+
+func (s *KVStore) updateChatSettings(chat types.JID, update func(settings *kvChatSettings)) error {
+	s.chatSettingsLock.Lock()
+	defer s.chatSettingsLock.Unlock()
+	key := s.k(chatSettingsBucket, chat.String())
+	var settings kvChatSettings
+	data, err := s.kv.Get(key)
+	if err != nil {
+		return err
+	} else if data != nil {
+		err = json.Unmarshal(data, &settings)
+		if err != nil {
+			return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		}
+	}
+	update(&settings)
+	data, err = json.Marshal(&settings)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(key, data)
+}
+
+func (s *KVStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
+	}
+	return s.updateChatSettings(chat, func(settings *kvChatSettings) {
+		settings.MutedUntil = val
+	})
+}
+
+func (s *KVStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.updateChatSettings(chat, func(settings *kvChatSettings) {
+		settings.Pinned = pinned
+	})
+}
+
+func (s *KVStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.updateChatSettings(chat, func(settings *kvChatSettings) {
+		settings.Archived = archived
+	})
+}
+
+func (s *KVStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var data []byte
+	data, err = s.kv.Get(s.k(chatSettingsBucket, chat.String()))
+	if err != nil || data == nil {
+		return
+	}
+	var stored kvChatSettings
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		err = fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		return
+	}
+	return stored.toSettings(), nil
+}
+
+func msgSecretID(chat, sender types.JID, id types.MessageID) string {
+	return chat.ToNonAD().String() + "/" + sender.ToNonAD().String() + "/" + id
+}
+
+func (s *KVStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	for _, insert := range inserts {
+		err := s.PutMessageSecret(ctx, insert.Chat, insert.Sender, insert.ID, insert.Secret)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	key := s.k(msgSecretsBucket, msgSecretID(chat, sender, id))
+	existing, err := s.kv.Get(key)
+	if err != nil || existing != nil {
+		return err
+	}
+	return s.kv.Put(key, secret)
+}
+
+func (s *KVStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.kv.Get(s.k(msgSecretsBucket, msgSecretID(chat, sender, id)))
+}
+
+func cloneBytes(data []byte) []byte {
+	return append([]byte(nil), data...)
+}
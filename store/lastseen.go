@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// LastSeenUpdater is implemented by containers that can store the LastSeen time of a device
+// without rewriting the rest of the device.
+type LastSeenUpdater interface {
+	// PutLastSeen stores the LastSeen field of the given device, which must already be saved in the container.
+	// Only the ID and LastSeen fields of the device are used.
+	PutLastSeen(ctx context.Context, device *Device) error
+}
+
+// PutLastSeen stores the LastSeen field of the given device in the given container.
+//
+// If the container doesn't implement LastSeenUpdater, the whole device is saved with PutDevice instead.
+func PutLastSeen(ctx context.Context, container DeviceContainer, device *Device) error {
+	if updater, ok := container.(LastSeenUpdater); ok {
+		return updater.PutLastSeen(ctx, device)
+	}
+	return container.PutDevice(ctx, device)
+}
+
+// UpdateLastSeen sets the LastSeen time of the device and stores it in the container of the device.
+// The client calls this automatically after each successful connection.
+//
+//	err := device.UpdateLastSeen(ctx, time.Now())
+func (device *Device) UpdateLastSeen(ctx context.Context, lastSeen time.Time) error {
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	device.LastSeen = lastSeen
+	return PutLastSeen(ctx, device.Container, device)
+}
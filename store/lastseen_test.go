@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+type lastSeenContainer struct {
+	store.Container
+	puts, lastSeenPuts int
+}
+
+func (c *lastSeenContainer) PutDevice(ctx context.Context, device *store.Device) error {
+	c.puts++
+	return c.Container.PutDevice(ctx, device)
+}
+
+func (c *lastSeenContainer) PutLastSeen(ctx context.Context, device *store.Device) error {
+	c.lastSeenPuts++
+	return nil
+}
+
+func TestUpdateLastSeen(t *testing.T) {
+	ctx := context.Background()
+	container := inmemstore.New(nil)
+	device := container.NewDevice()
+	if err := device.UpdateLastSeen(ctx, time.Now()); !errors.Is(err, store.ErrDeviceIDMustBeSet) {
+		t.Errorf("Expected error for unpaired device, got %v", err)
+	}
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	_ = device.Save(ctx)
+
+	// Containers without LastSeenUpdater save the whole device
+	lastSeen := time.Unix(1700000000, 0)
+	if err := device.UpdateLastSeen(ctx, lastSeen); err != nil {
+		t.Fatalf("Failed to update last seen: %v", err)
+	}
+	loaded, _ := container.GetDevice(ctx, jid)
+	if loaded == nil || !loaded.LastSeen.Equal(lastSeen) {
+		t.Errorf("Expected last seen to be saved, got %+v", loaded)
+	}
+}
+
+func TestPutLastSeenWrappers(t *testing.T) {
+	ctx := context.Background()
+	inner := &lastSeenContainer{Container: inmemstore.New(nil)}
+	containers := map[string]store.Container{
+		"cached":  store.NewCachedContainer(inner, 0),
+		"watched": store.NewWatchedContainer(inner),
+		"sharded": store.NewShardedContainer(inner),
+	}
+	jid := types.NewADJID("1234567890", 0, 1)
+	for name, container := range containers {
+		device := container.NewDevice()
+		device.ID = &jid
+		_ = device.Save(ctx)
+		inner.puts, inner.lastSeenPuts = 0, 0
+		if err := device.UpdateLastSeen(ctx, time.Now()); err != nil {
+			t.Errorf("%s: failed to update last seen: %v", name, err)
+		} else if inner.puts != 0 || inner.lastSeenPuts != 1 {
+			t.Errorf("%s: expected only the last seen time to be saved, got %d puts and %d last seen puts", name, inner.puts, inner.lastSeenPuts)
+		}
+	}
+
+	watched := store.NewWatchedContainer(inner)
+	var events []store.ChangeEvent
+	watched.Subscribe(func(evt store.ChangeEvent) {
+		events = append(events, evt)
+	})
+	device := watched.NewDevice()
+	device.ID = &jid
+	if err := store.PutLastSeen(ctx, watched, device); err != nil || len(events) != 1 || events[0].Op != store.ChangePut {
+		t.Errorf("Expected a device change event, got %v (%v)", events, err)
+	}
+}
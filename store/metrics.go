@@ -0,0 +1,502 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// MetricsHook is called after every operation on the stores of an instrumented device.
+//
+// The backend is the name of the container package (e.g. "sqlstore"), and the operation is the name of the
+// store method (e.g. "GetSession"). The error is the one returned by the method, or nil if it succeeded.
+// The hook is called synchronously, so it should return quickly.
+type MetricsHook func(backend, operation string, duration time.Duration, err error)
+
+// storeWrapper is implemented by the instrumented stores created by InstrumentDevice.
+type storeWrapper interface {
+	unwrapStore() interface{}
+}
+
+// UnwrapStore returns the store wrapped by InstrumentDevice, or the given store itself if it's not instrumented.
+func UnwrapStore(s interface{}) interface{} {
+	for {
+		wrapper, ok := s.(storeWrapper)
+		if !ok {
+			return s
+		}
+		s = wrapper.unwrapStore()
+	}
+}
+
+// InstrumentDevice wraps all the stores of the given device so that the hook is called after every operation.
+// The built-in containers call this automatically when their MetricsHook field (or option) is set.
+//
+// Stores that are already instrumented are not wrapped again. Nothing is done if the hook is nil.
+func InstrumentDevice(device *Device, backend string, hook MetricsHook) {
+	if hook == nil {
+		return
+	}
+	m := metered{backend: backend, hook: hook}
+	if _, ok := device.Identities.(*meteredIdentityStore); !ok && device.Identities != nil {
+		device.Identities = &meteredIdentityStore{metered: m, inner: device.Identities}
+	}
+	if _, ok := device.Sessions.(*meteredSessionStore); !ok && device.Sessions != nil {
+		device.Sessions = &meteredSessionStore{metered: m, inner: device.Sessions}
+	}
+	if _, ok := device.PreKeys.(*meteredPreKeyStore); !ok && device.PreKeys != nil {
+		device.PreKeys = &meteredPreKeyStore{metered: m, inner: device.PreKeys}
+	}
+	if _, ok := device.SenderKeys.(*meteredSenderKeyStore); !ok && device.SenderKeys != nil {
+		device.SenderKeys = &meteredSenderKeyStore{metered: m, inner: device.SenderKeys}
+	}
+	if _, ok := device.AppStateKeys.(*meteredAppStateSyncKeyStore); !ok && device.AppStateKeys != nil {
+		device.AppStateKeys = &meteredAppStateSyncKeyStore{metered: m, inner: device.AppStateKeys}
+	}
+	if _, ok := device.AppState.(*meteredAppStateStore); !ok && device.AppState != nil {
+		device.AppState = &meteredAppStateStore{metered: m, inner: device.AppState}
+	}
+	if _, ok := device.Contacts.(*meteredContactStore); !ok && device.Contacts != nil {
+		device.Contacts = &meteredContactStore{metered: m, inner: device.Contacts}
+	}
+	if _, ok := device.ChatSettings.(*meteredChatSettingsStore); !ok && device.ChatSettings != nil {
+		device.ChatSettings = &meteredChatSettingsStore{metered: m, inner: device.ChatSettings}
+	}
+	if _, ok := device.MsgSecrets.(*meteredMsgSecretStore); !ok && device.MsgSecrets != nil {
+		device.MsgSecrets = &meteredMsgSecretStore{metered: m, inner: device.MsgSecrets}
+	}
+	if _, ok := device.Messages.(*meteredMessageStore); !ok && device.Messages != nil {
+		device.Messages = &meteredMessageStore{metered: m, inner: device.Messages}
+	}
+	if _, ok := device.Outbox.(*meteredOutboxStore); !ok && device.Outbox != nil {
+		device.Outbox = &meteredOutboxStore{metered: m, inner: device.Outbox}
+	}
+	if _, ok := device.Schedule.(*meteredScheduleStore); !ok && device.Schedule != nil {
+		device.Schedule = &meteredScheduleStore{metered: m, inner: device.Schedule}
+	}
+	if _, ok := device.Reactions.(*meteredReactionStore); !ok && device.Reactions != nil {
+		device.Reactions = &meteredReactionStore{metered: m, inner: device.Reactions}
+	}
+	if _, ok := device.Polls.(*meteredPollStore); !ok && device.Polls != nil {
+		device.Polls = &meteredPollStore{metered: m, inner: device.Polls}
+	}
+}
+
+type metered struct {
+	backend string
+	hook    MetricsHook
+}
+
+func (m metered) observe(operation string, start time.Time, err *error) {
+	m.hook(m.backend, operation, time.Since(start), *err)
+}
+
+type meteredIdentityStore struct {
+	metered
+	inner IdentityStore
+}
+
+func (s *meteredIdentityStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredIdentityStore) PutIdentity(ctx context.Context, address string, key [32]byte) (err error) {
+	defer s.observe("PutIdentity", time.Now(), &err)
+	return s.inner.PutIdentity(ctx, address, key)
+}
+
+func (s *meteredIdentityStore) DeleteAllIdentities(ctx context.Context, phone string) (err error) {
+	defer s.observe("DeleteAllIdentities", time.Now(), &err)
+	return s.inner.DeleteAllIdentities(ctx, phone)
+}
+
+func (s *meteredIdentityStore) DeleteIdentity(ctx context.Context, address string) (err error) {
+	defer s.observe("DeleteIdentity", time.Now(), &err)
+	return s.inner.DeleteIdentity(ctx, address)
+}
+
+func (s *meteredIdentityStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (trusted bool, err error) {
+	defer s.observe("IsTrustedIdentity", time.Now(), &err)
+	return s.inner.IsTrustedIdentity(ctx, address, key)
+}
+
+type meteredSessionStore struct {
+	metered
+	inner SessionStore
+}
+
+func (s *meteredSessionStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredSessionStore) GetSession(ctx context.Context, address string) (session []byte, err error) {
+	defer s.observe("GetSession", time.Now(), &err)
+	return s.inner.GetSession(ctx, address)
+}
+
+func (s *meteredSessionStore) HasSession(ctx context.Context, address string) (has bool, err error) {
+	defer s.observe("HasSession", time.Now(), &err)
+	return s.inner.HasSession(ctx, address)
+}
+
+func (s *meteredSessionStore) PutSession(ctx context.Context, address string, session []byte) (err error) {
+	defer s.observe("PutSession", time.Now(), &err)
+	return s.inner.PutSession(ctx, address, session)
+}
+
+func (s *meteredSessionStore) DeleteAllSessions(ctx context.Context, phone string) (err error) {
+	defer s.observe("DeleteAllSessions", time.Now(), &err)
+	return s.inner.DeleteAllSessions(ctx, phone)
+}
+
+func (s *meteredSessionStore) DeleteSession(ctx context.Context, address string) (err error) {
+	defer s.observe("DeleteSession", time.Now(), &err)
+	return s.inner.DeleteSession(ctx, address)
+}
+
+// ExportData passes through to the wrapped store, so that Migrate and Device.ExportJSON work on instrumented devices.
+func (s *meteredSessionStore) ExportData(ctx context.Context) (data *ExportedData, err error) {
+	exporter, ok := s.inner.(DataExporter)
+	if !ok {
+		return nil, ErrExportNotSupported
+	}
+	defer s.observe("ExportData", time.Now(), &err)
+	return exporter.ExportData(ctx)
+}
+
+// PruneSessions passes through to the wrapped store, so that Device.PruneSessions works on instrumented devices.
+func (s *meteredSessionStore) PruneSessions(ctx context.Context, before time.Time) (count int, err error) {
+	pruner, ok := s.inner.(SessionPruner)
+	if !ok {
+		return 0, ErrPruneNotSupported
+	}
+	defer s.observe("PruneSessions", time.Now(), &err)
+	return pruner.PruneSessions(ctx, before)
+}
+
+type meteredPreKeyStore struct {
+	metered
+	inner PreKeyStore
+}
+
+func (s *meteredPreKeyStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredPreKeyStore) GetOrGenPreKeys(ctx context.Context, count uint32) (preKeys []*keys.PreKey, err error) {
+	defer s.observe("GetOrGenPreKeys", time.Now(), &err)
+	return s.inner.GetOrGenPreKeys(ctx, count)
+}
+
+func (s *meteredPreKeyStore) GenOnePreKey(ctx context.Context) (preKey *keys.PreKey, err error) {
+	defer s.observe("GenOnePreKey", time.Now(), &err)
+	return s.inner.GenOnePreKey(ctx)
+}
+
+func (s *meteredPreKeyStore) GetPreKey(ctx context.Context, id uint32) (preKey *keys.PreKey, err error) {
+	defer s.observe("GetPreKey", time.Now(), &err)
+	return s.inner.GetPreKey(ctx, id)
+}
+
+func (s *meteredPreKeyStore) RemovePreKey(ctx context.Context, id uint32) (err error) {
+	defer s.observe("RemovePreKey", time.Now(), &err)
+	return s.inner.RemovePreKey(ctx, id)
+}
+
+func (s *meteredPreKeyStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) (err error) {
+	defer s.observe("MarkPreKeysAsUploaded", time.Now(), &err)
+	return s.inner.MarkPreKeysAsUploaded(ctx, upToID)
+}
+
+func (s *meteredPreKeyStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	defer s.observe("UploadedPreKeyCount", time.Now(), &err)
+	return s.inner.UploadedPreKeyCount(ctx)
+}
+
+// ImportPreKeys passes through to the wrapped store, so that Migrate works on instrumented devices.
+func (s *meteredPreKeyStore) ImportPreKeys(ctx context.Context, preKeys []PreKeyEntry) (err error) {
+	importer, ok := s.inner.(PreKeyImporter)
+	if !ok {
+		return ErrPreKeyImportNotSupported
+	}
+	defer s.observe("ImportPreKeys", time.Now(), &err)
+	return importer.ImportPreKeys(ctx, preKeys)
+}
+
+type meteredSenderKeyStore struct {
+	metered
+	inner SenderKeyStore
+}
+
+func (s *meteredSenderKeyStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredSenderKeyStore) PutSenderKey(ctx context.Context, group, user string, session []byte) (err error) {
+	defer s.observe("PutSenderKey", time.Now(), &err)
+	return s.inner.PutSenderKey(ctx, group, user, session)
+}
+
+func (s *meteredSenderKeyStore) GetSenderKey(ctx context.Context, group, user string) (key []byte, err error) {
+	defer s.observe("GetSenderKey", time.Now(), &err)
+	return s.inner.GetSenderKey(ctx, group, user)
+}
+
+type meteredAppStateSyncKeyStore struct {
+	metered
+	inner AppStateSyncKeyStore
+}
+
+func (s *meteredAppStateSyncKeyStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredAppStateSyncKeyStore) PutAppStateSyncKey(ctx context.Context, id []byte, key AppStateSyncKey) (err error) {
+	defer s.observe("PutAppStateSyncKey", time.Now(), &err)
+	return s.inner.PutAppStateSyncKey(ctx, id, key)
+}
+
+func (s *meteredAppStateSyncKeyStore) GetAppStateSyncKey(ctx context.Context, id []byte) (key *AppStateSyncKey, err error) {
+	defer s.observe("GetAppStateSyncKey", time.Now(), &err)
+	return s.inner.GetAppStateSyncKey(ctx, id)
+}
+
+// GetLatestAppStateSyncKeyID passes through to the wrapped store, so that sending app state works on instrumented devices.
+func (s *meteredAppStateSyncKeyStore) GetLatestAppStateSyncKeyID(ctx context.Context) (id []byte, err error) {
+	getter, ok := s.inner.(LatestAppStateSyncKeyGetter)
+	if !ok {
+		return nil, ErrLatestAppStateSyncKeyNotSupported
+	}
+	defer s.observe("GetLatestAppStateSyncKeyID", time.Now(), &err)
+	return getter.GetLatestAppStateSyncKeyID(ctx)
+}
+
+type meteredAppStateStore struct {
+	metered
+	inner AppStateStore
+}
+
+func (s *meteredAppStateStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredAppStateStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) (err error) {
+	defer s.observe("PutAppStateVersion", time.Now(), &err)
+	return s.inner.PutAppStateVersion(ctx, name, version, hash)
+}
+
+func (s *meteredAppStateStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	defer s.observe("GetAppStateVersion", time.Now(), &err)
+	return s.inner.GetAppStateVersion(ctx, name)
+}
+
+func (s *meteredAppStateStore) DeleteAppStateVersion(ctx context.Context, name string) (err error) {
+	defer s.observe("DeleteAppStateVersion", time.Now(), &err)
+	return s.inner.DeleteAppStateVersion(ctx, name)
+}
+
+func (s *meteredAppStateStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []AppStateMutationMAC) (err error) {
+	defer s.observe("PutAppStateMutationMACs", time.Now(), &err)
+	return s.inner.PutAppStateMutationMACs(ctx, name, version, mutations)
+}
+
+func (s *meteredAppStateStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) (err error) {
+	defer s.observe("DeleteAppStateMutationMACs", time.Now(), &err)
+	return s.inner.DeleteAppStateMutationMACs(ctx, name, indexMACs)
+}
+
+func (s *meteredAppStateStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) (valueMAC []byte, err error) {
+	defer s.observe("GetAppStateMutationMAC", time.Now(), &err)
+	return s.inner.GetAppStateMutationMAC(ctx, name, indexMAC)
+}
+
+type meteredContactStore struct {
+	metered
+	inner ContactStore
+}
+
+func (s *meteredContactStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredContactStore) PutPushName(ctx context.Context, user types.JID, pushName string) (changed bool, previousName string, err error) {
+	defer s.observe("PutPushName", time.Now(), &err)
+	return s.inner.PutPushName(ctx, user, pushName)
+}
+
+func (s *meteredContactStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (changed bool, previousName string, err error) {
+	defer s.observe("PutBusinessName", time.Now(), &err)
+	return s.inner.PutBusinessName(ctx, user, businessName)
+}
+
+func (s *meteredContactStore) PutContactName(ctx context.Context, user types.JID, fullName, firstName string) (err error) {
+	defer s.observe("PutContactName", time.Now(), &err)
+	return s.inner.PutContactName(ctx, user, fullName, firstName)
+}
+
+func (s *meteredContactStore) PutAllContactNames(ctx context.Context, contacts []ContactEntry) (err error) {
+	defer s.observe("PutAllContactNames", time.Now(), &err)
+	return s.inner.PutAllContactNames(ctx, contacts)
+}
+
+func (s *meteredContactStore) GetContact(ctx context.Context, user types.JID) (contact types.ContactInfo, err error) {
+	defer s.observe("GetContact", time.Now(), &err)
+	return s.inner.GetContact(ctx, user)
+}
+
+func (s *meteredContactStore) GetAllContacts(ctx context.Context) (contacts map[types.JID]types.ContactInfo, err error) {
+	defer s.observe("GetAllContacts", time.Now(), &err)
+	return s.inner.GetAllContacts(ctx)
+}
+
+type meteredChatSettingsStore struct {
+	metered
+	inner ChatSettingsStore
+}
+
+func (s *meteredChatSettingsStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredChatSettingsStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) (err error) {
+	defer s.observe("PutMutedUntil", time.Now(), &err)
+	return s.inner.PutMutedUntil(ctx, chat, mutedUntil)
+}
+
+func (s *meteredChatSettingsStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) (err error) {
+	defer s.observe("PutPinned", time.Now(), &err)
+	return s.inner.PutPinned(ctx, chat, pinned)
+}
+
+func (s *meteredChatSettingsStore) PutArchived(ctx context.Context, chat types.JID, archived bool) (err error) {
+	defer s.observe("PutArchived", time.Now(), &err)
+	return s.inner.PutArchived(ctx, chat, archived)
+}
+
+func (s *meteredChatSettingsStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	defer s.observe("GetChatSettings", time.Now(), &err)
+	return s.inner.GetChatSettings(ctx, chat)
+}
+
+type meteredMsgSecretStore struct {
+	metered
+	inner MsgSecretStore
+}
+
+func (s *meteredMsgSecretStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredMsgSecretStore) PutMessageSecrets(ctx context.Context, inserts []MessageSecretInsert) (err error) {
+	defer s.observe("PutMessageSecrets", time.Now(), &err)
+	return s.inner.PutMessageSecrets(ctx, inserts)
+}
+
+func (s *meteredMsgSecretStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) (err error) {
+	defer s.observe("PutMessageSecret", time.Now(), &err)
+	return s.inner.PutMessageSecret(ctx, chat, sender, id, secret)
+}
+
+func (s *meteredMsgSecretStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) (secret []byte, err error) {
+	defer s.observe("GetMessageSecret", time.Now(), &err)
+	return s.inner.GetMessageSecret(ctx, chat, sender, id)
+}
+
+type meteredMessageStore struct {
+	metered
+	inner MessageStore
+}
+
+func (s *meteredMessageStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredMessageStore) PutMessage(ctx context.Context, msg *StoredMessage) (err error) {
+	defer s.observe("PutMessage", time.Now(), &err)
+	return s.inner.PutMessage(ctx, msg)
+}
+
+func (s *meteredMessageStore) GetMessage(ctx context.Context, chat, sender types.JID, id types.MessageID) (msg *StoredMessage, err error) {
+	defer s.observe("GetMessage", time.Now(), &err)
+	return s.inner.GetMessage(ctx, chat, sender, id)
+}
+
+func (s *meteredMessageStore) GetMessages(ctx context.Context, query MessageQuery) (messages []*StoredMessage, err error) {
+	defer s.observe("GetMessages", time.Now(), &err)
+	return s.inner.GetMessages(ctx, query)
+}
+
+type meteredOutboxStore struct {
+	metered
+	inner OutboxStore
+}
+
+func (s *meteredOutboxStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredOutboxStore) PutOutboxMessage(ctx context.Context, msg *OutboxMessage) (err error) {
+	defer s.observe("PutOutboxMessage", time.Now(), &err)
+	return s.inner.PutOutboxMessage(ctx, msg)
+}
+
+func (s *meteredOutboxStore) GetOutboxMessages(ctx context.Context) (messages []*OutboxMessage, err error) {
+	defer s.observe("GetOutboxMessages", time.Now(), &err)
+	return s.inner.GetOutboxMessages(ctx)
+}
+
+func (s *meteredOutboxStore) DeleteOutboxMessage(ctx context.Context, id types.MessageID) (err error) {
+	defer s.observe("DeleteOutboxMessage", time.Now(), &err)
+	return s.inner.DeleteOutboxMessage(ctx, id)
+}
+
+type meteredScheduleStore struct {
+	metered
+	inner ScheduleStore
+}
+
+func (s *meteredScheduleStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredScheduleStore) PutScheduledMessage(ctx context.Context, msg *ScheduledMessage) (err error) {
+	defer s.observe("PutScheduledMessage", time.Now(), &err)
+	return s.inner.PutScheduledMessage(ctx, msg)
+}
+
+func (s *meteredScheduleStore) GetDueScheduledMessages(ctx context.Context, now time.Time) (messages []*ScheduledMessage, err error) {
+	defer s.observe("GetDueScheduledMessages", time.Now(), &err)
+	return s.inner.GetDueScheduledMessages(ctx, now)
+}
+
+func (s *meteredScheduleStore) GetNextScheduledTime(ctx context.Context) (next time.Time, err error) {
+	defer s.observe("GetNextScheduledTime", time.Now(), &err)
+	return s.inner.GetNextScheduledTime(ctx)
+}
+
+func (s *meteredScheduleStore) DeleteScheduledMessage(ctx context.Context, id types.MessageID) (err error) {
+	defer s.observe("DeleteScheduledMessage", time.Now(), &err)
+	return s.inner.DeleteScheduledMessage(ctx, id)
+}
+
+type meteredReactionStore struct {
+	metered
+	inner ReactionStore
+}
+
+func (s *meteredReactionStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredReactionStore) PutReaction(ctx context.Context, reaction *MessageReaction) (err error) {
+	defer s.observe("PutReaction", time.Now(), &err)
+	return s.inner.PutReaction(ctx, reaction)
+}
+
+func (s *meteredReactionStore) GetReactions(ctx context.Context, chat types.JID, id types.MessageID) (reactions []*MessageReaction, err error) {
+	defer s.observe("GetReactions", time.Now(), &err)
+	return s.inner.GetReactions(ctx, chat, id)
+}
+
+type meteredPollStore struct {
+	metered
+	inner PollStore
+}
+
+func (s *meteredPollStore) unwrapStore() interface{} { return s.inner }
+
+func (s *meteredPollStore) PutPoll(ctx context.Context, poll *StoredPoll) (err error) {
+	defer s.observe("PutPoll", time.Now(), &err)
+	return s.inner.PutPoll(ctx, poll)
+}
+
+func (s *meteredPollStore) GetPoll(ctx context.Context, chat types.JID, id types.MessageID) (poll *StoredPoll, err error) {
+	defer s.observe("GetPoll", time.Now(), &err)
+	return s.inner.GetPoll(ctx, chat, id)
+}
+
+func (s *meteredPollStore) PutPollVote(ctx context.Context, vote *PollVote) (err error) {
+	defer s.observe("PutPollVote", time.Now(), &err)
+	return s.inner.PutPollVote(ctx, vote)
+}
+
+func (s *meteredPollStore) GetPollVotes(ctx context.Context, chat types.JID, id types.MessageID) (votes []*PollVote, err error) {
+	defer s.observe("GetPollVotes", time.Now(), &err)
+	return s.inner.GetPollVotes(ctx, chat, id)
+}
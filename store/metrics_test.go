@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestMetricsHook(t *testing.T) {
+	ctx := context.Background()
+	var operations []string
+	hook := func(backend, operation string, duration time.Duration, err error) {
+		if backend != "inmemstore" {
+			t.Errorf("Unexpected backend %q", backend)
+		}
+		operations = append(operations, operation)
+	}
+	container := inmemstore.New(nil, inmemstore.WithMetricsHook(hook))
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	_ = device.Save(ctx)
+	// Instrumenting twice must not wrap the stores again
+	store.InstrumentDevice(device, "inmemstore", hook)
+
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	_, _ = device.Sessions.GetSession(ctx, "111:1")
+	_, _ = device.PreKeys.GetOrGenPreKeys(ctx, 1)
+	expected := []string{"PutSession", "GetSession", "GetOrGenPreKeys"}
+	if len(operations) != len(expected) {
+		t.Fatalf("Expected operations %v, got %v", expected, operations)
+	}
+	for i, op := range expected {
+		if operations[i] != op {
+			t.Errorf("Expected operation #%d to be %s, got %s", i, op, operations[i])
+		}
+	}
+
+	if _, err := device.Sessions.(store.DataExporter).ExportData(ctx); err != nil {
+		t.Errorf("Failed to export data through instrumented store: %v", err)
+	}
+}
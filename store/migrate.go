@@ -0,0 +1,252 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// PreKeyEntry is a one-time prekey along with its upload status, used when exporting and importing device data.
+type PreKeyEntry struct {
+	keys.PreKey
+	Uploaded bool
+}
+
+// SenderKeyEntry is a single group sender key, used when exporting device data.
+type SenderKeyEntry struct {
+	Group string
+	User  string
+	Key   []byte
+}
+
+// AppStateSyncKeyEntry is a single app state sync key along with its ID, used when exporting device data.
+type AppStateSyncKeyEntry struct {
+	ID  []byte
+	Key AppStateSyncKey
+}
+
+// AppStateMutationMACEntry is a mutation MAC along with the app state version where it was set,
+// used when exporting device data.
+type AppStateMutationMACEntry struct {
+	AppStateMutationMAC
+	Version uint64
+}
+
+// AppStateEntry contains the version, hash and mutation MACs of a single app state type, used when exporting device data.
+type AppStateEntry struct {
+	Name         string
+	Version      uint64
+	Hash         [128]byte
+	MutationMACs []AppStateMutationMACEntry
+}
+
+// ExportedData contains everything stored for a single device other than the device itself.
+//
+// SessionTimes and LastPreKeyID are only filled by stores that track them (like inmemstore),
+// other stores ignore them when importing.
+type ExportedData struct {
+	Identities       map[string][32]byte
+	Sessions         map[string][]byte
+	SessionTimes     map[string]time.Time
+	PreKeys          []PreKeyEntry
+	LastPreKeyID     uint32
+	SenderKeys       []SenderKeyEntry
+	AppStateSyncKeys []AppStateSyncKeyEntry
+	AppStates        []AppStateEntry
+	Contacts         map[types.JID]types.ContactInfo
+	ChatSettings     map[types.JID]types.LocalChatSettings
+	MessageSecrets   []MessageSecretInsert
+}
+
+// DataExporter is implemented by device stores that can list all of their data.
+//
+// All the stores in the subpackages of this package implement it.
+type DataExporter interface {
+	ExportData(ctx context.Context) (*ExportedData, error)
+}
+
+// PreKeyImporter is implemented by prekey stores that can store existing prekeys.
+// The normal PreKeyStore interface only allows generating new keys.
+type PreKeyImporter interface {
+	ImportPreKeys(ctx context.Context, preKeys []PreKeyEntry) error
+}
+
+// MigrateProgress is passed to the progress callback of Migrate after each device has been copied.
+type MigrateProgress struct {
+	JID   types.JID
+	Done  int
+	Total int
+}
+
+var (
+	// ErrExportNotSupported is returned by Migrate if the stores of a source device don't implement DataExporter.
+	ErrExportNotSupported = errors.New("source store doesn't support exporting data")
+	// ErrPreKeyImportNotSupported is returned by Migrate if the prekey store of a target device doesn't implement PreKeyImporter.
+	ErrPreKeyImportNotSupported = errors.New("target store doesn't support importing prekeys")
+	// ErrDeviceAlreadyExists is returned by Migrate if the target container already contains one of the devices.
+	ErrDeviceAlreadyExists = errors.New("device already exists in target container")
+)
+
+// Migrate copies all devices and their data from one container to another, e.g. to switch from
+// sqlstore to redisstore without having to pair again.
+//
+// The source device stores must implement DataExporter and the target prekey stores must implement
+// PreKeyImporter. Devices that already exist in the target container are not overwritten, an error
+// is returned instead. The progress callback is optional and is called after each device has been copied.
+//
+// Clients using the source container should be disconnected before migrating, as any changes made
+// during the migration may not be included in the target container.
+func Migrate(ctx context.Context, src, dst Container, progress func(MigrateProgress)) error {
+	devices, err := src.GetAllDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get source devices: %w", err)
+	}
+	for i, device := range devices {
+		err = migrateDevice(ctx, device, dst)
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", device.ID, err)
+		}
+		if progress != nil {
+			progress(MigrateProgress{JID: *device.ID, Done: i + 1, Total: len(devices)})
+		}
+	}
+	return nil
+}
+
+func migrateDevice(ctx context.Context, device *Device, dst Container) error {
+	exporter, ok := device.Sessions.(DataExporter)
+	if !ok {
+		return ErrExportNotSupported
+	}
+	existing, err := dst.GetDevice(ctx, *device.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check if device exists: %w", err)
+	} else if existing != nil {
+		return ErrDeviceAlreadyExists
+	}
+	data, err := exporter.ExportData(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export data: %w", err)
+	}
+
+	_, err = saveCopy(ctx, device, data, dst)
+	return err
+}
+
+// saveCopy saves a copy of the given device and its data in the given container.
+// Only the credentials and metadata of the device are used, its stores are ignored.
+func saveCopy(ctx context.Context, device *Device, data *ExportedData, dst Container) (*Device, error) {
+	target := dst.NewDevice()
+	target.NoiseKey = device.NoiseKey
+	target.IdentityKey = device.IdentityKey
+	target.SignedPreKey = device.SignedPreKey
+	target.RegistrationID = device.RegistrationID
+	target.AdvSecretKey = device.AdvSecretKey
+	target.ID = device.ID
+	target.Account = device.Account
+	target.Platform = device.Platform
+	target.BusinessName = device.BusinessName
+	target.PushName = device.PushName
+	target.LastSeen = device.LastSeen
+	err := target.Save(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save device: %w", err)
+	}
+	return target, importData(ctx, target, data)
+}
+
+func importData(ctx context.Context, target *Device, data *ExportedData) error {
+	for address, key := range data.Identities {
+		if err := target.Identities.PutIdentity(ctx, address, key); err != nil {
+			return fmt.Errorf("failed to import identity of %s: %w", address, err)
+		}
+	}
+	for address, session := range data.Sessions {
+		if err := target.Sessions.PutSession(ctx, address, session); err != nil {
+			return fmt.Errorf("failed to import session with %s: %w", address, err)
+		}
+	}
+	if len(data.PreKeys) > 0 {
+		importer, ok := target.PreKeys.(PreKeyImporter)
+		if !ok {
+			return ErrPreKeyImportNotSupported
+		} else if err := importer.ImportPreKeys(ctx, data.PreKeys); err != nil {
+			return fmt.Errorf("failed to import prekeys: %w", err)
+		}
+	}
+	for _, senderKey := range data.SenderKeys {
+		if err := target.SenderKeys.PutSenderKey(ctx, senderKey.Group, senderKey.User, senderKey.Key); err != nil {
+			return fmt.Errorf("failed to import sender key of %s in %s: %w", senderKey.User, senderKey.Group, err)
+		}
+	}
+	for _, syncKey := range data.AppStateSyncKeys {
+		if err := target.AppStateKeys.PutAppStateSyncKey(ctx, syncKey.ID, syncKey.Key); err != nil {
+			return fmt.Errorf("failed to import app state sync key %X: %w", syncKey.ID, err)
+		}
+	}
+	for _, state := range data.AppStates {
+		if err := target.AppState.PutAppStateVersion(ctx, state.Name, state.Version, state.Hash); err != nil {
+			return fmt.Errorf("failed to import app state version of %s: %w", state.Name, err)
+		}
+		// Each MAC must keep the version where it was set, so store them in groups of the same version
+		var versions []uint64
+		macsByVersion := make(map[uint64][]AppStateMutationMAC)
+		for _, mac := range state.MutationMACs {
+			if _, seen := macsByVersion[mac.Version]; !seen {
+				versions = append(versions, mac.Version)
+			}
+			macsByVersion[mac.Version] = append(macsByVersion[mac.Version], mac.AppStateMutationMAC)
+		}
+		for _, version := range versions {
+			if err := target.AppState.PutAppStateMutationMACs(ctx, state.Name, version, macsByVersion[version]); err != nil {
+				return fmt.Errorf("failed to import app state mutation MACs of %s: %w", state.Name, err)
+			}
+		}
+	}
+	contactNames := make([]ContactEntry, 0, len(data.Contacts))
+	for jid, contact := range data.Contacts {
+		if contact.FirstName != "" || contact.FullName != "" {
+			contactNames = append(contactNames, ContactEntry{JID: jid, FirstName: contact.FirstName, FullName: contact.FullName})
+		}
+		if contact.PushName != "" {
+			if _, _, err := target.Contacts.PutPushName(ctx, jid, contact.PushName); err != nil {
+				return fmt.Errorf("failed to import push name of %s: %w", jid, err)
+			}
+		}
+		if contact.BusinessName != "" {
+			if _, _, err := target.Contacts.PutBusinessName(ctx, jid, contact.BusinessName); err != nil {
+				return fmt.Errorf("failed to import business name of %s: %w", jid, err)
+			}
+		}
+	}
+	if len(contactNames) > 0 {
+		if err := target.Contacts.PutAllContactNames(ctx, contactNames); err != nil {
+			return fmt.Errorf("failed to import contact names: %w", err)
+		}
+	}
+	for chat, settings := range data.ChatSettings {
+		var err error
+		if !settings.MutedUntil.IsZero() {
+			err = target.ChatSettings.PutMutedUntil(ctx, chat, settings.MutedUntil)
+		}
+		if err == nil && settings.Pinned {
+			err = target.ChatSettings.PutPinned(ctx, chat, true)
+		}
+		if err == nil && settings.Archived {
+			err = target.ChatSettings.PutArchived(ctx, chat, true)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to import chat settings of %s: %w", chat, err)
+		}
+	}
+	if len(data.MessageSecrets) > 0 {
+		if err := target.MsgSecrets.PutMessageSecrets(ctx, data.MessageSecrets); err != nil {
+			return fmt.Errorf("failed to import message secrets: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/store/kvstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src := inmemstore.New(nil)
+	device := src.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	device.Account = &waProto.ADVSignedDeviceIdentity{Details: []byte("details")}
+	device.PushName = "Tester"
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("failed to save device: %v", err)
+	}
+	alice := types.NewJID("4567", types.DefaultUserServer)
+	_ = device.Sessions.PutSession(ctx, "4567:0", []byte("session"))
+	_ = device.Identities.PutIdentity(ctx, "4567:0", [32]byte{1, 2, 3})
+	_, _ = device.PreKeys.GetOrGenPreKeys(ctx, 3)
+	_, _, _ = device.Contacts.PutPushName(ctx, alice, "Alice")
+	_ = device.AppState.PutAppStateVersion(ctx, "regular", 2, [128]byte{9})
+	_ = device.AppState.PutAppStateMutationMACs(ctx, "regular", 1, []store.AppStateMutationMAC{
+		{IndexMAC: []byte("index1"), ValueMAC: []byte("value1")},
+	})
+	_ = device.AppState.PutAppStateMutationMACs(ctx, "regular", 2, []store.AppStateMutationMAC{
+		{IndexMAC: []byte("index2"), ValueMAC: []byte("value2")},
+	})
+
+	dst := kvstore.New(kvstore.NewMemoryKV(), "", nil)
+	var progress []store.MigrateProgress
+	err := store.Migrate(ctx, src, dst, func(p store.MigrateProgress) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	} else if len(progress) != 1 || progress[0].JID != jid || progress[0].Total != 1 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+	if err = store.Migrate(ctx, src, dst, nil); err == nil {
+		t.Fatal("migrating the same device twice didn't fail")
+	}
+
+	migrated, err := dst.GetDevice(ctx, jid)
+	if err != nil || migrated == nil {
+		t.Fatalf("failed to get migrated device: %v", err)
+	} else if *migrated.IdentityKey.Priv != *device.IdentityKey.Priv || migrated.PushName != "Tester" {
+		t.Fatal("migrated device doesn't match source device")
+	}
+	if sess, _ := migrated.Sessions.GetSession(ctx, "4567:0"); string(sess) != "session" {
+		t.Fatalf("unexpected session %q", sess)
+	}
+	if key, _ := migrated.PreKeys.GetPreKey(ctx, 3); key == nil {
+		t.Fatal("prekey wasn't migrated")
+	}
+	if contact, _ := migrated.Contacts.GetContact(ctx, alice); contact.PushName != "Alice" {
+		t.Fatalf("unexpected contact %+v", contact)
+	}
+	if version, hash, _ := migrated.AppState.GetAppStateVersion(ctx, "regular"); version != 2 || hash[0] != 9 {
+		t.Fatalf("unexpected app state version %d", version)
+	}
+	if value, _ := migrated.AppState.GetAppStateMutationMAC(ctx, "regular", []byte("index1")); !bytes.Equal(value, []byte("value1")) {
+		t.Fatalf("unexpected value MAC %q", value)
+	}
+
+	data, err := migrated.Sessions.(store.DataExporter).ExportData(ctx)
+	if err != nil {
+		t.Fatalf("failed to export migrated data: %v", err)
+	} else if len(data.AppStates) != 1 {
+		t.Fatalf("expected 1 app state, got %d", len(data.AppStates))
+	}
+	versions := make(map[string]uint64)
+	for _, mac := range data.AppStates[0].MutationMACs {
+		versions[string(mac.IndexMAC)] = mac.Version
+	}
+	if versions["index1"] != 1 || versions["index2"] != 2 {
+		t.Fatalf("mutation MAC versions weren't preserved: %v", versions)
+	}
+}
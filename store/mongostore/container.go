@@ -0,0 +1,464 @@
+// Package mongostore contains a MongoDB implementation of the interfaces in the store package.
+//
+// Devices and all of their Signal state are stored as documents in separate collections, which are
+// indexed by the device JID and the natural key of each item (e.g. the session address).
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+const (
+	devicesCollection          = "devices"
+	identitiesCollection       = "identity_keys"
+	sessionsCollection         = "sessions"
+	preKeysCollection          = "pre_keys"
+	senderKeysCollection       = "sender_keys"
+	appStateSyncKeysCollection = "app_state_sync_keys"
+	appStateVersionCollection  = "app_state_version"
+	appStateMACsCollection     = "app_state_mutation_macs"
+	contactsCollection         = "contacts"
+	chatSettingsCollection     = "chat_settings"
+	msgSecretsCollection       = "message_secrets"
+)
+
+// collectionIndexes contains the fields of the unique key of every per-device collection. All of them start
+// with the device JID, so the same index is also used for deleting devices and listing all items of one device.
+var collectionIndexes = map[string][]string{
+	identitiesCollection:       {"our_jid", "their_id"},
+	sessionsCollection:         {"our_jid", "their_id"},
+	preKeysCollection:          {"jid", "key_id"},
+	senderKeysCollection:       {"our_jid", "chat_id", "sender_id"},
+	appStateSyncKeysCollection: {"jid", "key_id"},
+	appStateVersionCollection:  {"jid", "name"},
+	appStateMACsCollection:     {"jid", "name", "index_mac"},
+	contactsCollection:         {"our_jid", "their_jid"},
+	chatSettingsCollection:     {"our_jid", "chat_jid"},
+	msgSecretsCollection:       {"our_jid", "chat_jid", "sender_jid", "message_id"},
+}
+
+// deviceField contains the name of the field that refers to the device in each per-device collection,
+// used for deleting devices. It matches the column names used by sqlstore.
+var deviceField = map[string]string{
+	identitiesCollection:       "our_jid",
+	sessionsCollection:         "our_jid",
+	preKeysCollection:          "jid",
+	senderKeysCollection:       "our_jid",
+	appStateSyncKeysCollection: "jid",
+	appStateVersionCollection:  "jid",
+	appStateMACsCollection:     "jid",
+	contactsCollection:         "our_jid",
+	chatSettingsCollection:     "our_jid",
+	msgSecretsCollection:       "our_jid",
+}
+
+// Container is a wrapper for a MongoDB database that can contain multiple whatsmeow sessions.
+type Container struct {
+	db     *mongo.Database
+	log    waLog.Logger
+	tenant string
+
+	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	ReadOnly bool
+}
+
+var _ store.Container = (*Container)(nil)
+
+// New connects to the MongoDB server at the given URI and wraps the named database in a Container.
+//
+// The required indexes are created automatically.
+//
+// The logger can be nil and will default to a no-op logger.
+//
+//	container, err := mongostore.New(ctx, "mongodb://localhost:27017", "whatsmeow", nil)
+func New(ctx context.Context, uri, database string, log waLog.Logger) (*Container, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	container := NewWithDatabase(client.Database(database), log)
+	err = container.EnsureIndexes(ctx)
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return container, nil
+}
+
+// NewWithDatabase wraps an existing MongoDB database handle in a Container.
+//
+// The indexes are not created automatically, you must call Container.EnsureIndexes yourself.
+//
+// The logger can be nil and will default to a no-op logger.
+func NewWithDatabase(db *mongo.Database, log waLog.Logger) *Container {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Container{
+		db:  db,
+		log: log,
+	}
+}
+
+// WithTenant returns a Container that shares the database handle with this one, but only sees the devices
+// of the given tenant. Devices saved through the returned container are assigned to the tenant.
+//
+// Containers created with New or NewWithDatabase use the empty default tenant. Device JIDs are still unique across
+// the whole database, so saving a device that belongs to another tenant fails with ErrDeviceBelongsToOtherTenant.
+func (c *Container) WithTenant(tenant string) *Container {
+	return &Container{
+		db:     c.db,
+		log:    c.log,
+		tenant: tenant,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
+// tenantFilter returns the filter for device documents of this container's tenant.
+// Documents saved before tenants were supported don't have the field at all and belong to the default tenant.
+func (c *Container) tenantFilter() interface{} {
+	if c.tenant == "" {
+		return bson.M{"$in": bson.A{"", nil}}
+	}
+	return c.tenant
+}
+
+// EnsureIndexes creates the indexes used by the store. Indexes that already exist are left as-is.
+func (c *Container) EnsureIndexes(ctx context.Context) error {
+	_, err := c.db.Collection(devicesCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create index on %s: %w", devicesCollection, err)
+	}
+	for name, fields := range collectionIndexes {
+		index := make(bson.D, len(fields))
+		for i, field := range fields {
+			index[i] = bson.E{Key: field, Value: 1}
+		}
+		_, err := c.db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    index,
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create index on %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Close disconnects the underlying MongoDB client.
+func (c *Container) Close(ctx context.Context) error {
+	return c.db.Client().Disconnect(ctx)
+}
+
+func (c *Container) coll(name string) *mongo.Collection {
+	return c.db.Collection(name)
+}
+
+type mongoDevice struct {
+	JID              string `bson:"_id"`
+	RegistrationID   int64  `bson:"registration_id"`
+	NoiseKey         []byte `bson:"noise_key"`
+	IdentityKey      []byte `bson:"identity_key"`
+	SignedPreKey     []byte `bson:"signed_pre_key"`
+	SignedPreKeyID   int64  `bson:"signed_pre_key_id"`
+	SignedPreKeySig  []byte `bson:"signed_pre_key_sig"`
+	AdvKey           []byte `bson:"adv_key"`
+	AdvDetails       []byte `bson:"adv_details"`
+	AdvAccountSig    []byte `bson:"adv_account_sig"`
+	AdvAccountSigKey []byte `bson:"adv_account_sig_key"`
+	AdvDeviceSig     []byte `bson:"adv_device_sig"`
+	Platform         string `bson:"platform"`
+	BusinessName     string `bson:"business_name"`
+	PushName         string `bson:"push_name"`
+	LastSeen         int64  `bson:"last_seen"`
+	Tenant           string `bson:"tenant"`
+}
+
+func (c *Container) scanDevice(stored *mongoDevice) (*store.Device, error) {
+	jid, err := types.ParseJID(stored.JID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device JID %q: %w", stored.JID, err)
+	} else if len(stored.NoiseKey) != 32 || len(stored.IdentityKey) != 32 || len(stored.SignedPreKey) != 32 || len(stored.SignedPreKeySig) != 64 {
+		return nil, ErrInvalidLength
+	}
+
+	var device store.Device
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	device.Log = c.log
+	device.ID = &jid
+	device.RegistrationID = uint32(stored.RegistrationID)
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.NoiseKey))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.IdentityKey))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(stored.SignedPreKey)),
+		KeyID:     uint32(stored.SignedPreKeyID),
+		Signature: (*[64]byte)(stored.SignedPreKeySig),
+	}
+	device.AdvSecretKey = stored.AdvKey
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             stored.AdvDetails,
+		AccountSignature:    stored.AdvAccountSig,
+		AccountSignatureKey: stored.AdvAccountSigKey,
+		DeviceSignature:     stored.AdvDeviceSig,
+	}
+	device.Platform = stored.Platform
+	device.BusinessName = stored.BusinessName
+	device.PushName = stored.PushName
+	if stored.LastSeen != 0 {
+		device.LastSeen = time.Unix(stored.LastSeen, 0)
+	}
+
+	c.initStores(&device)
+	return &device, nil
+}
+
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewMongoStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	if device.Contacts == nil {
+		device.Contacts = innerStore
+	}
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.Container = c
+	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "mongostore", c.MetricsHook)
+}
+
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	return c.findDevices(ctx, bson.M{"tenant": c.tenantFilter()}, options.Find())
+}
+
+var _ store.DeviceLister = (*Container)(nil)
+
+// ListDevices finds a page of the devices of this container's tenant that match the filter.
+// The filtering and pagination are done in the database, so only the returned devices are loaded.
+func (c *Container) ListDevices(ctx context.Context, offset, limit int, filter store.DeviceFilter) ([]*store.Device, error) {
+	query := bson.M{"tenant": c.tenantFilter()}
+	if filter.PushName != "" {
+		query["push_name"] = bson.M{"$regex": regexp.QuoteMeta(filter.PushName), "$options": "i"}
+	}
+	if filter.Platform != "" {
+		query["platform"] = filter.Platform
+	}
+	lastSeen := bson.M{}
+	if !filter.LastSeenAfter.IsZero() {
+		lastSeen["$gt"] = filter.LastSeenAfter.Unix()
+	}
+	if !filter.LastSeenBefore.IsZero() {
+		// Devices saved before the field was added don't have it at all, $not matches them too
+		lastSeen["$not"] = bson.M{"$gte": filter.LastSeenBefore.Unix()}
+	}
+	if len(lastSeen) > 0 {
+		query["last_seen"] = lastSeen
+	}
+	opts := options.Find()
+	if offset > 0 {
+		opts.SetSkip(int64(offset))
+	}
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return c.findDevices(ctx, query, opts)
+}
+
+func (c *Container) findDevices(ctx context.Context, query bson.M, opts *options.FindOptions) ([]*store.Device, error) {
+	cursor, err := c.coll(devicesCollection).Find(ctx, query, opts.SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	var stored []mongoDevice
+	err = cursor.All(ctx, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	sessions := make([]*store.Device, 0, len(stored))
+	for i := range stored {
+		sess, err := c.scanDevice(&stored[i])
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the database.
+//
+// If the device is not found, nil is returned instead.
+//
+// Note that the parameter usually must be an AD-JID.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	var stored mongoDevice
+	err := c.coll(devicesCollection).FindOne(ctx, bson.M{"_id": jid.String(), "tenant": c.tenantFilter()}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+	return c.scanDevice(&stored)
+}
+
+// NewDevice creates a new device in this database.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	return device
+}
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+// ErrDeviceBelongsToOtherTenant is returned by PutDevice if the device is already stored under a different tenant.
+var ErrDeviceBelongsToOtherTenant = errors.New("device is already stored under a different tenant")
+
+// ErrInvalidLength is returned by some database getters if the database returned a byte array with an unexpected length.
+var ErrInvalidLength = errors.New("database returned byte array with illegal length")
+
+// PutDevice stores the given device in this database. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	stored := &mongoDevice{
+		JID:              device.ID.String(),
+		RegistrationID:   int64(device.RegistrationID),
+		NoiseKey:         device.NoiseKey.Priv[:],
+		IdentityKey:      device.IdentityKey.Priv[:],
+		SignedPreKey:     device.SignedPreKey.Priv[:],
+		SignedPreKeyID:   int64(device.SignedPreKey.KeyID),
+		SignedPreKeySig:  device.SignedPreKey.Signature[:],
+		AdvKey:           device.AdvSecretKey,
+		AdvDetails:       device.Account.Details,
+		AdvAccountSig:    device.Account.AccountSignature,
+		AdvAccountSigKey: device.Account.AccountSignatureKey,
+		AdvDeviceSig:     device.Account.DeviceSignature,
+		Platform:         device.Platform,
+		BusinessName:     device.BusinessName,
+		PushName:         device.PushName,
+		LastSeen:         lastSeen,
+		Tenant:           c.tenant,
+	}
+	filter := bson.M{"_id": stored.JID, "tenant": c.tenantFilter()}
+	_, err := c.coll(devicesCollection).ReplaceOne(ctx, filter, stored, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The filter didn't match, so the upsert tried to insert a second document with the same ID
+		return ErrDeviceBelongsToOtherTenant
+	}
+
+	if !device.Initialized {
+		c.initStores(device)
+	}
+	return err
+}
+
+// PutLastSeen stores only the last seen time of the given device, which is cheaper than saving the whole device.
+func (c *Container) PutLastSeen(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutLastSeen"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	filter := bson.M{"_id": device.ID.String(), "tenant": c.tenantFilter()}
+	_, err := c.coll(devicesCollection).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_seen": lastSeen}})
+	return err
+}
+
+// DeleteDevice deletes the given device and all of its data from this database. This should be called through Device.Delete()
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	jid := device.ID.String()
+	res, err := c.coll(devicesCollection).DeleteOne(ctx, bson.M{"_id": jid, "tenant": c.tenantFilter()})
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		// Don't touch the data if the device belongs to another tenant
+		otherTenants, err := c.coll(devicesCollection).CountDocuments(ctx, bson.M{"_id": jid})
+		if err != nil {
+			return err
+		} else if otherTenants > 0 {
+			return nil
+		}
+	}
+	// MongoDB doesn't have foreign keys, so the data in other collections has to be deleted manually
+	for name, field := range deviceField {
+		_, err = c.coll(name).DeleteMany(ctx, bson.M{field: jid})
+		if err != nil {
+			return fmt.Errorf("failed to delete device data from %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package mongostore
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.DataExporter = (*MongoStore)(nil)
+var _ store.PreKeyImporter = (*MongoStore)(nil)
+
+// findAll decodes all the documents of this device in the given collection into the given slice pointer.
+func (s *MongoStore) findAll(ctx context.Context, collection string, into interface{}) error {
+	cursor, err := s.coll(collection).Find(ctx, bson.M{deviceField[collection]: s.JID})
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, into)
+}
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *MongoStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	data := &store.ExportedData{
+		Identities:   make(map[string][32]byte),
+		Sessions:     make(map[string][]byte),
+		Contacts:     make(map[types.JID]types.ContactInfo),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+
+	var identities []mongoIdentity
+	err := s.findAll(ctx, identitiesCollection, &identities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export identities: %w", err)
+	}
+	for _, identity := range identities {
+		if len(identity.Identity) != 32 {
+			return nil, ErrInvalidLength
+		}
+		data.Identities[identity.TheirID] = *(*[32]byte)(identity.Identity)
+	}
+
+	var sessions []mongoSession
+	err = s.findAll(ctx, sessionsCollection, &sessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	for _, sess := range sessions {
+		data.Sessions[sess.TheirID] = sess.Session
+	}
+
+	var preKeys []mongoPreKey
+	err = s.findAll(ctx, preKeysCollection, &preKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export prekeys: %w", err)
+	}
+	for i := range preKeys {
+		key, err := preKeys[i].toPreKey()
+		if err != nil {
+			return nil, err
+		}
+		data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *key, Uploaded: preKeys[i].Uploaded})
+	}
+
+	var senderKeys []mongoSenderKey
+	err = s.findAll(ctx, senderKeysCollection, &senderKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sender keys: %w", err)
+	}
+	for _, senderKey := range senderKeys {
+		data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{
+			Group: senderKey.ChatID,
+			User:  senderKey.SenderID,
+			Key:   senderKey.SenderKey,
+		})
+	}
+
+	var syncKeys []mongoAppStateSyncKey
+	err = s.findAll(ctx, appStateSyncKeysCollection, &syncKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state sync keys: %w", err)
+	}
+	for _, key := range syncKeys {
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, store.AppStateSyncKeyEntry{
+			ID:  key.KeyID,
+			Key: store.AppStateSyncKey{Data: key.KeyData, Timestamp: key.Timestamp, Fingerprint: key.Fingerprint},
+		})
+	}
+
+	var versions []mongoAppStateVersion
+	err = s.findAll(ctx, appStateVersionCollection, &versions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state: %w", err)
+	}
+	var macs []mongoMutationMAC
+	err = s.findAll(ctx, appStateMACsCollection, &macs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state mutation MACs: %w", err)
+	}
+	macsByName := make(map[string][]store.AppStateMutationMACEntry)
+	for _, mac := range macs {
+		macsByName[mac.Name] = append(macsByName[mac.Name], store.AppStateMutationMACEntry{
+			AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: mac.IndexMAC, ValueMAC: mac.ValueMAC},
+			Version:             uint64(mac.Version),
+		})
+	}
+	for _, version := range versions {
+		if len(version.Hash) != 128 {
+			return nil, ErrInvalidLength
+		}
+		data.AppStates = append(data.AppStates, store.AppStateEntry{
+			Name:         version.Name,
+			Version:      uint64(version.Version),
+			Hash:         *(*[128]byte)(version.Hash),
+			MutationMACs: macsByName[version.Name],
+		})
+	}
+
+	var contacts []mongoContact
+	err = s.findAll(ctx, contactsCollection, &contacts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export contacts: %w", err)
+	}
+	for i := range contacts {
+		jid, err := types.ParseJID(contacts[i].TheirJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact JID %q: %w", contacts[i].TheirJID, err)
+		}
+		data.Contacts[jid] = contacts[i].toInfo()
+	}
+
+	var chatSettings []mongoChatSettings
+	err = s.findAll(ctx, chatSettingsCollection, &chatSettings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export chat settings: %w", err)
+	}
+	for i := range chatSettings {
+		chat, err := types.ParseJID(chatSettings[i].ChatJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chat JID %q: %w", chatSettings[i].ChatJID, err)
+		}
+		data.ChatSettings[chat] = chatSettings[i].toSettings()
+	}
+
+	var secrets []mongoMsgSecret
+	err = s.findAll(ctx, msgSecretsCollection, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export message secrets: %w", err)
+	}
+	for _, secret := range secrets {
+		entry := store.MessageSecretInsert{ID: secret.MessageID, Secret: secret.Key}
+		entry.Chat, err = types.ParseJID(secret.ChatJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chat JID %q: %w", secret.ChatJID, err)
+		}
+		entry.Sender, err = types.ParseJID(secret.SenderJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sender JID %q: %w", secret.SenderJID, err)
+		}
+		data.MessageSecrets = append(data.MessageSecrets, entry)
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *MongoStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	if len(preKeys) == 0 {
+		return nil
+	}
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	models := make([]mongo.WriteModel, len(preKeys))
+	for i, preKey := range preKeys {
+		key := preKey.PreKey
+		doc := s.preKeyDocument(&key, preKey.Uploaded)
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"jid": s.JID, "key_id": doc["key_id"]}).
+			SetReplacement(doc).
+			SetUpsert(true)
+	}
+	_, err := s.coll(preKeysCollection).BulkWrite(ctx, models)
+	return err
+}
@@ -0,0 +1,597 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+type MongoStore struct {
+	*Container
+	JID string
+
+	preKeyLock sync.Mutex
+
+	contactLock sync.Mutex
+}
+
+// NewMongoStore creates a new MongoStore with the given container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewMongoStore(c *Container, jid types.JID) *MongoStore {
+	return &MongoStore{
+		Container: c,
+		JID:       jid.String(),
+	}
+}
+
+var _ store.IdentityStore = (*MongoStore)(nil)
+var _ store.SessionStore = (*MongoStore)(nil)
+var _ store.PreKeyStore = (*MongoStore)(nil)
+var _ store.SenderKeyStore = (*MongoStore)(nil)
+var _ store.AppStateSyncKeyStore = (*MongoStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*MongoStore)(nil)
+var _ store.AppStateStore = (*MongoStore)(nil)
+var _ store.ContactStore = (*MongoStore)(nil)
+var _ store.ChatSettingsStore = (*MongoStore)(nil)
+var _ store.MsgSecretStore = (*MongoStore)(nil)
+
+// upsert sets the given fields in the document matching the filter, creating the document if it doesn't exist.
+func (s *MongoStore) upsert(ctx context.Context, collection string, filter, set bson.M) error {
+	_, err := s.coll(collection).UpdateOne(ctx, filter, bson.M{"$set": set}, options.Update().SetUpsert(true))
+	return err
+}
+
+// findOne decodes the document matching the filter into the given value.
+// If there's no such document, found is false and the error is nil.
+func (s *MongoStore) findOne(ctx context.Context, collection string, filter bson.M, into interface{}) (found bool, err error) {
+	err = s.coll(collection).FindOne(ctx, filter).Decode(into)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type mongoIdentity struct {
+	TheirID  string `bson:"their_id"`
+	Identity []byte `bson:"identity"`
+}
+
+func (s *MongoStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.upsert(ctx, identitiesCollection, bson.M{"our_jid": s.JID, "their_id": address}, bson.M{"identity": key[:]})
+}
+
+func (s *MongoStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	_, err := s.coll(identitiesCollection).DeleteMany(ctx, bson.M{"our_jid": s.JID, "their_id": addressPrefixFilter(phone)})
+	return err
+}
+
+func (s *MongoStore) DeleteIdentity(ctx context.Context, address string) error {
+	_, err := s.coll(identitiesCollection).DeleteOne(ctx, bson.M{"our_jid": s.JID, "their_id": address})
+	return err
+}
+
+func (s *MongoStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	var existing mongoIdentity
+	found, err := s.findOne(ctx, identitiesCollection, bson.M{"our_jid": s.JID, "their_id": address}, &existing)
+	if err != nil {
+		return false, err
+	} else if !found {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	} else if len(existing.Identity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existing.Identity) == key, nil
+}
+
+// addressPrefixFilter returns a filter that matches all Signal addresses of the given phone number.
+func addressPrefixFilter(phone string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(phone) + ":"}
+}
+
+type mongoSession struct {
+	TheirID string `bson:"their_id"`
+	Session []byte `bson:"session"`
+}
+
+func (s *MongoStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	var sess mongoSession
+	found, err := s.findOne(ctx, sessionsCollection, bson.M{"our_jid": s.JID, "their_id": address}, &sess)
+	if err != nil || !found {
+		return nil, err
+	}
+	return sess.Session, nil
+}
+
+func (s *MongoStore) HasSession(ctx context.Context, address string) (bool, error) {
+	count, err := s.coll(sessionsCollection).CountDocuments(ctx, bson.M{"our_jid": s.JID, "their_id": address}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+func (s *MongoStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.upsert(ctx, sessionsCollection, bson.M{"our_jid": s.JID, "their_id": address}, bson.M{"session": session})
+}
+
+func (s *MongoStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	_, err := s.coll(sessionsCollection).DeleteMany(ctx, bson.M{"our_jid": s.JID, "their_id": addressPrefixFilter(phone)})
+	return err
+}
+
+func (s *MongoStore) DeleteSession(ctx context.Context, address string) error {
+	_, err := s.coll(sessionsCollection).DeleteOne(ctx, bson.M{"our_jid": s.JID, "their_id": address})
+	return err
+}
+
+type mongoPreKey struct {
+	KeyID    int64  `bson:"key_id"`
+	Key      []byte `bson:"key"`
+	Uploaded bool   `bson:"uploaded"`
+}
+
+func (mpk *mongoPreKey) toPreKey() (*keys.PreKey, error) {
+	if len(mpk.Key) != 32 {
+		return nil, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(mpk.Key)),
+		KeyID:   uint32(mpk.KeyID),
+	}, nil
+}
+
+func (s *MongoStore) preKeyDocument(key *keys.PreKey, uploaded bool) bson.M {
+	return bson.M{"jid": s.JID, "key_id": int64(key.KeyID), "key": key.Priv[:], "uploaded": uploaded}
+}
+
+func (s *MongoStore) getNextPreKeyID(ctx context.Context) (uint32, error) {
+	var last mongoPreKey
+	opts := options.FindOne().SetSort(bson.D{{Key: "key_id", Value: -1}})
+	err := s.coll(preKeysCollection).FindOne(ctx, bson.M{"jid": s.JID}, opts).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to query next prekey ID: %w", err)
+	}
+	return uint32(last.KeyID) + 1, nil
+}
+
+func (s *MongoStore) genPreKeys(ctx context.Context, count uint32, markUploaded bool) ([]*keys.PreKey, error) {
+	nextKeyID, err := s.getNextPreKeyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newKeys := make([]*keys.PreKey, count)
+	docs := make([]interface{}, count)
+	for i := range newKeys {
+		newKeys[i] = keys.NewPreKey(nextKeyID + uint32(i))
+		docs[i] = s.preKeyDocument(newKeys[i], markUploaded)
+	}
+	_, err = s.coll(preKeysCollection).InsertMany(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys, nil
+}
+
+func (s *MongoStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	newKeys, err := s.genPreKeys(ctx, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys[0], nil
+}
+
+func (s *MongoStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	opts := options.Find().SetSort(bson.D{{Key: "key_id", Value: 1}}).SetLimit(int64(count))
+	cursor, err := s.coll(preKeysCollection).Find(ctx, bson.M{"jid": s.JID, "uploaded": false}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing prekeys: %w", err)
+	}
+	var existing []mongoPreKey
+	err = cursor.All(ctx, &existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing prekeys: %w", err)
+	}
+	newKeys := make([]*keys.PreKey, 0, count)
+	for i := range existing {
+		key, err := existing[i].toPreKey()
+		if err != nil {
+			return nil, err
+		}
+		newKeys = append(newKeys, key)
+	}
+
+	if missing := count - uint32(len(newKeys)); missing > 0 {
+		var generated []*keys.PreKey
+		generated, err = s.genPreKeys(ctx, missing, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate prekeys: %w", err)
+		}
+		newKeys = append(newKeys, generated...)
+	}
+	return newKeys, nil
+}
+
+func (s *MongoStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	var stored mongoPreKey
+	found, err := s.findOne(ctx, preKeysCollection, bson.M{"jid": s.JID, "key_id": int64(id)}, &stored)
+	if err != nil || !found {
+		return nil, err
+	}
+	return stored.toPreKey()
+}
+
+func (s *MongoStore) RemovePreKey(ctx context.Context, id uint32) error {
+	_, err := s.coll(preKeysCollection).DeleteOne(ctx, bson.M{"jid": s.JID, "key_id": int64(id)})
+	return err
+}
+
+func (s *MongoStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	_, err := s.coll(preKeysCollection).UpdateMany(
+		ctx,
+		bson.M{"jid": s.JID, "key_id": bson.M{"$lte": int64(upToID)}},
+		bson.M{"$set": bson.M{"uploaded": true}},
+	)
+	return err
+}
+
+func (s *MongoStore) UploadedPreKeyCount(ctx context.Context) (int, error) {
+	count, err := s.coll(preKeysCollection).CountDocuments(ctx, bson.M{"jid": s.JID, "uploaded": true})
+	return int(count), err
+}
+
+type mongoSenderKey struct {
+	ChatID    string `bson:"chat_id"`
+	SenderID  string `bson:"sender_id"`
+	SenderKey []byte `bson:"sender_key"`
+}
+
+func (s *MongoStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.upsert(ctx, senderKeysCollection, bson.M{"our_jid": s.JID, "chat_id": group, "sender_id": user}, bson.M{"sender_key": session})
+}
+
+func (s *MongoStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	var stored mongoSenderKey
+	found, err := s.findOne(ctx, senderKeysCollection, bson.M{"our_jid": s.JID, "chat_id": group, "sender_id": user}, &stored)
+	if err != nil || !found {
+		return nil, err
+	}
+	return stored.SenderKey, nil
+}
+
+type mongoAppStateSyncKey struct {
+	KeyID       []byte `bson:"key_id"`
+	KeyData     []byte `bson:"key_data"`
+	Timestamp   int64  `bson:"timestamp"`
+	Fingerprint []byte `bson:"fingerprint"`
+}
+
+func (s *MongoStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	return s.upsert(ctx, appStateSyncKeysCollection, bson.M{"jid": s.JID, "key_id": id}, bson.M{
+		"key_data":    key.Data,
+		"timestamp":   key.Timestamp,
+		"fingerprint": key.Fingerprint,
+	})
+}
+
+func (s *MongoStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	var stored mongoAppStateSyncKey
+	found, err := s.findOne(ctx, appStateSyncKeysCollection, bson.M{"jid": s.JID, "key_id": id}, &stored)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &store.AppStateSyncKey{Data: stored.KeyData, Timestamp: stored.Timestamp, Fingerprint: stored.Fingerprint}, nil
+}
+
+func (s *MongoStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	var stored mongoAppStateSyncKey
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	err := s.coll(appStateSyncKeysCollection).FindOne(ctx, bson.M{"jid": s.JID}, opts).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return stored.KeyID, nil
+}
+
+type mongoAppStateVersion struct {
+	Name    string `bson:"name"`
+	Version int64  `bson:"version"`
+	Hash    []byte `bson:"hash"`
+}
+
+func (s *MongoStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	return s.upsert(ctx, appStateVersionCollection, bson.M{"jid": s.JID, "name": name}, bson.M{
+		"version": int64(version),
+		"hash":    hash[:],
+	})
+}
+
+func (s *MongoStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var stored mongoAppStateVersion
+	var found bool
+	found, err = s.findOne(ctx, appStateVersionCollection, bson.M{"jid": s.JID, "name": name}, &stored)
+	if err != nil || !found {
+		// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+		return
+	} else if len(stored.Hash) != 128 {
+		err = ErrInvalidLength
+		return
+	}
+	version = uint64(stored.Version)
+	hash = *(*[128]byte)(stored.Hash)
+	return
+}
+
+func (s *MongoStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	_, err := s.coll(appStateVersionCollection).DeleteOne(ctx, bson.M{"jid": s.JID, "name": name})
+	if err != nil {
+		return err
+	}
+	// sqlstore removes the mutation MACs through a foreign key, so do the same manually here
+	_, err = s.coll(appStateMACsCollection).DeleteMany(ctx, bson.M{"jid": s.JID, "name": name})
+	return err
+}
+
+type mongoMutationMAC struct {
+	Name     string `bson:"name"`
+	Version  int64  `bson:"version"`
+	IndexMAC []byte `bson:"index_mac"`
+	ValueMAC []byte `bson:"value_mac"`
+}
+
+func (s *MongoStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(mutations))
+	for i, mutation := range mutations {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"jid": s.JID, "name": name, "index_mac": mutation.IndexMAC}).
+			SetUpdate(bson.M{"$set": bson.M{"version": int64(version), "value_mac": mutation.ValueMAC}}).
+			SetUpsert(true)
+	}
+	_, err := s.coll(appStateMACsCollection).BulkWrite(ctx, models)
+	return err
+}
+
+func (s *MongoStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	if len(indexMACs) == 0 {
+		return nil
+	}
+	_, err := s.coll(appStateMACsCollection).DeleteMany(ctx, bson.M{"jid": s.JID, "name": name, "index_mac": bson.M{"$in": indexMACs}})
+	return err
+}
+
+func (s *MongoStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	var stored mongoMutationMAC
+	found, err := s.findOne(ctx, appStateMACsCollection, bson.M{"jid": s.JID, "name": name, "index_mac": indexMAC}, &stored)
+	if err != nil || !found {
+		return nil, err
+	}
+	return stored.ValueMAC, nil
+}
+
+type mongoContact struct {
+	TheirJID     string `bson:"their_jid"`
+	FirstName    string `bson:"first_name"`
+	FullName     string `bson:"full_name"`
+	PushName     string `bson:"push_name"`
+	BusinessName string `bson:"business_name"`
+}
+
+func (mc *mongoContact) toInfo() types.ContactInfo {
+	return types.ContactInfo{
+		Found:        true,
+		FirstName:    mc.FirstName,
+		FullName:     mc.FullName,
+		PushName:     mc.PushName,
+		BusinessName: mc.BusinessName,
+	}
+}
+
+func (s *MongoStore) contactFilter(user types.JID) bson.M {
+	return bson.M{"our_jid": s.JID, "their_jid": user.String()}
+}
+
+func (s *MongoStore) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	s.contactLock.Lock()
+	defer s.contactLock.Unlock()
+
+	var existing mongoContact
+	_, err := s.findOne(ctx, contactsCollection, s.contactFilter(user), &existing)
+	if err != nil {
+		return false, "", err
+	} else if existing.PushName == pushName {
+		return false, "", nil
+	}
+	err = s.upsert(ctx, contactsCollection, s.contactFilter(user), bson.M{"push_name": pushName})
+	if err != nil {
+		return false, "", err
+	}
+	return true, existing.PushName, nil
+}
+
+func (s *MongoStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (bool, string, error) {
+	s.contactLock.Lock()
+	defer s.contactLock.Unlock()
+
+	var existing mongoContact
+	_, err := s.findOne(ctx, contactsCollection, s.contactFilter(user), &existing)
+	if err != nil {
+		return false, "", err
+	} else if existing.BusinessName == businessName {
+		return false, "", nil
+	}
+	err = s.upsert(ctx, contactsCollection, s.contactFilter(user), bson.M{"business_name": businessName})
+	if err != nil {
+		return false, "", err
+	}
+	return true, existing.BusinessName, nil
+}
+
+func (s *MongoStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	return s.upsert(ctx, contactsCollection, s.contactFilter(user), bson.M{"first_name": firstName, "full_name": fullName})
+}
+
+func (s *MongoStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	models := make([]mongo.WriteModel, 0, len(contacts))
+	for _, contact := range contacts {
+		if contact.JID.IsEmpty() {
+			s.log.Warnf("Empty contact info in mass insert: %+v", contact)
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(s.contactFilter(contact.JID)).
+			SetUpdate(bson.M{"$set": bson.M{"first_name": contact.FirstName, "full_name": contact.FullName}}).
+			SetUpsert(true))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := s.coll(contactsCollection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	var stored mongoContact
+	found, err := s.findOne(ctx, contactsCollection, s.contactFilter(user), &stored)
+	if err != nil || !found {
+		return types.ContactInfo{}, err
+	}
+	return stored.toInfo(), nil
+}
+
+func (s *MongoStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	cursor, err := s.coll(contactsCollection).Find(ctx, bson.M{"our_jid": s.JID})
+	if err != nil {
+		return nil, err
+	}
+	var stored []mongoContact
+	err = cursor.All(ctx, &stored)
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[types.JID]types.ContactInfo, len(stored))
+	for i := range stored {
+		jid, err := types.ParseJID(stored[i].TheirJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact JID %q: %w", stored[i].TheirJID, err)
+		}
+		output[jid] = stored[i].toInfo()
+	}
+	return output, nil
+}
+
+type mongoChatSettings struct {
+	ChatJID    string `bson:"chat_jid"`
+	MutedUntil int64  `bson:"muted_until"`
+	Pinned     bool   `bson:"pinned"`
+	Archived   bool   `bson:"archived"`
+}
+
+func (mcs *mongoChatSettings) toSettings() types.LocalChatSettings {
+	settings := types.LocalChatSettings{Found: true, Pinned: mcs.Pinned, Archived: mcs.Archived}
+	if mcs.MutedUntil != 0 {
+		settings.MutedUntil = time.Unix(mcs.MutedUntil, 0)
+	}
+	return settings
+}
+
+func (s *MongoStore) putChatSetting(ctx context.Context, chat types.JID, field string, value interface{}) error {
+	return s.upsert(ctx, chatSettingsCollection, bson.M{"our_jid": s.JID, "chat_jid": chat.String()}, bson.M{field: value})
+}
+
+func (s *MongoStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
+	}
+	return s.putChatSetting(ctx, chat, "muted_until", val)
+}
+
+func (s *MongoStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.putChatSetting(ctx, chat, "pinned", pinned)
+}
+
+func (s *MongoStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.putChatSetting(ctx, chat, "archived", archived)
+}
+
+func (s *MongoStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var stored mongoChatSettings
+	var found bool
+	found, err = s.findOne(ctx, chatSettingsCollection, bson.M{"our_jid": s.JID, "chat_jid": chat.String()}, &stored)
+	if err != nil || !found {
+		return
+	}
+	return stored.toSettings(), nil
+}
+
+type mongoMsgSecret struct {
+	ChatJID   string `bson:"chat_jid"`
+	SenderJID string `bson:"sender_jid"`
+	MessageID string `bson:"message_id"`
+	Key       []byte `bson:"key"`
+}
+
+func (s *MongoStore) msgSecretFilter(chat, sender types.JID, id types.MessageID) bson.M {
+	return bson.M{"our_jid": s.JID, "chat_jid": chat.ToNonAD().String(), "sender_jid": sender.ToNonAD().String(), "message_id": id}
+}
+
+func (s *MongoStore) msgSecretModel(chat, sender types.JID, id types.MessageID, secret []byte) mongo.WriteModel {
+	// Existing secrets are never overwritten, same as ON CONFLICT DO NOTHING in sqlstore
+	return mongo.NewUpdateOneModel().
+		SetFilter(s.msgSecretFilter(chat, sender, id)).
+		SetUpdate(bson.M{"$setOnInsert": bson.M{"key": secret}}).
+		SetUpsert(true)
+}
+
+func (s *MongoStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	if len(inserts) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(inserts))
+	for i, insert := range inserts {
+		models[i] = s.msgSecretModel(insert.Chat, insert.Sender, insert.ID, insert.Secret)
+	}
+	_, err := s.coll(msgSecretsCollection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	_, err := s.coll(msgSecretsCollection).UpdateOne(
+		ctx,
+		s.msgSecretFilter(chat, sender, id),
+		bson.M{"$setOnInsert": bson.M{"key": secret}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	var stored mongoMsgSecret
+	found, err := s.findOne(ctx, msgSecretsCollection, s.msgSecretFilter(chat, sender, id), &stored)
+	if err != nil || !found {
+		return nil, err
+	}
+	return stored.Key, nil
+}
@@ -0,0 +1,23 @@
+module github.com/insomnius/whatsmeow/store/pgstore
+
+go 1.18
+
+require (
+	github.com/insomnius/whatsmeow v0.0.0
+	github.com/jackc/pgx/v5 v5.2.0
+)
+
+require (
+	filippo.io/edwards25519 v1.0.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20200714003250-2b9c44734f2b // indirect
+	github.com/jackc/puddle/v2 v2.1.2 // indirect
+	go.mau.fi/libsignal v0.0.0-20221015105917-d970e7c3c9cf // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	golang.org/x/crypto v0.0.0-20221012134737-56aed061732a // indirect
+	golang.org/x/sync v0.0.0-20220923202941-7f9b1623fab7 // indirect
+	golang.org/x/text v0.3.8 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+replace github.com/insomnius/whatsmeow => ../..
@@ -0,0 +1,662 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// preKeyLockNamespace is the first key of the two-key advisory lock held while generating prekeys.
+// The second key is the hash of the device JID, so different devices don't block each other.
+const preKeyLockNamespace = 0x776d706b // "wmpk"
+
+type PGStore struct {
+	*Container
+	JID string
+
+	preKeyLock sync.Mutex
+
+	contactCache     map[types.JID]*types.ContactInfo
+	contactCacheLock sync.Mutex
+}
+
+// NewPGStore creates a new PGStore with the given database container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewPGStore(c *Container, jid types.JID) *PGStore {
+	return &PGStore{
+		Container:    c,
+		JID:          jid.String(),
+		contactCache: make(map[types.JID]*types.ContactInfo),
+	}
+}
+
+var _ store.IdentityStore = (*PGStore)(nil)
+var _ store.SessionStore = (*PGStore)(nil)
+var _ store.PreKeyStore = (*PGStore)(nil)
+var _ store.SenderKeyStore = (*PGStore)(nil)
+var _ store.AppStateSyncKeyStore = (*PGStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*PGStore)(nil)
+var _ store.AppStateStore = (*PGStore)(nil)
+var _ store.ContactStore = (*PGStore)(nil)
+var _ store.ChatSettingsStore = (*PGStore)(nil)
+var _ store.MsgSecretStore = (*PGStore)(nil)
+var _ store.SessionPruner = (*PGStore)(nil)
+
+// queryBytes runs a query returning a single bytea column and returns nil if there are no rows.
+func (s *PGStore) queryBytes(ctx context.Context, query string, args ...interface{}) (data []byte, err error) {
+	err = s.db.QueryRow(ctx, query, args...).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+	}
+	return
+}
+
+func (s *PGStore) exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := s.db.Exec(ctx, query, args...)
+	return err
+}
+
+const (
+	putIdentityQuery = `
+		INSERT INTO whatsmeow_identity_keys (our_jid, their_id, identity) VALUES ($1, $2, $3)
+		ON CONFLICT (our_jid, their_id) DO UPDATE SET identity=excluded.identity
+	`
+	deleteAllIdentitiesQuery = `DELETE FROM whatsmeow_identity_keys WHERE our_jid=$1 AND their_id LIKE $2`
+	deleteIdentityQuery      = `DELETE FROM whatsmeow_identity_keys WHERE our_jid=$1 AND their_id=$2`
+	getIdentityQuery         = `SELECT identity FROM whatsmeow_identity_keys WHERE our_jid=$1 AND their_id=$2`
+)
+
+func (s *PGStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.exec(ctx, putIdentityQuery, s.JID, address, key[:])
+}
+
+func (s *PGStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.exec(ctx, deleteAllIdentitiesQuery, s.JID, phone+":%")
+}
+
+func (s *PGStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.exec(ctx, deleteIdentityQuery, s.JID, address)
+}
+
+func (s *PGStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existingIdentity, err := s.queryBytes(ctx, getIdentityQuery, s.JID, address)
+	if err != nil {
+		return false, err
+	} else if existingIdentity == nil {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	} else if len(existingIdentity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existingIdentity) == key, nil
+}
+
+const (
+	getSessionQuery = `SELECT session FROM whatsmeow_sessions WHERE our_jid=$1 AND their_id=$2`
+	hasSessionQuery = `SELECT EXISTS(SELECT 1 FROM whatsmeow_sessions WHERE our_jid=$1 AND their_id=$2)`
+	putSessionQuery = `
+		INSERT INTO whatsmeow_sessions (our_jid, their_id, session, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (our_jid, their_id) DO UPDATE SET session=excluded.session, updated_at=excluded.updated_at
+	`
+	deleteAllSessionsQuery = `DELETE FROM whatsmeow_sessions WHERE our_jid=$1 AND their_id LIKE $2`
+	deleteSessionQuery     = `DELETE FROM whatsmeow_sessions WHERE our_jid=$1 AND their_id=$2`
+	pruneSessionsQuery     = `DELETE FROM whatsmeow_sessions WHERE our_jid=$1 AND updated_at<$2`
+)
+
+func (s *PGStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.queryBytes(ctx, getSessionQuery, s.JID, address)
+}
+
+func (s *PGStore) HasSession(ctx context.Context, address string) (has bool, err error) {
+	err = s.db.QueryRow(ctx, hasSessionQuery, s.JID, address).Scan(&has)
+	return
+}
+
+func (s *PGStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.exec(ctx, putSessionQuery, s.JID, address, session, time.Now().Unix())
+}
+
+func (s *PGStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.exec(ctx, deleteAllSessionsQuery, s.JID, phone+":%")
+}
+
+func (s *PGStore) DeleteSession(ctx context.Context, address string) error {
+	return s.exec(ctx, deleteSessionQuery, s.JID, address)
+}
+
+func (s *PGStore) PruneSessions(ctx context.Context, before time.Time) (int, error) {
+	tag, err := s.db.Exec(ctx, pruneSessionsQuery, s.JID, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+const (
+	lockPreKeysQuery            = `SELECT pg_advisory_xact_lock($1, hashtext($2))`
+	getLastPreKeyIDQuery        = `SELECT COALESCE(MAX(key_id), 0) FROM whatsmeow_pre_keys WHERE jid=$1`
+	insertPreKeyQuery           = `INSERT INTO whatsmeow_pre_keys (jid, key_id, key, uploaded) VALUES ($1, $2, $3, $4)`
+	getUnuploadedPreKeysQuery   = `SELECT key_id, key FROM whatsmeow_pre_keys WHERE jid=$1 AND uploaded=false ORDER BY key_id LIMIT $2`
+	getPreKeyQuery              = `SELECT key_id, key FROM whatsmeow_pre_keys WHERE jid=$1 AND key_id=$2`
+	deletePreKeyQuery           = `DELETE FROM whatsmeow_pre_keys WHERE jid=$1 AND key_id=$2`
+	markPreKeysAsUploadedQuery  = `UPDATE whatsmeow_pre_keys SET uploaded=true WHERE jid=$1 AND key_id<=$2`
+	getUploadedPreKeyCountQuery = `SELECT COUNT(*) FROM whatsmeow_pre_keys WHERE jid=$1 AND uploaded=true`
+)
+
+var preKeyColumns = []string{"jid", "key_id", "key", "uploaded"}
+
+// withPreKeyLock runs the given function in a transaction that holds the prekey advisory lock of this device,
+// which prevents other instances from generating prekeys with the same IDs at the same time.
+func (s *PGStore) withPreKeyLock(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, lockPreKeysQuery, int32(preKeyLockNamespace), s.JID)
+		if err != nil {
+			return fmt.Errorf("failed to acquire prekey lock: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+func (s *PGStore) getNextPreKeyID(ctx context.Context, tx pgx.Tx) (uint32, error) {
+	var lastKeyID int32
+	err := tx.QueryRow(ctx, getLastPreKeyIDQuery, s.JID).Scan(&lastKeyID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query next prekey ID: %w", err)
+	}
+	return uint32(lastKeyID) + 1, nil
+}
+
+func (s *PGStore) GenOnePreKey(ctx context.Context) (key *keys.PreKey, err error) {
+	err = s.withPreKeyLock(ctx, func(tx pgx.Tx) error {
+		nextKeyID, err := s.getNextPreKeyID(ctx, tx)
+		if err != nil {
+			return err
+		}
+		key = keys.NewPreKey(nextKeyID)
+		_, err = tx.Exec(ctx, insertPreKeyQuery, s.JID, int32(key.KeyID), key.Priv[:], true)
+		return err
+	})
+	return
+}
+
+func (s *PGStore) GetOrGenPreKeys(ctx context.Context, count uint32) (newKeys []*keys.PreKey, err error) {
+	err = s.withPreKeyLock(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Query(ctx, getUnuploadedPreKeysQuery, s.JID, int64(count))
+		if err != nil {
+			return fmt.Errorf("failed to query existing prekeys: %w", err)
+		}
+		newKeys = make([]*keys.PreKey, 0, count)
+		for res.Next() {
+			var key *keys.PreKey
+			key, err = scanPreKey(res)
+			if err != nil {
+				res.Close()
+				return err
+			}
+			newKeys = append(newKeys, key)
+		}
+		res.Close()
+		if err = res.Err(); err != nil {
+			return fmt.Errorf("failed to query existing prekeys: %w", err)
+		}
+
+		missing := int(count) - len(newKeys)
+		if missing <= 0 {
+			return nil
+		}
+		nextKeyID, err := s.getNextPreKeyID(ctx, tx)
+		if err != nil {
+			return err
+		}
+		rows := make([][]interface{}, missing)
+		for i := range rows {
+			key := keys.NewPreKey(nextKeyID)
+			newKeys = append(newKeys, key)
+			rows[i] = []interface{}{s.JID, int32(key.KeyID), key.Priv[:], false}
+			nextKeyID++
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"whatsmeow_pre_keys"}, preKeyColumns, pgx.CopyFromRows(rows))
+		if err != nil {
+			return fmt.Errorf("failed to insert generated prekeys: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func scanPreKey(row pgx.Row) (*keys.PreKey, error) {
+	var priv []byte
+	var id int32
+	err := row.Scan(&id, &priv)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if len(priv) != 32 {
+		return nil, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(priv)),
+		KeyID:   uint32(id),
+	}, nil
+}
+
+func (s *PGStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	return scanPreKey(s.db.QueryRow(ctx, getPreKeyQuery, s.JID, int32(id)))
+}
+
+func (s *PGStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.exec(ctx, deletePreKeyQuery, s.JID, int32(id))
+}
+
+func (s *PGStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	return s.exec(ctx, markPreKeysAsUploadedQuery, s.JID, int32(upToID))
+}
+
+func (s *PGStore) UploadedPreKeyCount(ctx context.Context) (count int, err error) {
+	err = s.db.QueryRow(ctx, getUploadedPreKeyCountQuery, s.JID).Scan(&count)
+	return
+}
+
+const (
+	getSenderKeyQuery = `SELECT sender_key FROM whatsmeow_sender_keys WHERE our_jid=$1 AND chat_id=$2 AND sender_id=$3`
+	putSenderKeyQuery = `
+		INSERT INTO whatsmeow_sender_keys (our_jid, chat_id, sender_id, sender_key) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (our_jid, chat_id, sender_id) DO UPDATE SET sender_key=excluded.sender_key
+	`
+)
+
+func (s *PGStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.exec(ctx, putSenderKeyQuery, s.JID, group, user, session)
+}
+
+func (s *PGStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.queryBytes(ctx, getSenderKeyQuery, s.JID, group, user)
+}
+
+const (
+	putAppStateSyncKeyQuery = `
+		INSERT INTO whatsmeow_app_state_sync_keys (jid, key_id, key_data, timestamp, fingerprint) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (jid, key_id) DO UPDATE
+			SET key_data=excluded.key_data, timestamp=excluded.timestamp, fingerprint=excluded.fingerprint
+	`
+	getAppStateSyncKeyQuery         = `SELECT key_data, timestamp, fingerprint FROM whatsmeow_app_state_sync_keys WHERE jid=$1 AND key_id=$2`
+	getLatestAppStateSyncKeyIDQuery = `SELECT key_id FROM whatsmeow_app_state_sync_keys WHERE jid=$1 ORDER BY timestamp DESC LIMIT 1`
+)
+
+func (s *PGStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	return s.exec(ctx, putAppStateSyncKeyQuery, s.JID, id, key.Data, key.Timestamp, key.Fingerprint)
+}
+
+func (s *PGStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	var key store.AppStateSyncKey
+	err := s.db.QueryRow(ctx, getAppStateSyncKeyQuery, s.JID, id).Scan(&key.Data, &key.Timestamp, &key.Fingerprint)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &key, err
+}
+
+func (s *PGStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	var keyID []byte
+	err := s.db.QueryRow(ctx, getLatestAppStateSyncKeyIDQuery, s.JID).Scan(&keyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return keyID, err
+}
+
+const (
+	putAppStateVersionQuery = `
+		INSERT INTO whatsmeow_app_state_version (jid, name, version, hash) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jid, name) DO UPDATE SET version=excluded.version, hash=excluded.hash
+	`
+	getAppStateVersionQuery      = `SELECT version, hash FROM whatsmeow_app_state_version WHERE jid=$1 AND name=$2`
+	deleteAppStateVersionQuery   = `DELETE FROM whatsmeow_app_state_version WHERE jid=$1 AND name=$2`
+	putAppStateMutationMACsQuery = `
+		INSERT INTO whatsmeow_app_state_mutation_macs (jid, name, version, index_mac, value_mac)
+		SELECT $1, $2, $3, index_mac, value_mac FROM unnest($4::bytea[], $5::bytea[]) AS macs(index_mac, value_mac)
+	`
+	deleteAppStateMutationMACsQuery = `DELETE FROM whatsmeow_app_state_mutation_macs WHERE jid=$1 AND name=$2 AND index_mac=ANY($3::bytea[])`
+	getAppStateMutationMACQuery     = `SELECT value_mac FROM whatsmeow_app_state_mutation_macs WHERE jid=$1 AND name=$2 AND index_mac=$3 ORDER BY version DESC LIMIT 1`
+)
+
+func (s *PGStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	return s.exec(ctx, putAppStateVersionQuery, s.JID, name, int64(version), hash[:])
+}
+
+func (s *PGStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var signedVersion int64
+	var uncheckedHash []byte
+	err = s.db.QueryRow(ctx, getAppStateVersionQuery, s.JID, name).Scan(&signedVersion, &uncheckedHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// version will be 0 and hash will be an empty array, which is the correct initial state
+		err = nil
+	} else if err != nil {
+		// There's an error, just return it
+	} else if len(uncheckedHash) != 128 {
+		// This shouldn't happen
+		err = ErrInvalidLength
+	} else {
+		// No errors, convert hash slice to array
+		version = uint64(signedVersion)
+		hash = *(*[128]byte)(uncheckedHash)
+	}
+	return
+}
+
+func (s *PGStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.exec(ctx, deleteAppStateVersionQuery, s.JID, name)
+}
+
+func (s *PGStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	indexMACs := make([][]byte, len(mutations))
+	valueMACs := make([][]byte, len(mutations))
+	for i, mutation := range mutations {
+		indexMACs[i] = mutation.IndexMAC
+		valueMACs[i] = mutation.ValueMAC
+	}
+	return s.exec(ctx, putAppStateMutationMACsQuery, s.JID, name, int64(version), indexMACs, valueMACs)
+}
+
+func (s *PGStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	if len(indexMACs) == 0 {
+		return nil
+	}
+	return s.exec(ctx, deleteAppStateMutationMACsQuery, s.JID, name, indexMACs)
+}
+
+func (s *PGStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	return s.queryBytes(ctx, getAppStateMutationMACQuery, s.JID, name, indexMAC)
+}
+
+const (
+	putContactNameQuery = `
+		INSERT INTO whatsmeow_contacts (our_jid, their_jid, first_name, full_name) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (our_jid, their_jid) DO UPDATE SET first_name=excluded.first_name, full_name=excluded.full_name
+	`
+	putManyContactNamesQuery = `
+		INSERT INTO whatsmeow_contacts (our_jid, their_jid, first_name, full_name)
+		SELECT $1, their_jid, first_name, full_name FROM unnest($2::text[], $3::text[], $4::text[]) AS contacts(their_jid, first_name, full_name)
+		ON CONFLICT (our_jid, their_jid) DO UPDATE SET first_name=excluded.first_name, full_name=excluded.full_name
+	`
+	putPushNameQuery = `
+		INSERT INTO whatsmeow_contacts (our_jid, their_jid, push_name) VALUES ($1, $2, $3)
+		ON CONFLICT (our_jid, their_jid) DO UPDATE SET push_name=excluded.push_name
+	`
+	putBusinessNameQuery = `
+		INSERT INTO whatsmeow_contacts (our_jid, their_jid, business_name) VALUES ($1, $2, $3)
+		ON CONFLICT (our_jid, their_jid) DO UPDATE SET business_name=excluded.business_name
+	`
+	getContactQuery = `
+		SELECT first_name, full_name, push_name, business_name FROM whatsmeow_contacts WHERE our_jid=$1 AND their_jid=$2
+	`
+	getAllContactsQuery = `
+		SELECT their_jid, first_name, full_name, push_name, business_name FROM whatsmeow_contacts WHERE our_jid=$1
+	`
+)
+
+func (s *PGStore) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	s.contactCacheLock.Lock()
+	defer s.contactCacheLock.Unlock()
+
+	cached, err := s.getContact(ctx, user)
+	if err != nil {
+		return false, "", err
+	}
+	if cached.PushName != pushName {
+		err = s.exec(ctx, putPushNameQuery, s.JID, user.String(), pushName)
+		if err != nil {
+			return false, "", err
+		}
+		previousName := cached.PushName
+		cached.PushName = pushName
+		cached.Found = true
+		return true, previousName, nil
+	}
+	return false, "", nil
+}
+
+func (s *PGStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (bool, string, error) {
+	s.contactCacheLock.Lock()
+	defer s.contactCacheLock.Unlock()
+
+	cached, err := s.getContact(ctx, user)
+	if err != nil {
+		return false, "", err
+	}
+	if cached.BusinessName != businessName {
+		err = s.exec(ctx, putBusinessNameQuery, s.JID, user.String(), businessName)
+		if err != nil {
+			return false, "", err
+		}
+		previousName := cached.BusinessName
+		cached.BusinessName = businessName
+		cached.Found = true
+		return true, previousName, nil
+	}
+	return false, "", nil
+}
+
+func (s *PGStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	s.contactCacheLock.Lock()
+	defer s.contactCacheLock.Unlock()
+
+	cached, err := s.getContact(ctx, user)
+	if err != nil {
+		return err
+	}
+	if cached.FirstName != firstName || cached.FullName != fullName {
+		err = s.exec(ctx, putContactNameQuery, s.JID, user.String(), firstName, fullName)
+		if err != nil {
+			return err
+		}
+		cached.FirstName = firstName
+		cached.FullName = fullName
+		cached.Found = true
+	}
+	return nil
+}
+
+func (s *PGStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	jids := make([]string, 0, len(contacts))
+	firstNames := make([]string, 0, len(contacts))
+	fullNames := make([]string, 0, len(contacts))
+	handledContacts := make(map[types.JID]struct{}, len(contacts))
+	for _, contact := range contacts {
+		if contact.JID.IsEmpty() {
+			s.log.Warnf("Empty contact info in mass insert: %+v", contact)
+			continue
+		}
+		// The whole query will break if there are duplicates, so make sure there aren't any duplicates
+		_, alreadyHandled := handledContacts[contact.JID]
+		if alreadyHandled {
+			s.log.Warnf("Duplicate contact info for %s in mass insert", contact.JID)
+			continue
+		}
+		handledContacts[contact.JID] = struct{}{}
+		jids = append(jids, contact.JID.String())
+		firstNames = append(firstNames, contact.FirstName)
+		fullNames = append(fullNames, contact.FullName)
+	}
+	err := s.exec(ctx, putManyContactNamesQuery, s.JID, jids, firstNames, fullNames)
+	if err != nil {
+		return err
+	}
+	s.contactCacheLock.Lock()
+	// Just clear the cache, fetching pushnames and business names would be too much effort
+	s.contactCache = make(map[types.JID]*types.ContactInfo)
+	s.contactCacheLock.Unlock()
+	return nil
+}
+
+func (s *PGStore) getContact(ctx context.Context, user types.JID) (*types.ContactInfo, error) {
+	cached, ok := s.contactCache[user]
+	if ok {
+		return cached, nil
+	}
+
+	var first, full, push, business *string
+	err := s.db.QueryRow(ctx, getContactQuery, s.JID, user.String()).Scan(&first, &full, &push, &business)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	info := &types.ContactInfo{
+		Found:        err == nil,
+		FirstName:    derefString(first),
+		FullName:     derefString(full),
+		PushName:     derefString(push),
+		BusinessName: derefString(business),
+	}
+	s.contactCache[user] = info
+	return info, nil
+}
+
+func derefString(val *string) string {
+	if val == nil {
+		return ""
+	}
+	return *val
+}
+
+func (s *PGStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	s.contactCacheLock.Lock()
+	info, err := s.getContact(ctx, user)
+	s.contactCacheLock.Unlock()
+	if err != nil {
+		return types.ContactInfo{}, err
+	}
+	return *info, nil
+}
+
+func (s *PGStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	s.contactCacheLock.Lock()
+	defer s.contactCacheLock.Unlock()
+	rows, err := s.db.Query(ctx, getAllContactsQuery, s.JID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	output := make(map[types.JID]types.ContactInfo, len(s.contactCache))
+	for rows.Next() {
+		var rawJID string
+		var first, full, push, business *string
+		err = rows.Scan(&rawJID, &first, &full, &push, &business)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact JID %q: %w", rawJID, err)
+		}
+		info := types.ContactInfo{
+			Found:        true,
+			FirstName:    derefString(first),
+			FullName:     derefString(full),
+			PushName:     derefString(push),
+			BusinessName: derefString(business),
+		}
+		output[jid] = info
+		s.contactCache[jid] = &info
+	}
+	return output, rows.Err()
+}
+
+const (
+	putChatSettingQuery = `
+		INSERT INTO whatsmeow_chat_settings (our_jid, chat_jid, %[1]s) VALUES ($1, $2, $3)
+		ON CONFLICT (our_jid, chat_jid) DO UPDATE SET %[1]s=excluded.%[1]s
+	`
+	getChatSettingsQuery = `
+		SELECT muted_until, pinned, archived FROM whatsmeow_chat_settings WHERE our_jid=$1 AND chat_jid=$2
+	`
+)
+
+var (
+	putMutedUntilQuery = fmt.Sprintf(putChatSettingQuery, "muted_until")
+	putPinnedQuery     = fmt.Sprintf(putChatSettingQuery, "pinned")
+	putArchivedQuery   = fmt.Sprintf(putChatSettingQuery, "archived")
+)
+
+func (s *PGStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
+	}
+	return s.exec(ctx, putMutedUntilQuery, s.JID, chat.String(), val)
+}
+
+func (s *PGStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.exec(ctx, putPinnedQuery, s.JID, chat.String(), pinned)
+}
+
+func (s *PGStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.exec(ctx, putArchivedQuery, s.JID, chat.String(), archived)
+}
+
+func (s *PGStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var mutedUntil int64
+	err = s.db.QueryRow(ctx, getChatSettingsQuery, s.JID, chat.String()).Scan(&mutedUntil, &settings.Pinned, &settings.Archived)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+	} else if err != nil {
+		return
+	} else {
+		settings.Found = true
+	}
+	if mutedUntil != 0 {
+		settings.MutedUntil = time.Unix(mutedUntil, 0)
+	}
+	return
+}
+
+const (
+	putMsgSecret = `
+		INSERT INTO whatsmeow_message_secrets (our_jid, chat_jid, sender_jid, message_id, key)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (our_jid, chat_jid, sender_jid, message_id) DO NOTHING
+	`
+	getMsgSecret = `
+		SELECT key FROM whatsmeow_message_secrets WHERE our_jid=$1 AND chat_jid=$2 AND sender_jid=$3 AND message_id=$4
+	`
+)
+
+func (s *PGStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	if len(inserts) == 0 {
+		return nil
+	}
+	var batch pgx.Batch
+	for _, insert := range inserts {
+		batch.Queue(putMsgSecret, s.JID, insert.Chat.ToNonAD().String(), insert.Sender.ToNonAD().String(), insert.ID, insert.Secret)
+	}
+	return s.db.SendBatch(ctx, &batch).Close()
+}
+
+func (s *PGStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	return s.exec(ctx, putMsgSecret, s.JID, chat.ToNonAD().String(), sender.ToNonAD().String(), id, secret)
+}
+
+func (s *PGStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.queryBytes(ctx, getMsgSecret, s.JID, chat.ToNonAD().String(), sender.ToNonAD().String(), id)
+}
@@ -0,0 +1,239 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The schema is identical to the Postgres schema created by sqlstore, so the version numbers are shared.
+var upgrades = [...]string{upgradeV1, upgradeV2, upgradeV3, upgradeV4, upgradeV5, upgradeV6, upgradeV7}
+
+// upgradeLockID is the advisory lock key held while upgrading the schema,
+// so that multiple instances starting at the same time don't try to run the same migrations.
+const upgradeLockID = 0x77686174736d656f // "whatsmeo"
+
+const upgradeV1 = `
+CREATE TABLE whatsmeow_device (
+	jid TEXT PRIMARY KEY,
+
+	registration_id BIGINT NOT NULL CHECK ( registration_id >= 0 AND registration_id < 4294967296 ),
+
+	noise_key    bytea NOT NULL CHECK ( length(noise_key) = 32 ),
+	identity_key bytea NOT NULL CHECK ( length(identity_key) = 32 ),
+
+	signed_pre_key     bytea   NOT NULL CHECK ( length(signed_pre_key) = 32 ),
+	signed_pre_key_id  INTEGER NOT NULL CHECK ( signed_pre_key_id >= 0 AND signed_pre_key_id < 16777216 ),
+	signed_pre_key_sig bytea   NOT NULL CHECK ( length(signed_pre_key_sig) = 64 ),
+
+	adv_key         bytea NOT NULL,
+	adv_details     bytea NOT NULL,
+	adv_account_sig bytea NOT NULL CHECK ( length(adv_account_sig) = 64 ),
+	adv_device_sig  bytea NOT NULL CHECK ( length(adv_device_sig) = 64 ),
+
+	platform      TEXT NOT NULL DEFAULT '',
+	business_name TEXT NOT NULL DEFAULT '',
+	push_name     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE whatsmeow_identity_keys (
+	our_jid  TEXT,
+	their_id TEXT,
+	identity bytea NOT NULL CHECK ( length(identity) = 32 ),
+
+	PRIMARY KEY (our_jid, their_id),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_pre_keys (
+	jid      TEXT,
+	key_id   INTEGER          CHECK ( key_id >= 0 AND key_id < 16777216 ),
+	key      bytea   NOT NULL CHECK ( length(key) = 32 ),
+	uploaded BOOLEAN NOT NULL,
+
+	PRIMARY KEY (jid, key_id),
+	FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_sessions (
+	our_jid  TEXT,
+	their_id TEXT,
+	session  bytea,
+
+	PRIMARY KEY (our_jid, their_id),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_sender_keys (
+	our_jid    TEXT,
+	chat_id    TEXT,
+	sender_id  TEXT,
+	sender_key bytea NOT NULL,
+
+	PRIMARY KEY (our_jid, chat_id, sender_id),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_app_state_sync_keys (
+	jid         TEXT,
+	key_id      bytea,
+	key_data    bytea  NOT NULL,
+	timestamp   BIGINT NOT NULL,
+	fingerprint bytea  NOT NULL,
+
+	PRIMARY KEY (jid, key_id),
+	FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_app_state_version (
+	jid     TEXT,
+	name    TEXT,
+	version BIGINT NOT NULL,
+	hash    bytea  NOT NULL CHECK ( length(hash) = 128 ),
+
+	PRIMARY KEY (jid, name),
+	FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_app_state_mutation_macs (
+	jid       TEXT,
+	name      TEXT,
+	version   BIGINT,
+	index_mac bytea          CHECK ( length(index_mac) = 32 ),
+	value_mac bytea NOT NULL CHECK ( length(value_mac) = 32 ),
+
+	PRIMARY KEY (jid, name, version, index_mac),
+	FOREIGN KEY (jid, name) REFERENCES whatsmeow_app_state_version(jid, name) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_contacts (
+	our_jid       TEXT,
+	their_jid     TEXT,
+	first_name    TEXT,
+	full_name     TEXT,
+	push_name     TEXT,
+	business_name TEXT,
+
+	PRIMARY KEY (our_jid, their_jid),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE whatsmeow_chat_settings (
+	our_jid       TEXT,
+	chat_jid      TEXT,
+	muted_until   BIGINT  NOT NULL DEFAULT 0,
+	pinned        BOOLEAN NOT NULL DEFAULT false,
+	archived      BOOLEAN NOT NULL DEFAULT false,
+
+	PRIMARY KEY (our_jid, chat_jid),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+`
+
+const upgradeV2 = `
+ALTER TABLE whatsmeow_device ADD COLUMN adv_account_sig_key bytea CHECK ( length(adv_account_sig_key) = 32 );
+UPDATE whatsmeow_device SET adv_account_sig_key=(
+	SELECT identity
+	FROM whatsmeow_identity_keys
+	WHERE our_jid=whatsmeow_device.jid
+	  AND their_id=concat(split_part(whatsmeow_device.jid, '.', 1), ':0')
+);
+DELETE FROM whatsmeow_device WHERE adv_account_sig_key IS NULL;
+ALTER TABLE whatsmeow_device ALTER COLUMN adv_account_sig_key SET NOT NULL;
+`
+
+const upgradeV3 = `
+CREATE TABLE whatsmeow_message_secrets (
+	our_jid    TEXT,
+	chat_jid   TEXT,
+	sender_jid TEXT,
+	message_id TEXT,
+	key        bytea NOT NULL,
+
+	PRIMARY KEY (our_jid, chat_jid, sender_jid, message_id),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+`
+
+const upgradeV4 = `
+ALTER TABLE whatsmeow_device ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+CREATE INDEX whatsmeow_device_tenant_idx ON whatsmeow_device (tenant);
+`
+
+const upgradeV5 = `
+CREATE TABLE whatsmeow_messages (
+	our_jid    TEXT,
+	chat_jid   TEXT,
+	sender_jid TEXT,
+	message_id TEXT,
+	timestamp  BIGINT  NOT NULL,
+	from_me    BOOLEAN NOT NULL,
+	push_name  TEXT    NOT NULL DEFAULT '',
+	message    bytea   NOT NULL,
+
+	PRIMARY KEY (our_jid, chat_jid, sender_jid, message_id),
+	FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX whatsmeow_messages_timestamp_idx ON whatsmeow_messages (our_jid, chat_jid, timestamp);
+`
+
+const upgradeV6 = `
+ALTER TABLE whatsmeow_sessions ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0;
+UPDATE whatsmeow_sessions SET updated_at=extract(epoch FROM now())::BIGINT;
+`
+
+const upgradeV7 = `
+ALTER TABLE whatsmeow_device ADD COLUMN last_seen BIGINT NOT NULL DEFAULT 0;
+`
+
+func getVersion(ctx context.Context, tx pgx.Tx) (int, error) {
+	_, err := tx.Exec(ctx, "CREATE TABLE IF NOT EXISTS whatsmeow_version (version INTEGER)")
+	if err != nil {
+		return -1, err
+	}
+	var version int
+	err = tx.QueryRow(ctx, "SELECT version FROM whatsmeow_version LIMIT 1").Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func setVersion(ctx context.Context, tx pgx.Tx, version int) error {
+	_, err := tx.Exec(ctx, "DELETE FROM whatsmeow_version")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO whatsmeow_version (version) VALUES ($1)", version)
+	return err
+}
+
+// Upgrade upgrades the database from the current to the latest version available.
+//
+// The whole upgrade runs in a single transaction that holds an advisory lock,
+// so it's safe to call this from multiple instances at the same time.
+func (c *Container) Upgrade(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, c.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", int64(upgradeLockID))
+		if err != nil {
+			return fmt.Errorf("failed to acquire upgrade lock: %w", err)
+		}
+		version, err := getVersion(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if version >= len(upgrades) {
+			return nil
+		}
+		for ; version < len(upgrades); version++ {
+			c.log.Infof("Upgrading database to v%d", version+1)
+			_, err = tx.Exec(ctx, upgrades[version])
+			if err != nil {
+				return err
+			}
+		}
+		return setVersion(ctx, tx, version)
+	})
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPruneNotSupported is returned by Device.PruneSessions if the session store doesn't implement SessionPruner.
+var ErrPruneNotSupported = errors.New("session store doesn't support pruning sessions")
+
+// SessionPruner is implemented by session stores that keep track of when each session was last updated.
+type SessionPruner interface {
+	// PruneSessions deletes all sessions that haven't been updated since the given time
+	// and returns the number of deleted sessions.
+	PruneSessions(ctx context.Context, before time.Time) (int, error)
+}
+
+// PruneSessions deletes the Signal sessions of this device that haven't been used for the given duration,
+// which is useful for dropping sessions with devices that were removed long ago.
+//
+// Sessions are updated whenever a message is sent to or received from the other device, so pruning
+// with a long duration (e.g. months) only removes sessions that are very unlikely to be used again.
+// If a pruned session is needed later, a new one is established automatically.
+func (device *Device) PruneSessions(ctx context.Context, olderThan time.Duration) (int, error) {
+	pruner, ok := device.Sessions.(SessionPruner)
+	if !ok {
+		return 0, ErrPruneNotSupported
+	}
+	return pruner.PruneSessions(ctx, time.Now().Add(-olderThan))
+}
+
+// StartSessionPruning calls PruneSessions every interval until the context is canceled.
+// Errors are logged using the device logger.
+//
+//	go device.StartSessionPruning(ctx, 24*time.Hour, 365*24*time.Hour)
+func (device *Device) StartSessionPruning(ctx context.Context, interval, olderThan time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			count, err := device.PruneSessions(ctx, olderThan)
+			if err != nil {
+				device.Log.Errorf("Failed to prune old sessions: %v", err)
+				if errors.Is(err, ErrPruneNotSupported) {
+					return
+				}
+			} else if count > 0 {
+				device.Log.Infof("Pruned %d sessions that were unused for over %s", count, olderThan)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
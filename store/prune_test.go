@@ -0,0 +1,35 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestPruneSessions(t *testing.T) {
+	ctx := context.Background()
+	container := store.NewCachedContainer(inmemstore.New(nil), 100)
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	_ = device.Save(ctx)
+
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	// Make sure the session is in the cache
+	_, _ = device.Sessions.GetSession(ctx, "111:1")
+
+	if count, err := device.PruneSessions(ctx, time.Hour); err != nil || count != 0 {
+		t.Fatalf("Expected no sessions to be pruned, got %d (%v)", count, err)
+	}
+	// A negative duration makes every existing session count as stale
+	if count, err := device.PruneSessions(ctx, -time.Hour); err != nil || count != 1 {
+		t.Fatalf("Expected 1 session to be pruned, got %d (%v)", count, err)
+	}
+	if has, _ := device.Sessions.HasSession(ctx, "111:1"); has {
+		t.Error("Pruned session is still in the cache")
+	}
+}
@@ -0,0 +1,410 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+// ReadOnlyError is returned by all methods that would modify the data of a read-only container or device.
+type ReadOnlyError struct {
+	Operation string
+}
+
+func (err *ReadOnlyError) Error() string {
+	return fmt.Sprintf("can't %s: store is read-only", err.Operation)
+}
+
+// Is matches all ReadOnlyErrors regardless of the operation, so errors.Is(err, ErrReadOnly) can be used to check for them.
+func (err *ReadOnlyError) Is(other error) bool {
+	_, ok := other.(*ReadOnlyError)
+	return ok
+}
+
+// ErrReadOnly matches any ReadOnlyError with errors.Is.
+var ErrReadOnly error = &ReadOnlyError{Operation: "write"}
+
+func readOnly(operation string) error {
+	return &ReadOnlyError{Operation: operation}
+}
+
+// MakeDeviceReadOnly wraps all the stores of the given device so that reads are passed through,
+// but all writes fail with a ReadOnlyError. The built-in containers call this automatically when
+// their ReadOnly field (or option) is set, which also makes them reject PutDevice and DeleteDevice.
+//
+// This is meant for analysis tools and standby replicas that must never modify the data of a live
+// session. A client can't stay connected with a read-only device, as handling messages requires
+// updating the Signal sessions.
+func MakeDeviceReadOnly(device *Device) {
+	if _, ok := device.Identities.(*readOnlyIdentityStore); !ok && device.Identities != nil {
+		device.Identities = &readOnlyIdentityStore{device.Identities}
+	}
+	if _, ok := device.Sessions.(*readOnlySessionStore); !ok && device.Sessions != nil {
+		device.Sessions = &readOnlySessionStore{device.Sessions}
+	}
+	if _, ok := device.PreKeys.(*readOnlyPreKeyStore); !ok && device.PreKeys != nil {
+		device.PreKeys = &readOnlyPreKeyStore{device.PreKeys}
+	}
+	if _, ok := device.SenderKeys.(*readOnlySenderKeyStore); !ok && device.SenderKeys != nil {
+		device.SenderKeys = &readOnlySenderKeyStore{device.SenderKeys}
+	}
+	if _, ok := device.AppStateKeys.(*readOnlyAppStateSyncKeyStore); !ok && device.AppStateKeys != nil {
+		device.AppStateKeys = &readOnlyAppStateSyncKeyStore{device.AppStateKeys}
+	}
+	if _, ok := device.AppState.(*readOnlyAppStateStore); !ok && device.AppState != nil {
+		device.AppState = &readOnlyAppStateStore{device.AppState}
+	}
+	if _, ok := device.Contacts.(*readOnlyContactStore); !ok && device.Contacts != nil {
+		device.Contacts = &readOnlyContactStore{device.Contacts}
+	}
+	if _, ok := device.ChatSettings.(*readOnlyChatSettingsStore); !ok && device.ChatSettings != nil {
+		device.ChatSettings = &readOnlyChatSettingsStore{device.ChatSettings}
+	}
+	if _, ok := device.MsgSecrets.(*readOnlyMsgSecretStore); !ok && device.MsgSecrets != nil {
+		device.MsgSecrets = &readOnlyMsgSecretStore{device.MsgSecrets}
+	}
+	if _, ok := device.Messages.(*readOnlyMessageStore); !ok && device.Messages != nil {
+		device.Messages = &readOnlyMessageStore{device.Messages}
+	}
+	if _, ok := device.Outbox.(*readOnlyOutboxStore); !ok && device.Outbox != nil {
+		device.Outbox = &readOnlyOutboxStore{device.Outbox}
+	}
+	if _, ok := device.Schedule.(*readOnlyScheduleStore); !ok && device.Schedule != nil {
+		device.Schedule = &readOnlyScheduleStore{device.Schedule}
+	}
+	if _, ok := device.Reactions.(*readOnlyReactionStore); !ok && device.Reactions != nil {
+		device.Reactions = &readOnlyReactionStore{device.Reactions}
+	}
+	if _, ok := device.Polls.(*readOnlyPollStore); !ok && device.Polls != nil {
+		device.Polls = &readOnlyPollStore{device.Polls}
+	}
+}
+
+type readOnlyIdentityStore struct {
+	inner IdentityStore
+}
+
+func (s *readOnlyIdentityStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyIdentityStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return readOnly("PutIdentity")
+}
+
+func (s *readOnlyIdentityStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return readOnly("DeleteAllIdentities")
+}
+
+func (s *readOnlyIdentityStore) DeleteIdentity(ctx context.Context, address string) error {
+	return readOnly("DeleteIdentity")
+}
+
+func (s *readOnlyIdentityStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	return s.inner.IsTrustedIdentity(ctx, address, key)
+}
+
+type readOnlySessionStore struct {
+	inner SessionStore
+}
+
+func (s *readOnlySessionStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlySessionStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.inner.GetSession(ctx, address)
+}
+
+func (s *readOnlySessionStore) HasSession(ctx context.Context, address string) (bool, error) {
+	return s.inner.HasSession(ctx, address)
+}
+
+func (s *readOnlySessionStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return readOnly("PutSession")
+}
+
+func (s *readOnlySessionStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return readOnly("DeleteAllSessions")
+}
+
+func (s *readOnlySessionStore) DeleteSession(ctx context.Context, address string) error {
+	return readOnly("DeleteSession")
+}
+
+// ExportData passes through to the wrapped store, so that read-only devices can still be exported and migrated elsewhere.
+func (s *readOnlySessionStore) ExportData(ctx context.Context) (*ExportedData, error) {
+	exporter, ok := s.inner.(DataExporter)
+	if !ok {
+		return nil, ErrExportNotSupported
+	}
+	return exporter.ExportData(ctx)
+}
+
+func (s *readOnlySessionStore) PruneSessions(ctx context.Context, before time.Time) (int, error) {
+	return 0, readOnly("PruneSessions")
+}
+
+type readOnlyPreKeyStore struct {
+	inner PreKeyStore
+}
+
+func (s *readOnlyPreKeyStore) unwrapStore() interface{} { return s.inner }
+
+// GetOrGenPreKeys is always rejected, as it may have to generate and store new prekeys.
+func (s *readOnlyPreKeyStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	return nil, readOnly("GetOrGenPreKeys")
+}
+
+func (s *readOnlyPreKeyStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	return nil, readOnly("GenOnePreKey")
+}
+
+func (s *readOnlyPreKeyStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	return s.inner.GetPreKey(ctx, id)
+}
+
+func (s *readOnlyPreKeyStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return readOnly("RemovePreKey")
+}
+
+func (s *readOnlyPreKeyStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	return readOnly("MarkPreKeysAsUploaded")
+}
+
+func (s *readOnlyPreKeyStore) UploadedPreKeyCount(ctx context.Context) (int, error) {
+	return s.inner.UploadedPreKeyCount(ctx)
+}
+
+func (s *readOnlyPreKeyStore) ImportPreKeys(ctx context.Context, preKeys []PreKeyEntry) error {
+	return readOnly("ImportPreKeys")
+}
+
+type readOnlySenderKeyStore struct {
+	inner SenderKeyStore
+}
+
+func (s *readOnlySenderKeyStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlySenderKeyStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return readOnly("PutSenderKey")
+}
+
+func (s *readOnlySenderKeyStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.inner.GetSenderKey(ctx, group, user)
+}
+
+type readOnlyAppStateSyncKeyStore struct {
+	inner AppStateSyncKeyStore
+}
+
+func (s *readOnlyAppStateSyncKeyStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyAppStateSyncKeyStore) PutAppStateSyncKey(ctx context.Context, id []byte, key AppStateSyncKey) error {
+	return readOnly("PutAppStateSyncKey")
+}
+
+func (s *readOnlyAppStateSyncKeyStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*AppStateSyncKey, error) {
+	return s.inner.GetAppStateSyncKey(ctx, id)
+}
+
+func (s *readOnlyAppStateSyncKeyStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	getter, ok := s.inner.(LatestAppStateSyncKeyGetter)
+	if !ok {
+		return nil, ErrLatestAppStateSyncKeyNotSupported
+	}
+	return getter.GetLatestAppStateSyncKeyID(ctx)
+}
+
+type readOnlyAppStateStore struct {
+	inner AppStateStore
+}
+
+func (s *readOnlyAppStateStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyAppStateStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	return readOnly("PutAppStateVersion")
+}
+
+func (s *readOnlyAppStateStore) GetAppStateVersion(ctx context.Context, name string) (uint64, [128]byte, error) {
+	return s.inner.GetAppStateVersion(ctx, name)
+}
+
+func (s *readOnlyAppStateStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return readOnly("DeleteAppStateVersion")
+}
+
+func (s *readOnlyAppStateStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []AppStateMutationMAC) error {
+	return readOnly("PutAppStateMutationMACs")
+}
+
+func (s *readOnlyAppStateStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	return readOnly("DeleteAppStateMutationMACs")
+}
+
+func (s *readOnlyAppStateStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	return s.inner.GetAppStateMutationMAC(ctx, name, indexMAC)
+}
+
+type readOnlyContactStore struct {
+	inner ContactStore
+}
+
+func (s *readOnlyContactStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyContactStore) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	return false, "", readOnly("PutPushName")
+}
+
+func (s *readOnlyContactStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (bool, string, error) {
+	return false, "", readOnly("PutBusinessName")
+}
+
+func (s *readOnlyContactStore) PutContactName(ctx context.Context, user types.JID, fullName, firstName string) error {
+	return readOnly("PutContactName")
+}
+
+func (s *readOnlyContactStore) PutAllContactNames(ctx context.Context, contacts []ContactEntry) error {
+	return readOnly("PutAllContactNames")
+}
+
+func (s *readOnlyContactStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	return s.inner.GetContact(ctx, user)
+}
+
+func (s *readOnlyContactStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	return s.inner.GetAllContacts(ctx)
+}
+
+type readOnlyChatSettingsStore struct {
+	inner ChatSettingsStore
+}
+
+func (s *readOnlyChatSettingsStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyChatSettingsStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	return readOnly("PutMutedUntil")
+}
+
+func (s *readOnlyChatSettingsStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return readOnly("PutPinned")
+}
+
+func (s *readOnlyChatSettingsStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return readOnly("PutArchived")
+}
+
+func (s *readOnlyChatSettingsStore) GetChatSettings(ctx context.Context, chat types.JID) (types.LocalChatSettings, error) {
+	return s.inner.GetChatSettings(ctx, chat)
+}
+
+type readOnlyMsgSecretStore struct {
+	inner MsgSecretStore
+}
+
+func (s *readOnlyMsgSecretStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyMsgSecretStore) PutMessageSecrets(ctx context.Context, inserts []MessageSecretInsert) error {
+	return readOnly("PutMessageSecrets")
+}
+
+func (s *readOnlyMsgSecretStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	return readOnly("PutMessageSecret")
+}
+
+func (s *readOnlyMsgSecretStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.inner.GetMessageSecret(ctx, chat, sender, id)
+}
+
+type readOnlyMessageStore struct {
+	inner MessageStore
+}
+
+func (s *readOnlyMessageStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyMessageStore) PutMessage(ctx context.Context, msg *StoredMessage) error {
+	return readOnly("PutMessage")
+}
+
+func (s *readOnlyMessageStore) GetMessage(ctx context.Context, chat, sender types.JID, id types.MessageID) (*StoredMessage, error) {
+	return s.inner.GetMessage(ctx, chat, sender, id)
+}
+
+func (s *readOnlyMessageStore) GetMessages(ctx context.Context, query MessageQuery) ([]*StoredMessage, error) {
+	return s.inner.GetMessages(ctx, query)
+}
+
+type readOnlyOutboxStore struct {
+	inner OutboxStore
+}
+
+func (s *readOnlyOutboxStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyOutboxStore) PutOutboxMessage(ctx context.Context, msg *OutboxMessage) error {
+	return readOnly("PutOutboxMessage")
+}
+
+func (s *readOnlyOutboxStore) GetOutboxMessages(ctx context.Context) ([]*OutboxMessage, error) {
+	return s.inner.GetOutboxMessages(ctx)
+}
+
+func (s *readOnlyOutboxStore) DeleteOutboxMessage(ctx context.Context, id types.MessageID) error {
+	return readOnly("DeleteOutboxMessage")
+}
+
+type readOnlyScheduleStore struct {
+	inner ScheduleStore
+}
+
+func (s *readOnlyScheduleStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyScheduleStore) PutScheduledMessage(ctx context.Context, msg *ScheduledMessage) error {
+	return readOnly("PutScheduledMessage")
+}
+
+func (s *readOnlyScheduleStore) GetDueScheduledMessages(ctx context.Context, now time.Time) ([]*ScheduledMessage, error) {
+	return s.inner.GetDueScheduledMessages(ctx, now)
+}
+
+func (s *readOnlyScheduleStore) GetNextScheduledTime(ctx context.Context) (time.Time, error) {
+	return s.inner.GetNextScheduledTime(ctx)
+}
+
+func (s *readOnlyScheduleStore) DeleteScheduledMessage(ctx context.Context, id types.MessageID) error {
+	return readOnly("DeleteScheduledMessage")
+}
+
+type readOnlyReactionStore struct {
+	inner ReactionStore
+}
+
+func (s *readOnlyReactionStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyReactionStore) PutReaction(ctx context.Context, reaction *MessageReaction) error {
+	return readOnly("PutReaction")
+}
+
+func (s *readOnlyReactionStore) GetReactions(ctx context.Context, chat types.JID, id types.MessageID) ([]*MessageReaction, error) {
+	return s.inner.GetReactions(ctx, chat, id)
+}
+
+type readOnlyPollStore struct {
+	inner PollStore
+}
+
+func (s *readOnlyPollStore) unwrapStore() interface{} { return s.inner }
+
+func (s *readOnlyPollStore) PutPoll(ctx context.Context, poll *StoredPoll) error {
+	return readOnly("PutPoll")
+}
+
+func (s *readOnlyPollStore) GetPoll(ctx context.Context, chat types.JID, id types.MessageID) (*StoredPoll, error) {
+	return s.inner.GetPoll(ctx, chat, id)
+}
+
+func (s *readOnlyPollStore) PutPollVote(ctx context.Context, vote *PollVote) error {
+	return readOnly("PutPollVote")
+}
+
+func (s *readOnlyPollStore) GetPollVotes(ctx context.Context, chat types.JID, id types.MessageID) ([]*PollVote, error) {
+	return s.inner.GetPollVotes(ctx, chat, id)
+}
@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestReadOnlyContainer(t *testing.T) {
+	ctx := context.Background()
+	container := inmemstore.New(nil)
+	device := container.NewDevice()
+	jid := types.NewADJID("1234", 0, 1)
+	device.ID = &jid
+	if err := device.Save(ctx); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	_ = device.Sessions.PutSession(ctx, "5678.0:1", []byte("session"))
+
+	var snapshot bytes.Buffer
+	if err := container.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	readOnly, err := inmemstore.Restore(&snapshot, nil, inmemstore.WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	roDevice, _ := readOnly.GetDevice(ctx, jid)
+	if roDevice == nil {
+		t.Fatalf("Device wasn't restored")
+	}
+	if session, err := roDevice.Sessions.GetSession(ctx, "5678.0:1"); err != nil || string(session) != "session" {
+		t.Errorf("Expected to read session from read-only device, got %q, %v", session, err)
+	}
+
+	err = roDevice.Sessions.PutSession(ctx, "5678.0:1", []byte("changed"))
+	var roErr *store.ReadOnlyError
+	if !errors.As(err, &roErr) || roErr.Operation != "PutSession" {
+		t.Errorf("Expected ReadOnlyError from PutSession, got %v", err)
+	}
+	if _, _, err = roDevice.Contacts.PutPushName(ctx, jid.ToNonAD(), "Name"); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from PutPushName, got %v", err)
+	}
+	if _, err = roDevice.PruneSessions(ctx, 0); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from PruneSessions, got %v", err)
+	}
+	if err = roDevice.Save(ctx); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Save, got %v", err)
+	}
+	if err = roDevice.Delete(ctx); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Delete, got %v", err)
+	}
+	if session, _ := roDevice.Sessions.GetSession(ctx, "5678.0:1"); string(session) != "session" {
+		t.Errorf("Session was modified through read-only device")
+	}
+	if _, err = roDevice.ExportJSON(ctx); err != nil {
+		t.Errorf("Failed to export read-only device: %v", err)
+	}
+}
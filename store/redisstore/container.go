@@ -0,0 +1,365 @@
+// Package redisstore contains a Redis-backed implementation of the interfaces in the store package.
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+// Container is a wrapper for a Redis client that can contain multiple whatsmeow sessions.
+type Container struct {
+	client     redis.UniversalClient
+	basePrefix string
+	prefix     string
+	tenant     string
+	log        waLog.Logger
+
+	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	ReadOnly bool
+}
+
+var _ store.Container = (*Container)(nil)
+
+// DefaultPrefix is the key prefix used if an empty prefix is passed to New.
+const DefaultPrefix = "whatsmeow:"
+
+// New wraps the given Redis client in a Container.
+//
+// All keys are namespaced with the given prefix, which allows sharing one Redis database with
+// other applications or other whatsmeow instances. An empty prefix defaults to DefaultPrefix.
+// Keys belonging to a single device use a hash tag, so the container also works with Redis Cluster.
+//
+// The logger can be nil and will default to a no-op logger.
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	container := redisstore.New(client, "mybot:", nil)
+func New(client redis.UniversalClient, prefix string, log waLog.Logger) *Container {
+	if log == nil {
+		log = waLog.Noop
+	}
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Container{
+		client:     client,
+		basePrefix: prefix,
+		prefix:     prefix,
+		log:        log,
+	}
+}
+
+// WithTenant returns a Container that shares the Redis client with this one, but only sees the devices
+// of the given tenant. The keys of the tenant are stored under `<prefix>tenant:<tenant>:`, so the devices
+// and data of different tenants never collide. The tenant name must not contain curly braces, as those
+// would interfere with the Redis Cluster hash tags.
+//
+// Containers created with New use the empty default tenant, which doesn't see the devices of other tenants.
+//
+//	customerContainer := container.WithTenant("customer-42")
+//	devices, err := customerContainer.GetAllDevices(ctx)
+func (c *Container) WithTenant(tenant string) *Container {
+	prefix := c.basePrefix
+	if tenant != "" {
+		prefix = fmt.Sprintf("%stenant:%s:", c.basePrefix, tenant)
+	}
+	return &Container{
+		client:     c.client,
+		basePrefix: c.basePrefix,
+		prefix:     prefix,
+		tenant:     tenant,
+		log:        c.log,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
+func (c *Container) devicesKey() string {
+	return c.prefix + "devices"
+}
+
+func (c *Container) deviceKey(jid string) string {
+	return c.key(jid, "device")
+}
+
+func (c *Container) key(jid, name string) string {
+	return fmt.Sprintf("%s{%s}:%s", c.prefix, jid, name)
+}
+
+const (
+	fieldRegistrationID   = "registration_id"
+	fieldNoiseKey         = "noise_key"
+	fieldIdentityKey      = "identity_key"
+	fieldSignedPreKey     = "signed_pre_key"
+	fieldSignedPreKeyID   = "signed_pre_key_id"
+	fieldSignedPreKeySig  = "signed_pre_key_sig"
+	fieldAdvKey           = "adv_key"
+	fieldAdvDetails       = "adv_details"
+	fieldAdvAccountSig    = "adv_account_sig"
+	fieldAdvAccountSigKey = "adv_account_sig_key"
+	fieldAdvDeviceSig     = "adv_device_sig"
+	fieldPlatform         = "platform"
+	fieldBusinessName     = "business_name"
+	fieldPushName         = "push_name"
+	fieldLastSeen         = "last_seen"
+)
+
+func (c *Container) scanDevice(jid types.JID, fields map[string]string) (*store.Device, error) {
+	var device store.Device
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	device.Log = c.log
+	device.ID = &jid
+
+	noisePriv := fields[fieldNoiseKey]
+	identityPriv := fields[fieldIdentityKey]
+	preKeyPriv := fields[fieldSignedPreKey]
+	preKeySig := fields[fieldSignedPreKeySig]
+	if len(noisePriv) != 32 || len(identityPriv) != 32 || len(preKeyPriv) != 32 || len(preKeySig) != 64 {
+		return nil, ErrInvalidLength
+	}
+	registrationID, err := strconv.ParseUint(fields[fieldRegistrationID], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registration ID: %w", err)
+	}
+	preKeyID, err := strconv.ParseUint(fields[fieldSignedPreKeyID], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signed prekey ID: %w", err)
+	}
+
+	device.RegistrationID = uint32(registrationID)
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)([]byte(noisePriv)))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)([]byte(identityPriv)))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)([]byte(preKeyPriv))),
+		KeyID:     uint32(preKeyID),
+		Signature: (*[64]byte)([]byte(preKeySig)),
+	}
+	device.AdvSecretKey = []byte(fields[fieldAdvKey])
+	device.Account = &waProto.ADVSignedDeviceIdentity{
+		Details:             []byte(fields[fieldAdvDetails]),
+		AccountSignature:    []byte(fields[fieldAdvAccountSig]),
+		AccountSignatureKey: []byte(fields[fieldAdvAccountSigKey]),
+		DeviceSignature:     []byte(fields[fieldAdvDeviceSig]),
+	}
+	device.Platform = fields[fieldPlatform]
+	device.BusinessName = fields[fieldBusinessName]
+	device.PushName = fields[fieldPushName]
+	// Devices saved before the last seen time was added don't have the field
+	if lastSeen, _ := strconv.ParseInt(fields[fieldLastSeen], 10, 64); lastSeen != 0 {
+		device.LastSeen = time.Unix(lastSeen, 0)
+	}
+
+	c.initStores(&device)
+	return &device, nil
+}
+
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewRedisStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	if device.Contacts == nil {
+		device.Contacts = innerStore
+	}
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.Container = c
+	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(device)
+	}
+	store.InstrumentDevice(device, "redisstore", c.MetricsHook)
+}
+
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	jids, err := c.client.SMembers(ctx, c.devicesKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	cmds := make([]*redis.MapStringStringCmd, len(jids))
+	_, err = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, jid := range jids {
+			cmds[i] = pipe.HGetAll(ctx, c.deviceKey(jid))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	sessions := make([]*store.Device, 0, len(jids))
+	for i, rawJID := range jids {
+		fields := cmds[i].Val()
+		if len(fields) == 0 {
+			// The device was deleted between the two queries
+			continue
+		}
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return sessions, fmt.Errorf("failed to parse device JID %q: %w", rawJID, err)
+		}
+		sess, err := c.scanDevice(jid, fields)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the database.
+//
+// If the device is not found, nil is returned instead.
+//
+// Note that the parameter usually must be an AD-JID.
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	fields, err := c.client.HGetAll(ctx, c.deviceKey(jid.String())).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	} else if len(fields) == 0 {
+		return nil, nil
+	}
+	return c.scanDevice(jid, fields)
+}
+
+// NewDevice creates a new device in this database.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
+	return device
+}
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+// ErrInvalidLength is returned by some database getters if the database returned a byte array with an unexpected length.
+var ErrInvalidLength = errors.New("database returned byte array with illegal length")
+
+// PutDevice stores the given device in this database. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	jid := device.ID.String()
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, c.deviceKey(jid), map[string]interface{}{
+			fieldRegistrationID:   device.RegistrationID,
+			fieldNoiseKey:         device.NoiseKey.Priv[:],
+			fieldIdentityKey:      device.IdentityKey.Priv[:],
+			fieldSignedPreKey:     device.SignedPreKey.Priv[:],
+			fieldSignedPreKeyID:   device.SignedPreKey.KeyID,
+			fieldSignedPreKeySig:  device.SignedPreKey.Signature[:],
+			fieldAdvKey:           device.AdvSecretKey,
+			fieldAdvDetails:       device.Account.Details,
+			fieldAdvAccountSig:    device.Account.AccountSignature,
+			fieldAdvAccountSigKey: device.Account.AccountSignatureKey,
+			fieldAdvDeviceSig:     device.Account.DeviceSignature,
+			fieldPlatform:         device.Platform,
+			fieldBusinessName:     device.BusinessName,
+			fieldPushName:         device.PushName,
+			fieldLastSeen:         lastSeen,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The device index lives in a different hash slot, so it can't be in the same transaction when using Redis Cluster.
+	err = c.client.SAdd(ctx, c.devicesKey(), jid).Err()
+
+	if !device.Initialized {
+		c.initStores(device)
+	}
+	return err
+}
+
+// PutLastSeen stores only the last seen time of the given device, which is cheaper than saving the whole device.
+func (c *Container) PutLastSeen(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutLastSeen"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	key := c.deviceKey(device.ID.String())
+	// Don't create a partial device if it was deleted in the meantime
+	if exists, err := c.client.Exists(ctx, key).Result(); err != nil || exists == 0 {
+		return err
+	}
+	return c.client.HSet(ctx, key, fieldLastSeen, lastSeen).Err()
+}
+
+// DeleteDevice deletes the given device and all of its data from this database. This should be called through Device.Delete()
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	jid := device.ID.String()
+	err := c.client.SRem(ctx, c.devicesKey(), jid).Err()
+	if err != nil {
+		return err
+	}
+	allKeys := make([]string, 0, len(deviceDataKeys)+1)
+	allKeys = append(allKeys, c.deviceKey(jid))
+	for _, name := range deviceDataKeys {
+		allKeys = append(allKeys, c.key(jid, name))
+	}
+	return c.client.Del(ctx, allKeys...).Err()
+}
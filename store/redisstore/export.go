@@ -0,0 +1,178 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.DataExporter = (*RedisStore)(nil)
+var _ store.PreKeyImporter = (*RedisStore)(nil)
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *RedisStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	names := []string{
+		identitiesKey, sessionsKey, preKeysKey, senderKeysKey, appStateSyncKeysKey,
+		appStateVersionKey, appStateMACsKey, chatSettingsKey, msgSecretsKey,
+	}
+	cmds := make(map[string]*redis.MapStringStringCmd, len(names))
+	var pending *redis.StringSliceCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, name := range names {
+			cmds[name] = pipe.HGetAll(ctx, s.k(name))
+		}
+		pending = pipe.ZRange(ctx, s.k(pendingPreKeysKey), 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device data: %w", err)
+	}
+
+	data := &store.ExportedData{
+		Identities:   make(map[string][32]byte),
+		Sessions:     make(map[string][]byte),
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+	for address, identity := range cmds[identitiesKey].Val() {
+		if len(identity) != 32 {
+			return nil, ErrInvalidLength
+		}
+		data.Identities[address] = *(*[32]byte)([]byte(identity))
+	}
+	for address, session := range cmds[sessionsKey].Val() {
+		data.Sessions[address] = []byte(session)
+	}
+	pendingIDs := make(map[string]struct{}, len(pending.Val()))
+	for _, id := range pending.Val() {
+		pendingIDs[id] = struct{}{}
+	}
+	for rawID, rawKey := range cmds[preKeysKey].Val() {
+		key, err := parsePreKey(rawID, rawKey)
+		if err != nil {
+			return nil, err
+		}
+		_, isPending := pendingIDs[rawID]
+		data.PreKeys = append(data.PreKeys, store.PreKeyEntry{PreKey: *key, Uploaded: !isPending})
+	}
+	for field, key := range cmds[senderKeysKey].Val() {
+		parts := strings.SplitN(field, "|", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sender key field %q", field)
+		}
+		data.SenderKeys = append(data.SenderKeys, store.SenderKeyEntry{Group: parts[0], User: parts[1], Key: []byte(key)})
+	}
+	for id, rawKey := range cmds[appStateSyncKeysKey].Val() {
+		entry := store.AppStateSyncKeyEntry{ID: []byte(id)}
+		err = json.Unmarshal([]byte(rawKey), &entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse app state sync key: %w", err)
+		}
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, entry)
+	}
+	appStateIndexes := make(map[string]int)
+	for name, rawVersion := range cmds[appStateVersionKey].Val() {
+		if len(rawVersion) != 8+128 {
+			return nil, ErrInvalidLength
+		}
+		appStateIndexes[name] = len(data.AppStates)
+		data.AppStates = append(data.AppStates, store.AppStateEntry{
+			Name:    name,
+			Version: binary.BigEndian.Uint64([]byte(rawVersion)),
+			Hash:    *(*[128]byte)([]byte(rawVersion[8:])),
+		})
+	}
+	for field, value := range cmds[appStateMACsKey].Val() {
+		parts := strings.SplitN(field, "|", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid mutation MAC field %q", field)
+		} else if len(value) < 8 {
+			return nil, ErrInvalidLength
+		}
+		index, ok := appStateIndexes[parts[0]]
+		if !ok {
+			continue
+		}
+		data.AppStates[index].MutationMACs = append(data.AppStates[index].MutationMACs, store.AppStateMutationMACEntry{
+			AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: []byte(parts[1]), ValueMAC: []byte(value[8:])},
+			Version:             binary.BigEndian.Uint64([]byte(value[:8])),
+		})
+	}
+	data.Contacts, err = s.GetAllContacts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export contacts: %w", err)
+	}
+	for rawJID, rawSettings := range cmds[chatSettingsKey].Val() {
+		chat, err := types.ParseJID(rawJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chat JID %q: %w", rawJID, err)
+		}
+		var stored redisChatSettings
+		err = json.Unmarshal([]byte(rawSettings), &stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		}
+		settings := types.LocalChatSettings{Found: true, Pinned: stored.Pinned, Archived: stored.Archived}
+		if stored.MutedUntil != 0 {
+			settings.MutedUntil = time.Unix(stored.MutedUntil, 0)
+		}
+		data.ChatSettings[chat] = settings
+	}
+	for field, secret := range cmds[msgSecretsKey].Val() {
+		parts := strings.SplitN(field, "|", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid message secret field %q", field)
+		}
+		entry := store.MessageSecretInsert{ID: parts[2], Secret: []byte(secret)}
+		entry.Chat, err = types.ParseJID(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chat JID %q: %w", parts[0], err)
+		}
+		entry.Sender, err = types.ParseJID(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sender JID %q: %w", parts[1], err)
+		}
+		data.MessageSecrets = append(data.MessageSecrets, entry)
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *RedisStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	var maxID uint32
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, preKey := range preKeys {
+			pipe.HSet(ctx, s.k(preKeysKey), strconv.FormatUint(uint64(preKey.KeyID), 10), preKey.Priv[:])
+			if !preKey.Uploaded {
+				pipe.ZAdd(ctx, s.k(pendingPreKeysKey), redis.Z{Score: float64(preKey.KeyID), Member: preKey.KeyID})
+			}
+			if preKey.KeyID > maxID {
+				maxID = preKey.KeyID
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Make sure newly generated keys don't reuse the imported IDs
+	lastID, err := s.client.Get(ctx, s.k(lastPreKeyIDKey)).Uint64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	} else if lastID < uint64(maxID) {
+		return s.client.Set(ctx, s.k(lastPreKeyIDKey), maxID, 0).Err()
+	}
+	return nil
+}
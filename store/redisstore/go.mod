@@ -0,0 +1,19 @@
+module github.com/insomnius/whatsmeow/store/redisstore
+
+go 1.18
+
+require (
+	github.com/insomnius/whatsmeow v0.0.0
+	github.com/redis/go-redis/v9 v9.0.5
+)
+
+require (
+	filippo.io/edwards25519 v1.0.0 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	go.mau.fi/libsignal v0.0.0-20221015105917-d970e7c3c9cf // indirect
+	golang.org/x/crypto v0.0.0-20221012134737-56aed061732a // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+replace github.com/insomnius/whatsmeow => ../..
@@ -0,0 +1,676 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+const (
+	identitiesKey       = "identities"
+	sessionsKey         = "sessions"
+	preKeysKey          = "pre_keys"
+	pendingPreKeysKey   = "pre_keys:pending"
+	lastPreKeyIDKey     = "pre_keys:last_id"
+	senderKeysKey       = "sender_keys"
+	appStateSyncKeysKey = "app_state_sync_keys"
+	appStateVersionKey  = "app_state_version"
+	appStateMACsKey     = "app_state_mutation_macs"
+	contactsKey         = "contacts"
+	chatSettingsKey     = "chat_settings"
+	msgSecretsKey       = "message_secrets"
+)
+
+// deviceDataKeys contains the names of all keys that belong to a single device, used for deleting devices.
+var deviceDataKeys = []string{
+	identitiesKey, sessionsKey, preKeysKey, pendingPreKeysKey, lastPreKeyIDKey, senderKeysKey,
+	appStateSyncKeysKey, appStateVersionKey, appStateMACsKey, contactsKey, chatSettingsKey, msgSecretsKey,
+}
+
+// scanBatchSize is the COUNT hint used when iterating over hashes with HSCAN.
+const scanBatchSize = 500
+
+type RedisStore struct {
+	*Container
+	JID string
+
+	preKeyLock sync.Mutex
+
+	contactLock sync.Mutex
+}
+
+// NewRedisStore creates a new RedisStore with the given container and user JID.
+// It contains implementations of all the different stores in the store package.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewRedisStore(c *Container, jid types.JID) *RedisStore {
+	return &RedisStore{
+		Container: c,
+		JID:       jid.String(),
+	}
+}
+
+var _ store.IdentityStore = (*RedisStore)(nil)
+var _ store.SessionStore = (*RedisStore)(nil)
+var _ store.PreKeyStore = (*RedisStore)(nil)
+var _ store.SenderKeyStore = (*RedisStore)(nil)
+var _ store.AppStateSyncKeyStore = (*RedisStore)(nil)
+var _ store.LatestAppStateSyncKeyGetter = (*RedisStore)(nil)
+var _ store.AppStateStore = (*RedisStore)(nil)
+var _ store.ContactStore = (*RedisStore)(nil)
+var _ store.ChatSettingsStore = (*RedisStore)(nil)
+var _ store.MsgSecretStore = (*RedisStore)(nil)
+
+func (s *RedisStore) k(name string) string {
+	return s.key(s.JID, name)
+}
+
+// getBytes is a helper for HGET that returns nil instead of an error if the field doesn't exist.
+func (s *RedisStore) getBytes(ctx context.Context, key, field string) ([]byte, error) {
+	val, err := s.client.HGet(ctx, key, field).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return val, err
+}
+
+// deleteFieldsWithPrefix deletes all fields in the given hash whose name starts with the given prefix.
+func (s *RedisStore) deleteFieldsWithPrefix(ctx context.Context, key, prefix string) error {
+	var cursor uint64
+	pattern := escapeGlob(prefix) + "*"
+	for {
+		fields, nextCursor, err := s.client.HScan(ctx, key, cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			names := make([]string, 0, len(fields)/2)
+			for i := 0; i < len(fields); i += 2 {
+				names = append(names, fields[i])
+			}
+			err = s.client.HDel(ctx, key, names...).Err()
+			if err != nil {
+				return err
+			}
+		}
+		if nextCursor == 0 {
+			return nil
+		}
+		cursor = nextCursor
+	}
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+func escapeGlob(val string) string {
+	return globEscaper.Replace(val)
+}
+
+func (s *RedisStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.client.HSet(ctx, s.k(identitiesKey), address, key[:]).Err()
+}
+
+func (s *RedisStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deleteFieldsWithPrefix(ctx, s.k(identitiesKey), phone+":")
+}
+
+func (s *RedisStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.client.HDel(ctx, s.k(identitiesKey), address).Err()
+}
+
+func (s *RedisStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existingIdentity, err := s.getBytes(ctx, s.k(identitiesKey), address)
+	if err != nil {
+		return false, err
+	} else if existingIdentity == nil {
+		// Trust if not known, it'll be saved automatically later
+		return true, nil
+	} else if len(existingIdentity) != 32 {
+		return false, ErrInvalidLength
+	}
+	return *(*[32]byte)(existingIdentity) == key, nil
+}
+
+func (s *RedisStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.getBytes(ctx, s.k(sessionsKey), address)
+}
+
+func (s *RedisStore) HasSession(ctx context.Context, address string) (bool, error) {
+	return s.client.HExists(ctx, s.k(sessionsKey), address).Result()
+}
+
+func (s *RedisStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.client.HSet(ctx, s.k(sessionsKey), address, session).Err()
+}
+
+func (s *RedisStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deleteFieldsWithPrefix(ctx, s.k(sessionsKey), phone+":")
+}
+
+func (s *RedisStore) DeleteSession(ctx context.Context, address string) error {
+	return s.client.HDel(ctx, s.k(sessionsKey), address).Err()
+}
+
+// genPreKeys generates count new prekeys and stores them in a single pipeline.
+func (s *RedisStore) genPreKeys(ctx context.Context, count uint32, markUploaded bool) ([]*keys.PreKey, error) {
+	lastID, err := s.client.IncrBy(ctx, s.k(lastPreKeyIDKey), int64(count)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve prekey IDs: %w", err)
+	}
+	firstID := uint32(lastID) - count + 1
+	newKeys := make([]*keys.PreKey, count)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range newKeys {
+			key := keys.NewPreKey(firstID + uint32(i))
+			newKeys[i] = key
+			pipe.HSet(ctx, s.k(preKeysKey), strconv.FormatUint(uint64(key.KeyID), 10), key.Priv[:])
+			if !markUploaded {
+				pipe.ZAdd(ctx, s.k(pendingPreKeysKey), redis.Z{Score: float64(key.KeyID), Member: key.KeyID})
+			}
+		}
+		return nil
+	})
+	return newKeys, err
+}
+
+func (s *RedisStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	newKeys, err := s.genPreKeys(ctx, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys[0], nil
+}
+
+func (s *RedisStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+
+	pendingIDs, err := s.client.ZRange(ctx, s.k(pendingPreKeysKey), 0, int64(count)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing prekeys: %w", err)
+	}
+	newKeys := make([]*keys.PreKey, 0, count)
+	if len(pendingIDs) > 0 {
+		var existing []interface{}
+		existing, err = s.client.HMGet(ctx, s.k(preKeysKey), pendingIDs...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query existing prekeys: %w", err)
+		}
+		for i, rawKey := range existing {
+			var key *keys.PreKey
+			key, err = parsePreKey(pendingIDs[i], rawKey)
+			if err != nil {
+				return nil, err
+			} else if key != nil {
+				newKeys = append(newKeys, key)
+			}
+		}
+	}
+
+	if missing := count - uint32(len(newKeys)); missing > 0 {
+		var generated []*keys.PreKey
+		generated, err = s.genPreKeys(ctx, missing, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate prekeys: %w", err)
+		}
+		newKeys = append(newKeys, generated...)
+	}
+
+	return newKeys, nil
+}
+
+func parsePreKey(rawID string, rawKey interface{}) (*keys.PreKey, error) {
+	if rawKey == nil {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(rawID, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prekey ID: %w", err)
+	}
+	priv, ok := rawKey.(string)
+	if !ok || len(priv) != 32 {
+		return nil, ErrInvalidLength
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)([]byte(priv))),
+		KeyID:   uint32(id),
+	}, nil
+}
+
+func (s *RedisStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	rawID := strconv.FormatUint(uint64(id), 10)
+	priv, err := s.client.HGet(ctx, s.k(preKeysKey), rawID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parsePreKey(rawID, priv)
+}
+
+func (s *RedisStore) RemovePreKey(ctx context.Context, id uint32) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.k(preKeysKey), strconv.FormatUint(uint64(id), 10))
+		pipe.ZRem(ctx, s.k(pendingPreKeysKey), id)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	return s.client.ZRemRangeByScore(ctx, s.k(pendingPreKeysKey), "-inf", strconv.FormatUint(uint64(upToID), 10)).Err()
+}
+
+func (s *RedisStore) UploadedPreKeyCount(ctx context.Context) (int, error) {
+	var total, pending *redis.IntCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		total = pipe.HLen(ctx, s.k(preKeysKey))
+		pending = pipe.ZCard(ctx, s.k(pendingPreKeysKey))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(total.Val() - pending.Val()), nil
+}
+
+func senderKeyField(group, user string) string {
+	return group + "|" + user
+}
+
+func (s *RedisStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.client.HSet(ctx, s.k(senderKeysKey), senderKeyField(group, user), session).Err()
+}
+
+func (s *RedisStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.getBytes(ctx, s.k(senderKeysKey), senderKeyField(group, user))
+}
+
+func (s *RedisStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	data, err := json.Marshal(&key)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.k(appStateSyncKeysKey), string(id), data).Err()
+}
+
+func (s *RedisStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	data, err := s.getBytes(ctx, s.k(appStateSyncKeysKey), string(id))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var key store.AppStateSyncKey
+	err = json.Unmarshal(data, &key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app state sync key: %w", err)
+	}
+	return &key, nil
+}
+
+func (s *RedisStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	keys, err := s.client.HGetAll(ctx, s.k(appStateSyncKeysKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var latestID []byte
+	var latestTimestamp int64
+	for id, rawKey := range keys {
+		var key store.AppStateSyncKey
+		if err = json.Unmarshal([]byte(rawKey), &key); err != nil {
+			return nil, fmt.Errorf("failed to parse app state sync key: %w", err)
+		} else if latestID == nil || key.Timestamp > latestTimestamp {
+			latestID, latestTimestamp = []byte(id), key.Timestamp
+		}
+	}
+	return latestID, nil
+}
+
+func (s *RedisStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	data := make([]byte, 8+len(hash))
+	binary.BigEndian.PutUint64(data, version)
+	copy(data[8:], hash[:])
+	return s.client.HSet(ctx, s.k(appStateVersionKey), name, data).Err()
+}
+
+func (s *RedisStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	var data []byte
+	data, err = s.getBytes(ctx, s.k(appStateVersionKey), name)
+	if err != nil || data == nil {
+		// If the name isn't found, version will be 0 and hash will be an empty array, which is the correct initial state
+		return
+	} else if len(data) != 8+len(hash) {
+		err = ErrInvalidLength
+		return
+	}
+	version = binary.BigEndian.Uint64(data)
+	hash = *(*[128]byte)(data[8:])
+	return
+}
+
+func (s *RedisStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.client.HDel(ctx, s.k(appStateVersionKey), name).Err()
+}
+
+func mutationMACField(name string, indexMAC []byte) string {
+	return name + "|" + string(indexMAC)
+}
+
+func (s *RedisStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(mutations)*2)
+	for _, mutation := range mutations {
+		value := make([]byte, 8+len(mutation.ValueMAC))
+		binary.BigEndian.PutUint64(value, version)
+		copy(value[8:], mutation.ValueMAC)
+		values = append(values, mutationMACField(name, mutation.IndexMAC), value)
+	}
+	return s.client.HSet(ctx, s.k(appStateMACsKey), values...).Err()
+}
+
+func (s *RedisStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	if len(indexMACs) == 0 {
+		return nil
+	}
+	fields := make([]string, len(indexMACs))
+	for i, indexMAC := range indexMACs {
+		fields[i] = mutationMACField(name, indexMAC)
+	}
+	return s.client.HDel(ctx, s.k(appStateMACsKey), fields...).Err()
+}
+
+func (s *RedisStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	value, err := s.getBytes(ctx, s.k(appStateMACsKey), mutationMACField(name, indexMAC))
+	if err != nil || value == nil {
+		return nil, err
+	} else if len(value) < 8 {
+		return nil, ErrInvalidLength
+	}
+	return value[8:], nil
+}
+
+type redisContact struct {
+	FirstName    string `json:"first_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+}
+
+func (rc *redisContact) toInfo() types.ContactInfo {
+	return types.ContactInfo{
+		Found:        true,
+		FirstName:    rc.FirstName,
+		FullName:     rc.FullName,
+		PushName:     rc.PushName,
+		BusinessName: rc.BusinessName,
+	}
+}
+
+func (s *RedisStore) getContact(ctx context.Context, user types.JID) (*redisContact, bool, error) {
+	data, err := s.getBytes(ctx, s.k(contactsKey), user.String())
+	if err != nil {
+		return nil, false, err
+	} else if data == nil {
+		return &redisContact{}, false, nil
+	}
+	var contact redisContact
+	err = json.Unmarshal(data, &contact)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse contact info of %s: %w", user, err)
+	}
+	return &contact, true, nil
+}
+
+func (s *RedisStore) putContact(ctx context.Context, user types.JID, contact *redisContact) error {
+	data, err := json.Marshal(contact)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.k(contactsKey), user.String(), data).Err()
+}
+
+// updateContact applies the given function to the stored contact info and saves the result if it returns true.
+func (s *RedisStore) updateContact(ctx context.Context, user types.JID, update func(contact *redisContact) bool) error {
+	s.contactLock.Lock()
+	defer s.contactLock.Unlock()
+	contact, _, err := s.getContact(ctx, user)
+	if err != nil {
+		return err
+	}
+	if update(contact) {
+		return s.putContact(ctx, user, contact)
+	}
+	return nil
+}
+
+func (s *RedisStore) PutPushName(ctx context.Context, user types.JID, pushName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(ctx, user, func(contact *redisContact) bool {
+		if contact.PushName != pushName {
+			previousName = contact.PushName
+			contact.PushName = pushName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *RedisStore) PutBusinessName(ctx context.Context, user types.JID, businessName string) (changed bool, previousName string, err error) {
+	err = s.updateContact(ctx, user, func(contact *redisContact) bool {
+		if contact.BusinessName != businessName {
+			previousName = contact.BusinessName
+			contact.BusinessName = businessName
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return
+}
+
+func (s *RedisStore) PutContactName(ctx context.Context, user types.JID, firstName, fullName string) error {
+	return s.updateContact(ctx, user, func(contact *redisContact) bool {
+		if contact.FirstName != firstName || contact.FullName != fullName {
+			contact.FirstName = firstName
+			contact.FullName = fullName
+			return true
+		}
+		return false
+	})
+}
+
+func (s *RedisStore) PutAllContactNames(ctx context.Context, contacts []store.ContactEntry) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	s.contactLock.Lock()
+	defer s.contactLock.Unlock()
+
+	fields := make([]string, 0, len(contacts))
+	entries := make(map[string]store.ContactEntry, len(contacts))
+	for _, contact := range contacts {
+		if contact.JID.IsEmpty() {
+			s.log.Warnf("Empty contact info in mass insert: %+v", contact)
+			continue
+		}
+		field := contact.JID.String()
+		if _, alreadyHandled := entries[field]; !alreadyHandled {
+			fields = append(fields, field)
+		}
+		entries[field] = contact
+	}
+	if len(fields) == 0 {
+		// HMGET with no fields is a syntax error in Redis
+		return nil
+	}
+	existing, err := s.client.HMGet(ctx, s.k(contactsKey), fields...).Result()
+	if err != nil {
+		return fmt.Errorf("failed to query existing contacts: %w", err)
+	}
+	values := make([]interface{}, 0, len(fields)*2)
+	for i, field := range fields {
+		var contact redisContact
+		if rawContact, ok := existing[i].(string); ok {
+			err = json.Unmarshal([]byte(rawContact), &contact)
+			if err != nil {
+				return fmt.Errorf("failed to parse contact info of %s: %w", field, err)
+			}
+		}
+		contact.FirstName = entries[field].FirstName
+		contact.FullName = entries[field].FullName
+		data, err := json.Marshal(&contact)
+		if err != nil {
+			return err
+		}
+		values = append(values, field, data)
+	}
+	return s.client.HSet(ctx, s.k(contactsKey), values...).Err()
+}
+
+func (s *RedisStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	contact, found, err := s.getContact(ctx, user)
+	if err != nil || !found {
+		return types.ContactInfo{}, err
+	}
+	return contact.toInfo(), nil
+}
+
+func (s *RedisStore) GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error) {
+	rawContacts, err := s.client.HGetAll(ctx, s.k(contactsKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[types.JID]types.ContactInfo, len(rawContacts))
+	for rawJID, rawContact := range rawContacts {
+		jid, err := types.ParseJID(rawJID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact JID %q: %w", rawJID, err)
+		}
+		var contact redisContact
+		err = json.Unmarshal([]byte(rawContact), &contact)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse contact info of %s: %w", jid, err)
+		}
+		output[jid] = contact.toInfo()
+	}
+	return output, nil
+}
+
+type redisChatSettings struct {
+	MutedUntil int64 `json:"muted_until,omitempty"`
+	Pinned     bool  `json:"pinned,omitempty"`
+	Archived   bool  `json:"archived,omitempty"`
+}
+
+// updateChatSettings atomically updates the settings of the given chat using optimistic locking.
+func (s *RedisStore) updateChatSettings(ctx context.Context, chat types.JID, update func(settings *redisChatSettings)) error {
+	key := s.k(chatSettingsKey)
+	field := chat.String()
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		var settings redisChatSettings
+		data, err := tx.HGet(ctx, key, field).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		} else if err == nil {
+			err = json.Unmarshal(data, &settings)
+			if err != nil {
+				return fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+			}
+		}
+		update(&settings)
+		data, err = json.Marshal(&settings)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, field, data)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisStore) PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
+	}
+	return s.updateChatSettings(ctx, chat, func(settings *redisChatSettings) {
+		settings.MutedUntil = val
+	})
+}
+
+func (s *RedisStore) PutPinned(ctx context.Context, chat types.JID, pinned bool) error {
+	return s.updateChatSettings(ctx, chat, func(settings *redisChatSettings) {
+		settings.Pinned = pinned
+	})
+}
+
+func (s *RedisStore) PutArchived(ctx context.Context, chat types.JID, archived bool) error {
+	return s.updateChatSettings(ctx, chat, func(settings *redisChatSettings) {
+		settings.Archived = archived
+	})
+}
+
+func (s *RedisStore) GetChatSettings(ctx context.Context, chat types.JID) (settings types.LocalChatSettings, err error) {
+	var data []byte
+	data, err = s.getBytes(ctx, s.k(chatSettingsKey), chat.String())
+	if err != nil || data == nil {
+		return
+	}
+	var stored redisChatSettings
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		err = fmt.Errorf("failed to parse chat settings of %s: %w", chat, err)
+		return
+	}
+	settings.Found = true
+	settings.Pinned = stored.Pinned
+	settings.Archived = stored.Archived
+	if stored.MutedUntil != 0 {
+		settings.MutedUntil = time.Unix(stored.MutedUntil, 0)
+	}
+	return
+}
+
+func msgSecretField(chat, sender types.JID, id types.MessageID) string {
+	return chat.ToNonAD().String() + "|" + sender.ToNonAD().String() + "|" + id
+}
+
+func (s *RedisStore) PutMessageSecrets(ctx context.Context, inserts []store.MessageSecretInsert) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, insert := range inserts {
+			pipe.HSetNX(ctx, s.k(msgSecretsKey), msgSecretField(insert.Chat, insert.Sender, insert.ID), insert.Secret)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error {
+	return s.client.HSetNX(ctx, s.k(msgSecretsKey), msgSecretField(chat, sender, id), secret).Err()
+}
+
+func (s *RedisStore) GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	return s.getBytes(ctx, s.k(msgSecretsKey), msgSecretField(chat, sender, id))
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// shardReplicas is the number of points each shard gets on the hash ring.
+// More points make the distribution of devices between shards more even.
+const shardReplicas = 128
+
+// ErrDeviceIDMustBeSet is returned by ShardedContainer.PutDevice if the device JID isn't known, as the shard can't be chosen without it.
+// It's also returned by Device.UpdateLastSeen for devices that haven't been paired yet.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// ShardedContainer spreads devices across multiple containers using consistent hashing on the device JID.
+//
+// Each device is always stored in the same shard, so all the data of a single device stays in one database.
+// Adding a new shard to the end of the list only moves about 1/N of the devices to it. Devices whose shard
+// changed must be moved manually (e.g. with Migrate and ShardFor), otherwise they won't be found.
+type ShardedContainer struct {
+	shards []Container
+	ring   []ringPoint
+}
+
+var _ Container = (*ShardedContainer)(nil)
+
+// NewShardedContainer creates a container that routes devices to the given containers. At least one shard is required.
+//
+// The position of a shard in the list determines which devices are assigned to it, so the order of the
+// shards must stay the same between restarts. New shards should only be appended to the end of the list.
+//
+//	container := store.NewShardedContainer(db1Container, db2Container, db3Container)
+func NewShardedContainer(shards ...Container) *ShardedContainer {
+	if len(shards) == 0 {
+		panic("store.NewShardedContainer: at least one shard is required")
+	}
+	ring := make([]ringPoint, 0, len(shards)*shardReplicas)
+	for i := range shards {
+		for j := 0; j < shardReplicas; j++ {
+			ring = append(ring, ringPoint{hash: hashShardKey(fmt.Sprintf("shard-%d-%d", i, j)), shard: i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	return &ShardedContainer{shards: shards, ring: ring}
+}
+
+func hashShardKey(key string) uint64 {
+	hash := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// Shards returns the underlying containers.
+func (sc *ShardedContainer) Shards() []Container {
+	return sc.shards
+}
+
+// ShardFor returns the container that the device with the given JID is stored in.
+func (sc *ShardedContainer) ShardFor(jid types.JID) Container {
+	hash := hashShardKey(jid.String())
+	index := sort.Search(len(sc.ring), func(i int) bool {
+		return sc.ring[i].hash >= hash
+	})
+	if index == len(sc.ring) {
+		index = 0
+	}
+	return sc.shards[sc.ring[index].shard]
+}
+
+func (sc *ShardedContainer) wrapDevice(device *Device) *Device {
+	if device != nil {
+		device.Container = sc
+	}
+	return device
+}
+
+// NewDevice creates a new device. The device is assigned to a shard when it's saved for the first time,
+// as the JID isn't known before pairing.
+func (sc *ShardedContainer) NewDevice() *Device {
+	return sc.wrapDevice(sc.shards[0].NewDevice())
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the store. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (sc *ShardedContainer) GetFirstDevice(ctx context.Context) (*Device, error) {
+	devices, err := sc.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return sc.NewDevice(), nil
+	} else {
+		return devices[0], nil
+	}
+}
+
+// GetDevice finds the device with the specified JID in the shard it belongs to.
+//
+// If the device is not found, nil is returned instead.
+func (sc *ShardedContainer) GetDevice(ctx context.Context, jid types.JID) (*Device, error) {
+	device, err := sc.ShardFor(jid).GetDevice(ctx, jid)
+	if err != nil {
+		return nil, err
+	}
+	return sc.wrapDevice(device), nil
+}
+
+// GetAllDevices finds all the devices in all shards.
+func (sc *ShardedContainer) GetAllDevices(ctx context.Context) ([]*Device, error) {
+	devices := make([]*Device, 0)
+	for i, shard := range sc.shards {
+		shardDevices, err := shard.GetAllDevices(ctx)
+		if err != nil {
+			return devices, fmt.Errorf("failed to get devices from shard #%d: %w", i, err)
+		}
+		for _, device := range shardDevices {
+			devices = append(devices, sc.wrapDevice(device))
+		}
+	}
+	return devices, nil
+}
+
+var _ DeviceLister = (*ShardedContainer)(nil)
+
+// ListDevices finds a page of the devices in all shards that match the filter.
+//
+// Each shard is asked for the first offset+limit matching devices, which are then merged and sorted,
+// so pages far from the start are more expensive than with a single container.
+func (sc *ShardedContainer) ListDevices(ctx context.Context, offset, limit int, filter DeviceFilter) ([]*Device, error) {
+	shardLimit := 0
+	if limit > 0 {
+		shardLimit = offset + limit
+	}
+	devices := make([]*Device, 0)
+	for i, shard := range sc.shards {
+		shardDevices, err := ListDevices(ctx, shard, 0, shardLimit, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list devices in shard #%d: %w", i, err)
+		}
+		for _, device := range shardDevices {
+			devices = append(devices, sc.wrapDevice(device))
+		}
+	}
+	sortDevices(devices)
+	return pageDevices(devices, offset, limit), nil
+}
+
+// PutDevice stores the given device in the shard it belongs to.
+func (sc *ShardedContainer) PutDevice(ctx context.Context, device *Device) error {
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	err := sc.ShardFor(*device.ID).PutDevice(ctx, device)
+	// The shard may have initialized the stores and replaced the container field
+	sc.wrapDevice(device)
+	return err
+}
+
+// PutLastSeen stores the last seen time of the given device in the shard it belongs to.
+func (sc *ShardedContainer) PutLastSeen(ctx context.Context, device *Device) error {
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	if updater, ok := sc.ShardFor(*device.ID).(LastSeenUpdater); ok {
+		return updater.PutLastSeen(ctx, device)
+	}
+	return sc.PutDevice(ctx, device)
+}
+
+// DeleteDevice deletes the given device from the shard it belongs to.
+func (sc *ShardedContainer) DeleteDevice(ctx context.Context, device *Device) error {
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	return sc.ShardFor(*device.ID).DeleteDevice(ctx, device)
+}
@@ -0,0 +1,56 @@
+package store_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestShardedContainer(t *testing.T) {
+	ctx := context.Background()
+	shards := []store.Container{inmemstore.New(nil), inmemstore.New(nil), inmemstore.New(nil)}
+	container := store.NewShardedContainer(shards...)
+
+	const deviceCount = 300
+	for i := 0; i < deviceCount; i++ {
+		device := container.NewDevice()
+		jid := types.NewADJID(strconv.Itoa(1000000+i), 0, 1)
+		device.ID = &jid
+		if err := device.Save(ctx); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+		if device.Container != container {
+			t.Fatalf("Expected device container to be the sharded container")
+		}
+		if found, _ := container.ShardFor(jid).GetDevice(ctx, jid); found != device {
+			t.Fatalf("Device %s wasn't stored in the shard it's routed to", jid)
+		}
+	}
+
+	for i, shard := range shards {
+		devices, _ := shard.GetAllDevices(ctx)
+		if len(devices) < deviceCount/10 {
+			t.Errorf("Shard #%d only got %d devices", i, len(devices))
+		}
+	}
+	if devices, _ := container.GetAllDevices(ctx); len(devices) != deviceCount {
+		t.Errorf("Expected %d devices in total, got %d", deviceCount, len(devices))
+	}
+
+	// Adding a shard should only move some of the devices
+	grown := store.NewShardedContainer(append(shards, inmemstore.New(nil))...)
+	moved := 0
+	for i := 0; i < deviceCount; i++ {
+		jid := types.NewADJID(strconv.Itoa(1000000+i), 0, 1)
+		if grown.ShardFor(jid) != container.ShardFor(jid) {
+			moved++
+		}
+	}
+	if moved == 0 || moved > deviceCount/2 {
+		t.Errorf("Unexpected number of devices moved after adding a shard: %d", moved)
+	}
+}
@@ -7,6 +7,7 @@
 package store
 
 import (
+	"context"
 	"go.mau.fi/libsignal/ecc"
 	groupRecord "go.mau.fi/libsignal/groups/state/record"
 	"go.mau.fi/libsignal/keys/identity"
@@ -35,7 +36,7 @@ func (device *Device) GetLocalRegistrationId() uint32 {
 
 func (device *Device) SaveIdentity(address *protocol.SignalAddress, identityKey *identity.Key) {
 	for i := 0; ; i++ {
-		err := device.Identities.PutIdentity(address.String(), identityKey.PublicKey().PublicKey())
+		err := device.Identities.PutIdentity(context.TODO(), address.String(), identityKey.PublicKey().PublicKey())
 		if err == nil || !device.handleDatabaseError(i, err, "save identity of %s", address.String()) {
 			break
 		}
@@ -44,7 +45,7 @@ func (device *Device) SaveIdentity(address *protocol.SignalAddress, identityKey
 
 func (device *Device) IsTrustedIdentity(address *protocol.SignalAddress, identityKey *identity.Key) bool {
 	for i := 0; ; i++ {
-		isTrusted, err := device.Identities.IsTrustedIdentity(address.String(), identityKey.PublicKey().PublicKey())
+		isTrusted, err := device.Identities.IsTrustedIdentity(context.TODO(), address.String(), identityKey.PublicKey().PublicKey())
 		if err == nil || !device.handleDatabaseError(i, err, "check if %s's identity is trusted", address.String()) {
 			return isTrusted
 		}
@@ -55,7 +56,7 @@ func (device *Device) LoadPreKey(id uint32) *record.PreKey {
 	var preKey *keys.PreKey
 	for i := 0; ; i++ {
 		var err error
-		preKey, err = device.PreKeys.GetPreKey(id)
+		preKey, err = device.PreKeys.GetPreKey(context.TODO(), id)
 		if err == nil || !device.handleDatabaseError(i, err, "load prekey %d", id) {
 			break
 		}
@@ -71,7 +72,7 @@ func (device *Device) LoadPreKey(id uint32) *record.PreKey {
 
 func (device *Device) RemovePreKey(id uint32) {
 	for i := 0; ; i++ {
-		err := device.PreKeys.RemovePreKey(id)
+		err := device.PreKeys.RemovePreKey(context.TODO(), id)
 		if err == nil || !device.handleDatabaseError(i, err, "remove prekey %d", id) {
 			break
 		}
@@ -90,7 +91,7 @@ func (device *Device) LoadSession(address *protocol.SignalAddress) *record.Sessi
 	var rawSess []byte
 	for i := 0; ; i++ {
 		var err error
-		rawSess, err = device.Sessions.GetSession(address.String())
+		rawSess, err = device.Sessions.GetSession(context.TODO(), address.String())
 		if err == nil || !device.handleDatabaseError(i, err, "load session with %s", address.String()) {
 			break
 		}
@@ -112,7 +113,7 @@ func (device *Device) GetSubDeviceSessions(name string) []uint32 {
 
 func (device *Device) StoreSession(address *protocol.SignalAddress, record *record.Session) {
 	for i := 0; ; i++ {
-		err := device.Sessions.PutSession(address.String(), record.Serialize())
+		err := device.Sessions.PutSession(context.TODO(), address.String(), record.Serialize())
 		if err == nil || !device.handleDatabaseError(i, err, "store session with %s", address.String()) {
 			return
 		}
@@ -121,7 +122,7 @@ func (device *Device) StoreSession(address *protocol.SignalAddress, record *reco
 
 func (device *Device) ContainsSession(remoteAddress *protocol.SignalAddress) bool {
 	for i := 0; ; i++ {
-		hasSession, err := device.Sessions.HasSession(remoteAddress.String())
+		hasSession, err := device.Sessions.HasSession(context.TODO(), remoteAddress.String())
 		if err == nil || !device.handleDatabaseError(i, err, "store has session for %s", remoteAddress.String()) {
 			return hasSession
 		}
@@ -164,7 +165,7 @@ func (device *Device) RemoveSignedPreKey(signedPreKeyID uint32) {
 
 func (device *Device) StoreSenderKey(senderKeyName *protocol.SenderKeyName, keyRecord *groupRecord.SenderKey) {
 	for i := 0; ; i++ {
-		err := device.SenderKeys.PutSenderKey(senderKeyName.GroupID(), senderKeyName.Sender().String(), keyRecord.Serialize())
+		err := device.SenderKeys.PutSenderKey(context.TODO(), senderKeyName.GroupID(), senderKeyName.Sender().String(), keyRecord.Serialize())
 		if err == nil || !device.handleDatabaseError(i, err, "store sender key from %s", senderKeyName.Sender().String()) {
 			return
 		}
@@ -175,7 +176,7 @@ func (device *Device) LoadSenderKey(senderKeyName *protocol.SenderKeyName) *grou
 	var rawKey []byte
 	for i := 0; ; i++ {
 		var err error
-		rawKey, err = device.SenderKeys.GetSenderKey(senderKeyName.GroupID(), senderKeyName.Sender().String())
+		rawKey, err = device.SenderKeys.GetSenderKey(context.TODO(), senderKeyName.GroupID(), senderKeyName.Sender().String())
 		if err == nil || !device.handleDatabaseError(i, err, "load sender key from %s for %s", senderKeyName.Sender().String(), senderKeyName.GroupID()) {
 			break
 		}
@@ -7,11 +7,13 @@
 package sqlstore
 
 import (
-	"crypto/rand"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	mathRand "math/rand"
+	"math"
+	"strings"
+	"time"
 
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
 	"github.com/insomnius/whatsmeow/store"
@@ -22,26 +24,57 @@ import (
 
 // Container is a wrapper for a SQL database that can contain multiple whatsmeow sessions.
 type Container struct {
-	db      *sql.DB
+	db      *dialectDB
 	dialect string
 	log     waLog.Logger
+	tenant  string
 
 	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
+	// MetricsHook is called after every operation on the stores of the devices in this container, if set.
+	MetricsHook store.MetricsHook
+	// ReadOnly makes the container reject PutDevice, DeleteDevice and all writes to the stores of its devices
+	// with a store.ReadOnlyError, which is useful for analysis tools and standby replicas.
+	// Note that New upgrades the database schema, so use NewWithDB with a read-only database user.
+	ReadOnly bool
+	// StoreMessages makes the devices in this container save their message history in the database.
+	StoreMessages bool
+	// EnableOutbox makes the devices in this container queue messages that are sent while the client
+	// is disconnected in the database, see store.OutboxStore.
+	EnableOutbox bool
+	// EnableScheduler makes the devices in this container store scheduled messages in the database,
+	// see store.ScheduleStore.
+	EnableScheduler bool
+	// TrackReactions makes the devices in this container store the reactions to messages in the database,
+	// see store.ReactionStore.
+	TrackReactions bool
+	// TrackPolls makes the devices in this container store polls and decrypted poll votes in the database,
+	// see store.PollStore.
+	TrackPolls bool
 }
 
-var _ store.DeviceContainer = (*Container)(nil)
+var _ store.Container = (*Container)(nil)
 
 // New connects to the given SQL database and wraps it in a Container.
 //
-// Only SQLite and Postgres are currently fully supported.
+// SQLite, Postgres and MySQL/MariaDB are currently fully supported.
 //
 // The logger can be nil and will default to a no-op logger.
 //
 // When using SQLite, it's strongly recommended to enable foreign keys by adding `?_foreign_keys=true`:
 //
 //	container, err := sqlstore.New("sqlite3", "file:yoursqlitefile.db?_foreign_keys=on", nil)
-func New(dialect, address string, log waLog.Logger) (*Container, error) {
-	db, err := sql.Open(dialect, address)
+//
+// Options can be used to tune SQLite for concurrent access, which avoids `database is locked` errors
+// when lots of messages are handled at the same time:
+//
+//	container, err := sqlstore.New("sqlite3", "file:yoursqlitefile.db?_foreign_keys=on", nil,
+//		sqlstore.WithJournalMode("WAL"), sqlstore.WithBusyTimeout(5*time.Second), sqlstore.WithSynchronous("NORMAL"))
+func New(dialect, address string, log waLog.Logger, opts ...Option) (*Container, error) {
+	var options openOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	db, err := options.open(dialect, address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -55,7 +88,7 @@ func New(dialect, address string, log waLog.Logger) (*Container, error) {
 
 // NewWithDB wraps an existing SQL connection in a Container.
 //
-// Only SQLite and Postgres are currently fully supported.
+// SQLite, Postgres and MySQL/MariaDB are currently fully supported.
 //
 // The logger can be nil and will default to a no-op logger.
 //
@@ -71,21 +104,53 @@ func NewWithDB(db *sql.DB, dialect string, log waLog.Logger) *Container {
 		log = waLog.Noop
 	}
 	return &Container{
-		db:      db,
+		db:      newDialectDB(db, dialect),
 		dialect: dialect,
 		log:     log,
 	}
 }
 
+// WithTenant returns a Container that shares the database connection with this one, but only sees the devices
+// of the given tenant. Devices saved through the returned container are assigned to the tenant.
+//
+// Containers created with New or NewWithDB use the empty default tenant. Device JIDs are still unique across
+// the whole database, so saving a device that belongs to another tenant fails with ErrDeviceBelongsToOtherTenant.
+//
+//	customerContainer := container.WithTenant("customer-42")
+//	devices, err := customerContainer.GetAllDevices(ctx)
+func (c *Container) WithTenant(tenant string) *Container {
+	return &Container{
+		db:      c.db,
+		dialect: c.dialect,
+		log:     c.log,
+		tenant:  tenant,
+
+		DatabaseErrorHandler: c.DatabaseErrorHandler,
+		MetricsHook:          c.MetricsHook,
+		ReadOnly:             c.ReadOnly,
+		StoreMessages:        c.StoreMessages,
+		EnableOutbox:         c.EnableOutbox,
+		EnableScheduler:      c.EnableScheduler,
+		TrackReactions:       c.TrackReactions,
+		TrackPolls:           c.TrackPolls,
+	}
+}
+
+// Tenant returns the tenant whose devices this container can access.
+func (c *Container) Tenant() string {
+	return c.tenant
+}
+
 const getAllDevicesQuery = `
 SELECT jid, registration_id, noise_key, identity_key,
        signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
        adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-       platform, business_name, push_name
+       platform, business_name, push_name, last_seen
 FROM whatsmeow_device
 `
 
-const getDeviceQuery = getAllDevicesQuery + " WHERE jid=$1"
+const getTenantDevicesQuery = getAllDevicesQuery + " WHERE tenant=$1"
+const getDeviceQuery = getAllDevicesQuery + " WHERE jid=$1 AND tenant=$2"
 
 type scannable interface {
 	Scan(dest ...interface{}) error
@@ -97,13 +162,14 @@ func (c *Container) scanDevice(row scannable) (*store.Device, error) {
 	device.Log = c.log
 	device.SignedPreKey = &keys.PreKey{}
 	var noisePriv, identityPriv, preKeyPriv, preKeySig []byte
+	var lastSeen int64
 	var account waProto.ADVSignedDeviceIdentity
 
 	err := row.Scan(
 		&device.ID, &device.RegistrationID, &noisePriv, &identityPriv,
 		&preKeyPriv, &device.SignedPreKey.KeyID, &preKeySig,
 		&device.AdvSecretKey, &account.Details, &account.AccountSignature, &account.AccountSignatureKey, &account.DeviceSignature,
-		&device.Platform, &device.BusinessName, &device.PushName)
+		&device.Platform, &device.BusinessName, &device.PushName, &lastSeen)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan session: %w", err)
 	} else if len(noisePriv) != 32 || len(identityPriv) != 32 || len(preKeyPriv) != 32 || len(preKeySig) != 64 {
@@ -115,6 +181,9 @@ func (c *Container) scanDevice(row scannable) (*store.Device, error) {
 	device.SignedPreKey.KeyPair = *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(preKeyPriv))
 	device.SignedPreKey.Signature = (*[64]byte)(preKeySig)
 	device.Account = &account
+	if lastSeen != 0 {
+		device.LastSeen = time.Unix(lastSeen, 0)
+	}
 
 	innerStore := NewSQLStore(c, *device.ID)
 	device.Identities = innerStore
@@ -126,15 +195,34 @@ func (c *Container) scanDevice(row scannable) (*store.Device, error) {
 	device.Contacts = innerStore
 	device.ChatSettings = innerStore
 	device.MsgSecrets = innerStore
+	if c.StoreMessages {
+		device.Messages = innerStore
+	}
+	if c.EnableOutbox {
+		device.Outbox = innerStore
+	}
+	if c.EnableScheduler {
+		device.Schedule = innerStore
+	}
+	if c.TrackReactions {
+		device.Reactions = innerStore
+	}
+	if c.TrackPolls {
+		device.Polls = innerStore
+	}
 	device.Container = c
 	device.Initialized = true
+	if c.ReadOnly {
+		store.MakeDeviceReadOnly(&device)
+	}
+	store.InstrumentDevice(&device, "sqlstore", c.MetricsHook)
 
 	return &device, nil
 }
 
-// GetAllDevices finds all the devices in the database.
-func (c *Container) GetAllDevices() ([]*store.Device, error) {
-	res, err := c.db.Query(getAllDevicesQuery)
+// GetAllDevices finds all the devices of this container's tenant in the database.
+func (c *Container) GetAllDevices(ctx context.Context) ([]*store.Device, error) {
+	res, err := c.db.QueryContext(ctx, getTenantDevicesQuery, c.tenant)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sessions: %w", err)
 	}
@@ -149,11 +237,66 @@ func (c *Container) GetAllDevices() ([]*store.Device, error) {
 	return sessions, nil
 }
 
+var _ store.DeviceLister = (*Container)(nil)
+
+// likeEscaper escapes the wildcards of LIKE patterns, using ! as the escape character,
+// as backslashes are treated differently in MySQL string literals.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// ListDevices finds a page of the devices of this container's tenant that match the filter.
+// The filtering and pagination are done in the database, so only the returned devices are loaded.
+func (c *Container) ListDevices(ctx context.Context, offset, limit int, filter store.DeviceFilter) ([]*store.Device, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	query := getTenantDevicesQuery
+	args := []interface{}{c.tenant}
+	addClause := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(clause, len(args))
+	}
+	if filter.PushName != "" {
+		addClause(" AND LOWER(push_name) LIKE $%d ESCAPE '!'", "%"+likeEscaper.Replace(strings.ToLower(filter.PushName))+"%")
+	}
+	if filter.Platform != "" {
+		addClause(" AND platform=$%d", filter.Platform)
+	}
+	if !filter.LastSeenAfter.IsZero() {
+		addClause(" AND last_seen>$%d", filter.LastSeenAfter.Unix())
+	}
+	if !filter.LastSeenBefore.IsZero() {
+		addClause(" AND last_seen<$%d", filter.LastSeenBefore.Unix())
+	}
+	query += " ORDER BY jid"
+	if limit > 0 || offset > 0 {
+		if limit <= 0 {
+			// SQLite and MySQL don't allow OFFSET without LIMIT
+			limit = math.MaxInt
+		}
+		args = append(args, limit, offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+	res, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer res.Close()
+	devices := make([]*store.Device, 0)
+	for res.Next() {
+		device, scanErr := c.scanDevice(res)
+		if scanErr != nil {
+			return devices, scanErr
+		}
+		devices = append(devices, device)
+	}
+	return devices, res.Err()
+}
+
 // GetFirstDevice is a convenience method for getting the first device in the store. If there are
 // no devices, then a new device will be created. You should only use this if you don't want to
 // have multiple sessions simultaneously.
-func (c *Container) GetFirstDevice() (*store.Device, error) {
-	devices, err := c.GetAllDevices()
+func (c *Container) GetFirstDevice(ctx context.Context) (*store.Device, error) {
+	devices, err := c.GetAllDevices(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -169,8 +312,8 @@ func (c *Container) GetFirstDevice() (*store.Device, error) {
 // If the device is not found, nil is returned instead.
 //
 // Note that the parameter usually must be an AD-JID.
-func (c *Container) GetDevice(jid types.JID) (*store.Device, error) {
-	sess, err := c.scanDevice(c.db.QueryRow(getDeviceQuery, jid))
+func (c *Container) GetDevice(ctx context.Context, jid types.JID) (*store.Device, error) {
+	sess, err := c.scanDevice(c.db.QueryRowContext(ctx, getDeviceQuery, jid, c.tenant))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -182,12 +325,29 @@ const (
 		INSERT INTO whatsmeow_device (jid, registration_id, noise_key, identity_key,
 									  signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
 									  adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-									  platform, business_name, push_name)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+									  platform, business_name, push_name, last_seen, tenant)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		ON CONFLICT (jid) DO UPDATE
-		    SET platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name
+		    SET platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name,
+		        last_seen=excluded.last_seen
+		    WHERE whatsmeow_device.tenant=excluded.tenant
 	`
-	deleteDeviceQuery = `DELETE FROM whatsmeow_device WHERE jid=$1`
+	// MySQL doesn't support conditional upserts, so the tenant check is done for each updated column
+	insertDeviceQueryMySQL = `
+		INSERT INTO whatsmeow_device (jid, registration_id, noise_key, identity_key,
+									  signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
+									  adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
+									  platform, business_name, push_name, last_seen, tenant)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON DUPLICATE KEY UPDATE
+		    platform=IF(tenant=VALUES(tenant), VALUES(platform), platform),
+		    business_name=IF(tenant=VALUES(tenant), VALUES(business_name), business_name),
+		    push_name=IF(tenant=VALUES(tenant), VALUES(push_name), push_name),
+		    last_seen=IF(tenant=VALUES(tenant), VALUES(last_seen), last_seen)
+	`
+	getDeviceTenantQuery = `SELECT tenant FROM whatsmeow_device WHERE jid=$1`
+	deleteDeviceQuery    = `DELETE FROM whatsmeow_device WHERE jid=$1 AND tenant=$2`
+	putLastSeenQuery     = `UPDATE whatsmeow_device SET last_seen=$1 WHERE jid=$2 AND tenant=$3`
 )
 
 // NewDevice creates a new device in this database.
@@ -195,39 +355,44 @@ const (
 // No data is actually stored before Save is called. However, the pairing process will automatically
 // call Save after a successful pairing, so you most likely don't need to call it yourself.
 func (c *Container) NewDevice() *store.Device {
-	device := &store.Device{
-		Log:       c.log,
-		Container: c,
-
-		DatabaseErrorHandler: c.DatabaseErrorHandler,
-
-		NoiseKey:       keys.NewKeyPair(),
-		IdentityKey:    keys.NewKeyPair(),
-		RegistrationID: mathRand.Uint32(),
-		AdvSecretKey:   make([]byte, 32),
-	}
-	_, err := rand.Read(device.AdvSecretKey)
-	if err != nil {
-		panic(err)
-	}
-	device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(1)
+	device := store.NewBlankDevice(c, c.log)
+	device.DatabaseErrorHandler = c.DatabaseErrorHandler
 	return device
 }
 
 // ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
 var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing database")
 
+// ErrDeviceBelongsToOtherTenant is returned by PutDevice if the device is already stored under a different tenant.
+var ErrDeviceBelongsToOtherTenant = errors.New("device is already stored under a different tenant")
+
 // PutDevice stores the given device in this database. This should be called through Device.Save()
 // (which usually doesn't need to be called manually, as the library does that automatically when relevant).
-func (c *Container) PutDevice(device *store.Device) error {
+func (c *Container) PutDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutDevice"}
+	}
 	if device.ID == nil {
 		return ErrDeviceIDMustBeSet
 	}
-	_, err := c.db.Exec(insertDeviceQuery,
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	query := insertDeviceQuery
+	if isMySQL(c.dialect) {
+		query = insertDeviceQueryMySQL
+	}
+	res, err := c.db.ExecContext(ctx, query,
 		device.ID.String(), device.RegistrationID, device.NoiseKey.Priv[:], device.IdentityKey.Priv[:],
 		device.SignedPreKey.Priv[:], device.SignedPreKey.KeyID, device.SignedPreKey.Signature[:],
 		device.AdvSecretKey, device.Account.Details, device.Account.AccountSignature, device.Account.AccountSignatureKey, device.Account.DeviceSignature,
-		device.Platform, device.BusinessName, device.PushName)
+		device.Platform, device.BusinessName, device.PushName, lastSeen, c.tenant)
+	if err == nil {
+		if affected, _ := res.RowsAffected(); affected == 0 && !c.ownsDevice(ctx, device.ID.String()) {
+			return ErrDeviceBelongsToOtherTenant
+		}
+	}
 
 	if !device.Initialized {
 		innerStore := NewSQLStore(c, *device.ID)
@@ -237,19 +402,69 @@ func (c *Container) PutDevice(device *store.Device) error {
 		device.SenderKeys = innerStore
 		device.AppStateKeys = innerStore
 		device.AppState = innerStore
-		device.Contacts = innerStore
+		if device.Contacts == nil {
+			device.Contacts = innerStore
+		}
 		device.ChatSettings = innerStore
 		device.MsgSecrets = innerStore
+		if c.StoreMessages && device.Messages == nil {
+			device.Messages = innerStore
+		}
+		if c.EnableOutbox && device.Outbox == nil {
+			device.Outbox = innerStore
+		}
+		if c.EnableScheduler && device.Schedule == nil {
+			device.Schedule = innerStore
+		}
+		if c.TrackReactions && device.Reactions == nil {
+			device.Reactions = innerStore
+		}
+		if c.TrackPolls && device.Polls == nil {
+			device.Polls = innerStore
+		}
 		device.Initialized = true
+		if c.ReadOnly {
+			store.MakeDeviceReadOnly(device)
+		}
+		store.InstrumentDevice(device, "sqlstore", c.MetricsHook)
+	}
+	return err
+}
+
+// ownsDevice checks whether the device with the given JID is stored under this container's tenant.
+//
+// MySQL doesn't count rows that an upsert didn't change as affected, so a device that was saved
+// again without changes looks the same as a device of another tenant.
+func (c *Container) ownsDevice(ctx context.Context, jid string) bool {
+	var tenant string
+	err := c.db.QueryRowContext(ctx, getDeviceTenantQuery, jid).Scan(&tenant)
+	return err == nil && tenant == c.tenant
+}
+
+// PutLastSeen stores only the last seen time of the given device, which is cheaper than saving the whole device.
+func (c *Container) PutLastSeen(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "PutLastSeen"}
 	}
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	var lastSeen int64
+	if !device.LastSeen.IsZero() {
+		lastSeen = device.LastSeen.Unix()
+	}
+	_, err := c.db.ExecContext(ctx, putLastSeenQuery, lastSeen, device.ID.String(), c.tenant)
 	return err
 }
 
 // DeleteDevice deletes the given device from this database. This should be called through Device.Delete()
-func (c *Container) DeleteDevice(store *store.Device) error {
-	if store.ID == nil {
+func (c *Container) DeleteDevice(ctx context.Context, device *store.Device) error {
+	if c.ReadOnly {
+		return &store.ReadOnlyError{Operation: "DeleteDevice"}
+	}
+	if device.ID == nil {
 		return ErrDeviceIDMustBeSet
 	}
-	_, err := c.db.Exec(deleteDeviceQuery, store.ID.String())
+	_, err := c.db.ExecContext(ctx, deleteDeviceQuery, device.ID.String(), c.tenant)
 	return err
 }
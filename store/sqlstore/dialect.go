@@ -0,0 +1,181 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The queries in this package are written for Postgres and SQLite. When using MySQL or MariaDB,
+// they're rewritten on the fly by dialectDB, which converts the parts that MySQL doesn't understand:
+//
+//   - numbered placeholders ($1) become positional ones (?), with the arguments reordered to match
+//   - ON CONFLICT upserts become ON DUPLICATE KEY UPDATE
+//   - the WHERE clause of conditional upserts is moved into an IF() in each assignment, which only works
+//     if the columns used in the condition are assigned last, as MySQL applies the assignments in order
+//   - the reserved column name key is quoted with backticks
+
+func isMySQL(dialect string) bool {
+	return dialect == "mysql"
+}
+
+var (
+	conflictUpdateRegex  = regexp.MustCompile(`ON CONFLICT\s*\([^)]*\)\s*DO UPDATE\s+SET`)
+	conflictWhereRegex   = regexp.MustCompile(`(?s)(ON CONFLICT\s*\([^)]*\)\s*DO UPDATE\s+SET)\s+(.*?)\s+WHERE\s+(.*?)\s*$`)
+	conflictNothingRegex = regexp.MustCompile(`ON CONFLICT\s*\(\s*(\w+)[^)]*\)\s*DO NOTHING`)
+	excludedColumnRegex  = regexp.MustCompile(`excluded\.(\w+)`)
+	keyColumnRegex       = regexp.MustCompile(`\bkey\b`)
+)
+
+// rewrittenQuery is a query converted for MySQL along with the order of the original arguments.
+type rewrittenQuery struct {
+	query string
+	// argOrder contains the zero-based index of the original argument used for each placeholder.
+	argOrder []int
+}
+
+func (rq *rewrittenQuery) args(args []interface{}) []interface{} {
+	reordered := make([]interface{}, len(rq.argOrder))
+	for i, index := range rq.argOrder {
+		if index < len(args) {
+			reordered[i] = args[index]
+		}
+	}
+	return reordered
+}
+
+// rewriteConditionalUpsert converts `DO UPDATE SET a=x, b=y WHERE cond` into `DO UPDATE SET a=IF(cond, x, a), b=IF(cond, y, b)`.
+func rewriteConditionalUpsert(query string) string {
+	match := conflictWhereRegex.FindStringSubmatchIndex(query)
+	if match == nil {
+		return query
+	}
+	cond := query[match[6]:match[7]]
+	assignments := strings.Split(query[match[4]:match[5]], ",")
+	for i, assignment := range assignments {
+		parts := strings.SplitN(assignment, "=", 2)
+		column := strings.TrimSpace(parts[0])
+		assignments[i] = fmt.Sprintf("%s=IF(%s, %s, %s)", column, cond, strings.TrimSpace(parts[1]), column)
+	}
+	return query[:match[3]] + " " + strings.Join(assignments, ", ") + query[match[7]:]
+}
+
+func rewriteForMySQL(query string) *rewrittenQuery {
+	query = rewriteConditionalUpsert(query)
+	query = conflictUpdateRegex.ReplaceAllString(query, "ON DUPLICATE KEY UPDATE")
+	// MySQL doesn't have DO NOTHING, but assigning a column to itself is a no-op
+	query = conflictNothingRegex.ReplaceAllString(query, "ON DUPLICATE KEY UPDATE $1=$1")
+	query = excludedColumnRegex.ReplaceAllString(query, "VALUES($1)")
+	query = keyColumnRegex.ReplaceAllString(query, "`key`")
+
+	var out strings.Builder
+	out.Grow(len(query))
+	var argOrder []int
+	inString := false
+	for i := 0; i < len(query); i++ {
+		char := query[i]
+		if char == '\'' {
+			inString = !inString
+		} else if char == '$' && !inString && i+1 < len(query) && isDigit(query[i+1]) {
+			index := 0
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+				index = index*10 + int(query[i]-'0')
+			}
+			argOrder = append(argOrder, index-1)
+			out.WriteByte('?')
+			continue
+		}
+		out.WriteByte(char)
+	}
+	return &rewrittenQuery{query: out.String(), argOrder: argOrder}
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+// queryRewriter converts queries for the dialect of the database and caches the results.
+type queryRewriter struct {
+	enabled bool
+	cache   sync.Map
+}
+
+func (qr *queryRewriter) rewrite(query string, args []interface{}) (string, []interface{}) {
+	if !qr.enabled {
+		return query, args
+	}
+	cached, ok := qr.cache.Load(query)
+	if !ok {
+		cached, _ = qr.cache.LoadOrStore(query, rewriteForMySQL(query))
+	}
+	rq := cached.(*rewrittenQuery)
+	return rq.query, rq.args(args)
+}
+
+// dialectDB is a wrapper for sql.DB that rewrites queries for the database dialect.
+type dialectDB struct {
+	*sql.DB
+	rewriter *queryRewriter
+}
+
+func newDialectDB(db *sql.DB, dialect string) *dialectDB {
+	return &dialectDB{DB: db, rewriter: &queryRewriter{enabled: isMySQL(dialect)}}
+}
+
+func (db *dialectDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *dialectDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = db.rewriter.rewrite(query, args)
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *dialectDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *dialectDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = db.rewriter.rewrite(query, args)
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *dialectDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *dialectDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query, args = db.rewriter.rewrite(query, args)
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *dialectDB) Begin() (*dialectTx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+func (db *dialectDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dialectTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dialectTx{Tx: tx, rewriter: db.rewriter}, nil
+}
+
+// dialectTx is a wrapper for sql.Tx that rewrites queries for the database dialect.
+type dialectTx struct {
+	*sql.Tx
+	rewriter *queryRewriter
+}
+
+func (tx *dialectTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+func (tx *dialectTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = tx.rewriter.rewrite(query, args)
+	return tx.Tx.ExecContext(ctx, query, args...)
+}
@@ -0,0 +1,58 @@
+package sqlstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteForMySQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		args     []interface{}
+		newArgs  []interface{}
+	}{{
+		name:     "upsert",
+		query:    putSessionQuery,
+		expected: "INSERT INTO whatsmeow_sessions (our_jid, their_id, session, updated_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE session=VALUES(session), updated_at=VALUES(updated_at)",
+		args:     []interface{}{"a", "b", "c", 4},
+		newArgs:  []interface{}{"a", "b", "c", 4},
+	}, {
+		name:     "do nothing",
+		query:    putMsgSecret,
+		expected: "INSERT INTO whatsmeow_message_secrets (our_jid, chat_jid, sender_jid, message_id, `key`) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE our_jid=our_jid",
+		args:     []interface{}{1, 2, 3, 4, 5},
+		newArgs:  []interface{}{1, 2, 3, 4, 5},
+	}, {
+		name:     "conditional upsert",
+		query:    putReactionQuery,
+		expected: "INSERT INTO whatsmeow_reactions (our_jid, chat_jid, message_id, sender_jid, reaction, timestamp) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE reaction=IF(whatsmeow_reactions.timestamp<VALUES(timestamp), VALUES(reaction), reaction), timestamp=IF(whatsmeow_reactions.timestamp<VALUES(timestamp), VALUES(timestamp), timestamp)",
+		args:     []interface{}{1, 2, 3, 4, 5, 6},
+		newArgs:  []interface{}{1, 2, 3, 4, 5, 6},
+	}, {
+		name:     "reused placeholders",
+		query:    "INSERT INTO x (a, b) VALUES ($1, $2), ($1, $3) ON CONFLICT (a, b) DO NOTHING",
+		expected: "INSERT INTO x (a, b) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE a=a",
+		args:     []interface{}{"a", "b", "c"},
+		newArgs:  []interface{}{"a", "b", "a", "c"},
+	}, {
+		name:     "string literal",
+		query:    "SELECT key_id, key FROM t WHERE a='$1' AND b=$1",
+		expected: "SELECT key_id, `key` FROM t WHERE a='$1' AND b=?",
+		args:     []interface{}{"x"},
+		newArgs:  []interface{}{"x"},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rq := rewriteForMySQL(test.query)
+			if actual := strings.Join(strings.Fields(rq.query), " "); actual != test.expected {
+				t.Errorf("Unexpected query:\n%s\nexpected:\n%s", actual, test.expected)
+			}
+			if args := rq.args(test.args); !reflect.DeepEqual(args, test.newArgs) {
+				t.Errorf("Unexpected args %v, expected %v", args, test.newArgs)
+			}
+		})
+	}
+}
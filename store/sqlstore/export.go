@@ -0,0 +1,222 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/util/keys"
+)
+
+var _ store.DataExporter = (*SQLStore)(nil)
+var _ store.PreKeyImporter = (*SQLStore)(nil)
+
+const (
+	exportIdentitiesQuery       = `SELECT their_id, identity FROM whatsmeow_identity_keys WHERE our_jid=$1`
+	exportSessionsQuery         = `SELECT their_id, session FROM whatsmeow_sessions WHERE our_jid=$1`
+	exportPreKeysQuery          = `SELECT key_id, key, uploaded FROM whatsmeow_pre_keys WHERE jid=$1 ORDER BY key_id`
+	exportSenderKeysQuery       = `SELECT chat_id, sender_id, sender_key FROM whatsmeow_sender_keys WHERE our_jid=$1`
+	exportAppStateSyncKeysQuery = `SELECT key_id, key_data, timestamp, fingerprint FROM whatsmeow_app_state_sync_keys WHERE jid=$1`
+	exportAppStateVersionsQuery = `SELECT name, version, hash FROM whatsmeow_app_state_version WHERE jid=$1`
+	exportMutationMACsQuery     = `SELECT name, version, index_mac, value_mac FROM whatsmeow_app_state_mutation_macs WHERE jid=$1 ORDER BY version`
+	exportChatSettingsQuery     = `SELECT chat_jid, muted_until, pinned, archived FROM whatsmeow_chat_settings WHERE our_jid=$1`
+	exportMessageSecretsQuery   = `SELECT chat_jid, sender_jid, message_id, key FROM whatsmeow_message_secrets WHERE our_jid=$1`
+)
+
+func (s *SQLStore) exportRows(ctx context.Context, query string, fn func(rows *sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, query, s.JID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = fn(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportData returns all the data stored for this device. It's used by store.Migrate to move devices to another container.
+func (s *SQLStore) ExportData(ctx context.Context) (*store.ExportedData, error) {
+	data := &store.ExportedData{
+		Identities: make(map[string][32]byte),
+		Sessions:   make(map[string][]byte),
+
+		ChatSettings: make(map[types.JID]types.LocalChatSettings),
+	}
+	err := s.exportRows(ctx, exportIdentitiesQuery, func(rows *sql.Rows) error {
+		var address string
+		var identity []byte
+		if err := rows.Scan(&address, &identity); err != nil {
+			return err
+		} else if len(identity) != 32 {
+			return ErrInvalidLength
+		}
+		data.Identities[address] = *(*[32]byte)(identity)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export identities: %w", err)
+	}
+	err = s.exportRows(ctx, exportSessionsQuery, func(rows *sql.Rows) error {
+		var address string
+		var session []byte
+		if err := rows.Scan(&address, &session); err != nil {
+			return err
+		}
+		data.Sessions[address] = session
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	err = s.exportRows(ctx, exportPreKeysQuery, func(rows *sql.Rows) error {
+		var id uint32
+		var priv []byte
+		var uploaded bool
+		if err := rows.Scan(&id, &priv, &uploaded); err != nil {
+			return err
+		} else if len(priv) != 32 {
+			return ErrInvalidLength
+		}
+		data.PreKeys = append(data.PreKeys, store.PreKeyEntry{
+			PreKey: keys.PreKey{
+				KeyPair: *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(priv)),
+				KeyID:   id,
+			},
+			Uploaded: uploaded,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export prekeys: %w", err)
+	}
+	err = s.exportRows(ctx, exportSenderKeysQuery, func(rows *sql.Rows) error {
+		var entry store.SenderKeyEntry
+		if err := rows.Scan(&entry.Group, &entry.User, &entry.Key); err != nil {
+			return err
+		}
+		data.SenderKeys = append(data.SenderKeys, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sender keys: %w", err)
+	}
+	err = s.exportRows(ctx, exportAppStateSyncKeysQuery, func(rows *sql.Rows) error {
+		var entry store.AppStateSyncKeyEntry
+		if err := rows.Scan(&entry.ID, &entry.Key.Data, &entry.Key.Timestamp, &entry.Key.Fingerprint); err != nil {
+			return err
+		}
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state sync keys: %w", err)
+	}
+	appStateIndexes := make(map[string]int)
+	err = s.exportRows(ctx, exportAppStateVersionsQuery, func(rows *sql.Rows) error {
+		var entry store.AppStateEntry
+		var hash []byte
+		if err := rows.Scan(&entry.Name, &entry.Version, &hash); err != nil {
+			return err
+		} else if len(hash) != 128 {
+			return ErrInvalidLength
+		}
+		entry.Hash = *(*[128]byte)(hash)
+		appStateIndexes[entry.Name] = len(data.AppStates)
+		data.AppStates = append(data.AppStates, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state versions: %w", err)
+	}
+	// The same index MAC may be stored for multiple versions, only the latest one is used.
+	mutationMACs := make(map[string]map[string]store.AppStateMutationMACEntry)
+	err = s.exportRows(ctx, exportMutationMACsQuery, func(rows *sql.Rows) error {
+		var name string
+		var version int64
+		var indexMAC, valueMAC []byte
+		if err := rows.Scan(&name, &version, &indexMAC, &valueMAC); err != nil {
+			return err
+		}
+		if mutationMACs[name] == nil {
+			mutationMACs[name] = make(map[string]store.AppStateMutationMACEntry)
+		}
+		mutationMACs[name][string(indexMAC)] = store.AppStateMutationMACEntry{
+			AppStateMutationMAC: store.AppStateMutationMAC{IndexMAC: indexMAC, ValueMAC: valueMAC},
+			Version:             uint64(version),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state mutation MACs: %w", err)
+	}
+	for name, macs := range mutationMACs {
+		index, ok := appStateIndexes[name]
+		if !ok {
+			continue
+		}
+		for _, mac := range macs {
+			data.AppStates[index].MutationMACs = append(data.AppStates[index].MutationMACs, mac)
+		}
+	}
+	data.Contacts, err = s.GetAllContacts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export contacts: %w", err)
+	}
+	err = s.exportRows(ctx, exportChatSettingsQuery, func(rows *sql.Rows) error {
+		var chat types.JID
+		var mutedUntil int64
+		settings := types.LocalChatSettings{Found: true}
+		if err := rows.Scan(&chat, &mutedUntil, &settings.Pinned, &settings.Archived); err != nil {
+			return err
+		}
+		if mutedUntil != 0 {
+			settings.MutedUntil = time.Unix(mutedUntil, 0)
+		}
+		data.ChatSettings[chat] = settings
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export chat settings: %w", err)
+	}
+	err = s.exportRows(ctx, exportMessageSecretsQuery, func(rows *sql.Rows) error {
+		var entry store.MessageSecretInsert
+		if err := rows.Scan(&entry.Chat, &entry.Sender, &entry.ID, &entry.Secret); err != nil {
+			return err
+		}
+		data.MessageSecrets = append(data.MessageSecrets, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export message secrets: %w", err)
+	}
+	return data, nil
+}
+
+// ImportPreKeys stores the given prekeys. It's used by store.Migrate to move devices from another container.
+func (s *SQLStore) ImportPreKeys(ctx context.Context, preKeys []store.PreKeyEntry) error {
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for _, preKey := range preKeys {
+		_, err = tx.ExecContext(ctx, insertPreKeyQuery, s.JID, preKey.KeyID, preKey.Priv[:], preKey.Uploaded)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.MessageStore = (*SQLStore)(nil)
+
+const (
+	putMessageQuery = `
+		INSERT INTO whatsmeow_messages (our_jid, chat_jid, sender_jid, message_id, timestamp, from_me, push_name, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (our_jid, chat_jid, sender_jid, message_id) DO UPDATE
+			SET timestamp=excluded.timestamp, from_me=excluded.from_me, push_name=excluded.push_name, message=excluded.message
+	`
+	getMessagesQuery = `
+		SELECT chat_jid, sender_jid, message_id, timestamp, from_me, push_name, message FROM whatsmeow_messages WHERE our_jid=$1
+	`
+	getMessageQuery = getMessagesQuery + " AND chat_jid=$2 AND sender_jid=$3 AND message_id=$4"
+)
+
+func (s *SQLStore) PutMessage(ctx context.Context, msg *store.StoredMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, putMessageQuery, s.JID, msg.Chat.ToNonAD(), msg.Sender.ToNonAD(), msg.ID, msg.Timestamp.Unix(), msg.FromMe, msg.PushName, data)
+	return err
+}
+
+func scanMessage(row scannable) (*store.StoredMessage, error) {
+	var msg store.StoredMessage
+	var timestamp int64
+	var data []byte
+	err := row.Scan(&msg.Chat, &msg.Sender, &msg.ID, &timestamp, &msg.FromMe, &msg.PushName, &data)
+	if err != nil {
+		return nil, err
+	}
+	msg.Timestamp = time.Unix(timestamp, 0)
+	msg.Message = &waProto.Message{}
+	err = proto.Unmarshal(data, msg.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message %s: %w", msg.ID, err)
+	}
+	return &msg, nil
+}
+
+func (s *SQLStore) GetMessage(ctx context.Context, chat, sender types.JID, id types.MessageID) (*store.StoredMessage, error) {
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, getMessageQuery, s.JID, chat.ToNonAD(), sender.ToNonAD(), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+func (s *SQLStore) GetMessages(ctx context.Context, query store.MessageQuery) ([]*store.StoredMessage, error) {
+	var conditions strings.Builder
+	args := []interface{}{s.JID}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		_, _ = fmt.Fprintf(&conditions, " AND %s$%d", condition, len(args))
+	}
+	if !query.Chat.IsEmpty() {
+		addCondition("chat_jid=", query.Chat.ToNonAD())
+	}
+	if !query.Since.IsZero() {
+		addCondition("timestamp>=", query.Since.Unix())
+	}
+	if !query.Until.IsZero() {
+		addCondition("timestamp<", query.Until.Unix())
+	}
+	// When only the end of the range is known, the newest messages are the interesting ones
+	newestFirst := query.Limit > 0 && query.Since.IsZero() && !query.Until.IsZero()
+	if newestFirst {
+		conditions.WriteString(" ORDER BY timestamp DESC, message_id DESC")
+	} else {
+		conditions.WriteString(" ORDER BY timestamp ASC, message_id ASC")
+	}
+	if query.Limit > 0 {
+		_, _ = fmt.Fprintf(&conditions, " LIMIT %d", query.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, getMessagesQuery+conditions.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []*store.StoredMessage
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if newestFirst {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, rows.Err()
+}
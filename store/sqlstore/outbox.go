@@ -0,0 +1,65 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.OutboxStore = (*SQLStore)(nil)
+
+const (
+	putOutboxMessageQuery = `
+		INSERT INTO whatsmeow_outbox (our_jid, message_id, to_jid, message, queued_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (our_jid, message_id) DO UPDATE SET to_jid=excluded.to_jid, message=excluded.message
+	`
+	getOutboxMessagesQuery   = `SELECT message_id, to_jid, message, queued_at FROM whatsmeow_outbox WHERE our_jid=$1 ORDER BY queued_at, message_id`
+	deleteOutboxMessageQuery = `DELETE FROM whatsmeow_outbox WHERE our_jid=$1 AND message_id=$2`
+)
+
+func (s *SQLStore) PutOutboxMessage(ctx context.Context, msg *store.OutboxMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	// The queue time is stored in nanoseconds, as it's used to keep messages queued in quick succession in order
+	_, err = s.db.ExecContext(ctx, putOutboxMessageQuery, s.JID, msg.ID, msg.To, data, msg.QueuedAt.UnixNano())
+	return err
+}
+
+func (s *SQLStore) GetOutboxMessages(ctx context.Context) ([]*store.OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx, getOutboxMessagesQuery, s.JID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []*store.OutboxMessage
+	for rows.Next() {
+		var msg store.OutboxMessage
+		var data []byte
+		var queuedAt int64
+		err = rows.Scan(&msg.ID, &msg.To, &data, &queuedAt)
+		if err != nil {
+			return nil, err
+		}
+		msg.QueuedAt = time.Unix(0, queuedAt)
+		msg.Message = &waProto.Message{}
+		err = proto.Unmarshal(data, msg.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queued message %s: %w", msg.ID, err)
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLStore) DeleteOutboxMessage(ctx context.Context, id types.MessageID) error {
+	_, err := s.db.ExecContext(ctx, deleteOutboxMessageQuery, s.JID, id)
+	return err
+}
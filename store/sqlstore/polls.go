@@ -0,0 +1,104 @@
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.PollStore = (*SQLStore)(nil)
+
+const (
+	putPollQuery = `
+		INSERT INTO whatsmeow_polls (our_jid, chat_jid, poll_id, sender_jid, poll) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (our_jid, chat_jid, poll_id) DO UPDATE SET sender_jid=excluded.sender_jid, poll=excluded.poll
+	`
+	getPollQuery     = `SELECT sender_jid, poll FROM whatsmeow_polls WHERE our_jid=$1 AND chat_jid=$2 AND poll_id=$3`
+	putPollVoteQuery = `
+		INSERT INTO whatsmeow_poll_votes (our_jid, chat_jid, poll_id, voter_jid, selected, timestamp) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (our_jid, chat_jid, poll_id, voter_jid) DO UPDATE SET selected=excluded.selected, timestamp=excluded.timestamp
+		WHERE whatsmeow_poll_votes.timestamp<excluded.timestamp
+	`
+	deletePollVoteQuery = `DELETE FROM whatsmeow_poll_votes WHERE our_jid=$1 AND chat_jid=$2 AND poll_id=$3 AND voter_jid=$4 AND timestamp<=$5`
+	getPollVotesQuery   = `
+		SELECT voter_jid, selected, timestamp FROM whatsmeow_poll_votes
+		WHERE our_jid=$1 AND chat_jid=$2 AND poll_id=$3 ORDER BY timestamp, voter_jid
+	`
+)
+
+func (s *SQLStore) PutPoll(ctx context.Context, poll *store.StoredPoll) error {
+	data, err := proto.Marshal(poll.Poll)
+	if err != nil {
+		return fmt.Errorf("failed to marshal poll: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, putPollQuery, s.JID, poll.Chat.ToNonAD(), poll.ID, poll.Sender.ToNonAD(), data)
+	return err
+}
+
+func (s *SQLStore) GetPoll(ctx context.Context, chat types.JID, id types.MessageID) (*store.StoredPoll, error) {
+	poll := store.StoredPoll{Chat: chat.ToNonAD(), ID: id}
+	var data []byte
+	err := s.db.QueryRowContext(ctx, getPollQuery, s.JID, poll.Chat, id).Scan(&poll.Sender, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	poll.Poll = &waProto.PollCreationMessage{}
+	err = proto.Unmarshal(data, poll.Poll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal poll %s: %w", id, err)
+	}
+	return &poll, nil
+}
+
+func (s *SQLStore) PutPollVote(ctx context.Context, vote *store.PollVote) error {
+	var err error
+	if len(vote.SelectedOptions) == 0 {
+		_, err = s.db.ExecContext(ctx, deletePollVoteQuery, s.JID, vote.Chat.ToNonAD(), vote.PollID, vote.Voter.ToNonAD(), vote.Timestamp.UnixMilli())
+	} else {
+		for _, hash := range vote.SelectedOptions {
+			if len(hash) != sha256.Size {
+				return fmt.Errorf("invalid poll option hash length %d", len(hash))
+			}
+		}
+		selected := bytes.Join(vote.SelectedOptions, nil)
+		_, err = s.db.ExecContext(ctx, putPollVoteQuery, s.JID, vote.Chat.ToNonAD(), vote.PollID, vote.Voter.ToNonAD(), selected, vote.Timestamp.UnixMilli())
+	}
+	return err
+}
+
+func (s *SQLStore) GetPollVotes(ctx context.Context, chat types.JID, id types.MessageID) ([]*store.PollVote, error) {
+	rows, err := s.db.QueryContext(ctx, getPollVotesQuery, s.JID, chat.ToNonAD(), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var votes []*store.PollVote
+	for rows.Next() {
+		vote := store.PollVote{Chat: chat.ToNonAD(), PollID: id}
+		var selected []byte
+		var timestamp int64
+		err = rows.Scan(&vote.Voter, &selected, &timestamp)
+		if err != nil {
+			return nil, err
+		}
+		for len(selected) >= sha256.Size {
+			vote.SelectedOptions = append(vote.SelectedOptions, selected[:sha256.Size])
+			selected = selected[sha256.Size:]
+		}
+		vote.Timestamp = time.UnixMilli(timestamp)
+		votes = append(votes, &vote)
+	}
+	return votes, rows.Err()
+}
@@ -0,0 +1,54 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.ReactionStore = (*SQLStore)(nil)
+
+const (
+	putReactionQuery = `
+		INSERT INTO whatsmeow_reactions (our_jid, chat_jid, message_id, sender_jid, reaction, timestamp) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (our_jid, chat_jid, message_id, sender_jid) DO UPDATE SET reaction=excluded.reaction, timestamp=excluded.timestamp
+		WHERE whatsmeow_reactions.timestamp<excluded.timestamp
+	`
+	deleteReactionQuery = `DELETE FROM whatsmeow_reactions WHERE our_jid=$1 AND chat_jid=$2 AND message_id=$3 AND sender_jid=$4 AND timestamp<=$5`
+	getReactionsQuery   = `
+		SELECT sender_jid, reaction, timestamp FROM whatsmeow_reactions
+		WHERE our_jid=$1 AND chat_jid=$2 AND message_id=$3 ORDER BY timestamp, sender_jid
+	`
+)
+
+func (s *SQLStore) PutReaction(ctx context.Context, reaction *store.MessageReaction) error {
+	var err error
+	if len(reaction.Text) == 0 {
+		_, err = s.db.ExecContext(ctx, deleteReactionQuery, s.JID, reaction.Chat.ToNonAD(), reaction.MessageID, reaction.Sender.ToNonAD(), reaction.Timestamp.UnixMilli())
+	} else {
+		_, err = s.db.ExecContext(ctx, putReactionQuery, s.JID, reaction.Chat.ToNonAD(), reaction.MessageID, reaction.Sender.ToNonAD(), reaction.Text, reaction.Timestamp.UnixMilli())
+	}
+	return err
+}
+
+func (s *SQLStore) GetReactions(ctx context.Context, chat types.JID, id types.MessageID) ([]*store.MessageReaction, error) {
+	rows, err := s.db.QueryContext(ctx, getReactionsQuery, s.JID, chat.ToNonAD(), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reactions []*store.MessageReaction
+	for rows.Next() {
+		reaction := store.MessageReaction{Chat: chat.ToNonAD(), MessageID: id}
+		var timestamp int64
+		err = rows.Scan(&reaction.Sender, &reaction.Text, &timestamp)
+		if err != nil {
+			return nil, err
+		}
+		reaction.Timestamp = time.UnixMilli(timestamp)
+		reactions = append(reactions, &reaction)
+	}
+	return reactions, rows.Err()
+}
@@ -0,0 +1,81 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+var _ store.ScheduleStore = (*SQLStore)(nil)
+
+const (
+	putScheduledMessageQuery = `
+		INSERT INTO whatsmeow_scheduled_messages (our_jid, message_id, to_jid, message, send_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (our_jid, message_id) DO UPDATE SET to_jid=excluded.to_jid, message=excluded.message, send_at=excluded.send_at
+	`
+	getDueScheduledMessagesQuery = `
+		SELECT message_id, to_jid, message, send_at FROM whatsmeow_scheduled_messages
+		WHERE our_jid=$1 AND send_at<=$2 ORDER BY send_at, message_id
+	`
+	getNextScheduledTimeQuery   = `SELECT MIN(send_at) FROM whatsmeow_scheduled_messages WHERE our_jid=$1`
+	deleteScheduledMessageQuery = `DELETE FROM whatsmeow_scheduled_messages WHERE our_jid=$1 AND message_id=$2`
+)
+
+func (s *SQLStore) PutScheduledMessage(ctx context.Context, msg *store.ScheduledMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, putScheduledMessageQuery, s.JID, msg.ID, msg.To, data, msg.SendAt.UnixMilli())
+	return err
+}
+
+func (s *SQLStore) GetDueScheduledMessages(ctx context.Context, now time.Time) ([]*store.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, getDueScheduledMessagesQuery, s.JID, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []*store.ScheduledMessage
+	for rows.Next() {
+		var msg store.ScheduledMessage
+		var data []byte
+		var sendAt int64
+		err = rows.Scan(&msg.ID, &msg.To, &data, &sendAt)
+		if err != nil {
+			return nil, err
+		}
+		msg.SendAt = time.UnixMilli(sendAt)
+		msg.Message = &waProto.Message{}
+		err = proto.Unmarshal(data, msg.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scheduled message %s: %w", msg.ID, err)
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLStore) GetNextScheduledTime(ctx context.Context) (time.Time, error) {
+	var sendAt sql.NullInt64
+	err := s.db.QueryRowContext(ctx, getNextScheduledTimeQuery, s.JID).Scan(&sendAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !sendAt.Valid) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(sendAt.Int64), nil
+}
+
+func (s *SQLStore) DeleteScheduledMessage(ctx context.Context, id types.MessageID) error {
+	_, err := s.db.ExecContext(ctx, deleteScheduledMessageQuery, s.JID, id)
+	return err
+}
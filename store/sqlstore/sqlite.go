@@ -0,0 +1,178 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Option is a function that configures how New opens the database.
+type Option func(opts *openOptions)
+
+type openOptions struct {
+	journalMode  string
+	busyTimeout  time.Duration
+	synchronous  string
+	singleWriter bool
+}
+
+// ErrInvalidOption is returned by New if an option has a value that SQLite doesn't accept.
+var ErrInvalidOption = errors.New("invalid SQLite option value")
+
+var (
+	validJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	validSynchronous  = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
+// WithJournalMode sets the SQLite journal mode of the database, e.g. "WAL".
+//
+// In WAL mode, reads don't block writes and vice versa, which prevents most `database is locked` errors
+// when many messages are handled concurrently. The journal mode is stored in the database file, so it
+// stays enabled even when the database is later opened without this option.
+func WithJournalMode(mode string) Option {
+	return func(opts *openOptions) {
+		opts.journalMode = strings.ToUpper(mode)
+	}
+}
+
+// WithBusyTimeout sets how long SQLite waits for other connections to release their locks
+// before failing with `database is locked`.
+func WithBusyTimeout(timeout time.Duration) Option {
+	return func(opts *openOptions) {
+		opts.busyTimeout = timeout
+	}
+}
+
+// WithSynchronous sets the SQLite synchronous level ("OFF", "NORMAL", "FULL" or "EXTRA").
+//
+// NORMAL is safe from corruption in WAL mode and makes writes much faster than the default FULL,
+// but the most recent transactions may be lost if the operating system crashes.
+func WithSynchronous(level string) Option {
+	return func(opts *openOptions) {
+		opts.synchronous = strings.ToUpper(level)
+	}
+}
+
+// WithSingleWriter limits the connection pool to a single connection, so that concurrent writes wait
+// for each other in Go instead of competing for the SQLite write lock. Note that reads use the same
+// connection, so they're serialized too.
+//
+// This option also works with other databases, but it's generally only useful for SQLite.
+func WithSingleWriter() Option {
+	return func(opts *openOptions) {
+		opts.singleWriter = true
+	}
+}
+
+func isSQLite(dialect string) bool {
+	return dialect == "sqlite3" || dialect == "sqlite"
+}
+
+func isValidValue(value string, valid []string) bool {
+	for _, validValue := range valid {
+		if value == validValue {
+			return true
+		}
+	}
+	return false
+}
+
+// pragmas returns the statements that need to be executed on every new SQLite connection.
+func (opts *openOptions) pragmas() ([]string, error) {
+	var pragmas []string
+	if opts.busyTimeout > 0 {
+		// The busy timeout is set first, so that changing the journal mode waits for other connections
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout = %d", opts.busyTimeout.Milliseconds()))
+	}
+	if opts.journalMode != "" {
+		if !isValidValue(opts.journalMode, validJournalModes) {
+			return nil, fmt.Errorf("%w: unknown journal mode %q", ErrInvalidOption, opts.journalMode)
+		}
+		pragmas = append(pragmas, "PRAGMA journal_mode = "+opts.journalMode)
+	}
+	if opts.synchronous != "" {
+		if !isValidValue(opts.synchronous, validSynchronous) {
+			return nil, fmt.Errorf("%w: unknown synchronous level %q", ErrInvalidOption, opts.synchronous)
+		}
+		pragmas = append(pragmas, "PRAGMA synchronous = "+opts.synchronous)
+	}
+	return pragmas, nil
+}
+
+// open opens the database with the given options. Pragmas are only applied to SQLite databases,
+// as they're per-connection settings that must be set again whenever the pool opens a new connection.
+func (opts *openOptions) open(dialect, address string) (*sql.DB, error) {
+	db, err := sql.Open(dialect, address)
+	if err != nil {
+		return nil, err
+	}
+	if isSQLite(dialect) {
+		var pragmas []string
+		pragmas, err = opts.pragmas()
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		} else if len(pragmas) > 0 {
+			drv := db.Driver()
+			// sql.Open doesn't connect yet, so there's nothing to clean up other than the handle itself
+			_ = db.Close()
+			db = sql.OpenDB(&pragmaConnector{driver: drv, address: address, pragmas: pragmas})
+		}
+	}
+	if opts.singleWriter {
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// pragmaConnector is a driver.Connector that executes the given pragmas on every new connection.
+type pragmaConnector struct {
+	driver  driver.Driver
+	address string
+	pragmas []string
+}
+
+var _ driver.Connector = (*pragmaConnector)(nil)
+
+func (pc *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := pc.driver.Open(pc.address)
+	if err != nil {
+		return nil, err
+	}
+	for _, pragma := range pc.pragmas {
+		err = execOnConn(ctx, conn, pragma)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to execute %q: %w", pragma, err)
+		}
+	}
+	return conn, nil
+}
+
+func (pc *pragmaConnector) Driver() driver.Driver {
+	return pc.driver
+}
+
+func execOnConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if !errors.Is(err, driver.ErrSkip) {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if stmtExecer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = stmtExecer.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return err
+}
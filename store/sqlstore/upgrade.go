@@ -8,6 +8,7 @@ package sqlstore
 
 import (
 	"database/sql"
+	"time"
 )
 
 type upgradeFunc func(*sql.Tx, *Container) error
@@ -16,7 +17,7 @@ type upgradeFunc func(*sql.Tx, *Container) error
 //
 // This may be of use if you want to manage the database fully manually, but in most cases you
 // should just call Container.Upgrade to let the library handle everything.
-var Upgrades = [...]upgradeFunc{upgradeV1, upgradeV2, upgradeV3}
+var Upgrades = [...]upgradeFunc{upgradeV1, upgradeV2, upgradeV3, upgradeV4, upgradeV5, upgradeV6, upgradeV7, upgradeV8, upgradeV9, upgradeV10, upgradeV11}
 
 func (c *Container) getVersion() (int, error) {
 	_, err := c.db.Exec("CREATE TABLE IF NOT EXISTS whatsmeow_version (version INTEGER)")
@@ -32,7 +33,7 @@ func (c *Container) getVersion() (int, error) {
 	return version, nil
 }
 
-func (c *Container) setVersion(tx *sql.Tx, version int) error {
+func (c *Container) setVersion(tx *dialectTx, version int) error {
 	_, err := tx.Exec("DELETE FROM whatsmeow_version")
 	if err != nil {
 		return err
@@ -48,16 +49,20 @@ func (c *Container) Upgrade() error {
 		return err
 	}
 
-	for ; version < len(Upgrades); version++ {
-		var tx *sql.Tx
+	upgrades := Upgrades[:]
+	if isMySQL(c.dialect) {
+		upgrades = MySQLUpgrades[:]
+	}
+	for ; version < len(upgrades); version++ {
+		var tx *dialectTx
 		tx, err = c.db.Begin()
 		if err != nil {
 			return err
 		}
 
-		migrateFunc := Upgrades[version]
+		migrateFunc := upgrades[version]
 		c.log.Infof("Upgrading database to v%d", version+1)
-		err = migrateFunc(tx, c)
+		err = migrateFunc(tx.Tx, c)
 		if err != nil {
 			_ = tx.Rollback()
 			return err
@@ -260,3 +265,353 @@ func upgradeV3(tx *sql.Tx, container *Container) error {
 	)`)
 	return err
 }
+
+func upgradeV4(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec("ALTER TABLE whatsmeow_device ADD COLUMN tenant TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("CREATE INDEX whatsmeow_device_tenant_idx ON whatsmeow_device (tenant)")
+	return err
+}
+
+func upgradeV5(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec(`CREATE TABLE whatsmeow_messages (
+		our_jid    TEXT,
+		chat_jid   TEXT,
+		sender_jid TEXT,
+		message_id TEXT,
+		timestamp  BIGINT  NOT NULL,
+		from_me    BOOLEAN NOT NULL,
+		push_name  TEXT    NOT NULL DEFAULT '',
+		message    bytea   NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, sender_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("CREATE INDEX whatsmeow_messages_timestamp_idx ON whatsmeow_messages (our_jid, chat_jid, timestamp)")
+	return err
+}
+
+func upgradeV6(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec("ALTER TABLE whatsmeow_sessions ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	// The real update times of existing sessions aren't known, so count them from the upgrade
+	_, err = tx.Exec("UPDATE whatsmeow_sessions SET updated_at=$1", time.Now().Unix())
+	return err
+}
+
+func upgradeV7(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec("ALTER TABLE whatsmeow_device ADD COLUMN last_seen BIGINT NOT NULL DEFAULT 0")
+	return err
+}
+
+func upgradeV8(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec(`CREATE TABLE whatsmeow_outbox (
+		our_jid    TEXT,
+		message_id TEXT,
+		to_jid     TEXT   NOT NULL,
+		message    bytea  NOT NULL,
+		queued_at  BIGINT NOT NULL,
+
+		PRIMARY KEY (our_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	return err
+}
+
+func upgradeV9(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec(`CREATE TABLE whatsmeow_scheduled_messages (
+		our_jid    TEXT,
+		message_id TEXT,
+		to_jid     TEXT   NOT NULL,
+		message    bytea  NOT NULL,
+		send_at    BIGINT NOT NULL,
+
+		PRIMARY KEY (our_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	return err
+}
+
+func upgradeV10(tx *sql.Tx, _ *Container) error {
+	_, err := tx.Exec(`CREATE TABLE whatsmeow_reactions (
+		our_jid    TEXT,
+		chat_jid   TEXT,
+		message_id TEXT,
+		sender_jid TEXT,
+		reaction   TEXT   NOT NULL,
+		timestamp  BIGINT NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, message_id, sender_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	return err
+}
+
+func upgradeV11(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_polls (
+		our_jid    TEXT,
+		chat_jid   TEXT,
+		poll_id    TEXT,
+		sender_jid TEXT  NOT NULL,
+		poll       bytea NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, poll_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`, `CREATE TABLE whatsmeow_poll_votes (
+		our_jid   TEXT,
+		chat_jid  TEXT,
+		poll_id   TEXT,
+		voter_jid TEXT,
+		selected  bytea  NOT NULL,
+		timestamp BIGINT NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, poll_id, voter_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+}
+
+// MySQLUpgrades is the equivalent of Upgrades for MySQL and MariaDB, which need different column types.
+// The version numbers are shared with the other dialects, so both lists always have the same length.
+//
+// Note that MySQL commits the transaction implicitly after every schema change, so a failed upgrade
+// may leave the database partially upgraded.
+var MySQLUpgrades = [...]upgradeFunc{upgradeMySQLV1, upgradeMySQLV2, upgradeMySQLV3, upgradeMySQLV4, upgradeMySQLV5, upgradeMySQLV6, upgradeMySQLV7, upgradeMySQLV8, upgradeMySQLV9, upgradeMySQLV10, upgradeMySQLV11}
+
+// The MySQL schema doesn't have the CHECK constraints of the other dialects, as older MySQL versions ignore them anyway.
+// The maximum lengths of binary columns are limited by their types instead.
+
+// mysqlTableOptions makes all text columns compare case-sensitively like they do in SQLite and Postgres.
+const mysqlTableOptions = " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin"
+
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, query := range queries {
+		_, err := tx.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upgradeMySQLV1(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_device (
+		jid VARCHAR(128) PRIMARY KEY,
+
+		registration_id BIGINT NOT NULL,
+
+		noise_key    VARBINARY(32) NOT NULL,
+		identity_key VARBINARY(32) NOT NULL,
+
+		signed_pre_key     VARBINARY(32) NOT NULL,
+		signed_pre_key_id  INTEGER       NOT NULL,
+		signed_pre_key_sig VARBINARY(64) NOT NULL,
+
+		adv_key         BLOB          NOT NULL,
+		adv_details     BLOB          NOT NULL,
+		adv_account_sig VARBINARY(64) NOT NULL,
+		adv_device_sig  VARBINARY(64) NOT NULL,
+
+		platform      VARCHAR(255) NOT NULL DEFAULT '',
+		business_name VARCHAR(255) NOT NULL DEFAULT '',
+		push_name     VARCHAR(255) NOT NULL DEFAULT ''
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_identity_keys (
+		our_jid  VARCHAR(128),
+		their_id VARCHAR(128),
+		identity VARBINARY(32) NOT NULL,
+
+		PRIMARY KEY (our_jid, their_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_pre_keys (
+		jid        VARCHAR(128),
+		key_id     INTEGER,
+		`+"`key`"+` VARBINARY(32) NOT NULL,
+		uploaded   BOOLEAN       NOT NULL,
+
+		PRIMARY KEY (jid, key_id),
+		FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_sessions (
+		our_jid  VARCHAR(128),
+		their_id VARCHAR(128),
+		session  BLOB,
+
+		PRIMARY KEY (our_jid, their_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_sender_keys (
+		our_jid    VARCHAR(128),
+		chat_id    VARCHAR(128),
+		sender_id  VARCHAR(128),
+		sender_key BLOB NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_id, sender_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_app_state_sync_keys (
+		jid         VARCHAR(128),
+		key_id      VARBINARY(64),
+		key_data    BLOB   NOT NULL,
+		timestamp   BIGINT NOT NULL,
+		fingerprint BLOB   NOT NULL,
+
+		PRIMARY KEY (jid, key_id),
+		FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_app_state_version (
+		jid     VARCHAR(128),
+		name    VARCHAR(128),
+		version BIGINT         NOT NULL,
+		hash    VARBINARY(128) NOT NULL,
+
+		PRIMARY KEY (jid, name),
+		FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_app_state_mutation_macs (
+		jid       VARCHAR(128),
+		name      VARCHAR(128),
+		version   BIGINT,
+		index_mac VARBINARY(32),
+		value_mac VARBINARY(32) NOT NULL,
+
+		PRIMARY KEY (jid, name, version, index_mac),
+		FOREIGN KEY (jid, name) REFERENCES whatsmeow_app_state_version(jid, name) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_contacts (
+		our_jid       VARCHAR(128),
+		their_jid     VARCHAR(128),
+		first_name    TEXT,
+		full_name     TEXT,
+		push_name     TEXT,
+		business_name TEXT,
+
+		PRIMARY KEY (our_jid, their_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_chat_settings (
+		our_jid     VARCHAR(128),
+		chat_jid    VARCHAR(128),
+		muted_until BIGINT  NOT NULL DEFAULT 0,
+		pinned      BOOLEAN NOT NULL DEFAULT false,
+		archived    BOOLEAN NOT NULL DEFAULT false,
+
+		PRIMARY KEY (our_jid, chat_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions)
+}
+
+func upgradeMySQLV2(tx *sql.Tx, _ *Container) error {
+	// MySQL support was added after this version, so there are no existing devices that would need the key filled in
+	return execAll(tx, "ALTER TABLE whatsmeow_device ADD COLUMN adv_account_sig_key VARBINARY(32) NOT NULL")
+}
+
+func upgradeMySQLV3(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_message_secrets (
+		our_jid    VARCHAR(128),
+		chat_jid   VARCHAR(128),
+		sender_jid VARCHAR(128),
+		message_id VARCHAR(128),
+		`+"`key`"+`      BLOB NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, sender_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions)
+}
+
+func upgradeMySQLV4(tx *sql.Tx, _ *Container) error {
+	return execAll(tx,
+		"ALTER TABLE whatsmeow_device ADD COLUMN tenant VARCHAR(128) NOT NULL DEFAULT ''",
+		"CREATE INDEX whatsmeow_device_tenant_idx ON whatsmeow_device (tenant)",
+	)
+}
+
+func upgradeMySQLV5(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_messages (
+		our_jid    VARCHAR(128),
+		chat_jid   VARCHAR(128),
+		sender_jid VARCHAR(128),
+		message_id VARCHAR(128),
+		timestamp  BIGINT       NOT NULL,
+		from_me    BOOLEAN      NOT NULL,
+		push_name  VARCHAR(255) NOT NULL DEFAULT '',
+		message    MEDIUMBLOB   NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, sender_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions,
+		"CREATE INDEX whatsmeow_messages_timestamp_idx ON whatsmeow_messages (our_jid, chat_jid, timestamp)",
+	)
+}
+
+func upgradeMySQLV6(tx *sql.Tx, _ *Container) error {
+	return execAll(tx,
+		"ALTER TABLE whatsmeow_sessions ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0",
+		"UPDATE whatsmeow_sessions SET updated_at=UNIX_TIMESTAMP()",
+	)
+}
+
+func upgradeMySQLV7(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, "ALTER TABLE whatsmeow_device ADD COLUMN last_seen BIGINT NOT NULL DEFAULT 0")
+}
+
+func upgradeMySQLV8(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_outbox (
+		our_jid    VARCHAR(128),
+		message_id VARCHAR(128),
+		to_jid     VARCHAR(128) NOT NULL,
+		message    MEDIUMBLOB   NOT NULL,
+		queued_at  BIGINT       NOT NULL,
+
+		PRIMARY KEY (our_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions)
+}
+
+func upgradeMySQLV9(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_scheduled_messages (
+		our_jid    VARCHAR(128),
+		message_id VARCHAR(128),
+		to_jid     VARCHAR(128) NOT NULL,
+		message    MEDIUMBLOB   NOT NULL,
+		send_at    BIGINT       NOT NULL,
+
+		PRIMARY KEY (our_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions)
+}
+
+func upgradeMySQLV10(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_reactions (
+		our_jid    VARCHAR(128),
+		chat_jid   VARCHAR(128),
+		message_id VARCHAR(128),
+		sender_jid VARCHAR(128),
+		reaction   VARCHAR(128) NOT NULL,
+		timestamp  BIGINT       NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, message_id, sender_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions)
+}
+
+func upgradeMySQLV11(tx *sql.Tx, _ *Container) error {
+	return execAll(tx, `CREATE TABLE whatsmeow_polls (
+		our_jid    VARCHAR(128),
+		chat_jid   VARCHAR(128),
+		poll_id    VARCHAR(128),
+		sender_jid VARCHAR(128) NOT NULL,
+		poll       MEDIUMBLOB   NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, poll_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions, `CREATE TABLE whatsmeow_poll_votes (
+		our_jid   VARCHAR(128),
+		chat_jid  VARCHAR(128),
+		poll_id   VARCHAR(128),
+		voter_jid VARCHAR(128),
+		selected  BLOB   NOT NULL,
+		timestamp BIGINT NOT NULL,
+
+		PRIMARY KEY (our_jid, chat_jid, poll_id, voter_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`+mysqlTableOptions)
+}
@@ -8,7 +8,11 @@
 package store
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	mathRand "math/rand"
 	"time"
 
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
@@ -18,32 +22,32 @@ import (
 )
 
 type IdentityStore interface {
-	PutIdentity(address string, key [32]byte) error
-	DeleteAllIdentities(phone string) error
-	DeleteIdentity(address string) error
-	IsTrustedIdentity(address string, key [32]byte) (bool, error)
+	PutIdentity(ctx context.Context, address string, key [32]byte) error
+	DeleteAllIdentities(ctx context.Context, phone string) error
+	DeleteIdentity(ctx context.Context, address string) error
+	IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error)
 }
 
 type SessionStore interface {
-	GetSession(address string) ([]byte, error)
-	HasSession(address string) (bool, error)
-	PutSession(address string, session []byte) error
-	DeleteAllSessions(phone string) error
-	DeleteSession(address string) error
+	GetSession(ctx context.Context, address string) ([]byte, error)
+	HasSession(ctx context.Context, address string) (bool, error)
+	PutSession(ctx context.Context, address string, session []byte) error
+	DeleteAllSessions(ctx context.Context, phone string) error
+	DeleteSession(ctx context.Context, address string) error
 }
 
 type PreKeyStore interface {
-	GetOrGenPreKeys(count uint32) ([]*keys.PreKey, error)
-	GenOnePreKey() (*keys.PreKey, error)
-	GetPreKey(id uint32) (*keys.PreKey, error)
-	RemovePreKey(id uint32) error
-	MarkPreKeysAsUploaded(upToID uint32) error
-	UploadedPreKeyCount() (int, error)
+	GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error)
+	GenOnePreKey(ctx context.Context) (*keys.PreKey, error)
+	GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error)
+	RemovePreKey(ctx context.Context, id uint32) error
+	MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error
+	UploadedPreKeyCount(ctx context.Context) (int, error)
 }
 
 type SenderKeyStore interface {
-	PutSenderKey(group, user string, session []byte) error
-	GetSenderKey(group, user string) ([]byte, error)
+	PutSenderKey(ctx context.Context, group, user string, session []byte) error
+	GetSenderKey(ctx context.Context, group, user string) ([]byte, error)
 }
 
 type AppStateSyncKey struct {
@@ -53,8 +57,21 @@ type AppStateSyncKey struct {
 }
 
 type AppStateSyncKeyStore interface {
-	PutAppStateSyncKey(id []byte, key AppStateSyncKey) error
-	GetAppStateSyncKey(id []byte) (*AppStateSyncKey, error)
+	PutAppStateSyncKey(ctx context.Context, id []byte, key AppStateSyncKey) error
+	GetAppStateSyncKey(ctx context.Context, id []byte) (*AppStateSyncKey, error)
+}
+
+// ErrLatestAppStateSyncKeyNotSupported is returned by store wrappers if the wrapped app state sync key store
+// doesn't implement LatestAppStateSyncKeyGetter.
+var ErrLatestAppStateSyncKeyNotSupported = errors.New("app state sync key store doesn't support finding the latest key")
+
+// LatestAppStateSyncKeyGetter is implemented by app state sync key stores that can find the newest key,
+// which is needed for sending app state patches with Client.SendAppState.
+//
+// All the stores in the subpackages of this package implement it.
+type LatestAppStateSyncKeyGetter interface {
+	// GetLatestAppStateSyncKeyID returns the ID of the newest key, or nil if there are no keys.
+	GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error)
 }
 
 type AppStateMutationMAC struct {
@@ -63,13 +80,13 @@ type AppStateMutationMAC struct {
 }
 
 type AppStateStore interface {
-	PutAppStateVersion(name string, version uint64, hash [128]byte) error
-	GetAppStateVersion(name string) (uint64, [128]byte, error)
-	DeleteAppStateVersion(name string) error
+	PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error
+	GetAppStateVersion(ctx context.Context, name string) (uint64, [128]byte, error)
+	DeleteAppStateVersion(ctx context.Context, name string) error
 
-	PutAppStateMutationMACs(name string, version uint64, mutations []AppStateMutationMAC) error
-	DeleteAppStateMutationMACs(name string, indexMACs [][]byte) error
-	GetAppStateMutationMAC(name string, indexMAC []byte) (valueMAC []byte, err error)
+	PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []AppStateMutationMAC) error
+	DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error
+	GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) (valueMAC []byte, err error)
 }
 
 type ContactEntry struct {
@@ -79,24 +96,34 @@ type ContactEntry struct {
 }
 
 type ContactStore interface {
-	PutPushName(user types.JID, pushName string) (bool, string, error)
-	PutBusinessName(user types.JID, businessName string) (bool, string, error)
-	PutContactName(user types.JID, fullName, firstName string) error
-	PutAllContactNames(contacts []ContactEntry) error
-	GetContact(user types.JID) (types.ContactInfo, error)
-	GetAllContacts() (map[types.JID]types.ContactInfo, error)
+	PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error)
+	PutBusinessName(ctx context.Context, user types.JID, businessName string) (bool, string, error)
+	PutContactName(ctx context.Context, user types.JID, fullName, firstName string) error
+	PutAllContactNames(ctx context.Context, contacts []ContactEntry) error
+	GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error)
+	GetAllContacts(ctx context.Context) (map[types.JID]types.ContactInfo, error)
 }
 
 type ChatSettingsStore interface {
-	PutMutedUntil(chat types.JID, mutedUntil time.Time) error
-	PutPinned(chat types.JID, pinned bool) error
-	PutArchived(chat types.JID, archived bool) error
-	GetChatSettings(chat types.JID) (types.LocalChatSettings, error)
+	PutMutedUntil(ctx context.Context, chat types.JID, mutedUntil time.Time) error
+	PutPinned(ctx context.Context, chat types.JID, pinned bool) error
+	PutArchived(ctx context.Context, chat types.JID, archived bool) error
+	GetChatSettings(ctx context.Context, chat types.JID) (types.LocalChatSettings, error)
 }
 
 type DeviceContainer interface {
-	PutDevice(store *Device) error
-	DeleteDevice(store *Device) error
+	PutDevice(ctx context.Context, store *Device) error
+	DeleteDevice(ctx context.Context, store *Device) error
+}
+
+// Container is the full set of methods implemented by the device containers in the subpackages of
+// this package (like sqlstore), which is useful for writing code that works with any backend.
+type Container interface {
+	DeviceContainer
+	NewDevice() *Device
+	GetFirstDevice(ctx context.Context) (*Device, error)
+	GetDevice(ctx context.Context, jid types.JID) (*Device, error)
+	GetAllDevices(ctx context.Context) ([]*Device, error)
 }
 
 type MessageSecretInsert struct {
@@ -107,9 +134,129 @@ type MessageSecretInsert struct {
 }
 
 type MsgSecretStore interface {
-	PutMessageSecrets([]MessageSecretInsert) error
-	PutMessageSecret(chat, sender types.JID, id types.MessageID, secret []byte) error
-	GetMessageSecret(chat, sender types.JID, id types.MessageID) ([]byte, error)
+	PutMessageSecrets(ctx context.Context, inserts []MessageSecretInsert) error
+	PutMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID, secret []byte) error
+	GetMessageSecret(ctx context.Context, chat, sender types.JID, id types.MessageID) ([]byte, error)
+}
+
+// StoredMessage is a decrypted message saved in a MessageStore.
+type StoredMessage struct {
+	Chat      types.JID
+	Sender    types.JID
+	ID        types.MessageID
+	Timestamp time.Time
+	FromMe    bool
+	PushName  string
+	Message   *waProto.Message
+}
+
+// MessageQuery specifies which messages MessageStore.GetMessages returns.
+type MessageQuery struct {
+	// Chat is the chat to get messages from. If it's empty, messages from all chats are returned.
+	Chat types.JID
+	// Since and Until limit the timestamps of the returned messages. Zero values mean no limit.
+	// Since is inclusive and Until is exclusive.
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of messages to return. Zero or negative means no limit.
+	// If Until is set and Since isn't, the newest messages before Until are returned.
+	Limit int
+}
+
+// MessageStore is an optional store for the history of decrypted messages. If a device has one,
+// the client saves all incoming messages and successfully sent outgoing messages in it.
+type MessageStore interface {
+	PutMessage(ctx context.Context, msg *StoredMessage) error
+	GetMessage(ctx context.Context, chat, sender types.JID, id types.MessageID) (*StoredMessage, error)
+	// GetMessages returns the messages matching the query, sorted by timestamp from oldest to newest.
+	GetMessages(ctx context.Context, query MessageQuery) ([]*StoredMessage, error)
+}
+
+// OutboxMessage is an outgoing message that was queued in an OutboxStore because the client wasn't connected.
+type OutboxMessage struct {
+	To       types.JID
+	ID       types.MessageID
+	Message  *waProto.Message
+	QueuedAt time.Time
+}
+
+// OutboxStore is an optional store for outgoing messages. If a device has one, messages sent while
+// the client is disconnected are queued in it and sent in order after the client reconnects.
+type OutboxStore interface {
+	PutOutboxMessage(ctx context.Context, msg *OutboxMessage) error
+	// GetOutboxMessages returns all queued messages in the order they were queued.
+	GetOutboxMessages(ctx context.Context) ([]*OutboxMessage, error)
+	DeleteOutboxMessage(ctx context.Context, id types.MessageID) error
+}
+
+// ScheduledMessage is an outgoing message that should be sent at a later time.
+type ScheduledMessage struct {
+	To      types.JID
+	ID      types.MessageID
+	Message *waProto.Message
+	SendAt  time.Time
+}
+
+// ScheduleStore is an optional store for messages scheduled to be sent later. If a device has one,
+// the client sends the scheduled messages when they're due, including ones scheduled before a restart.
+type ScheduleStore interface {
+	PutScheduledMessage(ctx context.Context, msg *ScheduledMessage) error
+	// GetDueScheduledMessages returns the messages scheduled to be sent at or before the given time, earliest first.
+	GetDueScheduledMessages(ctx context.Context, now time.Time) ([]*ScheduledMessage, error)
+	// GetNextScheduledTime returns the send time of the earliest scheduled message, or a zero time if there are none.
+	GetNextScheduledTime(ctx context.Context) (time.Time, error)
+	DeleteScheduledMessage(ctx context.Context, id types.MessageID) error
+}
+
+// MessageReaction is a single user's reaction to a message.
+type MessageReaction struct {
+	Chat      types.JID
+	MessageID types.MessageID // The ID of the message that was reacted to.
+	Sender    types.JID       // The user who reacted.
+	Text      string
+	Timestamp time.Time
+}
+
+// ReactionStore is an optional store for reactions to messages. If a device has one, the client keeps track of
+// the latest reaction of each user to each message, which allows getting the current reactions of a message.
+type ReactionStore interface {
+	// PutReaction stores a reaction, replacing the previous reaction of the same sender to the same message.
+	// If the text is empty, the sender's reaction is removed instead. Reactions that are older than the stored
+	// reaction of the sender are ignored, so that reactions received out of order don't replace newer ones.
+	PutReaction(ctx context.Context, reaction *MessageReaction) error
+	// GetReactions returns all current reactions to the given message, oldest first.
+	GetReactions(ctx context.Context, chat types.JID, id types.MessageID) ([]*MessageReaction, error)
+}
+
+// StoredPoll is a poll that was created in a chat, stored so that votes can be matched to the option names.
+type StoredPoll struct {
+	Chat   types.JID
+	Sender types.JID
+	ID     types.MessageID
+	Poll   *waProto.PollCreationMessage
+}
+
+// PollVote is a single user's current vote in a poll.
+type PollVote struct {
+	Chat   types.JID
+	PollID types.MessageID
+	Voter  types.JID
+	// The SHA-256 hashes of the selected option names, see whatsmeow.HashPollOptions.
+	SelectedOptions [][]byte
+	Timestamp       time.Time
+}
+
+// PollStore is an optional store for polls and votes. If a device has one, the client stores all polls it sees
+// and the latest decrypted vote of each user, which allows getting the current results of a poll.
+type PollStore interface {
+	PutPoll(ctx context.Context, poll *StoredPoll) error
+	GetPoll(ctx context.Context, chat types.JID, id types.MessageID) (*StoredPoll, error)
+	// PutPollVote stores a vote, replacing the previous vote of the same voter in the same poll.
+	// If no options are selected, the voter's vote is removed instead. Votes that are older than the stored
+	// vote of the voter are ignored, like in ReactionStore.PutReaction.
+	PutPollVote(ctx context.Context, vote *PollVote) error
+	// GetPollVotes returns all current votes in the given poll, oldest first.
+	GetPollVotes(ctx context.Context, chat types.JID, id types.MessageID) ([]*PollVote, error)
 }
 
 type Device struct {
@@ -126,6 +273,8 @@ type Device struct {
 	Platform     string
 	BusinessName string
 	PushName     string
+	// LastSeen is the last time the client successfully connected to WhatsApp with this device.
+	LastSeen time.Time
 
 	Initialized  bool
 	Identities   IdentityStore
@@ -134,9 +283,17 @@ type Device struct {
 	SenderKeys   SenderKeyStore
 	AppStateKeys AppStateSyncKeyStore
 	AppState     AppStateStore
+	// Contacts may be replaced with a store in a different backend. A custom store set on a new device
+	// is kept when the device is saved after pairing, but devices loaded from a container always get the
+	// container's own contact store, so use NewContactsContainer to replace it for every device.
 	Contacts     ContactStore
 	ChatSettings ChatSettingsStore
 	MsgSecrets   MsgSecretStore
+	Messages     MessageStore
+	Outbox       OutboxStore
+	Schedule     ScheduleStore
+	Reactions    ReactionStore
+	Polls        PollStore
 	Container    DeviceContainer
 
 	DatabaseErrorHandler func(device *Device, action string, attemptIndex int, err error) (retry bool)
@@ -150,12 +307,39 @@ func (device *Device) handleDatabaseError(attemptIndex int, err error, action st
 	return false
 }
 
-func (device *Device) Save() error {
-	return device.Container.PutDevice(device)
+// NewBlankDevice creates a new unpaired device in the given container with freshly generated keys.
+// It's meant for implementing Container.NewDevice, which should set the container-specific fields
+// (like the stores or DatabaseErrorHandler) on the returned device:
+//
+//	func (c *Container) NewDevice() *store.Device {
+//		device := store.NewBlankDevice(c, c.log)
+//		device.DatabaseErrorHandler = c.DatabaseErrorHandler
+//		return device
+//	}
+func NewBlankDevice(container DeviceContainer, log waLog.Logger) *Device {
+	device := &Device{
+		Log:       log,
+		Container: container,
+
+		NoiseKey:       keys.NewKeyPair(),
+		IdentityKey:    keys.NewKeyPair(),
+		RegistrationID: mathRand.Uint32(),
+		AdvSecretKey:   make([]byte, 32),
+	}
+	_, err := rand.Read(device.AdvSecretKey)
+	if err != nil {
+		panic(err)
+	}
+	device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(1)
+	return device
+}
+
+func (device *Device) Save(ctx context.Context) error {
+	return device.Container.PutDevice(ctx, device)
 }
 
-func (device *Device) Delete() error {
-	err := device.Container.DeleteDevice(device)
+func (device *Device) Delete(ctx context.Context) error {
+	err := device.Container.DeleteDevice(ctx, device)
 	if err != nil {
 		return err
 	}
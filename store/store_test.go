@@ -0,0 +1,27 @@
+package store_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	waLog "github.com/insomnius/whatsmeow/util/log"
+)
+
+func TestNewBlankDevice(t *testing.T) {
+	container := inmemstore.New(nil)
+	log := waLog.Noop
+	device := store.NewBlankDevice(container, log)
+	if device.Container != container || device.Log != log || device.ID != nil {
+		t.Errorf("Unexpected container, logger or JID in %+v", device)
+	} else if len(device.AdvSecretKey) != 32 || device.NoiseKey == nil || device.IdentityKey == nil {
+		t.Fatalf("Expected keys to be generated, got %+v", device)
+	} else if device.SignedPreKey == nil || device.SignedPreKey.KeyID != 1 {
+		t.Errorf("Expected signed prekey with ID 1, got %+v", device.SignedPreKey)
+	}
+	other := store.NewBlankDevice(container, log)
+	if bytes.Equal(device.AdvSecretKey, other.AdvSecretKey) || device.NoiseKey.Priv == other.NoiseKey.Priv {
+		t.Error("Expected each device to get its own keys")
+	}
+}
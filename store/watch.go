@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// ChangeKind is the type of data that was changed in a ChangeEvent.
+type ChangeKind int
+
+const (
+	ChangeKindDevice ChangeKind = iota
+	ChangeKindSession
+	ChangeKindAppStateSyncKey
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case ChangeKindDevice:
+		return "device"
+	case ChangeKindSession:
+		return "session"
+	case ChangeKindAppStateSyncKey:
+		return "app state sync key"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeOp is the operation that was done in a ChangeEvent.
+type ChangeOp int
+
+const (
+	// ChangePut means the item identified by ChangeEvent.Key was created or updated.
+	ChangePut ChangeOp = iota
+	// ChangeDelete means the item identified by ChangeEvent.Key was deleted.
+	ChangeDelete
+	// ChangeDeleteAll means all sessions of the phone number in ChangeEvent.Key were deleted.
+	ChangeDeleteAll
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangePut:
+		return "put"
+	case ChangeDelete:
+		return "delete"
+	case ChangeDeleteAll:
+		return "delete all"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeEvent is emitted by a Watcher after data has been successfully written to or deleted from the store.
+type ChangeEvent struct {
+	Kind ChangeKind
+	Op   ChangeOp
+	// Device is the JID of the device whose data was changed.
+	Device types.JID
+	// Key identifies the changed item: the Signal address for sessions, the hex-encoded key ID for
+	// app state sync keys and the phone number for ChangeDeleteAll. It's empty for device changes.
+	Key string
+}
+
+// Watcher is implemented by containers that can notify subscribers about changes to the stored data.
+type Watcher interface {
+	// Subscribe registers a function that is called for every change. The returned function removes the subscription.
+	Subscribe(fn func(evt ChangeEvent)) (unsubscribe func())
+}
+
+// WatchedContainer wraps another Container and emits change events for devices, sessions and app state
+// sync keys written through it. Changes made directly through the inner container are not noticed.
+//
+// Subscribers are called synchronously after each successful write, so they should return quickly.
+type WatchedContainer struct {
+	inner Container
+
+	subscribersLock sync.RWMutex
+	subscribers     map[int]func(evt ChangeEvent)
+	nextID          int
+}
+
+var _ Container = (*WatchedContainer)(nil)
+var _ Watcher = (*WatchedContainer)(nil)
+
+// NewWatchedContainer wraps the given container so that changes made through it can be subscribed to.
+//
+//	container := store.NewWatchedContainer(sqlContainer)
+//	container.Subscribe(func(evt store.ChangeEvent) {
+//		cache.Invalidate(evt.Device, evt.Key)
+//	})
+func NewWatchedContainer(inner Container) *WatchedContainer {
+	return &WatchedContainer{
+		inner:       inner,
+		subscribers: make(map[int]func(evt ChangeEvent)),
+	}
+}
+
+// Unwrap returns the underlying container.
+func (wc *WatchedContainer) Unwrap() Container {
+	return wc.inner
+}
+
+// Subscribe registers a function that is called for every change. The returned function removes the subscription.
+func (wc *WatchedContainer) Subscribe(fn func(evt ChangeEvent)) (unsubscribe func()) {
+	wc.subscribersLock.Lock()
+	id := wc.nextID
+	wc.nextID++
+	wc.subscribers[id] = fn
+	wc.subscribersLock.Unlock()
+	return func() {
+		wc.subscribersLock.Lock()
+		delete(wc.subscribers, id)
+		wc.subscribersLock.Unlock()
+	}
+}
+
+func (wc *WatchedContainer) emit(evt ChangeEvent) {
+	wc.subscribersLock.RLock()
+	defer wc.subscribersLock.RUnlock()
+	for _, fn := range wc.subscribers {
+		fn(evt)
+	}
+}
+
+func (wc *WatchedContainer) wrapDevice(device *Device) *Device {
+	if device == nil {
+		return nil
+	}
+	device.Container = wc
+	if device.ID == nil {
+		// Stores are only wrapped once the JID is known, see PutDevice
+		return device
+	}
+	if _, alreadyWrapped := device.Sessions.(*watchedSessionStore); !alreadyWrapped && device.Sessions != nil {
+		device.Sessions = &watchedSessionStore{SessionStore: device.Sessions, wc: wc, jid: *device.ID}
+	}
+	if _, alreadyWrapped := device.AppStateKeys.(*watchedAppStateSyncKeyStore); !alreadyWrapped && device.AppStateKeys != nil {
+		device.AppStateKeys = &watchedAppStateSyncKeyStore{AppStateSyncKeyStore: device.AppStateKeys, wc: wc, jid: *device.ID}
+	}
+	return device
+}
+
+// NewDevice creates a new device in the underlying container.
+func (wc *WatchedContainer) NewDevice() *Device {
+	return wc.wrapDevice(wc.inner.NewDevice())
+}
+
+// GetFirstDevice gets the first device from the underlying container.
+func (wc *WatchedContainer) GetFirstDevice(ctx context.Context) (*Device, error) {
+	device, err := wc.inner.GetFirstDevice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return wc.wrapDevice(device), nil
+}
+
+// GetDevice gets the device with the specified JID from the underlying container.
+func (wc *WatchedContainer) GetDevice(ctx context.Context, jid types.JID) (*Device, error) {
+	device, err := wc.inner.GetDevice(ctx, jid)
+	if err != nil {
+		return nil, err
+	}
+	return wc.wrapDevice(device), nil
+}
+
+// GetAllDevices gets all devices from the underlying container.
+func (wc *WatchedContainer) GetAllDevices(ctx context.Context) ([]*Device, error) {
+	devices, err := wc.inner.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		wc.wrapDevice(device)
+	}
+	return devices, nil
+}
+
+// PutDevice stores the given device in the underlying container and emits a device change event.
+func (wc *WatchedContainer) PutDevice(ctx context.Context, device *Device) error {
+	err := wc.inner.PutDevice(ctx, device)
+	// The inner container may have initialized the stores and replaced the container field
+	wc.wrapDevice(device)
+	if err == nil && device.ID != nil {
+		wc.emit(ChangeEvent{Kind: ChangeKindDevice, Op: ChangePut, Device: *device.ID})
+	}
+	return err
+}
+
+// PutLastSeen stores the last seen time of the given device in the underlying container and emits a device change event.
+func (wc *WatchedContainer) PutLastSeen(ctx context.Context, device *Device) error {
+	updater, ok := wc.inner.(LastSeenUpdater)
+	if !ok {
+		return wc.PutDevice(ctx, device)
+	}
+	err := updater.PutLastSeen(ctx, device)
+	if err == nil && device.ID != nil {
+		wc.emit(ChangeEvent{Kind: ChangeKindDevice, Op: ChangePut, Device: *device.ID})
+	}
+	return err
+}
+
+// DeleteDevice deletes the given device from the underlying container and emits a device change event.
+func (wc *WatchedContainer) DeleteDevice(ctx context.Context, device *Device) error {
+	err := wc.inner.DeleteDevice(ctx, device)
+	if err == nil && device.ID != nil {
+		wc.emit(ChangeEvent{Kind: ChangeKindDevice, Op: ChangeDelete, Device: *device.ID})
+	}
+	return err
+}
+
+type watchedSessionStore struct {
+	SessionStore
+	wc  *WatchedContainer
+	jid types.JID
+}
+
+func (s *watchedSessionStore) emit(op ChangeOp, key string, err error) error {
+	if err == nil {
+		s.wc.emit(ChangeEvent{Kind: ChangeKindSession, Op: op, Device: s.jid, Key: key})
+	}
+	return err
+}
+
+func (s *watchedSessionStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.emit(ChangePut, address, s.SessionStore.PutSession(ctx, address, session))
+}
+
+func (s *watchedSessionStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.emit(ChangeDeleteAll, phone, s.SessionStore.DeleteAllSessions(ctx, phone))
+}
+
+func (s *watchedSessionStore) DeleteSession(ctx context.Context, address string) error {
+	return s.emit(ChangeDelete, address, s.SessionStore.DeleteSession(ctx, address))
+}
+
+// ExportData passes through to the wrapped store, so that Migrate and Device.ExportJSON work on watched devices.
+func (s *watchedSessionStore) ExportData(ctx context.Context) (*ExportedData, error) {
+	exporter, ok := s.SessionStore.(DataExporter)
+	if !ok {
+		return nil, ErrExportNotSupported
+	}
+	return exporter.ExportData(ctx)
+}
+
+// PruneSessions passes through to the wrapped store. Pruned sessions don't emit change events,
+// as the store doesn't report which sessions were deleted.
+func (s *watchedSessionStore) PruneSessions(ctx context.Context, before time.Time) (int, error) {
+	pruner, ok := s.SessionStore.(SessionPruner)
+	if !ok {
+		return 0, ErrPruneNotSupported
+	}
+	return pruner.PruneSessions(ctx, before)
+}
+
+type watchedAppStateSyncKeyStore struct {
+	AppStateSyncKeyStore
+	wc  *WatchedContainer
+	jid types.JID
+}
+
+// GetLatestAppStateSyncKeyID passes through to the wrapped store.
+func (s *watchedAppStateSyncKeyStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	getter, ok := s.AppStateSyncKeyStore.(LatestAppStateSyncKeyGetter)
+	if !ok {
+		return nil, ErrLatestAppStateSyncKeyNotSupported
+	}
+	return getter.GetLatestAppStateSyncKeyID(ctx)
+}
+
+func (s *watchedAppStateSyncKeyStore) PutAppStateSyncKey(ctx context.Context, id []byte, key AppStateSyncKey) error {
+	err := s.AppStateSyncKeyStore.PutAppStateSyncKey(ctx, id, key)
+	if err == nil {
+		s.wc.emit(ChangeEvent{Kind: ChangeKindAppStateSyncKey, Op: ChangePut, Device: s.jid, Key: hex.EncodeToString(id)})
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestWatchedContainer(t *testing.T) {
+	ctx := context.Background()
+	container := store.NewWatchedContainer(inmemstore.New(nil))
+	var events []store.ChangeEvent
+	unsubscribe := container.Subscribe(func(evt store.ChangeEvent) {
+		events = append(events, evt)
+	})
+
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	_ = device.Save(ctx)
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("session"))
+	_ = device.AppStateKeys.PutAppStateSyncKey(ctx, []byte{0xab}, store.AppStateSyncKey{})
+	_ = device.Sessions.DeleteAllSessions(ctx, "111")
+	unsubscribe()
+	_ = device.Sessions.PutSession(ctx, "111:1", []byte("ignored"))
+
+	expected := []store.ChangeEvent{
+		{Kind: store.ChangeKindDevice, Op: store.ChangePut, Device: jid},
+		{Kind: store.ChangeKindSession, Op: store.ChangePut, Device: jid, Key: "111:1"},
+		{Kind: store.ChangeKindAppStateSyncKey, Op: store.ChangePut, Device: jid, Key: "ab"},
+		{Kind: store.ChangeKindSession, Op: store.ChangeDeleteAll, Device: jid, Key: "111"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, evt := range events {
+		if evt != expected[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], evt)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/util/imageutil"
+)
+
+// DefaultThumbnailSize is the maximum width and height of generated thumbnails if the thumbnailer doesn't specify a size.
+const DefaultThumbnailSize = 100
+
+// Thumbnailer generates JPEG thumbnails for outgoing media, see Client.Thumbnailer and Client.AttachThumbnail.
+//
+// Implementations should return ErrThumbnailUnsupported for media they can't handle, e.g. documents that aren't images.
+type Thumbnailer interface {
+	MakeThumbnail(ctx context.Context, data []byte, mediaType MediaType) (thumbnail []byte, width, height int, err error)
+}
+
+// ImageThumbnailer is a pure-Go Thumbnailer for JPEG, PNG and GIF images. It's also used for documents, so that
+// images sent as files get a preview too.
+type ImageThumbnailer struct {
+	// The maximum width and height of the thumbnail. Defaults to DefaultThumbnailSize.
+	MaxSize int
+}
+
+var _ Thumbnailer = (*ImageThumbnailer)(nil)
+
+// MakeThumbnail scales the image down and encodes it as a JPEG.
+func (it *ImageThumbnailer) MakeThumbnail(_ context.Context, data []byte, mediaType MediaType) ([]byte, int, int, error) {
+	if mediaType != MediaImage && mediaType != MediaDocument {
+		return nil, 0, 0, ErrThumbnailUnsupported
+	}
+	thumbnail, width, height, err := imageutil.MakeThumbnail(data, thumbnailSize(it.MaxSize))
+	if err != nil && mediaType == MediaDocument {
+		// Most documents aren't images, which isn't really an error
+		return nil, 0, 0, ErrThumbnailUnsupported
+	}
+	return thumbnail, width, height, err
+}
+
+// FFmpegThumbnailer is a Thumbnailer that runs ffmpeg to extract the first frame of videos.
+// Images and documents are handled with ImageThumbnailer.
+type FFmpegThumbnailer struct {
+	// The path to the ffmpeg binary. Defaults to "ffmpeg", i.e. looking it up in PATH.
+	Path string
+	// The maximum width and height of the thumbnail. Defaults to DefaultThumbnailSize.
+	MaxSize int
+}
+
+var _ Thumbnailer = (*FFmpegThumbnailer)(nil)
+
+// MakeThumbnail extracts the first frame of videos with ffmpeg and scales it down.
+func (ft *FFmpegThumbnailer) MakeThumbnail(ctx context.Context, data []byte, mediaType MediaType) ([]byte, int, int, error) {
+	if mediaType != MediaVideo {
+		return (&ImageThumbnailer{MaxSize: ft.MaxSize}).MakeThumbnail(ctx, data, mediaType)
+	}
+	path := ft.Path
+	if len(path) == 0 {
+		path = "ffmpeg"
+	}
+	// MP4 files often have the index at the end, so ffmpeg needs to be able to seek in the input
+	input, err := os.CreateTemp("", "whatsmeow-thumbnail-*")
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		_ = input.Close()
+		_ = os.Remove(input.Name())
+	}()
+	if _, err = input.Write(data); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, path,
+		"-hide_banner", "-loglevel", "error",
+		"-i", input.Name(), "-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "png", "pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("ffmpeg failed: %w (%s)", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return imageutil.MakeThumbnail(stdout.Bytes(), thumbnailSize(ft.MaxSize))
+}
+
+func thumbnailSize(size int) int {
+	if size <= 0 {
+		return DefaultThumbnailSize
+	}
+	return size
+}
+
+// AttachThumbnail returns a copy of the given message with a JPEG thumbnail of the given media data in the image,
+// video or document message inside it. If the message isn't a media message or already has a thumbnail, or the
+// thumbnailer doesn't support the media, it's returned as-is.
+//
+// Client.Thumbnailer is used for generating the thumbnail, or an ImageThumbnailer if it's not set. When
+// Client.Thumbnailer is set, Upload returns the thumbnail in UploadResponse.JPEGThumbnail, so this is only
+// needed for media uploaded with UploadStream or when thumbnails are opt-in per message.
+//
+//	msg, err = cli.AttachThumbnail(ctx, msg, imageData)
+func (cli *Client) AttachThumbnail(ctx context.Context, message *waProto.Message, data []byte) (*waProto.Message, error) {
+	mediaType, hasThumbnail := getThumbnailTarget(message)
+	if len(mediaType) == 0 || hasThumbnail {
+		return message, nil
+	}
+	thumbnailer := cli.Thumbnailer
+	if thumbnailer == nil {
+		thumbnailer = &ImageThumbnailer{}
+	}
+	thumbnail, width, height, err := thumbnailer.MakeThumbnail(ctx, data, mediaType)
+	if errors.Is(err, ErrThumbnailUnsupported) {
+		return message, nil
+	} else if err != nil {
+		return message, err
+	}
+	return setThumbnail(proto.Clone(message).(*waProto.Message), thumbnail, uint32(width), uint32(height)), nil
+}
+
+func getThumbnailTarget(message *waProto.Message) (mediaType MediaType, hasThumbnail bool) {
+	if img := message.GetImageMessage(); img != nil {
+		return MediaImage, len(img.GetJpegThumbnail()) > 0
+	} else if vid := message.GetVideoMessage(); vid != nil {
+		return MediaVideo, len(vid.GetJpegThumbnail()) > 0
+	} else if doc := message.GetDocumentMessage(); doc != nil {
+		return MediaDocument, len(doc.GetJpegThumbnail()) > 0
+	}
+	return "", false
+}
+
+// setThumbnail sets the thumbnail fields of the media message inside the given message, which is modified in place.
+func setThumbnail(message *waProto.Message, thumbnail []byte, width, height uint32) *waProto.Message {
+	if message.ImageMessage != nil {
+		message.ImageMessage.JpegThumbnail = thumbnail
+	} else if message.VideoMessage != nil {
+		message.VideoMessage.JpegThumbnail = thumbnail
+	} else if message.DocumentMessage != nil {
+		message.DocumentMessage.JpegThumbnail = thumbnail
+		message.DocumentMessage.ThumbnailWidth = proto.Uint32(width)
+		message.DocumentMessage.ThumbnailHeight = proto.Uint32(height)
+	}
+	return message
+}
+
+// makeUploadThumbnail generates a thumbnail for uploaded media if Client.Thumbnailer is set and stores it in the
+// upload response. Errors are only logged, as the thumbnail is optional.
+func (cli *Client) makeUploadThumbnail(ctx context.Context, data []byte, mediaType MediaType, resp *UploadResponse) {
+	if cli.Thumbnailer == nil || (mediaType != MediaImage && mediaType != MediaVideo && mediaType != MediaDocument) {
+		return
+	}
+	thumbnail, width, height, err := cli.Thumbnailer.MakeThumbnail(ctx, data, mediaType)
+	if errors.Is(err, ErrThumbnailUnsupported) {
+		return
+	} else if err != nil {
+		cli.Log.Warnf("Failed to generate thumbnail for uploaded %s: %v", mediaTypeToMMSType[mediaType], err)
+		return
+	}
+	resp.JPEGThumbnail = thumbnail
+	resp.ThumbnailWidth = uint32(width)
+	resp.ThumbnailHeight = uint32(height)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+type countingThumbnailer struct {
+	calls int
+	err   error
+}
+
+func (ct *countingThumbnailer) MakeThumbnail(ctx context.Context, data []byte, mediaType MediaType) ([]byte, int, int, error) {
+	ct.calls++
+	if ct.err != nil {
+		return nil, 0, 0, ct.err
+	}
+	return []byte("thumbnail"), 10, 5, nil
+}
+
+func makeTestPNG(width, height int) []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+func TestAttachThumbnail(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	ctx := context.Background()
+	pngData := makeTestPNG(300, 150)
+
+	original := &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("caption")}}
+	msg, err := cli.AttachThumbnail(ctx, original, pngData)
+	if err != nil {
+		t.Fatalf("Failed to attach thumbnail: %v", err)
+	} else if len(msg.GetImageMessage().GetJpegThumbnail()) == 0 || msg.GetImageMessage().GetCaption() != "caption" {
+		t.Errorf("Expected thumbnail to be attached, got %+v", msg.GetImageMessage())
+	} else if len(original.GetImageMessage().GetJpegThumbnail()) > 0 {
+		t.Error("Expected the original message not to be modified")
+	}
+
+	existing := &waProto.Message{ImageMessage: &waProto.ImageMessage{JpegThumbnail: []byte("existing")}}
+	if msg, err = cli.AttachThumbnail(ctx, existing, pngData); err != nil || msg != existing {
+		t.Errorf("Expected message with a thumbnail to be returned as-is (error: %v)", err)
+	}
+	text := &waProto.Message{Conversation: proto.String("hello")}
+	if msg, err = cli.AttachThumbnail(ctx, text, pngData); err != nil || msg != text {
+		t.Errorf("Expected non-media message to be returned as-is (error: %v)", err)
+	}
+
+	// Documents that aren't images are left without a thumbnail
+	document := &waProto.Message{DocumentMessage: &waProto.DocumentMessage{FileName: proto.String("file.pdf")}}
+	if msg, err = cli.AttachThumbnail(ctx, document, []byte(testPDF)); err != nil || msg != document {
+		t.Errorf("Expected unsupported document to be returned as-is (error: %v)", err)
+	}
+	msg, err = cli.AttachThumbnail(ctx, document, pngData)
+	if doc := msg.GetDocumentMessage(); err != nil || len(doc.GetJpegThumbnail()) == 0 {
+		t.Errorf("Expected image document to get a thumbnail (error: %v)", err)
+	} else if doc.GetThumbnailWidth() != DefaultThumbnailSize || doc.GetThumbnailHeight() != 50 {
+		t.Errorf("Expected thumbnail dimensions to be set, got %dx%d", doc.GetThumbnailWidth(), doc.GetThumbnailHeight())
+	}
+
+	failure := errors.New("thumbnailer failed")
+	cli.Thumbnailer = &countingThumbnailer{err: failure}
+	if msg, err = cli.AttachThumbnail(ctx, original, pngData); !errors.Is(err, failure) || msg != original {
+		t.Errorf("Expected thumbnailer error to be returned, got %v", err)
+	}
+}
+
+func TestMakeUploadThumbnail(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	ctx := context.Background()
+	var resp UploadResponse
+	cli.makeUploadThumbnail(ctx, makeTestPNG(30, 20), MediaImage, &resp)
+	if resp.JPEGThumbnail != nil {
+		t.Error("Expected no thumbnail without Client.Thumbnailer")
+	}
+
+	thumbnailer := &countingThumbnailer{}
+	cli.Thumbnailer = thumbnailer
+	cli.makeUploadThumbnail(ctx, []byte("audio"), MediaAudio, &resp)
+	if thumbnailer.calls != 0 {
+		t.Error("Expected thumbnailer not to be called for audio")
+	}
+	cli.makeUploadThumbnail(ctx, []byte("video"), MediaVideo, &resp)
+	if string(resp.JPEGThumbnail) != "thumbnail" || resp.ThumbnailWidth != 10 || resp.ThumbnailHeight != 5 {
+		t.Errorf("Expected thumbnail in response, got %+v", resp)
+	}
+
+	resp = UploadResponse{}
+	cli.Thumbnailer = &countingThumbnailer{err: ErrThumbnailUnsupported}
+	cli.makeUploadThumbnail(ctx, []byte("document"), MediaDocument, &resp)
+	cli.Thumbnailer = &countingThumbnailer{err: errors.New("thumbnailer failed")}
+	cli.makeUploadThumbnail(ctx, []byte("image"), MediaImage, &resp)
+	if resp.JPEGThumbnail != nil || resp.ThumbnailWidth != 0 {
+		t.Errorf("Expected failed thumbnails to be skipped, got %+v", resp)
+	}
+}
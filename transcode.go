@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/util/mp4"
+)
+
+// TranscodedMedia is the output of a MediaTranscoder.
+type TranscodedMedia struct {
+	// The converted file.
+	Data []byte
+	// The mime type of the converted file. If empty, it's detected from the data.
+	Mimetype string
+
+	// The dimensions of converted images and videos, and the duration of videos and audio. These are optional:
+	// the dimensions of JPEG, PNG and GIF images, the dimensions and duration of MP4 videos and the duration
+	// of audio supported by ProbeAudio are read from the file if not set.
+	Width    int
+	Height   int
+	Duration time.Duration
+}
+
+// MediaTranscoder converts a file before it's uploaded, e.g. to re-encode videos into a format that the official
+// clients can play or to compress large images. The mime type is detected from the input data.
+//
+// Returning nil without an error means the file doesn't need to be converted and is uploaded as-is.
+//
+//	cli.TranscodeVideo = func(ctx context.Context, data []byte, mimetype string) (*whatsmeow.TranscodedMedia, error) {
+//		if mimetype == "video/mp4" {
+//			return nil, nil
+//		}
+//		mp4, err := runFFmpeg(ctx, data, "-c:v", "libx264", "-c:a", "aac", "-movflags", "frag_keyframe", "-f", "mp4")
+//		return &whatsmeow.TranscodedMedia{Data: mp4, Mimetype: "video/mp4"}, err
+//	}
+type MediaTranscoder func(ctx context.Context, data []byte, mimetype string) (*TranscodedMedia, error)
+
+// transcodeMedia runs the transcoding hook for the given media type, if one is set, and fills missing metadata.
+func (cli *Client) transcodeMedia(ctx context.Context, data []byte, mediaType MediaType) (*TranscodedMedia, error) {
+	var transcoder MediaTranscoder
+	switch mediaType {
+	case MediaImage:
+		transcoder = cli.CompressImage
+	case MediaVideo:
+		transcoder = cli.TranscodeVideo
+	case MediaAudio:
+		transcoder = cli.TranscodeAudio
+	}
+	if transcoder == nil {
+		return nil, nil
+	}
+	output, err := transcoder(ctx, data, http.DetectContentType(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcode %s: %w", mediaTypeToMMSType[mediaType], err)
+	} else if output == nil {
+		return nil, nil
+	}
+	if len(output.Mimetype) == 0 {
+		output.Mimetype = http.DetectContentType(output.Data)
+	}
+	if mediaType == MediaImage && (output.Width == 0 || output.Height == 0) {
+		if config, _, err := image.DecodeConfig(bytes.NewReader(output.Data)); err == nil {
+			output.Width, output.Height = config.Width, config.Height
+		}
+	}
+	if mediaType == MediaVideo && (output.Width == 0 || output.Height == 0 || output.Duration == 0) {
+		if info, err := mp4.Parse(output.Data); err == nil {
+			if output.Width == 0 || output.Height == 0 {
+				output.Width, output.Height = info.Width, info.Height
+			}
+			if output.Duration == 0 {
+				output.Duration = info.Duration
+			}
+		}
+	}
+	if mediaType == MediaAudio && output.Duration == 0 {
+		if info, err := ProbeAudio(output.Data); err == nil {
+			output.Duration = info.Duration
+		}
+	}
+	return output, nil
+}
+
+// setTranscodedMetadata replaces the metadata of the media message inside the given message with the metadata of the
+// converted file. The message is modified in place. Unknown dimensions and durations are cleared rather than kept,
+// as they'd describe the original file.
+func setTranscodedMetadata(message *waProto.Message, upload *UploadResponse) {
+	optionalUint32 := func(val uint32) *uint32 {
+		if val == 0 {
+			return nil
+		}
+		return proto.Uint32(val)
+	}
+	switch {
+	case message.ImageMessage != nil:
+		message.ImageMessage.Mimetype = proto.String(upload.Mimetype)
+		message.ImageMessage.Width = optionalUint32(upload.Width)
+		message.ImageMessage.Height = optionalUint32(upload.Height)
+	case message.VideoMessage != nil:
+		message.VideoMessage.Mimetype = proto.String(upload.Mimetype)
+		message.VideoMessage.Width = optionalUint32(upload.Width)
+		message.VideoMessage.Height = optionalUint32(upload.Height)
+		message.VideoMessage.Seconds = optionalUint32(upload.Seconds)
+	case message.AudioMessage != nil:
+		message.AudioMessage.Mimetype = proto.String(upload.Mimetype)
+		message.AudioMessage.Seconds = optionalUint32(upload.Seconds)
+	}
+}
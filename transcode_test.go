@@ -0,0 +1,138 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+)
+
+func makeTestMP4(duration time.Duration, width, height int) []byte {
+	box := func(typ string, contents ...[]byte) []byte {
+		data := make([]byte, 8)
+		copy(data[4:], typ)
+		for _, content := range contents {
+			data = append(data, content...)
+		}
+		binary.BigEndian.PutUint32(data, uint32(len(data)))
+		return data
+	}
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration/time.Millisecond))
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(height)<<16)
+	return append(box("ftyp", []byte("isom\x00\x00\x02\x00")), box("moov", box("mvhd", mvhd), box("trak", box("tkhd", tkhd)))...)
+}
+
+func staticTranscoder(output *TranscodedMedia) MediaTranscoder {
+	return func(ctx context.Context, data []byte, mimetype string) (*TranscodedMedia, error) {
+		return output, nil
+	}
+}
+
+func TestTranscodeMediaMetadata(t *testing.T) {
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	ctx := context.Background()
+	var pngData bytes.Buffer
+	_ = png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 30, 20)))
+
+	cli.CompressImage = staticTranscoder(&TranscodedMedia{Data: pngData.Bytes()})
+	cli.TranscodeVideo = staticTranscoder(&TranscodedMedia{Data: makeTestMP4(12500*time.Millisecond, 1280, 720), Mimetype: "video/mp4"})
+	cli.TranscodeAudio = staticTranscoder(&TranscodedMedia{Data: makeTestMP4(3*time.Second, 0, 0), Mimetype: "audio/mp4"})
+	tests := []struct {
+		mediaType MediaType
+		expected  TranscodedMedia
+	}{
+		{MediaImage, TranscodedMedia{Mimetype: "image/png", Width: 30, Height: 20}},
+		{MediaVideo, TranscodedMedia{Mimetype: "video/mp4", Width: 1280, Height: 720, Duration: 12500 * time.Millisecond}},
+		{MediaAudio, TranscodedMedia{Mimetype: "audio/mp4", Duration: 3 * time.Second}},
+	}
+	for _, test := range tests {
+		output, err := cli.transcodeMedia(ctx, []byte("original"), test.mediaType)
+		if err != nil || output == nil {
+			t.Errorf("%s: unexpected result %+v (error: %v)", test.mediaType, output, err)
+			continue
+		}
+		if output.Mimetype != test.expected.Mimetype || output.Width != test.expected.Width || output.Height != test.expected.Height || output.Duration != test.expected.Duration {
+			t.Errorf("%s: expected metadata %+v, got %+v", test.mediaType, test.expected, *output)
+		}
+	}
+
+	// Metadata set by the hook isn't overridden
+	cli.TranscodeVideo = staticTranscoder(&TranscodedMedia{Data: makeTestMP4(time.Second, 1280, 720), Width: 640, Height: 360, Duration: 5 * time.Second})
+	if output, _ := cli.transcodeMedia(ctx, []byte("original"), MediaVideo); output.Width != 640 || output.Height != 360 || output.Duration != 5*time.Second {
+		t.Errorf("Expected metadata from the hook to be kept, got %+v", output)
+	}
+
+	failure := errors.New("ffmpeg failed")
+	cli.TranscodeVideo = func(ctx context.Context, data []byte, mimetype string) (*TranscodedMedia, error) {
+		return nil, failure
+	}
+	if _, err := cli.transcodeMedia(ctx, []byte("original"), MediaVideo); !errors.Is(err, failure) {
+		t.Errorf("Expected hook error to be returned, got %v", err)
+	}
+	if output, err := cli.transcodeMedia(ctx, []byte("original"), MediaDocument); output != nil || err != nil {
+		t.Errorf("Expected documents not to be transcoded, got %+v (error: %v)", output, err)
+	}
+}
+
+func TestUploadWithoutTranscoding(t *testing.T) {
+	cli := newUploadTestClient(t)
+	var called bool
+	cli.CompressImage = func(ctx context.Context, data []byte, mimetype string) (*TranscodedMedia, error) {
+		called = true
+		return nil, nil
+	}
+	original := []byte("original image data")
+	resp, err := cli.Upload(context.Background(), original, MediaImage)
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	} else if !called {
+		t.Error("Expected the hook to be called")
+	}
+	if resp.FileLength != uint64(len(original)) || resp.Mimetype != "" || resp.Width != 0 || resp.Height != 0 {
+		t.Errorf("Expected the original file to be uploaded without metadata, got %+v", resp)
+	}
+}
+
+func TestSetTranscodedMetadata(t *testing.T) {
+	msg := &waProto.Message{VideoMessage: &waProto.VideoMessage{
+		Mimetype: proto.String("video/webm"),
+		Width:    proto.Uint32(1920),
+		Height:   proto.Uint32(1080),
+		Seconds:  proto.Uint32(60),
+		Caption:  proto.String("caption"),
+	}}
+	setTranscodedMetadata(msg, &UploadResponse{Mimetype: "video/mp4", Width: 1280, Height: 720})
+	video := msg.GetVideoMessage()
+	if video.GetMimetype() != "video/mp4" || video.GetWidth() != 1280 || video.GetHeight() != 720 {
+		t.Errorf("Expected metadata to be replaced, got %+v", video)
+	} else if video.Seconds != nil {
+		t.Errorf("Expected unknown duration to be cleared, got %d", video.GetSeconds())
+	} else if video.GetCaption() != "caption" {
+		t.Error("Expected other fields to be kept")
+	}
+
+	msg = &waProto.Message{AudioMessage: &waProto.AudioMessage{Mimetype: proto.String("audio/wav")}}
+	setTranscodedMetadata(msg, &UploadResponse{Mimetype: "audio/ogg; codecs=opus", Seconds: 3})
+	if audio := msg.GetAudioMessage(); audio.GetMimetype() != "audio/ogg; codecs=opus" || audio.GetSeconds() != 3 {
+		t.Errorf("Unexpected audio metadata %+v", audio)
+	}
+}
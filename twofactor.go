@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// The two-step verification methods use the same account queries as the phone apps. WhatsApp may not allow
+// them from companion devices on every account, in which case the IQ error from the server (e.g. ErrIQForbidden)
+// is returned as-is.
+
+// GetTwoFactorStatus checks whether two-step verification is enabled and whether a recovery email is set.
+func (cli *Client) GetTwoFactorStatus(ctx context.Context) (*types.TwoFactorStatus, error) {
+	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
+		Namespace: "urn:xmpp:whatsapp:account",
+		Type:      iqGet,
+		To:        types.ServerJID,
+		Content:   []waBinary.Node{{Tag: "2fa"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseTwoFactorStatus(resp)
+}
+
+func parseTwoFactorStatus(resp *waBinary.Node) (*types.TwoFactorStatus, error) {
+	twoFactor, ok := resp.GetOptionalChildByTag("2fa")
+	if !ok {
+		return nil, &ElementMissingError{Tag: "2fa", In: "response to two-step verification query"}
+	}
+	var status types.TwoFactorStatus
+	_, status.Enabled = twoFactor.GetOptionalChildByTag("code")
+	email, hasEmail := twoFactor.GetOptionalChildByTag("email")
+	status.HasEmail = hasEmail
+	status.EmailVerified = hasEmail && email.AttrGetter().OptionalBool("verified")
+	return &status, nil
+}
+
+func (cli *Client) setTwoFactor(ctx context.Context, content []waBinary.Node) error {
+	_, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
+		Namespace: "urn:xmpp:whatsapp:account",
+		Type:      iqSet,
+		To:        types.ServerJID,
+		Content:   []waBinary.Node{{Tag: "2fa", Content: content}},
+	})
+	return err
+}
+
+func isValidTwoFactorPIN(pin string) bool {
+	if len(pin) != 6 {
+		return false
+	}
+	for _, char := range pin {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetTwoFactorPIN enables two-step verification with the given 6-digit PIN, or changes the PIN if it's already enabled.
+//
+// If email is not empty, it's set as the recovery email. The recovery email must be verified
+// from the link WhatsApp sends, see GetTwoFactorStatus for checking whether it has been verified.
+func (cli *Client) SetTwoFactorPIN(ctx context.Context, pin, email string) error {
+	if !isValidTwoFactorPIN(pin) {
+		return ErrInvalidTwoFactorPIN
+	}
+	content := []waBinary.Node{{Tag: "code", Content: []byte(pin)}}
+	if len(email) > 0 {
+		content = append(content, waBinary.Node{Tag: "email", Content: []byte(email)})
+	}
+	return cli.setTwoFactor(ctx, content)
+}
+
+// SetTwoFactorEmail changes the recovery email of two-step verification, which must already be enabled.
+// An empty email removes the recovery email.
+func (cli *Client) SetTwoFactorEmail(ctx context.Context, email string) error {
+	return cli.setTwoFactor(ctx, []waBinary.Node{{Tag: "email", Content: []byte(email)}})
+}
+
+// DisableTwoFactor turns off two-step verification, which also removes the PIN and the recovery email.
+func (cli *Client) DisableTwoFactor(ctx context.Context) error {
+	return cli.setTwoFactor(ctx, []waBinary.Node{{Tag: "code"}, {Tag: "email"}})
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestIsValidTwoFactorPIN(t *testing.T) {
+	tests := map[string]bool{
+		"123456":  true,
+		"000000":  true,
+		"12345":   false,
+		"1234567": false,
+		"12345a":  false,
+		"١٢٣٤٥٦":  false,
+		"":        false,
+	}
+	for pin, expected := range tests {
+		if valid := isValidTwoFactorPIN(pin); valid != expected {
+			t.Errorf("isValidTwoFactorPIN(%q) = %t, expected %t", pin, valid, expected)
+		}
+	}
+	cli := NewClient(inmemstore.New(nil).NewDevice(), nil)
+	if err := cli.SetTwoFactorPIN(context.Background(), "1234", ""); !errors.Is(err, ErrInvalidTwoFactorPIN) {
+		t.Errorf("Expected ErrInvalidTwoFactorPIN, got %v", err)
+	}
+}
+
+func TestParseTwoFactorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []waBinary.Node
+		expected types.TwoFactorStatus
+	}{
+		{"disabled", nil, types.TwoFactorStatus{}},
+		{"enabled without email", []waBinary.Node{{Tag: "code"}}, types.TwoFactorStatus{Enabled: true}},
+		{"unverified email", []waBinary.Node{{Tag: "code"}, {Tag: "email"}}, types.TwoFactorStatus{Enabled: true, HasEmail: true}},
+		{"verified email", []waBinary.Node{{Tag: "code"}, {Tag: "email", Attrs: waBinary.Attrs{"verified": "true"}}}, types.TwoFactorStatus{Enabled: true, HasEmail: true, EmailVerified: true}},
+	}
+	for _, test := range tests {
+		resp := &waBinary.Node{Tag: "iq", Content: []waBinary.Node{{Tag: "2fa", Content: test.content}}}
+		status, err := parseTwoFactorStatus(resp)
+		if err != nil {
+			t.Errorf("%s: failed to parse status: %v", test.name, err)
+		} else if *status != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *status)
+		}
+	}
+	if _, err := parseTwoFactorStatus(&waBinary.Node{Tag: "iq"}); err == nil {
+		t.Error("Expected error for a response without a 2fa element")
+	}
+}
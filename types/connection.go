@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"fmt"
+)
+
+// ConnectionState is the state of a client's connection to the WhatsApp web servers.
+type ConnectionState uint32
+
+const (
+	// ConnectionStateDisconnected means that there's no websocket connection.
+	ConnectionStateDisconnected ConnectionState = iota
+	// ConnectionStateConnecting means that the websocket is being dialed.
+	ConnectionStateConnecting
+	// ConnectionStateHandshaking means that the websocket is open and the noise handshake is in progress.
+	ConnectionStateHandshaking
+	// ConnectionStateAuthenticating means that the handshake is done and the client is waiting for the server to accept
+	// the login. Clients that aren't paired yet stay in this state until pairing is completed.
+	ConnectionStateAuthenticating
+	// ConnectionStateOnline means that the client has logged in and can send and receive messages.
+	ConnectionStateOnline
+	// ConnectionStateDegraded means that the client is logged in, but keepalive pings to the server are timing out.
+	ConnectionStateDegraded
+	// ConnectionStateBanned means that the server rejected the connection because the account is temporarily banned.
+	ConnectionStateBanned
+	// ConnectionStateLoggedOut means that the device was logged out and must be paired again.
+	ConnectionStateLoggedOut
+)
+
+var connectionStateNames = map[ConnectionState]string{
+	ConnectionStateDisconnected:   "disconnected",
+	ConnectionStateConnecting:     "connecting",
+	ConnectionStateHandshaking:    "handshaking",
+	ConnectionStateAuthenticating: "authenticating",
+	ConnectionStateOnline:         "online",
+	ConnectionStateDegraded:       "degraded",
+	ConnectionStateBanned:         "banned",
+	ConnectionStateLoggedOut:      "logged out",
+}
+
+// String returns a human-readable name for the state.
+func (cs ConnectionState) String() string {
+	name, ok := connectionStateNames[cs]
+	if !ok {
+		return fmt.Sprintf("unknown state %d", uint32(cs))
+	}
+	return name
+}
+
+// IsLoggedIn returns true if the state means that the client is authenticated on WhatsApp.
+func (cs ConnectionState) IsLoggedIn() bool {
+	return cs == ConnectionStateOnline || cs == ConnectionStateDegraded
+}
+
+// IsTerminal returns true if the client can't reconnect by itself from the state.
+func (cs ConnectionState) IsTerminal() bool {
+	return cs == ConnectionStateBanned || cs == ConnectionStateLoggedOut
+}
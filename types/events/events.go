@@ -4,7 +4,7 @@
 // License, v. 2.0. If a copy of the MPL was not distributed with this
 // file, You can obtain one at http://mozilla.org/MPL/2.0/.
 
-// Package events contains all the events that whatsmeow.Client emits to functions registered with AddEventHandler.
+// Package events contains all the events that whatsmeow.Client emits to functions registered with AddEventHandler or whatsmeow.Subscribe.
 package events
 
 import (
@@ -13,6 +13,7 @@ import (
 
 	waBinary "github.com/insomnius/whatsmeow/binary"
 	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/historysync"
 	"github.com/insomnius/whatsmeow/types"
 )
 
@@ -46,6 +47,48 @@ type PairError struct {
 	Error        error
 }
 
+// PairingStage is a step of the pairing process, see PairProgress.
+type PairingStage string
+
+const (
+	// PairingStageCodeGenerated means new QR codes were received from the server, or a pairing code was generated with PairPhone.
+	PairingStageCodeGenerated PairingStage = "code_generated"
+	// PairingStageScanned means the QR code was scanned or the pairing code was entered on the phone.
+	PairingStageScanned PairingStage = "scanned"
+	// PairingStageKeysExchanged means the identity sent by the phone was verified and the device has been signed.
+	PairingStageKeysExchanged PairingStage = "keys_exchanged"
+	// PairingStageSuccess means the pairing is complete, PairSuccess is emitted at the same time.
+	PairingStageSuccess PairingStage = "success"
+	// PairingStageFailed means the pairing failed, PairError is emitted at the same time for errors after scanning.
+	PairingStageFailed PairingStage = "failed"
+)
+
+// PairingMethod is the way the device is being paired with the phone.
+type PairingMethod string
+
+const (
+	PairingMethodQR        PairingMethod = "qr"
+	PairingMethodPhoneCode PairingMethod = "phone_code"
+)
+
+// PairProgress is emitted at every stage of pairing, in addition to the more specific events like QR and PairSuccess,
+// so that onboarding can be tracked from a single event type.
+type PairProgress struct {
+	Stage  PairingStage
+	Method PairingMethod
+	// The JID of the new device, which is only known after the code has been scanned.
+	// When pairing with a phone code, the earlier stages contain the user JID of the phone number instead.
+	ID types.JID
+	// The number of QR codes received in the code_generated stage.
+	Codes int
+
+	// The error that caused a failed stage and the error code that was sent to the server, if any.
+	Error     error
+	ErrorCode int
+
+	Timestamp time.Time
+}
+
 // QRScannedWithoutMultidevice is emitted when the pairing QR code is scanned, but the phone didn't have multidevice enabled.
 // The same QR code can still be scanned after this event, which means the user can just be told to enable multidevice and re-scan the code.
 type QRScannedWithoutMultidevice struct{}
@@ -69,6 +112,12 @@ type KeepAliveTimeout struct {
 // Note that if the websocket disconnects before the pings start working, this event will not be emitted.
 type KeepAliveRestored struct{}
 
+// KeepAliveLatency is emitted after each successful keepalive ping with the measured round-trip time.
+// A steadily growing latency is usually a sign that the connection is about to time out.
+type KeepAliveLatency struct {
+	Latency time.Duration
+}
+
 // LoggedOut is emitted when the client has been unpaired from the phone.
 //
 // This can happen while connected (stream:error messages) or right after connecting (connect failure messages).
@@ -189,14 +238,63 @@ type StreamError struct {
 // Disconnected is emitted when the websocket is closed by the server.
 type Disconnected struct{}
 
+// ConnectionStateChanged is emitted whenever the state of the connection changes.
+// The events are dispatched in the order the transitions happened.
+type ConnectionStateChanged struct {
+	Previous types.ConnectionState
+	State    types.ConnectionState
+	// Reason is the error that caused the transition, if any. Transitions caused by the server, like bans
+	// and logouts, have a *whatsmeow.ServerDisconnectError containing the code the server sent.
+	Reason error
+}
+
+// ReconnectAttempt is emitted before each automatic reconnection attempt.
+//
+// The Attempt counter is only reset after a successful connection, so a high number means that the connection is flapping.
+type ReconnectAttempt struct {
+	Attempt int           // The number of the attempt, starting from 1.
+	Delay   time.Duration // How long the client waits before the attempt.
+	Error   error         // Why the previous connection or attempt failed, nil if the server closed the websocket without a reason.
+}
+
+// ReconnectStopped is emitted when the ReconnectPolicy of the client gives up on reconnecting.
+type ReconnectStopped struct {
+	Attempts int   // The number of attempts that were made.
+	Error    error // The error that caused the policy to give up.
+}
+
 // HistorySync is emitted when the phone has sent a blob of historical messages.
 type HistorySync struct {
 	Data *waProto.HistorySync
 }
 
+// HistorySyncConversation is emitted for each conversation in a history sync blob if Client.StreamHistorySync
+// is enabled. In that mode, the HistorySync event isn't emitted and the blob is parsed one conversation at a time.
+//
+// Status messages in the blob are emitted as a conversation with the types.StatusBroadcastJID chat.
+type HistorySyncConversation struct {
+	SyncType     waProto.HistorySync_HistorySyncType
+	Conversation *historysync.Conversation
+}
+
+// HistorySyncComplete is emitted after all conversations of a history sync blob have been emitted as
+// HistorySyncConversation events, if Client.StreamHistorySync is enabled.
+type HistorySyncComplete struct {
+	SyncType   waProto.HistorySync_HistorySyncType
+	ChunkOrder uint32
+	Progress   uint32
+	Pushnames  []historysync.Pushname
+}
+
+// UnreadCountChange is emitted when the unread count or last read marker of a chat changes.
+// It's only emitted if Client.EnableUnreadTracking is set, see Client.GetUnreadState for details.
+type UnreadCountChange struct {
+	types.UnreadState
+}
+
 // UndecryptableMessage is emitted when receiving a new message that failed to decrypt.
 //
-// The library will automatically ask the sender to retry. If the sender resends the message,
+// The library will automatically ask the sender to retry according to Client.RetryPolicy. If the sender resends the message,
 // and it's decryptable, then it will be emitted as a normal Message event.
 //
 // The UndecryptableMessage event may also be repeated if the resent message is also undecryptable.
@@ -214,8 +312,9 @@ type Message struct {
 	Message *waProto.Message  // The actual message struct
 
 	IsEphemeral           bool // True if the message was unwrapped from an EphemeralMessage
-	IsViewOnce            bool // True if the message was unwrapped from a ViewOnceMessage or ViewOnceMessageV2
-	IsViewOnceV2          bool // True if the message was unwrapped from a ViewOnceMessage
+	IsViewOnce            bool // True if the message was unwrapped from any of the view-once wrappers, or the media itself is marked as view-once
+	IsViewOnceV2          bool // True if the message was unwrapped from a ViewOnceMessageV2 or ViewOnceMessageV2Extension
+	IsViewOnceV2Extension bool // True if the message was unwrapped from a ViewOnceMessageV2Extension (used for voice messages)
 	IsDocumentWithCaption bool // True if the message was unwrapped from a DocumentWithCaptionMessage
 	IsEdit                bool // True if the message was unwrapped from an EditedMessage
 
@@ -224,7 +323,7 @@ type Message struct {
 	RawMessage *waProto.Message
 }
 
-// UnwrapRaw fills the Message, IsEphemeral and IsViewOnce fields based on the raw message in the RawMessage field.
+// UnwrapRaw fills the Message, IsEphemeral, IsViewOnce and other flag fields based on the raw message in the RawMessage field.
 func (evt *Message) UnwrapRaw() *Message {
 	evt.Message = evt.RawMessage
 	if evt.Message.GetDeviceSentMessage().GetMessage() != nil {
@@ -247,6 +346,15 @@ func (evt *Message) UnwrapRaw() *Message {
 		evt.IsViewOnce = true
 		evt.IsViewOnceV2 = true
 	}
+	if evt.Message.GetViewOnceMessageV2Extension().GetMessage() != nil {
+		evt.Message = evt.Message.GetViewOnceMessageV2Extension().GetMessage()
+		evt.IsViewOnce = true
+		evt.IsViewOnceV2 = true
+		evt.IsViewOnceV2Extension = true
+	}
+	if evt.Message.GetImageMessage().GetViewOnce() || evt.Message.GetVideoMessage().GetViewOnce() {
+		evt.IsViewOnce = true
+	}
 	if evt.Message.GetDocumentWithCaptionMessage().GetMessage() != nil {
 		evt.Message = evt.Message.GetDocumentWithCaptionMessage().GetMessage()
 		evt.IsDocumentWithCaption = true
@@ -258,6 +366,85 @@ func (evt *Message) UnwrapRaw() *Message {
 	return evt
 }
 
+// MessageEdit is emitted after the Message event for messages that edit a previously sent message.
+type MessageEdit struct {
+	Info types.MessageInfo // Information about the edit message itself
+
+	// The ID of the message that was edited. Only the sender of a message can edit it,
+	// so the original message is the one with this ID sent by Info.Sender in Info.Chat.
+	OriginalID types.MessageID
+	// The new content of the message.
+	NewContent *waProto.Message
+	// The time when the message was edited, as reported by the sender.
+	EditTimestamp time.Time
+
+	// The original message, if the device store has a message store and it contains the message.
+	Original          *waProto.Message
+	OriginalTimestamp time.Time
+}
+
+// ReactionUpdate is emitted after the Message event for messages that add, change or remove a reaction.
+type ReactionUpdate struct {
+	Info types.MessageInfo // Information about the reaction message itself
+
+	// The ID of the message that was reacted to.
+	TargetID types.MessageID
+	// The new reaction of Info.Sender. This is empty if the sender removed their reaction.
+	Reaction string
+	Removed  bool
+
+	// The current aggregated reactions to the target message, including this update. This is only set
+	// if the device store has a reaction store (see store.ReactionStore).
+	Reactions *types.MessageReactions
+}
+
+// PollUpdate is emitted after the Message event for poll votes that were successfully decrypted.
+type PollUpdate struct {
+	Info types.MessageInfo // Information about the vote message itself
+
+	// The ID of the poll that was voted in.
+	PollID types.MessageID
+	// The SHA-256 hashes of the options the voter selected. This is empty if the voter removed their vote.
+	SelectedHashes [][]byte
+	// The names of the selected options. This is only set if the original poll is known,
+	// i.e. the device store has a poll store (see store.PollStore) that contains the poll.
+	SelectedOptions []string
+
+	// The current results of the poll, including this vote. Like SelectedOptions, this requires a poll store.
+	Results *types.PollResults
+}
+
+// LiveLocationUpdate is emitted after the Message event for live location messages. The first message of a live
+// location share is sent in the chat itself, while later updates have increasing sequence numbers and are usually
+// sent in types.LocationBroadcastJID, encrypted with a sender key that the sharer distributed in the chat.
+type LiveLocationUpdate struct {
+	Info types.MessageInfo // Information about the message containing the location
+
+	// True if this is the initial message of the share, false for later updates.
+	Initial bool
+
+	Latitude         float64
+	Longitude        float64
+	AccuracyInMeters uint32
+	SpeedInMps       float32
+	// The direction of the movement in degrees clockwise from magnetic north.
+	Heading uint32
+	Caption string
+	// The sequence number of the update, which increases with each update within a share.
+	SequenceNumber int64
+	// The time since the start of the share, if the sender included it.
+	TimeOffset time.Duration
+}
+
+// Album is emitted by whatsmeow.AlbumMiddleware instead of separate Message events when someone sends several images
+// or videos in a row, which the official clients display as a single album.
+type Album struct {
+	Chat   types.JID
+	Sender types.JID
+	// The Message events of the album items in the order they were received.
+	Messages []*Message
+}
+
 // ReceiptType represents the type of a Receipt event.
 type ReceiptType string
 
@@ -352,6 +539,9 @@ type GroupInfo struct {
 	Announce  *types.GroupAnnounce  // Group announce status change (can only admins send messages?)
 	Ephemeral *types.GroupEphemeral // Disappearing messages change
 
+	MembershipApprovalMode *types.GroupMembershipApprovalMode // Join approval requirement change
+	MemberAddMode          *types.GroupMemberAddMode          // Member add mode change (can only admins add members?)
+
 	Delete *types.GroupDelete
 
 	Link   *types.GroupLinkChange
@@ -370,9 +560,81 @@ type GroupInfo struct {
 	Promote []types.JID // Users who were promoted to admins
 	Demote  []types.JID // Users who were demoted to normal users
 
+	// The push name of the Sender from the contact store, if known.
+	SenderPushName string
+	// Details of the changes in Join, Leave, Promote and Demote, in the same order.
+	ParticipantChanges []GroupParticipantChange
+
 	UnknownChanges []*waBinary.Node
 }
 
+// GroupParticipantChangeType is the type of a GroupParticipantChange.
+type GroupParticipantChangeType string
+
+const (
+	GroupParticipantChangeJoin    GroupParticipantChangeType = "join"
+	GroupParticipantChangeLeave   GroupParticipantChangeType = "leave"
+	GroupParticipantChangePromote GroupParticipantChangeType = "promote"
+	GroupParticipantChangeDemote  GroupParticipantChangeType = "demote"
+)
+
+// GroupParticipantChangeReason is the reason for a GroupParticipantChange of the join or leave type.
+type GroupParticipantChangeReason string
+
+const (
+	// The user was added by an admin (the Sender of the GroupInfo event).
+	GroupParticipantChangeReasonAdded GroupParticipantChangeReason = "added"
+	// The user joined on their own with an invite link.
+	GroupParticipantChangeReasonInviteLink GroupParticipantChangeReason = "invite_link"
+	// The user requested to join with an invite link and an admin (the Sender) approved the request.
+	GroupParticipantChangeReasonJoinApproved GroupParticipantChangeReason = "join_approved"
+	// The user joined through the community that the group is linked to.
+	GroupParticipantChangeReasonCommunity GroupParticipantChangeReason = "community"
+	// The user joined on their own in some other way.
+	GroupParticipantChangeReasonJoined GroupParticipantChangeReason = "joined"
+	// The user left the group.
+	GroupParticipantChangeReasonLeft GroupParticipantChangeReason = "left"
+	// The user was removed by an admin (the Sender).
+	GroupParticipantChangeReasonRemoved GroupParticipantChangeReason = "removed"
+)
+
+// GroupParticipantChange contains details about a change to a single participant in a GroupInfo event.
+type GroupParticipantChange struct {
+	JID  types.JID
+	Type GroupParticipantChangeType
+	// The push name of the user from the contact store, if known.
+	PushName string
+	// Why the user joined or left. This is empty for promotions and demotions.
+	Reason GroupParticipantChangeReason
+}
+
+// GroupJoinRequest is emitted to group admins when users request to join a group that requires admin approval,
+// or when pending requests are canceled.
+type GroupJoinRequest struct {
+	JID       types.JID // The group that the requests are for
+	Timestamp time.Time
+
+	// The users whose requests were created or canceled.
+	Requesters []types.JID
+	// How the users requested to join, e.g. "invite_link". This is empty for canceled requests.
+	Method string
+	// True if the requests were canceled rather than created, e.g. because the user withdrew the request.
+	Revoked bool
+}
+
+// CommunityLink is emitted after the GroupInfo event when a group is linked to or unlinked from a community.
+//
+// The notification is sent both to the community and to the group itself, so members of both will get the event twice.
+type CommunityLink struct {
+	Community types.JID             // The community that the group was linked to or unlinked from
+	Group     types.GroupLinkTarget // The linked or unlinked group. The name is only set when the notification came to the community.
+	Sender    *types.JID            // The user who linked or unlinked the group
+	Timestamp time.Time
+
+	Unlinked     bool
+	UnlinkReason types.GroupUnlinkReason // Why the group was unlinked, e.g. because the community was deleted
+}
+
 // Picture is emitted when a user's profile picture or group's photo is changed.
 //
 // You can use Client.GetProfilePictureInfo to get the actual image URL after this event.
@@ -13,7 +13,8 @@ import (
 type GroupMemberAddMode string
 
 const (
-	GroupMemberAddModeAdmin GroupMemberAddMode = "admin_add"
+	GroupMemberAddModeAdmin     GroupMemberAddMode = "admin_add"
+	GroupMemberAddModeAllMember GroupMemberAddMode = "all_member_add"
 )
 
 // GroupInfo contains basic information about a group chat on WhatsApp.
@@ -26,6 +27,7 @@ type GroupInfo struct {
 	GroupLocked
 	GroupAnnounce
 	GroupEphemeral
+	GroupMembershipApprovalMode
 
 	GroupParent
 	GroupLinkedParent
@@ -35,6 +37,8 @@ type GroupInfo struct {
 
 	ParticipantVersionID string
 	Participants         []GroupParticipant
+	// The number of participants. This is set even when the participant list isn't, e.g. when resolving invite links.
+	ParticipantCount int
 
 	MemberAddMode GroupMemberAddMode
 }
@@ -79,6 +83,19 @@ type GroupAnnounce struct {
 	AnnounceVersionID string
 }
 
+// GroupMembershipApprovalMode specifies whether admins have to approve users who join with an invite link.
+type GroupMembershipApprovalMode struct {
+	IsJoinApprovalRequired bool
+}
+
+// GroupJoinRequest is a pending request to join a group that requires admin approval.
+type GroupJoinRequest struct {
+	JID         JID
+	RequestedAt time.Time
+	// How the user requested to join, e.g. "invite_link" or "linked_group_join" for community members.
+	Method string
+}
+
 // GroupParticipant contains info about a participant of a WhatsApp group chat.
 type GroupParticipant struct {
 	JID          JID
@@ -128,6 +145,14 @@ type GroupLinkTarget struct {
 	GroupIsDefaultSub
 }
 
+// CommunityGroups contains the groups of a community, see Client.GetCommunityGroups.
+type CommunityGroups struct {
+	// The announcement group that every member of the community is in, where only admins can send messages.
+	Announcement *GroupLinkTarget
+	// The other groups of the community.
+	SubGroups []*GroupLinkTarget
+}
+
 type GroupLinkChange struct {
 	Type         GroupLinkChangeType
 	UnlinkReason GroupUnlinkReason
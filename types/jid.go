@@ -36,6 +36,10 @@ var (
 	OfficialBusinessJID = NewJID("16505361212", LegacyUserServer)
 )
 
+// LocationBroadcastJID is the pseudo-chat that live location updates are sent in. The sender key for it
+// is distributed in the chats that the location is shared in.
+var LocationBroadcastJID = NewJID("location", BroadcastServer)
+
 // MessageID is the internal ID of a WhatsApp message.
 type MessageID = string
 
@@ -79,9 +83,9 @@ func (jid JID) SignalAddress() *signalProtocol.SignalAddress {
 	return signalProtocol.NewSignalAddress(user, uint32(jid.Device))
 }
 
-// IsBroadcastList returns true if the JID is a broadcast list, but not the status broadcast.
+// IsBroadcastList returns true if the JID is a broadcast list, but not the status or location broadcast.
 func (jid JID) IsBroadcastList() bool {
-	return jid.Server == BroadcastServer && jid.User != StatusBroadcastJID.User
+	return jid.Server == BroadcastServer && jid.User != StatusBroadcastJID.User && jid.User != LocationBroadcastJID.User
 }
 
 // NewADJID creates a new AD JID.
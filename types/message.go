@@ -51,6 +51,49 @@ type MessageInfo struct {
 	DeviceSentMeta *DeviceSentMeta // Metadata for direct messages sent from another one of the user's own devices.
 }
 
+// MessageReactions contains the current reactions to a message.
+type MessageReactions struct {
+	Chat      JID
+	MessageID MessageID
+	// Reactions maps each reaction (usually an emoji) to the users who have reacted with it, earliest first.
+	Reactions map[string][]JID
+}
+
+// Counts returns the number of users who have reacted with each reaction.
+func (mr *MessageReactions) Counts() map[string]int {
+	counts := make(map[string]int, len(mr.Reactions))
+	for reaction, senders := range mr.Reactions {
+		counts[reaction] = len(senders)
+	}
+	return counts
+}
+
+// PollResults contains the current results of a poll.
+type PollResults struct {
+	Chat   JID
+	PollID MessageID
+	Name   string
+	// The maximum number of options each voter can select. Zero means there's no limit.
+	SelectableOptionCount int
+	// The options of the poll in the original order, with the users who have voted for each one.
+	Options []PollOptionResult
+}
+
+// PollOptionResult contains the voters of a single poll option.
+type PollOptionResult struct {
+	Name   string
+	Voters []JID
+}
+
+// Counts returns the number of votes for each option.
+func (pr *PollResults) Counts() map[string]int {
+	counts := make(map[string]int, len(pr.Options))
+	for _, option := range pr.Options {
+		counts[option.Name] = len(option.Voters)
+	}
+	return counts
+}
+
 // SourceString returns a log-friendly representation of who sent the message and where.
 func (ms *MessageSource) SourceString() string {
 	if ms.Sender != ms.Chat {
@@ -59,3 +102,16 @@ func (ms *MessageSource) SourceString() string {
 		return ms.Chat.String()
 	}
 }
+
+// UnreadState contains the unread messages and last read marker of a chat.
+type UnreadState struct {
+	Chat         JID
+	Count        int  // The number of unread incoming messages.
+	MarkedUnread bool // Whether the chat was manually marked as unread.
+
+	LastUnreadID        MessageID // The ID of the newest unread message, if known.
+	LastUnreadTimestamp time.Time // The timestamp of the newest unread message, if known.
+
+	LastReadID MessageID // The ID of the newest message that was marked as read.
+	LastReadAt time.Time // The time when the chat was last read.
+}
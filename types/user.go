@@ -26,6 +26,22 @@ type UserInfo struct {
 	Devices      []JID
 }
 
+// LinkedDevice contains info about one of the devices of the user's own account, see Client.GetLinkedDevices.
+//
+// WhatsApp only tells the primary device the platforms and last active times of companion devices,
+// so that information isn't available for other devices than the current one.
+type LinkedDevice struct {
+	JID JID
+	// KeyIndex is the index of the device in the account's signed device list. Devices linked later have higher indexes.
+	KeyIndex int
+	// IsPrimary is true for the phone, which is always device 0.
+	IsPrimary bool
+	// IsCurrent is true for the device the client is logged in as.
+	IsCurrent bool
+	// Platform is the platform of the device, e.g. "smba" or "android". It's only set for the current device.
+	Platform string
+}
+
 // ProfilePictureInfo contains the ID and URL for a WhatsApp user's profile picture or group's photo.
 type ProfilePictureInfo struct {
 	URL  string // The full URL for the image, can be downloaded with a simple HTTP request.
@@ -102,6 +118,13 @@ type PrivacySettings struct {
 	ReadReceipts PrivacySetting
 }
 
+// TwoFactorStatus contains the state of the account's two-step verification, see Client.GetTwoFactorStatus.
+type TwoFactorStatus struct {
+	Enabled       bool
+	HasEmail      bool
+	EmailVerified bool
+}
+
 // StatusPrivacyType is the type of list in StatusPrivacy.
 type StatusPrivacyType string
 
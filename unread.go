@@ -0,0 +1,295 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+// maxTrackedUnreadMessages is the number of unread message IDs remembered per chat.
+// Older unread messages are still counted, but reading them by ID can't be tracked exactly.
+const maxTrackedUnreadMessages = 1000
+
+type unreadMessage struct {
+	id        types.MessageID
+	sender    types.JID
+	timestamp time.Time
+}
+
+type unreadChat struct {
+	// The unread incoming messages whose IDs are known, from oldest to newest.
+	messages []unreadMessage
+	// The number of older unread messages whose IDs aren't known, e.g. counts from history sync.
+	untracked    int
+	markedUnread bool
+
+	lastReadID types.MessageID
+	lastReadAt time.Time
+}
+
+func (uc *unreadChat) state(chat types.JID) types.UnreadState {
+	state := types.UnreadState{
+		Chat:         chat,
+		Count:        len(uc.messages) + uc.untracked,
+		MarkedUnread: uc.markedUnread,
+		LastReadID:   uc.lastReadID,
+		LastReadAt:   uc.lastReadAt,
+	}
+	if len(uc.messages) > 0 {
+		newest := uc.messages[len(uc.messages)-1]
+		state.LastUnreadID = newest.id
+		state.LastUnreadTimestamp = newest.timestamp
+	}
+	return state
+}
+
+func (uc *unreadChat) addMessage(id types.MessageID, sender types.JID, timestamp time.Time) bool {
+	for _, msg := range uc.messages {
+		if msg.id == id {
+			return false
+		}
+	}
+	if len(uc.messages) >= maxTrackedUnreadMessages {
+		uc.messages = append(uc.messages[:0], uc.messages[1:]...)
+		uc.untracked++
+	}
+	uc.messages = append(uc.messages, unreadMessage{id: id, sender: sender, timestamp: timestamp})
+	return true
+}
+
+// markRead marks the given messages and everything before them as read.
+func (uc *unreadChat) markRead(ids []types.MessageID, readAt time.Time) bool {
+	newestIndex := -1
+	for i, msg := range uc.messages {
+		for _, id := range ids {
+			if msg.id == id {
+				newestIndex = i
+			}
+		}
+	}
+	if newestIndex >= 0 {
+		uc.lastReadID = uc.messages[newestIndex].id
+		remaining := make([]unreadMessage, len(uc.messages)-newestIndex-1)
+		copy(remaining, uc.messages[newestIndex+1:])
+		uc.messages = remaining
+	} else if uc.untracked > 0 {
+		// The messages aren't tracked, so they're most likely some of the older unread messages
+		uc.lastReadID = ids[len(ids)-1]
+	} else if uc.lastReadID == ids[len(ids)-1] || len(uc.messages) > 0 {
+		return false
+	} else {
+		uc.lastReadID = ids[len(ids)-1]
+	}
+	uc.untracked = 0
+	uc.markedUnread = false
+	uc.lastReadAt = readAt
+	return true
+}
+
+func (uc *unreadChat) markAllRead(readAt time.Time) bool {
+	if len(uc.messages) == 0 && uc.untracked == 0 && !uc.markedUnread {
+		return false
+	}
+	if len(uc.messages) > 0 {
+		uc.lastReadID = uc.messages[len(uc.messages)-1].id
+		uc.lastReadAt = readAt
+	}
+	uc.messages = nil
+	uc.untracked = 0
+	uc.markedUnread = false
+	return true
+}
+
+// markReadUntil marks all messages that aren't newer than the given timestamp as read.
+func (uc *unreadChat) markReadUntil(until, readAt time.Time) bool {
+	count := 0
+	for count < len(uc.messages) && !uc.messages[count].timestamp.After(until) {
+		count++
+	}
+	if count == len(uc.messages) {
+		return uc.markAllRead(readAt)
+	} else if count > 0 {
+		return uc.markRead([]types.MessageID{uc.messages[count-1].id}, readAt)
+	} else if uc.untracked == 0 && !uc.markedUnread {
+		return false
+	}
+	uc.untracked = 0
+	uc.markedUnread = false
+	return true
+}
+
+// GetUnreadState returns the unread state of the given chat.
+//
+// Unread tracking must be enabled with EnableUnreadTracking. The state is only kept in memory: it starts from the
+// unread counts in history syncs and is updated based on incoming messages, messages sent from any of the user's
+// devices, read receipts and app state changes. Whenever it changes, an events.UnreadCountChange is dispatched.
+func (cli *Client) GetUnreadState(chat types.JID) types.UnreadState {
+	chat = chat.ToNonAD()
+	cli.unreadChatsLock.Lock()
+	defer cli.unreadChatsLock.Unlock()
+	uc, ok := cli.unreadChats[chat]
+	if !ok {
+		return types.UnreadState{Chat: chat}
+	}
+	return uc.state(chat)
+}
+
+// GetUnreadCount returns the number of unread messages in the given chat, see GetUnreadState.
+func (cli *Client) GetUnreadCount(chat types.JID) int {
+	return cli.GetUnreadState(chat).Count
+}
+
+// GetUnreadChats returns the unread state of all chats that have unread messages or are marked as unread,
+// ordered so that the chat with the newest unread message is first.
+func (cli *Client) GetUnreadChats() []types.UnreadState {
+	cli.unreadChatsLock.Lock()
+	states := make([]types.UnreadState, 0, len(cli.unreadChats))
+	for chat, uc := range cli.unreadChats {
+		if state := uc.state(chat); state.Count > 0 || state.MarkedUnread {
+			states = append(states, state)
+		}
+	}
+	cli.unreadChatsLock.Unlock()
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].LastUnreadTimestamp.After(states[j].LastUnreadTimestamp)
+	})
+	return states
+}
+
+// updateUnreadState runs the given function on the unread state of a chat and dispatches an
+// events.UnreadCountChange if the function returns true.
+func (cli *Client) updateUnreadState(chat types.JID, fn func(uc *unreadChat) bool) {
+	if !cli.EnableUnreadTracking || chat.IsEmpty() || chat.Server == types.BroadcastServer {
+		return
+	}
+	chat = chat.ToNonAD()
+	cli.unreadChatsLock.Lock()
+	uc, ok := cli.unreadChats[chat]
+	if !ok {
+		uc = &unreadChat{}
+	}
+	changed := fn(uc)
+	if changed {
+		cli.unreadChats[chat] = uc
+	}
+	state := uc.state(chat)
+	cli.unreadChatsLock.Unlock()
+	if changed {
+		cli.dispatchEvent(&events.UnreadCountChange{UnreadState: state})
+	}
+}
+
+// trackUnreadMessage updates the unread state of the chat of an incoming message. Messages sent from the user's
+// other devices mark the chat as read, like they do in the official apps.
+func (cli *Client) trackUnreadMessage(info *types.MessageInfo, msg *waProto.Message) {
+	if !cli.EnableUnreadTracking || !isUnreadCountable(msg) {
+		return
+	}
+	cli.updateUnreadState(info.Chat, func(uc *unreadChat) bool {
+		if info.IsFromMe {
+			return uc.markAllRead(info.Timestamp)
+		}
+		return uc.addMessage(info.ID, info.Sender, info.Timestamp)
+	})
+}
+
+func (cli *Client) trackUnreadRead(chat types.JID, ids []types.MessageID, readAt time.Time) {
+	if len(ids) == 0 {
+		return
+	}
+	cli.updateUnreadState(chat, func(uc *unreadChat) bool {
+		return uc.markRead(ids, readAt)
+	})
+}
+
+func (cli *Client) trackUnreadAppState(evt *events.MarkChatAsRead) {
+	cli.updateUnreadState(evt.JID, func(uc *unreadChat) bool {
+		if lastMessageTS := evt.Action.GetMessageRange().GetLastMessageTimestamp(); evt.Action.GetRead() && lastMessageTS > 0 {
+			// Messages received after the chat was marked as read on another device are still unread
+			return uc.markReadUntil(time.Unix(lastMessageTS, 0), evt.Timestamp)
+		} else if evt.Action.GetRead() {
+			return uc.markAllRead(evt.Timestamp)
+		} else if uc.markedUnread {
+			return false
+		}
+		uc.markedUnread = true
+		return true
+	})
+}
+
+// unreadMessagesUntil returns the tracked unread messages of a chat up to and including the given message,
+// or all of them if the message is nil.
+func (cli *Client) unreadMessagesUntil(chat types.JID, until *types.MessageInfo) []unreadMessage {
+	cli.unreadChatsLock.Lock()
+	defer cli.unreadChatsLock.Unlock()
+	uc, ok := cli.unreadChats[chat.ToNonAD()]
+	if !ok {
+		return nil
+	}
+	var messages []unreadMessage
+	for _, msg := range uc.messages {
+		if until != nil && !until.Timestamp.IsZero() && msg.timestamp.After(until.Timestamp) {
+			break
+		}
+		messages = append(messages, msg)
+		if until != nil && msg.id == until.ID {
+			break
+		}
+	}
+	return messages
+}
+
+// updateUnreadFromHistory fills the unread counts of chats that don't have any tracked state yet.
+func (cli *Client) updateUnreadFromHistory(conversations []*waProto.Conversation) {
+	if !cli.EnableUnreadTracking {
+		return
+	}
+	for _, conv := range conversations {
+		if conv.GetUnreadCount() <= 0 && !conv.GetMarkedAsUnread() {
+			continue
+		}
+		chatJID, err := types.ParseJID(conv.GetId())
+		if err != nil {
+			continue
+		}
+		cli.updateUnreadState(chatJID, func(uc *unreadChat) bool {
+			if len(uc.messages) > 0 || uc.untracked > 0 || uc.markedUnread || !uc.lastReadAt.IsZero() {
+				// The live state is newer than the history sync
+				return false
+			}
+			uc.untracked = int(conv.GetUnreadCount())
+			uc.markedUnread = conv.GetMarkedAsUnread()
+			return true
+		})
+	}
+}
+
+// isUnreadCountable returns true if the message is something that would be shown in the chat,
+// rather than e.g. a reaction, edit or bare sender key distribution message.
+func isUnreadCountable(msg *waProto.Message) bool {
+	if msg == nil || msg.ProtocolMessage != nil || msg.ReactionMessage != nil || msg.EncReactionMessage != nil ||
+		msg.PollUpdateMessage != nil || msg.KeepInChatMessage != nil {
+		return false
+	}
+	hasContent := false
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		switch fd.Name() {
+		case "senderKeyDistributionMessage", "messageContextInfo":
+			return true
+		}
+		hasContent = true
+		return false
+	})
+	return hasContent
+}
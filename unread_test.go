@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/store"
+	"github.com/insomnius/whatsmeow/types"
+	"github.com/insomnius/whatsmeow/types/events"
+)
+
+func TestUnreadTracking(t *testing.T) {
+	cli := NewClient(&store.Device{}, nil)
+	cli.EnableUnreadTracking = true
+	var changes int
+	cli.AddEventHandler(func(evt interface{}) {
+		if _, ok := evt.(*events.UnreadCountChange); ok {
+			changes++
+		}
+	})
+	chat := types.NewJID("1234", types.DefaultUserServer)
+	text := &waProto.Message{Conversation: proto.String("hi")}
+	for _, id := range []types.MessageID{"A", "B", "C"} {
+		cli.trackUnreadMessage(&types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}, ID: id, Timestamp: time.Now()}, text)
+	}
+	cli.trackUnreadMessage(&types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}, ID: "D"}, &waProto.Message{
+		ReactionMessage: &waProto.ReactionMessage{Text: proto.String("👍")},
+	})
+	if count := cli.GetUnreadCount(chat); count != 3 {
+		t.Fatalf("expected 3 unread messages, got %d", count)
+	}
+	cli.trackUnreadRead(chat, []types.MessageID{"B"}, time.Now())
+	state := cli.GetUnreadState(chat)
+	if state.Count != 1 || state.LastReadID != "B" || state.LastUnreadID != "C" {
+		t.Fatalf("unexpected state after reading B: %+v", state)
+	}
+	cli.trackUnreadMessage(&types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, IsFromMe: true}, ID: "E"}, text)
+	if count := cli.GetUnreadCount(chat); count != 0 {
+		t.Fatalf("expected own message to clear unread messages, got %d", count)
+	}
+	if changes != 5 {
+		t.Fatalf("expected 5 change events, got %d", changes)
+	}
+}
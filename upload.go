@@ -9,17 +9,22 @@ package whatsmeow
 import (
 	"bytes"
 	"context"
+	"crypto/aes"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"time"
 
 	"github.com/insomnius/whatsmeow/socket"
 	"github.com/insomnius/whatsmeow/util/cbcutil"
+	"github.com/insomnius/whatsmeow/util/ratelimit"
 )
 
 // UploadResponse contains the data from the attachment upload, which can be put into a message to send the attachment.
@@ -31,6 +36,19 @@ type UploadResponse struct {
 	FileEncSHA256 []byte `json:"-"`
 	FileSHA256    []byte `json:"-"`
 	FileLength    uint64 `json:"-"`
+
+	// The thumbnail generated by Client.Thumbnailer, if it's set and supports the media type.
+	JPEGThumbnail   []byte `json:"-"`
+	ThumbnailWidth  uint32 `json:"-"`
+	ThumbnailHeight uint32 `json:"-"`
+
+	// The metadata of the converted file, if one of the transcoding hooks in Client (e.g. Client.TranscodeVideo)
+	// converted the file. Mimetype is empty if the file wasn't converted. Seconds is also set for audio that wasn't
+	// converted if ProbeAudio supports the format.
+	Mimetype string `json:"-"`
+	Width    uint32 `json:"-"`
+	Height   uint32 `json:"-"`
+	Seconds  uint32 `json:"-"`
 }
 
 // Upload uploads the given attachment to WhatsApp servers.
@@ -45,7 +63,7 @@ type UploadResponse struct {
 //	imageMsg := &waProto.ImageMessage{
 //		Caption:  proto.String("Hello, world!"),
 //		Mimetype: proto.String("image/png"), // replace this with the actual mime type
-//		// you can also optionally add other fields like ContextInfo and JpegThumbnail here
+//		// you can also optionally add other fields like ContextInfo here
 //
 //		Url:           &resp.URL,
 //		DirectPath:    &resp.DirectPath,
@@ -53,6 +71,8 @@ type UploadResponse struct {
 //		FileEncSha256: resp.FileEncSHA256,
 //		FileSha256:    resp.FileSha256,
 //		FileLength:    &resp.FileLength,
+//		// empty if Client.Thumbnailer isn't set
+//		JpegThumbnail: resp.JPEGThumbnail,
 //	}
 //	_, err = cli.SendMessage(context.Background(), targetJID, "", &waProto.Message{
 //		ImageMessage: imageMsg,
@@ -60,15 +80,91 @@ type UploadResponse struct {
 //	// handle error again
 //
 // The same applies to the other message types like DocumentMessage, just replace the struct type and Message field name.
+//
+// If Client.MediaCache is set, uploading the same file again (e.g. when sending it to many chats) returns the
+// previous upload instead of uploading it again.
+//
+// If the transcoding hooks in Client are set, images, videos and audio are converted before uploading. The metadata
+// of the converted file is in the response, and it must be used in the message instead of the original metadata:
+//
+//	if len(resp.Mimetype) > 0 {
+//		imageMsg.Mimetype = proto.String(resp.Mimetype)
+//		imageMsg.Width = proto.Uint32(resp.Width)
+//		imageMsg.Height = proto.Uint32(resp.Height)
+//	}
+//
+// If Client.ValidateOutgoingMedia is set, the file is checked with ValidateMedia before uploading.
 func (cli *Client) Upload(ctx context.Context, plaintext []byte, appInfo MediaType) (resp UploadResponse, err error) {
+	return cli.UploadWithProgress(ctx, plaintext, appInfo, nil)
+}
+
+// UploadProgressFunc is called by UploadWithProgress and UploadStreamWithProgress while uploading. The numbers are
+// the amount of encrypted data sent so far and the total size of the encrypted file.
+type UploadProgressFunc func(uploaded, total int64)
+
+// UploadWithProgress uploads the given attachment like Upload, and calls the given function as the data is sent.
+//
+// The upload can be aborted by canceling the context, which also closes the underlying HTTP request.
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	// call cancel() to abort the upload
+//	resp, err := cli.UploadWithProgress(ctx, videoData, whatsmeow.MediaVideo, func(uploaded, total int64) {
+//		fmt.Printf("Uploaded %d/%d bytes\n", uploaded, total)
+//	})
+func (cli *Client) UploadWithProgress(ctx context.Context, plaintext []byte, appInfo MediaType, progress UploadProgressFunc) (resp UploadResponse, err error) {
+	var transcoded *TranscodedMedia
+	transcoded, err = cli.transcodeMedia(ctx, plaintext, appInfo)
+	if err != nil {
+		return
+	} else if transcoded != nil {
+		plaintext = transcoded.Data
+	}
+	if cli.ValidateOutgoingMedia {
+		var mimetype string
+		if transcoded != nil {
+			mimetype = transcoded.Mimetype
+		}
+		if _, err = ValidateMedia(plaintext, appInfo, mimetype); err != nil {
+			return
+		}
+	}
+	resp, err = cli.upload(ctx, plaintext, appInfo, progress)
+	if err != nil {
+		return
+	}
+	if transcoded != nil {
+		resp.Mimetype = transcoded.Mimetype
+		resp.Width = uint32(transcoded.Width)
+		resp.Height = uint32(transcoded.Height)
+		resp.Seconds = uint32(transcoded.Duration.Round(time.Second) / time.Second)
+	} else if appInfo == MediaAudio {
+		if info, probeErr := ProbeAudio(plaintext); probeErr == nil {
+			resp.Seconds = info.Seconds()
+		}
+	}
+	return
+}
+
+// upload encrypts and uploads the given file without converting it first.
+func (cli *Client) upload(ctx context.Context, plaintext []byte, appInfo MediaType, progress UploadProgressFunc) (resp UploadResponse, err error) {
+	if err = cli.startOperation(true); err != nil {
+		return
+	}
+	defer cli.finishOperation()
+
+	plaintextSHA256 := sha256.Sum256(plaintext)
+	if cached := cli.getCachedUpload(ctx, plaintextSHA256[:], appInfo); cached != nil {
+		return *cached, nil
+	} else if err = ctx.Err(); err != nil {
+		return
+	}
+
 	resp.FileLength = uint64(len(plaintext))
 	resp.MediaKey = make([]byte, 32)
 	_, err = rand.Read(resp.MediaKey)
 	if err != nil {
 		return
 	}
-
-	plaintextSHA256 := sha256.Sum256(plaintext)
 	resp.FileSHA256 = plaintextSHA256[:]
 
 	iv, cipherKey, macKey, _ := getMediaKeys(resp.MediaKey, appInfo)
@@ -88,32 +184,196 @@ func (cli *Client) Upload(ctx context.Context, plaintext []byte, appInfo MediaTy
 	fileEncSHA256 := sha256.Sum256(dataToUpload)
 	resp.FileEncSHA256 = fileEncSHA256[:]
 
-	var mediaConn *MediaConn
-	mediaConn, err = cli.refreshMediaConn(false)
+	err = cli.uploadMedia(ctx, bytes.NewReader(dataToUpload), int64(len(dataToUpload)), appInfo, &resp, progress)
+	if err == nil {
+		cli.makeUploadThumbnail(ctx, plaintext, appInfo, &resp)
+		cli.cacheUpload(ctx, resp, appInfo)
+	}
+	return
+}
+
+// UploadStream uploads the attachment read from the given reader to WhatsApp servers, like Upload,
+// but without keeping the whole file in memory.
+//
+// The size is the exact length of the data, or -1 if it's not known, in which case it's counted while reading.
+// The upload URL depends on the hash of the encrypted file, so the data has to be read twice: if the reader is an
+// io.ReadSeeker (like an *os.File), it's read directly both times. Other readers are encrypted into a temporary
+// file first, which is deleted after the upload.
+//
+// If Client.ValidateOutgoingMedia is set, only the size limit in MaxMediaSizes is checked, as the data isn't in memory.
+//
+//	file, err := os.Open("video.mp4")
+//	// handle error
+//	stat, _ := file.Stat()
+//	resp, err := cli.UploadStream(context.Background(), file, stat.Size(), whatsmeow.MediaDocument)
+func (cli *Client) UploadStream(ctx context.Context, r io.Reader, size int64, appInfo MediaType) (resp UploadResponse, err error) {
+	return cli.UploadStreamWithProgress(ctx, r, size, appInfo, nil)
+}
+
+// UploadStreamWithProgress uploads the attachment read from the given reader like UploadStream, and calls the given
+// function as the data is sent, see UploadWithProgress. If the reader isn't an io.ReadSeeker, the progress only starts
+// after the whole file has been read into the temporary file.
+func (cli *Client) UploadStreamWithProgress(ctx context.Context, r io.Reader, size int64, appInfo MediaType, progress UploadProgressFunc) (resp UploadResponse, err error) {
+	if cli.ValidateOutgoingMedia && size >= 0 {
+		if err = checkMediaSize(size, appInfo); err != nil {
+			return
+		}
+	}
+	if err = cli.startOperation(true); err != nil {
+		return
+	}
+	defer cli.finishOperation()
+
+	resp.MediaKey = make([]byte, 32)
+	_, err = rand.Read(resp.MediaKey)
+	if err != nil {
+		return
+	}
+	iv, cipherKey, macKey, _ := getMediaKeys(resp.MediaKey, appInfo)
+
+	seeker, canSeek := r.(io.ReadSeeker)
+	var tempFile *os.File
+	var output io.Writer = io.Discard
+	var start int64
+	if canSeek {
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			err = fmt.Errorf("failed to get start position of reader: %w", err)
+			return
+		}
+	} else {
+		tempFile, err = os.CreateTemp("", "whatsmeow-upload-*")
+		if err != nil {
+			err = fmt.Errorf("failed to create temporary file: %w", err)
+			return
+		}
+		defer func() {
+			_ = tempFile.Close()
+			_ = os.Remove(tempFile.Name())
+		}()
+		output = tempFile
+	}
+
+	var length int64
+	resp.FileSHA256, resp.FileEncSHA256, length, err = encryptMediaStream(&contextReader{ctx: ctx, r: r}, output, iv, cipherKey, macKey)
+	if err != nil {
+		err = fmt.Errorf("failed to encrypt file: %w", err)
+		return
+	} else if size >= 0 && length != size {
+		err = fmt.Errorf("%w (expected %d bytes, read %d)", ErrUploadSizeMismatch, size, length)
+		return
+	} else if cli.ValidateOutgoingMedia && size < 0 {
+		if err = checkMediaSize(length, appInfo); err != nil {
+			return
+		}
+	}
+	resp.FileLength = uint64(length)
+	// The ciphertext is padded to the next full block and followed by a 10-byte MAC
+	encryptedLength := (length/aes.BlockSize+1)*aes.BlockSize + 10
+
+	if tempFile != nil {
+		if _, err = tempFile.Seek(0, io.SeekStart); err != nil {
+			err = fmt.Errorf("failed to seek temporary file: %w", err)
+			return
+		}
+		err = cli.uploadMedia(ctx, tempFile, encryptedLength, appInfo, &resp, progress)
+		return
+	}
+	if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+		err = fmt.Errorf("failed to seek reader back to start: %w", err)
+		return
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_, _, _, encryptErr := encryptMediaStream(io.LimitReader(seeker, length), pipeWriter, iv, cipherKey, macKey)
+		_ = pipeWriter.CloseWithError(encryptErr)
+	}()
+	err = cli.uploadMedia(ctx, pipeReader, encryptedLength, appInfo, &resp, progress)
+	// Make sure the encryption goroutine exits if the request stopped reading early
+	_ = pipeReader.Close()
+	return
+}
+
+// encryptMediaStream encrypts media from the reader into the writer in the format that Upload uses,
+// and returns the hashes of the plaintext and the encrypted data.
+func encryptMediaStream(r io.Reader, w io.Writer, iv, cipherKey, macKey []byte) (fileSHA256, fileEncSHA256 []byte, length int64, err error) {
+	plaintextHash := sha256.New()
+	encryptedHash := sha256.New()
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	length, err = cbcutil.EncryptStream(cipherKey, iv, io.TeeReader(r, plaintextHash), io.MultiWriter(w, encryptedHash, mac))
 	if err != nil {
-		err = fmt.Errorf("failed to refresh media connections: %w", err)
 		return
 	}
+	macSum := mac.Sum(nil)[:10]
+	encryptedHash.Write(macSum)
+	if _, err = w.Write(macSum); err != nil {
+		return
+	}
+	return plaintextHash.Sum(nil), encryptedHash.Sum(nil), length, nil
+}
+
+// uploadMedia sends encrypted media to the WhatsApp media servers and fills the URL and direct path in the response.
+// The FileEncSHA256 field of the response must already be set. The progress function is optional.
+//
+// If the upload to a host fails and the body is an io.Seeker, the upload is retried with the next media host.
+func (cli *Client) uploadMedia(ctx context.Context, body io.Reader, contentLength int64, appInfo MediaType, resp *UploadResponse, progress UploadProgressFunc) (err error) {
+	mediaConn, hosts, err := cli.getMediaHosts()
+	if err != nil {
+		return err
+	}
+	seeker, canRetry := body.(io.Seeker)
+	var start int64
+	if canRetry {
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canRetry = false
+		}
+	}
+	for i, host := range hosts {
+		if i > 0 {
+			if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek upload body back to start: %w", err)
+			}
+		}
+		var retryable bool
+		retryable, err = cli.uploadMediaToHost(ctx, host, mediaConn.Auth, body, contentLength, appInfo, resp, progress)
+		cli.reportMediaHost(host, retryable)
+		if err == nil || !retryable || !canRetry || ctx.Err() != nil || i >= len(hosts)-1 {
+			return err
+		}
+		cli.Log.Warnf("Failed to upload media to %s: %v, trying with next host...", host, err)
+	}
+	return
+}
 
+// uploadMediaToHost sends encrypted media to a single media host. The first return value is true if the error was
+// caused by the connection or the server, so the upload may work with another host.
+func (cli *Client) uploadMediaToHost(ctx context.Context, host, auth string, body io.Reader, contentLength int64, appInfo MediaType, resp *UploadResponse, progress UploadProgressFunc) (retryable bool, err error) {
 	token := base64.URLEncoding.EncodeToString(resp.FileEncSHA256)
 	q := url.Values{
-		"auth":  []string{mediaConn.Auth},
+		"auth":  []string{auth},
 		"token": []string{token},
 	}
 	mmsType := mediaTypeToMMSType[appInfo]
 	uploadURL := url.URL{
 		Scheme:   "https",
-		Host:     mediaConn.Hosts[0].Hostname,
+		Host:     host,
 		Path:     fmt.Sprintf("/mms/%s/%s", mmsType, token),
 		RawQuery: q.Encode(),
 	}
 
 	var req *http.Request
-	req, err = http.NewRequestWithContext(ctx, http.MethodPost, uploadURL.String(), bytes.NewReader(dataToUpload))
+	body = ratelimit.NewReader(ctx, body, cli.UploadRateLimit, GlobalUploadRateLimit)
+	if progress != nil {
+		body = &uploadProgressReader{r: body, total: contentLength, fn: progress}
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, uploadURL.String(), body)
 	if err != nil {
 		err = fmt.Errorf("failed to prepare request: %w", err)
 		return
 	}
+	// The length can't be detected automatically if the body is wrapped in a rate limiter
+	req.ContentLength = contentLength
 
 	req.Header.Set("Origin", socket.Origin)
 	req.Header.Set("Referer", socket.Origin+"/")
@@ -122,9 +382,11 @@ func (cli *Client) Upload(ctx context.Context, plaintext []byte, appInfo MediaTy
 	httpResp, err = cli.http.Do(req)
 	if err != nil {
 		err = fmt.Errorf("failed to execute request: %w", err)
+		retryable = true
 	} else if httpResp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("upload failed with status code %d", httpResp.StatusCode)
-	} else if err = json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		retryable = httpResp.StatusCode >= 500
+	} else if err = json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
 		err = fmt.Errorf("failed to parse upload response: %w", err)
 	}
 	if httpResp != nil {
@@ -132,3 +394,32 @@ func (cli *Client) Upload(ctx context.Context, plaintext []byte, appInfo MediaTy
 	}
 	return
 }
+
+type uploadProgressReader struct {
+	r     io.Reader
+	sent  int64
+	total int64
+	fn    UploadProgressFunc
+}
+
+func (upr *uploadProgressReader) Read(p []byte) (n int, err error) {
+	n, err = upr.r.Read(p)
+	if n > 0 {
+		upr.sent += int64(n)
+		upr.fn(upr.sent, upr.total)
+	}
+	return
+}
+
+// contextReader stops reading with the context error once the context is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -270,6 +270,91 @@ func (cli *Client) GetUserDevicesContext(ctx context.Context, jids []types.JID)
 	return devices, nil
 }
 
+// GetLinkedDevices gets the list of devices linked to the user's own account, including the phone and the current device,
+// like the "Linked devices" screen on the phone. Unlike GetUserDevices, the result isn't cached.
+func (cli *Client) GetLinkedDevices(ctx context.Context) ([]types.LinkedDevice, error) {
+	if cli.Store.ID == nil {
+		return nil, ErrNotLoggedIn
+	}
+	list, err := cli.usync(ctx, []types.JID{cli.Store.ID.ToNonAD()}, "query", "message", []waBinary.Node{
+		{Tag: "devices", Attrs: waBinary.Attrs{"version": "2"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cli.parseLinkedDevices(list)
+}
+
+func (cli *Client) parseLinkedDevices(list *waBinary.Node) ([]types.LinkedDevice, error) {
+	ownID := *cli.Store.ID
+	user, ok := list.GetOptionalChildByTag("user")
+	if !ok {
+		return nil, &ElementMissingError{Tag: "user", In: "response to linked devices query"}
+	}
+	deviceList, ok := user.GetOptionalChildByTag("devices", "device-list")
+	if !ok {
+		return nil, &ElementMissingError{Tag: "device-list", In: "response to linked devices query"}
+	}
+	children := deviceList.GetChildren()
+	devices := make([]types.LinkedDevice, 0, len(children))
+	for _, child := range children {
+		ag := child.AttrGetter()
+		deviceID, ok := ag.GetInt64("id", true)
+		if child.Tag != "device" || !ok {
+			continue
+		}
+		device := types.LinkedDevice{
+			JID:       types.NewADJID(ownID.User, 0, byte(deviceID)),
+			KeyIndex:  ag.OptionalInt("key-index"),
+			IsPrimary: deviceID == 0,
+			IsCurrent: byte(deviceID) == ownID.Device,
+		}
+		if device.IsCurrent {
+			device.Platform = cli.Store.Platform
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// RemoveLinkedDevice asks the server to unlink another companion device of the user's own account,
+// like the "Log out" button in the linked devices screen on the phone.
+//
+// The primary device can't be removed. To remove the current device, use Logout instead.
+func (cli *Client) RemoveLinkedDevice(ctx context.Context, device types.JID) error {
+	if cli.Store.ID == nil {
+		return ErrNotLoggedIn
+	}
+	ownID := *cli.Store.ID
+	if device.User != ownID.User || device.Server != types.DefaultUserServer {
+		return ErrDeviceNotOwn
+	} else if device.Device == 0 {
+		return ErrCantRemovePrimaryDevice
+	} else if device.Device == ownID.Device {
+		return ErrCantRemoveCurrentDevice
+	}
+	_, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
+		Namespace: "md",
+		Type:      iqSet,
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag: "remove-companion-device",
+			Attrs: waBinary.Attrs{
+				"jid":    device,
+				"reason": "user_initiated",
+			},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove linked device: %w", err)
+	}
+	cli.userDevicesCacheLock.Lock()
+	delete(cli.userDevicesCache, ownID.ToNonAD())
+	cli.userDevicesCacheLock.Unlock()
+	return nil
+}
+
 type GetProfilePictureParams struct {
 	Preview     bool
 	ExistingID  string
@@ -357,7 +442,7 @@ func (cli *Client) handleHistoricalPushNames(names []*waProto.Pushname) {
 		var changed bool
 		if jid, err := types.ParseJID(user.GetId()); err != nil {
 			cli.Log.Warnf("Failed to parse user ID '%s' in push name history sync: %v", user.GetId(), err)
-		} else if changed, _, err = cli.Store.Contacts.PutPushName(jid, user.GetPushname()); err != nil {
+		} else if changed, _, err = cli.Store.Contacts.PutPushName(context.TODO(), jid, user.GetPushname()); err != nil {
 			cli.Log.Warnf("Failed to store push name of %s from history sync: %v", err)
 		} else if changed {
 			cli.Log.Debugf("Got push name %s for %s in history sync", user.GetPushname(), jid)
@@ -370,7 +455,7 @@ func (cli *Client) updatePushName(user types.JID, messageInfo *types.MessageInfo
 		return
 	}
 	user = user.ToNonAD()
-	changed, previousName, err := cli.Store.Contacts.PutPushName(user, name)
+	changed, previousName, err := cli.Store.Contacts.PutPushName(context.TODO(), user, name)
 	if err != nil {
 		cli.Log.Errorf("Failed to save push name of %s in device store: %v", user, err)
 	} else if changed {
@@ -388,7 +473,7 @@ func (cli *Client) updateBusinessName(user types.JID, messageInfo *types.Message
 	if cli.Store.Contacts == nil {
 		return
 	}
-	changed, previousName, err := cli.Store.Contacts.PutBusinessName(user, name)
+	changed, previousName, err := cli.Store.Contacts.PutBusinessName(context.TODO(), user, name)
 	if err != nil {
 		cli.Log.Errorf("Failed to save business name of %s in device store: %v", user, err)
 	} else if changed {
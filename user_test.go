@@ -0,0 +1,78 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	waBinary "github.com/insomnius/whatsmeow/binary"
+	"github.com/insomnius/whatsmeow/store/inmemstore"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func newLinkedDevicesTestClient() *Client {
+	device := inmemstore.New(nil).NewDevice()
+	jid := types.NewADJID("1111", 0, 2)
+	device.ID = &jid
+	device.Platform = "smba"
+	return NewClient(device, nil)
+}
+
+func TestParseLinkedDevices(t *testing.T) {
+	cli := newLinkedDevicesTestClient()
+	list := &waBinary.Node{Tag: "list", Content: []waBinary.Node{{
+		Tag:   "user",
+		Attrs: waBinary.Attrs{"jid": types.NewJID("1111", types.DefaultUserServer)},
+		Content: []waBinary.Node{{Tag: "devices", Content: []waBinary.Node{{
+			Tag: "device-list",
+			Content: []waBinary.Node{
+				{Tag: "device", Attrs: waBinary.Attrs{"id": "0"}},
+				{Tag: "device", Attrs: waBinary.Attrs{"id": "2", "key-index": "3"}},
+				{Tag: "device", Attrs: waBinary.Attrs{"id": "5", "key-index": "7"}},
+				{Tag: "something-else", Attrs: waBinary.Attrs{"id": "6"}},
+			},
+		}}}},
+	}}}
+	devices, err := cli.parseLinkedDevices(list)
+	if err != nil {
+		t.Fatalf("Failed to parse linked devices: %v", err)
+	}
+	expected := []types.LinkedDevice{
+		{JID: types.NewADJID("1111", 0, 0), IsPrimary: true},
+		{JID: types.NewADJID("1111", 0, 2), KeyIndex: 3, IsCurrent: true, Platform: "smba"},
+		{JID: types.NewADJID("1111", 0, 5), KeyIndex: 7},
+	}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("Unexpected devices\nexpected: %+v\ngot:      %+v", expected, devices)
+	}
+
+	var missingErr *ElementMissingError
+	if _, err = cli.parseLinkedDevices(&waBinary.Node{Tag: "list"}); !errors.As(err, &missingErr) {
+		t.Errorf("Expected ElementMissingError for an empty list, got %v", err)
+	}
+}
+
+func TestRemoveLinkedDevice_Invalid(t *testing.T) {
+	cli := newLinkedDevicesTestClient()
+	tests := map[types.JID]error{
+		types.NewADJID("2222", 0, 3): ErrDeviceNotOwn,
+		types.NewADJID("1111", 0, 0): ErrCantRemovePrimaryDevice,
+		types.NewADJID("1111", 0, 2): ErrCantRemoveCurrentDevice,
+	}
+	for device, expected := range tests {
+		if err := cli.RemoveLinkedDevice(context.Background(), device); !errors.Is(err, expected) {
+			t.Errorf("Expected %v when removing %s, got %v", expected, device, err)
+		}
+	}
+	cli.Store.ID = nil
+	if err := cli.RemoveLinkedDevice(context.Background(), types.NewADJID("1111", 0, 3)); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn, got %v", err)
+	}
+}
@@ -23,3 +23,25 @@ func TestEncryptDecrypt(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEncryptDecryptStream(t *testing.T) {
+	key := []byte("MySecretSecretSecretSecretKey123")
+	iv := []byte("0123456789abcdef")
+	for _, size := range []int{0, 1, 16, 1000, streamChunkSize, streamChunkSize + 5, 3 * streamChunkSize} {
+		plain := bytes.Repeat([]byte{'a'}, size)
+		expected, err := Encrypt(key, iv, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cipher bytes.Buffer
+		length, err := EncryptStream(key, iv, bytes.NewReader(plain), &cipher)
+		if err != nil || length != int64(size) || !bytes.Equal(cipher.Bytes(), expected) {
+			t.Fatalf("stream encryption of %d bytes doesn't match Encrypt (err: %v)", size, err)
+		}
+		var decrypted bytes.Buffer
+		length, err = DecryptStream(key, iv, &cipher, &decrypted)
+		if err != nil || length != int64(size) || !bytes.Equal(decrypted.Bytes(), plain) {
+			t.Fatalf("stream decryption of %d bytes failed (err: %v)", size, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cbcutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// streamChunkSize is the amount of data processed at once by EncryptStream and DecryptStream. It must be a multiple
+// of the AES block size.
+const streamChunkSize = 32 * 1024
+
+/*
+EncryptStream is like Encrypt, but it reads the plaintext from a reader and writes the ciphertext to a writer
+chunk by chunk, so the whole plaintext doesn't need to be in memory. The initialization vector is required,
+it's not generated or written to the output. The return value is the length of the plaintext that was read.
+*/
+func EncryptStream(key, iv []byte, plaintext io.Reader, ciphertext io.Writer) (int64, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return 0, err
+	}
+	cbc := cipher.NewCBCEncrypter(block, iv)
+	buf := make([]byte, streamChunkSize)
+	var length int64
+	for {
+		n, err := io.ReadFull(plaintext, buf)
+		length += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The padded final chunk always fits in the buffer, as the chunk size is a multiple of the block size
+			final := pad(buf[:n], aes.BlockSize)
+			cbc.CryptBlocks(final, final)
+			_, err = ciphertext.Write(final)
+			return length, err
+		} else if err != nil {
+			return length, err
+		}
+		cbc.CryptBlocks(buf, buf)
+		if _, err = ciphertext.Write(buf); err != nil {
+			return length, err
+		}
+	}
+}
+
+/*
+DecryptStream is like Decrypt, but it reads the ciphertext from a reader and writes the plaintext to a writer
+chunk by chunk. The initialization vector is required. The return value is the length of the plaintext that was written.
+*/
+func DecryptStream(key, iv []byte, ciphertext io.Reader, plaintext io.Writer) (int64, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return 0, err
+	}
+	cbc := cipher.NewCBCDecrypter(block, iv)
+	buf := make([]byte, streamChunkSize)
+	// The last block is held back until the end of the input, as it contains the padding
+	lastBlock := make([]byte, 0, aes.BlockSize)
+	var length int64
+	for {
+		n, err := io.ReadFull(ciphertext, buf)
+		if n%aes.BlockSize != 0 {
+			return length, fmt.Errorf("ciphertext is not a multiple of the block size")
+		} else if n > 0 {
+			cbc.CryptBlocks(buf[:n], buf[:n])
+			if len(lastBlock) > 0 {
+				if _, err := plaintext.Write(lastBlock); err != nil {
+					return length, err
+				}
+				length += int64(len(lastBlock))
+			}
+			if _, err := plaintext.Write(buf[:n-aes.BlockSize]); err != nil {
+				return length, err
+			}
+			length += int64(n - aes.BlockSize)
+			lastBlock = append(lastBlock[:0], buf[n-aes.BlockSize:n]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return length, err
+		}
+	}
+	if len(lastBlock) == 0 {
+		return 0, fmt.Errorf("ciphertext is shorter then block size: 0 / %d", aes.BlockSize)
+	}
+	final, err := unpad(lastBlock)
+	if err != nil {
+		return length, err
+	}
+	_, err = plaintext.Write(final)
+	return length + int64(len(final)), err
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package imageutil contains the image scaling and encoding helpers used for thumbnails, stickers and profile pictures.
+package imageutil
+
+import (
+	"image"
+)
+
+// FitSize returns the largest dimensions with the same aspect ratio as width×height that fit in a maxSize×maxSize box.
+// Neither of the returned dimensions is less than 1.
+func FitSize(width, height, maxSize int) (int, int) {
+	if width > height {
+		return maxSize, max(1, height*maxSize/width)
+	}
+	return max(1, width*maxSize/height), maxSize
+}
+
+// ScaleDown resizes the image to fit in a maxSize×maxSize box while keeping the aspect ratio.
+// Images that are already small enough are returned as-is.
+//
+//	thumbnail := imageutil.ScaleDown(img, 72)
+func ScaleDown(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() <= maxSize && bounds.Dy() <= maxSize {
+		return src
+	}
+	width, height := FitSize(bounds.Dx(), bounds.Dy(), maxSize)
+	return Resize(src, width, height)
+}
+
+// Resize scales the image to exactly width×height by averaging the source pixels covered by each destination
+// pixel. When upscaling, each destination pixel covers less than a source pixel, which makes this
+// nearest-neighbor scaling.
+//
+//	width, height := imageutil.FitSize(img.Bounds().Dx(), img.Bounds().Dy(), 512)
+//	resized := imageutil.Resize(img, width, height)
+func Resize(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := bounds.Min.Y+y*srcH/height, bounds.Min.Y+max((y+1)*srcH/height, y*srcH/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := bounds.Min.X+x*srcW/width, bounds.Min.X+max((x+1)*srcW/width, x*srcW/width+1)
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+			// The averaged values are premultiplied, which is what image.RGBA stores
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count >> 8)
+			dst.Pix[offset+1] = uint8(g / count >> 8)
+			dst.Pix[offset+2] = uint8(b / count >> 8)
+			dst.Pix[offset+3] = uint8(a / count >> 8)
+		}
+	}
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		width, height, maxSize int
+		expectedW, expectedH   int
+	}{
+		{1000, 500, 100, 100, 50},
+		{500, 1000, 100, 50, 100},
+		{300, 300, 512, 512, 512},
+		{10000, 1, 100, 100, 1},
+	}
+	for _, test := range tests {
+		if w, h := FitSize(test.width, test.height, test.maxSize); w != test.expectedW || h != test.expectedH {
+			t.Errorf("FitSize(%d, %d, %d) = %dx%d, expected %dx%d", test.width, test.height, test.maxSize, w, h, test.expectedW, test.expectedH)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(10, 10, 14, 12))
+	for x := 10; x < 14; x++ {
+		src.Set(x, 10, color.White)
+		src.Set(x, 11, color.Black)
+	}
+	scaled := Resize(src, 2, 1)
+	if scaled.Rect != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("unexpected bounds %v", scaled.Rect)
+	}
+	for x := 0; x < 2; x++ {
+		if c := scaled.RGBAAt(x, 0); c.R != 127 || c.A != 255 {
+			t.Errorf("expected pixel %d to be the average of black and white, got %v", x, c)
+		}
+	}
+	upscaled := Resize(src, 8, 4)
+	if c := upscaled.RGBAAt(7, 0); c.R != 255 {
+		t.Errorf("expected top right pixel to be white after upscaling, got %v", c)
+	}
+	if c := upscaled.RGBAAt(0, 3); c.R != 0 || c.A != 255 {
+		t.Errorf("expected bottom left pixel to be black after upscaling, got %v", c)
+	}
+}
+
+func TestScaleDown(t *testing.T) {
+	small := image.NewRGBA(image.Rect(0, 0, 50, 20))
+	if ScaleDown(small, 100) != image.Image(small) {
+		t.Error("expected image that already fits to be returned as-is")
+	}
+	if bounds := ScaleDown(image.NewRGBA(image.Rect(0, 0, 400, 200)), 100).Bounds(); bounds != image.Rect(0, 0, 100, 50) {
+		t.Errorf("unexpected bounds %v", bounds)
+	}
+}
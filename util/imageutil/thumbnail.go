@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MakeThumbnail decodes a JPEG, PNG or GIF image, scales it down to fit in a maxSize×maxSize box
+// and encodes it as a JPEG. The returned width and height are the dimensions of the thumbnail.
+//
+//	thumbnail, width, height, err := imageutil.MakeThumbnail(data, 72)
+func MakeThumbnail(data []byte, maxSize int) (thumbnail []byte, width, height int, err error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	img = ScaleDown(img, maxSize)
+	thumbnail, err = encodeJPEG(img, 75)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return thumbnail, img.Bounds().Dx(), img.Bounds().Dy(), nil
+}
+
+// MakeSquareImage decodes a JPEG, PNG or GIF image, crops it to a square from the center, scales it down
+// to at most size×size and encodes it as a JPEG. The returned dimension is the width and height of the result.
+//
+// JPEGs that are already square and at most size×size are returned as-is without re-encoding.
+//
+//	avatar, dimension, err := imageutil.MakeSquareImage(data, 640, 90)
+func MakeSquareImage(data []byte, size int, quality int) (result []byte, dimension int, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode image: %w", err)
+	} else if format == "jpeg" && config.Width == config.Height && config.Width <= size {
+		return data, config.Width, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	cropRect := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+	cropped := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(cropped, cropped.Bounds(), img, cropRect.Min, draw.Src)
+	scaled := ScaleDown(cropped, size)
+	result, err = encodeJPEG(scaled, quality)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return result, scaled.Bounds().Dx(), nil
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	// JPEG doesn't support transparency, so put the image on a white background
+	flattened := image.NewRGBA(img.Bounds())
+	draw.Draw(flattened, flattened.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, flattened.Bounds(), img, img.Bounds().Min, draw.Over)
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, flattened, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestMakeSquareImage(t *testing.T) {
+	// A wide image with a red center and blue sides, so the crop can be checked from the result
+	img := image.NewRGBA(image.Rect(0, 0, 1500, 1000))
+	for y := 0; y < 1000; y++ {
+		for x := 0; x < 1500; x++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x >= 250 && x < 1250 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data, dimension, err := MakeSquareImage(buf.Bytes(), 640, 90)
+	if err != nil {
+		t.Fatal(err)
+	} else if dimension != 640 {
+		t.Errorf("expected dimension 640, got %d", dimension)
+	}
+	result, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if result.Bounds().Dx() != 640 || result.Bounds().Dy() != 640 {
+		t.Fatalf("expected 640x640 result, got %v", result.Bounds())
+	}
+	for _, x := range []int{5, 320, 634} {
+		r, _, b, _ := result.At(x, 320).RGBA()
+		if r < 0xe000 || b > 0x2000 {
+			t.Errorf("expected pixel at x=%d to be red, got r=%x b=%x", x, r, b)
+		}
+	}
+}
+
+func TestMakeSquareImage_PassthroughSquareJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 300)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data, dimension, err := MakeSquareImage(buf.Bytes(), 640, 90)
+	if err != nil {
+		t.Fatal(err)
+	} else if dimension != 300 {
+		t.Errorf("expected dimension 300, got %d", dimension)
+	} else if !bytes.Equal(data, buf.Bytes()) {
+		t.Error("expected square JPEG within the size limit to be returned as-is")
+	}
+
+	buf.Reset()
+	if err = jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 800, 800)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, dimension, err = MakeSquareImage(buf.Bytes(), 640, 90); err != nil {
+		t.Fatal(err)
+	} else if dimension != 640 {
+		t.Errorf("expected oversized JPEG to be scaled down to 640, got %d", dimension)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package linkpreview generates link previews (title, description and thumbnail) for URLs in message text.
+//
+// Pages are fetched through the Fetcher interface, so environments without direct internet access can
+// provide their own implementation, e.g. one that goes through a proxy or a cache.
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/insomnius/whatsmeow/util/imageutil"
+)
+
+// ErrNoURL is returned by Generator.Generate if the text doesn't contain a URL.
+var ErrNoURL = errors.New("no URL found in text")
+
+// ErrResponseTooLarge is returned by HTTPFetcher if the response is larger than the maximum size.
+var ErrResponseTooLarge = errors.New("response is too large")
+
+// Preview contains the data of a link preview.
+type Preview struct {
+	// The URL as it appeared in the message text.
+	MatchedText string
+	// The canonical URL of the page, either from the og:url tag or the URL after following redirects.
+	URL string
+
+	Title       string
+	Description string
+	// The URL of the preview image, if the page has one.
+	ImageURL string
+
+	// A JPEG thumbnail of the preview image, empty if there's no image or fetching it failed.
+	Thumbnail       []byte
+	ThumbnailWidth  int
+	ThumbnailHeight int
+}
+
+// Response is the result of fetching a URL with a Fetcher.
+type Response struct {
+	// The final URL after redirects.
+	URL         string
+	ContentType string
+	Body        []byte
+}
+
+// Fetcher fetches URLs for generating link previews.
+type Fetcher interface {
+	// Fetch downloads the given URL. The body must not be longer than maxSize bytes: implementations
+	// may either truncate it or return an error.
+	Fetch(ctx context.Context, url string, maxSize int64) (*Response, error)
+}
+
+// HTTPFetcher is a Fetcher that downloads URLs directly with net/http.
+type HTTPFetcher struct {
+	// The HTTP client to use. Defaults to a client with a 10 second timeout.
+	Client *http.Client
+	// The user agent to send. Many sites only include OpenGraph tags for known crawlers,
+	// so the default mimics a generic link preview bot.
+	UserAgent string
+}
+
+// DefaultUserAgent is the user agent used by HTTPFetcher if one isn't set.
+const DefaultUserAgent = "Mozilla/5.0 (compatible; whatsmeow link preview bot)"
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Fetch downloads the given URL. HTML pages larger than maxSize are truncated, other responses return ErrResponseTooLarge.
+func (hf *HTTPFetcher) Fetch(ctx context.Context, url string, maxSize int64) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+	userAgent := hf.UserAgent
+	if len(userAgent) == 0 {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,image/*;q=0.9,*/*;q=0.8")
+	client := hf.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) > maxSize {
+		if !isHTML(contentType) {
+			return nil, ErrResponseTooLarge
+		}
+		// The interesting parts are in the <head>, so a truncated page is fine
+		data = data[:maxSize]
+	}
+	return &Response{URL: resp.Request.URL.String(), ContentType: contentType, Body: data}, nil
+}
+
+// Generator generates link previews. The zero value is usable and fetches pages directly with HTTPFetcher.
+type Generator struct {
+	// The fetcher to download pages and images with. Defaults to a HTTPFetcher.
+	Fetcher Fetcher
+	// The maximum number of bytes to read from HTML pages. Defaults to 512 KiB.
+	MaxPageSize int64
+	// The maximum size of preview images to download. Defaults to 5 MiB.
+	MaxImageSize int64
+	// The maximum width and height of generated thumbnails. Defaults to 256 pixels.
+	ThumbnailSize int
+	// If set, thumbnails aren't generated at all.
+	SkipThumbnail bool
+}
+
+// Default limits for Generator.
+const (
+	DefaultMaxPageSize   = 512 * 1024
+	DefaultMaxImageSize  = 5 * 1024 * 1024
+	DefaultThumbnailSize = 256
+)
+
+var defaultFetcher = &HTTPFetcher{}
+
+func (gen *Generator) fetcher() Fetcher {
+	if gen.Fetcher == nil {
+		return defaultFetcher
+	}
+	return gen.Fetcher
+}
+
+func orDefault(val, def int64) int64 {
+	if val <= 0 {
+		return def
+	}
+	return val
+}
+
+// Generate finds the first URL in the given text and generates a preview for it.
+//
+// The preview is returned even if the thumbnail couldn't be generated, the error is only returned
+// if the text has no URL or the page itself couldn't be fetched.
+func (gen *Generator) Generate(ctx context.Context, text string) (*Preview, error) {
+	matched := FindURL(text)
+	if len(matched) == 0 {
+		return nil, ErrNoURL
+	}
+	fetchURL := matched
+	if !strings.Contains(fetchURL, "://") {
+		fetchURL = "https://" + fetchURL
+	}
+	resp, err := gen.fetcher().Fetch(ctx, fetchURL, orDefault(gen.MaxPageSize, DefaultMaxPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", fetchURL, err)
+	}
+	var preview *Preview
+	var imageData []byte
+	if strings.HasPrefix(resp.ContentType, "image/") {
+		preview = &Preview{URL: resp.URL, ImageURL: resp.URL}
+		imageData = resp.Body
+	} else {
+		preview = ParseHTML(resp.URL, resp.Body)
+	}
+	preview.MatchedText = matched
+	if gen.SkipThumbnail || len(preview.ImageURL) == 0 {
+		return preview, nil
+	}
+	if imageData == nil {
+		imgResp, err := gen.fetcher().Fetch(ctx, preview.ImageURL, orDefault(gen.MaxImageSize, DefaultMaxImageSize))
+		if err != nil {
+			return preview, nil
+		}
+		imageData = imgResp.Body
+	}
+	thumbnailSize := gen.ThumbnailSize
+	if thumbnailSize <= 0 {
+		thumbnailSize = DefaultThumbnailSize
+	}
+	preview.Thumbnail, preview.ThumbnailWidth, preview.ThumbnailHeight, _ = imageutil.MakeThumbnail(imageData, thumbnailSize)
+	return preview, nil
+}
+
+var urlRegex = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'` + "`" + `]+`)
+
+// FindURL returns the first http(s) or www. URL in the given text, or an empty string if there isn't one.
+// Trailing punctuation, like a period at the end of a sentence, isn't included in the URL.
+func FindURL(text string) string {
+	match := urlRegex.FindString(text)
+	for len(match) > 0 {
+		last := match[len(match)-1]
+		if strings.IndexByte(".,:;!?", last) >= 0 {
+			match = match[:len(match)-1]
+		} else if last == ')' && strings.Count(match, "(") < strings.Count(match, ")") {
+			match = match[:len(match)-1]
+		} else {
+			break
+		}
+	}
+	if strings.HasSuffix(match, "://") || strings.EqualFold(match, "www") {
+		return ""
+	}
+	return match
+}
+
+func isHTML(contentType string) bool {
+	return len(contentType) == 0 || strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "application/xhtml")
+}
+
+var (
+	metaTagRegex   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributeRegex = regexp.MustCompile(`(?s)([a-zA-Z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titleTagRegex  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// maxDescriptionLength is the number of characters after which descriptions are cut off.
+const maxDescriptionLength = 300
+
+func cleanText(val string) string {
+	return strings.TrimSpace(whitespace.ReplaceAllString(html.UnescapeString(val), " "))
+}
+
+// ParseHTML extracts the preview metadata from a HTML page. OpenGraph and Twitter card tags are preferred,
+// with the <title> tag and the description meta tag as fallbacks. Relative image URLs are resolved against pageURL.
+//
+// The returned preview never has a thumbnail, see imageutil.MakeThumbnail for generating one from ImageURL.
+func ParseHTML(pageURL string, body []byte) *Preview {
+	meta := make(map[string]string)
+	for _, tag := range metaTagRegex.FindAll(body, -1) {
+		var key, content string
+		for _, attr := range attributeRegex.FindAllSubmatch(tag, -1) {
+			val := string(attr[2]) + string(attr[3]) + string(attr[4])
+			switch strings.ToLower(string(attr[1])) {
+			case "property", "name":
+				key = strings.ToLower(val)
+			case "content":
+				content = val
+			}
+		}
+		if _, alreadySet := meta[key]; len(key) > 0 && !alreadySet {
+			meta[key] = cleanText(content)
+		}
+	}
+	pick := func(keys ...string) string {
+		for _, key := range keys {
+			if val := meta[key]; len(val) > 0 {
+				return val
+			}
+		}
+		return ""
+	}
+
+	preview := &Preview{
+		URL:         pageURL,
+		Title:       pick("og:title", "twitter:title"),
+		Description: pick("og:description", "twitter:description", "description"),
+		ImageURL:    pick("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"),
+	}
+	if len(preview.Title) == 0 {
+		if match := titleTagRegex.FindSubmatch(body); match != nil {
+			preview.Title = cleanText(string(match[1]))
+		}
+	}
+	if runes := []rune(preview.Description); len(runes) > maxDescriptionLength {
+		preview.Description = strings.TrimSpace(string(runes[:maxDescriptionLength-1])) + "…"
+	}
+	base, err := url.Parse(pageURL)
+	if err == nil {
+		if canonical := pick("og:url"); len(canonical) > 0 {
+			if parsed, err := base.Parse(canonical); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+				preview.URL = parsed.String()
+			}
+		}
+		if len(preview.ImageURL) > 0 {
+			if parsed, err := base.Parse(preview.ImageURL); err == nil {
+				preview.ImageURL = parsed.String()
+			}
+		}
+	}
+	return preview
+}
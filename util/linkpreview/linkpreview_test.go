@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package linkpreview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestFindURL(t *testing.T) {
+	tests := map[string]string{
+		"no links here":                 "",
+		"see https://example.com/page.": "https://example.com/page",
+		"(https://en.wikipedia.org/wiki/Go_(programming_language))": "https://en.wikipedia.org/wiki/Go_(programming_language)",
+		"visit www.example.com, it's great":                         "www.example.com",
+		"http://a.b/c?d=e&f=g!":                                     "http://a.b/c?d=e&f=g",
+	}
+	for input, expected := range tests {
+		if found := FindURL(input); found != expected {
+			t.Errorf("FindURL(%q) = %q, expected %q", input, found, expected)
+		}
+	}
+}
+
+type mapFetcher map[string]*Response
+
+func (mf mapFetcher) Fetch(_ context.Context, url string, _ int64) (*Response, error) {
+	resp, ok := mf[url]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", url)
+	}
+	return resp, nil
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(0, 0, color.Black)
+	var imgBuf bytes.Buffer
+	_ = png.Encode(&imgBuf, img)
+	page := `<html><head>
+		<title>Fallback title</title>
+		<meta property="og:title" content="Example &amp; friends">
+		<meta name='description' content='A page
+			about examples'>
+		<meta property="og:image" content="/img.png" />
+		<meta property="og:url" content="https://example.com/canonical">
+	</head></html>`
+	gen := &Generator{Fetcher: mapFetcher{
+		"https://example.com/page":    {URL: "https://example.com/page", ContentType: "text/html; charset=utf-8", Body: []byte(page)},
+		"https://example.com/img.png": {URL: "https://example.com/img.png", ContentType: "image/png", Body: imgBuf.Bytes()},
+	}}
+	preview, err := gen.Generate(context.Background(), "check out https://example.com/page!")
+	if err != nil {
+		t.Fatalf("Failed to generate preview: %v", err)
+	}
+	if preview.MatchedText != "https://example.com/page" || preview.URL != "https://example.com/canonical" {
+		t.Errorf("Unexpected URLs in preview: %q, %q", preview.MatchedText, preview.URL)
+	}
+	if preview.Title != "Example & friends" || preview.Description != "A page about examples" {
+		t.Errorf("Unexpected text in preview: %q, %q", preview.Title, preview.Description)
+	}
+	if len(preview.Thumbnail) == 0 || preview.ThumbnailWidth != DefaultThumbnailSize || preview.ThumbnailHeight != DefaultThumbnailSize/2 {
+		t.Errorf("Unexpected thumbnail: %d bytes, %dx%d", len(preview.Thumbnail), preview.ThumbnailWidth, preview.ThumbnailHeight)
+	}
+
+	_, err = gen.Generate(context.Background(), "no links")
+	if err != ErrNoURL {
+		t.Errorf("Expected ErrNoURL, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package mp3 contains a parser for MPEG audio files, which is used for the duration of audio messages.
+//
+// It doesn't decode the audio: the duration is read from the Xing/Info header if the file has one,
+// and otherwise calculated by walking through the frame headers.
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Errors returned by Parse.
+var (
+	ErrNotMP3        = errors.New("data is not an MP3 file")
+	ErrTruncatedTag  = errors.New("ID3 tag is truncated")
+	ErrFreeFormat    = errors.New("free format MP3 files aren't supported")
+	ErrNoAudioFrames = errors.New("mp3 file doesn't contain any audio frames")
+	ErrMixedStreams  = errors.New("mp3 frames have different sample rates")
+)
+
+var errInvalidHeader = errors.New("invalid frame header")
+
+var (
+	id3Magic  = []byte("ID3")
+	xingMagic = []byte("Xing")
+	infoMagic = []byte("Info")
+)
+
+// The maximum number of bytes before the first frame that findFirstFrame searches through.
+const maxLeadingGarbage = 4096
+
+// Info contains metadata of an MP3 file.
+type Info struct {
+	SampleRate int
+	Channels   int
+	// The average bitrate in bits per second.
+	Bitrate  int
+	Frames   int
+	Duration time.Duration
+}
+
+type frameHeader struct {
+	version    int // 1, 2 or 25 (for MPEG 2.5)
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	samples    int
+	length     int
+}
+
+var bitrates = map[[2]int][15]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var sampleRates = map[int][3]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+func parseFrameHeader(data []byte) (*frameHeader, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1]&0xe0 != 0xe0 {
+		return nil, errInvalidHeader
+	}
+	var hdr frameHeader
+	switch (data[1] >> 3) & 0b11 {
+	case 0b00:
+		hdr.version = 25
+	case 0b10:
+		hdr.version = 2
+	case 0b11:
+		hdr.version = 1
+	default:
+		return nil, errInvalidHeader
+	}
+	hdr.layer = 4 - int((data[1]>>1)&0b11)
+	bitrateIndex := int(data[2] >> 4)
+	sampleRateIndex := int((data[2] >> 2) & 0b11)
+	if hdr.layer == 4 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, errInvalidHeader
+	} else if bitrateIndex == 0 {
+		return nil, ErrFreeFormat
+	}
+	tableVersion := hdr.version
+	if tableVersion == 25 {
+		tableVersion = 2
+	}
+	hdr.bitrate = bitrates[[2]int{tableVersion, hdr.layer}][bitrateIndex] * 1000
+	hdr.sampleRate = sampleRates[hdr.version][sampleRateIndex]
+	padding := int((data[2] >> 1) & 1)
+	hdr.channels = 2
+	if data[3]>>6 == 0b11 {
+		hdr.channels = 1
+	}
+	switch {
+	case hdr.layer == 1:
+		hdr.samples = 384
+		hdr.length = (12*hdr.bitrate/hdr.sampleRate + padding) * 4
+	case hdr.layer == 3 && hdr.version != 1:
+		hdr.samples = 576
+		hdr.length = 72*hdr.bitrate/hdr.sampleRate + padding
+	default:
+		hdr.samples = 1152
+		hdr.length = 144*hdr.bitrate/hdr.sampleRate + padding
+	}
+	return &hdr, nil
+}
+
+// skipID3 returns the data after the ID3v2 tag at the start of the file, if there is one.
+func skipID3(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, id3Magic) {
+		return data, nil
+	} else if len(data) < 10 {
+		return nil, ErrTruncatedTag
+	}
+	// The size is a "syncsafe" integer where the highest bit of each byte is zero
+	size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+	size += 10
+	if data[5]&0x10 != 0 {
+		// Footer present
+		size += 10
+	}
+	if size > len(data) {
+		return nil, ErrTruncatedTag
+	}
+	return data[size:], nil
+}
+
+// findFirstFrame skips garbage before the first frame, which some encoders leave after the ID3 tag.
+// The frame is only accepted if it's followed by another valid frame or the end of the file.
+func findFirstFrame(data []byte) []byte {
+	for i := 0; i < len(data)-4 && i < maxLeadingGarbage; i++ {
+		hdr, err := parseFrameHeader(data[i:])
+		if err != nil {
+			continue
+		}
+		next := i + hdr.length
+		if next == len(data) {
+			return data[i:]
+		} else if _, err = parseFrameHeader(data[next:]); err == nil {
+			return data[i:]
+		}
+	}
+	return nil
+}
+
+// IsMP3 checks if the data looks like an MP3 file without parsing all of it.
+func IsMP3(data []byte) bool {
+	data, err := skipID3(data)
+	if err != nil {
+		// The tag is truncated, but the file still starts with one, so it's probably an MP3 file
+		return true
+	}
+	return findFirstFrame(data) != nil
+}
+
+// xingFrameCount returns the number of frames from the Xing or Info header in the given frame, or -1 if there isn't one.
+func xingFrameCount(frame []byte, hdr *frameHeader) int {
+	// The header is after the side information, which depends on the version and channel count
+	offset := 4 + 17
+	if hdr.version == 1 && hdr.channels == 2 {
+		offset = 4 + 32
+	} else if hdr.version != 1 && hdr.channels == 1 {
+		offset = 4 + 9
+	}
+	if len(frame) < offset+12 {
+		return -1
+	}
+	tag := frame[offset : offset+4]
+	if !bytes.Equal(tag, xingMagic) && !bytes.Equal(tag, infoMagic) {
+		return -1
+	}
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	if flags&1 == 0 {
+		return -1
+	}
+	return int(binary.BigEndian.Uint32(frame[offset+8:]))
+}
+
+// Parse parses an MP3 file. Trailing tags like ID3v1 are ignored.
+func Parse(data []byte) (*Info, error) {
+	data, err := skipID3(data)
+	if err != nil {
+		return nil, err
+	}
+	data = findFirstFrame(data)
+	if data == nil {
+		return nil, ErrNotMP3
+	}
+	first, _ := parseFrameHeader(data)
+	info := Info{SampleRate: first.sampleRate, Channels: first.channels}
+	if first.length <= len(data) {
+		if frames := xingFrameCount(data[:first.length], first); frames >= 0 {
+			info.Frames = frames
+			info.Duration = time.Duration(frames) * time.Duration(first.samples) * time.Second / time.Duration(first.sampleRate)
+			if info.Duration > 0 {
+				info.Bitrate = int(int64(len(data)-first.length) * 8 * int64(time.Second) / int64(info.Duration))
+			}
+			return &info, nil
+		}
+	}
+	var samples, audioBytes int64
+	for len(data) >= 4 {
+		hdr, err := parseFrameHeader(data)
+		if err != nil {
+			// Probably an ID3v1 or APE tag at the end of the file
+			break
+		} else if hdr.sampleRate != info.SampleRate {
+			return nil, ErrMixedStreams
+		}
+		length := hdr.length
+		if length > len(data) {
+			length = len(data)
+		}
+		info.Frames++
+		samples += int64(hdr.samples)
+		audioBytes += int64(length)
+		data = data[length:]
+	}
+	if info.Frames == 0 {
+		return nil, ErrNoAudioFrames
+	}
+	info.Duration = time.Duration(samples * int64(time.Second) / int64(info.SampleRate))
+	if info.Duration > 0 {
+		info.Bitrate = int(audioBytes * 8 * int64(time.Second) / int64(info.Duration))
+	}
+	return &info, nil
+}
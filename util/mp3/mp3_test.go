@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// makeFrame returns an empty 128 kbps 44.1 kHz stereo MPEG-1 Layer III frame.
+func makeFrame() []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	return frame
+}
+
+func TestParse(t *testing.T) {
+	id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5, 1, 2, 3, 4, 5}
+	data := append(id3, bytes.Repeat(makeFrame(), 10)...)
+	data = append(data, []byte("TAG")...)
+	if !IsMP3(data) {
+		t.Fatal("Expected IsMP3 to be true")
+	}
+	info, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	expectedDuration := 10 * 1152 * time.Second / 44100
+	if info.Frames != 10 || info.Duration != expectedDuration || info.SampleRate != 44100 || info.Channels != 2 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+	if info.Bitrate < 127000 || info.Bitrate > 129000 {
+		t.Errorf("Expected bitrate to be about 128 kbps, got %d", info.Bitrate)
+	}
+}
+
+func TestParseXing(t *testing.T) {
+	xing := makeFrame()
+	copy(xing[36:], "Xing")
+	binary.BigEndian.PutUint32(xing[40:], 1)
+	binary.BigEndian.PutUint32(xing[44:], 1000)
+	info, err := Parse(append(xing, makeFrame()...))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if info.Frames != 1000 || info.Duration != 1000*1152*time.Second/44100 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if IsMP3([]byte("hello world")) {
+		t.Error("Expected IsMP3 to be false for text")
+	}
+	if _, err := Parse([]byte("hello world")); err != ErrNotMP3 {
+		t.Errorf("Expected ErrNotMP3, got %v", err)
+	}
+}
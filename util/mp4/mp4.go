@@ -0,0 +1,174 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package mp4 contains a minimal parser for MP4 (ISO base media) files, which is used for the metadata of videos.
+//
+// It only reads the box structure: the duration comes from the movie header and the dimensions from the header
+// of the first video track. The media data itself isn't decoded.
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Errors returned by Parse.
+var (
+	ErrNotMP4       = errors.New("data is not an MP4 file")
+	ErrTruncatedBox = errors.New("mp4 box is truncated")
+	ErrMissingMoov  = errors.New("mp4 file doesn't contain a movie box")
+)
+
+// Info contains metadata of an MP4 file.
+type Info struct {
+	// The major brand from the file type box, e.g. "isom" or "mp42".
+	Brand    string
+	Duration time.Duration
+	// The dimensions of the first video track, or zero if the file doesn't have any video tracks.
+	Width  int
+	Height int
+}
+
+// HasVideo returns true if the file has a video track with non-zero dimensions.
+func (info *Info) HasVideo() bool {
+	return info.Width > 0 && info.Height > 0
+}
+
+type box struct {
+	typ  string
+	data []byte
+}
+
+// readBoxes splits the data into boxes.
+func readBoxes(data []byte) ([]box, error) {
+	var boxes []box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return boxes, ErrTruncatedBox
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				return boxes, ErrTruncatedBox
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return boxes, ErrTruncatedBox
+		}
+		boxes = append(boxes, box{typ: typ, data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ string) []byte {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.data
+		}
+	}
+	return nil
+}
+
+// IsMP4 checks if the data starts with an MP4 file type box.
+func IsMP4(data []byte) bool {
+	return len(data) >= 12 && string(data[4:8]) == "ftyp"
+}
+
+// Parse reads the duration and dimensions of an MP4 file.
+func Parse(data []byte) (*Info, error) {
+	if !IsMP4(data) {
+		return nil, ErrNotMP4
+	}
+	// Media data after the movie box may be cut off, so errors are only fatal if the movie box wasn't found
+	boxes, err := readBoxes(data)
+	ftyp := findBox(boxes, "ftyp")
+	moov := findBox(boxes, "moov")
+	if moov == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrMissingMoov
+	}
+	info := &Info{}
+	if len(ftyp) >= 4 {
+		info.Brand = string(ftyp[:4])
+	}
+	moovBoxes, err := readBoxes(moov)
+	if err != nil {
+		return nil, err
+	}
+	if mvhd := findBox(moovBoxes, "mvhd"); len(mvhd) > 0 {
+		info.Duration, err = parseMovieHeader(mvhd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, trak := range moovBoxes {
+		if trak.typ != "trak" {
+			continue
+		}
+		trakBoxes, err := readBoxes(trak.data)
+		if err != nil {
+			return nil, err
+		}
+		width, height, err := parseTrackHeader(findBox(trakBoxes, "tkhd"))
+		if err != nil {
+			return nil, err
+		} else if width > 0 && height > 0 {
+			info.Width, info.Height = width, height
+			break
+		}
+	}
+	return info, nil
+}
+
+func parseMovieHeader(mvhd []byte) (time.Duration, error) {
+	var timescale, duration uint64
+	switch {
+	case mvhd[0] == 1 && len(mvhd) >= 32:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:]))
+		duration = binary.BigEndian.Uint64(mvhd[24:])
+	case mvhd[0] == 0 && len(mvhd) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	default:
+		return 0, ErrTruncatedBox
+	}
+	if timescale == 0 {
+		return 0, nil
+	}
+	seconds, remainder := duration/timescale, duration%timescale
+	return time.Duration(seconds)*time.Second + time.Duration(remainder*uint64(time.Second)/timescale), nil
+}
+
+func parseTrackHeader(tkhd []byte) (width, height int, err error) {
+	if len(tkhd) == 0 {
+		return 0, 0, nil
+	}
+	// The width and height are the last fields, after the version-dependent times and the transformation matrix
+	var offset int
+	if tkhd[0] == 1 {
+		offset = 4 + 8 + 8 + 4 + 4 + 8
+	} else {
+		offset = 4 + 4 + 4 + 4 + 4 + 4
+	}
+	offset += 8 + 2 + 2 + 2 + 2 + 36
+	if len(tkhd) < offset+8 {
+		return 0, 0, ErrTruncatedBox
+	}
+	// Both are 16.16 fixed point numbers
+	width = int(binary.BigEndian.Uint32(tkhd[offset:]) >> 16)
+	height = int(binary.BigEndian.Uint32(tkhd[offset+4:]) >> 16)
+	return width, height, nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mp4
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func makeBox(typ string, contents ...[]byte) []byte {
+	data := make([]byte, 8)
+	copy(data[4:], typ)
+	for _, content := range contents {
+		data = append(data, content...)
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func makeTrackHeader(width, height int) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(height)<<16)
+	return makeBox("tkhd", tkhd)
+}
+
+func TestParse(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 12500)
+	data := append(makeBox("ftyp", []byte("isom\x00\x00\x02\x00")), makeBox("moov",
+		makeBox("mvhd", mvhd),
+		makeBox("trak", makeTrackHeader(0, 0)),
+		makeBox("trak", makeTrackHeader(1280, 720), makeBox("mdia")),
+	)...)
+	// Truncated media data after the movie box shouldn't matter
+	data = append(data, 0, 0, 0x10, 0, 'm', 'd', 'a', 't', 1, 2, 3)
+
+	info, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if info.Brand != "isom" || info.Duration != 12500*time.Millisecond || info.Width != 1280 || info.Height != 720 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+	if _, err = Parse([]byte("not an mp4 file")); err != ErrNotMP4 {
+		t.Errorf("Expected ErrNotMP4, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package oggopus contains a parser for Ogg Opus files, which is used for the metadata of voice messages.
+//
+// It doesn't decode the audio: the duration comes from the Ogg granule positions, and the waveform
+// is estimated from the sizes of the Opus packets, which grow with the amount of sound in the packet.
+package oggopus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Errors returned by Parse.
+var (
+	ErrNotOgg         = errors.New("data is not an Ogg file")
+	ErrNotOpus        = errors.New("ogg stream doesn't contain Opus audio")
+	ErrTruncatedPage  = errors.New("ogg page is truncated")
+	ErrInvalidPacket  = errors.New("invalid Opus packet")
+	ErrMissingHeaders = errors.New("ogg stream is missing the Opus headers")
+)
+
+// The sample rate of Ogg granule positions in Opus streams, which is always 48 kHz regardless of the input rate.
+const granuleRate = 48000
+
+// Packet is a single Opus audio packet.
+type Packet struct {
+	Size     int
+	Duration time.Duration
+}
+
+// Info contains metadata of an Ogg Opus file.
+type Info struct {
+	Channels int
+	// The sample rate of the original audio before encoding. This is informational only.
+	InputSampleRate int
+	Duration        time.Duration
+	Packets         []Packet
+}
+
+var (
+	oggMagic      = []byte("OggS")
+	opusHeadMagic = []byte("OpusHead")
+	opusTagsMagic = []byte("OpusTags")
+)
+
+// IsOggOpus checks if the data looks like an Ogg Opus file without parsing all of it.
+func IsOggOpus(data []byte) bool {
+	if len(data) < 27 || !bytes.HasPrefix(data, oggMagic) {
+		return false
+	}
+	headerEnd := 27 + int(data[26])
+	return len(data) >= headerEnd+len(opusHeadMagic) && bytes.HasPrefix(data[headerEnd:], opusHeadMagic)
+}
+
+// Parse parses an Ogg file containing an Opus stream. If the file has multiple logical streams,
+// only the first one is parsed.
+func Parse(data []byte) (*Info, error) {
+	if !bytes.HasPrefix(data, oggMagic) {
+		return nil, ErrNotOgg
+	}
+	var info Info
+	var serial uint32
+	var lastGranule int64
+	var preSkip int
+	var packet []byte
+	packetIndex := 0
+	for pageIndex := 0; len(data) > 0; pageIndex++ {
+		if len(data) < 27 || !bytes.HasPrefix(data, oggMagic) {
+			return nil, ErrTruncatedPage
+		}
+		granule := int64(binary.LittleEndian.Uint64(data[6:14]))
+		pageSerial := binary.LittleEndian.Uint32(data[14:18])
+		numSegments := int(data[26])
+		if len(data) < 27+numSegments {
+			return nil, ErrTruncatedPage
+		}
+		segments := data[27 : 27+numSegments]
+		bodySize := 0
+		for _, size := range segments {
+			bodySize += int(size)
+		}
+		bodyStart := 27 + numSegments
+		if len(data) < bodyStart+bodySize {
+			return nil, ErrTruncatedPage
+		}
+		body := data[bodyStart : bodyStart+bodySize]
+		data = data[bodyStart+bodySize:]
+		if pageIndex == 0 {
+			serial = pageSerial
+		} else if pageSerial != serial {
+			continue
+		}
+		if granule >= 0 {
+			lastGranule = granule
+		}
+		for _, size := range segments {
+			packet = append(packet, body[:size]...)
+			body = body[size:]
+			if size == 255 {
+				// The packet continues in the next segment
+				continue
+			}
+			switch packetIndex {
+			case 0:
+				if len(packet) < 19 || !bytes.HasPrefix(packet, opusHeadMagic) {
+					return nil, ErrNotOpus
+				}
+				info.Channels = int(packet[9])
+				preSkip = int(binary.LittleEndian.Uint16(packet[10:12]))
+				info.InputSampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+			case 1:
+				if !bytes.HasPrefix(packet, opusTagsMagic) {
+					return nil, ErrMissingHeaders
+				}
+			default:
+				duration, err := PacketDuration(packet)
+				if err != nil {
+					return nil, err
+				}
+				info.Packets = append(info.Packets, Packet{Size: len(packet), Duration: duration})
+			}
+			packetIndex++
+			packet = packet[:0]
+		}
+	}
+	if packetIndex < 2 {
+		return nil, ErrMissingHeaders
+	}
+	if samples := lastGranule - int64(preSkip); samples > 0 {
+		info.Duration = time.Duration(samples) * time.Second / granuleRate
+	} else {
+		// Some encoders don't set granule positions properly, so fall back to the sum of the packet durations
+		for _, pkt := range info.Packets {
+			info.Duration += pkt.Duration
+		}
+	}
+	return &info, nil
+}
+
+// The frame durations of each Opus configuration in units of 2.5 ms, see section 3.1 of RFC 6716.
+var frameDurations = [32]int{
+	4, 8, 16, 24, 4, 8, 16, 24, 4, 8, 16, 24, // SILK
+	4, 8, 4, 8, // Hybrid
+	1, 2, 4, 8, 1, 2, 4, 8, 1, 2, 4, 8, 1, 2, 4, 8, // CELT
+}
+
+// PacketDuration returns the duration of the audio in an Opus packet based on its TOC byte.
+func PacketDuration(packet []byte) (time.Duration, error) {
+	if len(packet) == 0 {
+		return 0, ErrInvalidPacket
+	}
+	frameDuration := time.Duration(frameDurations[packet[0]>>3]) * 2500 * time.Microsecond
+	var frames int
+	switch packet[0] & 0x3 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, ErrInvalidPacket
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	return time.Duration(frames) * frameDuration, nil
+}
+
+// Waveform estimates the loudness of the audio in the given number of evenly sized parts, as values from 0 to 100.
+//
+// The estimate is based on the bitrate of each part: Opus spends very few bits on silence, so quiet parts
+// have a much lower bitrate than parts with speech.
+func (info *Info) Waveform(size int) []byte {
+	waveform := make([]byte, size)
+	var total time.Duration
+	for _, packet := range info.Packets {
+		total += packet.Duration
+	}
+	if total == 0 || size == 0 {
+		return waveform
+	}
+	bitrates := make([]float64, size)
+	durations := make([]time.Duration, size)
+	var elapsed time.Duration
+	for _, packet := range info.Packets {
+		bucket := int(int64(elapsed) * int64(size) / int64(total))
+		if bucket >= size {
+			bucket = size - 1
+		}
+		// Packets of a few bytes are silence (or discontinuous transmission), so they don't count as sound at all
+		if packet.Size > 3 {
+			bitrates[bucket] += float64(packet.Size)
+		}
+		durations[bucket] += packet.Duration
+		elapsed += packet.Duration
+	}
+	var maxRate float64
+	for i := range bitrates {
+		if durations[i] > 0 {
+			bitrates[i] /= durations[i].Seconds()
+		}
+		if bitrates[i] > maxRate {
+			maxRate = bitrates[i]
+		}
+	}
+	if maxRate == 0 {
+		return waveform
+	}
+	for i, rate := range bitrates {
+		waveform[i] = byte(100 * rate / maxRate)
+	}
+	return waveform
+}
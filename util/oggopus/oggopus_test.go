@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oggopus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func makePage(granule int64, packets ...[]byte) []byte {
+	var segments, body []byte
+	for _, packet := range packets {
+		body = append(body, packet...)
+		size := len(packet)
+		for ; size >= 255; size -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(size))
+	}
+	page := make([]byte, 27)
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:], 1234)
+	page[26] = byte(len(segments))
+	return append(append(page, segments...), body...)
+}
+
+func TestParse(t *testing.T) {
+	head := append([]byte("OpusHead"), 1, 1, 0x38, 0x01, 0x80, 0xbb, 0, 0, 0, 0, 0)
+	// TOC byte 0x08 is SILK narrowband with one 20ms frame
+	silence := []byte{0x08, 0, 0}
+	loud := append([]byte{0x08}, bytes.Repeat([]byte{0xaa}, 300)...)
+	var data []byte
+	data = append(data, makePage(0, head)...)
+	data = append(data, makePage(0, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00"))...)
+	data = append(data, makePage(312+48000, silence, silence, loud, loud, silence)...)
+	data = append(data, makePage(312+96000, loud, silence, silence, silence, silence)...)
+	if !IsOggOpus(data) {
+		t.Fatalf("IsOggOpus returned false")
+	}
+	info, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if info.Channels != 1 || info.InputSampleRate != 48000 {
+		t.Errorf("Unexpected header info: %+v", info)
+	}
+	if info.Duration != 2*time.Second {
+		t.Errorf("Expected duration of 2 seconds, got %s", info.Duration)
+	}
+	if len(info.Packets) != 10 || info.Packets[2].Size != 301 || info.Packets[2].Duration != 20*time.Millisecond {
+		t.Errorf("Unexpected packets: %+v", info.Packets)
+	}
+	waveform := info.Waveform(5)
+	expected := []byte{0, 100, 50, 0, 0}
+	if !bytes.Equal(waveform, expected) {
+		t.Errorf("Expected waveform %v, got %v", expected, waveform)
+	}
+
+	_, err = Parse(data[:len(data)-10])
+	if err != ErrTruncatedPage {
+		t.Errorf("Expected ErrTruncatedPage, got %v", err)
+	}
+}
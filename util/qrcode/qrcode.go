@@ -0,0 +1,485 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package qrcode contains a minimal QR code encoder for rendering pairing codes.
+//
+// Only byte mode is supported, which is all that's needed for the data in WhatsApp pairing QR codes.
+package qrcode
+
+import (
+	"errors"
+)
+
+// Level is the error correction level of a QR code.
+type Level int
+
+const (
+	Low      Level = iota // Recovers about 7% of the data
+	Medium                // Recovers about 15% of the data
+	Quartile              // Recovers about 25% of the data
+	High                  // Recovers about 30% of the data
+)
+
+// ErrDataTooLong is returned by Encode if the data doesn't fit in the largest QR code version.
+var ErrDataTooLong = errors.New("data too long to fit in a QR code")
+
+// The format bits of each error correction level, which aren't in the same order as the levels.
+var levelFormatBits = [4]int{1, 0, 3, 2}
+
+// Error correction codewords per block, indexed by level and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// Number of error correction blocks, indexed by level and version.
+var eccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Code is an encoded QR code.
+type Code struct {
+	// Version is the QR code version, from 1 to 40.
+	Version int
+	// Size is the width and height of the code in modules, not including the quiet zone.
+	Size int
+
+	modules    []bool
+	isFunction []bool
+}
+
+// Encode encodes the given data in byte mode into the smallest QR code that fits it at the given error correction level.
+func Encode(data []byte, level Level) (*Code, error) {
+	return encode(data, level, -1)
+}
+
+// encode encodes the data with the given mask, or the mask with the lowest penalty if mask is negative.
+func encode(data []byte, level Level, mask int) (*Code, error) {
+	if level < Low || level > High {
+		level = Medium
+	}
+	version := 1
+	for ; ; version++ {
+		if version > 40 {
+			return nil, ErrDataTooLong
+		}
+		if 4+charCountBits(version)+len(data)*8 <= numDataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := numDataCodewords(version, level) * 8
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+
+	size := version*4 + 17
+	code := &Code{
+		Version:    version,
+		Size:       size,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+	code.drawFunctionPatterns(level)
+	code.drawCodewords(addECCAndInterleave(codewords, version, level))
+
+	if mask < 0 || mask > 7 {
+		minPenalty := -1
+		for i := 0; i < 8; i++ {
+			code.applyMask(i)
+			code.drawFormatBits(level, i)
+			penalty := code.penalty()
+			if minPenalty < 0 || penalty < minPenalty {
+				mask, minPenalty = i, penalty
+			}
+			// Masks are XORs, so applying the same one again undoes it
+			code.applyMask(i)
+		}
+	}
+	code.applyMask(mask)
+	code.drawFormatBits(level, mask)
+	code.isFunction = nil
+	return code, nil
+}
+
+// Dark returns whether the module at the given coordinates is dark. Coordinates outside the code are light.
+func (code *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.modules[y*code.Size+x]
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(val, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*bb = append(*bb, (val>>i)&1 != 0)
+	}
+}
+
+func charCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*eccBlocks[level][version]
+}
+
+func alignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func (code *Code) setFunction(x, y int, dark bool) {
+	code.modules[y*code.Size+x] = dark
+	code.isFunction[y*code.Size+x] = true
+}
+
+func (code *Code) drawFunctionPatterns(level Level) {
+	for i := 0; i < code.Size; i++ {
+		code.setFunction(6, i, i%2 == 0)
+		code.setFunction(i, 6, i%2 == 0)
+	}
+	code.drawFinderPattern(3, 3)
+	code.drawFinderPattern(code.Size-4, 3)
+	code.drawFinderPattern(3, code.Size-4)
+
+	positions := alignmentPatternPositions(code.Version)
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the three corners with finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == len(positions)-1) || (i == len(positions)-1 && j == 0) {
+				continue
+			}
+			code.drawAlignmentPattern(x, y)
+		}
+	}
+
+	// Reserve the format areas with a dummy mask, the real one is drawn after choosing the mask
+	code.drawFormatBits(level, 0)
+	code.drawVersion()
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+	return val
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (code *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < code.Size && yy >= 0 && yy < code.Size {
+				dist := maxInt(abs(dx), abs(dy))
+				code.setFunction(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (code *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			code.setFunction(x+dx, y+dy, maxInt(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+func getBit(val, i int) bool {
+	return (val>>i)&1 != 0
+}
+
+func (code *Code) drawFormatBits(level Level, mask int) {
+	data := levelFormatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// First copy around the top left finder pattern
+	for i := 0; i <= 5; i++ {
+		code.setFunction(8, i, getBit(bits, i))
+	}
+	code.setFunction(8, 7, getBit(bits, 6))
+	code.setFunction(8, 8, getBit(bits, 7))
+	code.setFunction(7, 8, getBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		code.setFunction(14-i, 8, getBit(bits, i))
+	}
+
+	// Second copy split between the other two finder patterns
+	for i := 0; i < 8; i++ {
+		code.setFunction(code.Size-1-i, 8, getBit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		code.setFunction(8, code.Size-15+i, getBit(bits, i))
+	}
+	code.setFunction(8, code.Size-8, true)
+}
+
+func (code *Code) drawVersion() {
+	if code.Version < 7 {
+		return
+	}
+	rem := code.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := code.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := code.Size-11+i%3, i/3
+		code.setFunction(a, b, getBit(bits, i))
+		code.setFunction(b, a, getBit(bits, i))
+	}
+}
+
+func addECCAndInterleave(data []byte, version int, level Level) []byte {
+	numBlocks := eccBlocks[level][version]
+	blockECCLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		dataLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+dataLen]...)
+		k += dataLen
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// Placeholder to make all blocks the same length, skipped when interleaving
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	var root byte = 1
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+func (code *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// Skip the vertical timing pattern
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < code.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = code.Size - 1 - vert
+				}
+				if !code.isFunction[y*code.Size+x] && i < len(data)*8 {
+					code.modules[y*code.Size+x] = getBit(int(data[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+func maskInverts(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (code *Code) applyMask(mask int) {
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.isFunction[y*code.Size+x] && maskInverts(mask, x, y) {
+				code.modules[y*code.Size+x] = !code.modules[y*code.Size+x]
+			}
+		}
+	}
+}
+
+var finderLikePattern = []bool{true, false, true, true, true, false, true, false, false, false, false}
+
+// penalty calculates the penalty score of the current modules as specified in the QR code standard.
+// Lower scores are better, the mask with the lowest score is used.
+func (code *Code) penalty() int {
+	size := code.Size
+	line := make([]bool, size)
+	penalty := 0
+	for direction := 0; direction < 2; direction++ {
+		for a := 0; a < size; a++ {
+			for b := 0; b < size; b++ {
+				if direction == 0 {
+					line[b] = code.modules[a*size+b]
+				} else {
+					line[b] = code.modules[b*size+a]
+				}
+			}
+			// Runs of five or more modules of the same color
+			run := 1
+			for i := 1; i <= size; i++ {
+				if i < size && line[i] == line[i-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += 3 + run - 5
+				}
+				run = 1
+			}
+			// Patterns that look like finder patterns, in either direction
+			for i := 0; i+len(finderLikePattern) <= size; i++ {
+				forward, backward := true, true
+				for j, dark := range finderLikePattern {
+					forward = forward && line[i+j] == dark
+					backward = backward && line[i+len(finderLikePattern)-1-j] == dark
+				}
+				if forward {
+					penalty += 40
+				}
+				if backward {
+					penalty += 40
+				}
+			}
+		}
+	}
+	// 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			color := code.modules[y*size+x]
+			if color {
+				dark++
+			}
+			if x+1 < size && y+1 < size && color == code.modules[y*size+x+1] &&
+				color == code.modules[(y+1)*size+x] && color == code.modules[(y+1)*size+x+1] {
+				penalty += 3
+			}
+		}
+	}
+	// Balance of dark and light modules, 10 points for every 5% away from 50%
+	total := size * size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
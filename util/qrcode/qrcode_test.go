@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodeVersions(t *testing.T) {
+	cases := []struct {
+		length  int
+		level   Level
+		version int
+	}{
+		{17, Low, 1},
+		{18, Low, 2},
+		{14, Medium, 1},
+		{194, High, 14},
+		{195, High, 15},
+		{2953, Low, 40},
+	}
+	for _, tc := range cases {
+		code, err := Encode(bytes.Repeat([]byte{'a'}, tc.length), tc.level)
+		if err != nil {
+			t.Errorf("Failed to encode %d bytes: %v", tc.length, err)
+		} else if code.Version != tc.version || code.Size != tc.version*4+17 {
+			t.Errorf("Expected %d bytes at level %d to use version %d, got %d", tc.length, tc.level, tc.version, code.Version)
+		}
+	}
+	_, err := Encode(bytes.Repeat([]byte{'a'}, 2954), Low)
+	if !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("Expected ErrDataTooLong, got %v", err)
+	}
+}
+
+func TestEncodeKnownCode(t *testing.T) {
+	// Generated with another encoder using the same mask
+	expected := []string{
+		"111111101000001111111",
+		"100000101000001000001",
+		"101110100101001011101",
+		"101110101010101011101",
+		"101110100111001011101",
+		"100000100111101000001",
+		"111111101010101111111",
+		"000000001111100000000",
+		"101101110101101001011",
+		"111010010011111001101",
+		"110111101101000000011",
+		"110101000111001111010",
+		"010100111100100100001",
+		"000000001011001000100",
+		"111111101011100100000",
+		"100000101010000111110",
+		"101110100000111111111",
+		"101110101011001011110",
+		"101110101000101100100",
+		"100000100000010110001",
+		"111111101110010100100",
+	}
+	code, err := encode([]byte("hello"), Medium, 3)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if code.Size != len(expected) {
+		t.Fatalf("Expected size %d, got %d", len(expected), code.Size)
+	}
+	for y, row := range expected {
+		var buf strings.Builder
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				buf.WriteByte('1')
+			} else {
+				buf.WriteByte('0')
+			}
+		}
+		if buf.String() != row {
+			t.Errorf("Row %d: expected %s, got %s", y, row, buf.String())
+		}
+	}
+}
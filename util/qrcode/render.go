@@ -0,0 +1,94 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// QuietZone is the recommended width of the light border around a QR code, in modules.
+const QuietZone = 4
+
+// Image renders the code as a grayscale image with each module being scale pixels wide
+// and a light border of the given number of modules.
+func (code *Code) Image(scale, border int) *image.Gray {
+	if scale < 1 {
+		scale = 1
+	}
+	fullSize := (code.Size + border*2) * scale
+	img := image.NewGray(image.Rect(0, 0, fullSize, fullSize))
+	for y := 0; y < fullSize; y++ {
+		for x := 0; x < fullSize; x++ {
+			if code.Dark(x/scale-border, y/scale-border) {
+				img.SetGray(x, y, color.Gray{Y: 0x00})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img
+}
+
+// PNG renders the code as a PNG image, see Image for the parameters.
+func (code *Code) PNG(scale, border int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, code.Image(scale, border))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as an SVG image with a light border of the given number of modules.
+// The image scales to whatever size it's displayed at, each module is one unit in the view box.
+func (code *Code) SVG(border int) string {
+	fullSize := code.Size + border*2
+	var buf strings.Builder
+	_, _ = fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, fullSize, fullSize)
+	buf.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/><path fill="#000000" d="`)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				_, _ = fmt.Fprintf(&buf, "M%d,%dh1v1h-1z", x+border, y+border)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.String()
+}
+
+// Terminal renders the code as text for printing in a terminal, with a light border of the given number of modules.
+// Each character contains two modules stacked vertically using half block characters, which keeps the code roughly
+// square in most terminal fonts. The output assumes a terminal with a dark background, so dark modules are spaces.
+func (code *Code) Terminal(border int) string {
+	var buf strings.Builder
+	for y := -border; y < code.Size+border; y += 2 {
+		for x := -border; x < code.Size+border; x++ {
+			top, bottom := !code.Dark(x, y), !code.Dark(x, y+1)
+			if y+1 >= code.Size+border {
+				bottom = false
+			}
+			switch {
+			case top && bottom:
+				buf.WriteString("█")
+			case top:
+				buf.WriteString("▀")
+			case bottom:
+				buf.WriteString("▄")
+			default:
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package ratelimit contains a simple token bucket for limiting the throughput of readers in bytes per second.
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// MaxChunkSize is the maximum number of bytes that a limited reader reads at once,
+// so that the rate is applied smoothly instead of in large bursts.
+const MaxChunkSize = 32 * 1024
+
+// Limiter limits throughput to a number of bytes per second. It can be shared by multiple readers,
+// in which case the rate is split between them. A nil *Limiter doesn't limit anything.
+type Limiter struct {
+	lock   sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter that allows the given number of bytes per second. Zero or less means unlimited.
+func New(bytesPerSecond int) *Limiter {
+	return &Limiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// SetRate changes the number of bytes per second the limiter allows. Zero or less means unlimited.
+func (l *Limiter) SetRate(bytesPerSecond int) {
+	l.lock.Lock()
+	l.rate = float64(bytesPerSecond)
+	l.tokens = 0
+	l.last = time.Now()
+	l.lock.Unlock()
+}
+
+func (l *Limiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	l.last = now
+	// Allow bursts of at most one second's worth of data.
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// WaitN consumes n bytes from the limiter, waiting until the rate allows them or the context is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type limitedReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	limiters []*Limiter
+}
+
+// NewReader wraps the given reader so that reads are limited by all the given limiters. Nil limiters are ignored.
+func NewReader(ctx context.Context, reader io.Reader, limiters ...*Limiter) io.Reader {
+	active := make([]*Limiter, 0, len(limiters))
+	for _, limiter := range limiters {
+		if limiter != nil {
+			active = append(active, limiter)
+		}
+	}
+	if len(active) == 0 {
+		return reader
+	}
+	return &limitedReader{ctx: ctx, reader: reader, limiters: active}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > MaxChunkSize {
+		p = p[:MaxChunkSize]
+	}
+	n, err := lr.reader.Read(p)
+	for _, limiter := range lr.limiters {
+		if waitErr := limiter.WaitN(lr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
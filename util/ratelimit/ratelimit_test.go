@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	limiter := New(100 * 1024)
+	data := make([]byte, 150*1024)
+	start := time.Now()
+	// The first second's worth of data is allowed as a burst, the rest should take about half a second.
+	read, err := io.ReadAll(NewReader(context.Background(), bytes.NewReader(data), limiter, nil))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	} else if len(read) != len(data) {
+		t.Fatalf("Expected to read %d bytes, got %d", len(data), len(read))
+	} else if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected reading to take about 500ms, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = io.ReadAll(NewReader(ctx, bytes.NewReader(data), limiter))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded error, got %v", err)
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package webp
+
+import (
+	"container/heap"
+	"math/bits"
+)
+
+const (
+	vp8lSignature = 0x2f
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// Predictor modes, see section 4.1 of the lossless bitstream specification
+	predictorLeft = 1
+	predictorTop  = 2
+	// The predictor transform uses a single block for the whole image (block size 2^9 = 512)
+	predictorSizeBits = 9
+
+	numLiteralCodes         = 256
+	numLengthCodes          = 24
+	numDistanceCodes        = 40
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+	maxBackRefLength        = 4096
+	minBackRefLength        = 3
+
+	// Plane codes for the two distances used for backward references, see section 5.2.2 of the specification
+	planeCodeAbove = 1
+	planeCodeLeft  = 2
+)
+
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (bw *bitWriter) write(value uint32, nbits uint) {
+	bw.acc |= uint64(value) << bw.nacc
+	bw.nacc += nbits
+	for bw.nacc >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nacc -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nacc > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc = 0
+		bw.nacc = 0
+	}
+	return bw.buf
+}
+
+// encodeVP8L encodes ARGB pixels into a VP8L bitstream. The pixel slice is modified by the transforms.
+func encodeVP8L(argb []uint32, width, height int, hasAlpha bool) []byte {
+	var bw bitWriter
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(argb)
+
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorSizeBits-2, 3)
+	mode := choosePredictor(argb, width, height)
+	blocksX := (width + (1 << predictorSizeBits) - 1) >> predictorSizeBits
+	blocksY := (height + (1 << predictorSizeBits) - 1) >> predictorSizeBits
+	modes := make([]uint32, blocksX*blocksY)
+	for i := range modes {
+		modes[i] = mode << 8
+	}
+	writeImageData(&bw, modes, blocksX, false)
+	applyPredictor(argb, width, height, mode)
+
+	bw.write(0, 1) // no more transforms
+	writeImageData(&bw, argb, width, true)
+	return bw.bytes()
+}
+
+func subtractGreen(argb []uint32) {
+	for i, pixel := range argb {
+		green := (pixel >> 8) & 0xff
+		red := ((pixel >> 16) - green) & 0xff
+		blue := (pixel - green) & 0xff
+		argb[i] = pixel&0xff00ff00 | red<<16 | blue
+	}
+}
+
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return (alphaGreen & 0xff00ff00) | (redBlue & 0x00ff00ff)
+}
+
+func predict(argb []uint32, width, x, y int, mode uint32) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	case mode == predictorTop:
+		return argb[i-width]
+	default:
+		return argb[i-1]
+	}
+}
+
+// choosePredictor picks the predictor mode that produces the smallest residuals for the image.
+func choosePredictor(argb []uint32, width, height int) uint32 {
+	bestMode, bestCost := uint32(predictorLeft), -1
+	for _, mode := range []uint32{predictorLeft, predictorTop} {
+		cost := 0
+		for y := 1; y < height; y++ {
+			for x := 1; x < width; x++ {
+				residual := subPixels(argb[y*width+x], predict(argb, width, x, y, mode))
+				for shift := 0; shift < 32; shift += 8 {
+					val := int(int8(residual >> shift))
+					if val < 0 {
+						val = -val
+					}
+					cost += val
+				}
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			bestMode, bestCost = mode, cost
+		}
+	}
+	return bestMode
+}
+
+// applyPredictor replaces the pixels with the residuals of the given predictor mode.
+// It goes backwards so that the predictions are based on the original values.
+func applyPredictor(argb []uint32, width, height int, mode uint32) {
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			i := y*width + x
+			argb[i] = subPixels(argb[i], predict(argb, width, x, y, mode))
+		}
+	}
+}
+
+// encodePrefix converts a backward reference length or distance into a prefix symbol and extra bits.
+func encodePrefix(value int) (symbol int, extraBits uint, extra uint32) {
+	value--
+	if value < 4 {
+		return value, 0, 0
+	}
+	highest := bits.Len(uint(value)) - 1
+	second := (value >> (highest - 1)) & 1
+	extraBits = uint(highest - 1)
+	return 2*highest + second, extraBits, uint32(value) & (1<<extraBits - 1)
+}
+
+type token struct {
+	// The pixel for literals, or the length of the backward reference.
+	value uint32
+	// The plane code of the distance for backward references, zero for literals.
+	planeCode int
+}
+
+func findTokens(argb []uint32, width int) []token {
+	tokens := make([]token, 0, len(argb)/4)
+	for i := 0; i < len(argb); {
+		bestLength, bestPlaneCode := 0, 0
+		for _, candidate := range [2]struct{ distance, planeCode int }{{1, planeCodeLeft}, {width, planeCodeAbove}} {
+			if i < candidate.distance {
+				continue
+			}
+			length := 0
+			for i+length < len(argb) && length < maxBackRefLength && argb[i+length] == argb[i+length-candidate.distance] {
+				length++
+			}
+			if length > bestLength {
+				bestLength, bestPlaneCode = length, candidate.planeCode
+			}
+		}
+		if bestLength >= minBackRefLength {
+			tokens = append(tokens, token{value: uint32(bestLength), planeCode: bestPlaneCode})
+			i += bestLength
+		} else {
+			tokens = append(tokens, token{value: argb[i]})
+			i++
+		}
+	}
+	return tokens
+}
+
+func writeImageData(bw *bitWriter, argb []uint32, width int, isMainImage bool) {
+	bw.write(0, 1) // no color cache
+	if isMainImage {
+		bw.write(0, 1) // no meta prefix codes
+	}
+	tokens := findTokens(argb, width)
+	green := make([]int, numLiteralCodes+numLengthCodes)
+	red := make([]int, numLiteralCodes)
+	blue := make([]int, numLiteralCodes)
+	alpha := make([]int, numLiteralCodes)
+	distance := make([]int, numDistanceCodes)
+	for _, tok := range tokens {
+		if tok.planeCode == 0 {
+			green[(tok.value>>8)&0xff]++
+			red[(tok.value>>16)&0xff]++
+			blue[tok.value&0xff]++
+			alpha[tok.value>>24]++
+		} else {
+			lengthSymbol, _, _ := encodePrefix(int(tok.value))
+			green[numLiteralCodes+lengthSymbol]++
+			distanceSymbol, _, _ := encodePrefix(tok.planeCode)
+			distance[distanceSymbol]++
+		}
+	}
+	greenCode := writePrefixCode(bw, green)
+	redCode := writePrefixCode(bw, red)
+	blueCode := writePrefixCode(bw, blue)
+	alphaCode := writePrefixCode(bw, alpha)
+	distanceCode := writePrefixCode(bw, distance)
+	for _, tok := range tokens {
+		if tok.planeCode == 0 {
+			greenCode.write(bw, int(tok.value>>8)&0xff)
+			redCode.write(bw, int(tok.value>>16)&0xff)
+			blueCode.write(bw, int(tok.value)&0xff)
+			alphaCode.write(bw, int(tok.value>>24))
+		} else {
+			symbol, extraBits, extra := encodePrefix(int(tok.value))
+			greenCode.write(bw, numLiteralCodes+symbol)
+			bw.write(extra, extraBits)
+			symbol, extraBits, extra = encodePrefix(tok.planeCode)
+			distanceCode.write(bw, symbol)
+			bw.write(extra, extraBits)
+		}
+	}
+}
+
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (pc *prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(pc.codes[symbol], uint(pc.lengths[symbol]))
+}
+
+// writePrefixCode writes a prefix code for the given symbol counts and returns it for writing the symbols.
+func writePrefixCode(bw *bitWriter, counts []int) *prefixCode {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	lengths := make([]uint8, len(counts))
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < numLiteralCodes) {
+		// Simple code with one or two symbols
+		bw.write(1, 1)
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		// With a single symbol, it doesn't take any bits to write it
+		return &prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+	}
+	bw.write(0, 1)
+	lengths = huffmanLengths(counts, maxCodeLength)
+	writeCodeLengths(bw, lengths)
+	return &prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// writeCodeLengths writes the code lengths of a normal prefix code, which are themselves prefix coded.
+func writeCodeLengths(bw *bitWriter, lengths []uint8) {
+	type clToken struct {
+		symbol    int
+		extraBits uint
+		extra     uint32
+	}
+	var tokens []clToken
+	clCounts := make([]int, len(codeLengthCodeOrder))
+	for i := 0; i < len(lengths); {
+		if lengths[i] == 0 {
+			run := 1
+			for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+				run++
+			}
+			if run >= 11 {
+				tokens = append(tokens, clToken{18, 7, uint32(run - 11)})
+				clCounts[18]++
+				i += run
+				continue
+			} else if run >= 3 {
+				tokens = append(tokens, clToken{17, 3, uint32(run - 3)})
+				clCounts[17]++
+				i += run
+				continue
+			}
+		}
+		tokens = append(tokens, clToken{symbol: int(lengths[i])})
+		clCounts[lengths[i]]++
+		i++
+	}
+	clLengths := huffmanLengths(clCounts, maxCodeLengthCodeLength)
+	clCodes := canonicalCodes(clLengths)
+	numCodes := 4
+	for i, symbol := range codeLengthCodeOrder {
+		if clLengths[symbol] > 0 && i+1 > numCodes {
+			numCodes = i + 1
+		}
+	}
+	bw.write(uint32(numCodes-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:numCodes] {
+		bw.write(uint32(clLengths[symbol]), 3)
+	}
+	bw.write(0, 1) // code lengths are written for the whole alphabet
+	for _, tok := range tokens {
+		bw.write(clCodes[tok.symbol], uint(clLengths[tok.symbol]))
+		bw.write(tok.extra, tok.extraBits)
+	}
+}
+
+type huffmanNode struct {
+	count       int
+	symbol      int
+	left, right *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count == h[j].count {
+		return h[i].symbol < h[j].symbol
+	}
+	return h[i].count < h[j].count
+}
+func (h huffmanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x interface{}) { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return node
+}
+
+func assignDepths(node *huffmanNode, depth uint8, lengths []uint8) uint8 {
+	if node.left == nil {
+		lengths[node.symbol] = depth
+		return depth
+	}
+	left := assignDepths(node.left, depth+1, lengths)
+	right := assignDepths(node.right, depth+1, lengths)
+	if left > right {
+		return left
+	}
+	return right
+}
+
+// huffmanLengths returns the Huffman code lengths for the given symbol counts, limited to maxLength bits.
+// If only one symbol is used, another symbol is given a code too, as a complete code needs at least two symbols.
+func huffmanLengths(counts []int, maxLength uint8) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	switch len(used) {
+	case 0:
+		return lengths
+	case 1:
+		other := 0
+		if used[0] == 0 {
+			other = 1
+		}
+		lengths[used[0]], lengths[other] = 1, 1
+		return lengths
+	}
+	// If the tree would be too deep, flatten the distribution by raising the smallest counts until it fits
+	for minCount := 1; ; minCount *= 2 {
+		h := make(huffmanHeap, 0, len(used))
+		for _, symbol := range used {
+			count := counts[symbol]
+			if count < minCount {
+				count = minCount
+			}
+			h = append(h, &huffmanNode{count: count, symbol: symbol})
+		}
+		heap.Init(&h)
+		for h.Len() > 1 {
+			a := heap.Pop(&h).(*huffmanNode)
+			b := heap.Pop(&h).(*huffmanNode)
+			heap.Push(&h, &huffmanNode{count: a.count + b.count, symbol: a.symbol, left: a, right: b})
+		}
+		if assignDepths(h[0], 0, lengths) <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical prefix codes to the given code lengths. The codes are bit-reversed,
+// as the bit writer writes the least significant bit first, but prefix codes are read starting from the top bit.
+func canonicalCodes(lengths []uint8) []uint32 {
+	var lengthCounts [maxCodeLength + 1]int
+	for _, length := range lengths {
+		lengthCounts[length]++
+	}
+	lengthCounts[0] = 0
+	var nextCode [maxCodeLength + 2]uint32
+	code := uint32(0)
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + uint32(lengthCounts[length-1])) << 1
+		nextCode[length] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length > 0 {
+			codes[symbol] = bits.Reverse32(nextCode[length]) >> (32 - uint(length))
+			nextCode[length]++
+		}
+	}
+	return codes
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package webp contains a minimal lossless WebP encoder for creating stickers.
+//
+// Both still images and animations are supported, and EXIF metadata (which WhatsApp uses for sticker pack info)
+// can be embedded. The encoder only uses a small subset of the lossless format, so the output is larger than what
+// libwebp would produce, but it's good enough for the flat-colored images typically used as stickers.
+package webp
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"time"
+)
+
+// MaxDimension is the largest width or height that can be encoded.
+const MaxDimension = 1 << 14
+
+// ErrInvalidDimensions is returned if the image is empty or larger than MaxDimension in either direction.
+var ErrInvalidDimensions = errors.New("image dimensions not supported by WebP")
+
+// ErrNoFrames is returned by EncodeAnimation if there are no frames.
+var ErrNoFrames = errors.New("animation has no frames")
+
+// Options contains optional parameters for Encode and EncodeAnimation.
+type Options struct {
+	// Raw EXIF data to embed in the file.
+	EXIF []byte
+}
+
+// Frame is a single frame of an animation.
+type Frame struct {
+	Image    image.Image
+	Duration time.Duration
+}
+
+// VP8X feature flags
+const (
+	flagAnimation = 0x02
+	flagEXIF      = 0x08
+	flagAlpha     = 0x10
+)
+
+// toARGB converts the image to non-premultiplied ARGB pixels. The color of fully transparent pixels
+// is discarded, as it's not visible and would only make the output larger.
+func toARGB(img image.Image) (argb []uint32, hasAlpha bool) {
+	bounds := img.Bounds()
+	argb = make([]uint32, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				argb = append(argb, 0)
+			} else {
+				argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+			}
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+		}
+	}
+	return
+}
+
+func encodeImage(img image.Image) (data []byte, hasAlpha bool, err error) {
+	bounds := img.Bounds()
+	if bounds.Empty() || bounds.Dx() > MaxDimension || bounds.Dy() > MaxDimension {
+		return nil, false, ErrInvalidDimensions
+	}
+	argb, hasAlpha := toARGB(img)
+	return encodeVP8L(argb, bounds.Dx(), bounds.Dy(), hasAlpha), hasAlpha, nil
+}
+
+func appendChunk(buf []byte, fourCC string, data []byte) []byte {
+	buf = append(buf, fourCC...)
+	buf = appendUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+	if len(data)%2 == 1 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func appendUint32(buf []byte, val uint32) []byte {
+	return append(buf, byte(val), byte(val>>8), byte(val>>16), byte(val>>24))
+}
+
+func appendUint24(buf []byte, val int) []byte {
+	return append(buf, byte(val), byte(val>>8), byte(val>>16))
+}
+
+func vp8xChunk(flags byte, width, height int) []byte {
+	data := []byte{flags, 0, 0, 0}
+	data = appendUint24(data, width-1)
+	return appendUint24(data, height-1)
+}
+
+func writeRIFF(w io.Writer, chunks []byte) error {
+	header := make([]byte, 0, 12)
+	header = append(header, "RIFF"...)
+	header = appendUint32(header, uint32(4+len(chunks)))
+	header = append(header, "WEBP"...)
+	_, err := w.Write(append(header, chunks...))
+	return err
+}
+
+// Encode writes the image to w as a lossless WebP.
+func Encode(w io.Writer, img image.Image, opts *Options) error {
+	vp8l, hasAlpha, err := encodeImage(img)
+	if err != nil {
+		return err
+	}
+	var chunks []byte
+	if opts != nil && len(opts.EXIF) > 0 {
+		flags := byte(flagEXIF)
+		if hasAlpha {
+			flags |= flagAlpha
+		}
+		chunks = appendChunk(chunks, "VP8X", vp8xChunk(flags, img.Bounds().Dx(), img.Bounds().Dy()))
+		chunks = appendChunk(chunks, "VP8L", vp8l)
+		chunks = appendChunk(chunks, "EXIF", opts.EXIF)
+	} else {
+		chunks = appendChunk(chunks, "VP8L", vp8l)
+	}
+	return writeRIFF(w, chunks)
+}
+
+// EncodeAnimation writes the frames to w as an animated lossless WebP. The size of the first frame is used as
+// the canvas size and all frames are drawn at the top-left corner without blending, so frames should be the same size.
+// A loop count of zero means the animation loops forever.
+func EncodeAnimation(w io.Writer, frames []Frame, loopCount int, opts *Options) error {
+	if len(frames) == 0 {
+		return ErrNoFrames
+	}
+	canvas := frames[0].Image.Bounds()
+	var flags byte = flagAnimation
+	var frameChunks []byte
+	for _, frame := range frames {
+		vp8l, hasAlpha, err := encodeImage(frame.Image)
+		if err != nil {
+			return err
+		}
+		if hasAlpha {
+			flags |= flagAlpha
+		}
+		bounds := frame.Image.Bounds()
+		frameData := make([]byte, 0, 16+8+len(vp8l))
+		frameData = appendUint24(frameData, 0) // X offset
+		frameData = appendUint24(frameData, 0) // Y offset
+		frameData = appendUint24(frameData, bounds.Dx()-1)
+		frameData = appendUint24(frameData, bounds.Dy()-1)
+		frameData = appendUint24(frameData, int(frame.Duration.Milliseconds()))
+		frameData = append(frameData, 0x02) // don't blend, don't dispose
+		frameData = appendChunk(frameData, "VP8L", vp8l)
+		frameChunks = appendChunk(frameChunks, "ANMF", frameData)
+	}
+	if opts != nil && len(opts.EXIF) > 0 {
+		flags |= flagEXIF
+	}
+	var chunks []byte
+	chunks = appendChunk(chunks, "VP8X", vp8xChunk(flags, canvas.Dx(), canvas.Dy()))
+	anim := make([]byte, 0, 6)
+	anim = append(anim, 0, 0, 0, 0) // background color
+	anim = append(anim, byte(loopCount), byte(loopCount>>8))
+	chunks = appendChunk(chunks, "ANIM", anim)
+	chunks = append(chunks, frameChunks...)
+	if flags&flagEXIF != 0 {
+		chunks = appendChunk(chunks, "EXIF", opts.EXIF)
+	}
+	return writeRIFF(w, chunks)
+}
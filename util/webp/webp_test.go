@@ -0,0 +1,386 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// The decoder below only supports the parts of the lossless format that the encoder uses,
+// but it's written directly from the specification to catch misunderstandings in the encoder.
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (br *bitReader) read(n int) uint32 {
+	var val uint32
+	for i := 0; i < n; i++ {
+		if br.pos/8 >= len(br.data) {
+			panic("unexpected end of data")
+		}
+		bit := (br.data[br.pos/8] >> (br.pos % 8)) & 1
+		val |= uint32(bit) << i
+		br.pos++
+	}
+	return val
+}
+
+type testHuffman struct {
+	single int
+	codes  map[[2]int]int // (length, code) -> symbol
+}
+
+func (th *testHuffman) readSymbol(br *bitReader) int {
+	if th.single >= 0 {
+		return th.single
+	}
+	code := 0
+	for length := 1; length <= 15; length++ {
+		code = code<<1 | int(br.read(1))
+		if symbol, ok := th.codes[[2]int{length, code}]; ok {
+			return symbol
+		}
+	}
+	panic("invalid prefix code")
+}
+
+func buildTestHuffman(lengths []int) *testHuffman {
+	th := &testHuffman{single: -1, codes: make(map[[2]int]int)}
+	nonZero := 0
+	for symbol, length := range lengths {
+		if length > 0 {
+			nonZero++
+			th.single = symbol
+		}
+	}
+	if nonZero == 1 {
+		return th
+	}
+	th.single = -1
+	var counts [16]int
+	for _, length := range lengths {
+		counts[length]++
+	}
+	counts[0] = 0
+	var next [16]int
+	code := 0
+	kraft := 0
+	for length := 1; length <= 15; length++ {
+		code = (code + counts[length-1]) << 1
+		next[length] = code
+		kraft += counts[length] << (15 - length)
+	}
+	if kraft != 1<<15 {
+		panic(fmt.Sprintf("incomplete prefix code (kraft sum %d)", kraft))
+	}
+	for symbol, length := range lengths {
+		if length > 0 {
+			th.codes[[2]int{length, next[length]}] = symbol
+			next[length]++
+		}
+	}
+	return th
+}
+
+func readTestPrefixCode(br *bitReader, alphabetSize int) *testHuffman {
+	lengths := make([]int, alphabetSize)
+	if br.read(1) == 1 {
+		numSymbols := br.read(1) + 1
+		firstBits := 1
+		if br.read(1) == 1 {
+			firstBits = 8
+		}
+		lengths[br.read(firstBits)] = 1
+		if numSymbols == 2 {
+			lengths[br.read(8)] = 1
+		}
+		return buildTestHuffman(lengths)
+	}
+	clLengths := make([]int, 19)
+	numCodes := int(br.read(4)) + 4
+	for i := 0; i < numCodes; i++ {
+		clLengths[codeLengthCodeOrder[i]] = int(br.read(3))
+	}
+	clCode := buildTestHuffman(clLengths)
+	maxSymbol := alphabetSize
+	if br.read(1) == 1 {
+		lengthBits := 2 + 2*int(br.read(3))
+		maxSymbol = 2 + int(br.read(lengthBits))
+	}
+	prev := 8
+	for symbol := 0; symbol < alphabetSize && maxSymbol > 0; maxSymbol-- {
+		clSymbol := clCode.readSymbol(br)
+		switch {
+		case clSymbol < 16:
+			lengths[symbol] = clSymbol
+			symbol++
+			if clSymbol != 0 {
+				prev = clSymbol
+			}
+		case clSymbol == 16:
+			for repeat := 3 + int(br.read(2)); repeat > 0; repeat-- {
+				lengths[symbol] = prev
+				symbol++
+			}
+		case clSymbol == 17:
+			symbol += 3 + int(br.read(3))
+		case clSymbol == 18:
+			symbol += 11 + int(br.read(7))
+		}
+	}
+	return buildTestHuffman(lengths)
+}
+
+func readTestPrefixValue(br *bitReader, symbol int) int {
+	if symbol < 4 {
+		return symbol + 1
+	}
+	extraBits := (symbol - 2) >> 1
+	offset := (2 + symbol&1) << extraBits
+	return offset + int(br.read(extraBits)) + 1
+}
+
+var testPlaneCodes = []int{0x18, 0x07}
+
+func readTestImageData(br *bitReader, width, height int, isMainImage bool) []uint32 {
+	if br.read(1) != 0 {
+		panic("color cache not supported")
+	}
+	if isMainImage && br.read(1) != 0 {
+		panic("meta prefix codes not supported")
+	}
+	green := readTestPrefixCode(br, 256+24)
+	red := readTestPrefixCode(br, 256)
+	blue := readTestPrefixCode(br, 256)
+	alpha := readTestPrefixCode(br, 256)
+	distance := readTestPrefixCode(br, 40)
+	pixels := make([]uint32, 0, width*height)
+	for len(pixels) < width*height {
+		greenSymbol := green.readSymbol(br)
+		if greenSymbol < 256 {
+			r, b, a := red.readSymbol(br), blue.readSymbol(br), alpha.readSymbol(br)
+			pixels = append(pixels, uint32(a)<<24|uint32(r)<<16|uint32(greenSymbol)<<8|uint32(b))
+			continue
+		}
+		length := readTestPrefixValue(br, greenSymbol-256)
+		planeCode := readTestPrefixValue(br, distance.readSymbol(br))
+		var dist int
+		if planeCode > 120 {
+			dist = planeCode - 120
+		} else {
+			distCode := testPlaneCodes[planeCode-1]
+			dist = (distCode>>4)*width + 8 - distCode&0xf
+			if dist < 1 {
+				dist = 1
+			}
+		}
+		for i := 0; i < length; i++ {
+			pixels = append(pixels, pixels[len(pixels)-dist])
+		}
+	}
+	return pixels
+}
+
+func addPixels(a, b uint32) uint32 {
+	alphaGreen := (a & 0xff00ff00) + (b & 0xff00ff00)
+	redBlue := (a & 0x00ff00ff) + (b & 0x00ff00ff)
+	return (alphaGreen & 0xff00ff00) | (redBlue & 0x00ff00ff)
+}
+
+func decodeTestVP8L(data []byte) (width, height int, pixels []uint32) {
+	br := &bitReader{data: data}
+	if br.read(8) != vp8lSignature {
+		panic("invalid signature")
+	}
+	width, height = int(br.read(14))+1, int(br.read(14))+1
+	br.read(1)
+	if br.read(3) != 0 {
+		panic("invalid version")
+	}
+	type transform struct {
+		kind      uint32
+		sizeBits  int
+		subPixels []uint32
+	}
+	var transforms []transform
+	for br.read(1) == 1 {
+		tf := transform{kind: br.read(2)}
+		switch tf.kind {
+		case transformPredictor:
+			tf.sizeBits = int(br.read(3)) + 2
+			blockSize := 1 << tf.sizeBits
+			tf.subPixels = readTestImageData(br, (width+blockSize-1)/blockSize, (height+blockSize-1)/blockSize, false)
+		case transformSubtractGreen:
+		default:
+			panic("unsupported transform")
+		}
+		transforms = append(transforms, tf)
+	}
+	pixels = readTestImageData(br, width, height, true)
+	for i := len(transforms) - 1; i >= 0; i-- {
+		tf := transforms[i]
+		switch tf.kind {
+		case transformSubtractGreen:
+			for j, pixel := range pixels {
+				green := (pixel >> 8) & 0xff
+				pixels[j] = pixel&0xff00ff00 | ((pixel>>16+green)&0xff)<<16 | (pixel+green)&0xff
+			}
+		case transformPredictor:
+			blocksX := (width + 1<<tf.sizeBits - 1) >> tf.sizeBits
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					i := y*width + x
+					var pred uint32
+					mode := (tf.subPixels[(y>>tf.sizeBits)*blocksX+x>>tf.sizeBits] >> 8) & 0xff
+					switch {
+					case x == 0 && y == 0:
+						pred = 0xff000000
+					case y == 0:
+						pred = pixels[i-1]
+					case x == 0:
+						pred = pixels[i-width]
+					case mode == 0:
+						pred = 0xff000000
+					case mode == 1:
+						pred = pixels[i-1]
+					case mode == 2:
+						pred = pixels[i-width]
+					default:
+						panic("unsupported predictor mode")
+					}
+					pixels[i] = addPixels(pixels[i], pred)
+				}
+			}
+		}
+	}
+	return
+}
+
+type testChunk struct {
+	fourCC string
+	data   []byte
+}
+
+func parseTestRIFF(t *testing.T, data []byte) []testChunk {
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" || int(binary.LittleEndian.Uint32(data[4:8])) != len(data)-8 {
+		t.Fatalf("Invalid RIFF header")
+	}
+	return parseTestChunks(t, data[12:])
+}
+
+func parseTestChunks(t *testing.T, data []byte) (chunks []testChunk) {
+	for len(data) > 0 {
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		chunks = append(chunks, testChunk{string(data[0:4]), data[8 : 8+size]})
+		data = data[8+size+size%2:]
+	}
+	return
+}
+
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < width/3:
+				// Flat area
+				img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 30, B: 90, A: 255})
+			case x < 2*width/3:
+				// Gradient with transparency
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: uint8(y * 4)})
+			default:
+				// Noise
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func checkTestPixels(t *testing.T, img image.Image, vp8l []byte) {
+	width, height, pixels := decodeTestVP8L(vp8l)
+	if width != img.Bounds().Dx() || height != img.Bounds().Dy() {
+		t.Fatalf("Expected %dx%d image, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy(), width, height)
+	}
+	expected, _ := toARGB(img)
+	for i := range expected {
+		if pixels[i] != expected[i] {
+			t.Fatalf("Pixel %d,%d: expected %08x, got %08x", i%width, i/width, expected[i], pixels[i])
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {2, 3}, {97, 64}, {512, 512}} {
+		img := testImage(size[0], size[1])
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, nil); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		chunks := parseTestRIFF(t, buf.Bytes())
+		if len(chunks) != 1 || chunks[0].fourCC != "VP8L" {
+			t.Fatalf("Unexpected chunks in simple file")
+		}
+		checkTestPixels(t, img, chunks[0].data)
+	}
+
+	var buf bytes.Buffer
+	exif := []byte("exif data")
+	if err := Encode(&buf, testImage(10, 10), &Options{EXIF: exif}); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	chunks := parseTestRIFF(t, buf.Bytes())
+	if len(chunks) != 3 || chunks[0].fourCC != "VP8X" || chunks[1].fourCC != "VP8L" || chunks[2].fourCC != "EXIF" {
+		t.Fatalf("Unexpected chunks in extended file: %+v", chunks)
+	} else if chunks[0].data[0] != flagEXIF|flagAlpha || !bytes.Equal(chunks[2].data, exif) {
+		t.Errorf("Unexpected extended file contents")
+	}
+}
+
+func TestEncodeAnimation(t *testing.T) {
+	frames := []Frame{
+		{Image: testImage(32, 32), Duration: 100 * time.Millisecond},
+		{Image: image.NewNRGBA(image.Rect(0, 0, 32, 32)), Duration: 250 * time.Millisecond},
+	}
+	var buf bytes.Buffer
+	if err := EncodeAnimation(&buf, frames, 0, nil); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	chunks := parseTestRIFF(t, buf.Bytes())
+	if len(chunks) != 4 || chunks[0].fourCC != "VP8X" || chunks[1].fourCC != "ANIM" || chunks[0].data[0]&flagAnimation == 0 {
+		t.Fatalf("Unexpected chunks in animated file")
+	}
+	for i, chunk := range chunks[2:] {
+		if chunk.fourCC != "ANMF" {
+			t.Fatalf("Expected ANMF chunk, got %s", chunk.fourCC)
+		}
+		duration := int(chunk.data[12]) | int(chunk.data[13])<<8 | int(chunk.data[14])<<16
+		if duration != int(frames[i].Duration.Milliseconds()) {
+			t.Errorf("Frame %d: expected duration %d, got %d", i, frames[i].Duration.Milliseconds(), duration)
+		}
+		frameChunks := parseTestChunks(t, chunk.data[16:])
+		if len(frameChunks) != 1 || frameChunks[0].fourCC != "VP8L" {
+			t.Fatalf("Unexpected chunks in frame %d", i)
+		}
+		checkTestPixels(t, frames[i].Image, frameChunks[0].data)
+	}
+
+	if err := EncodeAnimation(&buf, nil, 0, nil); !errors.Is(err, ErrNoFrames) {
+		t.Errorf("Expected ErrNoFrames, got %v", err)
+	}
+}
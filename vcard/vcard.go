@@ -0,0 +1,373 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package vcard contains a builder and parser for the vCards in WhatsApp contact messages.
+//
+//	msg := vcard.BuildMessage(&vcard.Card{
+//		FullName: "Alice",
+//		Phones:   []vcard.Phone{{Number: "+1 555 123 4567", Type: "CELL"}},
+//	})
+//	resp, err := cli.SendMessage(context.Background(), chat, "", msg)
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/types"
+)
+
+// Errors returned by Parse and ParseAll.
+var (
+	ErrNoVCard          = errors.New("no vCard found")
+	ErrUnterminatedCard = errors.New("vCard is missing END:VCARD")
+)
+
+// Phone is a phone number in a vCard.
+type Phone struct {
+	// The phone number as written in the card, e.g. "+1 555-123-4567".
+	Number string
+	// The type of the number, e.g. CELL, HOME or WORK. Multiple types are separated with commas.
+	Type string
+	// A custom label for the number, as set by the X-ABLabel property.
+	Label string
+	// The WhatsApp user the number belongs to. When parsing, this is taken from the waid parameter if present,
+	// or derived from the number if it's in international format. It's empty if the number can't be mapped.
+	JID types.JID
+}
+
+// Card is a single contact.
+type Card struct {
+	// The formatted name of the contact. This is required and is also used as the display name of the message.
+	FullName string
+	// The structured name fields. If they're all empty when building, FullName is used as the first name.
+	FirstName  string
+	LastName   string
+	MiddleName string
+	Prefix     string
+	Suffix     string
+
+	Organization string
+	Title        string
+	Emails       []string
+	URLs         []string
+	Phones       []Phone
+}
+
+// DisplayName returns the name to show for the contact, i.e. the full name or the structured name if it's not set.
+func (c *Card) DisplayName() string {
+	if len(c.FullName) > 0 {
+		return c.FullName
+	}
+	return strings.Join(strings.Fields(strings.Join([]string{c.Prefix, c.FirstName, c.MiddleName, c.LastName, c.Suffix}, " ")), " ")
+}
+
+// JIDs returns the WhatsApp users of all phone numbers in the card that could be mapped to one.
+func (c *Card) JIDs() []types.JID {
+	var jids []types.JID
+	for _, phone := range c.Phones {
+		if !phone.JID.IsEmpty() {
+			jids = append(jids, phone.JID)
+		}
+	}
+	return jids
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", "", ",", `\,`, ";", `\;`)
+
+func escape(val string) string {
+	return escaper.Replace(val)
+}
+
+// String encodes the card as a vCard 3.0 in the format used by WhatsApp.
+func (c *Card) String() string {
+	var buf strings.Builder
+	writeLine := func(name, value string) {
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	writeLine("BEGIN", "VCARD")
+	writeLine("VERSION", "3.0")
+	firstName := c.FirstName
+	if len(firstName) == 0 && len(c.LastName) == 0 && len(c.MiddleName) == 0 {
+		firstName = c.FullName
+	}
+	writeLine("N", strings.Join([]string{escape(c.LastName), escape(firstName), escape(c.MiddleName), escape(c.Prefix), escape(c.Suffix)}, ";"))
+	writeLine("FN", escape(c.DisplayName()))
+	if len(c.Organization) > 0 {
+		writeLine("ORG", escape(c.Organization))
+	}
+	if len(c.Title) > 0 {
+		writeLine("TITLE", escape(c.Title))
+	}
+	for i, phone := range c.Phones {
+		name := "TEL"
+		if len(phone.Label) > 0 {
+			name = fmt.Sprintf("item%d.TEL", i+1)
+		}
+		phoneType := phone.Type
+		if len(phoneType) == 0 {
+			phoneType = "CELL"
+		}
+		for _, part := range strings.Split(phoneType, ",") {
+			name += ";type=" + strings.ToUpper(strings.TrimSpace(part))
+		}
+		jid := phone.JID
+		if jid.IsEmpty() {
+			jid = phoneToJID(phone.Number)
+		}
+		if !jid.IsEmpty() {
+			name += ";waid=" + jid.User
+		}
+		writeLine(name, escape(phone.Number))
+		if len(phone.Label) > 0 {
+			writeLine(fmt.Sprintf("item%d.X-ABLabel", i+1), escape(phone.Label))
+		}
+	}
+	for _, email := range c.Emails {
+		writeLine("EMAIL;type=INTERNET", escape(email))
+	}
+	for _, url := range c.URLs {
+		writeLine("URL", escape(url))
+	}
+	writeLine("END", "VCARD")
+	return buf.String()
+}
+
+// phoneToJID maps a phone number in international format (starting with +) to a WhatsApp user JID.
+func phoneToJID(number string) types.JID {
+	number = strings.TrimSpace(number)
+	if !strings.HasPrefix(number, "+") {
+		return types.EmptyJID
+	}
+	var digits strings.Builder
+	for _, char := range number[1:] {
+		if char >= '0' && char <= '9' {
+			digits.WriteRune(char)
+		} else if !strings.ContainsRune(" -().", char) {
+			return types.EmptyJID
+		}
+	}
+	if digits.Len() < 7 || digits.Len() > 15 {
+		return types.EmptyJID
+	}
+	return types.NewJID(digits.String(), types.DefaultUserServer)
+}
+
+// ContactMessage builds a ContactMessage containing the card.
+func (c *Card) ContactMessage() *waProto.ContactMessage {
+	return &waProto.ContactMessage{
+		DisplayName: proto.String(c.DisplayName()),
+		Vcard:       proto.String(c.String()),
+	}
+}
+
+// BuildMessage builds a message containing the given contacts. A single contact is sent as a ContactMessage,
+// multiple contacts as a ContactsArrayMessage.
+func BuildMessage(cards ...*Card) *waProto.Message {
+	if len(cards) == 1 {
+		return &waProto.Message{ContactMessage: cards[0].ContactMessage()}
+	}
+	contacts := make([]*waProto.ContactMessage, len(cards))
+	for i, card := range cards {
+		contacts[i] = card.ContactMessage()
+	}
+	return &waProto.Message{ContactsArrayMessage: &waProto.ContactsArrayMessage{
+		DisplayName: proto.String(fmt.Sprintf("%d contacts", len(cards))),
+		Contacts:    contacts,
+	}}
+}
+
+// ParseMessage parses the vCards in a ContactMessage or ContactsArrayMessage. Other message types return no cards.
+// Contacts with invalid vCards are skipped, the returned error is the first parsing error that occurred.
+func ParseMessage(msg *waProto.Message) ([]*Card, error) {
+	var contacts []*waProto.ContactMessage
+	if msg.GetContactMessage() != nil {
+		contacts = []*waProto.ContactMessage{msg.GetContactMessage()}
+	} else {
+		contacts = msg.GetContactsArrayMessage().GetContacts()
+	}
+	var cards []*Card
+	var firstErr error
+	for _, contact := range contacts {
+		card, err := Parse(contact.GetVcard())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(card.FullName) == 0 {
+			card.FullName = contact.GetDisplayName()
+		}
+		cards = append(cards, card)
+	}
+	return cards, firstErr
+}
+
+// Parse parses the first vCard in the given string.
+func Parse(data string) (*Card, error) {
+	cards, err := parse(data, true)
+	if err != nil {
+		return nil, err
+	}
+	return cards[0], nil
+}
+
+// ParseAll parses all vCards in the given string.
+func ParseAll(data string) ([]*Card, error) {
+	return parse(data, false)
+}
+
+type property struct {
+	group  string
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// unfoldLines splits the data into lines, joining folded lines (ones starting with a space or tab)
+// to the previous line.
+func unfoldLines(data string) []string {
+	rawLines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	lines := make([]string, 0, len(rawLines))
+	for _, line := range rawLines {
+		if len(lines) > 0 && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			lines[len(lines)-1] += line[1:]
+		} else if len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, strings.TrimRight(line, "\r"))
+		}
+	}
+	return lines
+}
+
+func parseProperty(line string) (prop property, ok bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return
+	}
+	prop.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+	if dot := strings.IndexByte(prop.name, '.'); dot >= 0 {
+		prop.group = prop.name[:dot]
+		prop.name = prop.name[dot+1:]
+	}
+	prop.params = make(map[string][]string)
+	for _, param := range parts[1:] {
+		key, val := "TYPE", param
+		if eq := strings.IndexByte(param, '='); eq >= 0 {
+			key, val = strings.ToUpper(param[:eq]), param[eq+1:]
+		}
+		for _, v := range strings.Split(val, ",") {
+			prop.params[key] = append(prop.params[key], strings.Trim(v, `"`))
+		}
+	}
+	return prop, true
+}
+
+// splitValue splits a structured value on unescaped separators and unescapes the parts.
+func splitValue(value string, sep byte) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		if char == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				current.WriteByte('\n')
+			default:
+				current.WriteByte(value[i])
+			}
+		} else if char == sep {
+			parts = append(parts, current.String())
+			current.Reset()
+		} else {
+			current.WriteByte(char)
+		}
+	}
+	return append(parts, current.String())
+}
+
+func unescape(value string) string {
+	return splitValue(value, 0)[0]
+}
+
+func parse(data string, onlyFirst bool) ([]*Card, error) {
+	var cards []*Card
+	var card *Card
+	var labels map[string]string
+	for _, line := range unfoldLines(data) {
+		prop, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		if prop.name == "BEGIN" && strings.EqualFold(prop.value, "VCARD") {
+			card = &Card{}
+			labels = make(map[string]string)
+			continue
+		} else if card == nil {
+			continue
+		}
+		switch prop.name {
+		case "END":
+			for i, phone := range card.Phones {
+				// The group is temporarily stored in the label field until all labels are known
+				if len(phone.Label) > 0 {
+					card.Phones[i].Label = labels[phone.Label]
+				}
+			}
+			cards = append(cards, card)
+			card = nil
+			if onlyFirst {
+				return cards, nil
+			}
+		case "FN":
+			card.FullName = unescape(prop.value)
+		case "N":
+			parts := append(splitValue(prop.value, ';'), "", "", "", "")
+			card.LastName, card.FirstName, card.MiddleName, card.Prefix, card.Suffix = parts[0], parts[1], parts[2], parts[3], parts[4]
+		case "ORG":
+			card.Organization = strings.TrimRight(strings.Join(splitValue(prop.value, ';'), ", "), ", ")
+		case "TITLE":
+			card.Title = unescape(prop.value)
+		case "EMAIL":
+			card.Emails = append(card.Emails, unescape(prop.value))
+		case "URL":
+			card.URLs = append(card.URLs, unescape(prop.value))
+		case "X-ABLABEL":
+			labels[prop.group] = unescape(prop.value)
+		case "TEL":
+			phone := Phone{Number: unescape(prop.value), Label: prop.group}
+			var phoneTypes []string
+			for _, phoneType := range prop.params["TYPE"] {
+				if upper := strings.ToUpper(phoneType); upper != "VOICE" && upper != "PREF" {
+					phoneTypes = append(phoneTypes, upper)
+				}
+			}
+			phone.Type = strings.Join(phoneTypes, ",")
+			if waid := prop.params["WAID"]; len(waid) > 0 && len(waid[0]) > 0 {
+				phone.JID = types.NewJID(waid[0], types.DefaultUserServer)
+			} else {
+				phone.JID = phoneToJID(phone.Number)
+			}
+			card.Phones = append(card.Phones, phone)
+		}
+	}
+	if card != nil {
+		return cards, ErrUnterminatedCard
+	} else if len(cards) == 0 {
+		return nil, ErrNoVCard
+	}
+	return cards, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package vcard
+
+import (
+	"testing"
+
+	"github.com/insomnius/whatsmeow/types"
+)
+
+func TestParse(t *testing.T) {
+	card, err := Parse("BEGIN:VCARD\r\nVERSION:3.0\r\nN:Doe;John;;;\r\nFN:John Doe\\, Jr.\r\nORG:Example Inc.;\r\n" +
+		"item1.TEL;waid=15551234567:+1 555-123-4567\r\nitem1.X-ABLabel:Mobile\r\n" +
+		"TEL;TYPE=HOME,VOICE:+44 20 7946 0958\r\nTEL;type=WORK:555 0100\r\n" +
+		"EMAIL;type=INTERNET:john@exa\r\n mple.com\r\nEND:VCARD\r\n")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if card.FullName != "John Doe, Jr." || card.FirstName != "John" || card.LastName != "Doe" || card.Organization != "Example Inc." {
+		t.Errorf("Unexpected names: %+v", card)
+	}
+	if len(card.Emails) != 1 || card.Emails[0] != "john@example.com" {
+		t.Errorf("Unexpected emails: %v", card.Emails)
+	}
+	expectedPhones := []Phone{
+		{Number: "+1 555-123-4567", Label: "Mobile", JID: types.NewJID("15551234567", types.DefaultUserServer)},
+		{Number: "+44 20 7946 0958", Type: "HOME", JID: types.NewJID("442079460958", types.DefaultUserServer)},
+		{Number: "555 0100", Type: "WORK"},
+	}
+	if len(card.Phones) != len(expectedPhones) {
+		t.Fatalf("Expected %d phones, got %+v", len(expectedPhones), card.Phones)
+	}
+	for i, phone := range card.Phones {
+		if phone != expectedPhones[i] {
+			t.Errorf("Phone #%d: expected %+v, got %+v", i+1, expectedPhones[i], phone)
+		}
+	}
+
+	if _, err = Parse("BEGIN:VCARD\nFN:Foo\n"); err != ErrUnterminatedCard {
+		t.Errorf("Expected ErrUnterminatedCard, got %v", err)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	original := &Card{
+		FullName:     "Alice; Bob",
+		Organization: "Example",
+		Phones:       []Phone{{Number: "+1 555 123 4567", Label: "Work phone"}, {Number: "0401234567", Type: "home"}},
+	}
+	msg := BuildMessage(original)
+	if msg.GetContactMessage().GetDisplayName() != original.FullName {
+		t.Errorf("Unexpected display name %q", msg.GetContactMessage().GetDisplayName())
+	}
+	cards, err := ParseMessage(msg)
+	if err != nil || len(cards) != 1 {
+		t.Fatalf("Failed to parse built message: %v", err)
+	}
+	card := cards[0]
+	if card.FullName != original.FullName || card.FirstName != original.FullName || card.Organization != original.Organization {
+		t.Errorf("Names didn't survive a round trip: %+v", card)
+	}
+	if len(card.Phones) != 2 || card.Phones[0].JID.User != "15551234567" || card.Phones[0].Label != "Work phone" ||
+		card.Phones[0].Type != "CELL" || !card.Phones[1].JID.IsEmpty() || card.Phones[1].Type != "HOME" {
+		t.Errorf("Phones didn't survive a round trip: %+v", card.Phones)
+	}
+
+	multi := BuildMessage(original, &Card{FullName: "Carol"})
+	if len(multi.GetContactsArrayMessage().GetContacts()) != 2 {
+		t.Errorf("Expected contacts array message with 2 contacts")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waProto "github.com/insomnius/whatsmeow/binary/proto"
+	"github.com/insomnius/whatsmeow/util/oggopus"
+)
+
+// VoiceWaveformSize is the number of values in the waveform of voice messages.
+const VoiceWaveformSize = 64
+
+// VoiceMimetype is the mime type that the official clients use for voice messages.
+const VoiceMimetype = "audio/ogg; codecs=opus"
+
+// AudioEncoder transcodes audio into Ogg Opus for voice messages.
+type AudioEncoder interface {
+	EncodeOggOpus(ctx context.Context, input []byte) ([]byte, error)
+}
+
+// FFmpegAudioEncoder is an AudioEncoder that runs ffmpeg. It accepts any input format that ffmpeg supports.
+type FFmpegAudioEncoder struct {
+	// The path to the ffmpeg binary. Defaults to "ffmpeg", i.e. looking it up in PATH.
+	Path string
+	// The bitrate in bits per second. Defaults to 32 kbps.
+	Bitrate int
+}
+
+// EncodeOggOpus transcodes the input into mono 48 kHz Ogg Opus.
+func (fe *FFmpegAudioEncoder) EncodeOggOpus(ctx context.Context, input []byte) ([]byte, error) {
+	path := fe.Path
+	if len(path) == 0 {
+		path = "ffmpeg"
+	}
+	bitrate := fe.Bitrate
+	if bitrate <= 0 {
+		bitrate = 32000
+	}
+	cmd := exec.CommandContext(ctx, path,
+		"-hide_banner", "-loglevel", "error",
+		"-i", "pipe:0", "-vn", "-ac", "1", "-ar", "48000",
+		"-c:a", "libopus", "-b:a", strconv.Itoa(bitrate), "-application", "voip",
+		"-f", "ogg", "pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w (%s)", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// BuildVoiceNote builds an audio message with the voice note flag, duration and waveform for already uploaded
+// Ogg Opus audio. The duration and waveform are read from the audio file itself.
+func (cli *Client) BuildVoiceNote(oggOpus []byte, uploaded UploadResponse) (*waProto.Message, error) {
+	info, err := oggopus.Parse(oggOpus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audio: %w", err)
+	}
+	return buildVoiceNote(info, uploaded), nil
+}
+
+func buildVoiceNote(info *oggopus.Info, uploaded UploadResponse) *waProto.Message {
+	return &waProto.Message{AudioMessage: &waProto.AudioMessage{
+		Url:               proto.String(uploaded.URL),
+		DirectPath:        proto.String(uploaded.DirectPath),
+		MediaKey:          uploaded.MediaKey,
+		Mimetype:          proto.String(VoiceMimetype),
+		FileEncSha256:     uploaded.FileEncSHA256,
+		FileSha256:        uploaded.FileSHA256,
+		FileLength:        proto.Uint64(uploaded.FileLength),
+		Seconds:           proto.Uint32(uint32((info.Duration + time.Second/2) / time.Second)),
+		Ptt:               proto.Bool(true),
+		Waveform:          info.Waveform(VoiceWaveformSize),
+		MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+	}}
+}
+
+// UploadVoiceNote uploads the given audio as a voice note and returns a message containing it.
+//
+// Voice notes must be Ogg Opus for the official clients to show them properly. If the input is in another format,
+// it's transcoded with the given encoder, e.g. FFmpegAudioEncoder. The encoder can be nil if the input is already
+// Ogg Opus.
+//
+//	msg, err := cli.UploadVoiceNote(ctx, mp3Data, &whatsmeow.FFmpegAudioEncoder{})
+//	// handle error
+//	resp, err := cli.SendMessage(ctx, chat, "", msg)
+func (cli *Client) UploadVoiceNote(ctx context.Context, audio []byte, encoder AudioEncoder) (*waProto.Message, error) {
+	if !oggopus.IsOggOpus(audio) {
+		if encoder == nil {
+			return nil, ErrAudioEncoderRequired
+		}
+		var err error
+		audio, err = encoder.EncodeOggOpus(ctx, audio)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transcode audio: %w", err)
+		}
+	}
+	// Parse before uploading to avoid uploading broken files
+	info, err := oggopus.Parse(audio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audio: %w", err)
+	}
+	uploaded, err := cli.upload(ctx, audio, MediaAudio, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload voice note: %w", err)
+	}
+	return buildVoiceNote(info, uploaded), nil
+}